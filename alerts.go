@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultAlertTimeout 是发送单条告警的默认超时时间。
+	DefaultAlertTimeout = 10 * time.Second
+	// defaultAlertContentType 是告警请求默认的 Content-Type。
+	defaultAlertContentType = "application/json"
+	// defaultAlertTemplate 是未配置模板时使用的告警正文。
+	defaultAlertTemplate = `{"time":{{json .Time}},"node":{{json .Node}},"seq":{{.Seq}},"stream_id":{{json .StreamID}},"event":{{json .Type}},"message":{{json .Message}},"labels":{{json .Labels}}}`
+)
+
+// AlertConfig 表示告警路由配置：按流标签把事件发送到不同的通知渠道。
+type AlertConfig struct {
+	// Channels 是按名称引用的通知渠道。
+	Channels map[string]AlertChannel `yaml:"channels"`
+	// Routes 是按顺序匹配的路由规则，默认命中第一条后停止。
+	Routes []AlertRoute `yaml:"routes"`
+	// Locale 是渠道未指定语言时使用的语言，默认 en。
+	Locale string `yaml:"locale,omitempty"`
+}
+
+// AlertChannel 表示一个通过 HTTP POST 接收告警的通知渠道（webhook、IM 机器人等），
+// 也可以交给插件发送。
+type AlertChannel struct {
+	// URL 是接收告警的地址，与 Plugin 二选一。
+	URL string `yaml:"url,omitempty"`
+	// Plugin 是发送告警的插件名称，与 URL 二选一。
+	Plugin string `yaml:"plugin,omitempty"`
+	// ContentType 是请求的 Content-Type，默认 application/json。
+	ContentType string `yaml:"content_type,omitempty"`
+	// Template 是告警正文模板（Go template），路由上的模板优先。
+	Template string `yaml:"template,omitempty"`
+	// Timeout 是发送超时时间，默认 10s。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Locale 是告警描述使用的语言（zh-CN 或 en），默认使用 alerts.locale。
+	Locale string `yaml:"locale,omitempty"`
+}
+
+// AlertRoute 表示一条路由规则。
+type AlertRoute struct {
+	// Match 是需要匹配的流标签，值支持 * 通配符，为空时匹配所有流。
+	Match map[string]string `yaml:"match,omitempty"`
+	// Events 是匹配的事件类型，为空时匹配所有事件。
+	Events []string `yaml:"events,omitempty"`
+	// Channels 是命中后发送的渠道名称。
+	Channels []string `yaml:"channels"`
+	// Template 是覆盖渠道模板的告警正文模板（可选）。
+	Template string `yaml:"template,omitempty"`
+	// Continue 表示命中后继续匹配后续规则。
+	Continue bool `yaml:"continue,omitempty"`
+}
+
+// alertFuncs 是告警模板中可用的函数。
+var alertFuncs = template.FuncMap{
+	// json encodes a value as JSON so templates can build valid JSON bodies.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// join concatenates lines, such as the stderr lines of an incident.
+	"join": strings.Join,
+}
+
+// parseAlertTemplate 解析告警正文模板。
+func parseAlertTemplate(text string) (*template.Template, error) {
+	return template.New("alert").Funcs(alertFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// validate 校验告警路由配置。
+func (c *AlertConfig) validate() error {
+	if !validLocale(c.Locale) {
+		return fmt.Errorf("unsupported locale %q", c.Locale)
+	}
+	for name, ch := range c.Channels {
+		if !validLocale(ch.Locale) {
+			return fmt.Errorf("channel %s: unsupported locale %q", name, ch.Locale)
+		}
+		if (ch.URL == "") == (ch.Plugin == "") {
+			return fmt.Errorf("channel %s: exactly one of url or plugin must be set", name)
+		}
+		if ch.URL != "" {
+			u, err := url.Parse(ch.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("channel %s: url must be an http(s) URL", name)
+			}
+		}
+		if ch.Timeout < 0 {
+			return fmt.Errorf("channel %s: timeout must not be negative", name)
+		}
+		if _, err := parseAlertTemplate(ch.Template); err != nil {
+			return fmt.Errorf("channel %s: template: %w", name, err)
+		}
+	}
+	for i, r := range c.Routes {
+		if len(r.Channels) == 0 {
+			return fmt.Errorf("route %d: channels is required", i)
+		}
+		for _, name := range r.Channels {
+			if _, ok := c.Channels[name]; !ok {
+				return fmt.Errorf("route %d: unknown channel %q", i, name)
+			}
+		}
+		for label, pattern := range r.Match {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("route %d: invalid pattern %q for label %s", i, pattern, label)
+			}
+		}
+		if _, err := parseAlertTemplate(r.Template); err != nil {
+			return fmt.Errorf("route %d: template: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// matches 判断路由是否匹配事件。
+func (r *AlertRoute) matches(ev Event) bool {
+	if len(r.Events) > 0 && !containsString(r.Events, ev.Type) {
+		return false
+	}
+	for label, pattern := range r.Match {
+		value, ok := ev.Labels[label]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// alertRouter 是当前生效的告警路由和流标签，在配置重载时整体替换。
+type alertRouter struct {
+	config *AlertConfig
+	// labels 是按流 ID 索引的流标签。
+	labels map[string]map[string]string
+}
+
+// alertRouting 是当前生效的告警路由。
+var alertRouting atomic.Pointer[alertRouter]
+
+// newAlertRouter 根据配置构建告警路由。
+func newAlertRouter(cfg *Config) *alertRouter {
+	r := &alertRouter{config: cfg.Alerts, labels: make(map[string]map[string]string, len(cfg.Streams))}
+	for _, s := range cfg.Streams {
+		r.labels[s.ID] = s.Labels
+	}
+	return r
+}
+
+// alertDelivery 是一条待发送的告警。
+type alertDelivery struct {
+	channel string
+	body    []byte
+}
+
+// route 返回事件需要发送的所有告警，同一渠道只发送一次。
+func (r *alertRouter) route(ev Event) []alertDelivery {
+	if r.config == nil {
+		return nil
+	}
+	var out []alertDelivery
+	sent := make(map[string]bool)
+	for _, route := range r.config.Routes {
+		if !route.matches(ev) {
+			continue
+		}
+		for _, name := range route.Channels {
+			if sent[name] {
+				continue
+			}
+			sent[name] = true
+			text := route.Template
+			if text == "" {
+				text = r.config.Channels[name].Template
+			}
+			if text == "" {
+				text = defaultAlertTemplate
+			}
+			body, err := renderAlert(text, ev.localized(r.channelLocale(name)))
+			if err != nil {
+				slog.Warn("failed to render alert", "channel", name, "stream_id", ev.StreamID, "error", err)
+				continue
+			}
+			out = append(out, alertDelivery{channel: name, body: body})
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	return out
+}
+
+// channelLocale 返回渠道告警使用的语言。
+func (r *alertRouter) channelLocale(name string) string {
+	if loc := r.config.Channels[name].Locale; loc != "" {
+		return loc
+	}
+	if r.config.Locale != "" {
+		return r.config.Locale
+	}
+	return LocaleEN
+}
+
+// renderAlert 使用模板渲染告警正文，data 通常是 Event。
+func renderAlert(text string, data any) ([]byte, error) {
+	tmpl, err := parseAlertTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendAlert 把告警 POST 到渠道地址，失败只记录日志。
+func sendAlert(ch AlertChannel, name string, body []byte) {
+	timeout := ch.Timeout
+	if timeout == 0 {
+		timeout = DefaultAlertTimeout
+	}
+	contentType := ch.ContentType
+	if contentType == "" {
+		contentType = defaultAlertContentType
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(ch.URL, contentType, bytes.NewReader(body))
+	if err != nil {
+		// The error quotes the webhook URL, whose path or query usually carries the token.
+		slog.Warn("failed to send alert", "channel", name, "error", redactURLs(err.Error()))
+		return
+	}
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("failed to close alert response", "channel", name, "error", err)
+	}
+	if resp.StatusCode >= 300 {
+		slog.Warn("alert rejected", "channel", name, "status", resp.Status)
+	}
+}
+
+// dispatchAlerts 按路由异步发送事件告警，不阻塞调用方。
+func dispatchAlerts(ev Event) {
+	r := alertRouting.Load()
+	if r == nil {
+		return
+	}
+	for _, d := range r.route(ev) {
+		ch := r.config.Channels[d.channel]
+		if ch.Plugin != "" {
+			go notifyPlugin(ch, d.channel, d.body)
+			continue
+		}
+		go sendAlert(ch, d.channel, d.body)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlertRouting 测试按流标签匹配路由、continue、渠道语言和模板渲染
+func TestAlertRouting(t *testing.T) {
+	cfg := &Config{
+		Streams: []StreamConfig{
+			{ID: "news", Labels: map[string]string{"team": "news", "severity": "critical"}},
+			{ID: "sports", Labels: map[string]string{"team": "sports"}},
+		},
+		Alerts: &AlertConfig{
+			Channels: map[string]AlertChannel{
+				"news":   {URL: "https://hooks.example.com/news", Template: `{"text": {{json .Message}}}`, Locale: LocaleZH},
+				"pager":  {URL: "https://pager.example.com/"},
+				"noc":    {URL: "https://hooks.example.com/noc"},
+				"unused": {URL: "http://127.0.0.1:9000/"},
+			},
+			Routes: []AlertRoute{
+				{Match: map[string]string{"severity": "crit*"}, Channels: []string{"pager"}, Continue: true},
+				{Match: map[string]string{"team": "news"}, Channels: []string{"news"}},
+				{Channels: []string{"noc"}, Template: `{{.StreamID}} {{.Type}} {{index .Labels "team"}}`},
+			},
+		},
+	}
+	if err := cfg.Alerts.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	r := newAlertRouter(cfg)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	got := r.route(Event{Time: now, StreamID: "news", Type: "av_drift", args: []any{"300ms", "200ms"}, Labels: r.labels["news"]})
+	if len(got) != 2 || got[0].channel != "pager" || got[1].channel != "news" {
+		t.Fatalf("news deliveries = %+v", got)
+	}
+	if string(got[1].body) != `{"text": "音画偏差 300ms 超过阈值 200ms"}` {
+		t.Errorf("news body = %s", got[1].body)
+	}
+
+	got = r.route(Event{Time: now, StreamID: "sports", Type: "keyframe_fallback", Labels: r.labels["sports"]})
+	if len(got) != 1 || got[0].channel != "noc" || string(got[0].body) != "sports keyframe_fallback sports" {
+		t.Errorf("sports deliveries = %+v", got)
+	}
+
+	cfg.Alerts.Routes = append(cfg.Alerts.Routes, AlertRoute{Channels: []string{"missing"}})
+	if err := cfg.Alerts.validate(); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
+
+// TestSendAlertRedactsURL 测试发送失败时日志中的 webhook 地址只保留主机部分，不含路径和参数中的令牌
+func TestSendAlertRedactsURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.URL
+	srv.Close()
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+	sendAlert(AlertChannel{URL: addr + "/services/T0/B0/secret-token?key=secret-key", Timeout: time.Second}, "slack", []byte("{}"))
+
+	out := buf.String()
+	if !strings.Contains(out, "failed to send alert") || strings.Contains(out, "secret") {
+		t.Errorf("unexpected log output: %s", out)
+	}
+	if !strings.Contains(out, addr+"/...") {
+		t.Errorf("expected the redacted host %s/... in %s", addr, out)
+	}
+}
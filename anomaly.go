@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 异常检测的指标。
+const (
+	// AnomalyMetricBitrate 是输出码率（kbit/s）。
+	AnomalyMetricBitrate = "bitrate"
+	// AnomalyMetricFPS 是输出帧率。
+	AnomalyMetricFPS = "fps"
+)
+
+const (
+	// DefaultAnomalyWindow 是基线的默认时间窗口。
+	DefaultAnomalyWindow = 10 * time.Minute
+	// DefaultAnomalyMinSamples 是开始检测前基线至少需要的默认采样数（2 分钟）。
+	DefaultAnomalyMinSamples = 24
+	// DefaultAnomalyThreshold 是判定偏离的默认标准差倍数。
+	DefaultAnomalyThreshold = 3
+	// DefaultAnomalySustain 是偏离持续多久才发出事件的默认时长。
+	DefaultAnomalySustain = 30 * time.Second
+	// anomalyMinDeviation 是标准差相对均值的下限，避免恒定码率的流因微小波动被判为异常。
+	anomalyMinDeviation = 0.05
+)
+
+// AnomalyConfig 表示按流自身基线检测码率和帧率异常的配置。每个码率采样周期（5s）取一次当前码率和帧率，
+// 与该流最近 window 内正常采样的均值比较，偏离超过 threshold 个标准差并持续 sustain 时发出 degraded 事件。
+type AnomalyConfig struct {
+	// Metrics 是检测的指标：bitrate、fps，默认两者都检测。
+	Metrics []string `yaml:"metrics,omitempty"`
+	// Window 是基线的时间窗口，默认 10m。
+	Window time.Duration `yaml:"window,omitempty"`
+	// MinSamples 是开始检测前基线至少需要的采样数，默认 24。
+	MinSamples int `yaml:"min_samples,omitempty"`
+	// Threshold 是判定偏离的标准差倍数，默认 3。
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// Sustain 是偏离持续多久才发出事件，默认 30s。
+	Sustain time.Duration `yaml:"sustain,omitempty"`
+}
+
+// anomalyDetection 是当前生效的异常检测配置，在配置重载时替换，为空时不检测。
+var anomalyDetection atomic.Pointer[AnomalyConfig]
+
+// validate 校验异常检测配置。
+func (c *AnomalyConfig) validate() error {
+	for _, m := range c.Metrics {
+		if m != AnomalyMetricBitrate && m != AnomalyMetricFPS {
+			return fmt.Errorf("unknown metric %q, expected bitrate or fps", m)
+		}
+	}
+	if c.Window < 0 || c.Sustain < 0 || c.MinSamples < 0 || c.Threshold < 0 {
+		return fmt.Errorf("window, min_samples, threshold and sustain must not be negative")
+	}
+	d := c.withDefaults()
+	if d.MinSamples < 3 || d.MinSamples > d.windowSamples() {
+		return fmt.Errorf("min_samples must be between 3 and %d samples of %s in window", d.windowSamples(), bitrateSampleInterval)
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c AnomalyConfig) withDefaults() AnomalyConfig {
+	if len(c.Metrics) == 0 {
+		c.Metrics = []string{AnomalyMetricBitrate, AnomalyMetricFPS}
+	}
+	if c.Window == 0 {
+		c.Window = DefaultAnomalyWindow
+	}
+	if c.MinSamples == 0 {
+		c.MinSamples = DefaultAnomalyMinSamples
+	}
+	if c.Threshold == 0 {
+		c.Threshold = DefaultAnomalyThreshold
+	}
+	if c.Sustain == 0 {
+		c.Sustain = DefaultAnomalySustain
+	}
+	return c
+}
+
+// windowSamples 返回基线窗口内的采样数。
+func (c AnomalyConfig) windowSamples() int {
+	return int(c.Window / bitrateSampleInterval)
+}
+
+// anomalyBaseline 是单个指标的滚动基线和偏离状态。
+type anomalyBaseline struct {
+	// samples 是最近的正常采样，偏离的采样不计入，避免基线被故障拉偏。
+	samples []float64
+	// deviating 是连续偏离的采样数。
+	deviating int
+	// degraded 表示已发出 degraded 事件、尚未恢复。
+	degraded bool
+}
+
+// meanStddev 返回基线的均值和标准差。
+func (b *anomalyBaseline) meanStddev() (float64, float64) {
+	var sum float64
+	for _, v := range b.samples {
+		sum += v
+	}
+	mean := sum / float64(len(b.samples))
+	var sq float64
+	for _, v := range b.samples {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(b.samples)))
+}
+
+// anomalyState 是一路流所有指标的基线，随流工作器保存，跨 ffmpeg 重启保留。
+type anomalyState struct {
+	// cfg 是建立基线时的流配置，配置变化后基线作废。
+	cfg *StreamConfig
+	// baselines 是各指标的基线。
+	baselines map[string]*anomalyBaseline
+}
+
+// anomalyEvent 是一次基线偏离或恢复。
+type anomalyEvent struct {
+	// Type 是 degraded 或 degraded_recovered。
+	Type   string
+	Metric string
+	// Value 是当前采样值，Mean 是基线均值。
+	Value float64
+	Mean  float64
+}
+
+// rebase 在流配置变化（如改了码率或转码配置）时丢弃旧基线。
+func (a *anomalyState) rebase(cfg StreamConfig) {
+	if a.cfg != nil && len(streamConfigDiff(*a.cfg, cfg)) > 0 {
+		a.baselines = nil
+	}
+	a.cfg = &cfg
+}
+
+// observe 记录一组采样，返回状态发生变化的指标对应的事件。
+func (a *anomalyState) observe(c AnomalyConfig, values map[string]float64) []anomalyEvent {
+	if a.baselines == nil {
+		a.baselines = make(map[string]*anomalyBaseline)
+	}
+	sustain := int((c.Sustain + bitrateSampleInterval - 1) / bitrateSampleInterval)
+	var events []anomalyEvent
+	for _, metric := range c.Metrics {
+		v, ok := values[metric]
+		if !ok {
+			continue
+		}
+		b := a.baselines[metric]
+		if b == nil {
+			b = &anomalyBaseline{}
+			a.baselines[metric] = b
+		}
+		deviates := false
+		var mean float64
+		if len(b.samples) >= c.MinSamples {
+			var stddev float64
+			mean, stddev = b.meanStddev()
+			stddev = math.Max(stddev, mean*anomalyMinDeviation)
+			deviates = stddev > 0 && math.Abs(v-mean) > c.Threshold*stddev
+		}
+		if deviates {
+			b.deviating++
+			if !b.degraded && b.deviating >= sustain {
+				b.degraded = true
+				events = append(events, anomalyEvent{Type: "degraded", Metric: metric, Value: v, Mean: mean})
+			}
+			continue
+		}
+		b.deviating = 0
+		if b.degraded {
+			b.degraded = false
+			events = append(events, anomalyEvent{Type: "degraded_recovered", Metric: metric, Value: v, Mean: mean})
+		}
+		b.samples = append(b.samples, v)
+		if n := c.windowSamples(); len(b.samples) > n {
+			b.samples = b.samples[len(b.samples)-n:]
+		}
+	}
+	return events
+}
+
+// degraded 返回当前偏离基线的指标，按名称排序。
+func (a *anomalyState) degraded() []string {
+	var out []string
+	for metric, b := range a.baselines {
+		if b.degraded {
+			out = append(out, metric)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// recordProgress 记录一次 ffmpeg 进度，有新的码率采样时与基线比较并发出事件。
+func (w *StreamWorker) recordProgress(p ffmpegProgress, now time.Time) {
+	c := anomalyDetection.Load()
+	w.mu.Lock()
+	sampled := w.stats.recordProgress(p, now)
+	var events []anomalyEvent
+	// The first sample of a run includes the startup burst; skip it.
+	if c != nil && sampled && len(w.stats.Bitrates) > 1 {
+		values := map[string]float64{AnomalyMetricBitrate: w.stats.Bitrates[len(w.stats.Bitrates)-1]}
+		if p.FPS > 0 {
+			values[AnomalyMetricFPS] = p.FPS
+		}
+		events = w.anomaly.observe(c.withDefaults(), values)
+	}
+	id := w.cfg.ID
+	w.mu.Unlock()
+
+	for _, ev := range events {
+		if ev.Type == "degraded" {
+			emitEvent(id, ev.Type, ev.Metric, formatAnomalyValue(ev.Metric, ev.Value), formatAnomalyValue(ev.Metric, ev.Mean))
+		} else {
+			emitEvent(id, ev.Type, ev.Metric, formatAnomalyValue(ev.Metric, ev.Value))
+		}
+	}
+}
+
+// formatAnomalyValue 按指标格式化采样值。
+func formatAnomalyValue(metric string, v float64) string {
+	if metric == AnomalyMetricBitrate {
+		return fmt.Sprintf("%.0fkbit/s", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// degradedMetrics 返回当前偏离基线的指标。
+func (w *StreamWorker) degradedMetrics() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.anomaly.degraded()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestAnomalyObserve 测试偏离基线持续 sustain 后才发出 degraded 事件，偏离的采样不计入基线
+func TestAnomalyObserve(t *testing.T) {
+	c := AnomalyConfig{Metrics: []string{AnomalyMetricBitrate}, MinSamples: 6, Sustain: 10 * time.Second}.withDefaults()
+	var a anomalyState
+	for i := 0; i < 6; i++ {
+		if ev := a.observe(c, map[string]float64{"bitrate": 3000 + float64(i%2)*100}); len(ev) != 0 {
+			t.Fatalf("event while building baseline: %+v", ev)
+		}
+	}
+	// A single dip is tolerated; the second one in a row is reported.
+	if ev := a.observe(c, map[string]float64{"bitrate": 800}); len(ev) != 0 {
+		t.Fatalf("event before sustain: %+v", ev)
+	}
+	ev := a.observe(c, map[string]float64{"bitrate": 900})
+	if len(ev) != 1 || ev[0].Type != "degraded" || ev[0].Mean != 3050 {
+		t.Fatalf("events = %+v, want degraded with mean 3050", ev)
+	}
+	if got := a.degraded(); !reflect.DeepEqual(got, []string{"bitrate"}) {
+		t.Errorf("degraded = %v", got)
+	}
+	if n := len(a.baselines["bitrate"].samples); n != 6 {
+		t.Errorf("baseline samples = %d, want 6", n)
+	}
+
+	ev = a.observe(c, map[string]float64{"bitrate": 3020, "fps": 1})
+	if len(ev) != 1 || ev[0].Type != "degraded_recovered" {
+		t.Fatalf("events = %+v, want degraded_recovered", ev)
+	}
+	if a.baselines["fps"] != nil {
+		t.Error("fps observed although not configured")
+	}
+
+	// A constant bitrate tolerates small changes thanks to the deviation floor.
+	var flat anomalyState
+	for i := 0; i < 6; i++ {
+		flat.observe(c, map[string]float64{"bitrate": 2000})
+	}
+	for i := 0; i < 3; i++ {
+		if ev := flat.observe(c, map[string]float64{"bitrate": 2100}); len(ev) != 0 {
+			t.Fatalf("events for a 5%% change: %+v", ev)
+		}
+	}
+
+	// Changing the stream config drops the baseline.
+	a.rebase(StreamConfig{ID: "a", Dst: "rtmp://a.example.com/app/key"})
+	a.rebase(StreamConfig{ID: "a", Dst: "rtmp://b.example.com/app/key"})
+	if a.baselines != nil {
+		t.Error("baseline kept after config change")
+	}
+
+	for _, bad := range []AnomalyConfig{
+		{Metrics: []string{"speed"}},
+		{MinSamples: 2},
+		{Window: time.Minute, MinSamples: 24},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
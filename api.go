@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// minAPITokenLength 是管理接口令牌的最小长度。
+const minAPITokenLength = 16
+
+// APIConfig 表示管理接口的配置。管理接口可以修改配置，流地址中又通常含有推流密钥，
+// 因此与只读的指标服务分开监听，且所有请求都必须携带令牌。
+type APIConfig struct {
+	// Listen 是管理接口的监听地址，如 "127.0.0.1:9311"。修改后需重启生效。
+	Listen string `yaml:"listen"`
+	// Token 是请求头 Authorization: Bearer 中携带的令牌，至少 16 个字符，角色为 admin，支持热重载。
+	Token string `yaml:"token,omitempty"`
+	// Tokens 是同样有效的其他令牌（可选），可以按角色限制权限，用于给不同客户端分配令牌或轮换令牌。
+	Tokens []APIToken `yaml:"tokens,omitempty"`
+	// TokenEnv 是保存令牌的环境变量名（可选），多个令牌以逗号分隔，角色为 admin，避免把令牌写进配置文件。
+	TokenEnv string `yaml:"token_env,omitempty"`
+	// TLS 是管理接口的 TLS 配置（可选），对外网开放管理接口时应当开启。修改后需重启生效。
+	TLS *TLSConfig `yaml:"tls,omitempty"`
+	// PersistStreams 表示通过 /streams 对流的修改是否写回配置文件，默认只修改内存中的配置，重载或重启后丢失。
+	PersistStreams bool `yaml:"persist_streams,omitempty"`
+	// Limits 是管理接口的限流和请求大小限制（可选）。修改后需重启生效。
+	Limits *HTTPLimits `yaml:"limits,omitempty"`
+	// OIDC 是仪表盘和管理接口的单点登录配置（可选），用户按所在的组获得角色，不需要共享令牌。
+	OIDC *OIDCConfig `yaml:"oidc,omitempty"`
+	// BasePath 是反向代理转发时使用的路径前缀，如 /stream-runner，仪表盘和单点登录都在该前缀下。修改后需重启生效。
+	BasePath string `yaml:"base_path,omitempty"`
+	// TrustedProxies 是可信反向代理的 IP 或 CIDR，只信任它们发送的 X-Forwarded-For 和 X-Forwarded-Host。修改后需重启生效。
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+	// CORS 是跨域策略（可选），未配置时不返回跨域响应头。修改后需重启生效。
+	CORS *CORSConfig `yaml:"cors,omitempty"`
+}
+
+// validate 校验管理接口配置。
+func (c *APIConfig) validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen is required")
+	}
+	if c.TokenEnv != "" && os.Getenv(c.TokenEnv) == "" {
+		return fmt.Errorf("token_env: environment variable %s is not set", c.TokenEnv)
+	}
+	for i, t := range c.Tokens {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+	}
+	tokens := c.tokens()
+	if len(tokens) == 0 && c.OIDC == nil {
+		return fmt.Errorf("token, tokens, token_env or oidc is required")
+	}
+	for _, t := range tokens {
+		if len(t.value()) < minAPITokenLength {
+			return fmt.Errorf("tokens must be at least %d characters", minAPITokenLength)
+		}
+	}
+	if c.TLS != nil {
+		if err := c.TLS.validate(); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	if c.Limits != nil {
+		if err := c.Limits.validate(); err != nil {
+			return fmt.Errorf("limits: %w", err)
+		}
+	}
+	if err := validateProxyOptions(c.BasePath, c.TrustedProxies, c.CORS); err != nil {
+		return err
+	}
+	if c.OIDC != nil {
+		if err := c.OIDC.validate(c.BasePath); err != nil {
+			return fmt.Errorf("oidc: %w", err)
+		}
+	}
+	return nil
+}
+
+// tokens 返回所有有效的令牌：token、tokens 和 token_env 指定的环境变量中的令牌。
+func (c *APIConfig) tokens() []APIToken {
+	var out []APIToken
+	if c.Token != "" {
+		out = append(out, APIToken{Token: c.Token})
+	}
+	out = append(out, c.Tokens...)
+	if c.TokenEnv != "" {
+		for _, t := range strings.Split(os.Getenv(c.TokenEnv), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				out = append(out, APIToken{Token: t})
+			}
+		}
+	}
+	return out
+}
+
+// apiConfig 返回当前生效的管理接口配置。
+func apiConfig(state *AppState) *APIConfig {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.config == nil {
+		return nil
+	}
+	return state.config.API
+}
+
+// writeAPIJSON 以 JSON 写出管理接口的响应。
+func writeAPIJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write api response", "error", err)
+	}
+}
+
+// writeAPIError 以 {"error": "..."} 的形式写出管理接口的错误。
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	writeAPIJSON(w, code, map[string]string{"error": msg})
+}
+
+// withAPIAuth 要求请求携带当前配置中的令牌或单点登录会话，且其角色允许该操作。令牌和组映射随配置重载更新。
+func withAPIAuth(h http.Handler, state *AppState) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t APIToken
+		c := apiConfig(state)
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && c != nil && c.OIDC != nil {
+			// A bearer token takes precedence, so scripts are unaffected by a stale dashboard cookie.
+			if cookie, err := r.Cookie(sessionCookie); err == nil {
+				serveSession(w, r, c.OIDC, cookie.Value, h)
+				return
+			}
+		}
+		if ok && c != nil {
+			t, ok = c.matchToken(token)
+		}
+		if c == nil || !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="stream-runner"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		authorizeAPI(w, r, tokenActor(t), t.role(), h)
+	})
+}
+
+// apiRateKey 返回管理接口限流使用的键：有效令牌和单点登录会话按身份计数，与来源地址无关，
+// 同一出口地址后的不同令牌互不影响；其余请求（包括猜测令牌的请求）按客户端地址计数。
+func apiRateKey(state *AppState) func(*http.Request) string {
+	return func(r *http.Request) string {
+		c := apiConfig(state)
+		if c == nil {
+			return "ip:" + clientIP(r)
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if t, ok := c.matchToken(token); ok {
+				return tokenActor(t)
+			}
+		} else if cookie, err := r.Cookie(sessionCookie); err == nil && c.OIDC != nil {
+			if s, ok := ssoSessions.lookup(c.OIDC, cookie.Value, time.Now()); ok {
+				return sessionActor(s)
+			}
+		}
+		return "ip:" + clientIP(r)
+	}
+}
+
+// authorizeAPI 检查 role 是否允许该请求，允许时执行 h；修改请求和被拒绝的请求写入审计记录。
+func authorizeAPI(w http.ResponseWriter, r *http.Request, actor, role string, h http.Handler) {
+	auditRequest(w, r, AuditViaAPI, actor, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if required := requiredRole(r); !roleAllows(role, required) {
+			slog.Warn("api request denied", "actor", actor, "role", role, "method", r.Method, "path", r.URL.Path)
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("role %s cannot %s %s, %s is required", role, r.Method, r.URL.Path, required))
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+}
+
+// isLoopbackHost 判断监听地址是否只在本机可达。
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newAPIMux 创建管理接口的路由。
+func newAPIMux(state *AppState) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config/plan", handleConfigPlan(state))
+	mux.Handle("/config/apply", rejectWhileDraining(handleConfigApply(state)))
+	mux.Handle("/streams", rejectWhileDraining(handleStreams(state)))
+	mux.Handle("/streams/", rejectWhileDraining(handleStreams(state)))
+	mux.Handle("/temporary-streams", rejectWhileDraining(handleTemporaryStreams(state)))
+	mux.Handle("/temporary-streams/", rejectWhileDraining(handleTemporaryStreams(state)))
+	mux.Handle("/jobs", rejectWhileDraining(handleJobs(state)))
+	mux.Handle("/jobs/", rejectWhileDraining(handleJobs(state)))
+	mux.HandleFunc("/drain", handleDrain(state))
+	mux.HandleFunc("/log-level", handleLogLevel())
+	mux.HandleFunc("/logs", handleLogs)
+	mux.HandleFunc("/events", handleLifecycleEvents())
+	mux.HandleFunc("/purge/", handlePurge(state))
+	mux.HandleFunc("/sessions", handleSessions(state))
+	mux.HandleFunc("/sessions/", handleSessions(state))
+	mux.HandleFunc("/status", handleStatus(state))
+	mux.HandleFunc("/status/", handleStreamStatus(state))
+	return mux
+}
+
+// newAPIHandler 创建管理接口的处理器：/ui/ 下的仪表盘静态文件不含数据，/auth/ 下是单点登录流程，
+// 都不需要令牌，其余路径都需要认证。base 是反向代理的路径前缀，请求路径已去掉该前缀，只用于生成跳转地址和 Cookie 路径。
+func newAPIHandler(state *AppState, base string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", dashboardHandler())
+	mux.Handle("/auth/", handleAuth(state, base))
+	mux.Handle("/", withAPIAuth(newAPIMux(state), state))
+	return mux
+}
+
+// serveAPI 在已绑定的监听器上运行管理接口。
+func serveAPI(state *AppState, ln net.Listener) {
+	c := apiConfig(state)
+	if c == nil {
+		c = &APIConfig{}
+	}
+	if c.Limits != nil {
+		ln = newLimitListener(ln, c.Limits.MaxConnections)
+	}
+	base := normalizeBasePath(c.BasePath)
+	server := &http.Server{
+		// Rate limiting runs before authentication so token guessing is throttled too.
+		Handler:           withPanicReport("api handler", withProxyOptions(newAPIHandler(state, base), base, c.TrustedProxies, c.CORS, c.Limits, apiRateKey(state))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	var err error
+	if c.TLS != nil {
+		if server.TLSConfig, err = c.TLS.serverConfig(); err != nil {
+			slog.Error("api server tls setup failed", "error", err)
+			return
+		}
+		slog.Info("api server listening", "addr", ln.Addr().String(), "tls", true)
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		slog.Info("api server listening", "addr", ln.Addr().String())
+		if host, _, _ := net.SplitHostPort(ln.Addr().String()); !isLoopbackHost(host) {
+			slog.Warn("api server is reachable beyond localhost without tls, tokens are sent in clear text", "addr", ln.Addr().String())
+		}
+		err = server.Serve(ln)
+	}
+	if err != nil {
+		slog.Error("api server stopped", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 管理接口令牌的角色，权限依次递增。
+const (
+	// APIRoleReadOnly 只能查询流状态（/status），适合监控系统。流配置和原始 ffmpeg 输出中可能含有推流密钥，不对该角色开放；/status/{id} 中的输出已去掉地址路径。
+	APIRoleReadOnly = "read-only"
+	// APIRoleOperator 可以查询所有接口，并执行流的重启、停止、暂停等操作、提交任务和管理临时流，但不能修改配置。
+	APIRoleOperator = "operator"
+	// APIRoleAdmin 可以执行所有操作，包括修改流配置和导入配置。
+	APIRoleAdmin = "admin"
+)
+
+// apiRoleLevels 是角色的权限级别。
+var apiRoleLevels = map[string]int{APIRoleReadOnly: 1, APIRoleOperator: 2, APIRoleAdmin: 3}
+
+// APIToken 是一个带角色的管理接口令牌。在 tokens 中也可以直接写令牌字符串，此时角色为 admin。
+type APIToken struct {
+	// Name 是令牌的名称（可选），如使用它的系统名，记录在拒绝访问的日志中。
+	Name string `yaml:"name,omitempty"`
+	// Token 是令牌，与 Env 二选一。
+	Token string `yaml:"token,omitempty"`
+	// Env 是保存令牌的环境变量名，与 Token 二选一。
+	Env string `yaml:"env,omitempty"`
+	// Role 是角色：read-only、operator 或 admin，默认 admin。
+	Role string `yaml:"role,omitempty"`
+}
+
+// UnmarshalYAML 实现 yaml.Unmarshaler 接口，接受令牌字符串或完整的映射。
+func (t *APIToken) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*t = APIToken{Token: n.Value}
+		return nil
+	}
+	type plain APIToken
+	return n.Decode((*plain)(t))
+}
+
+// validate 校验令牌配置。
+func (t *APIToken) validate() error {
+	if (t.Token == "") == (t.Env == "") {
+		return fmt.Errorf("exactly one of token and env is required")
+	}
+	if t.Env != "" && os.Getenv(t.Env) == "" {
+		return fmt.Errorf("environment variable %s is not set", t.Env)
+	}
+	if t.Role != "" && apiRoleLevels[t.Role] == 0 {
+		return fmt.Errorf("role must be read-only, operator or admin")
+	}
+	return nil
+}
+
+// value 返回令牌的值。
+func (t APIToken) value() string {
+	if t.Env != "" {
+		return strings.TrimSpace(os.Getenv(t.Env))
+	}
+	return t.Token
+}
+
+// role 返回令牌的角色。
+func (t APIToken) role() string {
+	if t.Role == "" {
+		return APIRoleAdmin
+	}
+	return t.Role
+}
+
+// matchToken 返回与 token 匹配的令牌。每个令牌都以常数时间比较，不因提前命中而泄露令牌数量和位置。
+func (c *APIConfig) matchToken(token string) (APIToken, bool) {
+	var match APIToken
+	found := 0
+	for _, t := range c.tokens() {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.value())) == 1 {
+			match, found = t, 1
+		}
+	}
+	return match, found == 1
+}
+
+// requiredRole 返回执行请求所需的最低角色。
+func requiredRole(r *http.Request) string {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	path := r.URL.Path
+	switch {
+	case read && (path == "/status" || strings.HasPrefix(path, "/status/")):
+		return APIRoleReadOnly
+	case path == "/sessions" || strings.HasPrefix(path, "/sessions/"):
+		// Sessions list who is signed in from where, and revoking them locks users out.
+		return APIRoleAdmin
+	case read:
+		return APIRoleOperator
+	case strings.HasPrefix(path, "/jobs"), strings.HasPrefix(path, "/temporary-streams"):
+		return APIRoleOperator
+	case strings.HasPrefix(path, "/streams/") && strings.Contains(strings.TrimPrefix(path, "/streams/"), "/"):
+		// /streams/{id}/{action}: restart, stop, start, pause and resume.
+		return APIRoleOperator
+	default:
+		return APIRoleAdmin
+	}
+}
+
+// roleAllows 判断角色是否具有 required 的权限。
+func roleAllows(role, required string) bool {
+	return apiRoleLevels[role] >= apiRoleLevels[required]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestAPIRoles 测试令牌角色：read-only 只能查询状态，operator 可以控制流但不能修改配置，admin 不受限制
+func TestAPIRoles(t *testing.T) {
+	t.Setenv("TEST_MONITOR_TOKEN", "monitor-token-0123456")
+	var c APIConfig
+	err := yaml.Unmarshal([]byte(`
+listen: 127.0.0.1:0
+tokens:
+  - admin-token-0123456789
+  - {name: monitoring, env: TEST_MONITOR_TOKEN, role: read-only}
+  - {name: noc, token: operator-token-012345, role: operator}
+`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	state := &AppState{config: &Config{API: &c}, workers: newWorkerMap(nil)}
+	h := withAPIAuth(newAPIMux(state), state)
+	denied := func(token, method, path string) bool {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code == http.StatusForbidden
+	}
+	for _, tc := range []struct {
+		method, path              string
+		readOnly, operator, admin bool // whether each role is allowed
+	}{
+		{http.MethodGet, "/status", true, true, true},
+		{http.MethodGet, "/status/news", true, true, true},
+		{http.MethodGet, "/streams", false, true, true},
+		{http.MethodGet, "/streams/news/tail", false, true, true},
+		{http.MethodGet, "/logs", false, true, true},
+		{http.MethodGet, "/events", false, true, true},
+		{http.MethodPost, "/streams/news/restart", false, true, true},
+		{http.MethodPost, "/temporary-streams", false, true, true},
+		{http.MethodPost, "/jobs", false, true, true},
+		{http.MethodPost, "/streams", false, false, true},
+		{http.MethodDelete, "/streams/news", false, false, true},
+		{http.MethodPost, "/config/apply", false, false, true},
+		{http.MethodGet, "/sessions", false, false, true},
+	} {
+		for token, allowed := range map[string]bool{
+			"monitor-token-0123456":  tc.readOnly,
+			"operator-token-012345":  tc.operator,
+			"admin-token-0123456789": tc.admin,
+		} {
+			if denied(token, tc.method, tc.path) == allowed {
+				t.Errorf("%s %s with %s: allowed = %v, want %v", tc.method, tc.path, token, !allowed, allowed)
+			}
+		}
+	}
+
+	for _, bad := range []APIToken{
+		{Token: "operator-token-012345", Role: "viewer"},
+		{Token: "operator-token-012345", Env: "TEST_MONITOR_TOKEN"},
+		{Env: "TEST_UNSET_TOKEN"},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded", bad)
+		}
+	}
+}
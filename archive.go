@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxS3PutSize 是单次 PUT 上传到 S3 的最大对象大小。
+	maxS3PutSize = 5 << 30
+	// archiveTimeLayout 是归档文件名和对象名中节目开始时间的格式（UTC）。
+	archiveTimeLayout = "20060102T150405Z"
+	// maxYouTubeTitle 是 YouTube 视频标题的最大字符数。
+	maxYouTubeTitle = 100
+)
+
+// ArchiveConfig 表示节目结束后把录制文件上传归档：受节目表控制的流停播后，
+// 录制文件改名为带节目开始时间的文件名（下一档节目重新录制），然后作为任务上传到 S3 或 YouTube。
+type ArchiveConfig struct {
+	// Output 是录制到本地文件的附加输出名（outputs 中的 name），文件必须位于 jobs.dirs 中。
+	Output string `yaml:"output"`
+	// S3 是上传到 S3 兼容对象存储的目标，与 youtube 二选一。
+	S3 *ArchiveS3 `yaml:"s3,omitempty"`
+	// YouTube 是上传为 YouTube 视频的目标，与 s3 二选一。
+	YouTube *ArchiveYouTube `yaml:"youtube,omitempty"`
+	// DeleteAfterUpload 表示上传成功后删除本地的录制文件，默认保留。
+	DeleteAfterUpload bool `yaml:"delete_after_upload,omitempty"`
+}
+
+// ArchiveS3 表示 S3 兼容对象存储的上传目标，使用 SigV4 签名的单次 PUT（最大 5GiB）。
+type ArchiveS3 struct {
+	// Endpoint 是服务地址，如 MinIO 的 https://minio.example.com:9000，默认 https://s3.<region>.amazonaws.com。
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix 是对象名前缀，对象名为 <prefix><流 ID>/<归档文件名>。
+	Prefix string `yaml:"prefix,omitempty"`
+	// AccessKeyID 和 SecretAccessKey 支持 ${secret:plugin/name} 占位符。
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+// ArchiveYouTube 表示通过 YouTube Data API 的可续传上传创建视频。
+type ArchiveYouTube struct {
+	// Token 是 OAuth 访问令牌（需要 youtube.upload 权限），支持 ${secret:plugin/name} 占位符，
+	// 流的 platform 为 youtube 时默认使用其令牌。
+	Token string `yaml:"token,omitempty"`
+	// Privacy 是视频的公开范围：private（默认）、unlisted 或 public。
+	Privacy string `yaml:"privacy,omitempty"`
+}
+
+// validate 校验归档配置，s 是流本身的配置，cfg 用于检查任务目录和节目表。
+func (c *ArchiveConfig) validate(cfg *Config, s StreamConfig) error {
+	if cfg.Schedule == nil || cfg.Schedule.Streams[s.ID] == "" {
+		return fmt.Errorf("archive requires the stream to be listed in schedule.streams")
+	}
+	if cfg.Jobs == nil {
+		return fmt.Errorf("archive requires jobs, uploads run as jobs")
+	}
+	if s.OutputMode == OutputModeIndependent {
+		return fmt.Errorf("archive requires output_mode tee, an independent output keeps the recording open")
+	}
+	path, err := c.recording(s)
+	if err != nil {
+		return err
+	}
+	if !inDirs(path, cfg.Jobs.Dirs) {
+		return fmt.Errorf("recording %s must be inside jobs.dirs", path)
+	}
+	switch {
+	case c.S3 != nil && c.YouTube != nil:
+		return fmt.Errorf("s3 and youtube are mutually exclusive")
+	case c.S3 != nil:
+		if c.S3.Region == "" || c.S3.Bucket == "" {
+			return fmt.Errorf("s3: region and bucket are required")
+		}
+		if c.S3.AccessKeyID == "" || c.S3.SecretAccessKey == "" {
+			return fmt.Errorf("s3: access_key_id and secret_access_key are required")
+		}
+		if c.S3.Endpoint != "" {
+			if u, err := url.Parse(c.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("s3: endpoint must be an http(s) URL")
+			}
+		}
+	case c.YouTube != nil:
+		if c.youtubeToken(s) == "" {
+			return fmt.Errorf("youtube: token is required unless platform is youtube")
+		}
+		switch c.YouTube.Privacy {
+		case "", "private", "unlisted", "public":
+		default:
+			return fmt.Errorf("youtube: privacy must be private, unlisted or public")
+		}
+	default:
+		return fmt.Errorf("s3 or youtube is required")
+	}
+	return nil
+}
+
+// recording 返回录制文件的路径，即 output 指向的本地文件输出。
+func (c *ArchiveConfig) recording(s StreamConfig) (string, error) {
+	if c.Output == "" {
+		return "", fmt.Errorf("output is required")
+	}
+	for _, o := range s.Outputs {
+		if o.Name != c.Output {
+			continue
+		}
+		path := o.target()
+		if !filepath.IsAbs(path) || o.format() == "hls" {
+			return "", fmt.Errorf("output %s must record to a single local file", o.Name)
+		}
+		return filepath.Clean(path), nil
+	}
+	return "", fmt.Errorf("unknown output %q", c.Output)
+}
+
+// youtubeToken 返回上传 YouTube 使用的令牌（未解析占位符）。
+func (c *ArchiveConfig) youtubeToken(s StreamConfig) string {
+	if c.YouTube.Token != "" {
+		return c.YouTube.Token
+	}
+	if s.Platform != nil && s.Platform.Type == PlatformYouTube {
+		return s.Platform.Token
+	}
+	return ""
+}
+
+// archivedName 返回录制文件改名后的路径，如 /srv/rec/news.flv 改为 /srv/rec/news-20261015T120000Z.flv。
+func archivedName(path string, start time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + start.UTC().Format(archiveTimeLayout) + ext
+}
+
+// archiveRecording 在节目结束、ffmpeg 退出后把录制文件改名，并提交上传任务。
+// 录制文件不存在或为空时（如节目期间一直没有推流成功）只记录事件。
+func archiveRecording(state *AppState, cfg StreamConfig, p programme, now time.Time) {
+	a := cfg.Archive
+	if a == nil {
+		return
+	}
+	fail := func(err error) {
+		slog.Error("failed to archive recording", "stream_id", cfg.ID, "error", err)
+		emitEvent(cfg.ID, "archive_failed", redactURLs(err.Error()))
+	}
+	q, jc := jobs.Load(), jobsConfig(state)
+	if q == nil || jc == nil {
+		fail(fmt.Errorf("jobs is not configured"))
+		return
+	}
+	path, err := a.recording(cfg)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		fail(fmt.Errorf("no recording at %s", path))
+		return
+	}
+	archived := archivedName(path, p.Start)
+	// Renamed first so that the next programme records to a new file while this one uploads.
+	if err := os.Rename(path, archived); err != nil {
+		fail(err)
+		return
+	}
+
+	j := &job{info: jobInfo{
+		ID: newJobID(), Kind: JobKindArchive, StreamID: cfg.ID, Input: archived,
+		State: JobQueued, CreatedAt: now,
+	}}
+	switch {
+	case a.S3 != nil:
+		s3 := *a.S3
+		key := s3.Prefix + cfg.ID + "/" + filepath.Base(archived)
+		j.info.Output = "s3://" + s3.Bucket + "/" + key
+		j.upload = func(ctx context.Context, progress func(sent, total int64)) (string, error) {
+			return uploadS3(ctx, s3, key, archived, progress)
+		}
+	case a.YouTube != nil:
+		yt, token := *a.YouTube, a.youtubeToken(cfg)
+		title, description := archiveTitle(cfg.ID, p), fmt.Sprintf("%s, %s - %s", cfg.ID, p.Start.UTC().Format(time.RFC3339), p.Stop.UTC().Format(time.RFC3339))
+		j.info.Output = PlatformYouTube
+		j.upload = func(ctx context.Context, progress func(sent, total int64)) (string, error) {
+			return uploadYouTube(ctx, yt, token, title, description, archived, progress)
+		}
+	}
+	j.done = func(info jobInfo) {
+		switch info.State {
+		case JobSucceeded:
+			emitEvent(cfg.ID, "archive_completed", info.Output)
+			if a.DeleteAfterUpload {
+				if err := os.Remove(archived); err != nil {
+					slog.Warn("failed to delete archived recording", "stream_id", cfg.ID, "path", archived, "error", err)
+				}
+			}
+		case JobFailed:
+			emitEvent(cfg.ID, "archive_failed", redactURLs(info.Error))
+		}
+	}
+	info := q.enqueue(jc, j, now)
+	slog.Info("programme ended, archiving recording", "stream_id", cfg.ID, "job_id", info.ID, "path", archived, "target", info.Output)
+}
+
+// archiveTitle 返回归档视频的标题：节目名，节目表没有节目名时为流 ID 和开始时间。
+func archiveTitle(streamID string, p programme) string {
+	title := p.Title
+	if title == "" {
+		title = streamID + " " + p.Start.UTC().Format(time.RFC3339)
+	}
+	if r := []rune(title); len(r) > maxYouTubeTitle {
+		title = string(r[:maxYouTubeTitle])
+	}
+	return title
+}
+
+// progressReader 在读取时报告已读取的字节数。
+type progressReader struct {
+	r      io.Reader
+	sent   int64
+	total  int64
+	report func(sent, total int64)
+}
+
+// Read 实现 io.Reader 接口。
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.report(p.sent, p.total)
+	}
+	return n, err
+}
+
+// openUpload 打开要上传的文件，返回带进度报告的读取器和文件大小。
+func openUpload(path string, progress func(sent, total int64)) (*os.File, *progressReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, &progressReader{r: f, total: info.Size(), report: progress}, nil
+}
+
+// uploadS3 把文件上传为 S3 对象，返回 s3://bucket/key。
+func uploadS3(ctx context.Context, c ArchiveS3, key, path string, progress func(sent, total int64)) (string, error) {
+	accessKey, err := resolveSecrets(ctx, c.AccessKeyID)
+	if err != nil {
+		return "", fmt.Errorf("access_key_id: %w", err)
+	}
+	secretKey, err := resolveSecrets(ctx, c.SecretAccessKey)
+	if err != nil {
+		return "", fmt.Errorf("secret_access_key: %w", err)
+	}
+	f, body, err := openUpload(path, progress)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if body.total > maxS3PutSize {
+		return "", fmt.Errorf("recording is %d bytes, larger than the 5GiB limit of a single S3 upload", body.total)
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	// Path-style addressing works with AWS and S3-compatible stores alike.
+	objectPath := "/" + s3Escape(c.Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(endpoint, "/")+objectPath, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = body.total
+	signS3(req, objectPath, c.Region, accessKey, secretKey, currentClock().Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("s3 upload returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return "s3://" + c.Bucket + "/" + key, nil
+}
+
+// s3Escape 按 SigV4 的规则转义对象路径：除非保留字符和 / 之外全部百分号编码。
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signS3 为 S3 请求添加 SigV4 签名，正文不参与签名（UNSIGNED-PAYLOAD，只用于 https 或内网）。
+func signS3(req *http.Request, objectPath, region, accessKey, secretKey string, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		objectPath,
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + amzDate + "\n",
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// hmacSHA256 返回 data 的 HMAC-SHA256。
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uploadYouTube 通过可续传上传把文件创建为 YouTube 视频，返回视频地址。
+func uploadYouTube(ctx context.Context, c ArchiveYouTube, token, title, description, path string, progress func(sent, total int64)) (string, error) {
+	token, err := resolveSecrets(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	f, body, err := openUpload(path, progress)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	privacy := c.Privacy
+	if privacy == "" {
+		privacy = "private"
+	}
+
+	meta, err := json.Marshal(map[string]any{
+		"snippet": map[string]string{"title": title, "description": description},
+		"status":  map[string]string{"privacyStatus": privacy},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		platformAPIs[PlatformYouTube]+"/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status", strings.NewReader(string(meta)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", fmt.Sprint(body.total))
+	req.Header.Set("X-Upload-Content-Type", "video/*")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusOK || session == "" {
+		return "", fmt.Errorf("youtube API returned %s when starting the upload", resp.Status)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, session, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = body.total
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "video/*")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("youtube API returned %s", resp.Status)
+	}
+	var video struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&video); err != nil {
+		return "", fmt.Errorf("decode youtube API response: %w", err)
+	}
+	if video.ID == "" {
+		return "", fmt.Errorf("youtube API response has no video id")
+	}
+	return "https://www.youtube.com/watch?v=" + video.ID, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestArchiveRecording 测试节目结束后录制文件改名并作为任务上传到 S3，任务进度和位置可以查询。
+func TestArchiveRecording(t *testing.T) {
+	var gotPath, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotAuth, gotBody = r.URL.EscapedPath(), r.Header.Get("Authorization"), string(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	rec := filepath.Join(dir, "news.flv")
+	if err := os.WriteFile(rec, []byte("flv data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := StreamConfig{
+		ID: "news", Src: "rtmp://127.0.0.1/live/n", Dst: "rtmp://127.0.0.2/live/n",
+		Outputs: []StreamOutput{{Name: "rec", Dst: rec}},
+		Archive: &ArchiveConfig{Output: "rec", S3: &ArchiveS3{
+			Endpoint: srv.URL, Region: "eu-west-1", Bucket: "vod", Prefix: "live/",
+			AccessKeyID: "AKID", SecretAccessKey: "secret",
+		}},
+	}
+	cfg := &Config{
+		Streams:  []StreamConfig{s},
+		Schedule: &ScheduleConfig{URL: "http://epg.example.com/epg.xml", Streams: map[string]string{"news": "news.1"}},
+		Jobs:     &JobsConfig{Dirs: []string{dir}},
+	}
+	if err := s.Archive.validate(cfg, s); err != nil {
+		t.Fatal(err)
+	}
+	outside := s
+	outside.Outputs = []StreamOutput{{Name: "rec", Dst: "/tmp/elsewhere/news.flv"}}
+	if err := s.Archive.validate(cfg, outside); err == nil {
+		t.Error("expected a recording outside jobs.dirs to be rejected")
+	}
+
+	state := &AppState{config: cfg}
+	q := newJobQueue(state)
+	jobs.Store(q)
+	defer jobs.Store(nil)
+
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	archiveRecording(state, s, programme{Channel: "news.1", Title: "Noon news", Start: start, Stop: start.Add(time.Hour)}, start.Add(time.Hour))
+	var info jobInfo
+	waitFor(t, "archive job to finish", func() bool {
+		list := q.list()
+		if len(list) == 1 {
+			info = list[0]
+		}
+		return info.FinishedAt != nil
+	})
+	if info.State != JobSucceeded || info.Kind != JobKindArchive || info.Progress.Percent != 100 {
+		t.Fatalf("job = %+v", info)
+	}
+	if info.Output != "s3://vod/live/news/news-20261015T120000Z.flv" {
+		t.Errorf("output = %s", info.Output)
+	}
+	if gotPath != "/vod/live/news/news-20261015T120000Z.flv" || gotBody != "flv data" {
+		t.Errorf("uploaded %q to %s", gotBody, gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/eu-west-1/s3/aws4_request") {
+		t.Errorf("authorization = %s", gotAuth)
+	}
+	// The next programme records to a fresh file.
+	if _, err := os.Stat(rec); !os.IsNotExist(err) {
+		t.Errorf("recording was not renamed: %v", err)
+	}
+	if _, err := os.Stat(info.Input); err != nil {
+		t.Errorf("archived recording: %v", err)
+	}
+}
+
+// TestUploadYouTube 测试通过可续传上传创建 YouTube 视频。
+func TestUploadYouTube(t *testing.T) {
+	var meta, video string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case http.MethodPost:
+			meta = string(body)
+			w.Header().Set("Location", srv.URL+"/session/1")
+		case http.MethodPut:
+			video = string(body)
+			w.Write([]byte(`{"id": "abc123"}`))
+		}
+	}))
+	defer srv.Close()
+	prev := platformAPIs[PlatformYouTube]
+	platformAPIs[PlatformYouTube] = srv.URL
+	defer func() { platformAPIs[PlatformYouTube] = prev }()
+
+	path := filepath.Join(t.TempDir(), "news.mp4")
+	if err := os.WriteFile(path, []byte("mp4 data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := uploadYouTube(context.Background(), ArchiveYouTube{Privacy: "unlisted"}, "tok", "Noon news", "news", path, func(int64, int64) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc != "https://www.youtube.com/watch?v=abc123" || video != "mp4 data" {
+		t.Errorf("location %s, uploaded %q", loc, video)
+	}
+	if !strings.Contains(meta, `"privacyStatus":"unlisted"`) || !strings.Contains(meta, `"title":"Noon news"`) {
+		t.Errorf("metadata = %s", meta)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审计记录中操作的来源。
+const (
+	// AuditViaAPI 是通过令牌认证的管理接口。
+	AuditViaAPI = "api"
+	// AuditViaControl 是本地控制套接字（status、reload、add 等子命令）。
+	AuditViaControl = "control"
+	// AuditViaSignal 是发给守护进程的信号。
+	AuditViaSignal = "signal"
+	// AuditViaCLI 是直接操作文件的子命令，如 purge。
+	AuditViaCLI = "cli"
+)
+
+// 审计记录的结果。
+const (
+	AuditResultOK     = "ok"
+	AuditResultDenied = "denied"
+	AuditResultFailed = "failed"
+)
+
+// auditOperatorHeader 是控制命令报告本地操作者的请求头。
+// 控制套接字只有守护进程的运行用户可以连接，该值只用于区分 sudo 背后的真实用户，不作为认证依据。
+const auditOperatorHeader = "X-Stream-Runner-Operator"
+
+// maxAuditErrorBody 是从失败响应中读取错误描述的最大字节数。
+const maxAuditErrorBody = 4096
+
+// auditEntry 是审计日志中的一条记录，每条记录占一行 JSON。
+type auditEntry struct {
+	Time string `json:"time"`
+	// Actor 是操作者：管理接口令牌名、控制命令的本地用户或信号名。
+	Actor string `json:"actor"`
+	Via   string `json:"via"`
+	// Action 是操作，如 PUT /streams/news、reload、shutdown。
+	Action string `json:"action"`
+	// Target 是操作的流 ID（可选）。
+	Target string `json:"target,omitempty"`
+	// Status 是管理接口响应的 HTTP 状态码。
+	Status int    `json:"status,omitempty"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// Before 和 After 是修改前后的值，流配置中的推流密钥和令牌已脱敏。
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// auditMu 串行化审计日志的写入，保证每条记录完整占一行。
+var auditMu sync.Mutex
+
+// writeAudit 向审计日志追加一条记录。每次写入都重新以追加方式打开文件，外部轮转或删除后自动创建新文件；
+// 写入失败只记录到主日志，不影响操作本身。
+func writeAudit(e auditEntry) {
+	if e.Time == "" {
+		e.Time = logTimestamp(time.Now())
+	}
+	if e.Result == "" {
+		e.Result = AuditResultOK
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to encode audit record", "action", e.Action, "error", err)
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(paths.AuditLog), 0755); err != nil {
+		slog.Error("failed to write audit record", "action", e.Action, "error", err)
+		return
+	}
+	f, err := os.OpenFile(paths.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		slog.Error("failed to write audit record", "action", e.Action, "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write audit record", "action", e.Action, "error", err)
+	}
+}
+
+// auditKey 是请求上下文中审计记录的键。
+type auditKey struct{}
+
+// auditRecorder 记录响应的状态码，失败时保留错误描述。
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader 实现 http.ResponseWriter 接口。
+func (r *auditRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write 实现 http.ResponseWriter 接口。
+func (r *auditRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.status >= 400 && r.body.Len() < maxAuditErrorBody {
+		r.body.Write(p[:min(len(p), maxAuditErrorBody-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// auditRequest 执行修改操作的请求并写入审计记录，查询请求（GET、HEAD）直接执行。
+// 处理器可以通过 auditChange 在记录中补充操作对象和修改前后的值。
+func auditRequest(w http.ResponseWriter, r *http.Request, via, actor string, next http.Handler) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	e := &auditEntry{Actor: actor, Via: via, Action: r.Method + " " + r.URL.Path}
+	rec := &auditRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, e)))
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	e.Status = rec.status
+	switch {
+	case rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden:
+		e.Result = AuditResultDenied
+	case rec.status >= 400:
+		e.Result = AuditResultFailed
+	}
+	if e.Result != "" {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(rec.body.Bytes(), &body) == nil {
+			e.Error = body.Error
+		}
+	}
+	writeAudit(*e)
+}
+
+// withControlAudit 为控制套接字上的修改操作写入审计记录，操作者为控制命令报告的本地用户。
+func withControlAudit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operator := r.Header.Get(auditOperatorHeader)
+		if operator == "" {
+			operator = "unknown"
+		}
+		auditRequest(w, r, AuditViaControl, "user:"+operator, h)
+	})
+}
+
+// tokenActor 返回令牌在审计记录中的身份：令牌名，未命名时为令牌哈希的前缀（不记录令牌本身）。
+func tokenActor(t APIToken) string {
+	if t.Name != "" {
+		return "token:" + t.Name
+	}
+	sum := sha256.Sum256([]byte(t.value()))
+	return "token:sha256-" + hex.EncodeToString(sum[:4])
+}
+
+// auditChange 在当前请求的审计记录中补充操作的流和修改前后的值，请求不在审计范围内时不做任何事。
+func auditChange(r *http.Request, target string, before, after any) {
+	e, ok := r.Context().Value(auditKey{}).(*auditEntry)
+	if !ok {
+		return
+	}
+	e.Target, e.Before, e.After = target, before, after
+}
+
+// localOperator 返回执行命令的本地用户，经 sudo 执行时为 sudo 之前的用户。
+func localOperator() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// auditSecretKeys 是取值需要整体隐藏的配置字段名片段。
+var auditSecretKeys = []string{"token", "secret", "password", "passphrase"}
+
+// auditStream 返回写入审计记录的流配置：地址中主机之后的部分和令牌类字段被隐藏，${secret:...} 占位符保留。
+func auditStream(s StreamConfig) any {
+	m, err := canonicalStream(s)
+	if err != nil {
+		return nil
+	}
+	return auditRedact("", m)
+}
+
+// auditRedact 递归隐藏 v 中的敏感值，key 是 v 所在的字段名。
+func auditRedact(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[k] = auditRedact(k, x)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = auditRedact(key, x)
+		}
+		return out
+	case string:
+		lower := strings.ToLower(key)
+		for _, k := range auditSecretKeys {
+			if strings.Contains(lower, k) && !secretRef.MatchString(v) {
+				return "***"
+			}
+		}
+		return redactURLs(v)
+	default:
+		return v
+	}
+}
+
+// auditConfigChanges 返回两份配置之间新增、删除和修改的流，分别作为审计记录的修改前后的值，没有变化时为 nil。
+func auditConfigChanges(prev, next *Config) (before, after any) {
+	b, a := make(map[string]any), make(map[string]any)
+	old := make(map[string]StreamConfig)
+	if prev != nil {
+		for _, s := range prev.Streams {
+			old[s.ID] = s
+		}
+	}
+	if next != nil {
+		for _, s := range next.Streams {
+			p, ok := old[s.ID]
+			delete(old, s.ID)
+			if ok && len(streamConfigDiff(p, s)) == 0 {
+				continue
+			}
+			if ok {
+				b[s.ID] = auditStream(p)
+			}
+			a[s.ID] = auditStream(s)
+		}
+	}
+	for id, s := range old {
+		b[id] = auditStream(s)
+	}
+	if len(b) > 0 {
+		before = b
+	}
+	if len(a) > 0 {
+		after = a
+	}
+	return before, after
+}
+
+// auditConfigChange 在当前请求的审计记录中补充配置变化的流。
+func auditConfigChange(r *http.Request, prev, next *Config) {
+	before, after := auditConfigChanges(prev, next)
+	auditChange(r, "", before, after)
+}
+
+// auditReload 写入一次重载的审计记录，只包含实际变化的流。新配置生效后部分工作器失败时同样记录变化。
+func auditReload(via, actor string, prev, next *Config, err error) {
+	e := auditEntry{Actor: actor, Via: via, Action: "reload"}
+	if err != nil {
+		e.Result, e.Error = AuditResultFailed, err.Error()
+		if !configApplied(err) {
+			writeAudit(e)
+			return
+		}
+	}
+	e.Before, e.After = auditConfigChanges(prev, next)
+	writeAudit(e)
+}
+
+// currentConfig 返回当前生效的配置。
+func currentConfig(state *AppState) *Config {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.config
+}
+
+// auditStreamIDs 返回配置中的流 ID，按字母排序。
+func auditStreamIDs(cfg *Config) []string {
+	var ids []string
+	if cfg != nil {
+		for _, s := range cfg.Streams {
+			ids = append(ids, s.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAuditLog 测试管理接口的修改操作写入审计日志：记录令牌身份、结果和修改前的流配置，推流密钥被隐藏，查询操作不记录。
+func TestAuditLog(t *testing.T) {
+	prev := paths.AuditLog
+	paths.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	defer func() { paths.AuditLog = prev }()
+
+	api := &APIConfig{Tokens: []APIToken{
+		{Token: "admin-token-0123456789"},
+		{Name: "monitoring", Token: "monitor-token-0123456", Role: APIRoleReadOnly},
+	}}
+	news := StreamConfig{ID: "news", Src: "rtmp://src.example.com/live/in", Dst: "rtmp://dest.example.com/live/SECRETKEY"}
+	state := &AppState{config: &Config{API: api, Streams: []StreamConfig{news}}, workers: newWorkerMap(nil)}
+	h := withAPIAuth(newAPIMux(state), state)
+	do := func(token, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := do("monitor-token-0123456", http.MethodPost, "/streams/news/restart"); code != http.StatusForbidden {
+		t.Fatalf("restart by read-only token: %d", code)
+	}
+	do("admin-token-0123456789", http.MethodGet, "/streams")
+	if code := do("admin-token-0123456789", http.MethodDelete, "/streams/news"); code != http.StatusNoContent {
+		t.Fatalf("delete: %d", code)
+	}
+
+	f, err := os.Open(paths.AuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]any
+	var raw []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("invalid record %s: %v", sc.Text(), err)
+		}
+		records = append(records, m)
+		raw = append(raw, sc.Text())
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", raw)
+	}
+	denied := records[0]
+	if denied["actor"] != "token:monitoring" || denied["result"] != AuditResultDenied || denied["action"] != "POST /streams/news/restart" {
+		t.Errorf("denied record = %v", raw[0])
+	}
+	deleted := records[1]
+	if !strings.HasPrefix(deleted["actor"].(string), "token:sha256-") || deleted["result"] != AuditResultOK || deleted["target"] != "news" {
+		t.Errorf("delete record = %v", raw[1])
+	}
+	before, _ := deleted["before"].(map[string]any)
+	if before["dst"] != "rtmp://dest.example.com/..." || deleted["after"] != nil {
+		t.Errorf("delete record = %v", raw[1])
+	}
+	if strings.Contains(raw[1], "SECRETKEY") || strings.Contains(raw[1], "admin-token") {
+		t.Errorf("audit record leaks a secret: %s", raw[1])
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAVSyncInterval 是音画同步检查的默认间隔。
+	DefaultAVSyncInterval = 5 * time.Minute
+	// DefaultAVSyncThreshold 是音画偏差告警的默认阈值。
+	DefaultAVSyncThreshold = 200 * time.Millisecond
+	// DefaultAVSyncWindow 是每次检查读取源流的默认时长。
+	DefaultAVSyncWindow = 5 * time.Second
+)
+
+// AVSyncConfig 表示音画同步偏差监控配置。
+type AVSyncConfig struct {
+	// Interval 是检查间隔，默认 5m。
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Threshold 是偏差告警阈值，默认 200ms。
+	Threshold time.Duration `yaml:"threshold,omitempty"`
+	// Window 是每次检查读取源流的时长，默认 5s。
+	Window time.Duration `yaml:"window,omitempty"`
+}
+
+// validate 校验音画同步监控配置。
+func (c *AVSyncConfig) validate() error {
+	if c.Interval < 0 || c.Threshold < 0 || c.Window < 0 {
+		return fmt.Errorf("interval, threshold and window must not be negative")
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c AVSyncConfig) withDefaults() AVSyncConfig {
+	if c.Interval == 0 {
+		c.Interval = DefaultAVSyncInterval
+	}
+	if c.Threshold == 0 {
+		c.Threshold = DefaultAVSyncThreshold
+	}
+	if c.Window == 0 {
+		c.Window = DefaultAVSyncWindow
+	}
+	return c
+}
+
+// computeAVDrift 根据 ffprobe 输出的包时间戳计算音画偏差。
+// 对每个视频包取其 PTS 与之前最近一个音频包 PTS 的差值，返回中位数；正值表示视频超前于音频。
+func computeAVDrift(data []byte) (time.Duration, error) {
+	var raw struct {
+		Packets []struct {
+			CodecType string `json:"codec_type"`
+			PTSTime   string `json:"pts_time"`
+		} `json:"packets"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	var diffs []float64
+	lastAudio, haveAudio := 0.0, false
+	for _, p := range raw.Packets {
+		pts, err := strconv.ParseFloat(p.PTSTime, 64)
+		if err != nil {
+			continue // Packets without a timestamp report "N/A".
+		}
+		switch p.CodecType {
+		case "audio":
+			lastAudio, haveAudio = pts, true
+		case "video":
+			if haveAudio {
+				diffs = append(diffs, pts-lastAudio)
+			}
+		}
+	}
+	if len(diffs) == 0 {
+		return 0, fmt.Errorf("source has no interleaved audio and video packets")
+	}
+	sort.Float64s(diffs)
+	median := diffs[len(diffs)/2]
+	return time.Duration(median * float64(time.Second)), nil
+}
+
+// measureAVDrift 读取源流一段时间并计算音画偏差。
+func measureAVDrift(cfg StreamConfig, window time.Duration) (time.Duration, error) {
+	ep, err := resolveEndpoints(cfg)
+	if err != nil {
+		return 0, err
+	}
+	args := append(probeInputArgs(cfg, ep),
+		"-read_intervals", fmt.Sprintf("%%+%g", window.Seconds()),
+		"-show_entries", "packet=codec_type,pts_time",
+		ep.Src,
+	)
+	out, err := runFFprobe(cfg.Sandbox, window+probeTimeout, args)
+	if err != nil {
+		return 0, err
+	}
+	return computeAVDrift(out)
+}
+
+// avSyncMonitor 定期检查开启了 av_sync 的流的音画偏差，超过阈值时发出事件。
+type avSyncMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// lastCheck 是每路流上次开始检查的时间。
+	lastCheck map[string]time.Time
+	// inFlight 记录正在检查的流，避免同一路流并发检查。
+	inFlight map[string]bool
+	// alerting 记录当前处于偏差告警状态的流。
+	alerting map[string]bool
+}
+
+// newAVSyncMonitor 创建音画同步监控器。
+func newAVSyncMonitor(state *AppState) *avSyncMonitor {
+	return &avSyncMonitor{
+		state:     state,
+		lastCheck: make(map[string]time.Time),
+		inFlight:  make(map[string]bool),
+		alerting:  make(map[string]bool),
+	}
+}
+
+// run 每 10 秒扫描一次工作器，对到期的流发起检查。
+func (m *avSyncMonitor) run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for id, w := range m.state.workers.snapshot() {
+			cfg := w.config()
+			if cfg.AVSync == nil || !w.IsRunning() {
+				continue
+			}
+			opts := cfg.AVSync.withDefaults()
+			m.mu.Lock()
+			due := !m.inFlight[id] && now.Sub(m.lastCheck[id]) >= opts.Interval
+			if due {
+				m.inFlight[id] = true
+				m.lastCheck[id] = now
+			}
+			m.mu.Unlock()
+			if due {
+				go m.check(w, cfg, opts)
+			}
+		}
+	}
+}
+
+// check 测量一次音画偏差，记录到统计并在越过阈值时发出事件。
+func (m *avSyncMonitor) check(w *StreamWorker, cfg StreamConfig, opts AVSyncConfig) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.inFlight, cfg.ID)
+		m.mu.Unlock()
+	}()
+
+	drift, err := measureAVDrift(cfg, opts.Window)
+	w.recordProbe(err)
+	if err != nil {
+		slog.Warn("a/v sync check failed", "stream_id", cfg.ID, "error", err)
+		return
+	}
+	w.recordAVDrift(drift)
+
+	abs := drift
+	if abs < 0 {
+		abs = -abs
+	}
+	m.mu.Lock()
+	wasAlerting := m.alerting[cfg.ID]
+	m.alerting[cfg.ID] = abs > opts.Threshold
+	m.mu.Unlock()
+
+	switch {
+	case abs > opts.Threshold && !wasAlerting:
+		emitEvent(cfg.ID, "av_drift", drift, opts.Threshold)
+	case abs <= opts.Threshold && wasAlerting:
+		emitEvent(cfg.ID, "av_drift_recovered", drift)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestComputeAVDrift 测试根据包时间戳计算音画偏差
+func TestComputeAVDrift(t *testing.T) {
+	data := []byte(`{"packets": [
+		{"codec_type": "video", "pts_time": "0.000000"},
+		{"codec_type": "audio", "pts_time": "0.000000"},
+		{"codec_type": "video", "pts_time": "0.340000"},
+		{"codec_type": "audio", "pts_time": "0.040000"},
+		{"codec_type": "video", "pts_time": "0.380000"},
+		{"codec_type": "audio", "pts_time": "N/A"},
+		{"codec_type": "video", "pts_time": "0.420000"}
+	]}`)
+	drift, err := computeAVDrift(data)
+	if err != nil {
+		t.Fatalf("computeAVDrift failed: %v", err)
+	}
+	if want := 340 * time.Millisecond; drift < want-time.Millisecond || drift > want+time.Millisecond {
+		t.Errorf("drift = %s, want about %s", drift, want)
+	}
+
+	if _, err := computeAVDrift([]byte(`{"packets": [{"codec_type": "video", "pts_time": "1.0"}]}`)); err == nil {
+		t.Error("expected error for source without audio")
+	}
+}
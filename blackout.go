@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// RestartBlackout 表示流的重启禁止窗口，如整点前后的广告时段。窗口内 ffmpeg 仍在推流时，
+// 配置变更、看门狗的 probe_failed 重启和调试叠加到期等主动重启推迟到窗口结束；
+// ffmpeg 已退出或输出卡住（硬故障）时照常重启。
+type RestartBlackout struct {
+	// Start 是窗口开始时间：HH:MM 表示每天，*:MM 表示每小时。
+	Start string `yaml:"start"`
+	// Duration 是窗口持续时间，每小时的窗口不能超过 1h，每天的窗口不能超过 24h。
+	Duration time.Duration `yaml:"duration"`
+	// Days 是窗口生效的星期（sun..sat），为空表示每天。
+	Days []string `yaml:"days,omitempty"`
+	// Timezone 是窗口使用的时区，默认 UTC。
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// hourly 判断窗口是否每小时重复。
+func (b *RestartBlackout) hourly() bool {
+	return strings.HasPrefix(b.Start, "*:")
+}
+
+// startTime 解析窗口开始时间，每小时的窗口只有分钟有效。
+func (b *RestartBlackout) startTime() (time.Time, error) {
+	if b.hourly() {
+		return time.Parse("04", strings.TrimPrefix(b.Start, "*:"))
+	}
+	return time.Parse("15:04", b.Start)
+}
+
+// validate 校验重启禁止窗口。
+func (b *RestartBlackout) validate() error {
+	if _, err := b.startTime(); err != nil {
+		return fmt.Errorf("invalid start %q, expected HH:MM or *:MM", b.Start)
+	}
+	limit := 24 * time.Hour
+	if b.hourly() {
+		limit = time.Hour
+	}
+	if b.Duration <= 0 || b.Duration >= limit {
+		return fmt.Errorf("duration must be between 0 and %s", limit)
+	}
+	if _, err := time.LoadLocation(b.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	for _, d := range b.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+	}
+	return nil
+}
+
+// endAt 返回窗口在 now 时刻生效时的结束时间。
+func (b *RestartBlackout) endAt(now time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(b.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	start, err := b.startTime()
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(loc)
+	// A window that started in the previous hour or day may still be running.
+	for _, offset := range []int{0, -1} {
+		var begin time.Time
+		if b.hourly() {
+			hour := local.Add(time.Duration(offset) * time.Hour)
+			begin = time.Date(hour.Year(), hour.Month(), hour.Day(), hour.Hour(), start.Minute(), 0, 0, loc)
+		} else {
+			day := local.AddDate(0, 0, offset)
+			begin = time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		}
+		if !b.onDay(begin.Weekday()) {
+			continue
+		}
+		if end := begin.Add(b.Duration); !local.Before(begin) && local.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// onDay 判断窗口是否在指定星期生效。
+func (b *RestartBlackout) onDay(day time.Weekday) bool {
+	if len(b.Days) == 0 {
+		return true
+	}
+	for _, d := range b.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// restartBlackoutEnd 返回流在 now 时刻所处重启禁止窗口的最晚结束时间，不在窗口内时返回 false。
+func restartBlackoutEnd(cfg StreamConfig, now time.Time) (time.Time, bool) {
+	var end time.Time
+	for i := range cfg.RestartBlackout {
+		if e, ok := cfg.RestartBlackout[i].endAt(now); ok && e.After(end) {
+			end = e
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// deferRestart 在 ffmpeg 正在运行且处于重启禁止窗口内时记录待应用的新配置并返回 true。
+// 调用方需持有 state.mu 写锁。
+func deferRestart(w *StreamWorker, next StreamConfig, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	end, ok := restartBlackoutEnd(w.cfg, now)
+	if !ok || !w.running {
+		return false
+	}
+	w.deferredCfg = &next
+	slog.Info("restart deferred by blackout window", "stream_id", next.ID, "until", end)
+	return true
+}
+
+// applyDeferredRestarts 对重启禁止窗口已结束（或 ffmpeg 已退出）的流应用推迟的配置并重启 ffmpeg。
+func applyDeferredRestarts(state *AppState, now time.Time) {
+	var restarting []*StreamWorker
+	for id, w := range state.workers.snapshot() {
+		w.mu.Lock()
+		if w.deferredCfg != nil {
+			if _, ok := restartBlackoutEnd(w.cfg, now); !ok || !w.running {
+				slog.Info("applying deferred config change", "stream_id", id)
+				w.cfg = *w.deferredCfg
+				w.deferredCfg = nil
+				restarting = append(restarting, w)
+			}
+		}
+		w.mu.Unlock()
+	}
+
+	// The worker loop picks up the new config when ffmpeg exits.
+	for _, w := range restarting {
+		w.Terminate()
+	}
+}
+
+// runDeferredRestarts 每秒检查一次推迟的重启。
+func runDeferredRestarts(state *AppState) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		applyDeferredRestarts(state, now)
+	}
+}
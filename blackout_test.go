@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRestartBlackoutEndAt 测试每小时和每天的重启禁止窗口，包括跨整点和按星期生效
+func TestRestartBlackoutEndAt(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	// 2026-10-15 is a Thursday.
+	cases := []struct {
+		b   RestartBlackout
+		now string
+		end string
+	}{
+		{RestartBlackout{Start: "*:58", Duration: 4 * time.Minute}, "2026-10-15T09:59:00Z", "2026-10-15T10:02:00Z"},
+		{RestartBlackout{Start: "*:58", Duration: 4 * time.Minute}, "2026-10-15T10:01:30Z", "2026-10-15T10:02:00Z"},
+		{RestartBlackout{Start: "*:58", Duration: 4 * time.Minute}, "2026-10-15T10:02:00Z", ""},
+		{RestartBlackout{Start: "23:30", Duration: time.Hour}, "2026-10-16T00:10:00Z", "2026-10-16T00:30:00Z"},
+		{RestartBlackout{Start: "20:00", Duration: time.Hour, Timezone: "Asia/Shanghai"}, "2026-10-15T12:30:00Z", "2026-10-15T13:00:00Z"},
+		{RestartBlackout{Start: "12:00", Duration: time.Hour, Days: []string{"fri"}}, "2026-10-15T12:30:00Z", ""},
+		{RestartBlackout{Start: "12:00", Duration: time.Hour, Days: []string{"Thu"}}, "2026-10-15T12:30:00Z", "2026-10-15T13:00:00Z"},
+	}
+	for _, tc := range cases {
+		if err := tc.b.validate(); err != nil {
+			t.Fatalf("%+v: %v", tc.b, err)
+		}
+		end, ok := tc.b.endAt(at(tc.now))
+		switch {
+		case tc.end == "" && ok:
+			t.Errorf("%s %s: in window until %s, want outside", tc.b.Start, tc.now, end)
+		case tc.end != "" && (!ok || !end.Equal(at(tc.end))):
+			t.Errorf("%s %s: end = %s, %v; want %s", tc.b.Start, tc.now, end, ok, tc.end)
+		}
+	}
+	for _, b := range []RestartBlackout{
+		{Start: "*:58", Duration: time.Hour},
+		{Start: "25:00", Duration: time.Minute},
+		{Start: "*:58"},
+		{Start: "12:00", Duration: time.Minute, Days: []string{"someday"}},
+	} {
+		if err := b.validate(); err == nil {
+			t.Errorf("%+v: expected error", b)
+		}
+	}
+}
+
+// TestDeferredRestart 测试窗口内运行中的流推迟应用新配置，窗口结束后再应用
+func TestDeferredRestart(t *testing.T) {
+	now := time.Now().UTC()
+	window := RestartBlackout{Start: "*:" + now.Format("04"), Duration: 2 * time.Minute}
+	old := StreamConfig{ID: "a", Dst: "rtmp://old.example.com/app/key", RestartBlackout: []RestartBlackout{window}}
+	next := old
+	next.Dst = "rtmp://new.example.com/app/key"
+
+	w := &StreamWorker{cfg: old, running: true}
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"a": w})}
+	if !deferRestart(w, next, now) {
+		t.Fatal("restart not deferred inside the window")
+	}
+	applyDeferredRestarts(state, now.Add(30*time.Second))
+	if w.config().Dst != old.Dst {
+		t.Fatal("deferred config applied inside the window")
+	}
+	applyDeferredRestarts(state, now.Add(3*time.Minute))
+	if w.config().Dst != next.Dst || w.deferredCfg != nil {
+		t.Errorf("deferred config not applied after the window: %s", w.config().Dst)
+	}
+
+	// A stream that is already down restarts right away.
+	w.running = false
+	if deferRestart(w, old, now) {
+		t.Error("restart deferred for a stream that is not running")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// MaxBurnInDuration 是调试叠加允许的最长持续时间，避免忘记关闭后长期转码。
+const MaxBurnInDuration = 24 * time.Hour
+
+// burnInActive 判断流在 now 时刻是否处于调试叠加期间。
+func burnInActive(cfg StreamConfig, now time.Time) bool {
+	return !cfg.BurnInUntil.IsZero() && now.Before(cfg.BurnInUntil)
+}
+
+// burnInFilter 返回叠加主机名、流 ID、本地时间和 PTS 的 drawtext 滤镜。
+func burnInFilter(streamID string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	text := "%{localtime} " + drawtextSafe(host) + " " + drawtextSafe(streamID) + " pts %{pts\\:hms}"
+	return "drawtext=text='" + text + "':x=10:y=10:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.6"
+}
+
+// drawtextSafe 将 drawtext 和滤镜图中有特殊含义的字符替换为下划线。
+func drawtextSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
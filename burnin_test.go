@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPlanBurnIn 测试调试叠加期间强制视频转码
+func TestPlanBurnIn(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	cfg := StreamConfig{ID: "cam:1'x", Dst: "rtmp://dest.com/live", BurnInUntil: now.Add(10 * time.Minute)}
+
+	plan := planBurnIn(outputPlan{Format: "flv"}, cfg, nil, now)
+	if !plan.TranscodeVideo || plan.Profile == nil || plan.TranscodeAudio {
+		t.Fatalf("expected video-only transcode during burn-in, got %+v", plan)
+	}
+	joined := strings.Join(plan.codecArgs(), " ")
+	if !strings.Contains(joined, "-vf drawtext=") || !strings.Contains(joined, "cam_1_x") {
+		t.Errorf("expected sanitized drawtext overlay, got %s", joined)
+	}
+
+	plan = planBurnIn(outputPlan{Format: "flv"}, cfg, nil, now.Add(time.Hour))
+	if plan.TranscodeVideo || plan.BurnIn != "" {
+		t.Errorf("expected no overlay after burn_in_until, got %+v", plan)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCanaryMinChanges 是触发金丝雀验证的默认变更流数。
+	DefaultCanaryMinChanges = 10
+	// DefaultCanaryHealthyFor 是金丝雀流需要连续运行的默认时长。
+	DefaultCanaryHealthyFor = 10 * time.Second
+	// DefaultCanaryTimeout 是等待金丝雀流稳定运行的默认超时时间。
+	DefaultCanaryTimeout = 60 * time.Second
+	// canaryPollInterval 是检查金丝雀流状态的间隔。
+	canaryPollInterval = 500 * time.Millisecond
+)
+
+// CanaryConfig 表示重载时的金丝雀验证：变更的流较多时，先只把新配置应用到金丝雀流，
+// 它稳定运行后再应用其余变更，否则回滚，避免一次错误的全局修改让所有流同时中断。
+type CanaryConfig struct {
+	// Stream 是金丝雀流的 ID，必须在配置中。
+	Stream string `yaml:"stream"`
+	// MinChanges 是触发验证的最少变更流数（新增、修改、删除），默认 10。
+	MinChanges int `yaml:"min_changes,omitempty"`
+	// HealthyFor 是金丝雀流需要连续运行的时长，默认 10s。
+	HealthyFor time.Duration `yaml:"healthy_for,omitempty"`
+	// Timeout 是等待金丝雀流稳定运行的最长时间，默认 60s。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// validate 校验金丝雀配置，streams 是配置中的全部流。
+func (c *CanaryConfig) validate(streams []StreamConfig) error {
+	if c.Stream == "" {
+		return fmt.Errorf("stream is required")
+	}
+	if indexOfStream(streams, c.Stream) < 0 {
+		return fmt.Errorf("stream %q is not in streams", c.Stream)
+	}
+	if c.MinChanges < 0 || c.HealthyFor < 0 || c.Timeout < 0 {
+		return fmt.Errorf("min_changes, healthy_for and timeout must not be negative")
+	}
+	o := c.withDefaults()
+	if o.Timeout <= o.HealthyFor {
+		return fmt.Errorf("timeout must be longer than healthy_for")
+	}
+	return nil
+}
+
+// withDefaults 返回填充了默认值的副本。
+func (c CanaryConfig) withDefaults() CanaryConfig {
+	if c.MinChanges == 0 {
+		c.MinChanges = DefaultCanaryMinChanges
+	}
+	if c.HealthyFor == 0 {
+		c.HealthyFor = DefaultCanaryHealthyFor
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultCanaryTimeout
+	}
+	return c
+}
+
+// changedStreams 返回从 old 到 cfg 新增、修改或删除的流数，改名但配置未变的流不计入。
+func changedStreams(old, cfg *Config) int {
+	prev := make(map[string]StreamConfig, len(old.Streams))
+	for _, s := range old.Streams {
+		prev[s.ID] = s
+	}
+	n := 0
+	for _, s := range cfg.Streams {
+		p, ok := prev[s.ID]
+		if !ok {
+			for _, id := range s.RenamedFrom {
+				if p, ok = prev[id]; ok {
+					delete(prev, id)
+					break
+				}
+			}
+		}
+		if !ok || len(streamConfigDiff(p, s)) > 0 {
+			n++
+		}
+		delete(prev, s.ID)
+	}
+	return n + len(prev)
+}
+
+// stageCanary 返回金丝雀阶段的配置：流列表保持 old 不变，只有金丝雀流换成新配置。
+// verifyCanary 只在全局配置段未变化时验证，因此全局配置取自 cfg 与取自 old 相同。
+func stageCanary(old, cfg *Config) *Config {
+	// The canary is validated to be in cfg.Streams.
+	canary := cfg.Streams[indexOfStream(cfg.Streams, cfg.Canary.Stream)]
+	staged := *cfg
+	staged.Streams = make([]StreamConfig, 0, len(old.Streams)+1)
+	replaced := false
+	for _, s := range old.Streams {
+		switch {
+		case s.ID == canary.ID:
+			staged.Streams = append(staged.Streams, canary)
+			replaced = true
+		case containsString(canary.RenamedFrom, s.ID):
+			// Leave the old ID out so the worker is renamed instead of duplicated.
+		default:
+			staged.Streams = append(staged.Streams, s)
+		}
+	}
+	if !replaced {
+		staged.Streams = append(staged.Streams, canary)
+	}
+	return &staged
+}
+
+// indexOfStream 返回流在列表中的下标，不存在时返回 -1。
+func indexOfStream(streams []StreamConfig, id string) int {
+	for i, s := range streams {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// runningSince 返回当前 ffmpeg 进程的启动时间，未运行时返回零值。
+func (w *StreamWorker) runningSince() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running {
+		return time.Time{}
+	}
+	return w.stats.runStart
+}
+
+// waitCanaryHealthy 等待金丝雀流在 since 之后启动并连续运行 healthyFor。
+func waitCanaryHealthy(state *AppState, id string, since time.Time, c CanaryConfig) bool {
+	deadline := time.Now().Add(c.Timeout)
+	for time.Now().Before(deadline) {
+		if w, ok := state.workers.get(id); ok {
+			if start := w.runningSince(); !start.Before(since) && time.Since(start) >= c.HealthyFor {
+				return true
+			}
+		}
+		time.Sleep(canaryPollInterval)
+	}
+	return false
+}
+
+// verifyCanary 在应用 cfg 之前进行金丝雀验证。变更的流不足 min_changes 或金丝雀流自身未变化时直接返回 nil；
+// 同时修改了全局配置段时拒绝重载，全局配置对所有流同时生效，无法只在金丝雀流上验证；
+// 金丝雀流未能稳定运行时恢复 old 并返回错误。返回错误时调用方不应再应用 cfg。
+func verifyCanary(state *AppState, cfg *Config) error {
+	if cfg.Canary == nil {
+		return nil
+	}
+	c := cfg.Canary.withDefaults()
+	state.mu.RLock()
+	old := state.config
+	state.mu.RUnlock()
+	if old == nil {
+		return nil
+	}
+	changed := changedStreams(old, cfg)
+	if changed < c.MinChanges {
+		return nil
+	}
+
+	// Global sections (profiles, hooks, settings, alerts, ...) are process-wide: staging them
+	// would put them into effect for every stream before the canary has proven anything.
+	if sections := globalConfigDiff(old, cfg); len(sections) > 0 {
+		slog.Error("reload rejected, canary cannot verify global changes", "sections", sections, "changed", changed)
+		return fmt.Errorf("reload changes %d streams and the global sections %s; a canary cannot verify global changes without applying them to every stream, reload the global changes separately",
+			changed, strings.Join(sections, ", "))
+	}
+	canary := cfg.Streams[indexOfStream(cfg.Streams, c.Stream)]
+	if i := indexOfStream(old.Streams, c.Stream); i >= 0 && len(streamConfigDiff(old.Streams[i], canary)) == 0 {
+		slog.Warn("canary stream is not changed by this reload, nothing to verify", "stream_id", c.Stream, "changed", changed)
+		return nil
+	}
+
+	staged := stageCanary(old, cfg)
+	slog.Info("verifying canary stream before applying reload", "stream_id", c.Stream, "changed", changed, "timeout", c.Timeout)
+	since := time.Now()
+	if err := applyConfig(state, staged); err != nil {
+		slog.Warn("canary config applied with errors", "error", err)
+	}
+	if waitCanaryHealthy(state, c.Stream, since, c) {
+		slog.Info("canary stream healthy, applying reload", "stream_id", c.Stream)
+		return nil
+	}
+
+	slog.Error("canary stream not healthy, rolling back reload", "stream_id", c.Stream, "healthy_for", c.HealthyFor, "timeout", c.Timeout)
+	if err := applyConfig(state, old); err != nil {
+		slog.Warn("rollback applied with errors", "error", err)
+	}
+	emitEvent(c.Stream, "canary_failed", c.HealthyFor, c.Timeout)
+	return fmt.Errorf("canary stream %s did not stay up for %s within %s, reload rolled back", c.Stream, c.HealthyFor, c.Timeout)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStageCanary 测试金丝雀阶段只替换金丝雀流，其余流保持旧配置
+func TestStageCanary(t *testing.T) {
+	old := &Config{Streams: []StreamConfig{
+		{ID: "canary", Src: "rtmp://a/live/c", Dst: "rtmp://b/live/c"},
+		{ID: "s1", Src: "rtmp://a/live/1", Dst: "rtmp://b/live/1"},
+		{ID: "s2", Src: "rtmp://a/live/2", Dst: "rtmp://b/live/2"},
+	}}
+	cfg := &Config{
+		Canary: &CanaryConfig{Stream: "canary", MinChanges: 2},
+		Streams: []StreamConfig{
+			{ID: "canary", Src: "rtmp://a/live/c", Dst: "rtmp://x/live/c"},
+			{ID: "s1", Src: "rtmp://a/live/1", Dst: "rtmp://x/live/1"},
+			{ID: "s3", Src: "rtmp://a/live/3", Dst: "rtmp://x/live/3"},
+		},
+	}
+	// canary and s1 changed, s3 added, s2 removed.
+	if n := changedStreams(old, cfg); n != 4 {
+		t.Errorf("changedStreams = %d, want 4", n)
+	}
+	staged := stageCanary(old, cfg)
+	var got []string
+	for _, s := range staged.Streams {
+		got = append(got, s.ID+"="+s.Dst)
+	}
+	want := "canary=rtmp://x/live/c,s1=rtmp://b/live/1,s2=rtmp://b/live/2"
+	if strings.Join(got, ",") != want {
+		t.Errorf("staged streams %v, want %s", got, want)
+	}
+	if staged.Canary != cfg.Canary || len(old.Streams) != 3 || old.Streams[0].Dst != "rtmp://b/live/c" {
+		t.Error("staging must take global settings from the new config and leave the old config untouched")
+	}
+}
+
+// TestCanaryValidate 测试金丝雀配置的校验
+func TestCanaryValidate(t *testing.T) {
+	streams := []StreamConfig{{ID: "canary"}}
+	cases := []struct {
+		c  CanaryConfig
+		ok bool
+	}{
+		{CanaryConfig{Stream: "canary"}, true},
+		{CanaryConfig{}, false},
+		{CanaryConfig{Stream: "missing"}, false},
+		{CanaryConfig{Stream: "canary", HealthyFor: DefaultCanaryTimeout}, false},
+		{CanaryConfig{Stream: "canary", MinChanges: -1}, false},
+	}
+	for _, c := range cases {
+		if err := c.c.validate(streams); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c.c, err)
+		}
+	}
+}
+
+// TestVerifyCanaryGlobalChanges 测试同时修改全局配置段的重载被拒绝且不应用任何配置，金丝雀流未变化时不验证
+func TestVerifyCanaryGlobalChanges(t *testing.T) {
+	streams := []StreamConfig{
+		{ID: "canary", Src: "rtmp://a/live/c", Dst: "rtmp://b/live/c"},
+		{ID: "s1", Src: "rtmp://a/live/1", Dst: "rtmp://b/live/1"},
+	}
+	old := &Config{
+		Canary:            &CanaryConfig{Stream: "canary", MinChanges: 1},
+		TranscodeProfiles: map[string]TranscodeProfile{"hd": {VideoBitrate: "4000k"}},
+		Streams:           streams,
+	}
+	state := &AppState{config: old, workers: newWorkerMap(nil)}
+
+	cfg := *old
+	cfg.TranscodeProfiles = map[string]TranscodeProfile{"hd": {VideoBitrate: "6000k"}}
+	cfg.Streams = []StreamConfig{streams[0], {ID: "s1", Src: "rtmp://a/live/1", Dst: "rtmp://x/live/1"}}
+	if got := globalConfigDiff(old, &cfg); strings.Join(got, ",") != "transcode_profiles" {
+		t.Errorf("globalConfigDiff = %v", got)
+	}
+	err := verifyCanary(state, &cfg)
+	if err == nil || !strings.Contains(err.Error(), "transcode_profiles") {
+		t.Errorf("expected the reload to be rejected, got %v", err)
+	}
+	if state.config != old {
+		t.Error("rejected reload must not apply the new global sections")
+	}
+
+	// Only s1 changed; the canary has nothing to prove and is not restarted.
+	cfg.TranscodeProfiles = old.TranscodeProfiles
+	if err := verifyCanary(state, &cfg); err != nil {
+		t.Errorf("unchanged canary: %v", err)
+	}
+	if g := globalConfigDiff(old, &Config{Canary: &CanaryConfig{Stream: "other"}, TranscodeProfiles: old.TranscodeProfiles}); len(g) != 0 {
+		t.Errorf("streams and canary are not global sections, got %v", g)
+	}
+}
@@ -0,0 +1,475 @@
+// Package client 是 stream-runner HTTP 接口的 Go 客户端，接口定义见 /openapi.json。
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetries 是请求失败后的默认重试次数。
+	DefaultRetries = 2
+	// DefaultRetryDelay 是第一次重试前的默认等待时间，之后每次翻倍。
+	DefaultRetryDelay = 500 * time.Millisecond
+	// maxErrorBody 是错误响应中读取的最大字节数。
+	maxErrorBody = 4096
+)
+
+// Client 是 stream-runner HTTP 接口的客户端，可被多个 goroutine 共享。
+// Version、Inventory、Metrics 访问指标服务（metrics.listen）；Logs、流的增删改查、配置导入和 WatchEvents
+// 访问管理接口（api.listen），需要设置 Token。Status 和 StreamStatus 两者都可以。
+type Client struct {
+	// BaseURL 是服务地址，如 http://127.0.0.1:9310。
+	BaseURL string
+	// Token 是管理接口的令牌，设置后以 Authorization: Bearer 发送。指标服务不需要令牌。
+	Token string
+	// HTTPClient 是发送请求使用的 HTTP 客户端。
+	HTTPClient *http.Client
+	// Retries 是连接失败或服务端返回 5xx 时的重试次数，0 表示不重试。
+	Retries int
+	// RetryDelay 是第一次重试前的等待时间，之后每次翻倍。
+	RetryDelay time.Duration
+}
+
+// New 创建使用默认超时和重试策略的客户端。
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base url must be an http(s) URL, got %q", baseURL)
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+	}, nil
+}
+
+// APIError 是服务端返回的非 2xx 响应。
+type APIError struct {
+	// StatusCode 是 HTTP 状态码。
+	StatusCode int
+	// Message 是错误描述：管理接口 JSON 错误中的 error 字段，或纯文本响应正文。
+	Message string
+}
+
+// Error 实现 error 接口。
+func (e *APIError) Error() string {
+	return fmt.Sprintf("stream-runner: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// BuildInfo 是守护进程的版本和构建信息（GET /version）。
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	// Protocol 是节点间接口的协议版本，旧版本的守护进程不返回该字段，此时为 0。
+	Protocol int `json:"protocol"`
+}
+
+// LogRecord 是一条守护进程日志或 ffmpeg 输出（GET /logs）。
+type LogRecord struct {
+	Time     string `json:"time"`
+	Level    string `json:"level"`
+	Msg      string `json:"msg"`
+	StreamID string `json:"stream_id,omitempty"`
+	// Source 为 ffmpeg 时表示该记录是 ffmpeg 的输出。
+	Source string `json:"source,omitempty"`
+	// Attrs 是记录中的全部字段，包括上面已解析的字段。
+	Attrs map[string]any `json:"-"`
+}
+
+// InventoryStream 是节点清单中的一路流，只包含地址的主机部分。
+type InventoryStream struct {
+	ID      string            `json:"id"`
+	Running bool              `json:"running"`
+	Region  string            `json:"region,omitempty"`
+	SrcHost string            `json:"src_host,omitempty"`
+	DstHost string            `json:"dst_host,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// NodeInventory 是节点清单（GET /inventory）中的主机信息。
+type NodeInventory struct {
+	// Host 是清单中的主机名。
+	Host    string
+	Version string
+	Region  string
+	Streams []InventoryStream
+	// Groups 是主机所属的 Ansible 组。
+	Groups []string
+}
+
+// StreamStatus 是一路流的运行状态（GET /status）。
+type StreamStatus struct {
+	ID string `json:"id"`
+	// State 是 running、backoff、starting、off_schedule、stopped 或 paused。
+	State         string            `json:"state"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Region        string            `json:"region,omitempty"`
+	DstHost       string            `json:"dst_host,omitempty"`
+	Restarts      int64             `json:"restarts"`
+	Failures      int64             `json:"failures"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	// PID 是当前 ffmpeg 进程的 pid，未运行时为 0。
+	PID int `json:"pid,omitempty"`
+	// StartedAt 是当前 ffmpeg 进程的启动时间，未运行时为空。
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Health 是健康分，0~100，越高越健康。
+	Health float64 `json:"health"`
+	// Degraded 是当前偏离自身基线的指标（bitrate、fps）。
+	Degraded []string `json:"degraded,omitempty"`
+	// LastError 是最近一次出错的记录，从未出错时为空。
+	LastError *StreamError `json:"last_error,omitempty"`
+	// ExpiresAt 是临时流的到期时间，配置中的流为空。
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Platform 是平台侧的直播状态，只有配置了 platform 的流才有。
+	Platform *PlatformStatus `json:"platform,omitempty"`
+	// Outputs 是各路输出的状态，只有配置了附加输出的流才有，第一项是 dst。
+	Outputs []OutputStatus `json:"outputs,omitempty"`
+	// Logs 是最近的 ffmpeg 输出，只有 StreamStatus 返回。
+	Logs []string `json:"logs,omitempty"`
+}
+
+// OutputStatus 是流的一路输出的状态。
+type OutputStatus struct {
+	// Name 是输出名称，dst 为 primary。
+	Name    string `json:"name"`
+	Format  string `json:"format"`
+	DstHost string `json:"dst_host,omitempty"`
+	// State 是 running、failed 或 down。
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	FailedAt *time.Time `json:"failed_at,omitempty"`
+	// Restarts 是独立推送的输出单独重启的次数。
+	Restarts int64 `json:"restarts,omitempty"`
+}
+
+// PlatformStatus 是从直播平台 API 查询到的直播状态。
+type PlatformStatus struct {
+	// Type 是 youtube、twitch 或 facebook。
+	Type string `json:"type"`
+	// State 是平台返回的原始状态。
+	State   string `json:"state,omitempty"`
+	Healthy bool   `json:"healthy"`
+	// Viewers 是同时在线观众数，平台未提供时为空。
+	Viewers *int64    `json:"viewers,omitempty"`
+	Checked time.Time `json:"checked"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// StreamError 是流最近一次出错的记录，描述中的地址只保留主机部分。
+type StreamError struct {
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// StatusPage 是一页流状态。
+type StatusPage struct {
+	// Total 是符合条件的流总数（分页前）。
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Streams []StreamStatus `json:"streams"`
+}
+
+// StatusQuery 是查询流状态的筛选、排序和分页条件，零值返回按 ID 排序的第一页。
+type StatusQuery struct {
+	// States 只返回这些状态的流。
+	States []string
+	// Labels 只返回包含全部这些标签的流。
+	Labels map[string]string
+	// Search 是流 ID 中需要包含的子串（不区分大小写）。
+	Search string
+	// Errors 只返回最近错误属于这些类别的流，none 表示从未出错。
+	Errors []string
+	// Sort 是排序字段，前缀 - 表示降序。
+	Sort   string
+	Offset int
+	// Limit 是每页数量，0 表示使用服务端默认值。
+	Limit int
+}
+
+// LogQuery 是查询日志的过滤条件，零值表示不过滤。
+type LogQuery struct {
+	// Level 是最低级别：debug、info、warn 或 error。
+	Level string
+	// StreamID 只返回该流的记录。
+	StreamID string
+	// Limit 只返回最新的若干条记录。
+	Limit int
+}
+
+// Version 返回守护进程的版本和构建信息。
+func (c *Client) Version(ctx context.Context) (*BuildInfo, error) {
+	var info BuildInfo
+	err := c.get(ctx, "/version", nil, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Logs 返回内存日志缓冲区中符合条件的记录，按时间从旧到新排列。
+// /logs 只在管理接口上提供，BaseURL 需指向 api.listen，Token 需为 operator 或 admin 角色。
+// 守护进程未配置 metrics.log_buffer 时返回 StatusCode 为 404 的 *APIError。
+func (c *Client) Logs(ctx context.Context, q LogQuery) ([]LogRecord, error) {
+	params := url.Values{}
+	if q.Level != "" {
+		params.Set("level", q.Level)
+	}
+	if q.StreamID != "" {
+		params.Set("stream", q.StreamID)
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var records []LogRecord
+	err := c.get(ctx, "/logs", params, func(body io.Reader) error {
+		records = records[:0]
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			rec, err := parseLogRecord(scanner.Bytes())
+			if err != nil {
+				return err
+			}
+			records = append(records, rec)
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Status 返回一页符合条件的流状态。
+func (c *Client) Status(ctx context.Context, q StatusQuery) (*StatusPage, error) {
+	params := url.Values{}
+	if len(q.States) > 0 {
+		params.Set("state", strings.Join(q.States, ","))
+	}
+	labels := make([]string, 0, len(q.Labels))
+	for k, v := range q.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	if len(labels) > 0 {
+		params["label"] = labels
+	}
+	if q.Search != "" {
+		params.Set("q", q.Search)
+	}
+	if len(q.Errors) > 0 {
+		params.Set("error", strings.Join(q.Errors, ","))
+	}
+	if q.Sort != "" {
+		params.Set("sort", q.Sort)
+	}
+	if q.Offset > 0 {
+		params.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page StatusPage
+	err := c.get(ctx, "/status", params, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// StreamStatus 返回单路流的状态，包括最近的 ffmpeg 输出。流不存在时返回 StatusCode 为 404 的 *APIError。
+func (c *Client) StreamStatus(ctx context.Context, id string) (*StreamStatus, error) {
+	var s StreamStatus
+	err := c.get(ctx, "/status/"+url.PathEscape(id), nil, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Inventory 返回节点清单，host 为空时使用守护进程的 hostname。
+func (c *Client) Inventory(ctx context.Context, host string) (*NodeInventory, error) {
+	params := url.Values{}
+	if host != "" {
+		params.Set("host", host)
+	}
+	var inv *NodeInventory
+	err := c.get(ctx, "/inventory", params, func(body io.Reader) error {
+		var err error
+		inv, err = parseInventory(body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// parseInventory 从 Ansible 清单格式中取出唯一主机的信息。
+func parseInventory(body io.Reader) (*NodeInventory, error) {
+	var raw struct {
+		All struct {
+			Children []string `json:"children"`
+		} `json:"all"`
+		Meta struct {
+			Hostvars map[string]struct {
+				Version string            `json:"stream_runner_version"`
+				Region  string            `json:"stream_runner_region"`
+				Streams []InventoryStream `json:"stream_runner_streams"`
+			} `json:"hostvars"`
+		} `json:"_meta"`
+	}
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Meta.Hostvars) != 1 {
+		return nil, fmt.Errorf("expected one host in inventory, got %d", len(raw.Meta.Hostvars))
+	}
+	for host, vars := range raw.Meta.Hostvars {
+		return &NodeInventory{Host: host, Version: vars.Version, Region: vars.Region, Streams: vars.Streams, Groups: raw.All.Children}, nil
+	}
+	return nil, nil
+}
+
+// Metrics 返回 Prometheus 文本格式的指标。
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	var text string
+	err := c.get(ctx, "/metrics", nil, func(body io.Reader) error {
+		data, err := io.ReadAll(body)
+		text = string(data)
+		return err
+	})
+	return text, err
+}
+
+// parseLogRecord 解析一行 JSON 日志记录。
+func parseLogRecord(line []byte) (LogRecord, error) {
+	var rec LogRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return rec, fmt.Errorf("invalid log record: %w", err)
+	}
+	if err := json.Unmarshal(line, &rec.Attrs); err != nil {
+		return rec, fmt.Errorf("invalid log record: %w", err)
+	}
+	return rec, nil
+}
+
+// request 是一次 HTTP 请求的内容。
+type request struct {
+	method string
+	path   string
+	params url.Values
+	header http.Header
+	body   []byte
+}
+
+// get 发送 GET 请求并用 decode 处理 2xx 响应正文。
+func (c *Client) get(ctx context.Context, path string, params url.Values, decode func(io.Reader) error) error {
+	_, err := c.send(ctx, request{method: http.MethodGet, path: path, params: params}, func(_ *http.Response, body io.Reader) error {
+		return decode(body)
+	})
+	return err
+}
+
+// send 发送请求并用 decode 处理 2xx 响应，decode 为 nil 时忽略正文，返回响应的状态码。
+// 连接失败和 5xx 响应按 Retries 重试，4xx 和解码错误直接返回。POST 不是幂等操作，不重试。
+func (c *Client) send(ctx context.Context, req request, decode func(*http.Response, io.Reader) error) (int, error) {
+	u := c.BaseURL + req.path
+	if len(req.params) > 0 {
+		u += "?" + req.params.Encode()
+	}
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		code, err := c.do(ctx, req, u, decode)
+		var apiErr *APIError
+		retryable := err != nil && (!errors.As(err, &apiErr) || apiErr.StatusCode >= 500) && !errors.Is(err, errDecode)
+		if !retryable || attempt >= c.Retries || req.method == http.MethodPost {
+			return code, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// errDecode 标记响应正文解码失败，这类错误重试也不会成功。
+var errDecode = errors.New("decode response")
+
+// do 发送一次请求。
+func (c *Client) do(ctx context.Context, r request, u string, decode func(*http.Response, io.Reader) error) (int, error) {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, newAPIError(resp)
+	}
+	if decode == nil {
+		return resp.StatusCode, nil
+	}
+	if err := decode(resp, resp.Body); err != nil {
+		return resp.StatusCode, fmt.Errorf("%w %s: %w", errDecode, u, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// httpClient 返回发送请求使用的 HTTP 客户端。
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// newAPIError 读取非 2xx 响应。管理接口的错误正文是 {"error": "..."}，取出其中的描述；其他正文原样保留。
+func newAPIError(resp *http.Response) *APIError {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(msg, &body) == nil && body.Error != "" {
+		return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClientRetries 测试 5xx 响应会重试、4xx 响应直接返回 APIError
+func TestClientRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/version":
+			if calls == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"version":"1.2.0","commit":"abc","build_date":"","go_version":"go1.21"}`))
+		case "/logs":
+			http.Error(w, "log buffer is not enabled", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RetryDelay = time.Millisecond
+	info, err := c.Version(context.Background())
+	if err != nil || info.Version != "1.2.0" || calls != 2 {
+		t.Fatalf("expected version after one retry, got %+v, %v after %d calls", info, err, calls)
+	}
+
+	calls = 0
+	_, err = c.Logs(context.Background(), LogQuery{Level: "warn"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || calls != 1 {
+		t.Errorf("expected a single 404 APIError, got %v after %d calls", err, calls)
+	}
+}
+
+// TestClientLogs 测试日志查询参数和 NDJSON 解析
+func TestClientLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.RawQuery; got != "level=warn&limit=2&stream=a" {
+			t.Errorf("unexpected query %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer operator-token" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		w.Write([]byte(`{"time":"t1","level":"WARN","msg":"stream event","stream_id":"a","event":"av_drift"}` + "\n" +
+			`{"time":"t2","level":"INFO","msg":"frame=1","stream_id":"a","source":"ffmpeg"}` + "\n"))
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	c.Token = "operator-token"
+	logs, err := c.Logs(context.Background(), LogQuery{Level: "warn", StreamID: "a", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].Attrs["event"] != "av_drift" || logs[1].Source != "ffmpeg" {
+		t.Errorf("unexpected records %+v", logs)
+	}
+}
+
+// TestClientStreams 测试流的增删改查：ETag、If-Match 冲突、JSON 错误描述，以及 POST 失败不重试
+func TestClientStreams(t *testing.T) {
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/streams/news":
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`{"id":"news","src":"rtmp://a/live","dst":"rtmp://b/live"}`))
+		case r.Method == http.MethodPut && r.Header.Get("If-Match") != `"v1"`:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"error":"stream was modified, fetch it again"}`))
+		case r.Method == http.MethodPut:
+			var s map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s["dst"] != "rtmp://c/live" {
+				t.Errorf("unexpected body %v: %v", s, err)
+			}
+			w.Header().Set("ETag", `"v2"`)
+			w.Write([]byte(`{"changed":true,"stream":{"id":"news","dst":"rtmp://c/live"}}`))
+		case r.Method == http.MethodPost:
+			posts++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"daemon is draining"}`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	c.RetryDelay = time.Millisecond
+	ctx := context.Background()
+	s, etag, err := c.GetStream(ctx, "news")
+	if err != nil || s.ID() != "news" || etag != `"v1"` {
+		t.Fatalf("GetStream: %v %q %v", s, etag, err)
+	}
+	s["dst"] = "rtmp://c/live"
+	if _, err := c.PutStream(ctx, "news", s, `"v0"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("stale If-Match: %v", err)
+	}
+	res, err := c.PutStream(ctx, "news", s, etag)
+	if err != nil || !res.Changed || res.ETag != `"v2"` || res.Stream["dst"] != "rtmp://c/live" {
+		t.Errorf("PutStream: %+v %v", res, err)
+	}
+
+	_, err = c.CreateStream(ctx, Stream{"id": "sports"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "daemon is draining" || posts != 1 {
+		t.Errorf("CreateStream: %v after %d posts", err, posts)
+	}
+	if res, err := c.DeleteStream(ctx, "news", ""); err != nil || !res.Changed || res.Error != "" {
+		t.Errorf("DeleteStream: %+v %v", res, err)
+	}
+}
+
+// TestClientReload 测试 Reload 先校验再按计划 ID 应用，校验不通过时不应用
+func TestClientReload(t *testing.T) {
+	applied := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/config/plan":
+			if strings.Contains(string(body), "bad") {
+				w.Write([]byte(`{"valid":false,"plan_id":"p0","errors":["yaml: line 1"],"streams":[{"id":"a","action":"invalid","error":"src is required"}],"summary":{"invalid":1}}`))
+				return
+			}
+			w.Write([]byte(`{"valid":true,"plan_id":"p1","streams":[{"id":"a","action":"add"}],"summary":{"add":1}}`))
+		case "/config/apply":
+			applied = r.URL.Query().Get("plan")
+			w.Write([]byte(`{"valid":true,"plan_id":"p1","streams":[{"id":"a","action":"add"}],"summary":{"add":1}}`))
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL)
+	plan, err := c.Reload(context.Background(), []byte("bad"))
+	if err == nil || !strings.Contains(err.Error(), "a: src is required") || plan == nil || applied != "" {
+		t.Errorf("invalid config: %+v %v, applied %q", plan, err, applied)
+	}
+	plan, err = c.Reload(context.Background(), []byte("streams: []"))
+	if err != nil || applied != "p1" || plan.Summary["add"] != 1 {
+		t.Errorf("valid config: %+v %v, applied %q", plan, err, applied)
+	}
+}
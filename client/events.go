@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// websocketGUID 是 RFC 6455 握手中拼接在 Sec-WebSocket-Key 之后的固定值。
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket 帧的操作码。
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// maxEventSize 是单条事件消息的上限，远大于实际的事件。
+const maxEventSize = 1 << 20
+
+// Event 是流的生命周期事件（GET /events）。
+type Event struct {
+	// Type 是 starting、started、exited、restarting 或 killed。
+	Type     string    `json:"type"`
+	StreamID string    `json:"stream_id"`
+	Time     time.Time `json:"time"`
+	// ExitCode 只在 exited 中出现，被信号终止时为 -1，启动失败时为空。
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Retries 是首次启动之后的重启次数。
+	Retries int64 `json:"retries"`
+	// RetryIn 是 restarting 事件中距下次启动的等待时长，如 4s。
+	RetryIn string `json:"retry_in,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ErrEventsOverflow 表示订阅者处理事件太慢、积压过多，服务端断开了连接。重新订阅后应通过 Status 补齐状态。
+var ErrEventsOverflow = errors.New("stream-runner: events subscriber fell behind and was disconnected")
+
+// WatchEvents 订阅管理接口的生命周期事件，对每个事件调用 fn，直到 ctx 取消、连接断开或 fn 返回错误。
+// streams 不为空时只订阅这些流。ctx 取消时返回 ctx.Err()，服务端正常关闭时返回 nil。
+// 需要 operator 及以上角色的令牌；订阅不重试，断开后由调用方决定是否重新订阅。
+func (c *Client) WatchEvents(ctx context.Context, streams []string, fn func(Event) error) error {
+	u := c.BaseURL + "/events"
+	if len(streams) > 0 {
+		u += "?" + url.Values{"stream": {strings.Join(streams, ",")}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	// The subscription is long-lived, so the client timeout must not cut it off.
+	hc := *c.httpClient()
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		return newAPIError(resp)
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return errors.New("stream-runner: events connection is not writable")
+	}
+	defer conn.Close()
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return errors.New("stream-runner: invalid Sec-WebSocket-Accept in events handshake")
+	}
+
+	// Closing the connection unblocks the read below when ctx is canceled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	r := bufio.NewReader(conn)
+	for {
+		op, payload, err := readServerFrame(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		switch op {
+		case wsOpText:
+			var ev Event
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				return fmt.Errorf("%w: invalid event: %w", errDecode, err)
+			}
+			if err := fn(ev); err != nil {
+				_ = writeClientFrame(conn, wsOpClose, binary.BigEndian.AppendUint16(nil, 1000))
+				return err
+			}
+		case wsOpPing:
+			if err := writeClientFrame(conn, wsOpPong, payload); err != nil {
+				return err
+			}
+		case wsOpClose:
+			// 1008 policy violation: the server dropped us for falling behind.
+			if len(payload) >= 2 && binary.BigEndian.Uint16(payload) == 1008 {
+				return ErrEventsOverflow
+			}
+			_ = writeClientFrame(conn, wsOpClose, payload[:min(len(payload), 2)])
+			return nil
+		}
+	}
+}
+
+// readServerFrame 读取一个服务端帧。服务端帧不带掩码，事件不分片。
+func readServerFrame(r io.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	if head[1]&0x80 != 0 {
+		return 0, nil, errors.New("masked server frame")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxEventSize {
+		return 0, nil, fmt.Errorf("server frame of %d bytes exceeds %d", n, maxEventSize)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return op, payload, nil
+}
+
+// writeClientFrame 发送一个带掩码的控制帧，客户端发出的帧必须带掩码。
+func writeClientFrame(w io.Writer, op byte, payload []byte) error {
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame := append([]byte{0x80 | op, 0x80 | byte(len(payload))}, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
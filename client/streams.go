@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 以下方法访问管理接口（api.listen），BaseURL 需指向管理接口并设置 Token。
+// 读取需要 operator 及以上角色，修改流配置和导入配置需要 admin 角色。
+
+// Stream 是配置中的一路流，字段与 streams.yml 相同（如 id、src、dst）。
+// PutStream 整体替换流，修改时应在 GetStream 的结果上改动，保留其余字段。
+type Stream map[string]any
+
+// ID 返回流 ID。
+func (s Stream) ID() string {
+	id, _ := s["id"].(string)
+	return id
+}
+
+// StreamWriteResult 是新增、替换或删除流的结果。
+type StreamWriteResult struct {
+	// Changed 表示请求实际修改了配置；内容未变化时为 false，ffmpeg 不会重启。
+	Changed bool `json:"changed"`
+	// Stream 是保存后的流，删除时为空。
+	Stream Stream `json:"stream,omitempty"`
+	// Error 是修改已生效、但 ffmpeg 停止或重启失败时的错误，不应重试或回滚修改。
+	Error string `json:"error,omitempty"`
+	// ETag 是保存后的流的 ETag，可作为下一次修改的 ifMatch。
+	ETag string `json:"-"`
+}
+
+// ErrPreconditionFailed 表示 ifMatch 与流当前的 ETag 不一致，流已被他人修改，需要重新读取。
+var ErrPreconditionFailed = errors.New("stream-runner: stream was modified, fetch it again")
+
+// ConfigPlan 是校验完整配置得到的计划（POST /config/plan）。
+type ConfigPlan struct {
+	Valid bool `json:"valid"`
+	// PlanID 标识被校验的配置和当时的配置文件，ApplyConfig 时原样提交。
+	PlanID string `json:"plan_id"`
+	// Errors 是不属于单路流的错误，如 YAML 语法错误或全局配置错误。
+	Errors  []string          `json:"errors,omitempty"`
+	Streams []ConfigPlanEntry `json:"streams"`
+	// Summary 是各动作的流数。
+	Summary map[string]int `json:"summary"`
+}
+
+// ConfigPlanEntry 是计划中一路流的变化。
+type ConfigPlanEntry struct {
+	ID string `json:"id"`
+	// Action 是 add、update、rename、unchanged、remove 或 invalid。
+	Action     string `json:"action"`
+	PreviousID string `json:"previous_id,omitempty"`
+	// Changed 是会导致 ffmpeg 重启的字段。
+	Changed []string `json:"changed,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// ListStreams 返回配置中的流，按 ID 排序。临时流不在其中。
+func (c *Client) ListStreams(ctx context.Context) ([]Stream, error) {
+	var streams []Stream
+	err := c.get(ctx, "/streams", nil, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&streams)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
+
+// GetStream 返回一路流及其 ETag。流不存在时返回 StatusCode 为 404 的 *APIError。
+func (c *Client) GetStream(ctx context.Context, id string) (Stream, string, error) {
+	var s Stream
+	var etag string
+	_, err := c.send(ctx, request{method: http.MethodGet, path: streamPath(id)}, func(resp *http.Response, body io.Reader) error {
+		etag = resp.Header.Get("ETag")
+		return json.NewDecoder(body).Decode(&s)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return s, etag, nil
+}
+
+// CreateStream 新增一路流，ID 已存在时返回 StatusCode 为 409 的 *APIError。
+func (c *Client) CreateStream(ctx context.Context, s Stream) (*StreamWriteResult, error) {
+	return c.writeStream(ctx, http.MethodPost, "/streams", s, "")
+}
+
+// PutStream 创建或整体替换一路流，重复提交相同的内容不会重启 ffmpeg，可以安全重试。
+// ifMatch 不为空时只在流的 ETag 仍与之相同时修改，否则返回 ErrPreconditionFailed。
+func (c *Client) PutStream(ctx context.Context, id string, s Stream, ifMatch string) (*StreamWriteResult, error) {
+	return c.writeStream(ctx, http.MethodPut, streamPath(id), s, ifMatch)
+}
+
+// DeleteStream 从配置中删除一路流并停止它，流不存在时不是错误。ifMatch 的含义与 PutStream 相同。
+// 配置已修改、但停止 ffmpeg 失败时返回的结果中 Error 不为空。
+func (c *Client) DeleteStream(ctx context.Context, id, ifMatch string) (*StreamWriteResult, error) {
+	header := http.Header{}
+	if ifMatch != "" {
+		header.Set("If-Match", ifMatch)
+	}
+	res := &StreamWriteResult{Changed: true}
+	code, err := c.send(ctx, request{method: http.MethodDelete, path: streamPath(id), header: header}, func(resp *http.Response, body io.Reader) error {
+		if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		return json.NewDecoder(body).Decode(res)
+	})
+	if code == http.StatusPreconditionFailed {
+		return nil, ErrPreconditionFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeStream 以 JSON 提交流并解析 StreamWriteResult。
+func (c *Client) writeStream(ctx context.Context, method, path string, s Stream, ifMatch string) (*StreamWriteResult, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if ifMatch != "" {
+		header.Set("If-Match", ifMatch)
+	}
+	var res StreamWriteResult
+	code, err := c.send(ctx, request{method: method, path: path, header: header, body: data}, func(resp *http.Response, body io.Reader) error {
+		res.ETag = resp.Header.Get("ETag")
+		return json.NewDecoder(body).Decode(&res)
+	})
+	if code == http.StatusPreconditionFailed {
+		return nil, ErrPreconditionFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// streamPath 返回流的资源路径。
+func streamPath(id string) string {
+	return "/streams/" + url.PathEscape(id)
+}
+
+// PlanConfig 校验完整的配置文件（YAML）并返回应用后的变化，不做任何修改。
+func (c *Client) PlanConfig(ctx context.Context, doc []byte) (*ConfigPlan, error) {
+	var plan ConfigPlan
+	_, err := c.send(ctx, request{method: http.MethodPost, path: "/config/plan", header: yamlHeader(), body: doc}, func(_ *http.Response, body io.Reader) error {
+		return json.NewDecoder(body).Decode(&plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ApplyConfig 写入 PlanConfig 校验过的配置文件并重载，doc 必须与校验时相同。
+// 配置或配置文件在校验后有变化时返回 StatusCode 为 409 的 *APIError，需要重新校验。
+func (c *Client) ApplyConfig(ctx context.Context, doc []byte, planID string) (*ConfigPlan, error) {
+	var plan ConfigPlan
+	params := url.Values{"plan": {planID}}
+	_, err := c.send(ctx, request{method: http.MethodPost, path: "/config/apply", params: params, header: yamlHeader(), body: doc}, func(_ *http.Response, body io.Reader) error {
+		return json.NewDecoder(body).Decode(&plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// Reload 用 doc 替换守护进程的配置文件并重载：先校验，通过后立即应用。
+// 校验不通过时不做修改，返回的错误中列出原因。管理接口不提供从磁盘重新读取配置，那需要 SIGHUP 或 reload 子命令。
+func (c *Client) Reload(ctx context.Context, doc []byte) (*ConfigPlan, error) {
+	plan, err := c.PlanConfig(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Valid {
+		return plan, fmt.Errorf("stream-runner: config is invalid: %s", strings.Join(plan.problems(), "; "))
+	}
+	return c.ApplyConfig(ctx, doc, plan.PlanID)
+}
+
+// problems 返回计划中的全部错误。
+func (p *ConfigPlan) problems() []string {
+	out := append([]string(nil), p.Errors...)
+	for _, s := range p.Streams {
+		if s.Error != "" {
+			out = append(out, s.ID+": "+s.Error)
+		}
+	}
+	return out
+}
+
+// yamlHeader 返回提交 YAML 正文的请求头。
+func yamlHeader() http.Header {
+	return http.Header{"Content-Type": {"application/yaml"}}
+}
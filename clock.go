@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock 是时间来源。重试等待、节目表、看门狗和日志轮转都通过 currentClock 取时间和定时器，
+// 测试中可以替换为手动推进的时钟，不必真的等待。
+type Clock interface {
+	// Now 返回当前时间。
+	Now() time.Time
+	// After 返回在 d 之后收到当前时间的通道。
+	After(d time.Duration) <-chan time.Time
+	// NewTicker 返回每隔 d 触发一次的定时器。
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 是 Clock 创建的周期定时器。
+type Ticker interface {
+	// C 返回接收触发时间的通道。
+	C() <-chan time.Time
+	// Stop 停止定时器，不关闭通道。
+	Stop()
+}
+
+// systemClock 是使用系统时间的 Clock。
+type systemClock struct{}
+
+// Now 实现 Clock 接口。
+func (systemClock) Now() time.Time { return time.Now() }
+
+// After 实现 Clock 接口。
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewTicker 实现 Clock 接口。
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+// systemTicker 包装 time.Ticker。
+type systemTicker struct{ t *time.Ticker }
+
+// C 实现 Ticker 接口。
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+
+// Stop 实现 Ticker 接口。
+func (t systemTicker) Stop() { t.t.Stop() }
+
+// clockBox 包装 Clock，使不同实现可以存入同一个 atomic.Pointer。
+type clockBox struct{ Clock }
+
+// activeClock 是当前使用的时钟，为空时使用系统时钟。
+var activeClock atomic.Pointer[clockBox]
+
+// currentClock 返回当前使用的时钟。
+func currentClock() Clock {
+	if b := activeClock.Load(); b != nil {
+		return b.Clock
+	}
+	return systemClock{}
+}
+
+// setClock 替换当前使用的时钟，返回恢复原时钟的函数。只在启动前或测试中调用。
+func setClock(c Clock) (restore func()) {
+	prev := activeClock.Swap(&clockBox{c})
+	return func() { activeClock.Store(prev) }
+}
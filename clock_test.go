@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 是测试用的手动推进时钟。
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer 是 fakeClock 的定时器，period 为 0 时只触发一次。
+type fakeTimer struct {
+	clock  *fakeClock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// newFakeClock 创建从 now 开始的时钟。
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return c.add(d, d)
+}
+
+func (c *fakeClock) add(d, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// pending 返回尚未触发或停止的定时器数。
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// advance 推进时间并触发到期的定时器；像 time.Ticker 一样，接收方来不及读取的触发被丢弃。
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.timers[:0]
+	for _, t := range c.timers {
+		for !t.at.After(c.now) {
+			select {
+			case t.ch <- t.at:
+			default:
+			}
+			if t.period == 0 {
+				break
+			}
+			t.at = t.at.Add(t.period)
+		}
+		if t.at.After(c.now) {
+			kept = append(kept, t)
+		}
+	}
+	c.timers = kept
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// TestClockBackoff 测试重试等待和周期定时器使用可替换的时钟，推进时间后才返回
+func TestClockBackoff(t *testing.T) {
+	c := newFakeClock(time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+	defer setClock(c)()
+
+	w := &StreamWorker{}
+	done := make(chan bool, 1)
+	go func() { done <- w.backoff(time.Minute) }()
+	waitFor(t, "backoff to wait", func() bool { return c.pending() == 1 })
+	if !w.inBackoff() {
+		t.Error("not in backoff while waiting")
+	}
+	c.advance(59 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("backoff returned early")
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.advance(time.Second)
+	if ok := <-done; !ok {
+		t.Error("backoff interrupted")
+	}
+	if w.inBackoff() {
+		t.Error("still in backoff after the delay")
+	}
+
+	ticker := currentClock().NewTicker(time.Second)
+	c.advance(3 * time.Second)
+	if got := <-ticker.C(); !got.Equal(c.Now().Add(-2 * time.Second)) {
+		t.Errorf("tick at %s", got)
+	}
+	ticker.Stop()
+	if n := c.pending(); n != 0 {
+		t.Errorf("%d timers pending after Stop", n)
+	}
+}
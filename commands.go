@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command 表示一个 CLI 子命令。
+type command struct {
+	// usage 是子命令的用法说明。
+	usage string
+	// run 执行子命令并返回退出码。
+	run func(args []string) int
+}
+
+// commands 是所有 CLI 子命令，key 为子命令名。
+// 不带子命令或使用 run 子命令时以守护进程模式运行。
+var commands = map[string]command{
+	"run": {
+		usage: "run [--env list]",
+		run:   run,
+	},
+	"status": {
+		usage: "status [--socket path] [--json]",
+		run:   runStatus,
+	},
+	"reload": {
+		usage: "reload [--socket path]",
+		run:   runReload,
+	},
+	"add": {
+		usage: "add --id <stream-id> --src <url> --dst <url> [--socket path]",
+		run:   runAdd,
+	},
+	"remove": {
+		usage: "remove --id <stream-id> [--socket path]",
+		run:   runRemove,
+	},
+	"pause": {
+		usage: "pause --id <stream-id> [--socket path]",
+		run:   runPause,
+	},
+	"resume": {
+		usage: "resume --id <stream-id> [--socket path]",
+		run:   runResume,
+	},
+	"log-level": {
+		usage: "log-level [--set debug|info|warn|error] [--reset] [--socket path]",
+		run:   runLogLevel,
+	},
+	"drain": {
+		usage: "drain [--wait schedule|none] [--timeout 1h] [--status] [--cancel] [--socket path]",
+		run:   runDrain,
+	},
+	"validate": {
+		usage: "validate [--config path] [--env list]",
+		run:   runValidate,
+	},
+	"grafana-dashboard": {
+		usage: "grafana-dashboard [--config path]",
+		run:   runGrafanaDashboard,
+	},
+	"install-service": {
+		usage: "install-service [--init systemd|openrc|launchd] [--user name] [--group name] [--binary path] [--dry-run]",
+		run:   runInstallService,
+	},
+	"uninstall-service": {
+		usage: "uninstall-service [--init systemd|openrc|launchd]",
+		run:   runUninstallService,
+	},
+	"migrate-config": {
+		usage: "migrate-config [--config path] [--output path] [--dry-run]",
+		run:   runMigrateConfig,
+	},
+	"export-config": {
+		usage: "export-config [--output path]",
+		run:   runExportConfig,
+	},
+	"import-config": {
+		usage: "import-config --from nginx-rtmp|srs|restreamer [--host addr] [--names list] [--output path] <file>",
+		run:   runImportConfig,
+	},
+	"openapi": {
+		usage: "openapi [--output path] [--base-path prefix] [--api-base-path prefix]",
+		run:   runOpenAPI,
+	},
+	"self-update": {
+		usage: "self-update [--config path] [--url manifest-url] [--public-key key] [--check] [--restart] [--init systemd|openrc|launchd]",
+		run:   runSelfUpdate,
+	},
+	"purge": {
+		usage: "purge --id <stream-id> [--yes] [--socket path]",
+		run:   runPurge,
+	},
+	// sandbox-exec is used internally to launch sandboxed ffmpeg processes.
+	"sandbox-exec": {
+		run: runSandboxExec,
+	},
+}
+
+// printUsage 输出所有子命令的用法。
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name, cmd := range commands {
+		if cmd.usage != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, T("usage.header"))
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// canonicalStream 把流配置转换为按 YAML 字段名索引的通用映射。
+// 经过一次编码，nil 和空的映射、列表都被省略，锚点、别名和合并键展开后的值与直接写出的值完全一致。
+func canonicalStream(s StreamConfig) (map[string]any, error) {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	// renamed_from only matters when workers are matched up; ffmpeg does not depend on it.
+	delete(m, "renamed_from")
+	return m, nil
+}
+
+// streamConfigDiff 返回两份流配置中取值不同的字段名（YAML 键），按字母排序。
+// 只比较语义：把共享块改写成锚点、或 labels: {} 与不写 labels 之间的差异都不算变更。
+func streamConfigDiff(a, b StreamConfig) []string {
+	ca, errA := canonicalStream(a)
+	cb, errB := canonicalStream(b)
+	if errA != nil || errB != nil {
+		// Fall back to a strict comparison; restarting is the safe choice.
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []string{"*"}
+	}
+	var changed []string
+	for k, v := range ca {
+		if !reflect.DeepEqual(v, cb[k]) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range cb {
+		if _, ok := ca[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// streamRestartDiff 在 streamConfigDiff 的基础上检查流引用的转码配置（transcode_fallback），
+// 该配置在 prev 与 next 之间被修改、新增或删除时记为 transcode_profiles.<名称>。prev 为 nil 时视为没有转码配置。
+func streamRestartDiff(prev, next *Config, a, b StreamConfig) []string {
+	changed := streamConfigDiff(a, b)
+	name := b.TranscodeFallback
+	// A renamed reference already shows up as transcode_fallback.
+	if name == "" || a.TranscodeFallback != name {
+		return changed
+	}
+	var old TranscodeProfile
+	had := false
+	if prev != nil {
+		old, had = prev.TranscodeProfiles[name]
+	}
+	cur, has := next.TranscodeProfiles[name]
+	if had != has || old != cur {
+		changed = append(changed, "transcode_profiles."+name)
+		sort.Strings(changed)
+	}
+	return changed
+}
+
+// globalConfigDiff 返回两份配置中取值不同的全局配置段（YAML 键），按字母排序。
+// streams、canary 和 version 不算全局配置段；与 streamConfigDiff 一样只比较语义。
+func globalConfigDiff(a, b *Config) []string {
+	canonical := func(c *Config) (map[string]any, error) {
+		g := *c
+		g.Streams, g.Canary, g.Version = nil, nil, 0
+		data, err := yaml.Marshal(&g)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]any
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		delete(m, "streams")
+		return m, nil
+	}
+	ca, errA := canonical(a)
+	cb, errB := canonical(b)
+	if errA != nil || errB != nil {
+		return []string{"*"}
+	}
+	var changed []string
+	for k, v := range ca {
+		if !reflect.DeepEqual(v, cb[k]) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range cb {
+		if _, ok := ca[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
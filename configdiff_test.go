@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestStreamConfigDiffAnchors 测试锚点和合并键改写后的配置不被视为变更
+func TestStreamConfigDiffAnchors(t *testing.T) {
+	expanded := `
+streams:
+  - id: a
+    src: rtmp://src/live/a
+    dst: rtmp://dst/live/a
+    probe: true
+    labels: {team: ops}
+    av_sync: {interval: 1m}
+`
+	anchored := `
+x-defaults: &defaults
+  probe: true
+  labels: {team: ops}
+  av_sync: {interval: 1m}
+  metadata: {}
+  dst_candidates: []
+streams:
+  - <<: *defaults
+    id: a
+    src: rtmp://src/live/a
+    dst: rtmp://dst/live/a
+`
+	var before, after Config
+	if err := yaml.Unmarshal([]byte(expanded), &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(anchored), &after); err != nil {
+		t.Fatal(err)
+	}
+	if changed := streamConfigDiff(before.Streams[0], after.Streams[0]); len(changed) != 0 {
+		t.Errorf("changed = %v, want none", changed)
+	}
+
+	after.Streams[0].Dst = "rtmp://other/live/a"
+	after.Streams[0].Labels["team"] = "dev"
+	if changed := streamConfigDiff(before.Streams[0], after.Streams[0]); !reflect.DeepEqual(changed, []string{"dst", "labels"}) {
+		t.Errorf("changed = %v, want [dst labels]", changed)
+	}
+}
+
+// TestStreamRestartDiffProfile 测试流引用的转码配置被修改时需要重启，未引用的转码配置不影响
+func TestStreamRestartDiffProfile(t *testing.T) {
+	s := StreamConfig{ID: "a", Src: "rtmp://src/live/a", Dst: "rtmp://dst/live/a", TranscodeFallback: "hd"}
+	other := StreamConfig{ID: "b", Src: "rtmp://src/live/b", Dst: "rtmp://dst/live/b"}
+	prev := &Config{TranscodeProfiles: map[string]TranscodeProfile{"hd": {VideoBitrate: "3000k"}, "sd": {VideoBitrate: "800k"}}}
+	next := &Config{TranscodeProfiles: map[string]TranscodeProfile{"hd": {VideoBitrate: "4000k"}}}
+
+	if changed := streamRestartDiff(prev, next, s, s); !reflect.DeepEqual(changed, []string{"transcode_profiles.hd"}) {
+		t.Errorf("changed = %v, want [transcode_profiles.hd]", changed)
+	}
+	if changed := streamRestartDiff(prev, next, other, other); len(changed) != 0 {
+		t.Errorf("unrelated stream changed = %v, want none", changed)
+	}
+	if changed := streamRestartDiff(next, next, s, s); len(changed) != 0 {
+		t.Errorf("unchanged profile changed = %v, want none", changed)
+	}
+	if changed := streamRestartDiff(prev, &Config{}, s, s); !reflect.DeepEqual(changed, []string{"transcode_profiles.hd"}) {
+		t.Errorf("removed profile changed = %v, want [transcode_profiles.hd]", changed)
+	}
+	if changed := streamRestartDiff(nil, next, s, s); !reflect.DeepEqual(changed, []string{"transcode_profiles.hd"}) {
+		t.Errorf("first config changed = %v, want [transcode_profiles.hd]", changed)
+	}
+
+	sd := s
+	sd.TranscodeFallback = "sd"
+	if changed := streamRestartDiff(prev, prev, s, sd); !reflect.DeepEqual(changed, []string{"transcode_fallback"}) {
+		t.Errorf("switched profile changed = %v, want [transcode_fallback]", changed)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 导入计划中每路流的动作。
+const (
+	ImportActionAdd       = "add"
+	ImportActionUpdate    = "update"
+	ImportActionRename    = "rename"
+	ImportActionUnchanged = "unchanged"
+	ImportActionRemove    = "remove"
+)
+
+// importStream 是导入计划中一路流的校验结果和变更。
+type importStream struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	// PreviousID 是改名前的流 ID，只在 rename 时出现。
+	PreviousID string `json:"previous_id,omitempty"`
+	// Changed 是会导致 ffmpeg 重启的字段（YAML 键）。
+	Changed []string `json:"changed,omitempty"`
+	// Error 是该流的校验错误。
+	Error string `json:"error,omitempty"`
+}
+
+// importPlan 是 POST /config/plan 的响应：逐流的校验和变更报告。
+type importPlan struct {
+	// Valid 表示整份配置可以应用。
+	Valid bool `json:"valid"`
+	// PlanID 标识被校验的配置和当时的配置文件，应用时必须原样提交。
+	PlanID string `json:"plan_id"`
+	// Errors 是不属于单路流的错误，如 YAML 语法错误或全局配置错误。
+	Errors  []string       `json:"errors,omitempty"`
+	Streams []importStream `json:"streams"`
+	// Summary 是各动作的流数，校验失败的流计入 invalid。
+	Summary map[string]int `json:"summary"`
+}
+
+// importMu 串行化配置导入，保证计划校验和写入之间配置文件不被另一个导入修改。
+var importMu sync.Mutex
+
+// planID 根据导入的配置和当前配置文件的内容计算计划 ID。
+func planID(doc, current []byte) string {
+	h := sha256.New()
+	h.Write(doc)
+	h.Write([]byte{0})
+	h.Write(current)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseImport 像加载配置文件一样解析导入的配置：合并所选环境的叠加文件并填充默认值。
+func parseImport(doc []byte) (*Config, error) {
+	data := doc
+	if len(configEnvs) > 0 {
+		var err error
+		if data, err = applyOverlays(paths.Config, doc, configEnvs); err != nil {
+			return nil, err
+		}
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, annotateYAMLError(data, err)
+	}
+	cfg.applyDefaults()
+	return &cfg, nil
+}
+
+// planImport 校验导入的配置并与当前生效的配置比较。
+// 每路流单独校验，一路流出错不影响其他流的报告；只有全部通过时计划才有效。
+func planImport(current *Config, doc, currentFile []byte) importPlan {
+	plan := importPlan{
+		PlanID:  planID(doc, currentFile),
+		Streams: []importStream{},
+		Summary: make(map[string]int),
+	}
+	cfg, err := parseImport(doc)
+	if err != nil {
+		plan.Errors = append(plan.Errors, err.Error())
+		return plan
+	}
+
+	old := make(map[string]StreamConfig)
+	if current != nil {
+		for _, s := range current.Streams {
+			old[s.ID] = s
+		}
+	}
+	wanted := make(map[string]bool, len(cfg.Streams))
+	for _, s := range cfg.Streams {
+		wanted[s.ID] = true
+	}
+
+	seen := make(map[string]bool, len(cfg.Streams))
+	kept := make(map[string]bool)
+	valid := cfg.Streams[:0:0]
+	for _, s := range cfg.Streams {
+		r := importStream{ID: s.ID, Action: ImportActionAdd}
+		prev, exists := old[s.ID]
+		if !exists {
+			// Mirrors renameWorkers: a free old ID that is no longer wanted is renamed.
+			for _, id := range s.RenamedFrom {
+				if p, ok := old[id]; ok && !wanted[id] && !kept[id] {
+					r.Action, r.PreviousID, prev, exists = ImportActionRename, id, p, true
+					break
+				}
+			}
+		}
+		if exists {
+			if r.Action != ImportActionRename {
+				r.Action = ImportActionUnchanged
+			}
+			r.Changed = streamRestartDiff(current, cfg, prev, s)
+			if len(r.Changed) > 0 && r.Action == ImportActionUnchanged {
+				r.Action = ImportActionUpdate
+			}
+			kept[prev.ID] = true
+		}
+		switch {
+		case s.ID == "":
+			r.Error = "id is required"
+		case seen[s.ID]:
+			r.Error = "duplicate id"
+		default:
+			if err := validateStream(cfg, s); err != nil {
+				r.Error = err.Error()
+			}
+		}
+		seen[s.ID] = true
+		if r.Error == "" {
+			valid = append(valid, s)
+			plan.Summary[r.Action]++
+		} else {
+			plan.Summary["invalid"]++
+		}
+		plan.Streams = append(plan.Streams, r)
+	}
+
+	var removed []string
+	for id := range old {
+		if !kept[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		plan.Streams = append(plan.Streams, importStream{ID: id, Action: ImportActionRemove})
+		plan.Summary[ImportActionRemove]++
+	}
+
+	// Global settings and cross-stream rules, checked without the streams already reported.
+	rest := *cfg
+	rest.Streams = valid
+	if err := validateConfig(&rest); err != nil {
+		plan.Errors = append(plan.Errors, err.Error())
+	}
+	plan.Valid = len(plan.Errors) == 0 && plan.Summary["invalid"] == 0
+	return plan
+}
+
+// readImport 读取请求正文和当前配置文件，生成导入计划。
+func readImport(state *AppState, r *http.Request) (importPlan, []byte, []byte, error) {
+	doc, err := io.ReadAll(r.Body)
+	if err != nil {
+		return importPlan{}, nil, nil, err
+	}
+	currentFile, err := os.ReadFile(paths.Config)
+	if err != nil && !os.IsNotExist(err) {
+		return importPlan{}, nil, nil, err
+	}
+	state.mu.RLock()
+	current := state.config
+	state.mu.RUnlock()
+	return planImport(current, doc, currentFile), doc, currentFile, nil
+}
+
+// handleConfigPlan 处理 POST /config/plan：校验请求正文中的完整配置并返回逐流报告，不做任何修改。
+func handleConfigPlan(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		plan, _, _, err := readImport(state, r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, plan)
+	}
+}
+
+// handleConfigApply 处理 POST /config/apply?plan=<plan_id>：确认并应用之前校验过的配置。
+// 配置或配置文件在校验后有任何变化时返回 409，需要重新 plan。
+func handleConfigApply(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		want := r.URL.Query().Get("plan")
+		if want == "" {
+			writeAPIError(w, http.StatusBadRequest, "plan is required, run /config/plan first")
+			return
+		}
+
+		importMu.Lock()
+		defer importMu.Unlock()
+		plan, doc, currentFile, err := readImport(state, r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if plan.PlanID != want {
+			writeAPIError(w, http.StatusConflict, "config or config file changed since the plan, run /config/plan again")
+			return
+		}
+		if !plan.Valid {
+			writeAPIJSON(w, http.StatusUnprocessableEntity, plan)
+			return
+		}
+		prev := currentConfig(state)
+		if err := installConfig(state, doc, currentFile); err != nil {
+			slog.Error("config import failed", "error", err)
+			if configApplied(err) {
+				auditConfigChange(r, prev, currentConfig(state))
+			}
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		slog.Info("config imported", "plan_id", plan.PlanID, "summary", plan.Summary)
+		auditConfigChange(r, prev, currentConfig(state))
+		writeAPIJSON(w, http.StatusOK, plan)
+	}
+}
+
+// installConfig 备份并原子替换配置文件，然后重载。新配置生效之前重载失败时恢复原文件；
+// 生效之后只是部分工作器失败时保留新文件，与运行中的配置一致。
+func installConfig(state *AppState, doc, currentFile []byte) error {
+	if currentFile != nil {
+		if err := os.WriteFile(paths.Config+".bak", currentFile, 0600); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+	if err := writeFileAtomic(paths.Config, doc); err != nil {
+		return fmt.Errorf("failed to write config: %w", withPermissionHint(err,
+			"after dropping privileges the config directory must be writable by run_as user"))
+	}
+	if err := reloadConfig(state); err != nil {
+		if currentFile != nil && !configApplied(err) {
+			if restoreErr := writeFileAtomic(paths.Config, currentFile); restoreErr != nil {
+				return fmt.Errorf("%w (restoring previous config failed: %v)", err, restoreErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再改名，读取方不会看到写了一半的文件。
+// 已有文件的权限会被保留。
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return writeFileAtomicMode(path, data, mode)
+}
+
+// writeFileAtomicMode 与 writeFileAtomic 相同，但文件权限为 mode。
+func writeFileAtomicMode(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stream-runner-config-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPlanImport 测试导入计划的逐流动作、校验错误和计划 ID
+func TestPlanImport(t *testing.T) {
+	current := &Config{Streams: []StreamConfig{
+		{ID: "keep", Src: "rtmp://a/live/1", Dst: "rtmp://b/live/1"},
+		{ID: "edit", Src: "rtmp://a/live/2", Dst: "rtmp://b/live/2"},
+		{ID: "old-name", Src: "rtmp://a/live/3", Dst: "rtmp://b/live/3"},
+		{ID: "drop", Src: "rtmp://a/live/4", Dst: "rtmp://b/live/4"},
+	}}
+	doc := []byte(`streams:
+  - {id: keep, src: "rtmp://a/live/1", dst: "rtmp://b/live/1"}
+  - {id: edit, src: "rtmp://a/live/2", dst: "rtmp://c/live/2"}
+  - {id: new-name, renamed_from: [old-name], src: "rtmp://a/live/3", dst: "rtmp://b/live/3"}
+  - {id: bad, src: "rtmp://a/live/5", dst: "rtmp://b/live/5", ip_family: ipv5}
+  - {id: keep, src: "rtmp://a/live/6", dst: "rtmp://b/live/6"}
+`)
+	plan := planImport(current, doc, []byte("old"))
+	if plan.Valid {
+		t.Error("plan with invalid streams must not be valid")
+	}
+	want := []struct{ id, action, previous string }{
+		{"keep", ImportActionUnchanged, ""},
+		{"edit", ImportActionUpdate, ""},
+		{"new-name", ImportActionRename, "old-name"},
+		{"bad", ImportActionAdd, ""},
+		{"keep", ImportActionUpdate, ""},
+		{"drop", ImportActionRemove, ""},
+	}
+	if len(plan.Streams) != len(want) {
+		t.Fatalf("unexpected streams %+v", plan.Streams)
+	}
+	for i, w := range want {
+		got := plan.Streams[i]
+		if got.ID != w.id || got.Action != w.action || got.PreviousID != w.previous {
+			t.Errorf("stream %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if plan.Streams[3].Error == "" || plan.Streams[4].Error != "duplicate id" {
+		t.Errorf("expected validation errors, got %+v", plan.Streams)
+	}
+	if plan.Summary["invalid"] != 2 || plan.Summary[ImportActionRemove] != 1 {
+		t.Errorf("unexpected summary %v", plan.Summary)
+	}
+	if other := planImport(current, doc, []byte("changed")); other.PlanID == plan.PlanID {
+		t.Error("plan id must change when the config file changes")
+	}
+
+	if broken := planImport(current, []byte("streams: {"), nil); broken.Valid || len(broken.Errors) == 0 {
+		t.Errorf("expected a parse error, got %+v", broken)
+	}
+}
+
+// TestWriteFileAtomic 测试原子写入保留原文件权限
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "streams.yml")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" || info.Mode().Perm() != 0600 {
+		t.Errorf("got %q with mode %v", data, info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
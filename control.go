@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// controlTimeout 是控制命令等待守护进程响应的时长，重载可能需要依次停止多路 ffmpeg，因此较长。
+const controlTimeout = 2 * time.Minute
+
+// newControlMux 创建本地控制套接字的路由：与管理接口相同的流管理和状态查询，外加 POST /reload。
+// 控制套接字只有守护进程的运行用户可以连接，不需要令牌。
+func newControlMux(state *AppState) *http.ServeMux {
+	mux := newAPIMux(state)
+	mux.HandleFunc("/reload", handleControlReload(state))
+	return mux
+}
+
+// handleControlReload 处理 POST /reload：重新读取配置文件并应用，效果与 SIGHUP 相同，但把结果返回给调用方。
+func handleControlReload(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		slog.Info("reload requested over control socket")
+		prev := currentConfig(state)
+		if err := reloadConfig(state); err != nil {
+			slog.Error("config reload failed", "error", err)
+			if configApplied(err) {
+				auditConfigChange(r, prev, currentConfig(state))
+			}
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		slog.Info("config reloaded successfully")
+		auditConfigChange(r, prev, currentConfig(state))
+		state.mu.RLock()
+		n := len(state.config.Streams)
+		state.mu.RUnlock()
+		writeAPIJSON(w, http.StatusOK, map[string]int{"streams": n})
+	}
+}
+
+// listenControl 在 path 上创建控制套接字，权限为 0600。
+// 残留的套接字文件（上次异常退出留下的）会被删除；若仍有守护进程在监听则返回错误。
+func listenControl(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use, is another daemon running?", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveControl 在控制套接字上运行控制接口，直到监听器关闭。
+func serveControl(state *AppState, ln net.Listener) {
+	srv := &http.Server{Handler: withPanicReport("control handler", withControlAudit(newControlMux(state))), ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("control socket server stopped", "error", err)
+	}
+}
+
+// controlClient 通过控制套接字与运行中的守护进程通信。
+type controlClient struct {
+	socket string
+	http   *http.Client
+}
+
+// newControlClient 创建连接到 socket 的客户端。
+func newControlClient(socket string) *controlClient {
+	return &controlClient{
+		socket: socket,
+		http: &http.Client{
+			Timeout: controlTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// do 发送请求，2xx 响应的正文解码到 out（可为空），其他响应返回其中的错误描述。
+func (c *controlClient) do(method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	// The host is ignored: every request goes to the socket.
+	req, err := http.NewRequest(method, "http://stream-runner"+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(auditOperatorHeader, localOperator())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s (%w)", T("control.unreachable", c.socket), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// controlFlags 创建控制命令的参数集，所有控制命令都支持 --socket。
+func controlFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return fs, fs.String("socket", paths.Control, T("flag.control.socket"))
+}
+
+// controlFail 输出控制命令的错误，返回退出码 1。
+func controlFail(err error) int {
+	fmt.Fprint(os.Stderr, T("control.error", err))
+	return 1
+}
+
+// runStatus 实现 status 子命令：输出运行中守护进程各路流的状态，指定 --id 时输出单路流的详细状态和最近的 ffmpeg 输出。
+func runStatus(args []string) int {
+	fs, socket := controlFlags("status")
+	asJSON := fs.Bool("json", false, T("flag.control.json"))
+	id := fs.String("id", "", T("flag.control.id"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var page statusPage
+	var one streamStatus
+	var out any = &page
+	path := "/status?limit=" + fmt.Sprint(maxStatusLimit)
+	if *id != "" {
+		out, path = &one, "/status/"+url.PathEscape(*id)
+	}
+	if err := newControlClient(*socket).do(http.MethodGet, path, nil, out); err != nil {
+		return controlFail(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return controlFail(err)
+		}
+		return 0
+	}
+	if *id != "" {
+		printStreamStatus(os.Stdout, one)
+		return 0
+	}
+	printStatusTable(os.Stdout, page.Streams)
+	if page.Total > len(page.Streams) {
+		fmt.Print(T("control.showing", len(page.Streams), page.Total))
+	}
+	return 0
+}
+
+// printStreamStatus 输出单路流的详细状态和最近的 ffmpeg 输出。
+func printStreamStatus(w io.Writer, s streamStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", s.ID)
+	fmt.Fprintf(tw, "State:\t%s\n", s.State)
+	if s.PID != 0 {
+		fmt.Fprintf(tw, "PID:\t%d\n", s.PID)
+	}
+	if s.StartedAt != nil {
+		fmt.Fprintf(tw, "Started:\t%s\n", s.StartedAt.Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "Uptime:\t%s\n", time.Duration(s.UptimeSeconds)*time.Second)
+	fmt.Fprintf(tw, "Restarts:\t%d\n", s.Restarts)
+	fmt.Fprintf(tw, "Failures:\t%d\n", s.Failures)
+	fmt.Fprintf(tw, "Health:\t%.0f\n", s.Health)
+	if s.LastError != nil {
+		fmt.Fprintf(tw, "Last error:\t%s: %s (%s)\n", s.LastError.Category, s.LastError.Message, s.LastError.Time.Local().Format(time.RFC3339))
+	}
+	tw.Flush()
+	if len(s.Logs) > 0 {
+		fmt.Fprintln(w, T("control.recent_output"))
+		for _, line := range s.Logs {
+			fmt.Fprintln(w, "  "+line)
+		}
+	}
+}
+
+// printStatusTable 以表格形式输出流状态。
+func printStatusTable(w io.Writer, streams []streamStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tUPTIME\tRESTARTS\tHEALTH\tLAST ERROR")
+	for _, s := range streams {
+		lastErr := "-"
+		if s.LastError != nil {
+			lastErr = s.LastError.Category + ": " + s.LastError.Message
+		}
+		uptime := (time.Duration(s.UptimeSeconds) * time.Second).String()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.0f\t%s\n", s.ID, s.State, uptime, s.Restarts, s.Health, lastErr)
+	}
+	tw.Flush()
+}
+
+// runDrain 实现 drain 子命令：让守护进程开始排空、查看进度或取消排空。
+func runDrain(args []string) int {
+	fs, socket := controlFlags("drain")
+	wait := fs.String("wait", DrainWaitSchedule, T("flag.drain.wait"))
+	timeout := fs.Duration("timeout", defaultDrainTimeout, T("flag.drain.timeout"))
+	statusOnly := fs.Bool("status", false, T("flag.drain.status"))
+	cancel := fs.Bool("cancel", false, T("flag.drain.cancel"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	c := newControlClient(*socket)
+	var st drainStatus
+	var err error
+	switch {
+	case *cancel:
+		err = c.do(http.MethodDelete, "/drain", nil, &st)
+	case *statusOnly:
+		err = c.do(http.MethodGet, "/drain", nil, &st)
+	default:
+		err = c.do(http.MethodPost, "/drain", map[string]string{"wait": *wait, "timeout": timeout.String()}, &st)
+	}
+	if err != nil {
+		return controlFail(err)
+	}
+	printDrainStatus(os.Stdout, st)
+	return 0
+}
+
+// printDrainStatus 输出排空进度。
+func printDrainStatus(w io.Writer, st drainStatus) {
+	if !st.Draining {
+		fmt.Fprintln(w, T("control.not_draining"))
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Wait:\t%s\n", st.Wait)
+	fmt.Fprintf(tw, "Started:\t%s\n", st.Started.Local().Format(time.RFC3339))
+	fmt.Fprintf(tw, "Deadline:\t%s\n", st.Deadline.Local().Format(time.RFC3339))
+	if st.Completed != nil {
+		fmt.Fprintf(tw, "Completed:\t%s\n", st.Completed.Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "Remaining:\t%d %s\n", len(st.Remaining), strings.Join(st.Remaining, ", "))
+	fmt.Fprintf(tw, "Drained:\t%d\n", len(st.Drained))
+	tw.Flush()
+}
+
+// runReload 实现 reload 子命令：让守护进程重新加载配置文件，并等待结果。
+func runReload(args []string) int {
+	fs, socket := controlFlags("reload")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var res struct {
+		Streams int `json:"streams"`
+	}
+	if err := newControlClient(*socket).do(http.MethodPost, "/reload", nil, &res); err != nil {
+		return controlFail(err)
+	}
+	fmt.Print(T("control.reloaded", res.Streams))
+	return 0
+}
+
+// runAdd 实现 add 子命令：向运行中的守护进程新增一路流，开启 api.persist_streams 时写回配置文件。
+func runAdd(args []string) int {
+	fs, socket := controlFlags("add")
+	id := fs.String("id", "", T("flag.control.id"))
+	src := fs.String("src", "", T("flag.control.src"))
+	dst := fs.String("dst", "", T("flag.control.dst"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *id == "" || *src == "" || *dst == "" {
+		fmt.Fprintln(os.Stderr, T("control.add_required"))
+		return 2
+	}
+	s := map[string]string{"id": *id, "src": *src, "dst": *dst}
+	if err := newControlClient(*socket).do(http.MethodPost, "/streams", s, nil); err != nil {
+		return controlFail(err)
+	}
+	fmt.Print(T("control.added", *id))
+	return 0
+}
+
+// runRemove 实现 remove 子命令：从运行中的守护进程删除一路流，开启 api.persist_streams 时写回配置文件。
+func runRemove(args []string) int {
+	fs, socket := controlFlags("remove")
+	id := fs.String("id", "", T("flag.control.id"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *id == "" {
+		fmt.Fprintln(os.Stderr, T("control.id_required"))
+		return 2
+	}
+	if err := newControlClient(*socket).do(http.MethodDelete, "/streams/"+url.PathEscape(*id), nil, nil); err != nil {
+		return controlFail(err)
+	}
+	fmt.Print(T("control.removed", *id))
+	return 0
+}
+
+// runPause 实现 pause 子命令：暂停运行中的一路流，配置保留在内存中，重载后仍保持暂停。
+func runPause(args []string) int {
+	return runStreamAction("pause", StreamActionPause, "control.paused", args)
+}
+
+// runResume 实现 resume 子命令：恢复已暂停或已停止的流。
+func runResume(args []string) int {
+	return runStreamAction("resume", StreamActionResume, "control.resumed", args)
+}
+
+// runStreamAction 通过控制套接字对一路流执行 POST /streams/{id}/{action}，成功后输出 done 对应的文案。
+func runStreamAction(name, action, done string, args []string) int {
+	fs, socket := controlFlags(name)
+	id := fs.String("id", "", T("flag.control.id"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *id == "" {
+		fmt.Fprintln(os.Stderr, T("control.id_required"))
+		return 2
+	}
+	var res streamControlResponse
+	if err := newControlClient(*socket).do(http.MethodPost, "/streams/"+url.PathEscape(*id)+"/"+action, nil, &res); err != nil {
+		return controlFail(err)
+	}
+	fmt.Print(T(done, *id, res.State))
+	return 0
+}
+
+// runValidate 实现 validate 子命令：检查配置文件，不需要守护进程在运行。
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	config := fs.String("config", paths.Config, T("flag.config"))
+	env := fs.String("env", strings.Join(configEnvs, ","), T("flag.env"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	envs, err := parseEnvList(*env)
+	if err != nil {
+		fmt.Fprint(os.Stderr, T("control.error", err))
+		return 2
+	}
+	configEnvs = envs
+	cfg, err := readConfig(*config)
+	if err != nil {
+		fmt.Fprint(os.Stderr, T("control.error", fmt.Sprintf("%s: %v", *config, err)))
+		return 1
+	}
+	fmt.Print(T("control.validate_ok", *config, len(cfg.Streams)))
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestControlSocket 测试控制套接字：客户端能查询状态、收到服务端的错误描述，且套接字被占用时拒绝再次监听。
+func TestControlSocket(t *testing.T) {
+	news := StreamConfig{ID: "news", Src: "rtmp://a.example.com/live/news", Dst: "rtmp://b.example.com/live/news"}
+	state := &AppState{
+		config:    &Config{Streams: []StreamConfig{news}},
+		workers:   newWorkerMap(map[string]*StreamWorker{"news": {cfg: news}, "event": {cfg: StreamConfig{ID: "event"}}}),
+		temporary: map[string]temporaryStream{"event": {cfg: StreamConfig{ID: "event"}}},
+	}
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	ln, err := listenControl(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveControl(state, ln)
+
+	c := newControlClient(socket)
+	var page statusPage
+	if err := c.do(http.MethodGet, "/status", nil, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Streams[1].ID != "news" {
+		t.Errorf("status = %+v", page)
+	}
+
+	// Temporary streams cannot be removed through /streams; the API error text reaches the client.
+	err = c.do(http.MethodDelete, "/streams/event", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "temporary") {
+		t.Errorf("remove temporary stream: %v", err)
+	}
+	if err := c.do(http.MethodGet, "/reload", nil, nil); err == nil {
+		t.Error("GET /reload succeeded")
+	}
+
+	if _, err := listenControl(socket); err == nil {
+		t.Error("listened on a socket that is in use")
+	}
+	if err := newControlClient(filepath.Join(t.TempDir(), "missing.sock")).do(http.MethodGet, "/status", nil, nil); err == nil {
+		t.Error("reached a daemon that is not running")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles 是内嵌的仪表盘静态文件。
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler 返回 /ui/ 下的仪表盘静态文件。页面通过单点登录会话或用户输入的管理接口令牌
+// 调用 /status、/streams/{id}/tail 和流控制接口，令牌只保存在浏览器的 sessionStorage 中。
+func dashboardHandler() http.Handler {
+	// The embedded directory always exists, so Sub cannot fail.
+	sub, _ := fs.Sub(dashboardFiles, "dashboard")
+	files := http.StripPrefix("/ui/", http.FileServer(http.FS(sub)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,228 @@
+// Dashboard for the stream-runner management API. All data is rendered with
+// textContent so stream IDs and ffmpeg output cannot inject markup.
+"use strict";
+
+const statusInterval = 3000;
+const tailInterval = 2000;
+let token = sessionStorage.getItem("stream-runner-token") || "";
+// Set when signed in through single sign-on; the session itself is an HttpOnly cookie.
+let csrf = "";
+let role = "";
+let selected = "";
+let statusTimer = 0;
+let tailTimer = 0;
+
+const $ = (id) => document.getElementById(id);
+// The dashboard is served at <base>/ui/, where <base> is api.base_path behind a reverse proxy.
+const apiBase = new URL("..", location.href).pathname.replace(/\/$/, "");
+
+async function api(method, path) {
+  const headers = {};
+  if (token) {
+    headers.Authorization = "Bearer " + token;
+  } else if (method !== "GET") {
+    headers["X-CSRF-Token"] = csrf;
+  }
+  const resp = await fetch(apiBase + path, { method, headers });
+  if (resp.status === 401) {
+    logout();
+    throw new Error(token ? "令牌无效" : "登录已失效");
+  }
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+function formatUptime(seconds) {
+  if (!seconds) {
+    return "-";
+  }
+  const s = Math.floor(seconds);
+  const h = Math.floor(s / 3600);
+  const m = Math.floor((s % 3600) / 60);
+  return h > 0 ? `${h}h${m}m` : `${m}m${s % 60}s`;
+}
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function actionButton(id, action, label) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.addEventListener("click", async (ev) => {
+    ev.stopPropagation();
+    if ((action === "stop" || action === "pause") && !confirm(`${label} ${id}？`)) {
+      return;
+    }
+    b.disabled = true;
+    try {
+      await api("POST", `/streams/${encodeURIComponent(id)}/${action}`);
+      $("error").textContent = "";
+    } catch (err) {
+      $("error").textContent = `${id}: ${err.message}`;
+    }
+    refreshStatus();
+  });
+  return b;
+}
+
+function renderStatus(page) {
+  const filter = $("filter").value.trim().toLowerCase();
+  const rows = $("streams");
+  rows.replaceChildren();
+  const counts = {};
+  for (const s of page.streams) {
+    counts[s.state] = (counts[s.state] || 0) + 1;
+    if (filter && !s.id.toLowerCase().includes(filter)) {
+      continue;
+    }
+    const tr = document.createElement("tr");
+    if (s.id === selected) {
+      tr.className = "selected";
+    }
+    tr.append(
+      cell(s.id),
+      cell(s.state, "state " + s.state),
+      cell(formatUptime(s.uptime_seconds)),
+      cell(String(s.restarts)),
+      cell(String(s.failures)),
+      cell(String(Math.round(s.health))),
+      cell(s.last_error ? `${s.last_error.category}: ${s.last_error.message}` : "", "error-cell"),
+    );
+    const actions = document.createElement("td");
+    // Users who may only view status get no control buttons.
+    if (role !== "read-only") {
+      actions.append(actionButton(s.id, "restart", "重启"));
+      if (s.state === "paused") {
+        actions.append(actionButton(s.id, "resume", "恢复"));
+      } else if (s.state === "stopped") {
+        actions.append(actionButton(s.id, "start", "启动"));
+      } else {
+        actions.append(actionButton(s.id, "stop", "停止"), actionButton(s.id, "pause", "暂停"));
+      }
+    }
+    tr.append(actions);
+    tr.addEventListener("click", () => selectStream(s.id));
+    rows.append(tr);
+  }
+  $("summary").textContent = Object.keys(counts).sort().map((k) => `${k} ${counts[k]}`).join(" · ");
+}
+
+async function refreshStatus() {
+  try {
+    renderStatus(await api("GET", "/status?limit=1000"));
+    $("error").textContent = "";
+  } catch (err) {
+    $("error").textContent = err.message;
+  }
+}
+
+async function refreshTail() {
+  if (!selected) {
+    return;
+  }
+  const id = selected;
+  try {
+    const body = await api("GET", `/streams/${encodeURIComponent(id)}/tail?lines=200`);
+    if (id !== selected) {
+      return;
+    }
+    const pre = $("tail-lines");
+    const atBottom = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 4;
+    pre.textContent = body.lines.join("\n");
+    if (atBottom) {
+      pre.scrollTop = pre.scrollHeight;
+    }
+  } catch (err) {
+    $("tail-lines").textContent = err.message;
+  }
+}
+
+function selectStream(id) {
+  selected = id;
+  $("tail-id").textContent = id;
+  $("tail-lines").textContent = "";
+  $("tail").hidden = !id;
+  clearInterval(tailTimer);
+  if (id) {
+    refreshTail();
+    tailTimer = setInterval(refreshTail, tailInterval);
+  }
+  refreshStatus();
+}
+
+function start() {
+  $("login").hidden = true;
+  $("main").hidden = false;
+  refreshStatus();
+  statusTimer = setInterval(refreshStatus, statusInterval);
+}
+
+// checkSession shows the dashboard when a single sign-on session exists, otherwise the login form,
+// with the single sign-on link when the server has it configured.
+async function checkSession() {
+  try {
+    const resp = await fetch(apiBase + "/auth/session");
+    if (resp.ok) {
+      const s = await resp.json();
+      csrf = s.csrf_token;
+      role = s.role;
+      $("user").textContent = `${s.user}（${s.role}）`;
+      start();
+      return;
+    }
+    $("sso").hidden = resp.status !== 401;
+  } catch (err) {
+    $("login-error").textContent = err.message;
+  }
+  $("login").hidden = false;
+}
+
+function logout() {
+  if (csrf) {
+    fetch(apiBase + "/auth/logout", { method: "POST", headers: { "X-CSRF-Token": csrf } });
+    $("sso").hidden = false;
+  }
+  token = "";
+  csrf = "";
+  role = "";
+  $("user").textContent = "";
+  sessionStorage.removeItem("stream-runner-token");
+  clearInterval(statusTimer);
+  selectStream("");
+  $("main").hidden = true;
+  $("login").hidden = false;
+}
+
+$("login").addEventListener("submit", async (ev) => {
+  ev.preventDefault();
+  token = $("token").value;
+  try {
+    await api("GET", "/status?limit=1");
+  } catch (err) {
+    $("login-error").textContent = err.message;
+    return;
+  }
+  sessionStorage.setItem("stream-runner-token", token);
+  $("token").value = "";
+  $("login-error").textContent = "";
+  start();
+});
+$("logout").addEventListener("click", logout);
+$("filter").addEventListener("input", refreshStatus);
+$("tail-close").addEventListener("click", () => selectStream(""));
+
+if (token) {
+  start();
+} else {
+  checkSession();
+}
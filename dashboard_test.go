@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDashboard 测试仪表盘静态文件不需要令牌，数据接口仍需要认证
+func TestDashboard(t *testing.T) {
+	state := &AppState{
+		config:  &Config{API: &APIConfig{Listen: "127.0.0.1:0", Token: "0123456789abcdef"}},
+		workers: newWorkerMap(nil),
+	}
+	h := newAPIHandler(state, "")
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	for _, p := range []string{"/ui/", "/ui/app.js", "/ui/style.css"} {
+		rec := get(p)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("%s: %d %v", p, rec.Code, rec.Header())
+		}
+	}
+	if rec := get("/ui/"); !strings.Contains(rec.Body.String(), "app.js") {
+		t.Errorf("index does not load app.js: %s", rec.Body)
+	}
+	if rec := get("/ui/missing.js"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing asset: %d", rec.Code)
+	}
+	if rec := get("/status"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("/status without token: %d", rec.Code)
+	}
+}
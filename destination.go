@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RegionPlaceholder 是目标地址模板中代表区域的占位符。
+	RegionPlaceholder = "{region}"
+	// RegionAuto 表示通过测量候选区域的连接延迟选择区域。
+	RegionAuto = "auto"
+	// connectProbeTimeout 是单个候选地址连接测量的超时时间。
+	connectProbeTimeout = 3 * time.Second
+)
+
+// defaultPorts 是测量连接延迟时各协议的默认端口。
+var defaultPorts = map[string]string{
+	"rtmp":  "1935",
+	"rtmpt": "80",
+	"rtmps": "443",
+	"rtmpe": "1935",
+	"http":  "80",
+	"https": "443",
+}
+
+// isDstTemplate 判断目标地址是否为区域模板。
+func isDstTemplate(dst string) bool {
+	return strings.Contains(dst, RegionPlaceholder)
+}
+
+// expandDst 将目标地址模板中的区域占位符替换为指定区域。
+func expandDst(dst, region string) string {
+	return strings.ReplaceAll(dst, RegionPlaceholder, region)
+}
+
+// validateDestination 校验目标地址模板、区域和候选地址配置。
+func validateDestination(s StreamConfig) error {
+	if len(s.DstCandidates) > 0 {
+		if isDstTemplate(s.Dst) {
+			return fmt.Errorf("dst_candidates cannot be combined with %s templates", RegionPlaceholder)
+		}
+		format := outputFormat(s)
+		for _, c := range s.DstCandidates {
+			if _, err := dstHostPort(c); err != nil {
+				return fmt.Errorf("dst_candidates: %w", err)
+			}
+			alt := s
+			alt.Dst = c
+			if outputFormat(alt) != format {
+				return fmt.Errorf("dst_candidates: %s does not use the same output format as dst", endpointHost(c))
+			}
+		}
+	}
+	if !isDstTemplate(s.Dst) {
+		return nil
+	}
+	switch {
+	case s.Region == "":
+		return fmt.Errorf("dst contains %s but no region is configured", RegionPlaceholder)
+	case s.Region == RegionAuto && len(s.Regions) == 0:
+		return fmt.Errorf("region auto requires a regions list")
+	case s.Region != RegionAuto && len(s.Regions) > 0 && !containsString(s.Regions, s.Region):
+		return fmt.Errorf("region %s is not in regions list", s.Region)
+	}
+	return nil
+}
+
+// dstHostPort 返回目标地址用于测量连接延迟的 host:port。
+func dstHostPort(dst string) (string, error) {
+	u, err := url.Parse(dst)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("no host in %s", u.Redacted())
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	if port == "" {
+		return "", fmt.Errorf("cannot measure connect latency for scheme %q", u.Scheme)
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// tlsSchemes 是需要在 TCP 之上完成 TLS 握手的协议。
+var tlsSchemes = []string{"rtmps", "https"}
+
+// measureConnectLatency 测量到目标地址的连接耗时，TLS 协议包含握手时间。
+func measureConnectLatency(dst, family string) (time.Duration, error) {
+	addr, err := dstHostPort(dst)
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(dst)
+	if err != nil {
+		return 0, err
+	}
+	network := "tcp" + strings.TrimPrefix(ipNetwork(family), "ip")
+	dialer := &net.Dialer{Timeout: connectProbeTimeout}
+	start := time.Now()
+	var conn net.Conn
+	if containsString(tlsSchemes, strings.ToLower(u.Scheme)) {
+		conn, err = tls.DialWithDialer(dialer, network, addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial(network, addr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if err := conn.Close(); err != nil {
+		slog.Warn("failed to close probe connection", "addr", addr, "error", err)
+	}
+	return elapsed, nil
+}
+
+// selectFastest 并发测量所有候选地址的连接延迟，返回最快的地址。
+func selectFastest(cfg StreamConfig, candidates []string) (string, time.Duration, error) {
+	type result struct {
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(candidates))
+	var wg sync.WaitGroup
+	for i, dst := range candidates {
+		wg.Add(1)
+		go func(i int, dst string) {
+			defer wg.Done()
+			latency, err := measureConnectLatency(dst, cfg.IPFamily)
+			results[i] = result{latency: latency, err: err}
+		}(i, dst)
+	}
+	wg.Wait()
+
+	best := -1
+	for i, r := range results {
+		if r.err != nil {
+			slog.Warn("ingest probe failed", "stream_id", cfg.ID, "host", endpointHost(candidates[i]), "error", r.err)
+			continue
+		}
+		if best < 0 || r.latency < results[best].latency {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", 0, fmt.Errorf("none of %d ingest candidates is reachable", len(candidates))
+	}
+	return candidates[best], results[best].latency, nil
+}
+
+// selectDestination 返回流本次启动实际推送的目标地址，每次（重新）启动前调用。
+// 普通地址原样返回；指定区域时直接展开；区域为 auto 或配置了候选地址时按连接延迟选择。
+func selectDestination(cfg StreamConfig) (string, error) {
+	var candidates []string
+	switch {
+	case len(cfg.DstCandidates) > 0:
+		candidates = append([]string{cfg.Dst}, cfg.DstCandidates...)
+	case isDstTemplate(cfg.Dst) && cfg.Region == RegionAuto:
+		for _, region := range cfg.Regions {
+			candidates = append(candidates, expandDst(cfg.Dst, region))
+		}
+	case isDstTemplate(cfg.Dst):
+		return expandDst(cfg.Dst, cfg.Region), nil
+	default:
+		return cfg.Dst, nil
+	}
+	dst, latency, err := selectFastest(cfg, candidates)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("selected ingest endpoint", "stream_id", cfg.ID, "host", endpointHost(dst), "connect_latency", latency)
+	return dst, nil
+}
+
+// endpointHost 返回目标地址的主机部分，用于状态展示，避免暴露路径中的推流密钥。
+func endpointHost(dst string) string {
+	u, err := url.Parse(dst)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// TestSelectDestination 测试目标地址模板展开和按延迟选择区域
+func TestSelectDestination(t *testing.T) {
+	cfg := StreamConfig{ID: "s", Dst: "rtmp://{region}.ingest.example.com/live/key", Region: "eu-west"}
+	if err := validateDestination(cfg); err != nil {
+		t.Fatalf("validateDestination failed: %v", err)
+	}
+	dst, err := selectDestination(cfg)
+	if err != nil || dst != "rtmp://eu-west.ingest.example.com/live/key" {
+		t.Errorf("selectDestination() = %q %v", dst, err)
+	}
+	if err := validateDestination(StreamConfig{Dst: cfg.Dst, Region: RegionAuto}); err == nil {
+		t.Error("expected auto region without candidates to be rejected")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	reachable := ln.Addr().String()
+	auto := StreamConfig{ID: "s", Dst: "rtmp://{region}/live/key", Region: RegionAuto, Regions: []string{"127.0.0.1:1", reachable}}
+	dst, err = selectDestination(auto)
+	if err != nil || dst != "rtmp://"+reachable+"/live/key" {
+		t.Errorf("expected reachable region to be selected, got %q %v", dst, err)
+	}
+
+	candidates := StreamConfig{ID: "s", Dst: "rtmp://127.0.0.1:1/live/key", DstCandidates: []string{"rtmp://" + reachable + "/live/key"}}
+	if err := validateDestination(candidates); err != nil {
+		t.Fatalf("validateDestination failed: %v", err)
+	}
+	dst, err = selectDestination(candidates)
+	if err != nil || dst != candidates.DstCandidates[0] {
+		t.Errorf("expected reachable candidate to be selected, got %q %v", dst, err)
+	}
+	candidates.DstCandidates = []string{"srt://" + reachable}
+	if err := validateDestination(candidates); err == nil {
+		t.Error("expected candidate with a different output format to be rejected")
+	}
+}
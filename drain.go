@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 排空时停止流的条件。
+const (
+	// DrainWaitNone 表示立即停止所有流。
+	DrainWaitNone = "none"
+	// DrainWaitSchedule 表示等待每路流按计划停播：受节目表控制的流等当前节目结束，临时流等到期；
+	// 没有计划停播时间的流立即停止。
+	DrainWaitSchedule = "schedule"
+)
+
+const (
+	// drainTick 是排空期间检查停止条件的间隔。
+	drainTick = 5 * time.Second
+	// defaultDrainTimeout 是排空未指定 timeout 时的最长等待时间，超时后停止剩余的流。
+	defaultDrainTimeout = time.Hour
+)
+
+var (
+	// errDraining 表示守护进程正在排空，不接受新的流和配置变更。
+	errDraining = errors.New("daemon is draining, cancel the drain before adding streams or changing the config")
+	// errDrainInProgress 表示已经在排空。
+	errDrainInProgress = errors.New("a drain is already in progress")
+)
+
+// drainRequest 是 POST /drain 的请求正文。
+type drainRequest struct {
+	// Wait 是停止流的条件：none 或 schedule，默认 schedule。
+	Wait string `yaml:"wait,omitempty"`
+	// Timeout 是最长等待时间，如 2h，到期后停止剩余的流，默认 1h。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// drainState 是一次排空的进度。排空不退出守护进程（服务管理器会把退出的守护进程重新拉起），
+// 所有流停止后守护进程保持空闲，等待维护时停止服务或取消排空。
+type drainState struct {
+	wait     string
+	started  time.Time
+	deadline time.Time
+	cancel   chan struct{}
+
+	mu sync.Mutex
+	// drained 是排空停止的流及其停止时间，取消排空时只恢复这些流。
+	drained   map[string]time.Time
+	completed time.Time
+	// cancelled 表示排空已取消，之后才停止完成的流立即重新启动。
+	cancelled bool
+}
+
+// drains 是正在进行的排空，未排空时为 nil。
+var drains atomic.Pointer[drainState]
+
+// draining 判断守护进程是否正在排空。
+func draining() bool {
+	return drains.Load() != nil
+}
+
+// writeDrainMetrics 输出守护进程是否正在排空。
+func writeDrainMetrics(bw *bufio.Writer) {
+	v := 0
+	if draining() {
+		v = 1
+	}
+	fmt.Fprintln(bw, "# HELP stream_runner_draining Whether the daemon is draining and refuses new streams.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_draining gauge")
+	fmt.Fprintf(bw, "stream_runner_draining %d\n", v)
+}
+
+// drainStatus 是 GET /drain 的响应。
+type drainStatus struct {
+	Draining bool       `json:"draining"`
+	Wait     string     `json:"wait,omitempty"`
+	Started  *time.Time `json:"started_at,omitempty"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Completed 是所有流都已停止的时间。
+	Completed *time.Time `json:"completed_at,omitempty"`
+	// Remaining 是仍在运行、等待停止的流。
+	Remaining []string `json:"remaining,omitempty"`
+	// Drained 是排空已停止的流。
+	Drained []string `json:"drained,omitempty"`
+}
+
+// startDrain 开始排空：拒绝新的流和配置变更，按 req 的条件逐步停止所有流。已在排空时返回错误。
+func startDrain(state *AppState, req drainRequest, now time.Time) (*drainState, error) {
+	if req.Wait == "" {
+		req.Wait = DrainWaitSchedule
+	}
+	if req.Wait != DrainWaitNone && req.Wait != DrainWaitSchedule {
+		return nil, fmt.Errorf("wait must be none or schedule")
+	}
+	if req.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+	if req.Timeout == 0 {
+		req.Timeout = defaultDrainTimeout
+	}
+	d := &drainState{
+		wait:     req.Wait,
+		started:  now,
+		deadline: now.Add(req.Timeout),
+		cancel:   make(chan struct{}),
+		drained:  make(map[string]time.Time),
+	}
+	// Held so that no reload is half-applied when the drain starts.
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	if !drains.CompareAndSwap(nil, d) {
+		return nil, errDrainInProgress
+	}
+	n := len(d.remaining(state))
+	slog.Info("draining streams", "streams", n, "wait", d.wait, "deadline", d.deadline)
+	emitEvent("", "drain_started", n, d.wait, d.deadline.Format(time.RFC3339))
+	return d, nil
+}
+
+// run 定期检查停止条件，直到所有流停止或排空被取消。
+func (d *drainState) run(state *AppState) {
+	ticker := currentClock().NewTicker(drainTick)
+	defer ticker.Stop()
+	for !d.step(state, currentClock().Now()) {
+		select {
+		case <-d.cancel:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// remaining 返回尚未停止的流，按 ID 排序。
+func (d *drainState) remaining(state *AppState) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ids []string
+	for id, w := range state.workers.snapshot() {
+		if _, ok := d.drained[id]; !ok && !w.isStopped() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// shouldStop 判断流在 now 时是否满足停止条件。
+func (d *drainState) shouldStop(state *AppState, id string, now time.Time) bool {
+	if d.wait == DrainWaitNone || !now.Before(d.deadline) {
+		return true
+	}
+	if m := epg.Load(); m != nil {
+		if live, scheduled := m.wantLive(id, now); scheduled {
+			return !live
+		}
+	}
+	// Temporary streams end at their expiry, when the reaper removes them.
+	return temporaryExpiry(state, id) == nil
+}
+
+// step 停止所有满足条件的流，全部停止后记录完成并返回 true。
+func (d *drainState) step(state *AppState, now time.Time) bool {
+	var stop []string
+	for _, id := range d.remaining(state) {
+		if d.shouldStop(state, id, now) {
+			stop = append(stop, id)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, id := range stop {
+		w, ok := state.workers.get(id)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(id string, w *StreamWorker) {
+			defer wg.Done()
+			slog.Info("stopping stream for drain", "stream_id", id)
+			if err := w.shutdown(); err != nil {
+				slog.Error("failed to stop stream for drain", "stream_id", id, "error", err)
+			}
+			d.mu.Lock()
+			cancelled := d.cancelled
+			d.drained[id] = now
+			d.mu.Unlock()
+			if cancelled {
+				if err := w.resume(); err != nil {
+					slog.Error("failed to restart stream after drain was cancelled", "stream_id", id, "error", err)
+				}
+			}
+		}(id, w)
+	}
+	wg.Wait()
+
+	left := len(d.remaining(state))
+	if len(stop) > 0 {
+		emitEvent("", "drain_progress", len(stop), left)
+	}
+	if left > 0 {
+		return false
+	}
+	d.mu.Lock()
+	d.completed = currentClock().Now()
+	d.mu.Unlock()
+	slog.Info("drain completed, all streams stopped", "duration", now.Sub(d.started).Round(time.Second))
+	emitEvent("", "drain_completed", now.Sub(d.started).Round(time.Second))
+	return true
+}
+
+// cancelDrain 取消排空，重新启动排空停止的流，返回恢复的流数。未在排空时返回错误。
+func cancelDrain(state *AppState) (int, error) {
+	d := drains.Load()
+	if d == nil || !drains.CompareAndSwap(d, nil) {
+		return 0, fmt.Errorf("no drain in progress")
+	}
+	close(d.cancel)
+	d.mu.Lock()
+	d.cancelled = true
+	ids := make([]string, 0, len(d.drained))
+	for id := range d.drained {
+		ids = append(ids, id)
+	}
+	d.mu.Unlock()
+	resumed := 0
+	for _, id := range ids {
+		w, ok := state.workers.get(id)
+		if !ok || !w.isStopped() {
+			continue
+		}
+		if err := w.resume(); err != nil {
+			slog.Error("failed to restart stream after drain was cancelled", "stream_id", id, "error", err)
+			continue
+		}
+		resumed++
+	}
+	slog.Info("drain cancelled", "resumed", resumed)
+	emitEvent("", "drain_cancelled", resumed)
+	return resumed, nil
+}
+
+// status 返回排空的进度。
+func (d *drainState) status(state *AppState) drainStatus {
+	started, deadline := d.started, d.deadline
+	s := drainStatus{Draining: true, Wait: d.wait, Started: &started, Deadline: &deadline, Remaining: d.remaining(state)}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.drained {
+		s.Drained = append(s.Drained, id)
+	}
+	sort.Strings(s.Drained)
+	if !d.completed.IsZero() {
+		t := d.completed
+		s.Completed = &t
+	}
+	return s
+}
+
+// handleDrain 处理 GET /drain（进度）、POST /drain（开始排空）和 DELETE /drain（取消排空）。
+func handleDrain(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if d := drains.Load(); d != nil {
+				writeAPIJSON(w, http.StatusOK, d.status(state))
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, drainStatus{})
+		case http.MethodPost:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// JSON is valid YAML, so durations such as "2h" are accepted as strings.
+			var req drainRequest
+			if err := yaml.Unmarshal(body, &req); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			d, err := startDrain(state, req, currentClock().Now())
+			if err != nil {
+				code := http.StatusBadRequest
+				if errors.Is(err, errDrainInProgress) {
+					code = http.StatusConflict
+				}
+				writeAPIError(w, code, err.Error())
+				return
+			}
+			go supervise("drain", func() { d.run(state) })
+			writeAPIJSON(w, http.StatusAccepted, d.status(state))
+		case http.MethodDelete:
+			if _, err := cancelDrain(state); err != nil {
+				writeAPIError(w, http.StatusConflict, err.Error())
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, drainStatus{})
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// rejectWhileDraining 在排空期间拒绝新增流、启动已停止的流、提交任务和修改配置的请求，返回 503。
+func rejectWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining() && drainBlocks(r) {
+			writeAPIError(w, http.StatusServiceUnavailable, errDraining.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// drainBlocks 判断请求在排空期间是否会启动新的 ffmpeg 或修改配置。停止、暂停、取消任务和删除临时流仍然允许。
+func drainBlocks(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/streams/"); ok {
+		if _, action, ok := strings.Cut(rest, "/"); ok {
+			return action == StreamActionStart || action == StreamActionResume || action == StreamActionRestart
+		}
+		// Deleting a configured stream is a config change, which would restart drained streams.
+		return true
+	}
+	// Cancelling jobs and removing temporary streams only stop ffmpeg.
+	return r.Method != http.MethodDelete
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDrain 测试排空时没有计划停播时间的流立即停止，临时流等到期或超时，取消后重新启动排空停止的流。
+func TestDrain(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Swap(&Settings{StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+	defer drains.Store(nil)
+
+	now := time.Now()
+	temp := StreamConfig{ID: "temp", Src: "rtmp://127.0.0.1/live/t", Dst: "rtmp://127.0.0.2/live/t"}
+	news := &StreamWorker{cfg: StreamConfig{ID: "news", Src: "rtmp://127.0.0.1/live/n", Dst: "rtmp://127.0.0.2/live/n"}}
+	tw := &StreamWorker{cfg: temp}
+	state := &AppState{
+		config:    &Config{},
+		workers:   newWorkerMap(map[string]*StreamWorker{"news": news, "temp": tw}),
+		temporary: map[string]temporaryStream{"temp": {cfg: temp, created: now, expires: now.Add(3 * time.Hour)}},
+	}
+	for _, w := range []*StreamWorker{news, tw} {
+		defer w.shutdown()
+		w.Start(context.Background())
+	}
+	waitFor(t, "ffmpeg to start", func() bool { return running() == 2 })
+
+	d, err := startDrain(state, drainRequest{Timeout: 2 * time.Hour}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := startDrain(state, drainRequest{}, now); err != errDrainInProgress {
+		t.Errorf("second drain: %v", err)
+	}
+	if d.step(state, now) {
+		t.Fatal("drain completed while the temporary stream has not expired")
+	}
+	if !news.isStopped() || tw.isStopped() || running() != 1 {
+		t.Fatalf("after first step: news stopped %v, temp stopped %v, %d ffmpeg running", news.isStopped(), tw.isStopped(), running())
+	}
+
+	// New streams and restarts of drained streams are refused while draining.
+	h := newAPIMux(state)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/temporary-streams", strings.NewReader(`{"id": "x", "ttl": "1h"}`)),
+		httptest.NewRequest(http.MethodPost, "/streams/news/start", nil),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: %d", req.Method, req.URL.Path, rec.Code)
+		}
+	}
+	if st := d.status(state); len(st.Remaining) != 1 || st.Remaining[0] != "temp" || len(st.Drained) != 1 {
+		t.Errorf("status = %+v", st)
+	}
+
+	// The timeout stops the rest.
+	if !d.step(state, now.Add(2*time.Hour)) {
+		t.Fatal("drain did not complete at the deadline")
+	}
+	if running() != 0 || d.status(state).Completed == nil {
+		t.Fatalf("%d ffmpeg running after drain", running())
+	}
+
+	if n, err := cancelDrain(state); err != nil || n != 2 {
+		t.Fatalf("cancel: %d, %v", n, err)
+	}
+	waitFor(t, "ffmpeg to restart", func() bool { return running() == 2 })
+	if draining() {
+		t.Error("still draining after cancel")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event 表示流运行过程中值得运维关注的事件。
+type Event struct {
+	// Time 是事件发生时间。
+	Time time.Time
+	// StreamID 是事件所属的流。
+	StreamID string
+	// Type 是事件类型，如 transcode_fallback。
+	Type string
+	// Message 是可读的事件描述。
+	Message string
+	// Labels 是所属流的标签，用于告警路由。
+	Labels map[string]string
+	// Seq 是事件序号，在本节点内单调递增，守护进程重启后继续，用于下游发现丢失和排序。
+	Seq uint64
+	// Node 是发出事件的节点，取 settings.node_id，默认为主机名。
+	Node string
+	// args 是渲染事件描述的参数，用于按告警渠道的语言重新生成 Message。
+	args []any
+}
+
+// localized 返回使用指定语言描述的事件副本。
+func (ev Event) localized(locale string) Event {
+	ev.Message = tr(locale, "event."+ev.Type, ev.args...)
+	return ev
+}
+
+// eventCounts 是按流 ID 累计的事件数（*atomic.Int64），用于指标和仪表盘时间线上的事件标注。
+var eventCounts sync.Map
+
+// eventCount 返回流累计的事件数。
+func eventCount(streamID string) int64 {
+	if v, ok := eventCounts.Load(streamID); ok {
+		return v.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// forgetEvents 清除已删除流的事件计数。
+func forgetEvents(streamID string) {
+	eventCounts.Delete(streamID)
+}
+
+// eventSeqFile 是日志目录中保存最近一个事件序号的文件名。
+const eventSeqFile = "events.seq"
+
+// eventSequence 分配事件序号。open 之后每分配一个序号都写回文件，守护进程重启后从上次的序号继续；
+// 未 open 时（测试、子命令）只在内存中递增。
+type eventSequence struct {
+	mu   sync.Mutex
+	last uint64
+	path string
+}
+
+// eventSeq 是全局的事件序号分配器。
+var eventSeq = &eventSequence{}
+
+// open 从 path 读取上次的序号，之后把分配的序号写回 path。文件不存在时从 0 开始。
+func (s *eventSequence) open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		last, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		// Never go back, even if the file was restored from an older backup.
+		s.last = max(s.last, last)
+	}
+	s.path = path
+	return nil
+}
+
+// next 分配下一个序号。写回文件失败只记录日志，内存中的序号仍然递增。
+func (s *eventSequence) next() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	if s.path != "" {
+		if err := writeFileAtomic(s.path, []byte(strconv.FormatUint(s.last, 10)+"\n")); err != nil {
+			slog.Warn("failed to persist event sequence", "path", s.path, "error", err)
+		}
+	}
+	return s.last
+}
+
+// eventNode 返回事件中的节点名：settings.node_id，未配置时为主机名。
+func eventNode() string {
+	if id := currentSettings().NodeID; id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// emitEvent 记录一条流事件，并按告警路由发送通知。
+// 事件描述取自文案目录中的 event.<类型>，日志中使用英文。
+func emitEvent(streamID, eventType string, args ...any) {
+	v, _ := eventCounts.LoadOrStore(streamID, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+	ev := Event{Time: time.Now(), StreamID: streamID, Type: eventType, Seq: eventSeq.next(), Node: eventNode(), args: args}
+	ev.Message = tr(LocaleEN, "event."+eventType, args...)
+	if r := alertRouting.Load(); r != nil {
+		ev.Labels = r.labels[streamID]
+	}
+	slog.Warn("stream event", "stream_id", ev.StreamID, "event", ev.Type, "seq", ev.Seq, "message", ev.Message)
+	dispatchAlerts(ev)
+}
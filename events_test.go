@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEventSequence 测试事件序号写回文件，重新打开后从上次的序号继续
+func TestEventSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), eventSeqFile)
+	var s eventSequence
+	if got := s.next(); got != 1 {
+		t.Errorf("in-memory seq = %d, want 1", got)
+	}
+	if err := s.open(path); err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(2); want <= 3; want++ {
+		if got := s.next(); got != want {
+			t.Errorf("seq = %d, want %d", got, want)
+		}
+	}
+
+	// A restarted daemon continues after the persisted value.
+	var restarted eventSequence
+	if err := restarted.open(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.next(); got != 4 {
+		t.Errorf("seq after restart = %d, want 4", got)
+	}
+
+	if err := os.WriteFile(path, []byte("garbage\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&eventSequence{}).open(path); err == nil {
+		t.Error("expected error for a corrupt sequence file")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ffmpegVersion 是启动时检测到的 ffmpeg 版本行，如 "ffmpeg version 6.1.1 ..."。
+var ffmpegVersion string
+
+// ffmpegVersionPattern 匹配发行版本号，git 构建（如 N-112345-g...）不匹配。
+var ffmpegVersionPattern = regexp.MustCompile(`^ffmpeg version n?(\d+)\.(\d+)`)
+
+// ffmpegAtLeast 判断 ffmpeg 版本是否不低于 major.minor。
+// 无法识别的版本（git 构建等）视为满足要求。
+func ffmpegAtLeast(version string, major, minor int) bool {
+	m := ffmpegVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return true
+	}
+	gotMajor, _ := strconv.Atoi(m[1])
+	gotMinor, _ := strconv.Atoi(m[2])
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// buildFFmpegArgs 根据流配置、解析后的连接参数和输出方式生成 ffmpeg 命令行参数。
+func buildFFmpegArgs(cfg StreamConfig, ep *resolvedEndpoints, plan outputPlan) []string {
+	// Progress goes to stdout as key=value blocks for stats collection.
+	args := []string{"-progress", "pipe:1", "-rw_timeout", "2000000"}
+	whitelist := protocolWhitelist(cfg)
+	if cfg.Synthetic != nil {
+		// Synthetic streams encode a generated test pattern instead of reading a source.
+		args = append(args, cfg.Synthetic.inputArgs()...)
+		args = append(args, cfg.Synthetic.codecArgs()...)
+	} else {
+		// Input protocol options must precede -i.
+		if whitelist != "" {
+			args = append(args, "-protocol_whitelist", whitelist)
+		}
+		if ep.SrcAddr != "" {
+			args = append(args, "-local_addr", ep.SrcAddr)
+		}
+		if ep.SrcTCURL != "" {
+			args = append(args, "-rtmp_tcurl", ep.SrcTCURL)
+		}
+		args = append(args, "-i", ep.Src)
+		args = append(args, plan.codecArgs()...)
+	}
+	if len(cfg.Outputs) > 0 {
+		return append(args, teeArgs(cfg, ep, plan, whitelist)...)
+	}
+	format := plan.Format
+	if format == "" {
+		format = "flv"
+	}
+	args = append(args, "-f", format)
+	args = append(args, metadataArgs(cfg)...)
+	if whitelist != "" {
+		args = append(args, "-protocol_whitelist", whitelist)
+	}
+	if ep.DstAddr != "" {
+		args = append(args, "-local_addr", ep.DstAddr)
+	}
+	if ep.DstTCURL != "" {
+		args = append(args, "-rtmp_tcurl", ep.DstTCURL)
+	}
+	return append(args, ep.Dst)
+}
+
+// metadataArgs 返回输出元数据参数。FLV 输出时这些字段写入 onMetaData。
+func metadataArgs(cfg StreamConfig) []string {
+	var args []string
+	if cfg.StripMetadata {
+		args = append(args, "-map_metadata", "-1")
+	}
+	keys := make([]string, 0, len(cfg.Metadata))
+	for k := range cfg.Metadata {
+		keys = append(keys, k)
+	}
+	// Sorted for stable command lines across restarts.
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-metadata", k+"="+cfg.Metadata[k])
+	}
+	return args
+}
+
+// validateMetadata 校验元数据键名。
+func validateMetadata(metadata map[string]string) error {
+	for k := range metadata {
+		if k == "" || strings.ContainsAny(k, "= \t\n") {
+			return fmt.Errorf("invalid metadata key %q", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBuildFFmpegArgs 测试 ffmpeg 参数生成
+func TestBuildFFmpegArgs(t *testing.T) {
+	cfg := StreamConfig{
+		ID:  "test-stream",
+		Src: "rtmp://source.com/live",
+		Dst: "rtmp://dest.com/live",
+	}
+
+	args := buildFFmpegArgs(cfg, &resolvedEndpoints{Src: cfg.Src, Dst: cfg.Dst}, outputPlan{})
+	if strings.Contains(strings.Join(args, " "), "-local_addr") {
+		t.Errorf("expected no -local_addr without bind, got %v", args)
+	}
+	if args[len(args)-1] != cfg.Dst {
+		t.Errorf("expected destination as last argument, got %v", args)
+	}
+
+	args = buildFFmpegArgs(cfg, &resolvedEndpoints{
+		Src:     cfg.Src,
+		Dst:     cfg.Dst,
+		SrcAddr: "10.0.0.1",
+		DstAddr: "10.0.1.1",
+	}, outputPlan{Format: "mpegts"})
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-local_addr 10.0.0.1 -i rtmp://source.com/live") {
+		t.Errorf("expected src bind before -i, got %v", args)
+	}
+	if !strings.Contains(joined, "-f mpegts") {
+		t.Errorf("expected planned output format, got %v", args)
+	}
+	if !strings.Contains(joined, "-local_addr 10.0.1.1 rtmp://dest.com/live") {
+		t.Errorf("expected dst bind before output, got %v", args)
+	}
+}
+
+// TestFFmpegAtLeast 测试 ffmpeg 版本比较
+func TestFFmpegAtLeast(t *testing.T) {
+	cases := []struct {
+		version string
+		want    bool
+	}{
+		{"ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023", true},
+		{"ffmpeg version n7.0 Copyright (c) 2000-2024", true},
+		{"ffmpeg version 6.0 Copyright (c) 2000-2023", false},
+		{"ffmpeg version 4.4.2-0ubuntu0.22.04.1", false},
+		{"ffmpeg version N-112345-gabcdef Copyright (c) 2000-2023", true},
+	}
+	for _, c := range cases {
+		if got := ffmpegAtLeast(c.version, 6, 1); got != c.want {
+			t.Errorf("ffmpegAtLeast(%q) = %v, want %v", c.version, got, c.want)
+		}
+	}
+}
+
+// TestMetadataArgs 测试输出元数据参数
+func TestMetadataArgs(t *testing.T) {
+	cfg := StreamConfig{
+		Metadata:      map[string]string{"title": "Main Stage", "author": "ops"},
+		StripMetadata: true,
+	}
+	got := strings.Join(metadataArgs(cfg), " ")
+	want := "-map_metadata -1 -metadata author=ops -metadata title=Main Stage"
+	if got != want {
+		t.Errorf("metadataArgs() = %q, want %q", got, want)
+	}
+	if err := validateMetadata(map[string]string{"bad key": "x"}); err == nil {
+		t.Error("expected error for metadata key with space")
+	}
+}
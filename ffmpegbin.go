@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ffmpeg 可执行文件的来源。
+const (
+	// FFmpegSourceSystem 表示使用系统安装的 ffmpeg（PATH 或 ffmpeg.path）。
+	FFmpegSourceSystem = "system"
+	// FFmpegSourceBundled 表示使用内置或下载的静态 ffmpeg。
+	FFmpegSourceBundled = "bundled"
+	// FFmpegSourceAuto 表示优先使用系统 ffmpeg，找不到时使用 bundled。
+	FFmpegSourceAuto = "auto"
+)
+
+// bundleRecordFile 是 ffmpeg 目录中记录已下载版本的文件，重启时据此离线复用，不必再次下载。
+const bundleRecordFile = "bundle.json"
+
+// ffmpegBin 和 ffprobeBin 是启动 ffmpeg、ffprobe 使用的命令，启动时由 resolveFFmpeg 确定，之后不再改变。
+var (
+	ffmpegBin  = "ffmpeg"
+	ffprobeBin = "ffprobe"
+)
+
+// embeddedFFmpeg 是构建时内置的静态 ffmpeg（bundled/ffmpeg，可选 bundled/ffprobe），
+// 只有使用 -tags bundled_ffmpeg 构建时才不为空。
+var embeddedFFmpeg fs.FS
+
+// FFmpegConfig 表示 ffmpeg 可执行文件的来源和版本要求。来源只在启动时读取，版本要求在重载后生效。
+type FFmpegConfig struct {
+	// Source 是来源：system、bundled 或 auto。默认为 system，内置了 ffmpeg 的构建默认为 auto。
+	Source string `yaml:"source,omitempty"`
+	// Path 是系统 ffmpeg 的路径（可选），ffprobe 取同一目录下的 ffprobe。
+	Path string `yaml:"path,omitempty"`
+	// Download 是静态 ffmpeg 的下载源，清单格式与 self-update 相同（可选）。
+	// 未内置 ffmpeg 时 bundled 需要该配置；public_key 为空时使用编译时内置的更新公钥。
+	Download *UpdateConfig `yaml:"download,omitempty"`
+	// Dir 是释放或下载的 ffmpeg 的存放目录（可选）。
+	Dir string `yaml:"dir,omitempty"`
+	// MinVersion 是允许的最低版本（可选），如 5.1。
+	MinVersion string `yaml:"min_version,omitempty"`
+	// MaxVersion 是允许的最高版本（可选），按给出的位数比较，7.1 允许 7.1.x。
+	MaxVersion string `yaml:"max_version,omitempty"`
+	// KnownBad 是已知有问题的版本（可选）。
+	KnownBad []KnownBadFFmpeg `yaml:"known_bad,omitempty"`
+	// VersionAction 是版本不符合要求时的处理方式：warn（默认）或 refuse。
+	VersionAction string `yaml:"version_action,omitempty"`
+}
+
+// validate 校验 ffmpeg 来源和版本要求。
+func (c *FFmpegConfig) validate() error {
+	switch c.Source {
+	case "", FFmpegSourceSystem, FFmpegSourceBundled, FFmpegSourceAuto:
+	default:
+		return fmt.Errorf("source must be system, bundled or auto")
+	}
+	for name, p := range map[string]string{"path": c.Path, "dir": c.Dir} {
+		if p != "" && !filepath.IsAbs(p) {
+			return fmt.Errorf("%s must be an absolute path", name)
+		}
+	}
+	if c.Download != nil {
+		if err := c.Download.validate(); err != nil {
+			return fmt.Errorf("download: %w", err)
+		}
+	}
+	return c.validateVersionPins()
+}
+
+// dir 返回释放或下载的 ffmpeg 的存放目录。
+func (c *FFmpegConfig) dir() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	if os.Geteuid() == 0 {
+		return "/var/lib/stream-runner/ffmpeg"
+	}
+	return filepath.Join(paths.LogDir, "ffmpeg")
+}
+
+// resolveFFmpeg 按配置确定 ffmpeg 和 ffprobe 的命令，在启动工作器之前调用一次。
+func resolveFFmpeg(c *FFmpegConfig) error {
+	if c == nil {
+		c = &FFmpegConfig{}
+	}
+	system := "ffmpeg"
+	if c.Path != "" {
+		system = c.Path
+	}
+	source := c.Source
+	if source == "" {
+		source = FFmpegSourceSystem
+		if embeddedFFmpeg != nil {
+			source = FFmpegSourceAuto
+		}
+	}
+	switch source {
+	case FFmpegSourceSystem:
+		setFFmpegBin(system)
+		return nil
+	case FFmpegSourceAuto:
+		if p, err := exec.LookPath(system); err == nil {
+			setFFmpegBin(p)
+			return nil
+		}
+		slog.Info("ffmpeg not found on the system, using the bundled ffmpeg")
+	}
+	ffmpeg, ffprobe, err := bundledFFmpeg(c)
+	if err != nil {
+		return fmt.Errorf("bundled ffmpeg: %w", err)
+	}
+	ffmpegBin = ffmpeg
+	ffprobeBin = ffprobe
+	slog.Info("using bundled ffmpeg", "ffmpeg", ffmpegBin, "ffprobe", ffprobeBin)
+	return nil
+}
+
+// setFFmpegBin 使用系统 ffmpeg；ffprobe 取 ffmpeg 所在目录下的 ffprobe，ffmpeg 只给出命令名时从 PATH 查找。
+func setFFmpegBin(ffmpeg string) {
+	ffmpegBin = ffmpeg
+	ffprobeBin = "ffprobe"
+	if strings.ContainsRune(ffmpeg, filepath.Separator) {
+		ffprobeBin = filepath.Join(filepath.Dir(ffmpeg), "ffprobe")
+	}
+}
+
+// bundledFFmpeg 返回内置或下载的 ffmpeg 和 ffprobe 的路径。内置优先，没有 ffprobe 时仍使用 PATH 中的 ffprobe。
+func bundledFFmpeg(c *FFmpegConfig) (ffmpeg, ffprobe string, err error) {
+	if embeddedFFmpeg != nil {
+		return extractEmbeddedFFmpeg(embeddedFFmpeg, c.dir())
+	}
+	if c.Download == nil {
+		return "", "", fmt.Errorf("this build has no embedded ffmpeg, configure ffmpeg.download")
+	}
+	return downloadFFmpeg(c.Download, c.dir(), &http.Client{Timeout: updateTimeout})
+}
+
+// installTool 把可执行文件写到 dir/<sha256>/name 并返回路径，已存在且内容一致时直接复用。
+func installTool(dir, name string, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	path := filepath.Join(dir, digest, name)
+	if got, err := fileSHA256(path); err == nil && got == digest {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+name+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// extractEmbeddedFFmpeg 把内置的 ffmpeg（和 ffprobe）释放到 dir 下。
+func extractEmbeddedFFmpeg(fsys fs.FS, dir string) (ffmpeg, ffprobe string, err error) {
+	data, err := fs.ReadFile(fsys, "bundled/ffmpeg")
+	if err != nil {
+		return "", "", err
+	}
+	if ffmpeg, err = installTool(dir, "ffmpeg", data); err != nil {
+		return "", "", err
+	}
+	ffprobe = "ffprobe"
+	if data, err := fs.ReadFile(fsys, "bundled/ffprobe"); err == nil {
+		if ffprobe, err = installTool(dir, "ffprobe", data); err != nil {
+			return "", "", err
+		}
+	}
+	return ffmpeg, ffprobe, nil
+}
+
+// bundleRecord 记录从某个下载源取得并校验过的 ffmpeg。
+type bundleRecord struct {
+	URL     string `json:"url"`
+	Version string `json:"version"`
+	FFmpeg  string `json:"ffmpeg"`
+	FFprobe string `json:"ffprobe,omitempty"`
+}
+
+// cachedDownload 返回之前从同一下载源取得的 ffmpeg；记录不存在、下载源已变更或文件被改动时返回 false。
+func cachedDownload(u, dir string) (bundleRecord, bool) {
+	var rec bundleRecord
+	data, err := os.ReadFile(filepath.Join(dir, bundleRecordFile))
+	if err != nil || json.Unmarshal(data, &rec) != nil || rec.URL != u {
+		return rec, false
+	}
+	// Files live under their own sha256, so the directory name is the expected digest.
+	for _, p := range []string{rec.FFmpeg, rec.FFprobe} {
+		if p == "" {
+			continue
+		}
+		if got, err := fileSHA256(p); err != nil || got != filepath.Base(filepath.Dir(p)) {
+			return rec, false
+		}
+	}
+	return rec, rec.FFmpeg != ""
+}
+
+// downloadFFmpeg 下载并校验当前平台的静态 ffmpeg。清单中的二进制以 GOOS/GOARCH/ffmpeg、GOOS/GOARCH/ffprobe 为键，
+// 清单签名和 SHA-256 校验与 self-update 相同。下载成功后记录在 dir 中，之后启动不再访问网络。
+func downloadFFmpeg(c *UpdateConfig, dir string, client *http.Client) (ffmpeg, ffprobe string, err error) {
+	if rec, ok := cachedDownload(c.URL, dir); ok {
+		ffprobe = rec.FFprobe
+		if ffprobe == "" {
+			ffprobe = "ffprobe"
+		}
+		return rec.FFmpeg, ffprobe, nil
+	}
+	key := c.PublicKey
+	if key == "" {
+		key = updatePublicKey
+	}
+	if key == "" {
+		return "", "", fmt.Errorf("ffmpeg.download.public_key is required to verify the manifest")
+	}
+	pub, err := parsePublicKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := fetchURL(client, c.URL)
+	if err != nil {
+		return "", "", err
+	}
+	sig, err := fetchURL(client, c.URL+".sig")
+	if err != nil {
+		return "", "", err
+	}
+	manifest, err := verifyManifest(pub, data, sig)
+	if err != nil {
+		return "", "", err
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	rec := bundleRecord{URL: c.URL, Version: manifest.Version}
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		asset, err := manifest.assetFor(c.URL, platform+"/"+name)
+		if err != nil {
+			if name == "ffprobe" {
+				continue // ffprobe is optional; probe features then use the system ffprobe.
+			}
+			return "", "", err
+		}
+		slog.Info("downloading bundled ffmpeg", "url", asset.URL, "version", manifest.Version)
+		binary, err := fetchURL(client, asset.URL)
+		if err != nil {
+			return "", "", err
+		}
+		sum := sha256.Sum256(binary)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, asset.SHA256) {
+			return "", "", fmt.Errorf("%s sha256 mismatch: manifest %s, downloaded %s", name, asset.SHA256, got)
+		}
+		path, err := installTool(dir, name, binary)
+		if err != nil {
+			return "", "", err
+		}
+		if name == "ffmpeg" {
+			rec.FFmpeg = path
+		} else {
+			rec.FFprobe = path
+		}
+	}
+	if data, err := json.Marshal(rec); err == nil {
+		if err := writeFileAtomic(filepath.Join(dir, bundleRecordFile), data); err != nil {
+			slog.Warn("failed to record bundled ffmpeg, it will be downloaded again on the next start", "error", err)
+		}
+	}
+	ffprobe = rec.FFprobe
+	if ffprobe == "" {
+		ffprobe = "ffprobe"
+	}
+	return rec.FFmpeg, ffprobe, nil
+}
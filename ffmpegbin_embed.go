@@ -0,0 +1,14 @@
+//go:build bundled_ffmpeg
+
+package main
+
+import "embed"
+
+// bundledFS 是构建时放在 bundled/ 目录下的静态 ffmpeg 和 ffprobe。
+//
+//go:embed bundled
+var bundledFS embed.FS
+
+func init() {
+	embeddedFFmpeg = bundledFS
+}
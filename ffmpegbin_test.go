@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestDownloadFFmpeg 测试下载静态 ffmpeg：校验清单签名和 SHA-256，之后启动离线复用，文件被改动时重新下载。
+func TestDownloadFFmpeg(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("\x7fELF static ffmpeg")
+	sum := sha256.Sum256(binary)
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	manifest := []byte(`{"version": "7.0.2", "assets": {"` + platform + `/ffmpeg": {"url": "bin/ffmpeg", "sha256": "` + hex.EncodeToString(sum[:]) + `"}}}`)
+	served := binary
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/ffmpeg.json":
+			w.Write(manifest)
+		case "/ffmpeg.json.sig":
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest))))
+		case "/bin/ffmpeg":
+			w.Write(served)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &UpdateConfig{URL: srv.URL + "/ffmpeg.json", PublicKey: base64.StdEncoding.EncodeToString(pub)}
+	dir := t.TempDir()
+	ffmpeg, ffprobe, err := downloadFFmpeg(c, dir, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(ffmpeg); string(data) != string(binary) || ffprobe != "ffprobe" {
+		t.Errorf("ffmpeg = %s (%q), ffprobe = %s", ffmpeg, data, ffprobe)
+	}
+	if info, err := os.Stat(ffmpeg); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("ffmpeg is not executable: %v", err)
+	}
+
+	// The next start uses the recorded download without going to the network.
+	requests = 0
+	if again, _, err := downloadFFmpeg(c, dir, srv.Client()); err != nil || again != ffmpeg || requests != 0 {
+		t.Errorf("cached download: %s, %v, %d requests", again, err, requests)
+	}
+
+	// A modified file is not trusted; a tampered download is rejected.
+	if err := os.WriteFile(ffmpeg, []byte("modified"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	served = []byte("tampered")
+	if _, _, err := downloadFFmpeg(c, dir, srv.Client()); err == nil {
+		t.Error("accepted a binary with the wrong sha256")
+	}
+	if _, err := os.Stat(filepath.Join(dir, hex.EncodeToString(sum[:]))); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestResolveFFmpeg 测试按来源确定 ffmpeg 命令：system 时 ffprobe 取同一目录，bundled 没有可用的静态 ffmpeg 时报错。
+func TestResolveFFmpeg(t *testing.T) {
+	defer func() { ffmpegBin, ffprobeBin = "ffmpeg", "ffprobe" }()
+	if err := resolveFFmpeg(&FFmpegConfig{Path: "/opt/ffmpeg/bin/ffmpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	if ffmpegBin != "/opt/ffmpeg/bin/ffmpeg" || ffprobeBin != "/opt/ffmpeg/bin/ffprobe" {
+		t.Errorf("ffmpeg = %s, ffprobe = %s", ffmpegBin, ffprobeBin)
+	}
+	if embeddedFFmpeg == nil {
+		if err := resolveFFmpeg(&FFmpegConfig{Source: FFmpegSourceBundled}); err == nil {
+			t.Error("bundled source without embedded ffmpeg or download succeeded")
+		}
+	}
+	if err := (&FFmpegConfig{Source: "docker"}).validate(); err == nil {
+		t.Error("accepted an unknown source")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ffmpeg 版本不符合要求时的处理方式。
+const (
+	// FFmpegVersionWarn 表示只记录警告，照常启动。
+	FFmpegVersionWarn = "warn"
+	// FFmpegVersionRefuse 表示拒绝启动：全局要求不满足时守护进程不启动，只影响部分封装的已知问题版本只拒绝相应的流。
+	FFmpegVersionRefuse = "refuse"
+)
+
+// errFFmpegVersion 表示 ffmpeg 版本不满足配置的要求。
+var errFFmpegVersion = errors.New("ffmpeg version refused")
+
+// ffmpegPolicy 是当前生效的 ffmpeg 配置，版本要求在配置重载时替换。
+var ffmpegPolicy atomic.Pointer[FFmpegConfig]
+
+// KnownBadFFmpeg 是已知有问题的 ffmpeg 版本。
+type KnownBadFFmpeg struct {
+	// Version 是版本号前缀，如 6.0 匹配 6.0.x，4.4.2-0ubuntu0.22.04.1 只匹配该发行版构建。
+	Version string `yaml:"version"`
+	// Reason 是问题说明，写入日志和错误信息。
+	Reason string `yaml:"reason,omitempty"`
+	// Formats 是受影响的输出封装（可选），为空时影响所有流。
+	Formats []string `yaml:"formats,omitempty"`
+}
+
+// matches 判断版本号是否属于该条目。
+func (k KnownBadFFmpeg) matches(token string) bool {
+	if !strings.HasPrefix(token, k.Version) {
+		return false
+	}
+	rest := token[len(k.Version):]
+	return rest == "" || rest[0] == '.' || rest[0] == '-' || rest[0] == '+'
+}
+
+// appliesTo 判断条目是否影响 format 封装的流。
+func (k KnownBadFFmpeg) appliesTo(format string) bool {
+	return len(k.Formats) == 0 || containsString(k.Formats, format)
+}
+
+// validateVersionPins 校验版本要求。
+func (c *FFmpegConfig) validateVersionPins() error {
+	var pins [2][]int
+	for i, v := range []string{c.MinVersion, c.MaxVersion} {
+		if v == "" {
+			continue
+		}
+		if pins[i] = parseVersionNumbers(v); pins[i] == nil || strings.Trim(v, "0123456789.") != "" {
+			return fmt.Errorf("version %q must be numeric, like 6.1", v)
+		}
+	}
+	if pins[0] != nil && pins[1] != nil && compareVersion(pins[1], pins[0]) < 0 {
+		return fmt.Errorf("max_version must not be lower than min_version")
+	}
+	for i, k := range c.KnownBad {
+		if k.Version == "" {
+			return fmt.Errorf("known_bad[%d]: version is required", i)
+		}
+	}
+	switch c.VersionAction {
+	case "", FFmpegVersionWarn, FFmpegVersionRefuse:
+	default:
+		return fmt.Errorf("version_action must be warn or refuse")
+	}
+	return nil
+}
+
+// hasVersionPins 判断是否配置了版本要求。
+func (c *FFmpegConfig) hasVersionPins() bool {
+	return c != nil && (c.MinVersion != "" || c.MaxVersion != "" || len(c.KnownBad) > 0)
+}
+
+// ffmpegVersionToken 从 -version 的第一行取出版本号，如 "ffmpeg version n6.1.1-static ..." 得到 6.1.1-static。
+func ffmpegVersionToken(line string) string {
+	rest, ok := strings.CutPrefix(line, "ffmpeg version ")
+	if !ok {
+		return ""
+	}
+	token, _, _ := strings.Cut(rest, " ")
+	return strings.TrimPrefix(token, "n")
+}
+
+// parseVersionNumbers 解析版本号开头的数字部分，如 4.4.2-0ubuntu0.22.04.1 得到 [4 4 2]。不以数字开头时返回 nil。
+func parseVersionNumbers(token string) []int {
+	var nums []int
+	for _, part := range strings.Split(token, ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(part[:end])
+		nums = append(nums, n)
+		if end < len(part) {
+			break
+		}
+	}
+	return nums
+}
+
+// compareVersion 按 pin 的精度比较版本：got 只比较到 pin 的位数，缺少的位视为 0。
+func compareVersion(got, pin []int) int {
+	for i, p := range pin {
+		g := 0
+		if i < len(got) {
+			g = got[i]
+		}
+		if g != p {
+			if g < p {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionProblems 返回版本不满足要求的原因。format 为空时只检查影响所有流的要求。
+// 无法识别的版本（git 构建等）不检查最低和最高版本。
+func (c *FFmpegConfig) versionProblems(version, format string) []string {
+	token := ffmpegVersionToken(version)
+	var problems []string
+	if got := parseVersionNumbers(token); got != nil {
+		if c.MinVersion != "" && compareVersion(got, parseVersionNumbers(c.MinVersion)) < 0 {
+			problems = append(problems, fmt.Sprintf("ffmpeg %s is older than min_version %s", token, c.MinVersion))
+		}
+		if c.MaxVersion != "" && compareVersion(got, parseVersionNumbers(c.MaxVersion)) > 0 {
+			problems = append(problems, fmt.Sprintf("ffmpeg %s is newer than max_version %s", token, c.MaxVersion))
+		}
+	}
+	for _, k := range c.KnownBad {
+		if !k.matches(token) || (format == "" && len(k.Formats) > 0) || (format != "" && !k.appliesTo(format)) {
+			continue
+		}
+		msg := fmt.Sprintf("ffmpeg %s is known bad", token)
+		if len(k.Formats) > 0 {
+			msg += " for " + strings.Join(k.Formats, ", ")
+		}
+		if k.Reason != "" {
+			msg += ": " + k.Reason
+		}
+		problems = append(problems, msg)
+	}
+	return problems
+}
+
+// checkFFmpegVersionAtStartup 在启动时按配置检查 ffmpeg 版本。refuse 时全局要求不满足返回错误；
+// 只影响部分封装的已知问题版本只记录日志，由使用这些封装的流在启动时拒绝。
+func checkFFmpegVersionAtStartup(c *FFmpegConfig, version string) error {
+	if !c.hasVersionPins() {
+		return nil
+	}
+	token := ffmpegVersionToken(version)
+	if parseVersionNumbers(token) == nil && (c.MinVersion != "" || c.MaxVersion != "") {
+		slog.Warn("cannot determine the ffmpeg release, min_version and max_version are not checked", "version", version)
+	}
+	for _, k := range c.KnownBad {
+		if len(k.Formats) > 0 && k.matches(token) {
+			slog.Warn("ffmpeg is known bad for some output formats", "version", token, "formats", k.Formats,
+				"reason", k.Reason, "action", c.versionAction())
+		}
+	}
+	problems := c.versionProblems(version, "")
+	if len(problems) == 0 {
+		return nil
+	}
+	if c.versionAction() == FFmpegVersionRefuse {
+		return fmt.Errorf("%w: %s", errFFmpegVersion, strings.Join(problems, "; "))
+	}
+	for _, p := range problems {
+		slog.Warn("ffmpeg version does not meet the configured requirements", "problem", p)
+	}
+	return nil
+}
+
+// versionAction 返回版本不符合要求时的处理方式。
+func (c *FFmpegConfig) versionAction() string {
+	if c.VersionAction == "" {
+		return FFmpegVersionWarn
+	}
+	return c.VersionAction
+}
+
+// checkFFmpegVersion 在每次启动 ffmpeg 前检查当前 ffmpeg 的版本是否适用于 format 封装的输出。
+// ffmpeg 可执行文件在运行期间被替换（如发行版升级）时重新检测版本。refuse 时返回错误，warn 时同一问题只记录一次。
+func checkFFmpegVersion(streamID, format string) error {
+	c := ffmpegPolicy.Load()
+	if !c.hasVersionPins() {
+		return nil
+	}
+	problems := c.versionProblems(ffmpegVersions.current(), format)
+	if len(problems) == 0 {
+		return nil
+	}
+	if c.versionAction() == FFmpegVersionRefuse {
+		return fmt.Errorf("%w: %s", errFFmpegVersion, strings.Join(problems, "; "))
+	}
+	for _, p := range problems {
+		if _, seen := warnedVersions.LoadOrStore(p, true); !seen {
+			slog.Warn("ffmpeg version does not meet the configured requirements", "stream_id", streamID, "problem", p)
+		}
+	}
+	return nil
+}
+
+// warnedVersions 记录已经警告过的版本问题，避免每次重启都重复记录。
+var warnedVersions sync.Map
+
+// ffmpegVersionCache 缓存 ffmpeg 可执行文件的版本，以路径、大小和修改时间判断文件是否被替换。
+type ffmpegVersionCache struct {
+	mu      sync.Mutex
+	key     string
+	version string
+}
+
+// ffmpegVersions 是当前 ffmpeg 的版本缓存。
+var ffmpegVersions = &ffmpegVersionCache{}
+
+// fileKey 返回 ffmpeg 可执行文件的标识，找不到文件时返回空串。
+func (c *ffmpegVersionCache) fileKey() string {
+	path, err := exec.LookPath(ffmpegBin)
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())
+}
+
+// seed 记录启动时检测到的版本。
+func (c *ffmpegVersionCache) seed(version string) {
+	key := c.fileKey()
+	c.mu.Lock()
+	c.key, c.version = key, version
+	c.mu.Unlock()
+}
+
+// current 返回当前 ffmpeg 的版本行，可执行文件变化时重新运行 ffmpeg -version。
+func (c *ffmpegVersionCache) current() string {
+	key := c.fileKey()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key == "" || key == c.key {
+		return c.version
+	}
+	out, err := exec.Command(ffmpegBin, "-version").Output()
+	if err != nil {
+		slog.Warn("failed to detect ffmpeg version", "error", err)
+		return c.version
+	}
+	version, _, _ := strings.Cut(string(out), "\n")
+	version = strings.TrimSpace(version)
+	if c.key != "" && version != c.version {
+		slog.Warn("ffmpeg binary changed on disk", "old_version", c.version, "new_version", version)
+	}
+	c.key, c.version = key, version
+	return version
+}
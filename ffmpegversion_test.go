@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestFFmpegVersionProblems 测试版本要求：按位数比较最低和最高版本，已知问题版本按前缀和封装匹配，无法识别的版本不比较最低最高版本。
+func TestFFmpegVersionProblems(t *testing.T) {
+	c := &FFmpegConfig{
+		MinVersion: "5.1",
+		MaxVersion: "7.1",
+		KnownBad: []KnownBadFFmpeg{
+			{Version: "4.4.2-0ubuntu0.22.04.1", Reason: "broken FLV muxer", Formats: []string{"flv"}},
+			{Version: "6.0", Reason: "segfault on reconnect"},
+		},
+	}
+	for _, tc := range []struct {
+		version, format string
+		want            int
+	}{
+		{"ffmpeg version 6.1.1 Copyright (c) 2000-2023", "flv", 0},
+		{"ffmpeg version n7.1.2-static https://johnvansickle.com/ffmpeg/", "flv", 0},
+		{"ffmpeg version 7.2 Copyright", "flv", 1},
+		{"ffmpeg version 5.0.3", "", 1},
+		{"ffmpeg version 6.0.1", "mpegts", 1},
+		{"ffmpeg version 6.01", "mpegts", 0},
+		// Too old, and known bad for flv only.
+		{"ffmpeg version 4.4.2-0ubuntu0.22.04.1 Copyright", "flv", 2},
+		{"ffmpeg version 4.4.2-0ubuntu0.22.04.1 Copyright", "mpegts", 1},
+		{"ffmpeg version 4.4.2-0ubuntu0.22.04.1 Copyright", "", 1},
+		{"ffmpeg version N-112345-g0123456789 Copyright", "flv", 0},
+	} {
+		if got := c.versionProblems(tc.version, tc.format); len(got) != tc.want {
+			t.Errorf("versionProblems(%q, %q) = %q, want %d problems", tc.version, tc.format, got, tc.want)
+		}
+	}
+
+	for _, bad := range []*FFmpegConfig{
+		{MinVersion: "6.x"},
+		{MinVersion: "7", MaxVersion: "6.1"},
+		{KnownBad: []KnownBadFFmpeg{{Reason: "no version"}}},
+		{VersionAction: "ignore"},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded", bad)
+		}
+	}
+}
+
+// TestCheckFFmpegVersion 测试版本检查的处理方式：refuse 时启动和单路流被拒绝，只影响部分封装的问题只拒绝相应的流。
+func TestCheckFFmpegVersion(t *testing.T) {
+	c := &FFmpegConfig{
+		KnownBad:      []KnownBadFFmpeg{{Version: "4.4.2", Reason: "broken FLV muxer", Formats: []string{"flv"}}},
+		VersionAction: FFmpegVersionRefuse,
+	}
+	if err := checkFFmpegVersionAtStartup(c, "ffmpeg version 4.4.2-0ubuntu0.22.04.1"); err != nil {
+		t.Errorf("startup refused for a format-specific problem: %v", err)
+	}
+	c.MinVersion = "5"
+	if err := checkFFmpegVersionAtStartup(c, "ffmpeg version 4.4.2-0ubuntu0.22.04.1"); !errors.Is(err, errFFmpegVersion) {
+		t.Errorf("startup with an old ffmpeg: %v", err)
+	}
+	c.MinVersion = ""
+
+	ffmpegPolicy.Store(c)
+	defer ffmpegPolicy.Store(nil)
+	ffmpegVersions.seed("ffmpeg version 4.4.2-0ubuntu0.22.04.1")
+	defer ffmpegVersions.seed("")
+	if err := checkFFmpegVersion("news", "flv"); !errors.Is(err, errFFmpegVersion) {
+		t.Errorf("flv stream: %v", err)
+	}
+	if err := checkFFmpegVersion("news", "mpegts"); err != nil {
+		t.Errorf("mpegts stream: %v", err)
+	}
+	c.VersionAction = FFmpegVersionWarn
+	if err := checkFFmpegVersion("news", "flv"); err != nil {
+		t.Errorf("warn only: %v", err)
+	}
+}
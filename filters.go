@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DeinterlaceOff 不做去隔行处理（默认）。
+	DeinterlaceOff = "off"
+	// DeinterlaceAuto 在探测到隔行源时去隔行，只处理标记为隔行的帧。
+	DeinterlaceAuto = "auto"
+	// DeinterlaceAlways 始终对所有帧去隔行。
+	DeinterlaceAlways = "always"
+)
+
+// validDeinterlaceFilters 是支持的去隔行滤镜。
+var validDeinterlaceFilters = []string{"yadif", "bwdif"}
+
+// DeinterlaceConfig 表示去隔行配置。
+type DeinterlaceConfig struct {
+	// Mode 是去隔行模式：off（默认）、auto 或 always。
+	Mode string `yaml:"mode,omitempty"`
+	// Filter 是去隔行滤镜：yadif（默认）或 bwdif。
+	Filter string `yaml:"filter,omitempty"`
+}
+
+// validate 校验去隔行配置。
+func (c *DeinterlaceConfig) validate(probe bool) error {
+	switch c.Mode {
+	case "", DeinterlaceOff, DeinterlaceAlways:
+	case DeinterlaceAuto:
+		if !probe {
+			return fmt.Errorf("mode auto requires probe")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q", c.Mode)
+	}
+	if c.Filter != "" && !containsString(validDeinterlaceFilters, c.Filter) {
+		return fmt.Errorf("invalid filter %q", c.Filter)
+	}
+	return nil
+}
+
+// isInterlaced 根据 ffprobe 报告的场序判断视频是否为隔行。
+func isInterlaced(v *probeStream) bool {
+	switch v.FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+	return false
+}
+
+// planDeinterlace 按配置和探测结果决定是否去隔行，去隔行会强制视频走转码路径。
+func planDeinterlace(plan outputPlan, cfg StreamConfig, probe *probeResult, profile *TranscodeProfile) outputPlan {
+	c := cfg.Deinterlace
+	if c == nil {
+		return plan
+	}
+	filter := c.Filter
+	if filter == "" {
+		filter = "yadif"
+	}
+	switch c.Mode {
+	case DeinterlaceAlways:
+		plan.Deinterlace = filter
+	case DeinterlaceAuto:
+		if probe == nil {
+			return plan
+		}
+		v := probe.Video()
+		if v == nil || !isInterlaced(v) {
+			return plan
+		}
+		// Only touch frames flagged as interlaced in case the source switches scan type.
+		plan.Deinterlace = filter + "=deint=interlaced"
+	default:
+		return plan
+	}
+	return forceVideoTranscode(plan, profile)
+}
+
+// forceVideoTranscode 让视频走转码路径，未指定转码配置时使用默认参数。
+func forceVideoTranscode(plan outputPlan, profile *TranscodeProfile) outputPlan {
+	if plan.Profile == nil {
+		if profile == nil {
+			profile = &TranscodeProfile{}
+		}
+		plan.Profile = profile
+	}
+	plan.TranscodeVideo = true
+	return plan
+}
+
+// ntscFrameRates 把常见的 NTSC 小数帧率映射为精确的分数形式。
+var ntscFrameRates = map[string][2]int{
+	"23.976": {24000, 1001},
+	"29.97":  {30000, 1001},
+	"59.94":  {60000, 1001},
+}
+
+// parseFrameRate 解析帧率，支持整数（25）、小数（29.97）和分数（30000/1001）。
+func parseFrameRate(s string) (num, den int, err error) {
+	s = strings.TrimSpace(s)
+	if r, ok := ntscFrameRates[s]; ok {
+		return r[0], r[1], nil
+	}
+	if n, d, found := strings.Cut(s, "/"); found {
+		num, err = strconv.Atoi(n)
+		if err == nil {
+			den, err = strconv.Atoi(d)
+		}
+		if err != nil || num <= 0 || den <= 0 {
+			return 0, 0, fmt.Errorf("invalid frame rate %q", s)
+		}
+		return num, den, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 || f > 240 {
+		return 0, 0, fmt.Errorf("invalid frame rate %q", s)
+	}
+	if f == math.Trunc(f) {
+		return int(f), 1, nil
+	}
+	return int(math.Round(f * 1000)), 1000, nil
+}
+
+// sameFrameRate 判断 ffprobe 报告的帧率（如 "25/1"）是否等于 num/den。
+func sameFrameRate(probed string, num, den int) bool {
+	pn, pd, err := parseFrameRate(probed)
+	if err != nil {
+		return false
+	}
+	return pn*den == num*pd
+}
+
+// planFrameRate 按配置转换输出帧率，转换会强制视频走转码路径。
+// 探测到源帧率已经等于目标帧率时保持复制。
+func planFrameRate(plan outputPlan, cfg StreamConfig, probe *probeResult, profile *TranscodeProfile) outputPlan {
+	if cfg.FrameRate == "" {
+		return plan
+	}
+	num, den, err := parseFrameRate(cfg.FrameRate)
+	if err != nil {
+		return plan // Rejected by validateConfig.
+	}
+	if probe != nil {
+		if v := probe.Video(); v != nil && sameFrameRate(v.RFrameRate, num, den) {
+			return plan
+		}
+	}
+	plan.FrameRate = fmt.Sprintf("fps=%d/%d", num, den)
+	return forceVideoTranscode(plan, profile)
+}
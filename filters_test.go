@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPlanDeinterlace 测试隔行源自动去隔行
+func TestPlanDeinterlace(t *testing.T) {
+	interlaced := &probeResult{Streams: []probeStream{{CodecType: "video", CodecName: "h264", FieldOrder: "tt"}}}
+	progressive := &probeResult{Streams: []probeStream{{CodecType: "video", CodecName: "h264", FieldOrder: "progressive"}}}
+	cfg := StreamConfig{Deinterlace: &DeinterlaceConfig{Mode: DeinterlaceAuto, Filter: "bwdif"}}
+
+	plan := planDeinterlace(outputPlan{Format: "flv"}, cfg, interlaced, &TranscodeProfile{Width: 1280})
+	joined := strings.Join(plan.codecArgs(), " ")
+	if !strings.Contains(joined, "-vf bwdif=deint=interlaced,scale=1280:-2") {
+		t.Errorf("expected deinterlace before scale, got %s", joined)
+	}
+	if plan := planDeinterlace(outputPlan{Format: "flv"}, cfg, progressive, nil); plan.TranscodeVideo {
+		t.Errorf("expected progressive source to be copied, got %+v", plan)
+	}
+	if err := (&DeinterlaceConfig{Mode: DeinterlaceAuto}).validate(false); err == nil {
+		t.Error("expected auto mode without probe to be rejected")
+	}
+}
+
+// TestPlanFrameRate 测试帧率转换配置
+func TestPlanFrameRate(t *testing.T) {
+	cases := map[string][2]int{"25": {25, 1}, "29.97": {30000, 1001}, "30000/1001": {30000, 1001}, "12.5": {12500, 1000}}
+	for in, want := range cases {
+		num, den, err := parseFrameRate(in)
+		if err != nil || num != want[0] || den != want[1] {
+			t.Errorf("parseFrameRate(%q) = %d/%d %v, want %d/%d", in, num, den, err, want[0], want[1])
+		}
+	}
+	if _, _, err := parseFrameRate("0"); err == nil {
+		t.Error("expected zero frame rate to be rejected")
+	}
+
+	cfg := StreamConfig{FrameRate: "25"}
+	source50 := &probeResult{Streams: []probeStream{{CodecType: "video", RFrameRate: "50/1"}}}
+	plan := planFrameRate(outputPlan{}, cfg, source50, nil)
+	if !plan.TranscodeVideo || plan.FrameRate != "fps=25/1" {
+		t.Errorf("expected 50 to 25 conversion, got %+v", plan)
+	}
+	source25 := &probeResult{Streams: []probeStream{{CodecType: "video", RFrameRate: "25/1"}}}
+	if plan := planFrameRate(outputPlan{}, cfg, source25, nil); plan.TranscodeVideo {
+		t.Errorf("expected matching source to be copied, got %+v", plan)
+	}
+}
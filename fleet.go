@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stream-runner/client"
+)
+
+const (
+	// DefaultFleetInterval 是轮询其他节点的默认间隔。
+	DefaultFleetInterval = 30 * time.Second
+	// DefaultFleetTimeout 是单个节点请求的默认超时时间。
+	DefaultFleetTimeout = 5 * time.Second
+)
+
+// FleetConfig 表示多节点汇总：定期轮询其他 stream-runner 节点的 /inventory，在 /fleet 中展示全部节点和流。
+type FleetConfig struct {
+	// Nodes 是要汇总的节点，可以包含本机。
+	Nodes []FleetNode `yaml:"nodes"`
+	// Interval 是轮询间隔，默认 30s。
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout 是单个节点的请求超时，默认 5s。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// FleetNode 表示一个被汇总的节点。
+type FleetNode struct {
+	// Name 是节点名称，也是清单中的主机名。
+	Name string `yaml:"name"`
+	// URL 是节点 HTTP 服务的地址（含 base_path），如 http://edge-1:9310。
+	URL string `yaml:"url"`
+}
+
+// validate 校验多节点汇总配置。
+func (c *FleetConfig) validate() error {
+	if len(c.Nodes) == 0 {
+		return fmt.Errorf("nodes is required")
+	}
+	if c.Interval < 0 || c.Timeout < 0 {
+		return fmt.Errorf("interval and timeout must not be negative")
+	}
+	seen := make(map[string]bool, len(c.Nodes))
+	for i, n := range c.Nodes {
+		if n.Name == "" {
+			return fmt.Errorf("nodes[%d]: name is required", i)
+		}
+		if seen[n.Name] {
+			return fmt.Errorf("nodes[%d]: duplicate name %q", i, n.Name)
+		}
+		seen[n.Name] = true
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("nodes[%d]: url must be an http(s) URL", i)
+		}
+	}
+	return nil
+}
+
+// withDefaults 返回填充了默认值的副本。
+func (c FleetConfig) withDefaults() FleetConfig {
+	if c.Interval == 0 {
+		c.Interval = DefaultFleetInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultFleetTimeout
+	}
+	return c
+}
+
+// fleetNodeStatus 是一个节点最近一次轮询的结果。
+type fleetNodeStatus struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Up 表示最近一次轮询是否成功。
+	Up bool `json:"up"`
+	// Rejected 表示节点的协议版本与本机不兼容，它的流不参与汇总。
+	Rejected bool `json:"rejected,omitempty"`
+	// LastSeen 是最近一次轮询成功的时间，从未成功时为空。
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	// Error 是最近一次轮询失败的原因。
+	Error   string                   `json:"error,omitempty"`
+	Version string                   `json:"version,omitempty"`
+	Region  string                   `json:"region,omitempty"`
+	Streams []client.InventoryStream `json:"streams"`
+}
+
+// fleetStatus 是 /fleet 的响应。
+type fleetStatus struct {
+	Nodes          []fleetNodeStatus `json:"nodes"`
+	NodesUp        int               `json:"nodes_up"`
+	Streams        int               `json:"streams"`
+	StreamsRunning int               `json:"streams_running"`
+}
+
+// fleetMonitor 定期轮询配置中的节点，节点列表随配置重载更新。
+type fleetMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// nodes 是按节点名称索引的最近状态，轮询失败时保留上次成功的流列表。
+	nodes    map[string]fleetNodeStatus
+	lastPoll time.Time
+	inFlight bool
+}
+
+// fleet 是当前的多节点汇总器，未配置时为空。
+var fleet atomic.Pointer[fleetMonitor]
+
+// newFleetMonitor 创建多节点汇总器。
+func newFleetMonitor(state *AppState) *fleetMonitor {
+	return &fleetMonitor{state: state, nodes: make(map[string]fleetNodeStatus)}
+}
+
+// fleetConfig 返回当前生效的多节点汇总配置。
+func fleetConfig(state *AppState) *FleetConfig {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.config == nil || state.config.Fleet == nil {
+		return nil
+	}
+	c := state.config.Fleet.withDefaults()
+	return &c
+}
+
+// run 每秒检查一次是否到了轮询时间。
+func (m *fleetMonitor) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cfg := fleetConfig(m.state)
+		if cfg == nil {
+			// Drop stale node status once fleet is removed from the config.
+			m.mu.Lock()
+			clear(m.nodes)
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Lock()
+		due := !m.inFlight && now.Sub(m.lastPoll) >= cfg.Interval
+		if due {
+			m.inFlight = true
+			m.lastPoll = now
+		}
+		m.mu.Unlock()
+		if due {
+			go m.poll(cfg)
+		}
+	}
+}
+
+// poll 并发轮询所有节点并更新状态，已从配置中删除的节点一并清除。
+func (m *fleetMonitor) poll(cfg *FleetConfig) {
+	results := make([]fleetNodeStatus, len(cfg.Nodes))
+	var wg sync.WaitGroup
+	for i, n := range cfg.Nodes {
+		wg.Add(1)
+		go func(i int, n FleetNode) {
+			defer wg.Done()
+			results[i] = pollFleetNode(n, cfg.Timeout)
+		}(i, n)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := make(map[string]fleetNodeStatus, len(results))
+	for _, r := range results {
+		if prev, ok := m.nodes[r.Name]; ok {
+			if prev.Up != r.Up || prev.Rejected != r.Rejected {
+				slog.Info("fleet node state changed", "node", r.Name, "up", r.Up, "rejected", r.Rejected, "error", r.Error)
+			}
+			if !r.Up && !r.Rejected {
+				r.LastSeen, r.Version, r.Region, r.Streams = prev.LastSeen, prev.Version, prev.Region, prev.Streams
+			}
+		}
+		nodes[r.Name] = r
+	}
+	m.nodes = nodes
+	m.inFlight = false
+}
+
+// pollFleetNode 读取一个节点的版本和清单。协议版本不同的节点标记为 rejected，不读取清单。
+func pollFleetNode(n FleetNode, timeout time.Duration) fleetNodeStatus {
+	status := fleetNodeStatus{Name: n.Name, URL: n.URL}
+	c, err := client.New(n.URL)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	c.HTTPClient = &http.Client{Timeout: timeout}
+	c.Retries = 0
+	info, err := c.Version(context.Background())
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if err := checkProtocol(info); err != nil {
+		slog.Warn("fleet node rejected", "node", n.Name, "version", info.Version, "error", err)
+		status.Rejected = true
+		status.Version = info.Version
+		status.Error = err.Error()
+		status.Streams = []client.InventoryStream{}
+		return status
+	}
+	inv, err := c.Inventory(context.Background(), n.Name)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	now := time.Now()
+	status.Up = true
+	status.LastSeen = &now
+	status.Version = inv.Version
+	status.Region = inv.Region
+	status.Streams = inv.Streams
+	return status
+}
+
+// checkProtocol 检查节点的协议版本是否与本机相同。
+func checkProtocol(info *client.BuildInfo) error {
+	switch {
+	case info.Protocol == protocolVersion:
+		return nil
+	case info.Protocol == 0:
+		return fmt.Errorf("node runs stream-runner %s without a protocol version, upgrade it to protocol %d", info.Version, protocolVersion)
+	case info.Protocol < protocolVersion:
+		return fmt.Errorf("node runs stream-runner %s with protocol %d, upgrade it to protocol %d", info.Version, info.Protocol, protocolVersion)
+	default:
+		return fmt.Errorf("node runs stream-runner %s with protocol %d, newer than protocol %d of this node, upgrade this node", info.Version, info.Protocol, protocolVersion)
+	}
+}
+
+// snapshot 返回按节点名称排序的汇总状态。
+func (m *fleetMonitor) snapshot() fleetStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := fleetStatus{Nodes: make([]fleetNodeStatus, 0, len(m.nodes))}
+	for _, n := range m.nodes {
+		out.Nodes = append(out.Nodes, n)
+		if n.Up {
+			out.NodesUp++
+		}
+		out.Streams += len(n.Streams)
+		for _, s := range n.Streams {
+			if s.Running {
+				out.StreamsRunning++
+			}
+		}
+	}
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Name < out.Nodes[j].Name })
+	return out
+}
+
+// handleFleet 处理 GET /fleet，未配置 fleet 时返回 404。
+func handleFleet(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		m := fleet.Load()
+		if m == nil || fleetConfig(state) == nil {
+			http.Error(w, "fleet is not configured", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.snapshot()); err != nil {
+			slog.Warn("failed to write fleet status", "error", err)
+		}
+	}
+}
+
+// writeFleetMetrics 输出各节点的汇总指标，未配置 fleet 时不输出。
+func writeFleetMetrics(bw *bufio.Writer) {
+	m := fleet.Load()
+	if m == nil {
+		return
+	}
+	status := m.snapshot()
+	if len(status.Nodes) == 0 {
+		return
+	}
+	fmt.Fprintln(bw, "# HELP stream_runner_fleet_node_up Whether the last poll of the fleet node succeeded.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_fleet_node_up gauge")
+	for _, n := range status.Nodes {
+		up := 0
+		if n.Up {
+			up = 1
+		}
+		fmt.Fprintf(bw, "stream_runner_fleet_node_up{node=\"%s\"} %d\n", escapeLabelValue(n.Name), up)
+	}
+	fmt.Fprintln(bw, "# HELP stream_runner_fleet_node_streams_running Running streams on the fleet node as of the last successful poll.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_fleet_node_streams_running gauge")
+	for _, n := range status.Nodes {
+		running := 0
+		for _, s := range n.Streams {
+			if s.Running {
+				running++
+			}
+		}
+		fmt.Fprintf(bw, "stream_runner_fleet_node_streams_running{node=\"%s\"} %d\n", escapeLabelValue(n.Name), running)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFleetPoll 测试轮询节点清单、节点离线时保留上次的流列表
+func TestFleetPoll(t *testing.T) {
+	node := &AppState{
+		workers: newWorkerMap(map[string]*StreamWorker{"a": {cfg: StreamConfig{ID: "a"}}}),
+		config:  &Config{Region: "cn-east", Streams: []StreamConfig{{ID: "a", Dst: "rtmp://ingest.example.com/live/key"}}},
+	}
+	srv := httptest.NewServer(newMetricsMux(node, ""))
+
+	cfg := (&FleetConfig{Nodes: []FleetNode{{Name: "edge-1", URL: srv.URL}, {Name: "edge-2", URL: "http://127.0.0.1:1"}}}).withDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Timeout = time.Second
+	m := newFleetMonitor(nil)
+	m.poll(&cfg)
+	status := m.snapshot()
+	if status.NodesUp != 1 || status.Streams != 1 || len(status.Nodes) != 2 {
+		t.Fatalf("unexpected fleet status %+v", status)
+	}
+	edge1 := status.Nodes[0]
+	if edge1.Name != "edge-1" || !edge1.Up || edge1.Region != "cn-east" || edge1.Streams[0].DstHost != "ingest.example.com" {
+		t.Errorf("unexpected node status %+v", edge1)
+	}
+	if status.Nodes[1].Up || status.Nodes[1].Error == "" {
+		t.Errorf("expected edge-2 to be down with an error, got %+v", status.Nodes[1])
+	}
+
+	srv.Close()
+	m.poll(&cfg)
+	edge1 = m.snapshot().Nodes[0]
+	if edge1.Up || len(edge1.Streams) != 1 || edge1.LastSeen == nil {
+		t.Errorf("expected last known streams to be kept for a down node, got %+v", edge1)
+	}
+}
+
+// TestFleetRejectsIncompatibleNode 测试协议版本不同的节点被标记为 rejected，它的流不计入汇总
+func TestFleetRejectsIncompatibleNode(t *testing.T) {
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"version":"0.9.0","commit":"","build_date":"","go_version":"go1.21"}`))
+		case "/inventory":
+			w.Write([]byte(`{"all":{"hosts":["edge-old"]},"_meta":{"hostvars":{"edge-old":{"stream_runner_streams":[{"id":"a","running":true}]}}}}`))
+		}
+	}))
+	defer old.Close()
+
+	cfg := (&FleetConfig{Nodes: []FleetNode{{Name: "edge-old", URL: old.URL}}}).withDefaults()
+	m := newFleetMonitor(nil)
+	m.poll(&cfg)
+	status := m.snapshot()
+	n := status.Nodes[0]
+	if n.Up || !n.Rejected || n.Version != "0.9.0" || !strings.Contains(n.Error, "protocol") || len(n.Streams) != 0 {
+		t.Errorf("expected edge-old to be rejected, got %+v", n)
+	}
+	if status.NodesUp != 0 || status.Streams != 0 {
+		t.Errorf("rejected node merged into fleet status %+v", status)
+	}
+}
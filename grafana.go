@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// timelineHeight 是状态时间线面板的高度。
+const timelineHeight = 10
+
+// grafanaAnnotation 返回以 Prometheus 查询结果为标注的定义，查询有值的时间点显示为竖线。
+func grafanaAnnotation(name, color, expr, title string) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"enable":      true,
+		"iconColor":   color,
+		"datasource":  map[string]any{"type": "prometheus", "uid": "${datasource}"},
+		"expr":        expr,
+		"step":        "1m",
+		"titleFormat": title,
+		"textFormat":  "{{instance}} {{stream_id}}",
+		"tagKeys":     "stream_id",
+	}
+}
+
+// buildGrafanaDashboard 根据指标描述和流 ID 生成 Grafana 仪表盘定义。
+// 计数器类指标以 rate() 展示，流 ID 作为多选模板变量，默认选中当前配置的全部流。
+// 顶部的状态时间线展示最近 24 小时每路流的运行状态，重启和流事件作为标注叠加在所有面板上，
+// 便于发现反复重启和同时发生的故障。
+func buildGrafanaDashboard(streamIDs []string) map[string]any {
+	const selector = `{instance=~"$instance",stream_id=~"$stream_id"}`
+	panels := []map[string]any{{
+		"id":         1,
+		"type":       "stat",
+		"title":      "Streams",
+		"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+		"gridPos":    map[string]any{"h": 4, "w": 24, "x": 0, "y": 0},
+		"targets": []map[string]any{{
+			"refId": "A",
+			"expr":  `sum(stream_runner_streams{instance=~"$instance"})`,
+		}},
+	}, {
+		"id":          len(streamMetrics) + 2,
+		"type":        "state-timeline",
+		"title":       "State (24h)",
+		"description": "Up/down state of each stream; restarts and stream events are shown as annotations.",
+		"datasource":  map[string]any{"type": "prometheus", "uid": "${datasource}"},
+		"gridPos":     map[string]any{"h": timelineHeight, "w": 24, "x": 0, "y": 4},
+		"timeFrom":    "24h",
+		"options":     map[string]any{"mergeValues": true, "showValue": "never", "rowHeight": 0.8},
+		"fieldConfig": map[string]any{
+			"defaults": map[string]any{
+				"color": map[string]any{"mode": "thresholds"},
+				"mappings": []any{map[string]any{
+					"type": "value",
+					"options": map[string]any{
+						"0": map[string]any{"text": "down", "color": "red"},
+						"1": map[string]any{"text": "up", "color": "green"},
+					},
+				}},
+			},
+			"overrides": []any{},
+		},
+		"targets": []map[string]any{{
+			"refId":        "A",
+			"expr":         "stream_runner_stream_up" + selector,
+			"legendFormat": "{{instance}} {{stream_id}}",
+		}},
+	}}
+
+	for i, m := range streamMetrics {
+		expr := m.name + selector
+		title := strings.TrimPrefix(m.name, "stream_runner_stream_")
+		if m.kind == "counter" {
+			expr = fmt.Sprintf("rate(%s[$__rate_interval])", expr)
+			title = strings.TrimSuffix(title, "_total") + " (rate)"
+		}
+		panels = append(panels, map[string]any{
+			"id":          i + 2,
+			"type":        "timeseries",
+			"title":       title,
+			"description": m.help,
+			"datasource":  map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":     map[string]any{"h": 8, "w": 12, "x": (i % 2) * 12, "y": 4 + timelineHeight + (i/2)*8},
+			"fieldConfig": map[string]any{
+				"defaults":  map[string]any{"unit": m.unit},
+				"overrides": []any{},
+			},
+			"targets": []map[string]any{{
+				"refId":        "A",
+				"expr":         expr,
+				"legendFormat": "{{instance}} {{stream_id}}",
+			}},
+		})
+	}
+
+	current := map[string]any{"text": "All", "value": "$__all"}
+	if len(streamIDs) > 0 {
+		current = map[string]any{"text": streamIDs, "value": streamIDs}
+	}
+
+	return map[string]any{
+		"title":         "stream-runner",
+		"uid":           "stream-runner",
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]any{"from": "now-6h", "to": "now"},
+		"tags":          []string{"stream-runner"},
+		"annotations": map[string]any{
+			"list": []map[string]any{
+				grafanaAnnotation("Restarts", "orange", "changes(stream_runner_stream_restarts_total"+selector+"[2m]) > 0", "restart"),
+				grafanaAnnotation("Stream events", "red", "increase(stream_runner_stream_events_total"+selector+"[2m]) > 0", "event"),
+			},
+		},
+		"templating": map[string]any{
+			"list": []map[string]any{
+				{
+					"name":  "datasource",
+					"type":  "datasource",
+					"query": "prometheus",
+				},
+				{
+					"name":       "instance",
+					"type":       "query",
+					"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+					"query":      "label_values(stream_runner_streams, instance)",
+					"refresh":    2,
+					"multi":      true,
+					"includeAll": true,
+				},
+				{
+					"name":       "stream_id",
+					"type":       "query",
+					"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+					"query":      `label_values(stream_runner_stream_up{instance=~"$instance"}, stream_id)`,
+					"refresh":    2,
+					"multi":      true,
+					"includeAll": true,
+					"current":    current,
+				},
+			},
+		},
+		"panels": panels,
+	}
+}
+
+// writeGrafanaDashboard 将仪表盘定义以 JSON 格式写入 w。
+func writeGrafanaDashboard(w io.Writer, streamIDs []string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buildGrafanaDashboard(streamIDs))
+}
+
+// runGrafanaDashboard 实现 grafana-dashboard 子命令，根据配置文件中的流输出仪表盘 JSON。
+func runGrafanaDashboard(args []string) int {
+	fs := flag.NewFlagSet("grafana-dashboard", flag.ContinueOnError)
+	configPath := fs.String("config", paths.Config, T("flag.config"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var ids []string
+	if cfg, err := loadConfig(*configPath); err == nil {
+		for _, s := range cfg.Streams {
+			ids = append(ids, s.ID)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "WARNING: %v, generating dashboard without stream defaults\n", err)
+	}
+
+	if err := writeGrafanaDashboard(os.Stdout, ids); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	return 0
+}
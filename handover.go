@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultHandoverHealthyFor 是接替的流需要在其他节点上持续运行的默认时长。
+	DefaultHandoverHealthyFor = 30 * time.Second
+	// DefaultHandoverTimeout 是等待接替的默认最长时间。
+	DefaultHandoverTimeout = 10 * time.Minute
+)
+
+// HandoverConfig 表示重载删除流时的交接：流迁移到其他节点时，本机的流先不停止，
+// 等其他节点上的同名流稳定运行后再停止，避免迁移期间断流。节点状态来自 fleet 汇总。
+type HandoverConfig struct {
+	// Node 是本机在 fleet.nodes 中的名称，默认取主机名。本机上报的状态不算作接替。
+	Node string `yaml:"node,omitempty"`
+	// HealthyFor 是其他节点上的同名流需要持续运行的时长，默认 30s。
+	HealthyFor time.Duration `yaml:"healthy_for,omitempty"`
+	// Timeout 是等待接替的最长时间，超时后照常停止并发出事件，默认 10m。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// validate 校验交接配置，交接依赖 fleet 汇总其他节点的状态。
+func (c *HandoverConfig) validate(fleet *FleetConfig) error {
+	if fleet == nil {
+		return fmt.Errorf("fleet is required")
+	}
+	if c.HealthyFor < 0 || c.Timeout < 0 {
+		return fmt.Errorf("healthy_for and timeout must not be negative")
+	}
+	o := c.withDefaults()
+	if o.Timeout <= o.HealthyFor {
+		return fmt.Errorf("timeout must be longer than healthy_for")
+	}
+	return nil
+}
+
+// withDefaults 返回填充了默认值的副本。
+func (c HandoverConfig) withDefaults() HandoverConfig {
+	if c.Node == "" {
+		if host, err := os.Hostname(); err == nil {
+			c.Node = host
+		}
+	}
+	if c.HealthyFor == 0 {
+		c.HealthyFor = DefaultHandoverHealthyFor
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultHandoverTimeout
+	}
+	return c
+}
+
+// pendingHandover 是一路已从配置中删除、正在等待接替的流。
+type pendingHandover struct {
+	// deadline 是停止等待的时间。
+	deadline time.Time
+	// node 是最近看到同名流在运行的其他节点。
+	node string
+	// healthySince 是同名流在其他节点上开始连续运行的时间，未运行时为零值。
+	healthySince time.Time
+}
+
+// deferRemoval 判断已从配置中删除的流是否需要等待接替后再停止，需要时登记并返回 true。
+// 调用方需持有 state.mu 写锁。
+func deferRemoval(state *AppState, cfg *Config, id string, now time.Time) bool {
+	if _, ok := state.handovers[id]; ok {
+		return true
+	}
+	if cfg.Handover == nil {
+		return false
+	}
+	if _, temporary := state.temporary[id]; temporary {
+		return false
+	}
+	c := cfg.Handover.withDefaults()
+	if state.handovers == nil {
+		state.handovers = make(map[string]*pendingHandover)
+	}
+	state.handovers[id] = &pendingHandover{deadline: now.Add(c.Timeout)}
+	slog.Info("stream removed from config, waiting for handover before stopping", "stream_id", id, "timeout", c.Timeout)
+	return true
+}
+
+// cancelHandover 在流重新出现在配置中时取消等待，流继续运行。调用方需持有 state.mu 写锁。
+func cancelHandover(state *AppState, id string) {
+	if _, ok := state.handovers[id]; ok {
+		delete(state.handovers, id)
+		slog.Info("stream is back in config, handover cancelled", "stream_id", id)
+	}
+}
+
+// runningElsewhere 返回 fleet 中除 self 外正在运行 id 的在线节点。
+func runningElsewhere(status fleetStatus, id, self string) (string, bool) {
+	for _, n := range status.Nodes {
+		if n.Name == self || !n.Up {
+			continue
+		}
+		for _, s := range n.Streams {
+			if s.ID == id && s.Running {
+				return n.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkHandovers 检查等待接替的流，同名流已在其他节点上持续运行 healthy_for 或等待超时时停止本机的流。
+// 配置中已没有 handover 时立即停止。
+func checkHandovers(state *AppState, now time.Time) {
+	var status fleetStatus
+	if m := fleet.Load(); m != nil {
+		status = m.snapshot()
+	}
+
+	state.mu.Lock()
+	var c HandoverConfig
+	configured := state.config != nil && state.config.Handover != nil
+	if configured {
+		c = state.config.Handover.withDefaults()
+	}
+	var stopping []*StreamWorker
+	for id, p := range state.handovers {
+		if node, ok := runningElsewhere(status, id, c.Node); ok {
+			if p.healthySince.IsZero() || p.node != node {
+				p.healthySince, p.node = now, node
+			}
+		} else {
+			p.healthySince = time.Time{}
+		}
+		switch {
+		case !configured:
+			slog.Info("handover disabled, stopping removed stream", "stream_id", id)
+		case !p.healthySince.IsZero() && now.Sub(p.healthySince) >= c.HealthyFor:
+			slog.Info("stream handed over, stopping", "stream_id", id, "node", p.node)
+		case !now.Before(p.deadline):
+			slog.Warn("handover timed out, stopping removed stream", "stream_id", id, "timeout", c.Timeout)
+			emitEvent(id, "handover_timeout", c.Timeout)
+		default:
+			continue
+		}
+		delete(state.handovers, id)
+		if w, ok := state.workers.remove(id); ok {
+			forgetEvents(id)
+			stopping = append(stopping, w)
+		}
+	}
+	state.mu.Unlock()
+
+	// Stopping may wait for stop_timeout, so it runs outside state.mu.
+	for _, w := range stopping {
+		if err := w.shutdown(); err != nil {
+			slog.Error("failed to stop worker", "stream_id", w.config().ID, "error", err)
+		}
+	}
+}
+
+// runHandovers 每秒检查一次等待接替的流。
+func runHandovers(state *AppState) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		checkHandovers(state, now)
+	}
+}
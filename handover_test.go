@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"stream-runner/client"
+)
+
+// TestCheckHandovers 测试删除的流在其他节点持续运行 healthy_for 后才停止，本机上报的状态不算接替
+func TestCheckHandovers(t *testing.T) {
+	cfg := &Config{
+		Fleet:    &FleetConfig{Nodes: []FleetNode{{Name: "edge-1", URL: "http://edge-1:9310"}, {Name: "edge-2", URL: "http://edge-2:9310"}}},
+		Handover: &HandoverConfig{Node: "edge-1", HealthyFor: 30 * time.Second, Timeout: time.Hour},
+	}
+	state := &AppState{config: cfg, workers: newWorkerMap(map[string]*StreamWorker{"a": {cfg: StreamConfig{ID: "a"}}})}
+	m := newFleetMonitor(state)
+	prev := fleet.Swap(m)
+	defer fleet.Store(prev)
+
+	now := time.Now()
+	state.mu.Lock()
+	if !deferRemoval(state, cfg, "a", now) {
+		t.Fatal("removal not deferred")
+	}
+	state.mu.Unlock()
+
+	setNodes := func(node string) {
+		m.mu.Lock()
+		m.nodes = map[string]fleetNodeStatus{node: {Name: node, Up: true, Streams: []client.InventoryStream{{ID: "a", Running: true}}}}
+		m.mu.Unlock()
+	}
+	setNodes("edge-1")
+	checkHandovers(state, now.Add(time.Minute))
+	if _, ok := state.workers.get("a"); !ok {
+		t.Fatal("stream stopped while only running on this node")
+	}
+
+	setNodes("edge-2")
+	checkHandovers(state, now.Add(2*time.Minute))
+	checkHandovers(state, now.Add(2*time.Minute+10*time.Second))
+	if _, ok := state.workers.get("a"); !ok {
+		t.Fatal("stream stopped before replacement was healthy for long enough")
+	}
+	checkHandovers(state, now.Add(2*time.Minute+30*time.Second))
+	if _, ok := state.workers.get("a"); ok {
+		t.Error("stream not stopped after handover")
+	}
+	if len(state.handovers) != 0 {
+		t.Error("handover not cleared")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log/slog"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// startTimeout 返回流生效的启动超时时间，流未设置时取 settings.start_timeout。
+func startTimeout(cfg StreamConfig) time.Duration {
+	if cfg.StartTimeout > 0 {
+		return cfg.StartTimeout
+	}
+	return currentSettings().StartTimeout
+}
+
+// watchStart 在 ffmpeg 启动 timeout 后检查输出是否开始前进，没有前进时视为卡住，
+// 终止整个进程组并把 hung 置为 true。有些目标接受 TCP 连接却不完成 RTMP 握手，ffmpeg 会一直阻塞。
+// 返回的定时器需要在 ffmpeg 退出后停止。
+func (w *StreamWorker) watchStart(cmd *exec.Cmd, timeout time.Duration, hung *atomic.Bool) *time.Timer {
+	return time.AfterFunc(timeout, func() {
+		w.mu.Lock()
+		id := w.cfg.ID
+		stuck := w.cmd == cmd && w.running && !w.stats.advanced()
+		w.mu.Unlock()
+		if !stuck {
+			return
+		}
+		hung.Store(true)
+		slog.Warn("ffmpeg produced no output after start, killing", "stream_id", id, "timeout", timeout)
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			slog.Warn("failed to kill hung ffmpeg", "stream_id", id, "error", err)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestWatchStart 测试启动后没有输出的 ffmpeg 会被终止，已有输出的不受影响
+func TestWatchStart(t *testing.T) {
+	for _, progressed := range []bool{false, true} {
+		cmd := exec.Command("sleep", "10")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := cmd.Start(); err != nil {
+			t.Skipf("cannot start sleep: %v", err)
+		}
+		w := &StreamWorker{cfg: StreamConfig{ID: "a"}, running: true, cmd: cmd}
+		now := time.Now()
+		w.stats.recordStart(now)
+		if progressed {
+			w.stats.recordProgress(ffmpegProgress{TotalSize: 1024}, now.Add(time.Millisecond))
+		}
+		var hung atomic.Bool
+		timer := w.watchStart(cmd, 50*time.Millisecond, &hung)
+		time.Sleep(200 * time.Millisecond)
+		timer.Stop()
+		if hung.Load() == progressed {
+			t.Errorf("progressed=%v: unexpected hung=%v", progressed, hung.Load())
+		}
+		if progressed {
+			_ = cmd.Process.Kill()
+		}
+		_ = cmd.Wait()
+	}
+}
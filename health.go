@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// 健康分的组成因素。
+const (
+	// HealthFactorRestarts 是 restart_window 内的重启次数。
+	HealthFactorRestarts = "restarts"
+	// HealthFactorBitrate 是输出码率的波动（变异系数）。
+	HealthFactorBitrate = "bitrate"
+	// HealthFactorProbe 是最近一次读取源流是否失败。
+	HealthFactorProbe = "probe"
+	// HealthFactorDrift 是最近一次测得的音画偏差。
+	HealthFactorDrift = "drift"
+)
+
+const (
+	// DefaultHealthRestartWindow 是统计重启次数的默认时间窗口。
+	DefaultHealthRestartWindow = time.Hour
+	// DefaultHealthMaxRestarts 是窗口内视为完全不健康的默认重启次数。
+	DefaultHealthMaxRestarts = 6
+	// DefaultHealthMaxBitrateVariation 是视为完全不健康的默认码率变异系数。
+	DefaultHealthMaxBitrateVariation = 0.5
+	// DefaultHealthMaxDrift 是视为完全不健康的默认音画偏差。
+	DefaultHealthMaxDrift = 500 * time.Millisecond
+)
+
+// defaultHealthWeights 是各因素的默认权重。
+var defaultHealthWeights = map[string]float64{
+	HealthFactorRestarts: 0.4,
+	HealthFactorBitrate:  0.2,
+	HealthFactorProbe:    0.2,
+	HealthFactorDrift:    0.2,
+}
+
+// HealthScoreConfig 表示流健康分的计算方式。健康分为 0~100，越高越健康：
+// 每个因素按上限折算为 0~1 的扣分，按权重加权平均后从 100 中扣除；ffmpeg 未运行时为 0。
+type HealthScoreConfig struct {
+	// Weights 是各因素的权重：restarts、bitrate、probe、drift，未列出的因素使用默认权重，设为 0 表示不计入。
+	Weights map[string]float64 `yaml:"weights,omitempty"`
+	// RestartWindow 是统计重启次数的时间窗口，默认 1h。
+	RestartWindow time.Duration `yaml:"restart_window,omitempty"`
+	// MaxRestarts 是窗口内扣满分的重启次数，默认 6。
+	MaxRestarts int `yaml:"max_restarts,omitempty"`
+	// MaxBitrateVariation 是扣满分的码率变异系数（标准差/均值），默认 0.5。
+	MaxBitrateVariation float64 `yaml:"max_bitrate_variation,omitempty"`
+	// MaxDrift 是扣满分的音画偏差，默认 500ms。
+	MaxDrift time.Duration `yaml:"max_drift,omitempty"`
+}
+
+// healthScoring 是当前生效的健康分配置，在配置重载时替换，为空时使用默认值。
+var healthScoring atomic.Pointer[HealthScoreConfig]
+
+// validate 校验健康分配置。
+func (c *HealthScoreConfig) validate() error {
+	for name, w := range c.Weights {
+		if _, ok := defaultHealthWeights[name]; !ok {
+			return fmt.Errorf("unknown weight %q, expected restarts, bitrate, probe or drift", name)
+		}
+		if w < 0 {
+			return fmt.Errorf("weight %s must not be negative", name)
+		}
+	}
+	if total := c.withDefaults().totalWeight(); total == 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+	if c.RestartWindow < 0 || c.MaxDrift < 0 || c.MaxBitrateVariation < 0 {
+		return fmt.Errorf("restart_window, max_bitrate_variation and max_drift must not be negative")
+	}
+	if c.MaxRestarts < 0 || c.MaxRestarts > streamHistorySize/2 {
+		return fmt.Errorf("max_restarts must be between 1 and %d", streamHistorySize/2)
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c HealthScoreConfig) withDefaults() HealthScoreConfig {
+	weights := make(map[string]float64, len(defaultHealthWeights))
+	for name, w := range defaultHealthWeights {
+		weights[name] = w
+	}
+	for name, w := range c.Weights {
+		weights[name] = w
+	}
+	c.Weights = weights
+	if c.RestartWindow == 0 {
+		c.RestartWindow = DefaultHealthRestartWindow
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = DefaultHealthMaxRestarts
+	}
+	if c.MaxBitrateVariation == 0 {
+		c.MaxBitrateVariation = DefaultHealthMaxBitrateVariation
+	}
+	if c.MaxDrift == 0 {
+		c.MaxDrift = DefaultHealthMaxDrift
+	}
+	return c
+}
+
+// totalWeight 返回权重之和。
+func (c HealthScoreConfig) totalWeight() float64 {
+	var total float64
+	for _, w := range c.Weights {
+		total += w
+	}
+	return total
+}
+
+// currentHealthScoring 返回生效的健康分配置。
+func currentHealthScoring() HealthScoreConfig {
+	if c := healthScoring.Load(); c != nil {
+		return c.withDefaults()
+	}
+	return HealthScoreConfig{}.withDefaults()
+}
+
+// bitrateVariation 返回码率采样的变异系数，采样不足 3 个或均值为 0 时返回 0。
+func bitrateVariation(samples []float64) float64 {
+	if len(samples) < 3 {
+		return 0
+	}
+	var sum float64
+	for _, v := range samples {
+		sum += v
+	}
+	mean := sum / float64(len(samples))
+	if mean == 0 {
+		return 0
+	}
+	var sq float64
+	for _, v := range samples {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq/float64(len(samples))) / mean
+}
+
+// healthPenalties 返回各因素 0~1 的扣分。
+func healthPenalties(c HealthScoreConfig, stats streamStats, history []historyEntry, now time.Time) map[string]float64 {
+	restarts := 0
+	for _, h := range history {
+		if h.Event == "exit" && now.Sub(h.Time) <= c.RestartWindow {
+			restarts++
+		}
+	}
+	drift := stats.AVDrift
+	if drift < 0 {
+		drift = -drift
+	}
+	penalties := map[string]float64{
+		HealthFactorRestarts: math.Min(float64(restarts)/float64(c.MaxRestarts), 1),
+		HealthFactorBitrate:  math.Min(bitrateVariation(stats.Bitrates)/c.MaxBitrateVariation, 1),
+	}
+	if stats.ProbeFailed {
+		penalties[HealthFactorProbe] = 1
+	}
+	if stats.AVDriftMeasured {
+		penalties[HealthFactorDrift] = math.Min(float64(drift)/float64(c.MaxDrift), 1)
+	}
+	return penalties
+}
+
+// healthScore 计算流的健康分，保留一位小数。ffmpeg 未运行时为 0，等待节目开始的流为 100。
+func (w *StreamWorker) healthScore(now time.Time) float64 {
+	c := currentHealthScoring()
+	w.mu.Lock()
+	running, offSchedule := w.running, w.offSchedule
+	stats := w.stats.snapshot(now)
+	history := append([]historyEntry(nil), w.history...)
+	w.mu.Unlock()
+	switch {
+	case offSchedule:
+		return 100
+	case !running:
+		return 0
+	}
+	var penalty float64
+	for name, p := range healthPenalties(c, stats, history, now) {
+		penalty += c.Weights[name] * p
+	}
+	return math.Round(1000*(1-penalty/c.totalWeight())) / 10
+}
+
+// recordProbe 记录一次读取源流的结果。
+func (w *StreamWorker) recordProbe(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.ProbeFailed = err != nil
+}
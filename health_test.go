@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBitrateSamples 测试按采样间隔记录输出码率，并计算变异系数
+func TestBitrateSamples(t *testing.T) {
+	var s streamStats
+	start := time.Now()
+	s.recordStart(start)
+	// 1000 kbit/s for 15s, sampled every 5s; progress in between is ignored.
+	for i := 1; i <= 6; i++ {
+		now := start.Add(time.Duration(i) * 2500 * time.Millisecond)
+		s.recordProgress(ffmpegProgress{TotalSize: int64(i) * 2500 * 1000 / 8}, now)
+	}
+	if len(s.Bitrates) != 3 {
+		t.Fatalf("samples = %v, want 3", s.Bitrates)
+	}
+	for _, v := range s.Bitrates {
+		if v < 999 || v > 1001 {
+			t.Errorf("sample = %v, want 1000", v)
+		}
+	}
+	if cv := bitrateVariation(s.Bitrates); cv > 0.001 {
+		t.Errorf("variation of a steady bitrate = %v", cv)
+	}
+	if cv := bitrateVariation([]float64{500, 1500, 500, 1500}); cv < 0.49 || cv > 0.51 {
+		t.Errorf("variation = %v, want 0.5", cv)
+	}
+}
+
+// TestHealthScore 测试健康分按权重扣分，未运行时为 0
+func TestHealthScore(t *testing.T) {
+	now := time.Now()
+	w := &StreamWorker{cfg: StreamConfig{ID: "a"}}
+	if got := w.healthScore(now); got != 0 {
+		t.Errorf("stopped stream score = %v, want 0", got)
+	}
+
+	w.stats.recordStart(now.Add(-time.Minute))
+	w.running = true
+	if got := w.healthScore(now); got != 100 {
+		t.Errorf("healthy stream score = %v, want 100", got)
+	}
+
+	// 3 of 6 restarts (0.4 * 0.5) and a failed probe (0.2) cost 40 points.
+	for i := 0; i < 3; i++ {
+		w.recordHistory("exit", "exit status 1", now.Add(-time.Duration(i)*time.Minute))
+	}
+	w.recordHistory("exit", "long ago", now.Add(-2*time.Hour))
+	w.recordProbe(errTestProbe)
+	if got := w.healthScore(now); got != 60 {
+		t.Errorf("score = %v, want 60", got)
+	}
+
+	// Only restarts count once the other weights are zero.
+	prev := healthScoring.Swap(&HealthScoreConfig{Weights: map[string]float64{"bitrate": 0, "probe": 0, "drift": 0}})
+	defer healthScoring.Store(prev)
+	if got := w.healthScore(now); got != 50 {
+		t.Errorf("restart-only score = %v, want 50", got)
+	}
+
+	for _, c := range []HealthScoreConfig{
+		{Weights: map[string]float64{"latency": 1}},
+		{Weights: map[string]float64{"restarts": 0, "bitrate": 0, "probe": 0, "drift": 0}},
+		{MaxRestarts: streamHistorySize},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v: expected error", c)
+		}
+	}
+}
+
+// errTestProbe 是测试用的探测错误。
+var errTestProbe = errorString("probe failed")
+
+// errorString 是测试用的简单错误类型。
+type errorString string
+
+func (e errorString) Error() string { return string(e) }
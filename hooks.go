@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultHookTimeout 是钩子命令的默认超时时间。
+	DefaultHookTimeout = 30 * time.Second
+	// DefaultHookMaxOutput 是钩子输出写入日志的默认最大字节数。
+	DefaultHookMaxOutput = 4096
+)
+
+// defaultHookEnv 是未配置环境变量白名单时传给钩子的变量。
+var defaultHookEnv = []string{"PATH", "LANG", "TZ"}
+
+// HookPolicy 表示执行外部钩子命令的安全策略，对所有钩子生效。
+type HookPolicy struct {
+	// User 是运行钩子的系统用户，为空时使用守护进程的用户。
+	User string `yaml:"user,omitempty"`
+	// Timeout 是单次钩子的超时时间，超时后终止整个进程组，默认 30s。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Env 是允许从守护进程继承的环境变量白名单，默认只有 PATH、LANG、TZ。
+	Env []string `yaml:"env,omitempty"`
+	// MaxOutput 是捕获到日志中的最大输出字节数，默认 4096。
+	MaxOutput int `yaml:"max_output,omitempty"`
+}
+
+// StreamHooks 表示流生命周期钩子，每个钩子是一条命令及其参数（不经过 shell）。
+type StreamHooks struct {
+	// OnStart 在 ffmpeg 启动成功后执行。
+	OnStart []string `yaml:"on_start,omitempty"`
+	// OnExit 在 ffmpeg 退出后执行。
+	OnExit []string `yaml:"on_exit,omitempty"`
+}
+
+// hookPolicy 是当前生效的钩子策略，在配置重载时替换。
+var hookPolicy atomic.Pointer[HookPolicy]
+
+// validate 校验钩子策略。
+func (p *HookPolicy) validate() error {
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if p.MaxOutput < 0 {
+		return fmt.Errorf("max_output must not be negative")
+	}
+	if p.User != "" {
+		if _, err := user.Lookup(p.User); err != nil {
+			return fmt.Errorf("user %s: %w", p.User, err)
+		}
+	}
+	return nil
+}
+
+// limitedBuffer 是只保留前 limit 字节的缓冲区。
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write 实现 io.Writer 接口，超出上限的数据被丢弃但不报错，避免阻塞子进程。
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// hookResult 是一次钩子执行的结果。
+type hookResult struct {
+	exitCode int
+	output   string
+	err      error
+	duration time.Duration
+}
+
+// runHook 按策略执行一条钩子命令。
+// 环境变量只包含白名单中的变量和 vars，输出合并 stdout/stderr 并按上限截断。
+func runHook(policy *HookPolicy, argv []string, vars map[string]string) hookResult {
+	if policy == nil {
+		policy = &HookPolicy{}
+	}
+	timeout := policy.Timeout
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	maxOutput := policy.MaxOutput
+	if maxOutput == 0 {
+		maxOutput = DefaultHookMaxOutput
+	}
+	allowed := policy.Env
+	if len(allowed) == 0 {
+		allowed = defaultHookEnv
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = hookEnv(allowed, vars)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// Kill the whole process group so forked children don't outlive the timeout.
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	if policy.User != "" {
+		cred, err := lookupCredential(policy.User)
+		if err != nil {
+			return hookResult{exitCode: -1, err: err}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	out := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	start := time.Now()
+	err := cmd.Run()
+	res := hookResult{exitCode: 0, output: out.buf.String(), duration: time.Since(start)}
+	if out.truncated {
+		res.output += "...(truncated)"
+	}
+	if err != nil {
+		res.err = err
+		res.exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.exitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			res.err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if policy.User != "" {
+			res.err = withPermissionHint(res.err, "running hooks as another user requires root or CAP_SETUID/CAP_SETGID")
+		}
+	}
+	return res
+}
+
+// hookEnv 构造钩子进程的环境变量。
+func hookEnv(allowed []string, vars map[string]string) []string {
+	var env []string
+	for _, name := range allowed {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// lookupCredential 将用户名解析为进程凭据。
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("hook user %s: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("hook user %s has non-numeric uid %s", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("hook user %s has non-numeric gid %s", name, u.Gid)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// fireHook 在独立 goroutine 中执行流钩子，并将结果记录到日志。
+// 钩子不会阻塞流的启动和重启。
+func fireHook(streamID, event string, argv []string, vars map[string]string) {
+	if len(argv) == 0 {
+		return
+	}
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	vars["STREAM_ID"] = streamID
+	vars["STREAM_EVENT"] = event
+
+	policy := hookPolicy.Load()
+	go func() {
+		res := runHook(policy, argv, vars)
+		attrs := []any{
+			"stream_id", streamID,
+			"event", event,
+			"command", strings.Join(argv, " "),
+			"exit_code", res.exitCode,
+			"duration", res.duration.String(),
+			"output", res.output,
+		}
+		if res.err != nil {
+			slog.Warn("hook failed", append(attrs, "error", res.err)...)
+			return
+		}
+		slog.Info("hook finished", attrs...)
+	}()
+}
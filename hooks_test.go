@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunHookEnvAllowlist 测试钩子只继承白名单环境变量
+func TestRunHookEnvAllowlist(t *testing.T) {
+	t.Setenv("HOOK_TEST_SECRET", "s3cr3t")
+
+	policy := &HookPolicy{Env: []string{"PATH"}}
+	res := runHook(policy, []string{"sh", "-c", `echo "id=$STREAM_ID secret=$HOOK_TEST_SECRET"`},
+		map[string]string{"STREAM_ID": "stream-1"})
+	if res.err != nil {
+		t.Fatalf("runHook failed: %v", res.err)
+	}
+	if !strings.Contains(res.output, "id=stream-1") {
+		t.Errorf("expected hook vars in output, got %q", res.output)
+	}
+	if strings.Contains(res.output, "s3cr3t") {
+		t.Errorf("expected non-allowlisted env to be hidden, got %q", res.output)
+	}
+}
+
+// TestRunHookTimeout 测试钩子超时被终止
+func TestRunHookTimeout(t *testing.T) {
+	policy := &HookPolicy{Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	res := runHook(policy, []string{"sh", "-c", "sleep 10"}, nil)
+	if res.err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected hook to be killed promptly, took %s", time.Since(start))
+	}
+}
+
+// TestRunHookOutputLimit 测试钩子输出截断
+func TestRunHookOutputLimit(t *testing.T) {
+	policy := &HookPolicy{MaxOutput: 10}
+	res := runHook(policy, []string{"sh", "-c", "echo 0123456789abcdef; exit 3"}, nil)
+	if res.exitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", res.exitCode)
+	}
+	if res.output != "0123456789...(truncated)" {
+		t.Errorf("unexpected output %q", res.output)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAdaptiveDelay 是主机过载时推迟启动的默认间隔。
+	DefaultAdaptiveDelay = 10 * time.Second
+	// DefaultAdaptiveConcurrency 是主机过载时默认允许的并发启动数。
+	DefaultAdaptiveConcurrency = 1
+	// hostSampleInterval 是采样主机负载的间隔。
+	hostSampleInterval = 5 * time.Second
+)
+
+// AdaptiveRestart 表示按主机负载自适应的重启策略。
+// 任一阈值被超过时主机视为过载，此时 ffmpeg 的启动被限流，避免重启风暴压垮已经吃紧的主机。
+type AdaptiveRestart struct {
+	// MaxLoadPerCPU 是 1 分钟平均负载除以 CPU 核数的阈值（可选）。
+	MaxLoadPerCPU float64 `yaml:"max_load_per_cpu,omitempty"`
+	// MaxMemoryPercent 是内存使用率阈值，按 MemAvailable 计算（可选）。
+	MaxMemoryPercent float64 `yaml:"max_memory_percent,omitempty"`
+	// MaxNetworkMbps 是所有非回环网卡收发总速率的阈值（可选）。
+	MaxNetworkMbps float64 `yaml:"max_network_mbps,omitempty"`
+	// Delay 是过载时每个启动名额占用的时长，也是等待名额时的重试间隔，默认 10s。
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// MaxConcurrentStarts 是过载时每个 delay 内允许的启动数，默认 1。
+	MaxConcurrentStarts int `yaml:"max_concurrent_starts,omitempty"`
+}
+
+// validate 校验自适应重启配置。
+func (a *AdaptiveRestart) validate() error {
+	if a.MaxLoadPerCPU < 0 || a.MaxMemoryPercent < 0 || a.MaxNetworkMbps < 0 || a.Delay < 0 || a.MaxConcurrentStarts < 0 {
+		return fmt.Errorf("values must not be negative")
+	}
+	if a.MaxMemoryPercent > 100 {
+		return fmt.Errorf("max_memory_percent must not exceed 100")
+	}
+	if a.MaxLoadPerCPU == 0 && a.MaxMemoryPercent == 0 && a.MaxNetworkMbps == 0 {
+		return fmt.Errorf("at least one of max_load_per_cpu, max_memory_percent and max_network_mbps is required")
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (a AdaptiveRestart) withDefaults() AdaptiveRestart {
+	if a.Delay == 0 {
+		a.Delay = DefaultAdaptiveDelay
+	}
+	if a.MaxConcurrentStarts == 0 {
+		a.MaxConcurrentStarts = DefaultAdaptiveConcurrency
+	}
+	return a
+}
+
+// hostSample 是一次主机负载采样。
+type hostSample struct {
+	// load1 是 1 分钟平均负载。
+	load1 float64
+	// memoryPercent 是内存使用率。
+	memoryPercent float64
+	// netBytes 是非回环网卡累计收发字节数。
+	netBytes uint64
+}
+
+// overloaded 返回超过阈值的项，未过载时返回空串。netMbps 为负表示还没有速率数据。
+func (a *AdaptiveRestart) overloaded(s hostSample, cpus int, netMbps float64) string {
+	var out []string
+	if a.MaxLoadPerCPU > 0 && cpus > 0 && s.load1/float64(cpus) > a.MaxLoadPerCPU {
+		out = append(out, fmt.Sprintf("load %.2f/cpu > %.2f", s.load1/float64(cpus), a.MaxLoadPerCPU))
+	}
+	if a.MaxMemoryPercent > 0 && s.memoryPercent > a.MaxMemoryPercent {
+		out = append(out, fmt.Sprintf("memory %.0f%% > %.0f%%", s.memoryPercent, a.MaxMemoryPercent))
+	}
+	if a.MaxNetworkMbps > 0 && netMbps > a.MaxNetworkMbps {
+		out = append(out, fmt.Sprintf("network %.0fMbps > %.0fMbps", netMbps, a.MaxNetworkMbps))
+	}
+	return strings.Join(out, ", ")
+}
+
+// adaptiveRestart 是当前生效的自适应重启策略，未配置时为空。
+var adaptiveRestart atomic.Pointer[AdaptiveRestart]
+
+// hostOverload 是最近一次采样判定的过载原因，未过载时为空串。
+var hostOverload atomic.Value
+
+// currentHostOverload 返回当前的过载原因。
+func currentHostOverload() string {
+	reason, _ := hostOverload.Load().(string)
+	return reason
+}
+
+// startLimiter 限制主机过载期间同时占用的启动名额。
+type startLimiter struct {
+	mu       sync.Mutex
+	inFlight int
+}
+
+// startSlots 是所有工作器共享的启动名额。
+var startSlots startLimiter
+
+// tryAcquire 在占用数小于 limit 时占用一个名额。
+func (l *startLimiter) tryAcquire(limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release 归还一个名额。
+func (l *startLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+}
+
+// waitForHost 在主机过载时等待启动名额；名额在 delay 之后自动归还，使过载期间的启动按间隔错开。
+func (w *StreamWorker) waitForHost(id string) {
+	for {
+		p := adaptiveRestart.Load()
+		reason := currentHostOverload()
+		if p == nil || reason == "" {
+			return
+		}
+		policy := p.withDefaults()
+		if startSlots.tryAcquire(policy.MaxConcurrentStarts) {
+			time.AfterFunc(policy.Delay, startSlots.release)
+			return
+		}
+		slog.Info("host overloaded, delaying ffmpeg start", "stream_id", id, "reason", reason, "retry_in", policy.Delay)
+		if !w.backoff(policy.Delay) {
+			return
+		}
+	}
+}
+
+// hostMonitor 定期采样主机负载并更新过载状态。
+type hostMonitor struct {
+	prev   hostSample
+	prevAt time.Time
+}
+
+// run 每个采样周期检查一次主机负载，未配置策略时不采样。
+func (m *hostMonitor) run() {
+	ticker := time.NewTicker(hostSampleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		p := adaptiveRestart.Load()
+		if p == nil {
+			m.prevAt = time.Time{}
+			hostOverload.Store("")
+			continue
+		}
+		s, err := readHostSample()
+		if err != nil {
+			slog.Debug("failed to sample host load", "error", err)
+			continue
+		}
+		netMbps := -1.0
+		if !m.prevAt.IsZero() && s.netBytes >= m.prev.netBytes {
+			netMbps = float64(s.netBytes-m.prev.netBytes) * 8 / now.Sub(m.prevAt).Seconds() / 1e6
+		}
+		m.prev, m.prevAt = s, now
+
+		reason := p.overloaded(s, runtime.NumCPU(), netMbps)
+		switch prev := currentHostOverload(); {
+		case reason != "" && prev == "":
+			slog.Warn("host overloaded, throttling ffmpeg starts", "reason", reason)
+		case reason == "" && prev != "":
+			slog.Info("host load back to normal, ffmpeg starts no longer throttled")
+		}
+		hostOverload.Store(reason)
+	}
+}
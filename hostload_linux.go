@@ -0,0 +1,68 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readHostSample 从 /proc/loadavg、/proc/meminfo 和 /proc/net/dev 读取主机负载。
+func readHostSample() (hostSample, error) {
+	var s hostSample
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return s, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return s, fmt.Errorf("malformed /proc/loadavg")
+	}
+	if s.load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return s, fmt.Errorf("malformed /proc/loadavg: %w", err)
+	}
+
+	mem, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return s, err
+	}
+	var total, available float64
+	for _, line := range strings.Split(string(mem), "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		kb, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 64)
+		switch key {
+		case "MemTotal":
+			total = kb
+		case "MemAvailable":
+			available = kb
+		}
+	}
+	if total > 0 {
+		s.memoryPercent = (total - available) / total * 100
+	}
+
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return s, err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		// Receive bytes is the first column, transmit bytes the ninth.
+		cols := strings.Fields(counters)
+		if len(cols) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(cols[0], 10, 64)
+		tx, _ := strconv.ParseUint(cols[8], 10, 64)
+		s.netBytes += rx + tx
+	}
+	return s, scanner.Err()
+}
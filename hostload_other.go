@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readHostSample 在没有 /proc 的平台上总是返回错误，自适应重启策略不会生效。
+func readHostSample() (hostSample, error) {
+	return hostSample{}, errors.New("host load sampling is only supported on linux")
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// TestAdaptiveRestartOverloaded 测试主机过载判断和启动名额限流
+func TestAdaptiveRestartOverloaded(t *testing.T) {
+	p := &AdaptiveRestart{MaxLoadPerCPU: 1.5, MaxMemoryPercent: 90, MaxNetworkMbps: 800}
+	if err := p.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if got := p.overloaded(hostSample{load1: 4, memoryPercent: 50}, 4, -1); got != "" {
+		t.Errorf("overloaded = %q, want empty", got)
+	}
+	got := p.overloaded(hostSample{load1: 8, memoryPercent: 95}, 4, 900)
+	if want := "load 2.00/cpu > 1.50, memory 95% > 90%, network 900Mbps > 800Mbps"; got != want {
+		t.Errorf("overloaded = %q, want %q", got, want)
+	}
+	if err := (&AdaptiveRestart{Delay: 0}).validate(); err == nil {
+		t.Error("expected error without thresholds")
+	}
+
+	var l startLimiter
+	if !l.tryAcquire(1) || l.tryAcquire(1) {
+		t.Error("limit of 1 should allow exactly one slot")
+	}
+	l.release()
+	if !l.tryAcquire(1) {
+		t.Error("slot should be available after release")
+	}
+}
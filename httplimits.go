@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHTTPMaxBody 是 HTTP 请求正文的默认上限。
+	DefaultHTTPMaxBody = 1 << 20
+	// rateLimiterIdle 是客户端令牌桶在空闲多久后被清理。
+	rateLimiterIdle = 10 * time.Minute
+)
+
+// HTTPLimits 表示 HTTP 服务的限流和请求大小限制，避免失控的自动化客户端影响守护进程。修改后需重启生效。
+type HTTPLimits struct {
+	// Rate 是每个客户端每秒允许的请求数，0 表示不限制。管理接口按令牌或登录用户计数，未认证的请求按客户端地址计数。
+	Rate float64 `yaml:"rate,omitempty"`
+	// Burst 是每个客户端允许的突发请求数，默认为 Rate 向上取整（至少 1）。
+	Burst int `yaml:"burst,omitempty"`
+	// MaxBody 是请求正文的最大大小，默认 1MB。
+	MaxBody ByteSize `yaml:"max_body,omitempty"`
+	// MaxConnections 是同时保持的最大连接数，超出的连接排队等待，0 表示不限制。
+	MaxConnections int `yaml:"max_connections,omitempty"`
+}
+
+// validate 校验 HTTP 限制配置。
+func (l *HTTPLimits) validate() error {
+	if l.Rate < 0 || l.Burst < 0 || l.MaxBody < 0 || l.MaxConnections < 0 {
+		return fmt.Errorf("rate, burst, max_body and max_connections must not be negative")
+	}
+	if l.Burst > 0 && l.Rate == 0 {
+		return fmt.Errorf("burst requires rate")
+	}
+	return nil
+}
+
+// tokenBucket 是单个客户端的令牌桶。
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 是按客户端独立计数的令牌桶限流器。
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	clients map[string]*tokenBucket
+	// lastSweep 是上次清理空闲客户端的时间。
+	lastSweep time.Time
+}
+
+// newRateLimiter 创建限流器，burst 为 0 时取 rate 向上取整。
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	b := float64(burst)
+	if b == 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &rateLimiter{rate: rate, burst: b, clients: make(map[string]*tokenBucket)}
+}
+
+// allow 消耗客户端的一个令牌。令牌不足时返回 false 和下一个令牌可用前的等待时间。
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimiterIdle {
+		for k, b := range l.clients {
+			if now.Sub(b.last) > rateLimiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.clients[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientIP 返回请求的客户端地址，用作限流的键。
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withHTTPLimits 为处理器加上请求正文上限和限流，超限时返回 413 或 429。key 返回请求所属的令牌桶，如 clientIP。
+func withHTTPLimits(h http.Handler, limits *HTTPLimits, key func(*http.Request) string) http.Handler {
+	if limits == nil {
+		limits = &HTTPLimits{}
+	}
+	maxBody := int64(limits.MaxBody)
+	if maxBody == 0 {
+		maxBody = DefaultHTTPMaxBody
+	}
+	h = http.MaxBytesHandler(h, maxBody)
+	if limits.Rate == 0 {
+		return h
+	}
+	limiter := newRateLimiter(limits.Rate, limits.Burst)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.allow(key(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitListener 是最多同时保持 n 个连接的监听器，超出的连接在 Accept 中等待。
+type limitListener struct {
+	net.Listener
+	sem chan struct{}
+}
+
+// newLimitListener 包装监听器，n 为 0 时原样返回。
+func newLimitListener(ln net.Listener, n int) net.Listener {
+	if n <= 0 {
+		return ln
+	}
+	return &limitListener{Listener: ln, sem: make(chan struct{}, n)}
+}
+
+// Accept 实现 net.Listener 接口。
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.sem <- struct{}{}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// limitConn 在关闭时归还连接名额，重复关闭只归还一次。
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// Close 实现 net.Conn 接口。
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter 测试令牌桶按客户端独立计数并随时间恢复
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 0)
+	now := time.Unix(1000, 0)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d within burst was rejected", i)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("expected rejection with 500ms wait, got %v %s", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("other clients must have their own bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected a token after 500ms")
+	}
+}
+
+// TestWithHTTPLimits 测试超过限流返回 429、正文超限返回 413
+func TestWithHTTPLimits(t *testing.T) {
+	h := withHTTPLimits(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tooLarge *http.MaxBytesError
+		if _, err := io.ReadAll(r.Body); errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}), &HTTPLimits{Rate: 1, MaxBody: 16}, clientIP)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 32))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for oversized body, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+// TestAPIRateKey 测试管理接口按令牌限流：同一地址的不同令牌各自计数，同一令牌换地址仍共用额度，无效令牌按地址计数
+func TestAPIRateKey(t *testing.T) {
+	state := &AppState{config: &Config{API: &APIConfig{Listen: "127.0.0.1:0", Tokens: []APIToken{
+		{Name: "deploy", Token: "deploy-token-0123456789"},
+		{Name: "grafana", Token: "grafana-token-0123456789"},
+	}}}}
+	h := withHTTPLimits(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), &HTTPLimits{Rate: 1}, apiRateKey(state))
+	do := func(token, addr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.RemoteAddr = addr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if do("deploy-token-0123456789", "10.0.0.1:1000") != http.StatusOK || do("grafana-token-0123456789", "10.0.0.1:1000") != http.StatusOK {
+		t.Error("expected tokens behind one address to have separate limits")
+	}
+	if do("deploy-token-0123456789", "10.0.0.2:1000") != http.StatusTooManyRequests {
+		t.Error("expected one token from another address to share its limit")
+	}
+	if do("wrong-token-0123456789", "10.0.0.3:1000") != http.StatusOK || do("other-wrong-token-0000", "10.0.0.3:1000") != http.StatusTooManyRequests {
+		t.Error("expected invalid tokens to be limited by address")
+	}
+}
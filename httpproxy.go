@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCORSMethods 是未配置 methods 时允许的跨域请求方法。
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead}
+
+// CORSConfig 表示 HTTP 服务的跨域策略，用于从其他域名的页面直接调用接口。
+type CORSConfig struct {
+	// Origins 是允许的来源，如 https://ops.example.com，"*" 表示任意来源。
+	Origins []string `yaml:"origins"`
+	// Methods 是允许的请求方法，默认 GET、HEAD。
+	Methods []string `yaml:"methods,omitempty"`
+	// Headers 是允许的请求头。
+	Headers []string `yaml:"headers,omitempty"`
+	// MaxAge 是浏览器缓存预检结果的时长，0 表示使用浏览器默认值。
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+}
+
+// validate 校验跨域配置。
+func (c *CORSConfig) validate() error {
+	if len(c.Origins) == 0 {
+		return fmt.Errorf("origins is required")
+	}
+	for _, o := range c.Origins {
+		if o == "*" {
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("origin %q must be * or scheme://host[:port]", o)
+		}
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	return nil
+}
+
+// allowOrigin 返回响应中 Access-Control-Allow-Origin 的值，来源不被允许时返回空串。
+func (c *CORSConfig) allowOrigin(origin string) string {
+	for _, o := range c.Origins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withCORS 按跨域策略设置响应头，并直接应答预检请求。
+func withCORS(h http.Handler, c *CORSConfig) http.Handler {
+	methods := c.Methods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := c.allowOrigin(origin)
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// Preflight: answer here so handlers never see OPTIONS.
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(c.Headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+			}
+			if c.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// parseTrustedProxies 解析可信代理列表，每项是 IP 或 CIDR。
+func parseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// trustedIP 判断地址是否属于可信代理。
+func trustedIP(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient 返回经过可信代理转发的请求的真实客户端地址。
+// 只有直连地址是可信代理时才读取 X-Forwarded-For，并从右向左跳过可信代理，
+// 因此客户端自己伪造的 X-Forwarded-For 不会生效。
+func forwardedClient(r *http.Request, trusted []*net.IPNet) string {
+	peer := clientIP(r)
+	if !trustedIP(peer, trusted) {
+		return peer
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trustedIP(hop, trusted) || i == 0 {
+			return hop
+		}
+	}
+	return peer
+}
+
+// forwardedHost 返回离本机最近的代理在 X-Forwarded-Host 中记录的主机，没有时返回空串。
+func forwardedHost(r *http.Request) string {
+	hosts := strings.Split(strings.Join(r.Header.Values("X-Forwarded-Host"), ","), ",")
+	return strings.TrimSpace(hosts[len(hosts)-1])
+}
+
+// withTrustedProxies 将来自可信代理的请求的 RemoteAddr 改写为真实客户端地址，Host 改写为 X-Forwarded-Host，
+// 之后的限流、审计、日志和同源检查都使用改写后的值。
+func withTrustedProxies(h http.Handler, trusted []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !trustedIP(clientIP(r), trusted) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		if client := forwardedClient(r, trusted); client != clientIP(r) {
+			r2.RemoteAddr = net.JoinHostPort(client, "0")
+		}
+		if host := forwardedHost(r); host != "" {
+			r2.Host = host
+		}
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// normalizeBasePath 将路径前缀规范为以 / 开头、不以 / 结尾的形式，根路径返回空串。
+func normalizeBasePath(p string) string {
+	p = strings.TrimRight(p, "/")
+	if p != "" && !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// validateProxyOptions 校验指标服务和管理接口共用的反向代理配置：路径前缀、可信代理和跨域策略。
+func validateProxyOptions(basePath string, trustedProxies []string, cors *CORSConfig) error {
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		return fmt.Errorf("base_path must start with /")
+	}
+	if _, err := parseTrustedProxies(trustedProxies); err != nil {
+		return err
+	}
+	if cors != nil {
+		if err := cors.validate(); err != nil {
+			return fmt.Errorf("cors: %w", err)
+		}
+	}
+	return nil
+}
+
+// withProxyOptions 给 HTTP 服务的处理器加上路径前缀、可信代理、跨域和访问限制。base 已规范化，
+// rateKey 见 withHTTPLimits。可信代理最先处理，限流看到的是改写后的客户端地址。
+func withProxyOptions(h http.Handler, base string, trustedProxies []string, cors *CORSConfig, limits *HTTPLimits, rateKey func(*http.Request) string) http.Handler {
+	h = withHTTPLimits(h, limits, rateKey)
+	if cors != nil {
+		h = withCORS(h, cors)
+	}
+	// Validated on load, so parse errors cannot happen here.
+	if trusted, _ := parseTrustedProxies(trustedProxies); len(trusted) > 0 {
+		h = withTrustedProxies(h, trusted)
+	}
+	if base != "" {
+		h = http.StripPrefix(base, h)
+	}
+	return h
+}
+
+// newHTTPHandler 按指标配置组装 HTTP 服务的处理器：路径前缀、可信代理、跨域和访问限制。
+func newHTTPHandler(state *AppState, m *MetricsConfig) http.Handler {
+	if m == nil {
+		m = &MetricsConfig{}
+	}
+	base := normalizeBasePath(m.BasePath)
+	return withProxyOptions(newMetricsMux(state, base), base, m.TrustedProxies, m.CORS, m.Limits, clientIP)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestForwardedClient 测试只信任可信代理发送的 X-Forwarded-For，且忽略客户端伪造的地址
+func TestForwardedClient(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		peer, xff, want string
+	}{
+		{"203.0.113.5:1234", "1.2.3.4", "203.0.113.5"},
+		{"10.0.0.2:1234", "1.2.3.4", "1.2.3.4"},
+		{"10.0.0.2:1234", "6.6.6.6, 1.2.3.4, 192.168.1.1", "1.2.3.4"},
+		{"10.0.0.2:1234", "", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.peer
+		if c.xff != "" {
+			r.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := forwardedClient(r, trusted); got != c.want {
+			t.Errorf("peer %s xff %q: expected %s, got %s", c.peer, c.xff, c.want, got)
+		}
+	}
+}
+
+// TestNewHTTPHandler 测试路径前缀和跨域预检
+func TestNewHTTPHandler(t *testing.T) {
+	state := &AppState{workers: newWorkerMap(nil)}
+	h := newHTTPHandler(state, &MetricsConfig{
+		BasePath: "/stream-runner/",
+		CORS:     &CORSConfig{Origins: []string{"https://ops.example.com"}, MaxAge: 10 * time.Minute},
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream-runner/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected /version under the base path, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 outside the base path, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, "/stream-runner/logs", nil)
+	req.Header.Set("Origin", "https://ops.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://ops.example.com" ||
+		rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight response %d %v", rec.Code, rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stream-runner/version", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("unexpected CORS header for a disallowed origin")
+	}
+}
+
+// TestAPIBehindProxy 测试管理接口在反向代理后使用路径前缀，并按可信代理转发的客户端地址和主机处理请求
+func TestAPIBehindProxy(t *testing.T) {
+	api := &APIConfig{
+		Listen: "127.0.0.1:0", Token: "0123456789abcdef",
+		BasePath: "/stream-runner", TrustedProxies: []string{"10.0.0.0/8"},
+	}
+	if err := api.validate(); err != nil {
+		t.Fatal(err)
+	}
+	state := &AppState{config: &Config{API: api}, workers: newWorkerMap(nil)}
+	h := withProxyOptions(newAPIHandler(state, "/stream-runner"), "/stream-runner", api.TrustedProxies, nil, nil, apiRateKey(state))
+	for path, want := range map[string]int{
+		"/stream-runner/ui/":    http.StatusOK,
+		"/stream-runner/status": http.StatusOK,
+		"/status":               http.StatusNotFound,
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer 0123456789abcdef")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("GET %s: got %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	var seen *http.Request
+	trusted, _ := parseTrustedProxies(api.TrustedProxies)
+	capture := withTrustedProxies(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { seen = r }), trusted)
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.RemoteAddr, req.Host = "10.0.0.2:1234", "127.0.0.1:9311"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+	req.Header.Set("X-Forwarded-Host", "runner.example.com")
+	capture.ServeHTTP(httptest.NewRecorder(), req)
+	if clientIP(seen) != "203.0.113.5" || !allowEventsOrigin(seen, "https://runner.example.com") {
+		t.Errorf("expected the forwarded client and host, got %s %s", seen.RemoteAddr, seen.Host)
+	}
+	// Headers from untrusted peers are ignored.
+	req.RemoteAddr = "203.0.113.9:1234"
+	capture.ServeHTTP(httptest.NewRecorder(), req)
+	if clientIP(seen) != "203.0.113.9" || allowEventsOrigin(seen, "https://runner.example.com") {
+		t.Errorf("expected forwarded headers from an untrusted peer to be ignored, got %s %s", seen.RemoteAddr, seen.Host)
+	}
+
+	api.OIDC = &OIDCConfig{
+		Issuer: "https://idp.example.com", ClientID: "runner",
+		RedirectURL: "https://runner.example.com/auth/callback",
+		Roles:       map[string]string{"noc": APIRoleOperator},
+	}
+	if err := api.validate(); err == nil {
+		t.Error("expected redirect_url outside the base path to be rejected")
+	}
+	api.OIDC.RedirectURL = "https://runner.example.com/stream-runner/auth/callback"
+	if err := api.validate(); err != nil {
+		t.Errorf("redirect_url under the base path: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TLSConfig 表示 HTTP 服务的 TLS 配置。修改后需重启生效；证书和私钥文件被替换（如证书续期）时自动重新加载，不需要重启。
+type TLSConfig struct {
+	// CertFile 是 PEM 格式的证书（可含中间证书链）路径。
+	CertFile string `yaml:"cert_file"`
+	// KeyFile 是 PEM 格式的私钥路径。
+	KeyFile string `yaml:"key_file"`
+	// ClientCA 是校验客户端证书的 CA 证书路径（可选）。配置后客户端必须出示由该 CA 签发的证书。
+	ClientCA string `yaml:"client_ca,omitempty"`
+}
+
+// validate 校验 TLS 配置，并确认证书和私钥能够加载。
+func (c *TLSConfig) validate() error {
+	for name, p := range map[string]string{"cert_file": c.CertFile, "key_file": c.KeyFile} {
+		if p == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+	for name, p := range map[string]string{"cert_file": c.CertFile, "key_file": c.KeyFile, "client_ca": c.ClientCA} {
+		if p != "" && !filepath.IsAbs(p) {
+			return fmt.Errorf("%s must be an absolute path", name)
+		}
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	if c.ClientCA != "" {
+		if _, err := loadCertPool(c.ClientCA); err != nil {
+			return fmt.Errorf("client_ca: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadCertPool 读取 PEM 格式的 CA 证书。
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// serverConfig 返回 HTTP 服务使用的 tls.Config。
+func (c *TLSConfig) serverConfig() (*tls.Config, error) {
+	certs := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if _, err := certs.load(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.load()
+		},
+	}
+	if c.ClientCA != "" {
+		pool, err := loadCertPool(c.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// certReloaderInterval 是检查证书文件是否被替换的最短间隔。
+const certReloaderInterval = 10 * time.Second
+
+// certReloader 缓存证书，证书或私钥文件的修改时间变化后重新加载。加载失败时继续使用之前的证书。
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// load 返回当前证书，距上次检查超过 certReloaderInterval 时检查文件是否变化。
+func (r *certReloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := currentClock().Now()
+	if r.cert != nil && now.Sub(r.checked) < certReloaderInterval {
+		return r.cert, nil
+	}
+	r.checked = now
+	var modTime time.Time
+	for _, p := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(p)
+		if err != nil {
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Probably caught between writing the certificate and the key; retry on the next check.
+			slog.Warn("failed to reload tls certificate, keeping the previous one", "cert_file", r.certFile, "error", err)
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	if r.cert != nil {
+		slog.Info("tls certificate reloaded", "cert_file", r.certFile)
+	}
+	r.cert, r.modTime = &cert, modTime
+	return r.cert, nil
+}
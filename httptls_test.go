@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成 127.0.0.1 的自签名证书，写入 certFile 和 keyFile，返回证书。
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "stream-runner"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// TestTLSConfig 测试 TLS 配置校验，以及证书文件被替换后新的连接使用新证书
+func TestTLSConfig(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	defer setClock(clock)()
+	dir := t.TempDir()
+	c := &TLSConfig{CertFile: filepath.Join(dir, "api.crt"), KeyFile: filepath.Join(dir, "api.key")}
+	if err := c.validate(); err == nil {
+		t.Error("accepted missing certificate files")
+	}
+	first := writeTestCert(t, c.CertFile, c.KeyFile, 1)
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&TLSConfig{CertFile: "api.crt", KeyFile: c.KeyFile}).validate(); err == nil {
+		t.Error("accepted a relative cert_file")
+	}
+
+	cfg, err := c.serverConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), TLSConfig: cfg}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+	serial := func() int64 {
+		t.Helper()
+		// A fresh connection each time so the certificate is fetched again.
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		resp, err := client.Get("https://" + ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != first.SerialNumber.Int64() {
+		t.Fatalf("serial = %d", got)
+	}
+
+	// Renewed certificate files are picked up after the check interval.
+	writeTestCert(t, c.CertFile, c.KeyFile, 2)
+	later := time.Now().Add(time.Minute)
+	for _, p := range []string{c.CertFile, c.KeyFile} {
+		if err := os.Chtimes(p, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := serial(); got != 1 {
+		t.Errorf("serial before the check interval = %d", got)
+	}
+	clock.advance(certReloaderInterval)
+	if got := serial(); got != 2 {
+		t.Errorf("serial after renewal = %d", got)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// LocaleZH 表示简体中文。
+	LocaleZH = "zh-CN"
+	// LocaleEN 表示英文。
+	LocaleEN = "en"
+)
+
+// catalog 是所有面向用户的文案，key 为消息 ID，值为各语言的 fmt 格式串。
+// 新增文案时两种语言都必须提供；日志消息保持英文，不放在这里。
+var catalog = map[string]map[string]string{
+	// CLI usage.
+	"usage.header": {
+		LocaleZH: "用法: stream-runner [--env 环境[,环境...]] | stream-runner [子命令]\n\n不带子命令时以守护进程模式运行。\n\n子命令:",
+		LocaleEN: "Usage: stream-runner [--env name[,name...]] | stream-runner [command]\n\nRun without command to start the daemon.\n\nCommands:",
+	},
+	"purge.confirm": {
+		LocaleZH: "此操作将永久删除流 %q 的所有日志记录、录制文件、报表记录和配置备份中的条目。\n请输入流 ID 确认: ",
+		LocaleEN: "This permanently deletes all log records, recordings, report records and config backup entries of stream %q.\nType the stream ID to confirm: ",
+	},
+	"purge.aborted": {LocaleZH: "已取消", LocaleEN: "aborted"},
+	"purge.offline": {LocaleZH: "守护进程未运行，直接清除本机文件", LocaleEN: "daemon is not running, purging files directly"},
+	"purge.done": {
+		LocaleZH: "已清除流 %s：%d 条日志记录，%d 条缓冲日志，%d 个录制文件，%d 条报表记录，%d 个任务\n",
+		LocaleEN: "purged stream %s: %d log records, %d buffered log records, %d recordings, %d report records, %d jobs\n",
+	},
+	"purge.deleted":      {LocaleZH: "  已删除 %s\n", LocaleEN: "  deleted %s\n"},
+	"purge.removed_from": {LocaleZH: "  已从 %s 中删除\n", LocaleEN: "  removed from %s\n"},
+	"purge.note":         {LocaleZH: "注意：%s\n", LocaleEN: "note: %s\n"},
+	"purge.note.still_configured": {
+		LocaleZH: "流仍在配置中，删除该流后配置文件中才不再含有它的地址",
+		LocaleEN: "the stream is still configured, remove it to delete its addresses from the config file",
+	},
+	"purge.note.not_configured": {
+		LocaleZH: "流不在配置中，也没有它的录制位置记录，未删除录制文件",
+		LocaleEN: "the stream is not in the config and no recording locations are known for it, no recordings were deleted",
+	},
+	"purge.note.stdout_not_covered": {
+		LocaleZH: "输出到 stdout/stderr 的 ffmpeg 日志（如 journald）不在清除范围内",
+		LocaleEN: "ffmpeg output sent to stdout/stderr (e.g. journald) is not covered",
+	},
+	"purge.no_config":    {LocaleZH: "警告：%v，无法定位录制文件和报表\n", LocaleEN: "WARNING: %v, recordings and reports cannot be located\n"},
+	"purge.audit_failed": {LocaleZH: "警告：写入审计记录失败：%v\n", LocaleEN: "WARNING: failed to write audit record: %v\n"},
+
+	// Control commands.
+	"control.id_required":   {LocaleZH: "错误：缺少 --id", LocaleEN: "ERROR: --id is required"},
+	"control.add_required":  {LocaleZH: "错误：--id、--src 和 --dst 均为必填项", LocaleEN: "ERROR: --id, --src and --dst are required"},
+	"control.unreachable":   {LocaleZH: "无法通过 %s 连接守护进程，守护进程是否在运行？", LocaleEN: "cannot reach the daemon at %s, is it running?"},
+	"control.error":         {LocaleZH: "错误：%v\n", LocaleEN: "ERROR: %v\n"},
+	"control.showing":       {LocaleZH: "（显示 %d / %d 路流）\n", LocaleEN: "(showing %d of %d streams)\n"},
+	"control.recent_output": {LocaleZH: "\n最近的 ffmpeg 输出：", LocaleEN: "\nRecent ffmpeg output:"},
+	"control.not_draining":  {LocaleZH: "未在排空", LocaleEN: "not draining"},
+	"control.reloaded":      {LocaleZH: "配置已重载（%d 路流）\n", LocaleEN: "config reloaded (%d streams)\n"},
+	"control.added":         {LocaleZH: "已新增流 %s\n", LocaleEN: "added stream %s\n"},
+	"control.removed":       {LocaleZH: "已删除流 %s\n", LocaleEN: "removed stream %s\n"},
+	"control.paused":        {LocaleZH: "已暂停流 %s（状态：%s）\n", LocaleEN: "paused stream %s (state: %s)\n"},
+	"control.resumed":       {LocaleZH: "已恢复流 %s（状态：%s）\n", LocaleEN: "resumed stream %s (state: %s)\n"},
+	"control.validate_ok":   {LocaleZH: "%s：正常（%d 路流）\n", LocaleEN: "%s: ok (%d streams)\n"},
+
+	// CLI flags.
+	"flag.config":                 {LocaleZH: "配置文件路径", LocaleEN: "config file path"},
+	"flag.env":                    {LocaleZH: "逗号分隔的配置环境，按顺序叠加在基础配置上（默认读取 STREAM_RUNNER_ENV）", LocaleEN: "comma separated config environments overlaid on the base config in order (defaults to STREAM_RUNNER_ENV)"},
+	"flag.output.stdout":          {LocaleZH: "输出文件，默认写到标准输出", LocaleEN: "output file, defaults to stdout"},
+	"flag.import.from":            {LocaleZH: "源配置格式：nginx-rtmp、srs 或 restreamer", LocaleEN: "source config format: nginx-rtmp, srs or restreamer"},
+	"flag.import.host":            {LocaleZH: "拉流时使用的源服务器地址（nginx-rtmp / srs）", LocaleEN: "source server address to pull from (nginx-rtmp / srs)"},
+	"flag.import.names":           {LocaleZH: "逗号分隔的流名（nginx-rtmp）或 app/stream（srs）", LocaleEN: "comma separated stream names (nginx-rtmp) or app/stream (srs)"},
+	"flag.migrate.output":         {LocaleZH: "写入的目标文件，默认覆盖原文件并保留 .bak 备份", LocaleEN: "target file, defaults to overwriting the config and keeping a .bak backup"},
+	"flag.migrate.dryrun":         {LocaleZH: "只输出差异，不写入文件", LocaleEN: "print the diff without writing"},
+	"flag.purge.id":               {LocaleZH: "要清除数据的流 ID", LocaleEN: "ID of the stream to purge"},
+	"flag.purge.yes":              {LocaleZH: "跳过交互确认", LocaleEN: "skip the interactive confirmation"},
+	"flag.sandbox.seccomp":        {LocaleZH: "应用 seccomp 过滤器", LocaleEN: "apply the seccomp filter"},
+	"flag.sandbox.apparmor":       {LocaleZH: "exec 时切换到的 AppArmor profile", LocaleEN: "AppArmor profile to switch to on exec"},
+	"flag.service.init":           {LocaleZH: "init 系统：systemd、openrc 或 launchd，默认自动检测", LocaleEN: "init system: systemd, openrc or launchd, detected by default"},
+	"flag.service.user":           {LocaleZH: "运行服务的用户，默认 root", LocaleEN: "user to run the service as, defaults to root"},
+	"flag.service.group":          {LocaleZH: "运行服务的组，默认与 --user 相同", LocaleEN: "group to run the service as, defaults to --user"},
+	"flag.service.binary":         {LocaleZH: "stream-runner 可执行文件路径，默认为当前程序", LocaleEN: "path to the stream-runner binary, defaults to this executable"},
+	"flag.openapi.api_basepath":   {LocaleZH: "管理接口的反向代理路径前缀（api.base_path），写入管理接口的 servers", LocaleEN: "reverse proxy path prefix of the management api (api.base_path) written to its servers"},
+	"flag.openapi.basepath":       {LocaleZH: "反向代理的路径前缀，写入文档的 servers", LocaleEN: "reverse proxy path prefix written to the document servers"},
+	"flag.update.url":             {LocaleZH: "更新清单地址，覆盖配置中的 update.url", LocaleEN: "update manifest URL, overrides update.url in the config"},
+	"flag.update.key":             {LocaleZH: "验证清单签名的 ed25519 公钥（base64），覆盖配置中的 update.public_key", LocaleEN: "ed25519 public key (base64) for the manifest signature, overrides update.public_key"},
+	"flag.update.check":           {LocaleZH: "只检查是否有新版本，不下载", LocaleEN: "only check for a new version without downloading"},
+	"flag.update.restart":         {LocaleZH: "替换后通过 init 系统重启服务（普通重启，所有流会中断）", LocaleEN: "restart the service through the init system after replacing the binary (a plain restart, every stream is interrupted)"},
+	"flag.update.allow_downgrade": {LocaleZH: "允许安装低于当前版本的发布（有意回退时使用）", LocaleEN: "allow installing a release older than the running version (for deliberate rollbacks)"},
+	"flag.control.socket":         {LocaleZH: "守护进程的控制套接字路径", LocaleEN: "path to the daemon's control socket"},
+	"flag.control.json":           {LocaleZH: "以 JSON 输出", LocaleEN: "print JSON"},
+	"flag.control.id":             {LocaleZH: "流 ID", LocaleEN: "stream ID"},
+	"flag.control.src":            {LocaleZH: "源流地址", LocaleEN: "source stream URL"},
+	"flag.control.dst":            {LocaleZH: "目标流地址", LocaleEN: "destination stream URL"},
+	"flag.drain.wait":             {LocaleZH: "停止流的条件：schedule（等节目结束或临时流到期）或 none（立即停止）", LocaleEN: "when to stop each stream: schedule (at programme end or temporary stream expiry) or none (now)"},
+	"flag.drain.timeout":          {LocaleZH: "最长等待时间，到期后停止剩余的流", LocaleEN: "maximum wait, remaining streams are stopped afterwards"},
+	"flag.drain.status":           {LocaleZH: "只查看排空进度", LocaleEN: "only show drain progress"},
+	"flag.drain.cancel":           {LocaleZH: "取消排空并重新启动排空停止的流", LocaleEN: "cancel the drain and restart the streams it stopped"},
+	"flag.loglevel.set":           {LocaleZH: "临时设置日志级别：debug、info、warn 或 error，重载配置后仍然保留", LocaleEN: "temporarily set the log level: debug, info, warn or error, kept across reloads"},
+	"flag.loglevel.reset":         {LocaleZH: "恢复配置文件中的日志级别", LocaleEN: "restore the log level from the config file"},
+	"flag.service.dryrun":         {LocaleZH: "只输出服务文件，不安装", LocaleEN: "print the service file without installing"},
+
+	// Stream events, rendered per alert channel locale.
+	"event.transcode_fallback": {
+		LocaleZH: "源流 %s 不被 %s 输出支持，使用转码配置 %s",
+		LocaleEN: "source %s not supported by %s output, transcoding with profile %s",
+	},
+	"event.keyframe_interval_exceeded": {
+		LocaleZH: "源流关键帧间隔 %s 超过 %s，仍直接复制",
+		LocaleEN: "source keyframe interval %s exceeds %s, copying anyway",
+	},
+	"event.keyframe_fallback": {
+		LocaleZH: "源流关键帧间隔 %s 超过 %s，使用转码配置 %s",
+		LocaleEN: "source keyframe interval %s exceeds %s, transcoding with profile %s",
+	},
+	"event.av_drift": {
+		LocaleZH: "音画偏差 %s 超过阈值 %s",
+		LocaleEN: "a/v drift %s exceeds threshold %s",
+	},
+	"event.av_drift_recovered": {
+		LocaleZH: "音画偏差恢复到 %s",
+		LocaleEN: "a/v drift back to %s",
+	},
+	"event.degraded": {
+		LocaleZH: "%s 偏离基线：当前 %s，基线均值 %s",
+		LocaleEN: "%s deviates from baseline: %s, baseline mean %s",
+	},
+	"event.degraded_recovered": {
+		LocaleZH: "%s 恢复到基线范围：%s",
+		LocaleEN: "%s back within baseline: %s",
+	},
+	"event.resource_exceeded": {
+		LocaleZH: "ffmpeg 资源占用超过阈值：%s",
+		LocaleEN: "ffmpeg resource usage above limits: %s",
+	},
+	"event.resource_recovered": {
+		LocaleZH: "ffmpeg 资源占用恢复正常",
+		LocaleEN: "ffmpeg resource usage back within limits",
+	},
+	"event.canary_failed": {
+		LocaleZH: "金丝雀流未能在 %[2]s 内连续运行 %[1]s，配置重载已回滚",
+		LocaleEN: "canary stream did not stay up for %s within %s, config reload rolled back",
+	},
+	"event.synthetic_failed": {
+		LocaleZH: "端到端监测流在平台侧验证失败：%s",
+		LocaleEN: "synthetic stream failed platform-side check: %s",
+	},
+	"event.synthetic_recovered": {
+		LocaleZH: "端到端监测流在平台侧验证恢复正常",
+		LocaleEN: "synthetic stream passes platform-side check again",
+	},
+	"event.platform_unhealthy": {
+		LocaleZH: "%s 平台侧直播状态异常：%s",
+		LocaleEN: "%s reports the broadcast unhealthy: %s",
+	},
+	"event.platform_healthy": {
+		LocaleZH: "%s 平台侧直播状态恢复正常",
+		LocaleEN: "%s reports the broadcast healthy again",
+	},
+	"event.schedule_drift": {
+		LocaleZH: "流与节目表不一致：应为 %s，实际为 %s",
+		LocaleEN: "stream drifted from the schedule: expected %s, actually %s",
+	},
+	"event.schedule_drift_resolved": {
+		LocaleZH: "流已与节目表一致",
+		LocaleEN: "stream matches the schedule again",
+	},
+	"event.archive_completed": {
+		LocaleZH: "节目录制已归档到 %s",
+		LocaleEN: "programme recording archived to %s",
+	},
+	"event.archive_failed": {
+		LocaleZH: "节目录制归档失败：%s",
+		LocaleEN: "failed to archive programme recording: %s",
+	},
+	"event.handover_timeout": {
+		LocaleZH: "流已从配置中删除，%s 内没有其他节点接替，已停止",
+		LocaleEN: "stream removed from config was not taken over by another node within %s, stopped",
+	},
+	"event.watchdog_unhealthy": {
+		LocaleZH: "看门狗判定流异常（%s），处理方式：%s",
+		LocaleEN: "watchdog found stream unhealthy (%s), action: %s",
+	},
+	"event.watchdog_recovered": {
+		LocaleZH: "看门狗判定流已从 %s 恢复",
+		LocaleEN: "watchdog found stream recovered from %s",
+	},
+	"event.goroutine_panic": {
+		LocaleZH: "内部协程 %s 发生 panic：%s",
+		LocaleEN: "internal goroutine %s panicked: %s",
+	},
+	"event.loop_stalled": {
+		LocaleZH: "核心循环 %s 超过 %s 没有进展，已转储协程调用栈",
+		LocaleEN: "core loop %s made no progress for %s, goroutine stacks dumped",
+	},
+	"event.loop_recovered": {
+		LocaleZH: "核心循环 %s 已恢复",
+		LocaleEN: "core loop %s is making progress again",
+	},
+	"event.drain_started": {
+		LocaleZH: "开始排空 %d 路流（条件 %s，最晚 %s），不再接受新的流",
+		LocaleEN: "draining %d streams (wait %s, deadline %s), new streams are refused",
+	},
+	"event.drain_progress": {
+		LocaleZH: "排空已停止 %d 路流，剩余 %d 路",
+		LocaleEN: "drain stopped %d streams, %d remaining",
+	},
+	"event.drain_completed": {
+		LocaleZH: "排空完成，所有流已停止，用时 %s",
+		LocaleEN: "drain completed, all streams stopped after %s",
+	},
+	"event.drain_cancelled": {
+		LocaleZH: "排空已取消，重新启动了 %d 路流",
+		LocaleEN: "drain cancelled, %d streams restarted",
+	},
+	"event.output_failed": {
+		LocaleZH: "输出 %s 失败：%s，其他输出继续推送",
+		LocaleEN: "output %s failed: %s, other outputs continue",
+	},
+}
+
+// normalizeLocale 将 zh_CN.UTF-8、en_US 等写法归一为支持的语言，不支持时返回空串。
+func normalizeLocale(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(s, "zh"):
+		return LocaleZH
+	case strings.HasPrefix(s, "en"):
+		return LocaleEN
+	}
+	return ""
+}
+
+// validLocale 判断配置中的语言是否受支持，空串表示使用默认值。
+func validLocale(s string) bool {
+	return s == "" || s == LocaleZH || s == LocaleEN
+}
+
+// cliLocale 返回 CLI 使用的语言：依次读取 STREAM_RUNNER_LANG、LC_ALL、LC_MESSAGES、LANG，
+// 都未设置或不受支持时使用中文。
+func cliLocale() string {
+	for _, name := range []string{"STREAM_RUNNER_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			if loc := normalizeLocale(v); loc != "" {
+				return loc
+			}
+			// Like setlocale, the first variable that is set wins even if unsupported.
+			return LocaleZH
+		}
+	}
+	return LocaleZH
+}
+
+// tr 返回指定语言的文案，缺少该语言时回退到英文，缺少消息时返回消息 ID。
+func tr(locale, key string, args ...any) string {
+	msgs, ok := catalog[key]
+	if !ok {
+		return key
+	}
+	format, ok := msgs[locale]
+	if !ok {
+		format = msgs[LocaleEN]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// T 返回 CLI 语言的文案。
+func T(key string, args ...any) string {
+	return tr(cliLocale(), key, args...)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+// TestCatalogComplete 测试文案目录中每条消息都提供了所有语言，清除结果中的说明都有对应文案
+func TestCatalogComplete(t *testing.T) {
+	for key, msgs := range catalog {
+		for _, loc := range []string{LocaleZH, LocaleEN} {
+			if msgs[loc] == "" {
+				t.Errorf("message %s has no %s translation", key, loc)
+			}
+		}
+	}
+	// Purge notes are sent as codes and translated by the CLI.
+	for _, note := range []string{purgeNoteStillConfigured, purgeNoteNotConfigured, purgeNoteStdout} {
+		if _, ok := catalog["purge.note."+note]; !ok {
+			t.Errorf("purge note %s has no message", note)
+		}
+	}
+}
+
+// TestCLILocale 测试从环境变量选择 CLI 语言
+func TestCLILocale(t *testing.T) {
+	tests := []struct {
+		override, lang string
+		want           string
+	}{
+		{"", "", LocaleZH},
+		{"", "en_US.UTF-8", LocaleEN},
+		{"", "zh_CN.UTF-8", LocaleZH},
+		{"en", "zh_CN.UTF-8", LocaleEN},
+		{"", "C", LocaleZH},
+	}
+	for _, tt := range tests {
+		t.Setenv("STREAM_RUNNER_LANG", tt.override)
+		t.Setenv("LC_ALL", "")
+		t.Setenv("LC_MESSAGES", "")
+		t.Setenv("LANG", tt.lang)
+		if got := cliLocale(); got != tt.want {
+			t.Errorf("cliLocale(%q, %q) = %s, want %s", tt.override, tt.lang, got, tt.want)
+		}
+	}
+	if got := tr(LocaleEN, "event.av_drift_recovered", "10ms"); got != "a/v drift back to 10ms" {
+		t.Errorf("tr = %q", got)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// directive 是 nginx / SRS 风格配置中的一条指令及其子块。
+type directive struct {
+	name     string
+	args     []string
+	children []*directive
+}
+
+// find 返回名称匹配的所有直接子指令。
+func (d *directive) find(name string) []*directive {
+	var out []*directive
+	for _, c := range d.children {
+		if c.name == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// tokenizeBlockConfig 把 nginx 风格配置切分为词法单元，去掉 # 注释并处理引号。
+func tokenizeBlockConfig(data string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '#':
+			flush()
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			flush()
+			end := strings.IndexByte(data[i+1:], c)
+			if end < 0 {
+				end = len(data) - i - 1
+			}
+			tokens = append(tokens, data[i+1:i+1+end])
+			i += end + 1
+		case c == '{' || c == '}' || c == ';':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parseBlockConfig 解析 nginx 风格的块配置（nginx-rtmp 和 SRS 共用这种语法）。
+func parseBlockConfig(data string) (*directive, error) {
+	tokens := tokenizeBlockConfig(data)
+	root := &directive{}
+	stack := []*directive{root}
+	var cur *directive
+	for _, tok := range tokens {
+		parent := stack[len(stack)-1]
+		switch tok {
+		case ";":
+			cur = nil
+		case "{":
+			if cur == nil {
+				return nil, fmt.Errorf("unexpected '{'")
+			}
+			stack = append(stack, cur)
+			cur = nil
+		case "}":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected '}'")
+			}
+			stack = stack[:len(stack)-1]
+			cur = nil
+		default:
+			if cur == nil {
+				cur = &directive{name: tok}
+				parent.children = append(parent.children, cur)
+			} else {
+				cur.args = append(cur.args, tok)
+			}
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unterminated block")
+	}
+	return root, nil
+}
+
+// importIDs 为导入的流生成唯一且只含安全字符的 ID。
+type importIDs map[string]int
+
+// next 返回基于 base 的下一个唯一 ID。
+func (ids importIDs) next(base string) string {
+	id := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, base), "-")
+	if id == "" {
+		id = "stream"
+	}
+	ids[id]++
+	if n := ids[id]; n > 1 {
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// importNginxRTMP 将 nginx-rtmp 的 push 指令转换为流配置。
+// push 作用于应用下发布的所有流，因此需要由 names 给出具体的流名。
+func importNginxRTMP(data, host string, names []string) ([]StreamConfig, error) {
+	root, err := parseBlockConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--names is required: nginx-rtmp push applies to every stream published to an application")
+	}
+	ids := importIDs{}
+	var streams []StreamConfig
+	for _, rtmp := range root.find("rtmp") {
+		for _, server := range rtmp.find("server") {
+			port := "1935"
+			if listen := server.find("listen"); len(listen) > 0 && len(listen[0].args) > 0 {
+				port = listen[0].args[0]
+				if i := strings.LastIndexByte(port, ':'); i >= 0 {
+					port = port[i+1:]
+				}
+			}
+			for _, app := range server.find("application") {
+				if len(app.args) == 0 {
+					continue
+				}
+				for _, push := range app.find("push") {
+					if len(push.args) == 0 {
+						continue
+					}
+					target := strings.TrimSuffix(push.args[0], "/")
+					for _, name := range names {
+						streams = append(streams, StreamConfig{
+							ID:  ids.next(app.args[0] + "-" + name),
+							Src: fmt.Sprintf("rtmp://%s:%s/%s/%s", host, port, app.args[0], name),
+							Dst: nginxPushURL(target, name),
+						})
+					}
+				}
+			}
+		}
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no push directives found")
+	}
+	return streams, nil
+}
+
+// nginxPushURL 返回 push 地址对应的推流地址：只写到应用一级时按 nginx-rtmp 的行为追加流名。
+func nginxPushURL(target, name string) string {
+	u, err := url.Parse(target)
+	if err != nil || strings.Count(strings.Trim(u.Path, "/"), "/") >= 1 {
+		return target
+	}
+	return target + "/" + name
+}
+
+// importSRS 将 SRS 的 forward 配置转换为流配置。
+// forward 按原应用名和流名转发所有流，因此需要由 names 给出 app/stream 列表。
+func importSRS(data, host string, names []string) ([]StreamConfig, error) {
+	root, err := parseBlockConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--names is required in app/stream form: SRS forwards every stream of a vhost")
+	}
+	port := "1935"
+	if listen := root.find("listen"); len(listen) > 0 && len(listen[0].args) > 0 {
+		port = listen[0].args[0]
+	}
+	ids := importIDs{}
+	var streams []StreamConfig
+	for _, vhost := range root.find("vhost") {
+		if len(vhost.args) == 0 {
+			continue
+		}
+		var destinations []string
+		for _, fwd := range vhost.find("forward") {
+			if len(fwd.children) == 0 {
+				// SRS 2.x style: forward host:port ...;
+				destinations = append(destinations, fwd.args...)
+				continue
+			}
+			if enabled := fwd.find("enabled"); len(enabled) > 0 && len(enabled[0].args) > 0 && enabled[0].args[0] != "on" {
+				continue
+			}
+			for _, dst := range fwd.find("destination") {
+				destinations = append(destinations, dst.args...)
+			}
+		}
+		query := ""
+		if vhost.args[0] != "__defaultVhost__" {
+			query = "?vhost=" + vhost.args[0]
+		}
+		for _, dest := range destinations {
+			for _, name := range names {
+				if !strings.Contains(name, "/") {
+					return nil, fmt.Errorf("invalid name %q, expected app/stream", name)
+				}
+				streams = append(streams, StreamConfig{
+					ID:  ids.next(strings.ReplaceAll(name, "/", "-")),
+					Src: fmt.Sprintf("rtmp://%s:%s/%s%s", host, port, name, query),
+					Dst: fmt.Sprintf("rtmp://%s/%s", dest, name),
+				})
+			}
+		}
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no forward destinations found")
+	}
+	return streams, nil
+}
+
+// restreamerProcess 是 datarhei Restreamer / Core 进程配置中导入需要的字段。
+type restreamerProcess struct {
+	ID     string `json:"id"`
+	Config *struct {
+		ID     string              `json:"id"`
+		Input  []restreamerAddress `json:"input"`
+		Output []restreamerAddress `json:"output"`
+	} `json:"config"`
+	Input  []restreamerAddress `json:"input"`
+	Output []restreamerAddress `json:"output"`
+}
+
+// restreamerAddress 是进程的输入或输出地址。
+type restreamerAddress struct {
+	Address string `json:"address"`
+}
+
+// importRestreamer 将 Restreamer 导出的进程配置转换为流配置。
+// 导出文件可以是进程数组，也可以是带 processes 字段的对象；地址中含有 {memfs} 等占位符的进程会被跳过。
+func importRestreamer(data []byte) ([]StreamConfig, []string, error) {
+	var procs []restreamerProcess
+	if err := json.Unmarshal(data, &procs); err != nil {
+		var wrapped struct {
+			Processes []restreamerProcess `json:"processes"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, nil, err
+		}
+		procs = wrapped.Processes
+	}
+
+	ids := importIDs{}
+	var streams []StreamConfig
+	var skipped []string
+	for _, p := range procs {
+		id, inputs, outputs := p.ID, p.Input, p.Output
+		if p.Config != nil {
+			if p.Config.ID != "" {
+				id = p.Config.ID
+			}
+			inputs, outputs = p.Config.Input, p.Config.Output
+		}
+		if len(inputs) == 0 || len(outputs) == 0 {
+			skipped = append(skipped, fmt.Sprintf("%s: no input or output", id))
+			continue
+		}
+		if len(inputs) > 1 {
+			skipped = append(skipped, fmt.Sprintf("%s: multiple inputs are not supported", id))
+			continue
+		}
+		src := inputs[0].Address
+		if strings.Contains(src, "{") {
+			skipped = append(skipped, fmt.Sprintf("%s: input %s uses a Restreamer placeholder", id, src))
+			continue
+		}
+		for _, out := range outputs {
+			if strings.Contains(out.Address, "{") {
+				skipped = append(skipped, fmt.Sprintf("%s: output %s uses a Restreamer placeholder", id, out.Address))
+				continue
+			}
+			streams = append(streams, StreamConfig{ID: ids.next(id), Src: src, Dst: out.Address})
+		}
+	}
+	if len(streams) == 0 {
+		return nil, skipped, fmt.Errorf("no importable processes found")
+	}
+	return streams, skipped, nil
+}
+
+// runImportConfig 实现 import-config 子命令：从其他推流软件的配置生成 streams.yml。
+func runImportConfig(args []string) int {
+	fs := flag.NewFlagSet("import-config", flag.ContinueOnError)
+	from := fs.String("from", "", T("flag.import.from"))
+	host := fs.String("host", "127.0.0.1", T("flag.import.host"))
+	names := fs.String("names", "", T("flag.import.names"))
+	output := fs.String("output", "", T("flag.output.stdout"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "ERROR: --from and exactly one input file are required")
+		return 2
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	var nameList []string
+	for _, n := range strings.Split(*names, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			nameList = append(nameList, n)
+		}
+	}
+
+	var streams []StreamConfig
+	var skipped []string
+	switch *from {
+	case "nginx-rtmp":
+		streams, err = importNginxRTMP(string(data), *host, nameList)
+	case "srs":
+		streams, err = importSRS(string(data), *host, nameList)
+	case "restreamer":
+		streams, skipped, err = importRestreamer(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", *from)
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "WARNING: skipped %s\n", s)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&Config{Version: CurrentConfigVersion, Streams: streams}); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	out := buf.Bytes()
+	if *output == "" {
+		if _, err := os.Stdout.Write(out); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	} else if err := os.WriteFile(*output, out, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] imported %d streams\n", len(streams))
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+// TestImportNginxRTMP 测试 nginx-rtmp push 指令的导入
+func TestImportNginxRTMP(t *testing.T) {
+	conf := `
+rtmp {
+    server {
+        listen 1936;
+        application live {
+            live on;
+            # push to two platforms
+            push rtmp://a.example.com/app;
+            push "rtmp://b.example.com/live/fixed-key";
+        }
+    }
+}`
+	streams, err := importNginxRTMP(conf, "10.0.0.5", []string{"cam1"})
+	if err != nil {
+		t.Fatalf("importNginxRTMP: %v", err)
+	}
+	if len(streams) != 2 {
+		t.Fatalf("got %d streams, want 2", len(streams))
+	}
+	if streams[0].Src != "rtmp://10.0.0.5:1936/live/cam1" || streams[0].Dst != "rtmp://a.example.com/app/cam1" {
+		t.Errorf("stream 0 = %+v", streams[0])
+	}
+	if streams[1].Dst != "rtmp://b.example.com/live/fixed-key" || streams[1].ID != "live-cam1-2" {
+		t.Errorf("stream 1 = %+v", streams[1])
+	}
+	if _, err := importNginxRTMP(conf, "10.0.0.5", nil); err == nil {
+		t.Error("expected error without names")
+	}
+}
+
+// TestImportSRSAndRestreamer 测试 SRS forward 和 Restreamer 导出的导入
+func TestImportSRSAndRestreamer(t *testing.T) {
+	conf := `
+listen 1935;
+vhost __defaultVhost__ {
+    forward {
+        enabled on;
+        destination 127.0.0.1:19350;
+    }
+}
+vhost disabled.example.com {
+    forward {
+        enabled off;
+        destination 127.0.0.1:19351;
+    }
+}`
+	streams, err := importSRS(conf, "srs.local", []string{"live/cam1"})
+	if err != nil {
+		t.Fatalf("importSRS: %v", err)
+	}
+	if len(streams) != 1 || streams[0].Src != "rtmp://srs.local:1935/live/cam1" || streams[0].Dst != "rtmp://127.0.0.1:19350/live/cam1" {
+		t.Errorf("srs streams = %+v", streams)
+	}
+
+	export := `{"processes": [
+		{"id": "restreamer-ui:ingest:1", "config": {
+			"input": [{"address": "rtmp://origin/live/cam1"}],
+			"output": [{"address": "rtmp://a.rtmp.youtube.com/live2/key"}, {"address": "{memfs}/cam1.m3u8"}]
+		}}
+	]}`
+	streams, skipped, err := importRestreamer([]byte(export))
+	if err != nil {
+		t.Fatalf("importRestreamer: %v", err)
+	}
+	if len(streams) != 1 || streams[0].ID != "restreamer-ui-ingest-1" || streams[0].Src != "rtmp://origin/live/cam1" {
+		t.Errorf("restreamer streams = %+v", streams)
+	}
+	if len(skipped) != 1 {
+		t.Errorf("skipped = %v, want 1 entry", skipped)
+	}
+}
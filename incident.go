@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIncidentAfter 是流持续异常多久后创建事故单的默认时长。
+	DefaultIncidentAfter = 5 * time.Minute
+	// DefaultIncidentLogLines 是事故单附带的 ffmpeg 输出默认行数。
+	DefaultIncidentLogLines = 50
+	// defaultIncidentTemplate 是未配置模板时的事故单正文，即完整的上下文 JSON。
+	defaultIncidentTemplate = `{{json .}}`
+	// incidentStableRun 是 ffmpeg 连续运行多久后视为恢复。
+	incidentStableRun = time.Minute
+	// streamHistorySize 是每路流保留的状态变化条数。
+	streamHistorySize = 20
+	// streamTailSize 是每路流保留的 ffmpeg 输出行数，事故单的 log_lines 不能超过它。
+	streamTailSize = 200
+)
+
+// IncidentConfig 表示持续故障时自动创建事故单：流持续异常超过 after 时，
+// 通过告警渠道发送一次附带上下文（最近的 ffmpeg 输出、探测结果、状态变化和命令行）的事故单。
+type IncidentConfig struct {
+	// After 是流持续未能稳定运行多久后创建事故单，默认 5m。
+	After time.Duration `yaml:"after,omitempty"`
+	// Channels 是发送事故单的渠道，引用 alerts.channels 中的名称。
+	Channels []string `yaml:"channels"`
+	// Match 是需要匹配的流标签，值支持 * 通配符，为空时对所有流生效。
+	Match map[string]string `yaml:"match,omitempty"`
+	// Template 是事故单正文模板（Go template），默认输出完整的上下文 JSON。
+	Template string `yaml:"template,omitempty"`
+	// LogLines 是附带的 ffmpeg 输出行数，默认 50，最多 200。
+	LogLines int `yaml:"log_lines,omitempty"`
+}
+
+// validate 校验事故单配置，alerts 是同一配置中的告警路由。
+func (c *IncidentConfig) validate(alerts *AlertConfig) error {
+	if c.After < 0 {
+		return fmt.Errorf("after must not be negative")
+	}
+	if c.LogLines < 0 || c.LogLines > streamTailSize {
+		return fmt.Errorf("log_lines must be between 0 and %d", streamTailSize)
+	}
+	if len(c.Channels) == 0 {
+		return fmt.Errorf("channels is required")
+	}
+	for _, name := range c.Channels {
+		if alerts == nil {
+			return fmt.Errorf("unknown channel %q, alerts.channels is not configured", name)
+		}
+		if _, ok := alerts.Channels[name]; !ok {
+			return fmt.Errorf("unknown channel %q", name)
+		}
+	}
+	for label, pattern := range c.Match {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for label %s", pattern, label)
+		}
+	}
+	if _, err := parseAlertTemplate(c.Template); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c IncidentConfig) withDefaults() IncidentConfig {
+	if c.After == 0 {
+		c.After = DefaultIncidentAfter
+	}
+	if c.LogLines == 0 {
+		c.LogLines = DefaultIncidentLogLines
+	}
+	if c.Template == "" {
+		c.Template = defaultIncidentTemplate
+	}
+	return c
+}
+
+// lineTail 保留最近写入的若干行。
+type lineTail struct {
+	mu    sync.Mutex
+	lines []string
+	size  int
+}
+
+// add 追加一行，超出容量时丢弃最早的行。
+func (t *lineTail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = append(t.lines[:0], t.lines[len(t.lines)-t.size:]...)
+	}
+}
+
+// last 返回最近 n 行。
+func (t *lineTail) last(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n > len(t.lines) {
+		n = len(t.lines)
+	}
+	return append([]string(nil), t.lines[len(t.lines)-n:]...)
+}
+
+// historyEntry 是流的一次状态变化。
+type historyEntry struct {
+	Time time.Time `json:"time"`
+	// Event 是 start、exit 或错误类别。
+	Event  string `json:"event"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// recordHistory 记录一次状态变化，只保留最近 streamHistorySize 条。调用方需持有 w.mu。
+func (w *StreamWorker) recordHistory(event, detail string, now time.Time) {
+	w.history = append(w.history, historyEntry{Time: now, Event: event, Detail: redactURLs(detail)})
+	if len(w.history) > streamHistorySize {
+		w.history = append(w.history[:0], w.history[len(w.history)-streamHistorySize:]...)
+	}
+}
+
+// stderrTail 返回保存 ffmpeg 输出的缓冲区，不存在时创建。
+func (w *StreamWorker) stderrTail() *lineTail {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.tail == nil {
+		w.tail = &lineTail{size: streamTailSize}
+	}
+	return w.tail
+}
+
+// incident 是事故单的上下文，也是模板的数据。
+type incident struct {
+	Time     time.Time         `json:"time"`
+	StreamID string            `json:"stream_id"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// FailingSince 是流开始未能稳定运行的时间。
+	FailingSince time.Time          `json:"failing_since"`
+	Summary      string             `json:"summary"`
+	LastError    *streamErrorStatus `json:"last_error,omitempty"`
+	Restarts     int64              `json:"restarts"`
+	Failures     int64              `json:"failures"`
+	History      []historyEntry     `json:"history"`
+	Stderr       []string           `json:"stderr"`
+	// Probe 是创建事故单时对源流的探测结果，Codecs 与 Error 二选一。
+	Probe incidentProbe `json:"probe"`
+	// Command 是最近一次启动的 ffmpeg 命令行，地址只保留主机部分。
+	Command string `json:"command,omitempty"`
+}
+
+// incidentProbe 是事故单中的源流探测结果。
+type incidentProbe struct {
+	Codecs string `json:"codecs,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// buildIncident 收集流的上下文，其中的探测会访问源流。
+func buildIncident(w *StreamWorker, since time.Time, logLines int, now time.Time) incident {
+	cfg := w.config()
+	stats := w.Stats(now)
+	w.mu.Lock()
+	history := append([]historyEntry(nil), w.history...)
+	args := w.lastArgs
+	w.mu.Unlock()
+
+	inc := incident{
+		Time:         now,
+		StreamID:     cfg.ID,
+		Labels:       cfg.Labels,
+		FailingSince: since,
+		Summary:      fmt.Sprintf("stream %s has not been running stably for %s", cfg.ID, now.Sub(since).Round(time.Second)),
+		Restarts:     stats.Restarts,
+		Failures:     stats.Failures,
+		History:      history,
+		Stderr:       w.stderrTail().last(logLines),
+	}
+	for i, line := range inc.Stderr {
+		inc.Stderr[i] = redactURLs(line)
+	}
+	if e := stats.LastError; e.Category != "" {
+		inc.LastError = &streamErrorStatus{Category: e.Category, Message: redactURLs(e.Message), Time: e.Time}
+	}
+	if len(args) > 0 {
+		inc.Command = redactURLs("ffmpeg " + strings.Join(args, " "))
+	}
+	if err := resolveStreamSecrets(&cfg); err != nil {
+		inc.Probe.Error = err.Error()
+	} else if ep, err := resolveEndpoints(cfg); err != nil {
+		inc.Probe.Error = err.Error()
+	} else if probe, err := probeSource(cfg, ep); err != nil {
+		inc.Probe.Error = redactURLs(err.Error())
+	} else {
+		inc.Probe.Codecs = probe.codecSummary()
+	}
+	return inc
+}
+
+// sendIncident 渲染事故单并发送到配置的渠道。
+func sendIncident(c IncidentConfig, inc incident) {
+	r := alertRouting.Load()
+	if r == nil || r.config == nil {
+		return
+	}
+	body, err := renderAlert(c.Template, inc)
+	if err != nil {
+		slog.Warn("failed to render incident", "stream_id", inc.StreamID, "error", err)
+		return
+	}
+	for _, name := range c.Channels {
+		ch, ok := r.config.Channels[name]
+		if !ok {
+			continue
+		}
+		if ch.Plugin != "" {
+			notifyPlugin(ch, name, body)
+			continue
+		}
+		sendAlert(ch, name, body)
+	}
+}
+
+// incidentMonitor 跟踪每路流未能稳定运行的时间，超过 after 时创建一次事故单。
+type incidentMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// failingSince 是每路流开始未能稳定运行的时间。
+	failingSince map[string]time.Time
+	// opened 记录本次故障已创建过事故单的流。
+	opened map[string]bool
+}
+
+// newIncidentMonitor 创建事故单监控器。
+func newIncidentMonitor(state *AppState) *incidentMonitor {
+	return &incidentMonitor{
+		state:        state,
+		failingSince: make(map[string]time.Time),
+		opened:       make(map[string]bool),
+	}
+}
+
+// run 每 10 秒检查一次所有流。
+func (m *incidentMonitor) run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.check(now)
+	}
+}
+
+// check 更新每路流的故障起始时间，对持续故障且尚未创建事故单的流异步创建事故单。
+// ffmpeg 连续运行 incidentStableRun 后视为恢复，下次故障会重新创建。
+func (m *incidentMonitor) check(now time.Time) {
+	m.state.mu.RLock()
+	var c *IncidentConfig
+	if m.state.config != nil && m.state.config.Incidents != nil {
+		o := m.state.config.Incidents.withDefaults()
+		c = &o
+	}
+	m.state.mu.RUnlock()
+	workers := m.state.workers.snapshot()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c == nil {
+		clear(m.failingSince)
+		clear(m.opened)
+		return
+	}
+	route := AlertRoute{Match: c.Match}
+	for id := range m.failingSince {
+		if _, ok := workers[id]; !ok {
+			delete(m.failingSince, id)
+			delete(m.opened, id)
+		}
+	}
+	for id, w := range workers {
+		cfg := w.config()
+		if !route.matches(Event{Labels: cfg.Labels}) {
+			continue
+		}
+		start := w.runningSince()
+		if w.isOffSchedule() || (!start.IsZero() && now.Sub(start) >= incidentStableRun) {
+			if m.opened[id] {
+				slog.Info("stream recovered after incident", "stream_id", id)
+			}
+			delete(m.failingSince, id)
+			delete(m.opened, id)
+			continue
+		}
+		since, ok := m.failingSince[id]
+		if !ok {
+			m.failingSince[id] = now
+			continue
+		}
+		if m.opened[id] || now.Sub(since) < c.After {
+			continue
+		}
+		m.opened[id] = true
+		slog.Warn("stream failing for too long, creating incident", "stream_id", id, "failing_since", since)
+		// Probing the source may take seconds, so the bundle is built off the check loop.
+		go func(w *StreamWorker, c IncidentConfig, since time.Time) {
+			sendIncident(c, buildIncident(w, since, c.LogLines, now))
+		}(w, *c, since)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLineTail 测试只保留最近的若干行
+func TestLineTail(t *testing.T) {
+	tail := &lineTail{size: 3}
+	for _, line := range []string{"a", "b", "c", "d"} {
+		tail.add(line)
+	}
+	if got := strings.Join(tail.last(10), ","); got != "b,c,d" {
+		t.Errorf("last(10) = %q", got)
+	}
+	if got := strings.Join(tail.last(2), ","); got != "c,d" {
+		t.Errorf("last(2) = %q", got)
+	}
+}
+
+// TestIncidentMonitor 测试持续故障超过 after 时只创建一次事故单，且地址中的密钥被去掉
+func TestIncidentMonitor(t *testing.T) {
+	bodies := make(chan []byte, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		Alerts:    &AlertConfig{Channels: map[string]AlertChannel{"tickets": {URL: srv.URL}}},
+		Incidents: &IncidentConfig{After: time.Minute, Channels: []string{"tickets"}},
+	}
+	if err := cfg.Incidents.validate(cfg.Alerts); err != nil {
+		t.Fatal(err)
+	}
+	prev := alertRouting.Swap(newAlertRouter(cfg))
+	defer alertRouting.Store(prev)
+
+	w := &StreamWorker{cfg: StreamConfig{ID: "a", Src: "rtmp://127.0.0.1:1/live/src", Dst: "rtmp://live.example.com/app/SECRET"}}
+	w.lastArgs = []string{"-i", "rtmp://127.0.0.1:1/live/src", "rtmp://live.example.com/app/SECRET"}
+	w.recordError(ErrorCategoryExit, io.ErrUnexpectedEOF)
+	w.stderrTail().add("Connection to tcp://live.example.com:1935 failed")
+	state := &AppState{config: cfg, workers: newWorkerMap(map[string]*StreamWorker{"a": w})}
+	m := newIncidentMonitor(state)
+
+	now := time.Now()
+	m.check(now)
+	m.check(now.Add(30 * time.Second))
+	m.check(now.Add(2 * time.Minute))
+	m.check(now.Add(3 * time.Minute))
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(30 * time.Second):
+		t.Fatal("no incident sent")
+	}
+	var inc incident
+	if err := json.Unmarshal(body, &inc); err != nil {
+		t.Fatalf("invalid incident %s: %v", body, err)
+	}
+	if inc.StreamID != "a" || len(inc.Stderr) != 1 || len(inc.History) != 1 || inc.LastError == nil {
+		t.Errorf("unexpected incident %s", body)
+	}
+	if strings.Contains(inc.Command, "SECRET") {
+		t.Errorf("command not redacted: %s", inc.Command)
+	}
+	select {
+	case body = <-bodies:
+		t.Errorf("incident sent twice: %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// inventoryStream 是 Ansible 清单中一路流的信息。
+// 只包含源和目标的主机部分，推流密钥通常在路径中，不能出现在未认证的接口上。
+type inventoryStream struct {
+	ID      string            `json:"id"`
+	Running bool              `json:"running"`
+	Region  string            `json:"region,omitempty"`
+	SrcHost string            `json:"src_host,omitempty"`
+	DstHost string            `json:"dst_host,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// inventoryGroupInvalid 匹配 Ansible 组名中不允许的字符。
+var inventoryGroupInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// inventoryGroup 返回带 stream_runner 前缀的组名，不允许的字符替换为下划线。
+func inventoryGroup(parts ...string) string {
+	name := strings.Join(append([]string{"stream_runner"}, parts...), "_")
+	return inventoryGroupInvalid.ReplaceAllString(strings.ToLower(name), "_")
+}
+
+// buildInventory 生成 Ansible 动态清单（ansible-inventory --list 的 JSON 格式）。
+// 本机是唯一的主机，按区域和流标签分组，流信息放在主机变量 stream_runner_streams 中。
+func buildInventory(host string, cfg *Config, snaps []workerSnapshot) jsonObject {
+	running := make(map[string]bool, len(snaps))
+	endpoints := make(map[string]string, len(snaps))
+	for _, s := range snaps {
+		running[s.id] = s.running
+		endpoints[s.id] = s.endpoint
+	}
+
+	groups := map[string]bool{inventoryGroup(): true}
+	streams := make([]inventoryStream, 0)
+	region := ""
+	if cfg != nil {
+		region = cfg.Region
+		for _, s := range cfg.Streams {
+			dst := endpoints[s.ID]
+			if dst == "" {
+				dst = s.Dst
+			}
+			streams = append(streams, inventoryStream{
+				ID:      s.ID,
+				Running: running[s.ID],
+				Region:  s.Region,
+				SrcHost: endpointHost(s.Src),
+				DstHost: endpointHost(dst),
+				Labels:  s.Labels,
+			})
+			for k, v := range s.Labels {
+				groups[inventoryGroup("label", k, v)] = true
+			}
+		}
+	}
+	if region != "" {
+		groups[inventoryGroup("region", region)] = true
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].ID < streams[j].ID })
+
+	inv := jsonObject{
+		"_meta": jsonObject{"hostvars": jsonObject{host: jsonObject{
+			"stream_runner_version": currentBuildInfo().Version,
+			"stream_runner_region":  region,
+			"stream_runner_streams": streams,
+		}}},
+	}
+	for name := range groups {
+		inv[name] = jsonObject{"hosts": []string{host}}
+	}
+	inv["all"] = jsonObject{"children": sortedKeys(groups)}
+	return inv
+}
+
+// sortedKeys 返回排序后的 map 键。
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleInventory 处理 GET /inventory，主机名默认为本机 hostname，可用 ?host= 覆盖。
+func handleInventory(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			var err error
+			if host, err = os.Hostname(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		state.mu.RLock()
+		cfg := state.config
+		state.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildInventory(host, cfg, snapshotWorkers(state))); err != nil {
+			slog.Warn("failed to write inventory", "error", err)
+		}
+	}
+}
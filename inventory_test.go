@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestBuildInventory 测试清单的分组和主机变量，且不包含推流密钥
+func TestBuildInventory(t *testing.T) {
+	cfg := &Config{Region: "cn-east", Streams: []StreamConfig{
+		{ID: "b", Src: "rtmp://src.example.com/live/b", Dst: "rtmp://ingest.example.com/live/secret-key", Labels: map[string]string{"team": "news-ops"}},
+		{ID: "a", Src: "rtmp://src.example.com/live/a", Dst: "rtmp://x/live/a"},
+	}}
+	snaps := []workerSnapshot{{id: "b", running: true, endpoint: "rtmp://backup.example.com/live/secret-key"}}
+	data, err := json.Marshal(buildInventory("edge-1", cfg, snaps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Error("inventory must not contain stream keys")
+	}
+
+	var inv struct {
+		All  struct{ Children []string } `json:"all"`
+		Meta struct {
+			Hostvars map[string]struct {
+				Streams []inventoryStream `json:"stream_runner_streams"`
+			} `json:"hostvars"`
+		} `json:"_meta"`
+		Label struct{ Hosts []string } `json:"stream_runner_label_team_news_ops"`
+	}
+	if err := json.Unmarshal(data, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if want := "stream_runner,stream_runner_label_team_news_ops,stream_runner_region_cn_east"; strings.Join(inv.All.Children, ",") != want {
+		t.Errorf("unexpected groups %v", inv.All.Children)
+	}
+	if len(inv.Label.Hosts) != 1 || inv.Label.Hosts[0] != "edge-1" {
+		t.Errorf("unexpected label group hosts %v", inv.Label.Hosts)
+	}
+	streams := inv.Meta.Hostvars["edge-1"].Streams
+	if len(streams) != 2 || streams[0].ID != "a" || !streams[1].Running || streams[1].DstHost != "backup.example.com" {
+		t.Errorf("unexpected streams %+v", streams)
+	}
+}
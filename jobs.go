@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultJobConcurrency 是同时运行的任务数默认值。
+	DefaultJobConcurrency = 1
+	// DefaultJobRetention 是已结束任务的默认保留时间。
+	DefaultJobRetention = 24 * time.Hour
+)
+
+// 任务状态。
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// jobInputSchemes 是任务输入允许的网络协议，其余输入必须是 dirs 中的本地文件。
+var jobInputSchemes = []string{"rtmp", "rtmps", "http", "https", "srt"}
+
+// JobsConfig 表示一次性转码/转封装任务的配置。
+type JobsConfig struct {
+	// Dirs 是任务可以读写的本地目录，本地输入和所有输出都必须在其中。
+	Dirs []string `yaml:"dirs"`
+	// MaxConcurrent 是同时运行的任务数，默认 1，其余任务排队。支持热重载。
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+	// Retention 是已结束任务在列表中保留的时间，默认 24h。
+	Retention time.Duration `yaml:"retention,omitempty"`
+	// Sandbox 是任务 ffmpeg 子进程的加固配置（可选），与流的 sandbox 相同。
+	Sandbox *SandboxConfig `yaml:"sandbox,omitempty"`
+}
+
+// validate 校验任务配置。
+func (c *JobsConfig) validate() error {
+	if len(c.Dirs) == 0 {
+		return fmt.Errorf("dirs is required")
+	}
+	for _, d := range c.Dirs {
+		if !filepath.IsAbs(d) {
+			return fmt.Errorf("dir %s must be absolute", d)
+		}
+		if info, err := os.Stat(d); err != nil || !info.IsDir() {
+			return fmt.Errorf("dir %s must be an existing directory", d)
+		}
+	}
+	if c.MaxConcurrent < 0 || c.Retention < 0 {
+		return fmt.Errorf("max_concurrent and retention must not be negative")
+	}
+	if c.Sandbox != nil {
+		if err := c.Sandbox.validate(); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// withDefaults 返回填充了默认值的副本。
+func (c JobsConfig) withDefaults() JobsConfig {
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = DefaultJobConcurrency
+	}
+	if c.Retention == 0 {
+		c.Retention = DefaultJobRetention
+	}
+	return c
+}
+
+// inDirs 判断 path 是否位于 dirs 中的某个目录之下。
+func inDirs(path string, dirs []string) bool {
+	for _, d := range dirs {
+		rel, err := filepath.Rel(filepath.Clean(d), path)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobRequest 是 POST /jobs 的请求正文。
+type jobRequest struct {
+	// Input 是输入文件的绝对路径或 rtmp/http/srt 地址。
+	Input string `json:"input"`
+	// Output 是输出文件的绝对路径，封装格式由扩展名决定。
+	Output string `json:"output"`
+	// Profile 是转码配置名，为空时只转封装（-c copy）。
+	Profile string `json:"profile,omitempty"`
+	// Overwrite 表示输出文件已存在时覆盖，默认拒绝。
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// validate 校验任务请求，dirs 是允许读写的目录。
+func (r *jobRequest) validate(dirs []string) error {
+	if u, err := url.Parse(r.Input); err == nil && u.Scheme != "" {
+		if !containsString(jobInputSchemes, strings.ToLower(u.Scheme)) {
+			return fmt.Errorf("input scheme %q is not allowed", u.Scheme)
+		}
+	} else {
+		if !filepath.IsAbs(r.Input) {
+			return fmt.Errorf("input must be an absolute path or a URL")
+		}
+		r.Input = filepath.Clean(r.Input)
+		if !inDirs(r.Input, dirs) {
+			return fmt.Errorf("input must be inside jobs.dirs")
+		}
+	}
+	if !filepath.IsAbs(r.Output) {
+		return fmt.Errorf("output must be an absolute path")
+	}
+	r.Output = filepath.Clean(r.Output)
+	if !inDirs(r.Output, dirs) {
+		return fmt.Errorf("output must be inside jobs.dirs")
+	}
+	if r.Output == r.Input {
+		return fmt.Errorf("output must differ from input")
+	}
+	if r.Profile != "" && lookupTranscodeProfile(r.Profile) == nil {
+		return fmt.Errorf("unknown transcode profile %q", r.Profile)
+	}
+	return nil
+}
+
+// args 返回任务的 ffmpeg 参数。
+func (r *jobRequest) args() []string {
+	args := []string{"-nostdin", "-progress", "pipe:1", "-n"}
+	if r.Overwrite {
+		args[3] = "-y"
+	}
+	input := r.Input
+	if filepath.IsAbs(input) {
+		// Keep ffmpeg from reading a protocol prefix out of a file name.
+		input = "file:" + input
+	}
+	args = append(args, "-i", input)
+	if p := lookupTranscodeProfile(r.Profile); p != nil {
+		args = append(args, p.videoArgs(nil, nil)...)
+		args = append(args, p.audioArgs()...)
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	return append(args, "file:"+r.Output)
+}
+
+// jobProgress 是任务的进度。
+type jobProgress struct {
+	// OutTimeSeconds 是已处理的媒体时长。
+	OutTimeSeconds float64 `json:"out_time_seconds"`
+	// DurationSeconds 是输入的总时长，未知时为 0。
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Percent 是完成百分比，总时长未知时省略。
+	Percent float64 `json:"percent,omitempty"`
+	Speed   float64 `json:"speed"`
+	// SizeBytes 是已输出的字节数。
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// 任务类型。
+const (
+	// JobKindArchive 是节目结束后上传录制文件的归档任务，普通的 ffmpeg 任务类型为空。
+	JobKindArchive = "archive"
+)
+
+// jobInfo 是任务在管理接口中的表示。
+type jobInfo struct {
+	ID string `json:"id"`
+	// Kind 是任务类型，ffmpeg 转码/转封装任务为空。
+	Kind string `json:"kind,omitempty"`
+	// StreamID 是产生归档任务的流。
+	StreamID   string      `json:"stream_id,omitempty"`
+	Input      string      `json:"input"`
+	Output     string      `json:"output"`
+	Profile    string      `json:"profile,omitempty"`
+	State      string      `json:"state"`
+	Error      string      `json:"error,omitempty"`
+	Progress   jobProgress `json:"progress"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// job 是一个一次性任务，字段由 jobQueue.mu 保护。
+type job struct {
+	info jobInfo
+	req  jobRequest
+	cmd  *exec.Cmd
+	// upload 是归档任务的上传函数，返回上传后的位置；为 nil 时任务运行 ffmpeg。
+	upload func(ctx context.Context, progress func(sent, total int64)) (string, error)
+	// stop 取消运行中的上传。
+	stop context.CancelFunc
+	// done 在任务结束后调用（可选）。
+	done func(info jobInfo)
+	// canceled 表示任务被取消，运行中的 ffmpeg 退出后不再记为失败。
+	canceled bool
+}
+
+// jobQueue 按提交顺序运行任务，同时运行的任务数受 jobs.max_concurrent 限制。
+type jobQueue struct {
+	state   *AppState
+	mu      sync.Mutex
+	jobs    map[string]*job
+	order   []string
+	running int
+}
+
+// jobs 是当前的任务队列，在 run 中创建。
+var jobs atomic.Pointer[jobQueue]
+
+// newJobQueue 创建任务队列。
+func newJobQueue(state *AppState) *jobQueue {
+	return &jobQueue{state: state, jobs: make(map[string]*job)}
+}
+
+// jobsConfig 返回当前生效的任务配置，未配置时返回 nil。
+func jobsConfig(state *AppState) *JobsConfig {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.config == nil || state.config.Jobs == nil {
+		return nil
+	}
+	c := state.config.Jobs.withDefaults()
+	return &c
+}
+
+// newJobID 返回随机的任务 ID。
+func newJobID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	return "job-" + hex.EncodeToString(b)
+}
+
+// submit 校验并提交任务。
+func (q *jobQueue) submit(cfg *JobsConfig, req jobRequest, now time.Time) (jobInfo, error) {
+	if err := req.validate(cfg.Dirs); err != nil {
+		return jobInfo{}, err
+	}
+	j := &job{req: req, info: jobInfo{
+		ID: newJobID(), Input: req.Input, Output: req.Output, Profile: req.Profile,
+		State: JobQueued, CreatedAt: now,
+	}}
+	return q.enqueue(cfg, j, now), nil
+}
+
+// enqueue 把任务加入队列并调度。
+func (q *jobQueue) enqueue(cfg *JobsConfig, j *job, now time.Time) jobInfo {
+	q.mu.Lock()
+	q.jobs[j.info.ID] = j
+	q.order = append(q.order, j.info.ID)
+	info := j.info
+	q.mu.Unlock()
+	slog.Info("job queued", "job_id", info.ID, "kind", info.Kind, "input", info.Input, "output", info.Output, "profile", info.Profile)
+	q.dispatch(cfg, now)
+	return info
+}
+
+// dispatch 启动排队中的任务直到达到并发上限，并清理超过保留时间的已结束任务。
+func (q *jobQueue) dispatch(cfg *JobsConfig, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	order := q.order[:0]
+	for _, id := range q.order {
+		j, ok := q.jobs[id]
+		if !ok {
+			continue
+		}
+		if j.info.FinishedAt != nil && now.Sub(*j.info.FinishedAt) > cfg.Retention {
+			delete(q.jobs, id)
+			continue
+		}
+		order = append(order, id)
+		if j.info.State == JobQueued && q.running < cfg.MaxConcurrent {
+			j.info.State = JobRunning
+			started := now
+			j.info.StartedAt = &started
+			q.running++
+			go q.run(j, cfg.Sandbox)
+		}
+	}
+	q.order = order
+}
+
+// run 运行一个任务的 ffmpeg，结束后调度下一个任务。
+func (q *jobQueue) run(j *job, sandbox *SandboxConfig) {
+	var err error
+	if j.upload != nil {
+		err = q.execUpload(j)
+	} else {
+		err = q.exec(j, sandbox)
+	}
+
+	q.mu.Lock()
+	now := time.Now()
+	j.info.FinishedAt = &now
+	j.cmd = nil
+	switch {
+	case j.canceled:
+		j.info.State = JobCanceled
+	case err != nil:
+		j.info.State = JobFailed
+		j.info.Error = err.Error()
+	default:
+		j.info.State = JobSucceeded
+		if j.info.Progress.DurationSeconds > 0 {
+			j.info.Progress.Percent = 100
+		}
+	}
+	q.running--
+	info := j.info
+	q.mu.Unlock()
+
+	if err != nil && info.State == JobFailed {
+		slog.Error("job failed", "job_id", info.ID, "error", err)
+	} else {
+		slog.Info("job finished", "job_id", info.ID, "state", info.State)
+	}
+	if j.done != nil {
+		j.done(info)
+	}
+	if cfg := jobsConfig(q.state); cfg != nil {
+		q.dispatch(cfg, now)
+	}
+}
+
+// exec 启动 ffmpeg 并等待退出，ffmpeg 输出按流日志的格式记录，日志中的流 ID 为任务 ID。
+func (q *jobQueue) exec(j *job, sandbox *SandboxConfig) error {
+	var duration time.Duration
+	if !strings.Contains(j.req.Input, "://") {
+		// Only files have a known length; probing a live URL would just time out.
+		if out, err := runFFprobe(sandbox, probeTimeout, []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", "file:" + j.req.Input}); err == nil {
+			if probe, err := parseProbeOutput(out); err == nil {
+				duration = probe.Duration
+			}
+		}
+	}
+	q.mu.Lock()
+	j.info.Progress.DurationSeconds = duration.Seconds()
+	canceled := j.canceled
+	q.mu.Unlock()
+	if canceled {
+		return nil
+	}
+
+	cmd, err := newFFmpegCommand(StreamConfig{ID: j.info.ID, Sandbox: sandbox}, j.req.args())
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = &progressWriter{onProgress: func(p ffmpegProgress) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		pr := &j.info.Progress
+		pr.OutTimeSeconds = p.OutTime.Seconds()
+		pr.Speed = p.Speed
+		pr.SizeBytes = p.TotalSize
+		if duration > 0 {
+			pr.Percent = min(100, 100*p.OutTime.Seconds()/duration.Seconds())
+		}
+	}}
+	cmd.Stderr = &StreamLogWriter{streamID: j.info.ID, writer: os.Stderr}
+
+	q.mu.Lock()
+	if j.canceled {
+		q.mu.Unlock()
+		return nil
+	}
+	slog.Info("starting job", "job_id", j.info.ID)
+	if err := cmd.Start(); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	j.cmd = cmd
+	q.mu.Unlock()
+	return cmd.Wait()
+}
+
+// execUpload 运行归档任务的上传，进度按已发送的字节数计算。
+func (q *jobQueue) execUpload(j *job) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.mu.Lock()
+	if j.canceled {
+		q.mu.Unlock()
+		return nil
+	}
+	j.stop = cancel
+	q.mu.Unlock()
+
+	slog.Info("starting upload", "job_id", j.info.ID, "input", j.info.Input, "output", j.info.Output)
+	location, err := j.upload(ctx, func(sent, total int64) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		pr := &j.info.Progress
+		pr.SizeBytes = sent
+		if total > 0 {
+			pr.Percent = min(100, 100*float64(sent)/float64(total))
+		}
+	})
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.stop = nil
+	if err == nil && location != "" {
+		j.info.Output = location
+	}
+	if j.canceled {
+		return nil
+	}
+	return err
+}
+
+// cancel 取消排队或运行中的任务，已结束的任务从列表中删除。任务不存在时返回 false。
+func (q *jobQueue) cancel(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return false
+	}
+	switch j.info.State {
+	case JobQueued:
+		now := time.Now()
+		j.canceled = true
+		j.info.State = JobCanceled
+		j.info.FinishedAt = &now
+	case JobRunning:
+		j.canceled = true
+		if j.stop != nil {
+			j.stop()
+		}
+		if j.cmd != nil && j.cmd.Process != nil {
+			if err := syscall.Kill(-j.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+				slog.Warn("failed to kill job", "job_id", id, "error", err)
+			}
+		}
+	default:
+		delete(q.jobs, id)
+	}
+	slog.Info("job canceled", "job_id", id)
+	return true
+}
+
+// forgetStream 取消流产生的归档任务并删除已结束的任务，返回涉及的任务数。
+// 仍在退出中的任务保留在列表中，但不再含有流 ID 和文件位置。
+func (q *jobQueue) forgetStream(streamID string) int {
+	q.mu.Lock()
+	var ids []string
+	for id, j := range q.jobs {
+		if j.info.StreamID == streamID {
+			ids = append(ids, id)
+		}
+	}
+	q.mu.Unlock()
+	for _, id := range ids {
+		q.cancel(id)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		if j, ok := q.jobs[id]; ok {
+			j.info.StreamID, j.info.Input, j.info.Output = "", "purged", "purged"
+		}
+	}
+	return len(ids)
+}
+
+// list 返回所有任务，按提交顺序排列。
+func (q *jobQueue) list() []jobInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]jobInfo, 0, len(q.order))
+	for _, id := range q.order {
+		if j, ok := q.jobs[id]; ok {
+			out = append(out, j.info)
+		}
+	}
+	return out
+}
+
+// get 返回指定任务。
+func (q *jobQueue) get(id string) (jobInfo, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return jobInfo{}, false
+	}
+	return j.info, true
+}
+
+// handleJobs 处理 /jobs：GET 列出、POST 提交、GET /jobs/{id} 查询、DELETE /jobs/{id} 取消或删除。
+func handleJobs(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := jobs.Load()
+		cfg := jobsConfig(state)
+		if q == nil || cfg == nil {
+			writeAPIError(w, http.StatusNotFound, "jobs is not configured")
+			return
+		}
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			q.dispatch(cfg, time.Now())
+			writeAPIJSON(w, http.StatusOK, q.list())
+		case r.Method == http.MethodGet:
+			info, ok := q.get(id)
+			if !ok {
+				writeAPIError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", id))
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, info)
+		case r.Method == http.MethodPost && id == "":
+			var req jobRequest
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			info, err := q.submit(cfg, req, time.Now())
+			if err != nil {
+				writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			writeAPIJSON(w, http.StatusAccepted, info)
+		case r.Method == http.MethodDelete && id != "":
+			// Like temporary streams, deleting a missing job succeeds so retries are safe.
+			q.cancel(id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJobRequestValidate 测试任务的输入输出只能位于允许的目录或使用允许的协议
+func TestJobRequestValidate(t *testing.T) {
+	dirs := []string{"/srv/media"}
+	cases := []struct {
+		req jobRequest
+		ok  bool
+	}{
+		{jobRequest{Input: "/srv/media/in.flv", Output: "/srv/media/out.mp4"}, true},
+		{jobRequest{Input: "rtmp://src.example.com/live/a", Output: "/srv/media/a.mp4"}, true},
+		{jobRequest{Input: "/srv/media/../../etc/passwd", Output: "/srv/media/out.mp4"}, false},
+		{jobRequest{Input: "/srv/media-other/in.flv", Output: "/srv/media/out.mp4"}, false},
+		{jobRequest{Input: "/srv/media/in.flv", Output: "/tmp/out.mp4"}, false},
+		{jobRequest{Input: "/srv/media/in.flv", Output: "out.mp4"}, false},
+		{jobRequest{Input: "/srv/media/in.flv", Output: "/srv/media/in.flv"}, false},
+		{jobRequest{Input: "concat:/etc/passwd", Output: "/srv/media/out.mp4"}, false},
+		{jobRequest{Input: "/srv/media/in.flv", Output: "/srv/media/out.mp4", Profile: "missing"}, false},
+	}
+	for _, c := range cases {
+		req := c.req
+		if err := req.validate(dirs); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c.req, err)
+		}
+	}
+
+	req := jobRequest{Input: "/srv/media/in.flv", Output: "/srv/media/out.mp4"}
+	if got := strings.Join(req.args(), " "); got != "-nostdin -progress pipe:1 -n -i file:/srv/media/in.flv -c copy file:/srv/media/out.mp4" {
+		t.Errorf("unexpected args %q", got)
+	}
+}
+
+// TestJobQueueCancel 测试排队中的任务可以取消，已结束的任务在保留时间后被清理
+func TestJobQueueCancel(t *testing.T) {
+	q := newJobQueue(&AppState{})
+	// Zero concurrency keeps jobs queued without starting ffmpeg.
+	cfg := &JobsConfig{Dirs: []string{"/srv/media"}, Retention: time.Hour}
+	now := time.Now()
+	info, err := q.submit(cfg, jobRequest{Input: "/srv/media/in.flv", Output: "/srv/media/out.mp4"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != JobQueued {
+		t.Fatalf("unexpected state %s", info.State)
+	}
+	if !q.cancel(info.ID) {
+		t.Fatal("cancel returned false")
+	}
+	if got, _ := q.get(info.ID); got.State != JobCanceled {
+		t.Errorf("unexpected state after cancel %s", got.State)
+	}
+	q.dispatch(cfg, now.Add(2*time.Hour))
+	if len(q.list()) != 0 {
+		t.Error("finished job not removed after retention")
+	}
+}
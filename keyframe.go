@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keyframeTolerance 是校验关键帧间隔时允许的误差，吸收时间戳取整带来的偏差。
+const keyframeTolerance = 50 * time.Millisecond
+
+// computeKeyframeInterval 根据 ffprobe 输出的视频包计算观测到的最大关键帧间隔。
+func computeKeyframeInterval(data []byte) (time.Duration, error) {
+	var raw struct {
+		Packets []struct {
+			PTSTime string `json:"pts_time"`
+			Flags   string `json:"flags"`
+		} `json:"packets"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	var keyframes []float64
+	for _, p := range raw.Packets {
+		if !strings.Contains(p.Flags, "K") {
+			continue
+		}
+		pts, err := strconv.ParseFloat(p.PTSTime, 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, pts)
+	}
+	if len(keyframes) < 2 {
+		return 0, fmt.Errorf("fewer than two keyframes observed")
+	}
+	var max float64
+	for i := 1; i < len(keyframes); i++ {
+		if d := keyframes[i] - keyframes[i-1]; d > max {
+			max = d
+		}
+	}
+	return time.Duration(max * float64(time.Second)), nil
+}
+
+// measureKeyframeInterval 读取源流视频包并返回最大关键帧间隔。
+func measureKeyframeInterval(cfg StreamConfig, ep *resolvedEndpoints, window time.Duration) (time.Duration, error) {
+	args := append(probeInputArgs(cfg, ep),
+		"-select_streams", "v:0",
+		"-read_intervals", fmt.Sprintf("%%+%g", window.Seconds()),
+		"-show_entries", "packet=pts_time,flags",
+		ep.Src,
+	)
+	out, err := runFFprobe(cfg.Sandbox, window+probeTimeout, args)
+	if err != nil {
+		return 0, err
+	}
+	return computeKeyframeInterval(out)
+}
+
+// verifyKeyframes 在复制模式下校验源流的关键帧间隔。
+// 超过配置的间隔时，如果有转码配置则回退到转码并强制关键帧，否则只发出事件。
+func verifyKeyframes(cfg StreamConfig, ep *resolvedEndpoints, plan outputPlan, profile *TranscodeProfile) outputPlan {
+	// Sample at least two full intervals so one GOP boundary is always seen.
+	got, err := measureKeyframeInterval(cfg, ep, 3*cfg.KeyframeInterval)
+	if err != nil {
+		slog.Warn("keyframe interval check failed", "stream_id", cfg.ID, "error", err)
+		return plan
+	}
+	if got <= cfg.KeyframeInterval+keyframeTolerance {
+		return plan
+	}
+	if profile == nil {
+		emitEvent(cfg.ID, "keyframe_interval_exceeded", got, cfg.KeyframeInterval)
+		return plan
+	}
+	emitEvent(cfg.ID, "keyframe_fallback", got, cfg.KeyframeInterval, cfg.TranscodeFallback)
+	plan.Profile = profile
+	plan.TranscodeVideo = true
+	plan.Fallback = true
+	return plan
+}
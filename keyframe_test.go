@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestComputeKeyframeInterval 测试最大关键帧间隔计算
+func TestComputeKeyframeInterval(t *testing.T) {
+	data := []byte(`{"packets": [
+		{"pts_time": "0.000000", "flags": "K__"},
+		{"pts_time": "1.000000", "flags": "___"},
+		{"pts_time": "2.000000", "flags": "K__"},
+		{"pts_time": "6.000000", "flags": "K__"}
+	]}`)
+	got, err := computeKeyframeInterval(data)
+	if err != nil {
+		t.Fatalf("computeKeyframeInterval failed: %v", err)
+	}
+	if got != 4*time.Second {
+		t.Errorf("interval = %s, want 4s", got)
+	}
+	if _, err := computeKeyframeInterval([]byte(`{"packets": [{"pts_time": "0.0", "flags": "K__"}]}`)); err == nil {
+		t.Error("expected error with a single keyframe")
+	}
+}
+
+// TestForceKeyFrames 测试转码时强制关键帧间隔
+func TestForceKeyFrames(t *testing.T) {
+	plan := outputPlan{Format: "flv", Profile: &TranscodeProfile{}, TranscodeVideo: true, KeyframeInterval: 2 * time.Second}
+	joined := strings.Join(plan.codecArgs(), " ")
+	if !strings.Contains(joined, "-force_key_frames expr:gte(t,n_forced*2)") {
+		t.Errorf("expected forced keyframes, got %s", joined)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 工作器生命周期事件的类型。
+const (
+	// LifecycleStarting 表示即将启动 ffmpeg。
+	LifecycleStarting = "starting"
+	// LifecycleStarted 表示 ffmpeg 已启动。
+	LifecycleStarted = "started"
+	// LifecycleExited 表示 ffmpeg 已退出或启动失败。
+	LifecycleExited = "exited"
+	// LifecycleRestarting 表示 ffmpeg 退出后等待重试。
+	LifecycleRestarting = "restarting"
+	// LifecycleKilled 表示 ffmpeg 被主动终止（重载、看门狗、节目表等）。
+	LifecycleKilled = "killed"
+)
+
+// lifecycleBuffer 是每个订阅者缓冲的事件数，缓冲满时断开订阅者，避免拖慢工作器。
+const lifecycleBuffer = 256
+
+// LifecycleEvent 是推送给 /events 订阅者的工作器生命周期事件。
+type LifecycleEvent struct {
+	// Type 是事件类型：starting、started、exited、restarting、killed。
+	Type string `json:"type"`
+	// StreamID 是事件所属的流。
+	StreamID string `json:"stream_id"`
+	// Time 是事件发生时间。
+	Time time.Time `json:"time"`
+	// ExitCode 是 ffmpeg 的退出码，只用于 exited；被信号终止时为 -1，启动失败时为空。
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Retries 是首次启动之后的重启次数。
+	Retries int64 `json:"retries"`
+	// RetryIn 是 restarting 事件中距下次启动的等待时长。
+	RetryIn string `json:"retry_in,omitempty"`
+	// Error 是退出或启动失败的原因。
+	Error string `json:"error,omitempty"`
+}
+
+// lifecycleHub 把生命周期事件分发给各订阅者。
+type lifecycleHub struct {
+	mu   sync.Mutex
+	subs map[chan LifecycleEvent]struct{}
+}
+
+// lifecycle 是全局的生命周期事件分发器。
+var lifecycle = &lifecycleHub{subs: make(map[chan LifecycleEvent]struct{})}
+
+// subscribe 注册订阅者，返回事件通道和取消函数。通道在取消或订阅者跟不上时关闭。
+func (h *lifecycleHub) subscribe() (<-chan LifecycleEvent, func()) {
+	ch := make(chan LifecycleEvent, lifecycleBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish 发送事件，不阻塞：缓冲已满的订阅者被断开，由客户端重连后通过 /status 补齐状态。
+func (h *lifecycleHub) publish(ev LifecycleEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("lifecycle subscriber too slow, disconnecting", "buffer", lifecycleBuffer)
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishLifecycle 发布工作器的生命周期事件，重启次数取自工作器的统计。
+func (w *StreamWorker) publishLifecycle(ev LifecycleEvent) {
+	w.mu.Lock()
+	ev.StreamID = w.cfg.ID
+	ev.Retries = w.stats.Restarts
+	w.mu.Unlock()
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	lifecycle.publish(ev)
+}
+
+// handleLifecycleEvents 处理 GET /events：升级为 WebSocket 后以 JSON 文本帧推送生命周期事件。
+// 参数 stream 是逗号分隔的流 ID，只推送这些流的事件。
+func handleLifecycleEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var streams map[string]bool
+		if s := r.URL.Query().Get("stream"); s != "" {
+			streams = make(map[string]bool)
+			for _, id := range strings.Split(s, ",") {
+				streams[strings.TrimSpace(id)] = true
+			}
+		}
+		conn, err := upgradeWebSocket(w, r, func(origin string) bool { return allowEventsOrigin(r, origin) })
+		if err != nil {
+			slog.Info("rejected events subscription", "remote", r.RemoteAddr, "error", err)
+			return
+		}
+		events, cancel := lifecycle.subscribe()
+		defer cancel()
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			if err := conn.readLoop(); err != nil {
+				slog.Debug("events subscriber disconnected", "remote", r.RemoteAddr, "error", err)
+			}
+		}()
+		slog.Info("events subscriber connected", "remote", r.RemoteAddr)
+		for {
+			select {
+			case <-closed:
+				conn.conn.Close()
+				return
+			case ev, ok := <-events:
+				if !ok {
+					// 1008 policy violation: the subscriber fell too far behind.
+					conn.close(1008)
+					return
+				}
+				if streams != nil && !streams[ev.StreamID] {
+					continue
+				}
+				data, err := json.Marshal(ev)
+				if err != nil {
+					slog.Warn("failed to encode lifecycle event", "error", err)
+					continue
+				}
+				if err := conn.writeText(data); err != nil {
+					slog.Info("events subscriber disconnected", "remote", r.RemoteAddr, "error", err)
+					conn.conn.Close()
+					return
+				}
+			}
+		}
+	}
+}
+
+// allowEventsOrigin 判断浏览器能否从 origin 订阅事件。只允许同源：仪表盘的会话 Cookie 会随跨站的 WebSocket 请求发送，
+// metrics.cors 属于未认证的指标服务，不适用于这里。
+func allowEventsOrigin(r *http.Request, origin string) bool {
+	host := origin
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	return strings.EqualFold(host, r.Host)
+}
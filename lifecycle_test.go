@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stream-runner/client"
+)
+
+// TestLifecycleEvents 测试通过 WebSocket 订阅生命周期事件，按 stream 过滤并应答 ping
+func TestLifecycleEvents(t *testing.T) {
+	srv := httptest.NewServer(newAPIMux(&AppState{workers: newWorkerMap(nil)}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET /events?stream=a HTTP/1.1\r\nHost: " + addr + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\nOrigin: http://" + addr + "\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// The subscription is registered after the handshake; publish until it is.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lifecycle.mu.Lock()
+		n := len(lifecycle.subs)
+		lifecycle.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	code := 1
+	lifecycle.publish(LifecycleEvent{Type: LifecycleStarted, StreamID: "b"})
+	lifecycle.publish(LifecycleEvent{Type: LifecycleExited, StreamID: "a", ExitCode: &code, Retries: 3})
+
+	op, payload := readServerFrame(t, br)
+	var ev LifecycleEvent
+	if err := json.Unmarshal(payload, &ev); err != nil || op != wsOpText {
+		t.Fatalf("frame %x %q: %v", op, payload, err)
+	}
+	if ev.StreamID != "a" || ev.Type != LifecycleExited || ev.ExitCode == nil || *ev.ExitCode != 1 || ev.Retries != 3 {
+		t.Errorf("event = %+v", ev)
+	}
+
+	// A masked ping is answered with a pong carrying the same payload.
+	mask := []byte{1, 2, 3, 4}
+	ping := []byte{0x80 | wsOpPing, 0x80 | 2}
+	ping = append(ping, mask...)
+	ping = append(ping, 'h'^mask[0], 'i'^mask[1])
+	if _, err := conn.Write(ping); err != nil {
+		t.Fatal(err)
+	}
+	if op, payload := readServerFrame(t, br); op != wsOpPong || string(payload) != "hi" {
+		t.Errorf("pong = %x %q", op, payload)
+	}
+
+	// Other origins and plain requests are rejected.
+	for _, h := range []map[string]string{
+		{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Key": key, "Sec-WebSocket-Version": "13", "Origin": "https://evil.example.com"},
+		{},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusUpgradeRequired {
+			t.Errorf("%v: %d", h, resp.StatusCode)
+		}
+	}
+}
+
+// TestLifecycleEventsClient 测试 Go 客户端订阅事件：按流过滤，取消 ctx 后返回
+func TestLifecycleEventsClient(t *testing.T) {
+	srv := httptest.NewServer(newAPIMux(&AppState{workers: newWorkerMap(nil)}))
+	defer srv.Close()
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan client.Event, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.WatchEvents(ctx, []string{"a"}, func(ev client.Event) error {
+			select {
+			case events <- ev:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// The subscription is registered after the handshake, and other tests may leave subscribers
+	// behind, so publish until the event arrives.
+	deadline := time.After(5 * time.Second)
+	for got := false; !got; {
+		lifecycle.publish(LifecycleEvent{Type: LifecycleStarted, StreamID: "b"})
+		lifecycle.publish(LifecycleEvent{Type: LifecycleRestarting, StreamID: "a", RetryIn: "4s", Retries: 2})
+		select {
+		case ev := <-events:
+			if ev.StreamID != "a" || ev.Type != LifecycleRestarting || ev.RetryIn != "4s" || ev.Retries != 2 {
+				t.Errorf("event = %+v", ev)
+			}
+			got = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event")
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WatchEvents returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchEvents did not return after cancel")
+	}
+}
+
+// readServerFrame 读取服务端发送的一个不带掩码的短帧。
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		t.Fatal(err)
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(br, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = int(ext[0])<<8 | int(ext[1])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logEntry 是内存日志缓冲区中的一条记录。
+type logEntry struct {
+	level    slog.Level
+	streamID string
+	// data 是一行 JSON 格式的日志记录，不含换行。
+	data []byte
+}
+
+// logBuffer 是只保留最近若干字节日志的内存环形缓冲区，用于 /logs 接口。
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []logEntry
+	size    int
+	limit   int
+}
+
+// logRing 是守护进程的内存日志缓冲区，未配置时为空。
+var logRing atomic.Pointer[logBuffer]
+
+// newLogBuffer 创建容量为 limit 字节的日志缓冲区。
+func newLogBuffer(limit int) *logBuffer {
+	return &logBuffer{limit: limit}
+}
+
+// add 追加一条记录，超出容量时丢弃最旧的记录。
+func (b *logBuffer) add(e logEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, e)
+	b.size += len(e.data)
+	drop := 0
+	for b.size > b.limit && drop < len(b.entries) {
+		b.size -= len(b.entries[drop].data)
+		drop++
+	}
+	if drop > 0 {
+		// Clear dropped entries so their data can be collected.
+		clear(b.entries[:drop])
+		b.entries = b.entries[drop:]
+	}
+}
+
+// addJSON 追加一条 slog JSON 记录。
+func (b *logBuffer) addJSON(p []byte) {
+	line := bytes.TrimRight(p, "\n")
+	var record struct {
+		Level    string `json:"level"`
+		StreamID string `json:"stream_id"`
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(record.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	b.add(logEntry{level: level, streamID: record.StreamID, data: bytes.Clone(line)})
+}
+
+// addStreamLine 追加一行 ffmpeg 输出，转换为与主日志相同的 JSON 结构。
+func (b *logBuffer) addStreamLine(streamID, line string, t time.Time) {
+	data, err := json.Marshal(map[string]string{
+		"time":      logTimestamp(t),
+		"level":     slog.LevelInfo.String(),
+		"msg":       line,
+		"stream_id": streamID,
+		"source":    "ffmpeg",
+	})
+	if err != nil {
+		return
+	}
+	b.add(logEntry{level: slog.LevelInfo, streamID: streamID, data: data})
+}
+
+// purge 删除属于 streamID 的记录，返回删除的条数。
+func (b *logBuffer) purge(streamID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.entries[:0]
+	for _, e := range b.entries {
+		if e.streamID == streamID {
+			b.size -= len(e.data)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	removed := len(b.entries) - len(kept)
+	clear(b.entries[len(kept):])
+	b.entries = kept
+	return removed
+}
+
+// query 返回符合过滤条件的最近 limit 条记录（limit 为 0 表示不限制），按时间从旧到新排列。
+func (b *logBuffer) query(minLevel slog.Level, streamID string, limit int) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out [][]byte
+	for i := len(b.entries) - 1; i >= 0 && (limit == 0 || len(out) < limit); i-- {
+		e := b.entries[i]
+		if e.level < minLevel || (streamID != "" && e.streamID != streamID) {
+			continue
+		}
+		out = append(out, e.data)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// logSink 在写入日志文件的同时把记录复制到内存缓冲区。
+// slog 的 JSON 处理器每条记录只调用一次 Write，因此每次写入就是一条完整记录。
+type logSink struct {
+	w io.Writer
+}
+
+// Write 实现 io.Writer 接口。
+func (s logSink) Write(p []byte) (int, error) {
+	if r := logRing.Load(); r != nil {
+		r.addJSON(p)
+	}
+	return s.w.Write(p)
+}
+
+// handleLogs 处理 GET /logs：按 level（最低级别）、stream 和 limit 过滤，返回 NDJSON。
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	ring := logRing.Load()
+	if ring == nil {
+		http.Error(w, "log buffer is not enabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	minLevel := slog.LevelDebug
+	if v := q.Get("level"); v != "" {
+		if err := minLevel.UnmarshalText([]byte(strings.ToUpper(v))); err != nil {
+			http.Error(w, fmt.Sprintf("invalid level %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	for _, line := range ring.query(minLevel, q.Get("stream"), limit) {
+		bw.Write(line)
+		bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		slog.Warn("failed to write logs", "error", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLogBuffer 测试内存日志缓冲区的容量淘汰和 /logs 过滤
+func TestLogBuffer(t *testing.T) {
+	ring := newLogBuffer(400)
+	logRing.Store(ring)
+	defer logRing.Store(nil)
+
+	var file bytes.Buffer
+	logger := slog.New(newLogHandler(&file))
+	logger.Info("first", "stream_id", "a")
+	logger.Warn("second", "stream_id", "b")
+	ring.addStreamLine("a", "frame=1", time.Now())
+	logger.Error("third", "stream_id", "a")
+
+	if !strings.Contains(file.String(), "third") {
+		t.Error("records must still reach the log file")
+	}
+	if ring.size > 400 {
+		t.Errorf("buffer size %d exceeds limit", ring.size)
+	}
+	all := ring.query(slog.LevelDebug, "", 0)
+	if strings.Contains(string(all[0]), `"first"`) {
+		t.Error("oldest record should have been evicted")
+	}
+
+	rec := httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest("GET", "/logs?level=warn&stream=a", nil))
+	body := rec.Body.String()
+	if strings.Count(body, "\n") != 1 || !strings.Contains(body, `"msg":"third"`) {
+		t.Errorf("filtered logs = %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest("GET", "/logs?level=loud", nil))
+	if rec.Code != 400 {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logFile 是主日志文件的写入器。slog 处理器在启动时创建一次并一直写入它，轮转只在内部换文件，
+// 因此轮转不需要替换处理器，也不会有记录写进已轮转的旧文件。
+// 写入时超过 settings.log_max_size 即轮转；定期检查处理文件被外部删除或移走的情况。
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	size int64
+}
+
+// mainLog 是守护进程的主日志文件，由 initLog 打开。
+var mainLog = &logFile{}
+
+// logSettingsChanged 在重载修改了日志轮转参数时收到通知，使定期检查立即按新的间隔进行。
+var logSettingsChanged = make(chan struct{}, 1)
+
+// open 打开 path 处的日志文件，已超过大小阈值时先轮转。
+func (l *logFile) open(path string) error {
+	if info, err := os.Stat(path); err == nil && info.Size() >= int64(currentSettings().LogMaxSize) {
+		if err := rotateLogFiles(path, currentSettings().LogMaxFiles); err != nil {
+			// Not critical: keep appending to the oversized file.
+			slog.Warn("log rotation failed", "error", err)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+	return l.reopenLocked()
+}
+
+// reopenLocked 关闭当前文件并重新打开 path，调用方持有 mu。
+func (l *logFile) reopenLocked() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// Write 实现 io.Writer 接口。写入后超过大小阈值时轮转，失败时继续写入当前文件。
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.Stderr.Write(p)
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	if l.size >= int64(currentSettings().LogMaxSize) {
+		if rerr := l.rotateLocked(); rerr != nil {
+			// The logger itself writes here, so report on stderr instead.
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", rerr)
+		}
+	}
+	return n, err
+}
+
+// rotateLocked 轮转日志文件并打开新文件，调用方持有 mu。
+func (l *logFile) rotateLocked() error {
+	if err := rotateLogFiles(l.path, currentSettings().LogMaxFiles); err != nil {
+		return err
+	}
+	return l.reopenLocked()
+}
+
+// purge 删除主日志及其轮转文件中属于 streamID 的行，返回删除的行数。
+// 持有写入锁重写，期间的日志记录等待重写完成后再追加，不会丢失，也不会与轮转同时进行。
+func (l *logFile) purge(streamID string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := 0
+	var errs []error
+	for _, path := range logFiles() {
+		n, err := purgeLogFile(path, streamID)
+		total += n
+		errs = append(errs, err)
+	}
+	if l.f != nil {
+		// The file was rewritten in place; appends continue at its new end.
+		if info, err := l.f.Stat(); err == nil {
+			l.size = info.Size()
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// check 定期检查日志文件：文件被外部删除或移走（如 logrotate）时重新打开，超过大小阈值（如阈值在重载后调小）时轮转。
+func (l *logFile) check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	open, err := l.f.Stat()
+	if err != nil {
+		return err
+	}
+	onDisk, err := os.Stat(l.path)
+	if err != nil || !os.SameFile(open, onDisk) {
+		return l.reopenLocked()
+	}
+	if l.size >= int64(currentSettings().LogMaxSize) {
+		return l.rotateLocked()
+	}
+	return nil
+}
+
+// runLogRotation 按 settings.log_rotate_interval 定期检查主日志，间隔在重载后立即生效。
+func runLogRotation() {
+	for {
+		select {
+		case <-currentClock().After(currentSettings().LogRotateInterval):
+		case <-logSettingsChanged:
+		}
+		if err := mainLog.check(); err != nil {
+			slog.Error("log rotation check failed", "error", err)
+		}
+	}
+}
+
+// notifyLogSettings 在轮转参数变化时唤醒定期检查。
+func notifyLogSettings(old, cur Settings) {
+	if old.LogMaxSize == cur.LogMaxSize && old.LogMaxFiles == cur.LogMaxFiles && old.LogRotateInterval == cur.LogRotateInterval {
+		return
+	}
+	slog.Info("log rotation settings changed", "log_max_size", cur.LogMaxSize, "log_max_files", cur.LogMaxFiles,
+		"log_rotate_interval", cur.LogRotateInterval)
+	select {
+	case logSettingsChanged <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultStreamLogLayout 是未配置 time_format 时 ffmpeg 日志行前缀使用的时间格式。
+	defaultStreamLogLayout = "2006-01-02 15:04:05"
+)
+
+// logTimeFormats 是 time_format 可用的预定义格式名。
+var logTimeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"datetime":    time.DateTime,
+}
+
+// LogConfig 表示日志配置：时间戳同时作用于主日志（slog）和 ffmpeg 日志行前缀，级别只作用于主日志。
+type LogConfig struct {
+	// Timezone 是日志时间使用的时区：Local（默认）、UTC 或 IANA 时区名。
+	Timezone string `yaml:"timezone,omitempty"`
+	// TimeFormat 是时间格式：rfc3339、rfc3339nano、datetime 或 Go 时间布局。
+	// 未设置时主日志使用 RFC3339 纳秒格式，ffmpeg 日志前缀使用 2006-01-02 15:04:05。
+	TimeFormat string `yaml:"time_format,omitempty"`
+	// Level 是主日志的级别：debug、info（默认）、warn 或 error，运行时可通过 log-level 命令或 SIGUSR1 临时修改。
+	Level string `yaml:"level,omitempty"`
+}
+
+// logTimeSettings 是解析后的日志时间设置。
+type logTimeSettings struct {
+	loc *time.Location
+	// layout 是配置的时间格式，为空时两种日志各自使用默认格式。
+	layout string
+}
+
+// logTime 是当前生效的日志时间设置，在配置重载时替换。
+var logTime atomic.Pointer[logTimeSettings]
+
+// resolve 校验并解析日志时间配置。
+func (c *LogConfig) resolve() (*logTimeSettings, error) {
+	s := &logTimeSettings{loc: time.Local}
+	if c == nil {
+		return s, nil
+	}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		s.loc = loc
+	}
+	if c.Level != "" {
+		if _, err := parseLogLevel(c.Level); err != nil {
+			return nil, err
+		}
+	}
+	if c.TimeFormat != "" {
+		if layout, ok := logTimeFormats[strings.ToLower(c.TimeFormat)]; ok {
+			s.layout = layout
+		} else if !strings.ContainsAny(c.TimeFormat, "0123456789") {
+			// A Go layout always contains reference digits such as 2006 or 15.
+			return nil, fmt.Errorf("unknown time_format %q", c.TimeFormat)
+		} else {
+			s.layout = c.TimeFormat
+		}
+	}
+	return s, nil
+}
+
+// currentLogTime 返回当前生效的日志时间设置。
+func currentLogTime() *logTimeSettings {
+	if s := logTime.Load(); s != nil {
+		return s
+	}
+	return &logTimeSettings{loc: time.Local}
+}
+
+// streamLogTimestamp 返回 ffmpeg 日志行前缀使用的时间戳。
+func streamLogTimestamp(t time.Time) string {
+	s := currentLogTime()
+	layout := s.layout
+	if layout == "" {
+		layout = defaultStreamLogLayout
+	}
+	return t.In(s.loc).Format(layout)
+}
+
+// logTimestamp 返回与主日志 time 字段格式相同的时间戳。
+func logTimestamp(t time.Time) string {
+	s := currentLogTime()
+	layout := s.layout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	return t.In(s.loc).Format(layout)
+}
+
+// replaceLogTime 按日志时间设置改写 slog 记录的 time 字段。
+func replaceLogTime(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 || a.Key != slog.TimeKey || a.Value.Kind() != slog.KindTime {
+		return a
+	}
+	s := currentLogTime()
+	t := a.Value.Time().In(s.loc)
+	if s.layout == "" {
+		return slog.Time(a.Key, t)
+	}
+	return slog.String(a.Key, t.Format(s.layout))
+}
+
+// newLogHandler 创建主日志使用的 JSON 处理器，记录同时复制到内存日志缓冲区。
+func newLogHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(logSink{w}, &slog.HandlerOptions{
+		Level:       &logLevel,
+		AddSource:   true, // Add source code location.
+		ReplaceAttr: replaceLogTime,
+	})
+}
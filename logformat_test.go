@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLogTimeFormat 测试主日志和 ffmpeg 日志前缀使用相同的时区和格式
+func TestLogTimeFormat(t *testing.T) {
+	defer logTime.Store(nil)
+
+	if _, err := (&LogConfig{TimeFormat: "iso"}).resolve(); err == nil {
+		t.Error("expected error for unknown time_format")
+	}
+	if _, err := (&LogConfig{Timezone: "Mars/Base"}).resolve(); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+
+	lt, err := (&LogConfig{Timezone: "UTC", TimeFormat: "rfc3339"}).resolve()
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	logTime.Store(lt)
+
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("CST", 8*3600))
+	if got := streamLogTimestamp(ts); got != "2024-05-05T23:08:09Z" {
+		t.Errorf("streamLogTimestamp = %s", got)
+	}
+
+	var buf bytes.Buffer
+	slog.New(newLogHandler(&buf)).Info("hello")
+	var record struct {
+		Time string `json:"time"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !strings.HasSuffix(record.Time, "Z") || strings.Contains(record.Time, ".") {
+		t.Errorf("slog time = %s, want RFC3339 in UTC", record.Time)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// logLevelNames 是可用的日志级别名。
+var logLevelNames = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// parseLogLevel 解析日志级别名 debug、info、warn 或 error（不区分大小写）。
+func parseLogLevel(s string) (slog.Level, error) {
+	if l, ok := logLevelNames[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return l, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, use debug, info, warn or error", s)
+}
+
+// logLevelName 返回日志级别的小写名称。
+func logLevelName(l slog.Level) string {
+	return strings.ToLower(l.String())
+}
+
+// level 返回配置的主日志级别，未设置时为 info。
+func (c *LogConfig) level() slog.Level {
+	if c == nil || c.Level == "" {
+		return slog.LevelInfo
+	}
+	// Validated by resolve when the config is loaded.
+	l, _ := parseLogLevel(c.Level)
+	return l
+}
+
+// logLevel 是主日志处理器当前使用的级别。
+var logLevel slog.LevelVar
+
+// logLevelState 记录配置的日志级别和运行时临时设置的级别。
+// 临时级别在重载配置后仍然保留，直到通过接口清除，便于排查问题时重载配置而不丢失调试日志。
+type logLevelState struct {
+	mu         sync.Mutex
+	configured slog.Level
+	override   *slog.Level
+}
+
+// logLevels 是主日志的级别设置。
+var logLevels logLevelState
+
+// logLevelStatus 是 /log-level 的响应。
+type logLevelStatus struct {
+	// Level 是当前生效的级别。
+	Level string `json:"level"`
+	// Configured 是配置文件中 log.level 的级别。
+	Configured string `json:"configured"`
+	// Override 表示当前级别是运行时临时设置的。
+	Override bool `json:"override"`
+}
+
+// apply 更新处理器的级别，调用方持有 mu。
+func (s *logLevelState) apply() {
+	if s.override != nil {
+		logLevel.Set(*s.override)
+		return
+	}
+	logLevel.Set(s.configured)
+}
+
+// setConfigured 设置配置的级别，在启动和重载配置时调用。
+func (s *logLevelState) setConfigured(l slog.Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured = l
+	s.apply()
+}
+
+// setOverride 临时设置级别，l 为 nil 时恢复配置的级别。
+func (s *logLevelState) setOverride(l *slog.Level) logLevelStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.override = l
+	s.apply()
+	return s.statusLocked()
+}
+
+// toggleDebug 在 debug 和配置的级别之间切换，返回切换后的状态。
+func (s *logLevelState) toggleDebug() logLevelStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.override != nil && *s.override == slog.LevelDebug {
+		s.override = nil
+	} else {
+		debug := slog.LevelDebug
+		s.override = &debug
+	}
+	s.apply()
+	return s.statusLocked()
+}
+
+// status 返回当前的级别设置。
+func (s *logLevelState) status() logLevelStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+func (s *logLevelState) statusLocked() logLevelStatus {
+	return logLevelStatus{
+		Level:      logLevelName(logLevel.Level()),
+		Configured: logLevelName(s.configured),
+		Override:   s.override != nil,
+	}
+}
+
+// handleLogLevel 处理 GET /log-level（当前级别）、PUT /log-level（临时设置级别，正文 {"level": "debug"}）
+// 和 DELETE /log-level（恢复配置的级别）。
+func handleLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeAPIJSON(w, http.StatusOK, logLevels.status())
+		case http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			var req struct {
+				Level string `yaml:"level"`
+			}
+			if err := yaml.Unmarshal(body, &req); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			l, err := parseLogLevel(req.Level)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			prev := logLevels.status()
+			st := logLevels.setOverride(&l)
+			slog.Info("log level changed", "level", st.Level, "configured", st.Configured)
+			auditChange(r, "", prev.Level, st.Level)
+			writeAPIJSON(w, http.StatusOK, st)
+		case http.MethodDelete:
+			prev := logLevels.status()
+			st := logLevels.setOverride(nil)
+			slog.Info("log level reset to configured level", "level", st.Level)
+			auditChange(r, "", prev.Level, st.Level)
+			writeAPIJSON(w, http.StatusOK, st)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// runLogLevel 实现 log-level 子命令：查看、临时修改或恢复运行中守护进程的日志级别。
+func runLogLevel(args []string) int {
+	fs, socket := controlFlags("log-level")
+	set := fs.String("set", "", T("flag.loglevel.set"))
+	reset := fs.Bool("reset", false, T("flag.loglevel.reset"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	c := newControlClient(*socket)
+	var st logLevelStatus
+	var err error
+	switch {
+	case *reset:
+		err = c.do(http.MethodDelete, "/log-level", nil, &st)
+	case *set != "":
+		if _, perr := parseLogLevel(*set); perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+			return 2
+		}
+		err = c.do(http.MethodPut, "/log-level", map[string]string{"level": *set}, &st)
+	default:
+		err = c.do(http.MethodGet, "/log-level", nil, &st)
+	}
+	if err != nil {
+		return controlFail(err)
+	}
+	if st.Override {
+		fmt.Printf("log level: %s (configured: %s)\n", st.Level, st.Configured)
+	} else {
+		fmt.Printf("log level: %s\n", st.Level)
+	}
+	return 0
+}
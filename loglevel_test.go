@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogLevel 测试通过接口和 SIGUSR1 临时修改日志级别，重载配置后临时级别保留，清除后恢复配置的级别。
+func TestLogLevel(t *testing.T) {
+	defer logLevels.setOverride(nil)
+	defer logLevels.setConfigured(slog.LevelInfo)
+
+	cfg := &LogConfig{Level: "WARN"}
+	if _, err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&LogConfig{Level: "verbose"}).resolve(); err == nil {
+		t.Error("expected unknown level to be rejected")
+	}
+	logLevels.setConfigured(cfg.level())
+	if logLevel.Level() != slog.LevelWarn {
+		t.Fatalf("level = %v", logLevel.Level())
+	}
+
+	h := handleLogLevel()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level": "debug"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"override":true`) {
+		t.Fatalf("put: %d %s", rec.Code, rec.Body)
+	}
+	// A reload changes the configured level but keeps the override.
+	logLevels.setConfigured(slog.LevelError)
+	if st := logLevels.status(); st.Level != "debug" || st.Configured != "error" {
+		t.Errorf("after reload = %+v", st)
+	}
+	if st := logLevels.toggleDebug(); st.Level != "error" || st.Override {
+		t.Errorf("after SIGUSR1 = %+v", st)
+	}
+	if st := logLevels.toggleDebug(); st.Level != "debug" || !st.Override {
+		t.Errorf("after second SIGUSR1 = %+v", st)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/log-level", nil))
+	if rec.Code != http.StatusOK || logLevel.Level() != slog.LevelError {
+		t.Errorf("delete: %d, level %v", rec.Code, logLevel.Level())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level": "trace"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown level: %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loopCheckInterval 是检查核心循环是否卡住的间隔。
+const loopCheckInterval = 10 * time.Second
+
+// coreLoop 记录一个核心循环的进展。周期性的循环用 beat 记录每次前进；按需工作的循环用 begin 开始一段有期限的工作，
+// 空闲等待（如等待信号）时没有期限。超过期限加上 settings.loop_stall_timeout 仍没有进展即判定卡住。
+type coreLoop struct {
+	name string
+	// mu 保护 active，使并发的 begin 和 end 不会互相覆盖期限。
+	mu     sync.Mutex
+	active int
+	// deadline 是最晚的进展时间（UnixNano），0 表示空闲、没有期限。
+	deadline atomic.Int64
+	// stalled 表示已经上报过卡住，恢复时清除。
+	stalled atomic.Bool
+}
+
+// 被监控的核心循环。
+var (
+	// loopSignal 是主信号循环，处理一个信号（重载、退出）期间有期限。
+	loopSignal = registerLoop("signal")
+	// loopWatchdog 是看门狗的检查循环，每秒前进一次。
+	loopWatchdog = registerLoop("watchdog")
+	// loopApply 是配置应用，从等待 applyMu 开始到应用完成期间有期限。
+	loopApply = registerLoop("config apply")
+)
+
+// coreLoops 是所有被监控的核心循环。
+var coreLoops struct {
+	mu    sync.Mutex
+	loops []*coreLoop
+}
+
+// registerLoop 注册一个被监控的核心循环，初始为空闲。
+func registerLoop(name string) *coreLoop {
+	l := &coreLoop{name: name}
+	coreLoops.mu.Lock()
+	coreLoops.loops = append(coreLoops.loops, l)
+	coreLoops.mu.Unlock()
+	return l
+}
+
+// expect 声明循环在 d 之后应当再次前进。
+func (l *coreLoop) expect(d time.Duration) {
+	l.deadline.Store(currentClock().Now().Add(d + currentSettings().LoopStallTimeout).UnixNano())
+}
+
+// beat 记录一次进展，下一次进展应在 loop_stall_timeout 之内。
+func (l *coreLoop) beat() {
+	l.expect(0)
+}
+
+// idle 表示循环进入空闲等待，不再有期限。
+func (l *coreLoop) idle() {
+	l.deadline.Store(0)
+}
+
+// begin 开始一段有期限的工作，返回结束时调用的函数。可以并发调用（如多个重载等待 applyMu），全部结束后才转为空闲。
+func (l *coreLoop) begin() (end func()) {
+	l.mu.Lock()
+	l.active++
+	l.beat()
+	l.mu.Unlock()
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.active--; l.active == 0 {
+			l.idle()
+		} else {
+			l.beat()
+		}
+	}
+}
+
+// overdue 判断循环在 now 是否已超过期限。
+func (l *coreLoop) overdue(now time.Time) bool {
+	d := l.deadline.Load()
+	return d != 0 && now.UnixNano() > d
+}
+
+// runLoopMonitor 定期检查核心循环，卡住时转储所有协程的调用栈并告警，恢复后再记录一次。
+func runLoopMonitor() {
+	ticker := currentClock().NewTicker(loopCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C() {
+		checkLoops(now)
+	}
+}
+
+// checkLoops 检查一次所有核心循环。
+func checkLoops(now time.Time) {
+	coreLoops.mu.Lock()
+	loops := append([]*coreLoop(nil), coreLoops.loops...)
+	coreLoops.mu.Unlock()
+	for _, l := range loops {
+		switch overdue := l.overdue(now); {
+		case overdue && !l.stalled.Load():
+			l.stalled.Store(true)
+			timeout := currentSettings().LoopStallTimeout
+			dump, err := dumpGoroutines(l.name, now)
+			if err != nil {
+				slog.Error("core loop stalled, failed to write goroutine dump", "loop", l.name, "timeout", timeout, "error", err)
+			} else {
+				slog.Error("core loop stalled, goroutine stacks dumped", "loop", l.name, "timeout", timeout, "dump", dump)
+			}
+			emitEvent("", "loop_stalled", l.name, timeout)
+		case !overdue && l.stalled.Load():
+			l.stalled.Store(false)
+			slog.Info("core loop recovered", "loop", l.name)
+			emitEvent("", "loop_recovered", l.name)
+		}
+	}
+}
+
+// dumpGoroutines 把所有协程的调用栈写到日志目录下的 stall-<循环>-<时间>.txt，返回文件路径。
+func dumpGoroutines(loop string, now time.Time) (string, error) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	name := fmt.Sprintf("stall-%s-%s.txt", sanitizeFileName(loop), now.UTC().Format("20060102T150405Z"))
+	path := filepath.Join(paths.LogDir, name)
+	return path, os.WriteFile(path, buf, 0644)
+}
+
+// sanitizeFileName 把名称中的空格和路径分隔符替换为 -。
+func sanitizeFileName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c == ' ' || c == '/' || c == os.PathSeparator {
+			b[i] = '-'
+		}
+	}
+	return string(b)
+}
+
+// writeLoopMetrics 输出核心循环是否卡住。
+func writeLoopMetrics(bw *bufio.Writer) {
+	coreLoops.mu.Lock()
+	loops := append([]*coreLoop(nil), coreLoops.loops...)
+	coreLoops.mu.Unlock()
+	fmt.Fprintln(bw, "# HELP stream_runner_loop_stalled Whether a core loop has made no progress within settings.loop_stall_timeout.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_loop_stalled gauge")
+	for _, l := range loops {
+		v := 0
+		if l.stalled.Load() {
+			v = 1
+		}
+		fmt.Fprintf(bw, "stream_runner_loop_stalled{loop=\"%s\"} %d\n", escapeLabelValue(l.name), v)
+	}
+}
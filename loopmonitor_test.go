@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoopMonitor 测试核心循环超过期限没有进展时转储调用栈并标记卡住，重叠的工作全部结束后恢复。
+func TestLoopMonitor(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC))
+	defer setClock(clock)()
+	old := paths
+	defer func() { paths = old }()
+	paths.LogDir = t.TempDir()
+
+	l := registerLoop("test loop")
+	checkLoops(clock.Now().Add(time.Hour))
+	if l.stalled.Load() {
+		t.Fatal("an idle loop was reported as stalled")
+	}
+
+	first := l.begin()
+	second := l.begin()
+	first()
+	clock.advance(DefaultLoopStallTimeout - time.Second)
+	checkLoops(clock.Now())
+	if l.stalled.Load() {
+		t.Fatal("stalled before loop_stall_timeout")
+	}
+	clock.advance(2 * time.Second)
+	checkLoops(clock.Now())
+	if !l.stalled.Load() {
+		t.Fatal("not stalled after loop_stall_timeout")
+	}
+	dumps, _ := filepath.Glob(filepath.Join(paths.LogDir, "stall-test-loop-*.txt"))
+	if len(dumps) != 1 {
+		t.Fatalf("dumps = %v", dumps)
+	}
+	if data, _ := os.ReadFile(dumps[0]); !strings.Contains(string(data), "TestLoopMonitor") {
+		t.Error("dump does not contain the goroutine stacks")
+	}
+	var b strings.Builder
+	bw := bufio.NewWriter(&b)
+	writeLoopMetrics(bw)
+	bw.Flush()
+	if !strings.Contains(b.String(), `stream_runner_loop_stalled{loop="test loop"} 1`) {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+
+	second()
+	checkLoops(clock.Now())
+	if l.stalled.Load() {
+		t.Error("still stalled after the work finished")
+	}
+}
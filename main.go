@@ -4,14 +4,21 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -25,11 +32,17 @@ const (
 	LogDir = "/var/log/stream-runner"
 	// LogFile 是主日志文件的默认路径。
 	LogFile = "/var/log/stream-runner/stream.log"
+	// AuditLogPath 是控制操作审计日志的默认路径。
+	AuditLogPath = "/var/log/stream-runner/audit.log"
 	// PIDFilePath 是 PID 文件的默认路径。
 	PIDFilePath = "/var/run/stream-runner.pid"
-	// MaxLogSize 是日志文件的最大大小（100MB）。
+	// SnapshotPath 是当前生效配置快照的默认路径。
+	SnapshotPath = "/var/run/stream-runner.snapshot.yml"
+	// ControlSocketPath 是本地控制套接字的默认路径。
+	ControlSocketPath = "/var/run/stream-runner.sock"
+	// MaxLogSize 是日志文件的默认最大大小（100MB），可通过 settings.log_max_size 修改。
 	MaxLogSize = 100 * 1024 * 1024
-	// MaxLogFiles 是保留的最大日志文件数量。
+	// MaxLogFiles 是默认保留的最大日志文件数量，可通过 settings.log_max_files 修改。
 	MaxLogFiles = 5
 )
 
@@ -37,16 +50,130 @@ const (
 type StreamConfig struct {
 	// ID 是流的唯一标识符。
 	ID string `yaml:"id"`
+	// RenamedFrom 是该流以前使用过的 ID。重载时若旧 ID 的工作器仍在运行，会直接改名而不重启 ffmpeg。
+	RenamedFrom []string `yaml:"renamed_from,omitempty"`
 	// Src 是源 RTMP 流地址。
 	Src string `yaml:"src"`
 	// Dst 是目标 RTMP 流地址。
 	Dst string `yaml:"dst"`
+	// SrcBind 是拉取源流时绑定的本地 IP 或网卡名（可选）。
+	SrcBind string `yaml:"src_bind,omitempty"`
+	// DstBind 是推送目标流时绑定的本地 IP 或网卡名（可选）。
+	DstBind string `yaml:"dst_bind,omitempty"`
+	// IPFamily 是连接使用的地址族偏好：auto（默认）、ipv4 或 ipv6。
+	IPFamily string `yaml:"ip_family,omitempty"`
+	// Hooks 是流生命周期钩子（可选）。
+	Hooks StreamHooks `yaml:"hooks,omitempty"`
+	// Sandbox 是 ffmpeg 子进程的加固配置（可选）。
+	Sandbox *SandboxConfig `yaml:"sandbox,omitempty"`
+	// Probe 启用启动前的 ffprobe 源流探测，用于选择输出封装并检查编码兼容性。
+	Probe bool `yaml:"probe,omitempty"`
+	// Format 是输出封装格式（可选），为空时根据目标地址推断。
+	Format string `yaml:"format,omitempty"`
+	// EnhancedRTMP 表示目标支持 enhanced RTMP，可直接透传 HEVC/AV1/VP9（需要 ffmpeg 6.1+）。
+	EnhancedRTMP bool `yaml:"enhanced_rtmp,omitempty"`
+	// Metadata 是写入输出的元数据（FLV 输出时为 onMetaData 字段），会覆盖源流中的同名字段。
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+	// StripMetadata 表示丢弃源流自带的元数据，只保留 Metadata 中配置的字段。
+	StripMetadata bool `yaml:"strip_metadata,omitempty"`
+	// BurnInUntil 是调试叠加的截止时间（可选），在此之前视频转码并叠加时间戳和流 ID。
+	BurnInUntil time.Time `yaml:"burn_in_until,omitempty"`
+	// AVSync 是音画同步偏差监控配置（可选），需要 ffprobe。
+	AVSync *AVSyncConfig `yaml:"av_sync,omitempty"`
+	// KeyframeInterval 是输出允许的最大关键帧间隔（可选）。转码时强制该间隔，复制时通过 probe 校验。
+	KeyframeInterval time.Duration `yaml:"keyframe_interval,omitempty"`
+	// Deinterlace 是去隔行配置（可选）。
+	Deinterlace *DeinterlaceConfig `yaml:"deinterlace,omitempty"`
+	// FrameRate 是输出帧率（可选），如 25、29.97 或 30000/1001。设置后视频走转码路径。
+	FrameRate string `yaml:"frame_rate,omitempty"`
+	// Region 是目标地址模板中 {region} 的取值，auto 表示按连接延迟从 Regions 中选择（可选，默认使用全局 region）。
+	Region string `yaml:"region,omitempty"`
+	// Regions 是可选的候选区域列表。
+	Regions []string `yaml:"regions,omitempty"`
+	// DstCandidates 是与 Dst 等价的备选推流入口，配置后每次启动前选择连接最快的一个（可选）。
+	DstCandidates []string `yaml:"dst_candidates,omitempty"`
+	// Outputs 是除 dst 之外同时推送的附加输出（可选），如 SRT 或 HLS 目录，由同一个 ffmpeg 进程通过 tee 封装推送。
+	Outputs []StreamOutput `yaml:"outputs,omitempty"`
+	// OutputMode 是附加输出的推送方式：tee（默认）或 independent（每路输出独立的 ffmpeg，失败时单独重启）。
+	OutputMode string `yaml:"output_mode,omitempty"`
+	// Archive 是节目结束后上传录制文件的配置（可选），需要 schedule 和 jobs。
+	Archive *ArchiveConfig `yaml:"archive,omitempty"`
+	// WaitFor 是启动前必须满足的外部就绪条件（可选），未满足时退避重试。
+	WaitFor []ReadinessCheck `yaml:"wait_for,omitempty"`
+	// TranscodeFallback 是源编码与输出不兼容时使用的转码配置名（可选，需要开启 probe）。
+	TranscodeFallback string `yaml:"transcode_fallback,omitempty"`
+	// Synthetic 表示这是端到端监测流（可选）：推送生成的测试图案，并从平台侧验证能否播放，此时 src 留空。
+	Synthetic *SyntheticConfig `yaml:"synthetic,omitempty"`
+	// RestartBlackout 是重启禁止窗口（可选），窗口内推迟主动重启，硬故障除外。
+	RestartBlackout []RestartBlackout `yaml:"restart_blackout,omitempty"`
+	// Platform 表示从直播平台 API 获取推流地址并检查平台侧直播状态（可选），此时 dst 留空。
+	Platform *PlatformConfig `yaml:"platform,omitempty"`
+	// StartTimeout 是 ffmpeg 启动后等待输出开始前进的时长（可选），默认取 settings.start_timeout。
+	StartTimeout time.Duration `yaml:"start_timeout,omitempty"`
+	// Watchdog 是看门狗策略（可选），未配置时 ffmpeg 未运行即重启。
+	Watchdog *WatchdogConfig `yaml:"watchdog,omitempty"`
+	// Resources 是 ffmpeg 子进程的资源告警阈值（可选）。
+	Resources *ResourceLimits `yaml:"resources,omitempty"`
+	// Labels 是流的标签（如 team、severity、region），用于告警路由。
+	Labels map[string]string `yaml:"labels,omitempty"`
 }
 
 // Config 表示应用程序的完整配置。
 type Config struct {
+	// Version 是配置结构版本，旧配置可以用 migrate-config 升级。
+	Version int `yaml:"version,omitempty"`
 	// Streams 是所有要管理的 RTMP 流配置列表。
 	Streams []StreamConfig `yaml:"streams"`
+	// Reports 是用量报表配置，为空时不生成报表。
+	Reports *ReportConfig `yaml:"reports,omitempty"`
+	// Metrics 是指标配置（抓取服务和主动推送），为空时不导出指标。
+	Metrics *MetricsConfig `yaml:"metrics,omitempty"`
+	// SNMP 是 SNMP 代理配置，为空时不启动 SNMP 代理。
+	SNMP *SNMPConfig `yaml:"snmp,omitempty"`
+	// Hooks 是执行钩子命令的安全策略，为空时使用默认策略。
+	Hooks *HookPolicy `yaml:"hooks,omitempty"`
+	// Region 是所有流默认使用的区域，流自身配置的 region 优先。
+	Region string `yaml:"region,omitempty"`
+	// Maintenance 是目标平台的已知维护窗口。
+	Maintenance []MaintenanceWindow `yaml:"maintenance,omitempty"`
+	// TranscodeProfiles 是按名称引用的转码配置。
+	TranscodeProfiles map[string]TranscodeProfile `yaml:"transcode_profiles,omitempty"`
+	// Log 是日志时间戳的时区和格式配置（可选）。
+	Log *LogConfig `yaml:"log,omitempty"`
+	// Alerts 是按流标签路由的告警配置，为空时事件只写入日志。
+	Alerts *AlertConfig `yaml:"alerts,omitempty"`
+	// Settings 是日志路径、轮转、看门狗和重试间隔等运行参数，未设置的项使用默认值。
+	Settings *Settings `yaml:"settings,omitempty"`
+	// AdaptiveRestart 是按主机负载限流 ffmpeg 启动的策略，为空时不限流。
+	AdaptiveRestart *AdaptiveRestart `yaml:"adaptive_restart,omitempty"`
+	// DestinationPacing 是按目标主机的启动限速，为空时不限速。
+	DestinationPacing *DestinationPacing `yaml:"destination_pacing,omitempty"`
+	// Update 是 self-update 子命令使用的发布源（可选）。
+	Update *UpdateConfig `yaml:"update,omitempty"`
+	// FFmpeg 是 ffmpeg 可执行文件的来源（可选），只在启动时读取。
+	FFmpeg *FFmpegConfig `yaml:"ffmpeg,omitempty"`
+	// RunAs 是完成特权操作后切换到的用户和组，为空时不切换。修改后需重启生效。
+	RunAs *RunAsConfig `yaml:"run_as,omitempty"`
+	// Plugins 是按名称引用的外部插件（可选），用于自定义就绪检查、告警渠道和密钥。
+	Plugins map[string]PluginConfig `yaml:"plugins,omitempty"`
+	// Fleet 是多节点汇总配置（可选），支持热重载。
+	Fleet *FleetConfig `yaml:"fleet,omitempty"`
+	// Canary 是重载时的金丝雀验证（可选）。
+	Canary *CanaryConfig `yaml:"canary,omitempty"`
+	// Incidents 是持续故障时自动创建事故单的配置（可选），需要 alerts.channels。
+	Incidents *IncidentConfig `yaml:"incidents,omitempty"`
+	// Handover 是重载删除流时等待其他节点接替的配置（可选），需要 fleet。
+	Handover *HandoverConfig `yaml:"handover,omitempty"`
+	// HealthScore 是流健康分的计算方式（可选），未配置时使用默认权重，支持热重载。
+	HealthScore *HealthScoreConfig `yaml:"health_score,omitempty"`
+	// Anomaly 是按流自身基线检测码率和帧率异常的配置（可选），为空时不检测，支持热重载。
+	Anomaly *AnomalyConfig `yaml:"anomaly,omitempty"`
+	// Schedule 是由外部节目表驱动开播和停播的配置（可选），支持热重载。
+	Schedule *ScheduleConfig `yaml:"schedule,omitempty"`
+	// Jobs 是通过管理接口提交的一次性转码/转封装任务（可选）。
+	Jobs *JobsConfig `yaml:"jobs,omitempty"`
+	// API 是需要令牌的管理接口（可选），为空时不启动。
+	API *APIConfig `yaml:"api,omitempty"`
 }
 
 // StreamWorker 管理单个 RTMP 流的工作器，负责启动、监控和停止 ffmpeg 进程。
@@ -57,18 +184,57 @@ type StreamWorker struct {
 	running bool
 	// cmd 是当前运行的 ffmpeg 命令进程。
 	cmd *exec.Cmd
+	// stats 是累计运行统计。
+	stats streamStats
+	// endpoint 是本次启动选定的实际推送地址。
+	endpoint string
+	// backoffUntil 是当前重试等待的结束时间。
+	backoffUntil time.Time
+	// deferredCfg 是因重启禁止窗口推迟应用的新配置，窗口结束后应用并重启。
+	deferredCfg *StreamConfig
+	// offSchedule 表示流受节目表控制，正在等待下一档节目开始。
+	offSchedule bool
+	// paused 表示流已通过管理接口暂停。与停止不同，重载修改了流的配置时也保持暂停，直到恢复。
+	paused bool
+	// anomaly 是码率和帧率的基线，用于异常检测。
+	anomaly anomalyState
+	// logWriter 是当前 ffmpeg 进程的日志写入器，改名时同步更新日志前缀。
+	logWriter *StreamLogWriter
+	// exited 在当前 ffmpeg 进程退出并被回收后关闭。
+	exited chan struct{}
+	// lastArgs 是最近一次启动 ffmpeg 的参数，用于事故单。
+	lastArgs []string
+	// history 是最近的状态变化，用于事故单。
+	history []historyEntry
+	// outputs 是当前 ffmpeg 进程中各路输出的失败记录，只有配置了附加输出的流才使用。
+	outputs outputTracker
+	// pushers 是独立推送的附加输出，只在 output_mode 为 independent 且主循环运行期间存在。
+	pushers *outputPushers
+	// tail 是最近的 ffmpeg 输出行，跨多次运行保留，用于事故单。
+	tail *lineTail
+	// ctx 是当前主循环的上下文，Stop 或 Start 传入的 ctx 取消时结束；cancel 用于 Stop。
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// parent 是 Start 传入的 ctx，更新配置后重新启动时沿用。
+	parent context.Context
+	// done 在主循环退出后关闭，未启动时为 nil。
+	done chan struct{}
 	// mu 保护并发访问的互斥锁。
 	mu sync.Mutex
 }
 
 // AppState 表示应用程序的全局状态。
 type AppState struct {
-	// workers 是所有流工作器的映射表，key 为流 ID。
-	workers map[string]*StreamWorker
-	// mu 保护并发访问的读写互斥锁。
+	// workers 是所有流工作器的映射表，key 为流 ID。写时复制，读取不需要持有 mu。
+	workers *workerMap
+	// mu 保护 config、temporary 和 handovers；增删工作器时也持有它，使工作器表与配置一致。
 	mu sync.RWMutex
-	// logger 是结构化日志记录器。
-	logger *slog.Logger
+	// config 是当前生效的配置。
+	config *Config
+	// temporary 是通过管理接口创建的临时流，不写入配置。
+	temporary map[string]temporaryStream
+	// handovers 是已从配置中删除、等待其他节点接替后再停止的流。
+	handovers map[string]*pendingHandover
 }
 
 // StreamLogWriter 包装 io.Writer，为每行日志添加流 ID 和时间戳前缀。
@@ -79,10 +245,21 @@ type StreamLogWriter struct {
 	writer io.Writer
 	// buf 是缓冲区，用于处理不完整的行。
 	buf bytes.Buffer
+	// tail 保存最近的输出行（可选）。
+	tail *lineTail
+	// onLine 处理每一行输出（可选），如检测附加输出失败。
+	onLine func(line string)
 	// mu 保护并发写入的互斥锁。
 	mu sync.Mutex
 }
 
+// setStreamID 修改后续日志行使用的流 ID。
+func (w *StreamLogWriter) setStreamID(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.streamID = id
+}
+
 // Write 实现 io.Writer 接口，将数据写入并添加时间戳和流 ID 前缀。
 func (w *StreamLogWriter) Write(p []byte) (n int, err error) {
 	w.mu.Lock()
@@ -103,78 +280,265 @@ func (w *StreamLogWriter) Write(p []byte) (n int, err error) {
 		// Remove trailing newline and write with prefix and timestamp.
 		line = strings.TrimSuffix(line, "\n")
 		if line != "" {
-			timestamp := time.Now().Format("2006-01-02 15:04:05")
+			timestamp := streamLogTimestamp(time.Now())
 			_, err = fmt.Fprintf(w.writer, "[%s] [%s] %s\n", timestamp, w.streamID, line)
 			if err != nil {
 				return len(p), err
 			}
+			if r := logRing.Load(); r != nil {
+				r.addStreamLine(w.streamID, line, time.Now())
+			}
+			if w.tail != nil {
+				w.tail.add(line)
+			}
+			if w.onLine != nil {
+				w.onLine(line)
+			}
 		}
 	}
 
 	return len(p), nil
 }
 
-// startLoop 启动流工作器的主循环，持续监控和重启 ffmpeg 进程。
-func (w *StreamWorker) startLoop() {
+// startLoop 启动流工作器的主循环，持续监控和重启 ffmpeg 进程，ctx 取消后退出并关闭 done。
+func (w *StreamWorker) startLoop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	var readinessDelay time.Duration
+	// Independent outputs keep their connections across ffmpeg restarts and stop with the loop.
+	defer func() {
+		w.mu.Lock()
+		pushers := w.pushers
+		w.pushers = nil
+		w.mu.Unlock()
+		if pushers != nil {
+			pushers.stop()
+		}
+	}()
 	for {
+		if ctx.Err() != nil {
+			return
+		}
+		w.waitForSchedule(w.config().ID)
 		w.mu.Lock()
-		w.running = true
-		cmd := exec.Command("ffmpeg",
-			"-rw_timeout", "2000000",
-			"-i", w.cfg.Src,
-			"-c", "copy",
-			"-f", "flv",
-			w.cfg.Dst,
-		)
+		cfg := w.cfg
+		w.mu.Unlock()
 
-		stdoutPipe, err := cmd.StdoutPipe()
+		if len(cfg.WaitFor) > 0 {
+			if err := checkReadiness(cfg.ID, cfg.WaitFor); err != nil {
+				readinessDelay = nextReadinessBackoff(readinessDelay)
+				w.recordError(ErrorCategoryReadiness, err)
+				slog.Info("waiting for readiness checks", "stream_id", cfg.ID, "error", err, "retry_in", readinessDelay)
+				w.backoff(readinessDelay)
+				continue
+			}
+			readinessDelay = 0
+		}
+
+		// Secrets are resolved per start and never stored back into w.cfg.
+		if err := resolveStreamSecrets(&cfg); err != nil {
+			w.recordError(ErrorCategorySecrets, err)
+			slog.Error("failed to resolve secrets", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+
+		// Platform ingest URLs carry the stream key, so they are fetched per start like secrets.
+		if cfg.Platform != nil {
+			dst, err := fetchPlatformIngest(*cfg.Platform)
+			if err != nil {
+				w.recordError(ErrorCategoryDestination, err)
+				slog.Error("failed to fetch ingest URL from platform", "stream_id", cfg.ID, "platform", cfg.Platform.Type, "error", err)
+				w.backoff(currentSettings().RestartDelay)
+				continue
+			}
+			cfg.Dst = dst
+		}
+
+		// Resolution and probing may block for seconds; keep them outside w.mu.
+		endpoint, err := selectDestination(cfg)
 		if err != nil {
+			w.recordError(ErrorCategoryDestination, err)
+			slog.Error("failed to select destination", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+		w.mu.Lock()
+		w.endpoint = endpoint
+		w.mu.Unlock()
+		cfg.Dst = endpoint
+
+		ep, err := resolveEndpoints(cfg)
+		if err != nil {
+			w.recordError(ErrorCategoryDestination, err)
+			slog.Error("failed to resolve stream endpoints", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+		var probe *probeResult
+		if cfg.Probe {
+			probe, err = probeSource(cfg, ep)
+			w.recordProbe(err)
+			if err != nil {
+				w.recordError(ErrorCategoryProbe, err)
+				slog.Error("failed to probe source", "stream_id", cfg.ID, "error", err)
+				w.backoff(currentSettings().RestartDelay)
+				continue
+			}
+		}
+		profile := lookupTranscodeProfile(cfg.TranscodeFallback)
+		plan, err := planOutput(cfg, probe, profile)
+		if err != nil {
+			w.recordError(ErrorCategoryIncompatible, err)
+			slog.Error("source is not compatible with output, fix the stream config",
+				"stream_id", cfg.ID, "dst", cfg.Dst, "error", err, "retry_in", currentSettings().IncompatibleRetryDelay)
+			w.backoff(currentSettings().IncompatibleRetryDelay)
+			continue
+		}
+		if err := checkOutputsFFmpegVersion(cfg, plan); err != nil {
+			w.recordError(ErrorCategoryIncompatible, err)
+			slog.Error("ffmpeg version is refused for this stream, upgrade ffmpeg or change ffmpeg.known_bad",
+				"stream_id", cfg.ID, "error", err, "retry_in", currentSettings().IncompatibleRetryDelay)
+			w.backoff(currentSettings().IncompatibleRetryDelay)
+			continue
+		}
+		if plan.Fallback {
+			emitEvent(cfg.ID, "transcode_fallback", probe.codecSummary(), plan.Format, cfg.TranscodeFallback)
+		}
+		if cfg.Probe && cfg.KeyframeInterval > 0 && !plan.TranscodeVideo {
+			plan = verifyKeyframes(cfg, ep, plan, profile)
+		}
+		plan = planDeinterlace(plan, cfg, probe, profile)
+		plan = planFrameRate(plan, cfg, probe, profile)
+		plan = planBurnIn(plan, cfg, profile, time.Now())
+		w.waitForHost(cfg.ID)
+		w.waitForDestination(cfg.ID, cfg.Dst)
+		if err := prepareOutputs(cfg); err != nil {
+			w.recordError(ErrorCategoryDestination, err)
+			slog.Error("failed to prepare stream outputs", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+		args := buildFFmpegArgs(cfg, ep, plan)
+		cmd, err := newFFmpegCommand(cfg, args)
+		if err != nil {
+			w.recordError(ErrorCategoryStart, err)
+			slog.Error("failed to create ffmpeg command", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+
+		attachFeed := func(bool) {}
+		if independentOutputs(cfg) {
+			w.mu.Lock()
+			if w.pushers == nil {
+				w.pushers = startOutputPushers(cfg)
+			}
+			feed := &w.pushers.feed
 			w.mu.Unlock()
-			slog.Error("failed to create stdout pipe", "stream_id", w.cfg.ID, "error", err)
-			time.Sleep(1 * time.Second)
+			if attachFeed, err = attachOutputFeed(cmd, feed); err != nil {
+				w.recordError(ErrorCategoryStart, err)
+				slog.Error("failed to create output feed", "stream_id", cfg.ID, "error", err)
+				w.backoff(currentSettings().RestartDelay)
+				continue
+			}
+		}
+
+		stdoutPipe, err := cmd.StdoutPipe()
+		if err != nil {
+			attachFeed(false)
+			w.recordError(ErrorCategoryStart, err)
+			slog.Error("failed to create stdout pipe", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
 			continue
 		}
 
 		stderrPipe, err := cmd.StderrPipe()
 		if err != nil {
-			w.mu.Unlock()
 			if closeErr := stdoutPipe.Close(); closeErr != nil {
-				slog.Warn("failed to close stdout pipe", "stream_id", w.cfg.ID, "error", closeErr)
+				slog.Warn("failed to close stdout pipe", "stream_id", cfg.ID, "error", closeErr)
 			}
-			slog.Error("failed to create stderr pipe", "stream_id", w.cfg.ID, "error", err)
-			time.Sleep(1 * time.Second)
+			attachFeed(false)
+			w.recordError(ErrorCategoryStart, err)
+			slog.Error("failed to create stderr pipe", "stream_id", cfg.ID, "error", err)
+			w.backoff(currentSettings().RestartDelay)
+			continue
+		}
+
+		if w.isStopped() {
+			closePipes(cfg.ID, stdoutPipe, stderrPipe)
+			attachFeed(false)
+			return
+		}
+
+		slog.Info("starting ffmpeg", "stream_id", cfg.ID)
+		w.publishLifecycle(LifecycleEvent{Type: LifecycleStarting})
+		err = cmd.Start()
+		attachFeed(err == nil)
+		if err != nil {
+			w.recordError(ErrorCategoryStart, err)
+			slog.Error("failed to start ffmpeg", "stream_id", cfg.ID, "error", err)
+			closePipes(cfg.ID, stdoutPipe, stderrPipe)
+			w.publishLifecycle(LifecycleEvent{Type: LifecycleExited, Error: err.Error()})
+			w.backoff(currentSettings().RestartDelay)
 			continue
 		}
 
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		exited := make(chan struct{})
+		w.mu.Lock()
+		// cmd is registered only once it has a process, so stop never sees it half-started.
+		// A Stop that came in while ffmpeg was starting found nothing to signal; kill it here
+		// and let the loop exit after Wait.
+		if w.stopRequestedLocked() {
+			if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+				slog.Warn("failed to kill ffmpeg started after stop", "stream_id", cfg.ID, "error", err)
+			}
+		}
+		w.running = true
 		w.cmd = cmd
+		w.exited = exited
+		w.stats.recordStart(time.Now())
+		w.outputs.reset()
+		w.anomaly.rebase(cfg)
+		w.lastArgs = args
+		w.recordHistory("start", "", time.Now())
 		w.mu.Unlock()
+		w.publishLifecycle(LifecycleEvent{Type: LifecycleStarted})
 
-		slog.Info("starting ffmpeg", "stream_id", w.cfg.ID)
-		if err := cmd.Start(); err != nil {
-			slog.Error("failed to start ffmpeg", "stream_id", w.cfg.ID, "error", err)
-			if closeErr := stdoutPipe.Close(); closeErr != nil {
-				slog.Warn("failed to close stdout pipe", "stream_id", w.cfg.ID, "error", closeErr)
-			}
-			if closeErr := stderrPipe.Close(); closeErr != nil {
-				slog.Warn("failed to close stderr pipe", "stream_id", w.cfg.ID, "error", closeErr)
-			}
-			w.mu.Lock()
-			w.running = false
-			w.mu.Unlock()
-			time.Sleep(1 * time.Second)
-			continue
+		// Restart without the overlay once the burn-in window closes.
+		var burnInTimer *time.Timer
+		if plan.BurnIn != "" {
+			slog.Info("debug burn-in enabled", "stream_id", cfg.ID, "until", cfg.BurnInUntil)
+			burnInTimer = time.AfterFunc(time.Until(cfg.BurnInUntil), func() {
+				if end, ok := restartBlackoutEnd(cfg, time.Now()); ok {
+					slog.Info("debug burn-in expired, restart deferred by blackout window", "stream_id", cfg.ID, "until", end)
+					burnInTimer.Reset(time.Until(end))
+					return
+				}
+				slog.Info("debug burn-in expired, restarting ffmpeg", "stream_id", cfg.ID)
+				if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+					slog.Warn("failed to stop ffmpeg after burn-in", "stream_id", cfg.ID, "error", err)
+				}
+			})
 		}
+		var hung atomic.Bool
+		startTimer := w.watchStart(cmd, startTimeout(cfg), &hung)
+		fireHook(cfg.ID, "start", cfg.Hooks.OnStart, nil)
 
-		// Create log writers to capture ffmpeg output.
-		stdoutWriter := &StreamLogWriter{
-			streamID: w.cfg.ID,
-			writer:   os.Stdout,
+		// Stdout carries -progress output; stderr carries ffmpeg logs.
+		stdoutWriter := &progressWriter{
+			onProgress: func(p ffmpegProgress) {
+				w.recordProgress(p, time.Now())
+			},
 		}
 		stderrWriter := &StreamLogWriter{
-			streamID: w.cfg.ID,
+			streamID: cfg.ID,
 			writer:   os.Stderr,
+			tail:     w.stderrTail(),
+			onLine:   w.outputLineHandler(cfg),
 		}
+		w.mu.Lock()
+		w.logWriter = stderrWriter
+		w.mu.Unlock()
 
 		// Start goroutines to continuously capture logs.
 		var wg sync.WaitGroup
@@ -184,11 +548,11 @@ func (w *StreamWorker) startLoop() {
 			defer wg.Done()
 			defer func() {
 				if closeErr := stdoutPipe.Close(); closeErr != nil {
-					slog.Warn("failed to close stdout pipe", "stream_id", w.cfg.ID, "error", closeErr)
+					slog.Warn("failed to close stdout pipe", "stream_id", cfg.ID, "error", closeErr)
 				}
 			}()
 			if _, err := io.Copy(stdoutWriter, stdoutPipe); err != nil {
-				slog.Warn("failed to copy stdout", "stream_id", w.cfg.ID, "error", err)
+				slog.Warn("failed to copy stdout", "stream_id", cfg.ID, "error", err)
 			}
 		}()
 
@@ -196,31 +560,236 @@ func (w *StreamWorker) startLoop() {
 			defer wg.Done()
 			defer func() {
 				if closeErr := stderrPipe.Close(); closeErr != nil {
-					slog.Warn("failed to close stderr pipe", "stream_id", w.cfg.ID, "error", closeErr)
+					slog.Warn("failed to close stderr pipe", "stream_id", cfg.ID, "error", closeErr)
 				}
 			}()
 			if _, err := io.Copy(stderrWriter, stderrPipe); err != nil {
-				slog.Warn("failed to copy stderr", "stream_id", w.cfg.ID, "error", err)
+				slog.Warn("failed to copy stderr", "stream_id", cfg.ID, "error", err)
 			}
 		}()
 
 		err = cmd.Wait()
 		wg.Wait() // Wait for log capture goroutines to finish.
+		startTimer.Stop()
+		if burnInTimer != nil {
+			burnInTimer.Stop()
+		}
 
+		// Disconnects during announced destination maintenance are expected.
+		now := currentClock().Now()
+		maintenance := inMaintenance(cfg.Dst, now)
+		// Streams stopped at the end of their programme or by Stop have not failed.
+		offAir := programmeEnded(cfg.ID, now)
 		w.mu.Lock()
+		stopped := w.stopRequestedLocked()
+		// The stream may have been renamed while ffmpeg was running.
+		cfg.ID = w.cfg.ID
+		w.logWriter = nil
 		w.running = false
+		w.stats.recordExit(now, err != nil && !maintenance && !offAir && !stopped)
+		if hung.Load() {
+			w.stats.Hangs++
+		}
+		exit := ""
+		if err != nil {
+			exit = err.Error()
+		}
+		w.recordHistory("exit", exit, now)
 		w.mu.Unlock()
+		close(exited)
+		exitCode := cmd.ProcessState.ExitCode()
+		w.publishLifecycle(LifecycleEvent{Type: LifecycleExited, Time: now, ExitCode: &exitCode, Error: exit})
 
-		if err != nil {
-			slog.Error("ffmpeg error", "stream_id", w.cfg.ID, "error", err)
+		switch {
+		case stopped:
+			slog.Info("ffmpeg stopped", "stream_id", cfg.ID)
+		case hung.Load():
+			w.recordError(ErrorCategoryHung, fmt.Errorf("no output within %s of start", startTimeout(cfg)))
+			slog.Error("ffmpeg hung after start", "stream_id", cfg.ID, "timeout", startTimeout(cfg))
+		case offAir:
+			slog.Info("ffmpeg stopped at the end of the programme", "stream_id", cfg.ID)
+		case maintenance:
+			slog.Info("ffmpeg exited during destination maintenance", "stream_id", cfg.ID, "error", err)
+		case err != nil:
+			w.recordError(ErrorCategoryExit, err)
+			slog.Error("ffmpeg error", "stream_id", cfg.ID, "error", err)
 		}
-		slog.Info("stream ended, retry in 1s", "stream_id", w.cfg.ID)
-		time.Sleep(1 * time.Second)
+		fireHook(cfg.ID, "exit", cfg.Hooks.OnExit, map[string]string{
+			"EXIT_CODE": strconv.Itoa(exitCode),
+		})
+		if stopped || offAir {
+			continue
+		}
+		if maintenance {
+			delay := currentSettings().MaintenanceRetryDelay
+			slog.Info("stream ended, retry after maintenance backoff", "stream_id", cfg.ID, "retry_in", delay)
+			w.publishLifecycle(LifecycleEvent{Type: LifecycleRestarting, RetryIn: delay.String()})
+			w.backoff(delay)
+			continue
+		}
+		delay := currentSettings().RestartDelay
+		slog.Info("stream ended, retrying", "stream_id", cfg.ID, "retry_in", delay)
+		w.publishLifecycle(LifecycleEvent{Type: LifecycleRestarting, RetryIn: delay.String()})
+		w.backoff(delay)
+	}
+}
+
+// errWorkerStopped 是调用 Stop 后 Err 返回的错误。
+var errWorkerStopped = errors.New("worker stopped")
+
+// Start 在独立的 goroutine 中启动流工作器的主循环，ctx 取消时与 Stop 一样终止 ffmpeg 并退出主循环。
+// 主循环仍在运行时不做任何事，因此更新配置时需要先 Stop 并等待 Done，保证同一工作器只有一个主循环。
+func (w *StreamWorker) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done != nil {
+		select {
+		case <-w.done:
+		default:
+			slog.Warn("worker already running, not starting another loop", "stream_id", w.cfg.ID)
+			return
+		}
+	}
+	loopCtx, cancel := context.WithCancelCause(ctx)
+	w.parent, w.ctx, w.cancel = ctx, loopCtx, cancel
+	w.done = make(chan struct{})
+	// Stop terminates ffmpeg itself and reports the error; only a cancelled parent needs this.
+	context.AfterFunc(loopCtx, func() {
+		if errors.Is(context.Cause(loopCtx), errWorkerStopped) {
+			return
+		}
+		if err := w.stop(); err != nil {
+			slog.Error("failed to stop ffmpeg", "stream_id", w.config().ID, "error", err)
+		}
+	})
+	go w.startLoop(loopCtx, w.done)
+}
+
+// Stop 通知主循环不再重启 ffmpeg 并终止当前的 ffmpeg，不等待主循环退出（见 Done）。
+// 可以重复调用；ffmpeg 在 SIGKILL 后仍未退出时返回错误，主循环在它退出后结束。
+func (w *StreamWorker) Stop() error {
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.cancel(errWorkerStopped)
 	}
+	w.mu.Unlock()
+	return w.stop()
 }
 
-// Start 启动流工作器，在独立的 goroutine 中运行。
-func (w *StreamWorker) Start() { go w.startLoop() }
+// Done 返回在主循环退出后关闭的通道，工作器未启动时返回已关闭的通道。
+func (w *StreamWorker) Done() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return w.done
+}
+
+// Err 返回主循环退出的原因：调用 Stop 时为 errWorkerStopped，ctx 取消时为其原因。
+// 主循环仍在运行或未启动时返回 nil。
+func (w *StreamWorker) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done == nil {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return context.Cause(w.ctx)
+	default:
+		return nil
+	}
+}
+
+// shutdown 停止工作器并等待主循环退出；ffmpeg 无法终止时不等待，直接返回错误。
+func (w *StreamWorker) shutdown() error {
+	if err := w.Stop(); err != nil {
+		return err
+	}
+	<-w.Done()
+	return nil
+}
+
+// restart 停止主循环，换用 cfg 后以原来的 ctx 重新启动。ffmpeg 无法终止时返回错误，并在它最终退出后再启动。
+func (w *StreamWorker) restart(cfg StreamConfig) error {
+	err := w.shutdown()
+	w.mu.Lock()
+	w.cfg = cfg
+	parent := w.parent
+	paused := w.paused
+	w.mu.Unlock()
+	if paused {
+		// The new config is kept and used once the stream is resumed.
+		return err
+	}
+	if parent == nil {
+		parent = context.Background()
+	}
+	if err != nil {
+		go func() {
+			<-w.Done()
+			w.Start(parent)
+		}()
+		return err
+	}
+	w.Start(parent)
+	return nil
+}
+
+// isStopped 判断工作器是否已被停止，停止的流不视为故障。
+func (w *StreamWorker) isStopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stopRequestedLocked()
+}
+
+// stopRequestedLocked 判断是否已调用 Stop 或 ctx 已取消，调用方需持有 w.mu。
+func (w *StreamWorker) stopRequestedLocked() bool {
+	return w.ctx != nil && w.ctx.Err() != nil
+}
+
+// sleep 等待 d，调用 Stop 或 ctx 取消时提前返回 false。
+func (w *StreamWorker) sleep(d time.Duration) bool {
+	w.mu.Lock()
+	ctx := w.ctx
+	w.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-currentClock().After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff 在重试前等待 d，等待期间看门狗不会把工作器视为异常。调用 Stop 时提前返回 false。
+func (w *StreamWorker) backoff(d time.Duration) bool {
+	w.mu.Lock()
+	w.backoffUntil = currentClock().Now().Add(d)
+	w.mu.Unlock()
+	return w.sleep(d)
+}
+
+// closePipes 关闭未启动的 ffmpeg 的输出管道。
+func closePipes(id string, pipes ...io.Closer) {
+	for _, p := range pipes {
+		if err := p.Close(); err != nil {
+			slog.Warn("failed to close ffmpeg pipe", "stream_id", id, "error", err)
+		}
+	}
+}
+
+// inBackoff 判断工作器是否处于主动等待重试的状态。
+func (w *StreamWorker) inBackoff() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return currentClock().Now().Before(w.backoffUntil)
+}
 
 // IsRunning 检查流工作器是否正在运行。
 func (w *StreamWorker) IsRunning() bool {
@@ -229,53 +798,445 @@ func (w *StreamWorker) IsRunning() bool {
 	return w.running
 }
 
-// ForceKill 强制终止流工作器及其关联的 ffmpeg 进程。
-// 会先尝试终止整个进程组，如果失败则直接终止进程。
-func (w *StreamWorker) ForceKill() {
+// Stats 返回工作器截至 now 的累计运行统计。
+func (w *StreamWorker) Stats(now time.Time) streamStats {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if w.cmd == nil || w.cmd.Process == nil {
-		w.running = false
-		return
+	return w.stats.snapshot(now)
+}
+
+// config 返回工作器当前的流配置。
+func (w *StreamWorker) config() StreamConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cfg
+}
+
+// Endpoint 返回工作器选定的推送地址，尚未选定时返回空字符串。
+func (w *StreamWorker) Endpoint() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.endpoint
+}
+
+// rename 把工作器改为新的流 ID，运行中的 ffmpeg 和累计统计保持不变。
+func (w *StreamWorker) rename(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cfg.ID = id
+	if w.logWriter != nil {
+		w.logWriter.setStreamID(id)
+	}
+}
+
+// pid 返回当前 ffmpeg 进程的 pid，未运行时返回 0。
+func (w *StreamWorker) pid() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running || w.cmd == nil || w.cmd.Process == nil {
+		return 0
 	}
-	pid := w.cmd.Process.Pid
-	slog.Info("force killing process", "stream_id", w.cfg.ID, "pid", pid)
-	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
-		slog.Warn("kill failed, trying direct kill", "stream_id", w.cfg.ID, "error", err)
-		if killErr := syscall.Kill(pid, syscall.SIGKILL); killErr != nil {
-			slog.Warn("direct kill also failed", "stream_id", w.cfg.ID, "error", killErr)
+	return w.cmd.Process.Pid
+}
+
+// recordProcStats 记录一次子进程资源采样，pid 已不是当前进程时丢弃。
+func (w *StreamWorker) recordProcStats(pid int, s processStats) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running && w.cmd != nil && w.cmd.Process != nil && w.cmd.Process.Pid == pid {
+		w.stats.Proc = s
+	}
+}
+
+// recordError 记录导致本次启动失败或 ffmpeg 异常退出的错误。
+func (w *StreamWorker) recordError(category string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.LastError = streamError{Category: category, Message: err.Error(), Time: time.Now()}
+	w.recordHistory(category, err.Error(), w.stats.LastError.Time)
+}
+
+// state 返回工作器当前的运行状态：running、stopped、off_schedule、backoff 或 starting。
+func (w *StreamWorker) state() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.paused:
+		return StreamStatePaused
+	case w.running:
+		return StreamStateRunning
+	case w.stopRequestedLocked():
+		return StreamStateStopped
+	case w.offSchedule:
+		return StreamStateOffSchedule
+	case currentClock().Now().Before(w.backoffUntil):
+		return StreamStateBackoff
+	}
+	return StreamStateStarting
+}
+
+// recordAVDrift 记录一次音画同步检查结果。
+func (w *StreamWorker) recordAVDrift(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.AVDrift = d
+	w.stats.AVDriftMeasured = true
+}
+
+// Terminate 停止流工作器当前的 ffmpeg 进程并等待其退出。先向进程组发送 SIGTERM，
+// 让 ffmpeg 写完文件尾、正常关闭输出；超过 settings.stop_timeout 仍未退出时再发送 SIGKILL。
+func (w *StreamWorker) Terminate() {
+	if err := w.stop(); err != nil {
+		slog.Error("failed to stop ffmpeg", "stream_id", w.config().ID, "error", err)
+	}
+}
+
+// stop 终止当前的 ffmpeg 进程并等待其退出，进程在 SIGKILL 后仍未退出时返回错误。
+func (w *StreamWorker) stop() error {
+	w.mu.Lock()
+	cmd, exited, id := w.cmd, w.exited, w.cfg.ID
+	running := w.running
+	w.mu.Unlock()
+	if !running || cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	w.publishLifecycle(LifecycleEvent{Type: LifecycleKilled})
+	return terminateProcess(id, cmd.Process.Pid, exited, currentSettings().StopTimeout)
+}
+
+// terminateProcess 向 pid 所在的进程组发送 SIGTERM，timeout 内 exited 未关闭时改发 SIGKILL，
+// 然后再等待 exited 关闭最多 timeout，仍未关闭时返回错误。进程组不存在时退回到只向 pid 发送信号。
+func terminateProcess(id string, pid int, exited <-chan struct{}, timeout time.Duration) error {
+	signalGroup := func(sig syscall.Signal) {
+		if err := syscall.Kill(-pid, sig); err != nil {
+			slog.Warn("group kill failed, trying direct kill", "stream_id", id, "signal", sig, "error", err)
+			if killErr := syscall.Kill(pid, sig); killErr != nil {
+				slog.Warn("direct kill also failed", "stream_id", id, "signal", sig, "error", killErr)
+			}
 		}
 	}
-	if waitErr := w.cmd.Wait(); waitErr != nil {
-		// Process already killed, ignore wait error
-		_ = waitErr
+	slog.Info("stopping process", "stream_id", id, "pid", pid, "timeout", timeout)
+	signalGroup(syscall.SIGTERM)
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+	}
+	slog.Warn("process did not exit after SIGTERM, force killing", "stream_id", id, "pid", pid)
+	signalGroup(syscall.SIGKILL)
+	// A process stuck in uninterruptible sleep ignores SIGKILL; do not block reloads on it forever.
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("process %d did not exit after SIGKILL", pid)
 	}
-	w.running = false
 }
 
-// loadConfig 从指定路径加载配置文件。
+// loadConfig 从指定路径加载配置文件，并合并所选环境的叠加文件。
 func loadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	if len(configEnvs) > 0 {
+		if data, err = applyOverlays(path, data, configEnvs); err != nil {
+			return nil, err
+		}
+	}
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+		return nil, annotateYAMLError(data, err)
 	}
+	cfg.applyDefaults()
 	return &cfg, nil
 }
 
+// applyDefaults 将全局默认值填充到未显式配置的流上，并把已弃用的数值字段换算为新字段。
+func (c *Config) applyDefaults() {
+	for i := range c.Streams {
+		if c.Streams[i].Region == "" {
+			c.Streams[i].Region = c.Region
+		}
+		if r := c.Streams[i].Resources; r != nil && r.MaxRSS == 0 {
+			r.MaxRSS = ByteSize(r.MaxRSSMB) << 20
+		}
+	}
+	if m := c.Metrics; m != nil && m.LogBuffer == 0 {
+		m.LogBuffer = ByteSize(m.LogBufferKB) << 10
+	}
+}
+
+// validateConfig 校验配置中无法由 YAML 解析保证的约束，例如绑定地址是否存在于本机。
+// DNS 解析依赖外部网络，只在启动 ffmpeg 前进行，不在此校验。
+func validateConfig(cfg *Config) error {
+	if cfg.Version > CurrentConfigVersion {
+		return fmt.Errorf("config version %d is newer than supported version %d", cfg.Version, CurrentConfigVersion)
+	}
+	ids := make(map[string]bool, len(cfg.Streams))
+	for _, s := range cfg.Streams {
+		ids[s.ID] = true
+	}
+	renamed := make(map[string]string)
+	for _, s := range cfg.Streams {
+		for _, old := range s.RenamedFrom {
+			if ids[old] {
+				return fmt.Errorf("stream %s: renamed_from %q is still used as a stream id", s.ID, old)
+			}
+			if other, ok := renamed[old]; ok {
+				return fmt.Errorf("stream %s: renamed_from %q is also claimed by stream %s", s.ID, old, other)
+			}
+			renamed[old] = s.ID
+		}
+	}
+	for _, s := range cfg.Streams {
+		if err := validateStream(cfg, s); err != nil {
+			return fmt.Errorf("stream %s: %w", s.ID, err)
+		}
+	}
+	for i := range cfg.Maintenance {
+		if err := cfg.Maintenance[i].validate(); err != nil {
+			return fmt.Errorf("maintenance[%d]: %w", i, err)
+		}
+	}
+	for name, p := range cfg.TranscodeProfiles {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("transcode profile %s: %w", name, err)
+		}
+	}
+	if cfg.Reports != nil {
+		if err := cfg.Reports.validate(); err != nil {
+			return fmt.Errorf("reports: %w", err)
+		}
+	}
+	if _, err := cfg.Log.resolve(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	if cfg.Alerts != nil {
+		if err := cfg.Alerts.validate(); err != nil {
+			return fmt.Errorf("alerts: %w", err)
+		}
+	}
+	if cfg.Settings != nil {
+		if err := cfg.Settings.validate(); err != nil {
+			return fmt.Errorf("settings: %w", err)
+		}
+	}
+	if cfg.Update != nil {
+		if err := cfg.Update.validate(); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+	}
+	if cfg.FFmpeg != nil {
+		if err := cfg.FFmpeg.validate(); err != nil {
+			return fmt.Errorf("ffmpeg: %w", err)
+		}
+	}
+	if cfg.Fleet != nil {
+		if err := cfg.Fleet.validate(); err != nil {
+			return fmt.Errorf("fleet: %w", err)
+		}
+	}
+	if cfg.AdaptiveRestart != nil {
+		if err := cfg.AdaptiveRestart.validate(); err != nil {
+			return fmt.Errorf("adaptive_restart: %w", err)
+		}
+	}
+	if cfg.DestinationPacing != nil {
+		if err := cfg.DestinationPacing.validate(); err != nil {
+			return fmt.Errorf("destination_pacing: %w", err)
+		}
+	}
+	if cfg.Hooks != nil {
+		if err := cfg.Hooks.validate(); err != nil {
+			return fmt.Errorf("hooks: %w", err)
+		}
+	}
+	for name, p := range cfg.Plugins {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("plugin %s: %w", name, err)
+		}
+	}
+	if err := validatePluginRefs(cfg); err != nil {
+		return err
+	}
+	if cfg.RunAs != nil {
+		if _, _, err := resolveRunAs(cfg.RunAs); err != nil {
+			return err
+		}
+	}
+	if cfg.Metrics != nil {
+		if err := cfg.Metrics.validate(); err != nil {
+			return fmt.Errorf("metrics: %w", err)
+		}
+	}
+	if cfg.Canary != nil {
+		if err := cfg.Canary.validate(cfg.Streams); err != nil {
+			return fmt.Errorf("canary: %w", err)
+		}
+	}
+	if cfg.Incidents != nil {
+		if err := cfg.Incidents.validate(cfg.Alerts); err != nil {
+			return fmt.Errorf("incidents: %w", err)
+		}
+	}
+	if cfg.Handover != nil {
+		if err := cfg.Handover.validate(cfg.Fleet); err != nil {
+			return fmt.Errorf("handover: %w", err)
+		}
+	}
+	if cfg.HealthScore != nil {
+		if err := cfg.HealthScore.validate(); err != nil {
+			return fmt.Errorf("health_score: %w", err)
+		}
+	}
+	if cfg.Anomaly != nil {
+		if err := cfg.Anomaly.validate(); err != nil {
+			return fmt.Errorf("anomaly: %w", err)
+		}
+	}
+	if cfg.Schedule != nil {
+		if err := cfg.Schedule.validate(cfg.Streams); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+	if cfg.Jobs != nil {
+		if err := cfg.Jobs.validate(); err != nil {
+			return fmt.Errorf("jobs: %w", err)
+		}
+	}
+	if cfg.API != nil {
+		if err := cfg.API.validate(); err != nil {
+			return fmt.Errorf("api: %w", err)
+		}
+	}
+	if cfg.SNMP != nil && cfg.SNMP.BaseOID != "" {
+		if _, err := parseOID(cfg.SNMP.BaseOID); err != nil {
+			return fmt.Errorf("snmp: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateStream 校验单路流的配置，cfg 用于查找流引用的转码配置等全局项。
+func validateStream(cfg *Config, s StreamConfig) error {
+	if !validIPFamily(s.IPFamily) {
+		return fmt.Errorf("invalid ip_family %q", s.IPFamily)
+	}
+	if _, err := resolveBindAddr(s.SrcBind, s.IPFamily); err != nil {
+		return fmt.Errorf("src_bind: %w", err)
+	}
+	if _, err := resolveBindAddr(s.DstBind, s.IPFamily); err != nil {
+		return fmt.Errorf("dst_bind: %w", err)
+	}
+	if err := validateDestination(s); err != nil {
+		return err
+	}
+	if err := validateOutputs(s.Outputs); err != nil {
+		return err
+	}
+	switch s.OutputMode {
+	case "", OutputModeTee:
+	case OutputModeIndependent:
+		if len(s.Outputs) == 0 {
+			return fmt.Errorf("output_mode independent requires outputs")
+		}
+	default:
+		return fmt.Errorf("output_mode must be tee or independent")
+	}
+	if err := validateMetadata(s.Metadata); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+	if s.EnhancedRTMP && outputFormat(s) != "flv" {
+		return fmt.Errorf("enhanced_rtmp requires an flv/rtmp output")
+	}
+	if !s.BurnInUntil.IsZero() && time.Until(s.BurnInUntil) > MaxBurnInDuration {
+		return fmt.Errorf("burn_in_until must be within %s", MaxBurnInDuration)
+	}
+	if s.TranscodeFallback != "" {
+		if !s.Probe {
+			return fmt.Errorf("transcode_fallback requires probe")
+		}
+		if _, ok := cfg.TranscodeProfiles[s.TranscodeFallback]; !ok {
+			return fmt.Errorf("unknown transcode profile %q", s.TranscodeFallback)
+		}
+	}
+	if s.KeyframeInterval < 0 {
+		return fmt.Errorf("keyframe_interval must not be negative")
+	}
+	if s.Deinterlace != nil {
+		if err := s.Deinterlace.validate(s.Probe); err != nil {
+			return fmt.Errorf("deinterlace: %w", err)
+		}
+	}
+	if s.FrameRate != "" {
+		if _, _, err := parseFrameRate(s.FrameRate); err != nil {
+			return fmt.Errorf("frame_rate: %w", err)
+		}
+	}
+	for i := range s.WaitFor {
+		if err := s.WaitFor[i].validate(); err != nil {
+			return fmt.Errorf("wait_for[%d]: %w", i, err)
+		}
+	}
+	if s.Resources != nil {
+		if err := s.Resources.validate(); err != nil {
+			return fmt.Errorf("resources: %w", err)
+		}
+	}
+	if s.AVSync != nil {
+		if err := s.AVSync.validate(); err != nil {
+			return fmt.Errorf("av_sync: %w", err)
+		}
+	}
+	if s.Sandbox != nil {
+		if err := s.Sandbox.validate(); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+	if s.StartTimeout < 0 {
+		return fmt.Errorf("start_timeout must not be negative")
+	}
+	if s.Synthetic != nil {
+		if err := s.Synthetic.validate(s); err != nil {
+			return fmt.Errorf("synthetic: %w", err)
+		}
+	}
+	for i := range s.RestartBlackout {
+		if err := s.RestartBlackout[i].validate(); err != nil {
+			return fmt.Errorf("restart_blackout[%d]: %w", i, err)
+		}
+	}
+	if s.Platform != nil {
+		if err := s.Platform.validate(s); err != nil {
+			return fmt.Errorf("platform: %w", err)
+		}
+	}
+	if s.Watchdog != nil {
+		if err := s.Watchdog.validate(); err != nil {
+			return fmt.Errorf("watchdog: %w", err)
+		}
+	}
+	if s.Archive != nil {
+		if err := s.Archive.validate(cfg, s); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+	return nil
+}
+
 // writePID 将当前进程的 PID 写入 PID 文件。
 // 如果文件不存在会自动创建，如果写入失败会终止程序。
 func writePID() {
-	if err := os.MkdirAll("/var/run", 0755); err != nil {
-		slog.Error("cannot create /var/run directory", "error", err)
+	const hint = "run as root, or as a user that can write the pid directory"
+	dir := filepath.Dir(paths.PIDFile)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("cannot create pid directory", "dir", dir, "error", withPermissionHint(err, hint))
 		os.Exit(1)
 	}
-	f, err := os.OpenFile(PIDFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	f, err := os.OpenFile(paths.PIDFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		slog.Error("cannot write pid file", "error", err)
+		slog.Error("cannot write pid file", "error", withPermissionHint(err, hint))
 		os.Exit(1)
 	}
 	if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
@@ -292,25 +1253,11 @@ func writePID() {
 	}
 }
 
-// rotateLog 检查日志文件大小，如果超过限制则进行轮转。
-// 轮转策略：将当前日志重命名为 .1，旧的 .1 重命名为 .2，以此类推。
-func rotateLog() error {
-	info, err := os.Stat(LogFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // File doesn't exist yet, no need to rotate.
-		}
-		return err
-	}
-
-	if info.Size() < MaxLogSize {
-		return nil // File is not large enough.
-	}
-
-	// Rotate existing logs.
-	for i := MaxLogFiles - 1; i >= 1; i-- {
-		oldFile := fmt.Sprintf("%s.%d", LogFile, i)
-		newFile := fmt.Sprintf("%s.%d", LogFile, i+1)
+// rotateLogFiles 轮转日志文件：path.N-1 依次改名为 path.N，当前文件改名为 path.1，最多保留 maxFiles 个。
+func rotateLogFiles(path string, maxFiles int) error {
+	for i := maxFiles - 1; i >= 1; i-- {
+		oldFile := fmt.Sprintf("%s.%d", path, i)
+		newFile := fmt.Sprintf("%s.%d", path, i+1)
 		if _, err := os.Stat(oldFile); err == nil {
 			if renameErr := os.Rename(oldFile, newFile); renameErr != nil {
 				return fmt.Errorf("failed to rename log file %s to %s: %w", oldFile, newFile, renameErr)
@@ -318,59 +1265,64 @@ func rotateLog() error {
 		}
 	}
 
-	// Move current log to .1.
-	backupFile := fmt.Sprintf("%s.1", LogFile)
-	if err := os.Rename(LogFile, backupFile); err != nil {
+	backupFile := fmt.Sprintf("%s.1", path)
+	if err := os.Rename(path, backupFile); err != nil {
 		return fmt.Errorf("failed to rename current log file to %s: %w", backupFile, err)
 	}
 	return nil
 }
 
-// initLog 初始化日志系统，创建日志目录和日志文件。
-// 如果日志文件超过大小限制会先进行轮转。
+// initLog 初始化日志系统，创建日志目录并打开主日志文件。
+// 如果日志文件超过大小限制会先进行轮转，之后由 mainLog 在写入时轮转。
 // 如果初始化失败会 panic。
-func initLog() *slog.Logger {
-	if err := os.MkdirAll(LogDir, 0755); err != nil {
-		panic(fmt.Errorf("failed to create log directory: %w", err))
+func initLog() {
+	const hint = "run as root, or as a user that can write the log directory"
+	if err := os.MkdirAll(paths.LogDir, 0755); err != nil {
+		panic(fmt.Errorf("failed to create log directory: %w", withPermissionHint(err, hint)))
 	}
-
-	// Rotate log if needed (before opening new file).
-	if err := rotateLog(); err != nil {
-		// Log rotation failure is not critical, log warning and continue
-		slog.Warn("log rotation failed", "error", err)
+	if err := mainLog.open(paths.LogFile); err != nil {
+		panic(fmt.Errorf("failed to open log file: %w", withPermissionHint(err, hint)))
 	}
 
-	f, err := os.OpenFile(LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		panic(fmt.Errorf("failed to open log file: %w", err))
-	}
+	// JSON handler (recommended for production), created once: rotation swaps the file underneath it.
+	slog.SetDefault(slog.New(newLogHandler(mainLog)))
+}
 
-	// Create JSON format handler (recommended for production).
-	opts := &slog.HandlerOptions{
-		Level:     slog.LevelInfo,
-		AddSource: true, // Add source code location.
+// cleanupPID 清理 PID 文件。
+// 如果文件不存在则忽略错误。
+func cleanupPID() {
+	if err := os.Remove(paths.PIDFile); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove PID file", "error", withPermissionHint(err,
+			"after dropping privileges the pid directory must be writable by run_as user"))
 	}
-	handler := slog.NewJSONHandler(f, opts)
-	logger := slog.New(handler)
+}
 
-	// Set as default logger.
-	slog.SetDefault(logger)
+// cleanupControl 删除控制套接字文件。
+// 如果文件不存在则忽略错误。
+func cleanupControl() {
+	if err := os.Remove(paths.Control); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove control socket", "path", paths.Control, "error", err)
+	}
+}
 
-	return logger
+// printStartupError 把启动阶段（日志尚未初始化）的错误输出到 stderr。
+func printStartupError(err error) {
+	if _, printErr := fmt.Fprintf(os.Stderr, "ERROR: %v\n", err); printErr != nil {
+		slog.Error("failed to print error to stderr", "error", printErr)
+	}
 }
 
-// cleanupPID 清理 PID 文件。
-// 如果文件不存在则忽略错误。
-func cleanupPID() {
-	if err := os.Remove(PIDFilePath); err != nil && !os.IsNotExist(err) {
-		slog.Warn("failed to remove PID file", "error", err)
+// printCLI 把子命令的输出写到 w，写入失败时与 printStartupError 一样记录到日志。
+func printCLI(w io.Writer, msg string) {
+	if _, err := fmt.Fprint(w, msg); err != nil {
+		slog.Error("failed to print command output", "error", err)
 	}
 }
 
 // checkFFmpeg 检查系统中是否安装了 ffmpeg 并可以执行。
 // 如果 ffmpeg 不可用则返回错误。
 func checkFFmpeg() error {
-	cmd := exec.Command("ffmpeg", "-version")
+	cmd := exec.Command(ffmpegBin, "-version")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("ffmpeg not found or not executable: %v", err)
@@ -379,6 +1331,7 @@ func checkFFmpeg() error {
 	// Extract version from output (first line usually contains version info).
 	lines := strings.Split(string(output), "\n")
 	if len(lines) > 0 {
+		ffmpegVersion = strings.TrimSpace(lines[0])
 		if _, err := fmt.Fprintf(os.Stderr, "[*] FFmpeg detected: %s\n", strings.TrimSpace(lines[0])); err != nil {
 			// Non-critical error, just log it
 			slog.Warn("failed to write ffmpeg version to stderr", "error", err)
@@ -387,161 +1340,464 @@ func checkFFmpeg() error {
 	return nil
 }
 
-// reloadConfig 重新加载配置文件并更新流工作器。
-// 会停止已删除的流，启动新增的流，更新配置变更的流。
+// readConfig 加载并校验配置文件。
+func readConfig(path string) (*Config, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("load config failed: %v", err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// reloadConfig 重新加载配置文件并更新流工作器。配置了金丝雀验证时可能阻塞到 canary.timeout。
 func reloadConfig(state *AppState) error {
-	cfg, err := loadConfig(ConfigPath)
+	if draining() {
+		return errDraining
+	}
+	cfg, err := readConfig(paths.Config)
 	if err != nil {
-		return fmt.Errorf("load config failed: %v", err)
+		return err
+	}
+	state.mu.RLock()
+	restartNeeded := pathSettingsChanged(state.config.Settings, cfg.Settings)
+	state.mu.RUnlock()
+	if restartNeeded {
+		slog.Warn("settings.log_file and settings.pid_file only take effect after a restart")
 	}
+	if err := verifyCanary(state, cfg); err != nil {
+		return err
+	}
+	if err := applyConfig(state, cfg); err != nil {
+		return &configAppliedError{err}
+	}
+	return nil
+}
 
-	state.mu.Lock()
-	defer state.mu.Unlock()
-
-	// Stop and remove workers that are no longer in config.
-	for id, w := range state.workers {
-		found := false
-		for _, s := range cfg.Streams {
-			if s.ID == id {
-				found = true
-				break
-			}
+// configAppliedError 表示新配置已经生效、只是部分工作器失败。此时运行中的就是新配置，
+// 调用方不能再把配置文件恢复为旧内容，否则文件与运行状态不一致，下次重载会悄悄回退。
+type configAppliedError struct {
+	err error
+}
+
+// Error 实现 error 接口。
+func (e *configAppliedError) Error() string {
+	return "config applied, but some workers failed: " + e.err.Error()
+}
+
+// Unwrap 返回工作器的错误。
+func (e *configAppliedError) Unwrap() error {
+	return e.err
+}
+
+// configApplied 判断 err 是否发生在新配置生效之后。
+func configApplied(err error) bool {
+	var applied *configAppliedError
+	return errors.As(err, &applied)
+}
+
+// renameWorkers 把 renamed_from 指向的旧工作器移到新 ID 下，使改名不表现为删除再新增。
+// 新 ID 已有工作器或旧 ID 仍在配置中时不改名。
+func renameWorkers(workers map[string]*StreamWorker, streams []StreamConfig) {
+	wanted := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		wanted[s.ID] = true
+	}
+	for _, s := range streams {
+		if _, exists := workers[s.ID]; exists {
+			continue
 		}
-		if !found {
-			slog.Info("removing worker", "stream_id", id)
-			w.ForceKill()
-			delete(state.workers, id)
+		for _, old := range s.RenamedFrom {
+			w, ok := workers[old]
+			if !ok || wanted[old] {
+				continue
+			}
+			slog.Info("renaming worker", "stream_id", s.ID, "previous_id", old)
+			w.rename(s.ID)
+			delete(workers, old)
+			workers[s.ID] = w
+			break
 		}
 	}
+}
 
-	// Add or update workers.
-	for _, s := range cfg.Streams {
-		if w, exists := state.workers[s.ID]; exists {
-			// Update config if changed.
-			if w.cfg.Src != s.Src || w.cfg.Dst != s.Dst {
-				slog.Info("updating worker", "stream_id", s.ID)
-				w.ForceKill()
-				w.cfg = s
-				w.Start()
+// applyMu 串行化配置应用，前一次重载仍在停止或重启工作器时，后一次重载等待它完成。
+var applyMu sync.Mutex
+
+// workerOp 是重载时需要停止或重启的一个工作器。
+type workerOp struct {
+	id  string
+	run func() error
+}
+
+// applyConfig 将配置应用到流工作器。
+// 会停止已删除的流，启动新增的流，更新配置变更的流；临时流不在配置中，但会被保留。
+// 只在计算变更时持有 state.mu，停止和重启 ffmpeg 在锁外按 settings.reload_concurrency 并发进行，
+// 状态查询和看门狗不会被大批量重载阻塞。返回所有失败工作器的汇总错误，失败不影响其他流。
+// 配置生效后立即刷新快照，重载、管理接口和控制套接字的修改都能被 export-config 导出。
+func applyConfig(state *AppState, cfg *Config) error {
+	defer loopApply.begin()()
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	state.mu.Lock()
+	prev := state.config
+	state.config = cfg
+	hookPolicy.Store(cfg.Hooks)
+	plugins.Store(newPlugins(cfg.Plugins))
+	transcodeProfiles.Store(&cfg.TranscodeProfiles)
+	maintenanceWindows.Store(&cfg.Maintenance)
+	alertRouting.Store(newAlertRouter(cfg))
+	adaptiveRestart.Store(cfg.AdaptiveRestart)
+	destinationPacing.Store(cfg.DestinationPacing)
+	scheduleConfig.Store(cfg.Schedule)
+	ffmpegPolicy.Store(cfg.FFmpeg)
+	healthScoring.Store(cfg.HealthScore)
+	anomalyDetection.Store(cfg.Anomaly)
+	prevSettings := currentSettings()
+	runtimeSettings.Store(cfg.Settings)
+	notifyLogSettings(prevSettings, currentSettings())
+	if lt, err := cfg.Log.resolve(); err == nil {
+		logTime.Store(lt)
+	}
+	logLevels.setConfigured(cfg.Log.level())
+
+	streams := effectiveStreams(state, cfg)
+	wanted := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		wanted[s.ID] = true
+	}
+
+	var ops []workerOp
+	var added []*StreamWorker
+	var updated []StreamConfig
+	state.workers.update(func(workers map[string]*StreamWorker) {
+		renameWorkers(workers, streams)
+		// Stop and remove workers that are no longer in config.
+		for id, w := range workers {
+			if wanted[id] || deferRemoval(state, cfg, id, time.Now()) {
+				continue
+			}
+			slog.Info("removing worker", "stream_id", id)
+			delete(workers, id)
+			forgetEvents(id)
+			ops = append(ops, workerOp{id: id, run: w.shutdown})
+		}
+		for _, s := range streams {
+			cancelHandover(state, s.ID)
+			if _, exists := workers[s.ID]; exists {
+				updated = append(updated, s)
+				continue
 			}
-		} else {
-			// New worker.
 			slog.Info("adding new worker", "stream_id", s.ID)
 			w := &StreamWorker{cfg: s}
-			state.workers[s.ID] = w
-			w.Start()
+			workers[s.ID] = w
+			added = append(added, w)
 		}
+	})
+	for _, w := range added {
+		// Daemon workers run until removed; shutdown stops each of them explicitly.
+		w.Start(context.Background())
 	}
 
-	return nil
+	// Update workers whose config changed.
+	for _, s := range updated {
+		w, _ := state.workers.get(s.ID)
+		changed := streamRestartDiff(prev, cfg, w.config(), s)
+		if len(changed) == 0 {
+			// Only representation or renamed_from changed; keep ffmpeg running.
+			w.mu.Lock()
+			w.deferredCfg = nil
+			w.cfg = s
+			w.mu.Unlock()
+			continue
+		}
+		if deferRestart(w, s, time.Now()) {
+			continue
+		}
+		slog.Info("updating worker", "stream_id", s.ID, "changed", changed)
+		s := s
+		ops = append(ops, workerOp{id: s.ID, run: func() error { return w.restart(s) }})
+	}
+	state.mu.Unlock()
+	// Still under applyMu, so snapshots are written in the same order as configs are applied.
+	saveSnapshot(cfg)
+	rememberRecordings(streams)
+
+	return runWorkerOps(ops, currentSettings().ReloadConcurrency)
+}
+
+// runWorkerOps 以最多 limit 个并发执行 ops，返回所有失败的汇总错误。
+func runWorkerOps(ops []workerOp, limit int) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	errs := make([]error, len(ops))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, op := range ops {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, op workerOp) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := op.run(); err != nil {
+				errs[i] = fmt.Errorf("stream %s: %w", op.id, err)
+			}
+			// A large reload may take longer than loop_stall_timeout; each finished worker counts as progress.
+			loopApply.beat()
+		}(i, op)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
 // run 是应用程序的主逻辑入口，返回退出码。
 // 使用 return 而不是 os.Exit，确保 defer 语句能正常执行。
-func run() int {
+func run(args []string) int {
+	fs := flag.NewFlagSet("stream-runner", flag.ContinueOnError)
+	env := fs.String("env", strings.Join(configEnvs, ","), T("flag.env"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	envs, err := parseEnvList(*env)
+	if err != nil {
+		printStartupError(err)
+		return 2
+	}
+	configEnvs = envs
+
+	// Initial config load; it comes first because settings may move the log and pid files
+	// and the ffmpeg section decides which ffmpeg to check.
+	cfg, err := readConfig(paths.Config)
+	if err != nil {
+		printStartupError(err)
+		return 1
+	}
+
 	// Check ffmpeg availability before starting.
+	if err := resolveFFmpeg(cfg.FFmpeg); err != nil {
+		printStartupError(err)
+		return 1
+	}
 	if err := checkFFmpeg(); err != nil {
-		if _, printErr := fmt.Fprintf(os.Stderr, "ERROR: %v\n", err); printErr != nil {
-			slog.Error("failed to print error to stderr", "error", printErr)
-		}
+		printStartupError(err)
+		return 1
+	}
+	ffmpegVersions.seed(ffmpegVersion)
+	if err := checkFFmpegVersionAtStartup(cfg.FFmpeg, ffmpegVersion); err != nil {
+		printStartupError(err)
 		return 1
 	}
+	applyPathSettings(cfg.Settings)
+	runtimeSettings.Store(cfg.Settings)
 
-	logger := initLog()
-	defer func() {
-		// Logger will handle file closing when done.
-		_ = logger
-	}()
+	initLog()
 
 	writePID()
 	defer cleanupPID()
 
 	// Setup signal handlers.
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
 
-	slog.Info("stream-runner starting")
+	build := currentBuildInfo()
+	slog.Info("stream-runner starting", "version", build.Version, "commit", build.Commit, "env", strings.Join(configEnvs, ","))
 
 	state := &AppState{
-		workers: make(map[string]*StreamWorker),
-		logger:  logger,
+		workers: newWorkerMap(nil),
 	}
+	// Written before dropping privileges so the file can be handed over to run_as.
+	saveSnapshot(cfg)
+	defer removeSnapshot()
 
-	// Initial config load.
-	if err := reloadConfig(state); err != nil {
-		slog.Error("initial config load failed", "error", err)
-		return 1
+	// Listeners are bound before dropping privileges so that privileged ports work.
+	// Their addresses are read once at startup.
+	const portHint = "ports below 1024 require root or CAP_NET_BIND_SERVICE"
+	if m := cfg.Metrics; m != nil && m.Listen != "" {
+		if m.LogBuffer > 0 {
+			logRing.Store(newLogBuffer(int(m.LogBuffer)))
+		}
+		ln, err := net.Listen("tcp", m.Listen)
+		if err != nil {
+			slog.Error("metrics server failed to listen", "addr", m.Listen, "error", withPermissionHint(err, portHint))
+			return 1
+		}
+		go supervise("metrics server", func() { serveMetrics(state, ln) })
 	}
-
-	// Watchdog goroutine monitors and restarts stopped workers.
-	go func() {
-		time.Sleep(10 * time.Second) // Give workers time to start.
-		for {
-			time.Sleep(5 * time.Second)
-			state.mu.RLock()
-			for id, w := range state.workers {
-				if !w.IsRunning() {
-					slog.Warn("worker not running, force kill & restart", "stream_id", id)
-					w.ForceKill()
-					time.Sleep(1 * time.Second) // Wait before next check.
-				}
-			}
-			state.mu.RUnlock()
+	if c := cfg.API; c != nil {
+		ln, err := net.Listen("tcp", c.Listen)
+		if err != nil {
+			slog.Error("api server failed to listen", "addr", c.Listen, "error", withPermissionHint(err, portHint))
+			return 1
 		}
-	}()
+		go supervise("api server", func() { serveAPI(state, ln) })
+	}
+	// The control socket is always available; only the daemon's user (root or run_as) can connect.
+	if ln, err := listenControl(paths.Control); err != nil {
+		slog.Warn("control socket unavailable, status/reload/add/remove commands will not work", "path", paths.Control, "error", err)
+	} else {
+		defer cleanupControl()
+		go supervise("control socket", func() { serveControl(state, ln) })
+	}
+	if c := cfg.SNMP; c != nil && c.Listen != "" {
+		agent, err := newSNMPAgent(state, c)
+		if err != nil {
+			slog.Error("failed to create snmp agent", "error", err)
+			return 1
+		}
+		conn, err := net.ListenPacket("udp", c.Listen)
+		if err != nil {
+			slog.Error("snmp agent failed to listen", "addr", c.Listen, "error", withPermissionHint(err, portHint))
+			return 1
+		}
+		go supervise("snmp agent", func() { agent.serve(conn) })
+	}
 
-	// Log rotation checker runs periodically.
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
-		for range ticker.C {
-			if err := rotateLog(); err != nil {
-				slog.Error("log rotation check failed", "error", err)
-			} else {
-				// Check if rotation actually happened (file was renamed).
-				if info, err := os.Stat(LogFile); err == nil && info.Size() == 0 {
-					// File was rotated, reopen it.
-					newFile, err := os.OpenFile(LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-					if err == nil {
-						opts := &slog.HandlerOptions{
-							Level:     slog.LevelInfo,
-							AddSource: true,
-						}
-						handler := slog.NewJSONHandler(newFile, opts)
-						state.mu.Lock()
-						state.logger = slog.New(handler)
-						slog.SetDefault(state.logger)
-						state.mu.Unlock()
-					}
-				}
-			}
+	if cfg.RunAs != nil {
+		if err := dropPrivileges(cfg.RunAs); err != nil {
+			slog.Error("failed to drop privileges", "error", err)
+			return 1
 		}
-	}()
+		slog.Info("dropped privileges", "user", cfg.RunAs.User, "uid", os.Getuid(), "gid", os.Getgid())
+	}
 
-	// Main signal loop handles SIGHUP (reload) and SIGINT/SIGTERM (shutdown).
+	// Opened after dropping privileges so the file belongs to the run_as user.
+	if err := eventSeq.open(filepath.Join(paths.LogDir, eventSeqFile)); err != nil {
+		slog.Warn("failed to load event sequence, numbering continues in memory", "error", err)
+	}
+
+	// Workers start only after privileges are dropped so ffmpeg never runs as root.
+	if err := applyConfig(state, cfg); err != nil {
+		slog.Error("failed to apply config", "error", err)
+	}
+
+	// Auxiliary goroutines run under supervise: a panic is logged and alerted, and the goroutine is restarted.
+
+	// Watchdog checks each worker with its own strategy.
+	go supervise("watchdog", func() { newWatchdog(state).run() })
+
+	// Host monitor throttles ffmpeg starts while the host is overloaded.
+	go supervise("host monitor", func() { (&hostMonitor{}).run() })
+
+	// Usage reporter summarizes per-stream usage at each report boundary.
+	reporter := &usageReporter{state: state}
+	go supervise("usage reporter", reporter.run)
+
+	// Process monitor samples CPU, memory and I/O of ffmpeg children.
+	go supervise("process monitor", func() { newProcMonitor(state).run() })
+
+	// Metrics pusher sends metrics to the configured push targets.
+	go supervise("metrics pusher", func() { newMetricsPusher(state).run() })
+
+	// Job queue runs one-shot ffmpeg jobs submitted through the API.
+	jobs.Store(newJobQueue(state))
+
+	// Temporary stream reaper removes temporary streams whose TTL has expired.
+	go supervise("temporary stream reaper", func() { runTemporaryReaper(state) })
+
+	// Deferred restart checker applies config changes held back by restart blackout windows.
+	go supervise("deferred restarts", func() { runDeferredRestarts(state) })
+
+	// Handover checker stops removed streams once another node has taken them over.
+	go supervise("handovers", func() { runHandovers(state) })
+
+	// Synthetic monitor verifies synthetic streams from the platform side.
+	sm := newSyntheticMonitor(state)
+	synthetic.Store(sm)
+	go supervise("synthetic monitor", sm.run)
+
+	// Platform monitor polls platform-side broadcast health.
+	pm := newPlatformMonitor(state)
+	platforms.Store(pm)
+	go supervise("platform monitor", pm.run)
+
+	// Schedule monitor fetches the EPG feed and stops streams whose programme has ended.
+	em := newScheduleMonitor(state)
+	epg.Store(em)
+	go supervise("schedule monitor", em.run)
+
+	// Incident monitor opens an incident for streams that keep failing.
+	go supervise("incident monitor", func() { newIncidentMonitor(state).run() })
+
+	// Fleet monitor polls other nodes listed in fleet.nodes.
+	fm := newFleetMonitor(state)
+	fleet.Store(fm)
+	go supervise("fleet monitor", fm.run)
+
+	// A/V sync monitor periodically probes sources with av_sync enabled.
+	go supervise("av sync monitor", func() { newAVSyncMonitor(state).run() })
+
+	// Log rotation checker reopens or rotates the main log periodically.
+	go supervise("log rotation", runLogRotation)
+
+	// Loop monitor dumps goroutine stacks and alerts when a core loop stops making progress.
+	go supervise("loop monitor", runLoopMonitor)
+
+	// Main signal loop handles SIGHUP (reload), SIGUSR1 (toggle debug logging) and SIGINT/SIGTERM (shutdown).
 	for {
 		sig := <-sigChan
+		done := loopSignal.begin()
 		switch sig {
 		case syscall.SIGHUP:
 			slog.Info("received SIGHUP, reloading config")
-			if err := reloadConfig(state); err != nil {
+			prev := currentConfig(state)
+			err := reloadConfig(state)
+			if err != nil {
 				slog.Error("config reload failed", "error", err)
 			} else {
 				slog.Info("config reloaded successfully")
 			}
+			auditReload(AuditViaSignal, "SIGHUP", prev, currentConfig(state), err)
+		case syscall.SIGUSR1:
+			prev := logLevels.status()
+			st := logLevels.toggleDebug()
+			slog.Warn("received SIGUSR1, log level changed", "level", st.Level, "configured", st.Configured)
+			writeAudit(auditEntry{Actor: "SIGUSR1", Via: AuditViaSignal, Action: "log-level", Before: prev.Level, After: st.Level})
 		case syscall.SIGINT, syscall.SIGTERM:
 			slog.Info("received termination signal, shutting down")
-			state.mu.Lock()
-			for id, w := range state.workers {
+			name := "SIGTERM"
+			if sig == syscall.SIGINT {
+				name = "SIGINT"
+			}
+			writeAudit(auditEntry{Actor: name, Via: AuditViaSignal, Action: "shutdown", Before: auditStreamIDs(currentConfig(state))})
+			// Stop all workers in parallel so shutdown takes at most one stop_timeout.
+			applyMu.Lock()
+			var wg sync.WaitGroup
+			for id, w := range state.workers.snapshot() {
 				slog.Info("stopping worker", "stream_id", id)
-				w.ForceKill()
+				wg.Add(1)
+				go func(w *StreamWorker) {
+					defer wg.Done()
+					if err := w.shutdown(); err != nil {
+						slog.Error("failed to stop worker", "stream_id", w.config().ID, "error", err)
+					}
+				}(w)
 			}
-			state.mu.Unlock()
+			wg.Wait()
 			return 0
 		}
+		done()
 	}
 }
 
 func main() {
-	os.Exit(run())
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+		switch os.Args[1] {
+		case "help", "-h", "--help":
+			printUsage()
+			os.Exit(0)
+		case "version", "--version":
+			fmt.Println(currentBuildInfo())
+			os.Exit(0)
+		}
+	}
+	os.Exit(run(os.Args[1:]))
 }
@@ -2,14 +2,37 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// TestMain 把审计日志、配置快照和日志目录中的状态文件写到临时目录，避免测试中的管理操作写入系统目录。
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "stream-runner-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	paths.AuditLog = filepath.Join(dir, "audit.log")
+	paths.Snapshot = filepath.Join(dir, "stream-runner.snapshot.yml")
+	paths.LogDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 // TestStreamConfig 测试 StreamConfig 结构体
 func TestStreamConfig(t *testing.T) {
 	cfg := StreamConfig{
@@ -121,32 +144,135 @@ func TestStreamWorkerIsRunning(t *testing.T) {
 	}
 }
 
-// TestRotateLog 测试日志轮转功能
-func TestRotateLog(t *testing.T) {
-	tmpDir := t.TempDir()
-	logFile := filepath.Join(tmpDir, "test.log")
+// TestTerminateProcess 测试停止进程时先发送 SIGTERM，忽略 SIGTERM 的进程在超时后被 SIGKILL 终止
+func TestTerminateProcess(t *testing.T) {
+	for _, c := range []struct {
+		script string
+		signal syscall.Signal
+	}{
+		{"sleep 10", syscall.SIGTERM},
+		{"trap '' TERM; sleep 10", syscall.SIGKILL},
+	} {
+		cmd := exec.Command("sh", "-c", c.script)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := cmd.Start(); err != nil {
+			t.Skipf("cannot start sh: %v", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(exited)
+		}()
+		// Give the shell time to install its trap.
+		time.Sleep(100 * time.Millisecond)
+		if err := terminateProcess("test", cmd.Process.Pid, exited, 200*time.Millisecond); err != nil {
+			t.Errorf("%q: %v", c.script, err)
+		}
+		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		if !ws.Signaled() || ws.Signal() != c.signal {
+			t.Errorf("%q: expected exit by %v, got %v", c.script, c.signal, ws)
+		}
+	}
+}
 
-	// 创建一个大文件（模拟需要轮转的情况）
-	largeContent := make([]byte, MaxLogSize+1)
-	for i := range largeContent {
-		largeContent[i] = 'a'
+// TestRunWorkerOps 测试重载时并发数不超过上限，并汇总所有失败的工作器
+func TestRunWorkerOps(t *testing.T) {
+	var running, peak atomic.Int32
+	var ops []workerOp
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("s%02d", i)
+		ops = append(ops, workerOp{id: id, run: func() error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			if id == "s03" || id == "s17" {
+				return errors.New("did not exit")
+			}
+			return nil
+		}})
+	}
+	start := time.Now()
+	err := runWorkerOps(ops, 4)
+	if p := peak.Load(); p > 4 || p < 2 {
+		t.Errorf("peak concurrency = %d, want 2..4", p)
 	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("ops took %s, not run concurrently", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "stream s03: did not exit") || !strings.Contains(err.Error(), "stream s17") {
+		t.Errorf("err = %v", err)
+	}
+	if err := runWorkerOps(nil, 4); err != nil {
+		t.Error(err)
+	}
+}
 
-	if err := os.WriteFile(logFile, largeContent, 0644); err != nil {
-		t.Fatalf("failed to create test log file: %v", err)
+// TestRenameWorkers 测试按 renamed_from 改名时保留原工作器
+func TestRenameWorkers(t *testing.T) {
+	old := &StreamWorker{cfg: StreamConfig{ID: "cam-1"}, logWriter: &StreamLogWriter{streamID: "cam-1"}}
+	old.stats.Starts = 3
+	kept := &StreamWorker{cfg: StreamConfig{ID: "cam-2"}}
+	workers := map[string]*StreamWorker{"cam-1": old, "cam-2": kept}
+
+	renameWorkers(workers, []StreamConfig{
+		{ID: "lobby", RenamedFrom: []string{"cam-1"}},
+		{ID: "cam-2"},
+		// cam-2 is still configured, so it must not be taken over.
+		{ID: "hall", RenamedFrom: []string{"cam-2"}},
+	})
+
+	if workers["lobby"] != old || workers["cam-1"] != nil {
+		t.Fatalf("cam-1 was not renamed to lobby: %v", workers)
 	}
+	if old.config().ID != "lobby" || old.logWriter.streamID != "lobby" || old.Stats(time.Now()).Starts != 3 {
+		t.Errorf("renamed worker lost state: id=%s log=%s", old.config().ID, old.logWriter.streamID)
+	}
+	if workers["cam-2"] != kept || workers["hall"] != nil {
+		t.Errorf("cam-2 should stay in place: %v", workers)
+	}
+}
+
+// TestRotateLog 测试日志轮转功能：写入超过阈值时换新文件，保留的文件数按设置，文件被外部移走时重新打开
+func TestRotateLog(t *testing.T) {
+	defer runtimeSettings.Store(runtimeSettings.Load())
+	runtimeSettings.Store(&Settings{LogMaxSize: 100, LogMaxFiles: 2})
+	path := filepath.Join(t.TempDir(), "test.log")
 
-	// 临时修改 LogFile 常量（通过环境变量或函数参数）
-	// 由于 LogFile 是常量，我们需要创建一个测试函数
-	originalLogFile := LogFile
-	defer func() {
-		// 恢复原始值（虽然常量不能修改，但这里只是演示测试思路）
-		_ = originalLogFile
-	}()
+	l := &logFile{}
+	if err := l.open(path); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(newLogHandler(l))
+	for i := 0; i < 10; i++ {
+		logger.Info("a record long enough to rotate the log after a few lines", "i", i)
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more than log_max_files rotated logs")
+	}
 
-	// 注意：由于 rotateLog 使用全局常量 LogFile，这个测试需要重构代码
-	// 或者创建一个接受路径参数的版本
-	// 这里仅作为测试示例
+	// Moved away by an external tool: check reopens the configured path.
+	runtimeSettings.Store(&Settings{LogMaxSize: 1 << 20, LogMaxFiles: 2})
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.check(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after reopen")
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "after reopen") {
+		t.Errorf("log after reopen = %q, %v", data, err)
+	}
 }
 
 // TestStreamLogWriter 测试 StreamLogWriter
@@ -222,3 +348,143 @@ func BenchmarkLoadConfig(b *testing.B) {
 		}
 	}
 }
+
+// TestWorkerRestart 测试反复重载更新同一路流时只保留一个 ffmpeg，删除后主循环退出
+func TestWorkerRestart(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Load()
+	defer runtimeSettings.Store(prev)
+
+	state := &AppState{workers: newWorkerMap(nil)}
+	settings := &Settings{StopTimeout: time.Second}
+	stream := func(n int) *Config {
+		return &Config{Settings: settings, Streams: []StreamConfig{{
+			ID:  "a",
+			Src: "rtmp://127.0.0.1/live/a",
+			Dst: fmt.Sprintf("rtmp://127.0.0.2/live/a%d", n),
+		}}}
+	}
+	for i := 0; i < 5; i++ {
+		if err := applyConfig(state, stream(i)); err != nil {
+			t.Fatalf("reload %d: %v", i, err)
+		}
+		w, _ := state.workers.get("a")
+		waitFor(t, "ffmpeg to start", func() bool { return w.IsRunning() && running() == 1 })
+	}
+	w, _ := state.workers.get("a")
+	if got := w.config().Dst; got != "rtmp://127.0.0.2/live/a4" {
+		t.Errorf("dst = %s", got)
+	}
+	// Starting again while the loop runs must not add a second ffmpeg.
+	w.Start(context.Background())
+	time.Sleep(200 * time.Millisecond)
+	if n := running(); n != 1 {
+		t.Errorf("%d ffmpeg processes after Start, want 1", n)
+	}
+
+	if err := applyConfig(state, &Config{Settings: settings}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker loop still running after removal")
+	}
+	if !errors.Is(w.Err(), errWorkerStopped) {
+		t.Errorf("Err() = %v, want errWorkerStopped", w.Err())
+	}
+	waitFor(t, "ffmpeg to exit", func() bool { return running() == 0 })
+	if w.IsRunning() {
+		t.Error("removed worker still running")
+	}
+}
+
+// TestWorkerContext 测试取消 Start 传入的 ctx 会终止 ffmpeg 并结束主循环，未启动的工作器 Done 已关闭
+func TestWorkerContext(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Swap(&Settings{StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+
+	idle := &StreamWorker{}
+	select {
+	case <-idle.Done():
+	default:
+		t.Error("Done of an unstarted worker is open")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &StreamWorker{cfg: StreamConfig{ID: "a", Src: "rtmp://127.0.0.1/live/a", Dst: "rtmp://127.0.0.2/live/a"}}
+	w.Start(ctx)
+	waitFor(t, "ffmpeg to start", func() bool { return w.IsRunning() && running() == 1 })
+	if w.Err() != nil {
+		t.Errorf("Err() = %v while running", w.Err())
+	}
+	cancel()
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker loop still running after cancel")
+	}
+	if !errors.Is(w.Err(), context.Canceled) {
+		t.Errorf("Err() = %v, want context.Canceled", w.Err())
+	}
+	waitFor(t, "ffmpeg to exit", func() bool { return running() == 0 })
+}
+
+// TestWorkerStopWhileStarting 测试 Start 后立即 Stop 时，落在 ffmpeg 启动过程中的 Stop 也能结束主循环
+func TestWorkerStopWhileStarting(t *testing.T) {
+	fakeFFmpeg(t)
+	prev := runtimeSettings.Swap(&Settings{StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+
+	for i := 0; i < 100; i++ {
+		w := &StreamWorker{cfg: StreamConfig{ID: "a", Src: "rtmp://127.0.0.1/live/a", Dst: "rtmp://127.0.0.2/live/a"}}
+		w.Start(context.Background())
+		// Spread the Stop calls over the time it takes the loop to reach and finish cmd.Start.
+		time.Sleep(time.Duration(i%20) * 250 * time.Microsecond)
+		if err := w.Stop(); err != nil {
+			t.Fatalf("cycle %d: %v", i, err)
+		}
+		select {
+		case <-w.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("cycle %d: worker loop still running after Stop", i)
+		}
+	}
+}
+
+// fakeFFmpeg 在 PATH 最前面放置一个假的 ffmpeg，返回统计正在运行的假进程数的函数。
+func fakeFFmpeg(t *testing.T) func() int {
+	t.Helper()
+	// The fake records its pid while running.
+	dir := t.TempDir()
+	pids := filepath.Join(dir, "pids")
+	if err := os.Mkdir(pids, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The trap is installed before the pid is recorded, so a TERM sent once the pid is visible is always handled.
+	script := "#!/bin/sh\ntrap 'rm -f " + pids + "/$$; exit 0' TERM\necho $$ > " + pids + "/$$\nwhile :; do sleep 0.05; done\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() int {
+		entries, err := os.ReadDir(pids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+}
+
+// waitFor 轮询 ok 直到返回 true，超过 5 秒则测试失败。
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maintenanceRetryDelay 是维护窗口内断开后的重试间隔，比正常重试更温和。
+const maintenanceRetryDelay = 30 * time.Second
+
+// weekdays 是维护窗口 days 字段可用的星期缩写。
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// MaintenanceWindow 表示目标平台公布的维护窗口，可以是每周重复的时段或一次性的时间段。
+type MaintenanceWindow struct {
+	// Hosts 是窗口适用的目标主机名，支持 * 通配符。
+	Hosts []string `yaml:"hosts"`
+	// Days 是重复窗口生效的星期（sun..sat），为空表示每天。
+	Days []string `yaml:"days,omitempty"`
+	// Start 是重复窗口的开始时间，格式 HH:MM。
+	Start string `yaml:"start,omitempty"`
+	// Duration 是重复窗口的持续时间。
+	Duration time.Duration `yaml:"duration,omitempty"`
+	// Timezone 是重复窗口使用的时区，默认 UTC。
+	Timezone string `yaml:"timezone,omitempty"`
+	// From 是一次性窗口的开始时间。
+	From time.Time `yaml:"from,omitempty"`
+	// Until 是一次性窗口的结束时间。
+	Until time.Time `yaml:"until,omitempty"`
+}
+
+// maintenanceWindows 是当前生效的维护窗口，在配置重载时替换。
+var maintenanceWindows atomic.Pointer[[]MaintenanceWindow]
+
+// validate 校验维护窗口配置。
+func (m *MaintenanceWindow) validate() error {
+	if len(m.Hosts) == 0 {
+		return fmt.Errorf("hosts is required")
+	}
+	for _, h := range m.Hosts {
+		if _, err := path.Match(h, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %q", h)
+		}
+	}
+	oneOff := !m.From.IsZero() || !m.Until.IsZero()
+	recurring := m.Start != "" || m.Duration != 0
+	switch {
+	case oneOff && recurring:
+		return fmt.Errorf("use either from/until or start/duration, not both")
+	case oneOff:
+		if m.From.IsZero() || m.Until.IsZero() || !m.Until.After(m.From) {
+			return fmt.Errorf("until must be after from")
+		}
+	case recurring:
+		if _, err := time.Parse("15:04", m.Start); err != nil {
+			return fmt.Errorf("invalid start %q, expected HH:MM", m.Start)
+		}
+		if m.Duration <= 0 || m.Duration > 24*time.Hour {
+			return fmt.Errorf("duration must be between 0 and 24h")
+		}
+		if _, err := time.LoadLocation(m.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+		for _, d := range m.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("invalid day %q", d)
+			}
+		}
+	default:
+		return fmt.Errorf("either from/until or start/duration is required")
+	}
+	return nil
+}
+
+// matchesHost 判断窗口是否适用于指定主机。
+func (m *MaintenanceWindow) matchesHost(host string) bool {
+	for _, pattern := range m.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// activeAt 判断窗口在 now 时刻是否生效。
+func (m *MaintenanceWindow) activeAt(now time.Time) bool {
+	if !m.From.IsZero() {
+		return !now.Before(m.From) && now.Before(m.Until)
+	}
+	loc, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		return false
+	}
+	start, err := time.Parse("15:04", m.Start)
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	// A window that started yesterday may still be running after midnight.
+	for _, offset := range []int{0, -1} {
+		day := local.AddDate(0, 0, offset)
+		begin := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		if !m.onDay(begin.Weekday()) {
+			continue
+		}
+		if !local.Before(begin) && local.Before(begin.Add(m.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// onDay 判断重复窗口是否在指定星期生效。
+func (m *MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(m.Days) == 0 {
+		return true
+	}
+	for _, d := range m.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// inMaintenance 判断目标地址在 now 时刻是否处于已知维护窗口内。
+func inMaintenance(dst string, now time.Time) bool {
+	windows := maintenanceWindows.Load()
+	if windows == nil {
+		return false
+	}
+	u, err := url.Parse(dst)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	for i := range *windows {
+		w := &(*windows)[i]
+		if w.matchesHost(u.Hostname()) && w.activeAt(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMaintenanceWindow 测试重复和一次性维护窗口的匹配
+func TestMaintenanceWindow(t *testing.T) {
+	windows := []MaintenanceWindow{
+		{Hosts: []string{"*.ingest.example.com"}, Days: []string{"tue"}, Start: "23:00", Duration: 2 * time.Hour},
+		{Hosts: []string{"live.example.com"},
+			From:  time.Date(2026, 10, 15, 1, 0, 0, 0, time.UTC),
+			Until: time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)},
+	}
+	for i := range windows {
+		if err := windows[i].validate(); err != nil {
+			t.Fatalf("window %d: %v", i, err)
+		}
+	}
+	maintenanceWindows.Store(&windows)
+	defer maintenanceWindows.Store(nil)
+
+	// 2026-10-13 is a Tuesday; the window runs past midnight into Wednesday.
+	cases := []struct {
+		dst  string
+		at   time.Time
+		want bool
+	}{
+		{"rtmp://eu.ingest.example.com/live/key", time.Date(2026, 10, 13, 23, 30, 0, 0, time.UTC), true},
+		{"rtmp://eu.ingest.example.com/live/key", time.Date(2026, 10, 14, 0, 30, 0, 0, time.UTC), true},
+		{"rtmp://eu.ingest.example.com/live/key", time.Date(2026, 10, 14, 23, 30, 0, 0, time.UTC), false},
+		{"rtmp://live.example.com/app/key", time.Date(2026, 10, 15, 1, 30, 0, 0, time.UTC), true},
+		{"rtmp://other.example.com/app/key", time.Date(2026, 10, 15, 1, 30, 0, 0, time.UTC), false},
+	}
+	for _, c := range cases {
+		if got := inMaintenance(c.dst, c.at); got != c.want {
+			t.Errorf("inMaintenance(%q, %s) = %v, want %v", c.dst, c.at, got, c.want)
+		}
+	}
+
+	if err := (&MaintenanceWindow{Hosts: []string{"x"}, Start: "25:00", Duration: time.Hour}).validate(); err == nil {
+		t.Error("expected invalid start to be rejected")
+	}
+}
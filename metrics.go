@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MetricsConfig 表示 Prometheus 指标配置，包括抓取服务和主动推送。
+type MetricsConfig struct {
+	// Listen 是指标 HTTP 服务的监听地址，如 ":9310"，为空时不启动。修改后需重启生效。
+	Listen string `yaml:"listen,omitempty"`
+	// LogBuffer 是 /logs 接口保留的最近日志大小，如 512KB，0 表示不启用。修改后需重启生效。
+	LogBuffer ByteSize `yaml:"log_buffer,omitempty"`
+	// LogBufferKB 是以 KB 为单位的 LogBuffer，已弃用。
+	LogBufferKB int `yaml:"log_buffer_kb,omitempty"`
+	// MaxStreams 是按 stream_id 单独导出的最大流数，超过后按 Overflow 合并，0 表示不限制。
+	MaxStreams int `yaml:"max_streams,omitempty"`
+	// Overflow 是超过 MaxStreams 后的合并方式：hash（默认，按流 ID 哈希分桶）或 aggregate（合并为一条）。
+	Overflow string `yaml:"overflow,omitempty"`
+	// OverflowBuckets 是 hash 方式的桶数，默认 16。
+	OverflowBuckets int `yaml:"overflow_buckets,omitempty"`
+	// DropLabels 是不导出的可选标签，目前支持 host（stream_runner_stream_endpoint_info）。
+	DropLabels []string `yaml:"drop_labels,omitempty"`
+	// ExcludeMetrics 是不导出的按流指标名。
+	ExcludeMetrics []string `yaml:"exclude_metrics,omitempty"`
+	// Push 是主动推送指标的目标，与 Listen 可以同时使用。
+	Push []MetricsPush `yaml:"push,omitempty"`
+	// Limits 是 HTTP 服务的限流和请求大小限制（可选）。修改后需重启生效。
+	Limits *HTTPLimits `yaml:"limits,omitempty"`
+	// BasePath 是反向代理转发时使用的路径前缀，如 /stream-runner。修改后需重启生效。
+	BasePath string `yaml:"base_path,omitempty"`
+	// TrustedProxies 是可信反向代理的 IP 或 CIDR，只信任它们发送的 X-Forwarded-For。修改后需重启生效。
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+	// CORS 是跨域策略（可选），未配置时不返回跨域响应头。修改后需重启生效。
+	CORS *CORSConfig `yaml:"cors,omitempty"`
+	// ReadyPercent 是 /readyz 返回 200 所需的运行中流的百分比，默认 100。
+	ReadyPercent float64 `yaml:"ready_percent,omitempty"`
+}
+
+const (
+	// OverflowHash 表示按流 ID 哈希到固定数量的桶。
+	OverflowHash = "hash"
+	// OverflowAggregate 表示去掉 stream_id 标签合并为一条序列。
+	OverflowAggregate = "aggregate"
+	// DefaultOverflowBuckets 是 hash 方式的默认桶数。
+	DefaultOverflowBuckets = 16
+)
+
+// validate 校验指标配置。
+func (c *MetricsConfig) validate() error {
+	if c.LogBuffer < 0 || c.LogBufferKB < 0 {
+		return fmt.Errorf("log_buffer must not be negative")
+	}
+	if c.LogBufferKB > 0 && c.LogBuffer != ByteSize(c.LogBufferKB)<<10 {
+		return fmt.Errorf("log_buffer and the deprecated log_buffer_kb are mutually exclusive")
+	}
+	if c.ReadyPercent < 0 || c.ReadyPercent > 100 {
+		return fmt.Errorf("ready_percent must be between 0 and 100")
+	}
+	if c.MaxStreams < 0 || c.OverflowBuckets < 0 {
+		return fmt.Errorf("max_streams and overflow_buckets must not be negative")
+	}
+	if c.Overflow != "" && c.Overflow != OverflowHash && c.Overflow != OverflowAggregate {
+		return fmt.Errorf("unsupported overflow %q", c.Overflow)
+	}
+	for _, l := range c.DropLabels {
+		if l != "host" {
+			return fmt.Errorf("label %q cannot be dropped", l)
+		}
+	}
+	for i := range c.Push {
+		if err := c.Push[i].validate(); err != nil {
+			return fmt.Errorf("push[%d]: %w", i, err)
+		}
+	}
+	if c.Limits != nil {
+		if err := c.Limits.validate(); err != nil {
+			return fmt.Errorf("limits: %w", err)
+		}
+	}
+	if err := validateProxyOptions(c.BasePath, c.TrustedProxies, c.CORS); err != nil {
+		return err
+	}
+	for _, name := range c.ExcludeMetrics {
+		found := false
+		for _, m := range streamMetrics {
+			found = found || m.name == name
+		}
+		if !found {
+			return fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	return nil
+}
+
+// workerSnapshot 是采集指标时单个工作器的状态快照。
+type workerSnapshot struct {
+	id      string
+	running bool
+	stats   streamStats
+	// endpoint 是选定的推送地址，未选定时为空。
+	endpoint string
+	// events 是流累计的事件数。
+	events int64
+	// health 是流的健康分。
+	health float64
+	// degraded 表示流有指标偏离自身基线。
+	degraded bool
+	// outputs 是各路输出的状态，只有配置了附加输出的流才有。
+	outputs []outputStatus
+}
+
+// streamMetric 描述一个按流维度导出的指标。
+// 指标导出和 Grafana 面板生成都基于同一份描述，保证名称一致。
+type streamMetric struct {
+	// name 是指标名。
+	name string
+	// help 是指标说明。
+	help string
+	// kind 是指标类型：counter 或 gauge。
+	kind string
+	// unit 是 Grafana 面板使用的单位。
+	unit string
+	// value 从快照中取出指标值。
+	value func(s workerSnapshot) float64
+	// merge 在多路流合并为一条序列时合并取值，为空时求和。
+	merge func(a, b float64) float64
+}
+
+// mergeMaxAbs 取绝对值较大的一个，用于可正可负的偏差类指标。
+func mergeMaxAbs(a, b float64) float64 {
+	if math.Abs(b) > math.Abs(a) {
+		return b
+	}
+	return a
+}
+
+// streamMetrics 是所有按流维度导出的指标。
+var streamMetrics = []streamMetric{
+	{
+		name: "stream_runner_stream_up",
+		help: "Whether the ffmpeg process of the stream is running (1) or not (0).",
+		kind: "gauge",
+		unit: "none",
+		value: func(s workerSnapshot) float64 {
+			if s.running {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name:  "stream_runner_stream_restarts_total",
+		help:  "Number of ffmpeg restarts after the first start.",
+		kind:  "counter",
+		unit:  "short",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Restarts) },
+	},
+	{
+		name:  "stream_runner_stream_failures_total",
+		help:  "Number of abnormal ffmpeg exits.",
+		kind:  "counter",
+		unit:  "short",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Failures) },
+	},
+	{
+		name:  "stream_runner_stream_hangs_total",
+		help:  "Number of ffmpeg runs killed for producing no output within the start timeout.",
+		kind:  "counter",
+		unit:  "short",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Hangs) },
+	},
+	{
+		name:  "stream_runner_stream_health_score",
+		help:  "Composite health score of the stream from 0 (worst) to 100 (best).",
+		kind:  "gauge",
+		unit:  "none",
+		value: func(s workerSnapshot) float64 { return s.health },
+		merge: math.Min,
+	},
+	{
+		name: "stream_runner_stream_degraded",
+		help: "Whether the bitrate or fps of the stream deviates from its own baseline (1) or not (0).",
+		kind: "gauge",
+		unit: "none",
+		value: func(s workerSnapshot) float64 {
+			if s.degraded {
+				return 1
+			}
+			return 0
+		},
+		merge: math.Max,
+	},
+	{
+		name:  "stream_runner_stream_events_total",
+		help:  "Stream events such as av_drift or resource_exceeded.",
+		kind:  "counter",
+		unit:  "short",
+		value: func(s workerSnapshot) float64 { return float64(s.events) },
+	},
+	{
+		name:  "stream_runner_stream_uptime_seconds_total",
+		help:  "Accumulated ffmpeg running time in seconds.",
+		kind:  "counter",
+		unit:  "s",
+		value: func(s workerSnapshot) float64 { return s.stats.Uptime.Seconds() },
+	},
+	{
+		name:  "stream_runner_stream_output_bytes_total",
+		help:  "Accumulated bytes written to the destination.",
+		kind:  "counter",
+		unit:  "bytes",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.BytesOut) },
+	},
+	{
+		name:  "stream_runner_stream_bitrate_kbps",
+		help:  "Current output bitrate reported by ffmpeg in kbit/s.",
+		kind:  "gauge",
+		unit:  "Kbits",
+		value: func(s workerSnapshot) float64 { return s.stats.Progress.Bitrate },
+	},
+	{
+		name:  "stream_runner_stream_fps",
+		help:  "Current output frame rate reported by ffmpeg.",
+		kind:  "gauge",
+		unit:  "none",
+		value: func(s workerSnapshot) float64 { return s.stats.Progress.FPS },
+		merge: math.Max,
+	},
+	{
+		name:  "stream_runner_stream_av_drift_seconds",
+		help:  "Last measured audio/video PTS drift of the source in seconds (positive: video ahead).",
+		kind:  "gauge",
+		unit:  "s",
+		value: func(s workerSnapshot) float64 { return s.stats.AVDrift.Seconds() },
+		merge: mergeMaxAbs,
+	},
+	{
+		name:  "stream_runner_stream_cpu_percent",
+		help:  "CPU usage of the ffmpeg process over the last sample interval (100 = one core).",
+		kind:  "gauge",
+		unit:  "percent",
+		value: func(s workerSnapshot) float64 { return s.stats.Proc.CPUPercent },
+	},
+	{
+		name:  "stream_runner_stream_memory_rss_bytes",
+		help:  "Resident memory of the ffmpeg process in bytes.",
+		kind:  "gauge",
+		unit:  "bytes",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Proc.RSS) },
+	},
+	{
+		name:  "stream_runner_stream_io_read_bytes_total",
+		help:  "Bytes read by the current ffmpeg process, including network input.",
+		kind:  "counter",
+		unit:  "bytes",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Proc.ReadBytes) },
+	},
+	{
+		name:  "stream_runner_stream_io_write_bytes_total",
+		help:  "Bytes written by the current ffmpeg process, including network output.",
+		kind:  "counter",
+		unit:  "bytes",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Proc.WriteBytes) },
+	},
+	{
+		name:  "stream_runner_stream_open_fds",
+		help:  "Open file descriptors of the ffmpeg process.",
+		kind:  "gauge",
+		unit:  "short",
+		value: func(s workerSnapshot) float64 { return float64(s.stats.Proc.FDs) },
+	},
+}
+
+// snapshotWorkers 返回按流 ID 排序的所有工作器快照。
+func snapshotWorkers(state *AppState) []workerSnapshot {
+	now := time.Now()
+	workers := state.workers.snapshot()
+	snaps := make([]workerSnapshot, 0, len(workers))
+	for id, w := range workers {
+		snaps = append(snaps, workerSnapshot{id: id, running: w.IsRunning(), stats: w.Stats(now), endpoint: w.Endpoint(), events: eventCount(id), health: w.healthScore(now), degraded: len(w.degradedMetrics()) > 0, outputs: w.outputStatuses(w.config(), w.Endpoint())})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].id < snaps[j].id })
+	return snaps
+}
+
+// escapeLabelValue 按 Prometheus 文本格式转义标签值。
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// metricSeries 是导出时的一条序列，可能由多路流合并而来。
+type metricSeries struct {
+	// id 是 stream_id 标签值（流 ID 或桶名），合并为一条时为空。
+	id    string
+	snaps []workerSnapshot
+}
+
+// labels 返回 Prometheus 文本格式的标签部分，如 {stream_id="a"}。
+func (s metricSeries) labels() string {
+	if s.id == "" {
+		return ""
+	}
+	return fmt.Sprintf(`{stream_id="%s"}`, escapeLabelValue(s.id))
+}
+
+// groupSeries 按基数限制把快照分组为序列。未超过 max_streams 时每路流一条序列。
+func groupSeries(snaps []workerSnapshot, cfg *MetricsConfig) []metricSeries {
+	if cfg == nil || cfg.MaxStreams == 0 || len(snaps) <= cfg.MaxStreams {
+		series := make([]metricSeries, len(snaps))
+		for i, s := range snaps {
+			series[i] = metricSeries{id: s.id, snaps: snaps[i : i+1]}
+		}
+		return series
+	}
+	if cfg.Overflow == OverflowAggregate {
+		return []metricSeries{{snaps: snaps}}
+	}
+	buckets := cfg.OverflowBuckets
+	if buckets == 0 {
+		buckets = DefaultOverflowBuckets
+	}
+	grouped := make([][]workerSnapshot, buckets)
+	for _, s := range snaps {
+		h := fnv.New32a()
+		h.Write([]byte(s.id))
+		b := h.Sum32() % uint32(buckets)
+		grouped[b] = append(grouped[b], s)
+	}
+	var series []metricSeries
+	for b, g := range grouped {
+		if len(g) > 0 {
+			series = append(series, metricSeries{id: fmt.Sprintf("bucket-%02d", b), snaps: g})
+		}
+	}
+	return series
+}
+
+// seriesValue 返回序列中所有流合并后的指标值。
+func seriesValue(m streamMetric, series metricSeries) float64 {
+	v := m.value(series.snaps[0])
+	for _, s := range series.snaps[1:] {
+		if m.merge != nil {
+			v = m.merge(v, m.value(s))
+		} else {
+			v += m.value(s)
+		}
+	}
+	return v
+}
+
+// exportedMetrics 返回未被 exclude_metrics 排除的按流指标。
+func exportedMetrics(cfg *MetricsConfig) []streamMetric {
+	if cfg == nil || len(cfg.ExcludeMetrics) == 0 {
+		return streamMetrics
+	}
+	var out []streamMetric
+	for _, m := range streamMetrics {
+		if !containsString(cfg.ExcludeMetrics, m.name) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// writeMetrics 以 Prometheus 文本格式输出所有指标，cfg 控制标签基数（可为 nil）。
+func writeMetrics(w io.Writer, snaps []workerSnapshot, cfg *MetricsConfig) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP stream_runner_streams Number of configured streams.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_streams gauge")
+	fmt.Fprintf(bw, "stream_runner_streams %d\n", len(snaps))
+	build := currentBuildInfo()
+	fmt.Fprintln(bw, "# HELP stream_runner_build_info Version and build information of the running daemon.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_build_info gauge")
+	fmt.Fprintf(bw, "stream_runner_build_info{version=\"%s\",commit=\"%s\",build_date=\"%s\",go_version=\"%s\"} 1\n",
+		escapeLabelValue(build.Version), escapeLabelValue(build.Commit), escapeLabelValue(build.BuildDate), escapeLabelValue(build.GoVersion))
+	writeFleetMetrics(bw)
+	writeSyntheticMetrics(bw)
+	writePlatformMetrics(bw)
+	writeScheduleMetrics(bw)
+	writeSupervisorMetrics(bw)
+	writeLoopMetrics(bw)
+	writeOutputMetrics(bw, snaps)
+	writeDrainMetrics(bw)
+	series := groupSeries(snaps, cfg)
+	for _, m := range exportedMetrics(cfg) {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+		for _, s := range series {
+			fmt.Fprintf(bw, "%s%s %g\n", m.name, s.labels(), seriesValue(m, s))
+		}
+	}
+	// The info metric is only meaningful per stream; skip it once streams are merged.
+	if (cfg != nil && containsString(cfg.DropLabels, "host")) || len(series) != len(snaps) {
+		return bw.Flush()
+	}
+	// Only the host is exported; the path usually carries the stream key.
+	fmt.Fprintln(bw, "# HELP stream_runner_stream_endpoint_info Destination ingest host selected for the stream.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_stream_endpoint_info gauge")
+	for _, s := range snaps {
+		if host := endpointHost(s.endpoint); host != "" {
+			fmt.Fprintf(bw, "stream_runner_stream_endpoint_info{stream_id=\"%s\",host=\"%s\"} 1\n",
+				escapeLabelValue(s.id), escapeLabelValue(host))
+		}
+	}
+	return bw.Flush()
+}
+
+// metricsConfig 返回当前生效的指标配置。
+func metricsConfig(state *AppState) *MetricsConfig {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.config == nil {
+		return nil
+	}
+	return state.config.Metrics
+}
+
+// newMetricsMux 创建指标 HTTP 服务的路由，提供 /metrics、/version、/dashboard.json、/status、/status/{id}、/inventory、/fleet、
+// /healthz、/readyz 和 /openapi.json。指标服务不做认证，含有 ffmpeg 原始输出的 /logs 和 /events 只在管理接口上提供。
+// basePath 是反向代理的路径前缀，只用于 OpenAPI 文档中的服务地址。
+func newMetricsMux(state *AppState, basePath string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writeMetrics(w, snapshotWorkers(state), metricsConfig(state)); err != nil {
+			slog.Warn("failed to write metrics", "error", err)
+		}
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(currentBuildInfo()); err != nil {
+			slog.Warn("failed to write version", "error", err)
+		}
+	})
+	mux.HandleFunc("/dashboard.json", func(w http.ResponseWriter, _ *http.Request) {
+		snaps := snapshotWorkers(state)
+		ids := make([]string, 0, len(snaps))
+		for _, s := range snaps {
+			ids = append(ids, s.id)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeGrafanaDashboard(w, ids); err != nil {
+			slog.Warn("failed to write grafana dashboard", "error", err)
+		}
+	})
+	mux.HandleFunc("/status", handleStatus(state))
+	mux.HandleFunc("/status/", handleStreamStatus(state))
+	mux.HandleFunc("/inventory", handleInventory(state))
+	mux.HandleFunc("/fleet", handleFleet(state))
+	mux.HandleFunc("/schedule", handleSchedule)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz(state))
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		apiBase := ""
+		if c := apiConfig(state); c != nil {
+			apiBase = c.BasePath
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeOpenAPISpec(w, basePath, apiBase); err != nil {
+			slog.Warn("failed to write openapi spec", "error", err)
+		}
+	})
+	return mux
+}
+
+// serveMetrics 在已绑定的监听器上启动指标 HTTP 服务，访问限制和代理设置在启动时读取。
+func serveMetrics(state *AppState, ln net.Listener) {
+	m := metricsConfig(state)
+	if m != nil && m.Limits != nil {
+		ln = newLimitListener(ln, m.Limits.MaxConnections)
+	}
+	server := &http.Server{
+		Handler:           withPanicReport("metrics handler", newHTTPHandler(state, m)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("metrics server listening", "addr", ln.Addr().String())
+	if err := server.Serve(ln); err != nil {
+		slog.Error("metrics server stopped", "error", err)
+	}
+}
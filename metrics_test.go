@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteMetrics 测试 Prometheus 文本格式输出
+func TestWriteMetrics(t *testing.T) {
+	snaps := []workerSnapshot{
+		{id: "stream-1", running: true, stats: streamStats{Restarts: 2, Uptime: 90 * time.Second}},
+		{id: `odd"id`, running: false},
+	}
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, snaps, nil); err != nil {
+		t.Fatalf("writeMetrics failed: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"stream_runner_streams 2\n",
+		`stream_runner_stream_up{stream_id="stream-1"} 1`,
+		`stream_runner_stream_restarts_total{stream_id="stream-1"} 2`,
+		`stream_runner_stream_uptime_seconds_total{stream_id="stream-1"} 90`,
+		`stream_runner_stream_up{stream_id="odd\"id"} 0`,
+		"# TYPE stream_runner_stream_failures_total counter",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected metrics output to contain %q", expected)
+		}
+	}
+}
+
+// TestWriteGrafanaDashboard 测试仪表盘包含所有指标
+func TestWriteGrafanaDashboard(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGrafanaDashboard(&buf, []string{"stream-1"}); err != nil {
+		t.Fatalf("writeGrafanaDashboard failed: %v", err)
+	}
+	output := buf.String()
+	for _, m := range streamMetrics {
+		if !strings.Contains(output, m.name) {
+			t.Errorf("expected dashboard to reference %s", m.name)
+		}
+	}
+	if !strings.Contains(output, "rate(stream_runner_stream_restarts_total") {
+		t.Error("expected counters to be graphed as rate()")
+	}
+	if !strings.Contains(output, `"state-timeline"`) || !strings.Contains(output, "increase(stream_runner_stream_events_total") {
+		t.Error("expected the state timeline with event annotations")
+	}
+}
+
+// TestWriteMetricsCardinality 测试超过 max_streams 后按桶或整体合并序列
+func TestWriteMetricsCardinality(t *testing.T) {
+	var snaps []workerSnapshot
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		snaps = append(snaps, workerSnapshot{id: id, running: true, endpoint: "rtmp://ingest.example.com/live/key",
+			stats: streamStats{AVDrift: -300 * time.Millisecond}})
+	}
+
+	var buf bytes.Buffer
+	cfg := &MetricsConfig{MaxStreams: 3, OverflowBuckets: 2, ExcludeMetrics: []string{"stream_runner_stream_fps"}}
+	if err := writeMetrics(&buf, snaps, cfg); err != nil {
+		t.Fatalf("writeMetrics failed: %v", err)
+	}
+	output := buf.String()
+	if strings.Contains(output, `stream_id="a"`) || strings.Contains(output, "endpoint_info{") || strings.Contains(output, "stream_runner_stream_fps") {
+		t.Errorf("expected per-stream series to be merged:\n%s", output)
+	}
+	if n := strings.Count(output, "stream_runner_stream_up{"); n == 0 || n > 2 {
+		t.Errorf("expected at most 2 bucket series, got %d", n)
+	}
+
+	buf.Reset()
+	cfg = &MetricsConfig{MaxStreams: 3, Overflow: OverflowAggregate}
+	if err := writeMetrics(&buf, snaps, cfg); err != nil {
+		t.Fatalf("writeMetrics failed: %v", err)
+	}
+	for _, expected := range []string{"stream_runner_stream_up 5\n", "stream_runner_stream_av_drift_seconds -0.3\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected aggregated output to contain %q", expected)
+		}
+	}
+	if err := (&MetricsConfig{DropLabels: []string{"stream_id"}}).validate(); err == nil {
+		t.Error("expected error for dropping stream_id")
+	}
+}
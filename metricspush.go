@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PushGraphite 表示 Graphite plaintext 协议（TCP）。
+	PushGraphite = "graphite"
+	// PushInfluxDB 表示 InfluxDB line protocol（HTTP 写入接口）。
+	PushInfluxDB = "influxdb"
+	// PushGateway 表示 Prometheus Pushgateway。
+	PushGateway = "pushgateway"
+
+	// DefaultPushInterval 是默认推送间隔。
+	DefaultPushInterval = time.Minute
+	// pushTimeout 是单次推送的超时时间。
+	pushTimeout = 10 * time.Second
+	// defaultPushPrefix 是 Graphite 路径前缀、InfluxDB measurement 和 Pushgateway job 的默认值。
+	defaultPushPrefix = "stream_runner"
+)
+
+// MetricsPush 表示一个主动推送指标的目标，用于无法被 Prometheus 入站抓取的站点。
+type MetricsPush struct {
+	// Type 是推送协议：graphite、influxdb 或 pushgateway。
+	Type string `yaml:"type"`
+	// Address 是目标地址：graphite 为 host:port，influxdb 为完整写入 URL，pushgateway 为服务 URL。
+	Address string `yaml:"address"`
+	// Interval 是推送间隔，默认 1m。
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Prefix 是 Graphite 路径前缀、InfluxDB measurement 或 Pushgateway job 名，默认 stream_runner。
+	Prefix string `yaml:"prefix,omitempty"`
+	// Token 是 InfluxDB 的 API token（可选）。
+	Token string `yaml:"token,omitempty"`
+}
+
+// validate 校验推送目标配置。
+func (p *MetricsPush) validate() error {
+	switch p.Type {
+	case PushGraphite:
+		if _, _, err := net.SplitHostPort(p.Address); err != nil {
+			return fmt.Errorf("graphite address must be host:port: %w", err)
+		}
+	case PushInfluxDB, PushGateway:
+		u, err := url.Parse(p.Address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s address must be an http(s) URL", p.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported push type %q", p.Type)
+	}
+	if p.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的推送配置。
+func (p MetricsPush) withDefaults() MetricsPush {
+	if p.Interval == 0 {
+		p.Interval = DefaultPushInterval
+	}
+	if p.Prefix == "" {
+		p.Prefix = defaultPushPrefix
+	}
+	return p
+}
+
+// key 返回推送目标的唯一标识，用于跨配置重载记录上次推送时间。
+func (p MetricsPush) key() string {
+	return p.Type + " " + p.Address
+}
+
+// metricShortName 返回去掉 stream_runner_stream_ 前缀的指标名，用于 Graphite 路径和 InfluxDB 字段。
+func metricShortName(name string) string {
+	return strings.TrimPrefix(name, "stream_runner_stream_")
+}
+
+// graphiteSafe 把标签值转换为可用作 Graphite 路径节点的形式。
+func graphiteSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == ' ' || r == '/' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// encodeGraphite 按 Graphite plaintext 协议编码指标，每行 path value timestamp。
+func encodeGraphite(snaps []workerSnapshot, cfg *MetricsConfig, prefix string, now time.Time) []byte {
+	var buf bytes.Buffer
+	ts := now.Unix()
+	fmt.Fprintf(&buf, "%s.streams %d %d\n", prefix, len(snaps), ts)
+	for _, s := range groupSeries(snaps, cfg) {
+		node := "all"
+		if s.id != "" {
+			node = graphiteSafe(s.id)
+		}
+		for _, m := range exportedMetrics(cfg) {
+			fmt.Fprintf(&buf, "%s.stream.%s.%s %g %d\n", prefix, node, metricShortName(m.name), seriesValue(m, s), ts)
+		}
+	}
+	return buf.Bytes()
+}
+
+// influxEscape 按 line protocol 规则转义 tag 值。
+func influxEscape(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+// encodeInflux 按 InfluxDB line protocol 编码指标，每条序列一行，指标作为字段。
+func encodeInflux(snaps []workerSnapshot, cfg *MetricsConfig, measurement string, now time.Time) []byte {
+	var buf bytes.Buffer
+	ts := now.UnixNano()
+	fmt.Fprintf(&buf, "%s streams=%di %d\n", measurement, len(snaps), ts)
+	for _, s := range groupSeries(snaps, cfg) {
+		buf.WriteString(measurement)
+		if s.id != "" {
+			buf.WriteString(",stream_id=" + influxEscape(s.id))
+		}
+		for i, m := range exportedMetrics(cfg) {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			fmt.Fprintf(&buf, "%s%s=%g", sep, metricShortName(m.name), seriesValue(m, s))
+		}
+		fmt.Fprintf(&buf, " %d\n", ts)
+	}
+	return buf.Bytes()
+}
+
+// pushMetrics 向单个目标推送一次指标。
+func pushMetrics(p MetricsPush, snaps []workerSnapshot, cfg *MetricsConfig, now time.Time) error {
+	switch p.Type {
+	case PushGraphite:
+		conn, err := net.DialTimeout("tcp", p.Address, pushTimeout)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				slog.Warn("failed to close graphite connection", "addr", p.Address, "error", err)
+			}
+		}()
+		if err := conn.SetDeadline(now.Add(pushTimeout)); err != nil {
+			return err
+		}
+		_, err = conn.Write(encodeGraphite(snaps, cfg, p.Prefix, now))
+		return err
+	case PushInfluxDB:
+		req, err := http.NewRequest(http.MethodPost, p.Address, bytes.NewReader(encodeInflux(snaps, cfg, p.Prefix, now)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if p.Token != "" {
+			req.Header.Set("Authorization", "Token "+p.Token)
+		}
+		return doPushRequest(req)
+	case PushGateway:
+		var body bytes.Buffer
+		if err := writeMetrics(&body, snaps, cfg); err != nil {
+			return err
+		}
+		instance, err := os.Hostname()
+		if err != nil {
+			instance = "unknown"
+		}
+		// PUT replaces the whole group, so streams removed from the config disappear too.
+		target := strings.TrimSuffix(p.Address, "/") + "/metrics/job/" + url.PathEscape(p.Prefix) + "/instance/" + url.PathEscape(instance)
+		req, err := http.NewRequest(http.MethodPut, target, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		return doPushRequest(req)
+	}
+	return fmt.Errorf("unsupported push type %q", p.Type)
+}
+
+// doPushRequest 发送推送请求，非 2xx 响应视为失败。
+func doPushRequest(req *http.Request) error {
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("failed to close push response", "url", req.URL.Redacted(), "error", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// metricsPusher 按各目标的间隔定期推送指标，目标列表随配置重载更新。
+type metricsPusher struct {
+	state *AppState
+	mu    sync.Mutex
+	// lastPush 是每个目标上次推送的时间。
+	lastPush map[string]time.Time
+	// inFlight 记录正在推送的目标，避免慢目标堆积请求。
+	inFlight map[string]bool
+}
+
+// newMetricsPusher 创建指标推送器。
+func newMetricsPusher(state *AppState) *metricsPusher {
+	return &metricsPusher{state: state, lastPush: make(map[string]time.Time), inFlight: make(map[string]bool)}
+}
+
+// run 每秒检查一次推送目标，对到期的目标发起推送。
+func (m *metricsPusher) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cfg := metricsConfig(m.state)
+		if cfg == nil || len(cfg.Push) == 0 {
+			continue
+		}
+		var snaps []workerSnapshot
+		for _, p := range cfg.Push {
+			p = p.withDefaults()
+			m.mu.Lock()
+			due := !m.inFlight[p.key()] && now.Sub(m.lastPush[p.key()]) >= p.Interval
+			if due {
+				m.inFlight[p.key()] = true
+				m.lastPush[p.key()] = now
+			}
+			m.mu.Unlock()
+			if !due {
+				continue
+			}
+			if snaps == nil {
+				snaps = snapshotWorkers(m.state)
+			}
+			go func(p MetricsPush, snaps []workerSnapshot, now time.Time) {
+				if err := pushMetrics(p, snaps, cfg, now); err != nil {
+					slog.Warn("metrics push failed", "type", p.Type, "error", err)
+				}
+				m.mu.Lock()
+				delete(m.inFlight, p.key())
+				m.mu.Unlock()
+			}(p, snaps, now)
+		}
+	}
+}
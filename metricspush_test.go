@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEncodePushFormats 测试 Graphite 和 InfluxDB 编码
+func TestEncodePushFormats(t *testing.T) {
+	snaps := []workerSnapshot{{id: "cam.1", running: true, stats: streamStats{Restarts: 3}}}
+	now := time.Unix(1700000000, 0)
+	cfg := &MetricsConfig{ExcludeMetrics: []string{"stream_runner_stream_fps"}}
+
+	graphite := string(encodeGraphite(snaps, cfg, "sr", now))
+	for _, want := range []string{"sr.streams 1 1700000000\n", "sr.stream.cam_1.up 1 1700000000\n", "sr.stream.cam_1.restarts_total 3 1700000000\n"} {
+		if !strings.Contains(graphite, want) {
+			t.Errorf("graphite output missing %q:\n%s", want, graphite)
+		}
+	}
+	if strings.Contains(graphite, ".fps ") {
+		t.Error("excluded metric must not be pushed")
+	}
+
+	influx := string(encodeInflux(snaps, cfg, "sr", now))
+	if !strings.Contains(influx, "sr,stream_id=cam.1 up=1,restarts_total=3,") || !strings.HasSuffix(influx, " 1700000000000000000\n") {
+		t.Errorf("influx output = %s", influx)
+	}
+}
+
+// TestPushGateway 测试向 Pushgateway 推送 Prometheus 文本格式
+func TestPushGateway(t *testing.T) {
+	var gotMethod, gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p := MetricsPush{Type: PushGateway, Address: srv.URL + "/"}.withDefaults()
+	if err := p.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := pushMetrics(p, []workerSnapshot{{id: "a", running: true}}, nil, time.Now()); err != nil {
+		t.Fatalf("pushMetrics: %v", err)
+	}
+	if gotMethod != http.MethodPut || !strings.HasPrefix(gotPath, "/metrics/job/stream_runner/instance/") {
+		t.Errorf("request = %s %s", gotMethod, gotPath)
+	}
+	if !strings.Contains(gotBody, `stream_runner_stream_up{stream_id="a"} 1`) {
+		t.Errorf("body = %s", gotBody)
+	}
+}
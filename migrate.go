@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion 是当前程序使用的配置结构版本。
+// 修改配置结构且旧写法需要改写时递增该值，并在 configMigrations 中追加迁移。
+const CurrentConfigVersion = 1
+
+// configMigration 把配置从 from 版本升级到 from+1 版本。
+type configMigration struct {
+	// from 是迁移前的版本。
+	from int
+	// describe 是迁移内容的简短说明。
+	describe string
+	// apply 原地修改 YAML 文档的根映射节点。
+	apply func(root *yaml.Node) error
+}
+
+// configMigrations 是按版本排序的所有迁移。
+var configMigrations = []configMigration{
+	{
+		// Version 0 is every config written before versioning; its layout is unchanged.
+		from:     0,
+		describe: "add schema version",
+		apply:    func(*yaml.Node) error { return nil },
+	},
+}
+
+// mappingValue 返回映射节点中 key 对应的值节点，不存在时返回 nil。
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingScalar 设置映射节点中 key 的标量值，不存在时插入到最前面。
+func setMappingScalar(m *yaml.Node, key, value, tag string) {
+	if v := mappingValue(m, key); v != nil {
+		v.Kind, v.Tag, v.Value = yaml.ScalarNode, tag, value
+		return
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	m.Content = append([]*yaml.Node{k, v}, m.Content...)
+}
+
+// migrateConfig 将配置升级到当前版本，返回新内容和已执行的迁移说明。
+// 已是最新版本时原样返回且不执行任何迁移。
+func migrateConfig(data []byte) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("config root must be a mapping")
+	}
+	root := doc.Content[0]
+
+	version := 0
+	if v := mappingValue(root, "version"); v != nil {
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid version %q", v.Value)
+		}
+		version = n
+	}
+	if version > CurrentConfigVersion {
+		return nil, nil, fmt.Errorf("config version %d is newer than supported version %d", version, CurrentConfigVersion)
+	}
+
+	var applied []string
+	for _, m := range configMigrations {
+		if m.from < version {
+			continue
+		}
+		if err := m.apply(root); err != nil {
+			return nil, nil, fmt.Errorf("migration %d->%d: %w", m.from, m.from+1, err)
+		}
+		version = m.from + 1
+		setMappingScalar(root, "version", strconv.Itoa(version), "!!int")
+		applied = append(applied, fmt.Sprintf("%d->%d: %s", m.from, version, m.describe))
+	}
+	if len(applied) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, err
+	}
+	// Make sure the result still decodes into the current schema.
+	var cfg Config
+	if err := yaml.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("migrated config does not parse: %w", err)
+	}
+	return buf.Bytes(), applied, nil
+}
+
+// unifiedDiff 返回两段文本按行比较的 unified 格式差异，每处改动带 3 行上下文。
+func unifiedDiff(oldName, newName, a, b string) string {
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+	if x[len(x)-1] == "" {
+		x = x[:len(x)-1]
+	}
+	if y[len(y)-1] == "" {
+		y = y[:len(y)-1]
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]; configs are small enough for O(n*m).
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind byte // ' ', '-' or '+'
+		line string
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', x[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', y[j]})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			oldLine++
+			newLine++
+			k++
+			continue
+		}
+		// Extend the hunk until more than 2*context unchanged lines follow a change.
+		start := max(0, k-context)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(run, end+context)
+				break
+			}
+			end = run
+		}
+		hunkOld, hunkNew := oldLine-(k-start), newLine-(k-start)
+		var oldCount, newCount int
+		var body strings.Builder
+		for _, o := range ops[start:end] {
+			line := o.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			body.WriteByte(o.kind)
+			body.WriteString(line)
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunkOld, oldCount, hunkNew, newCount)
+		out.WriteString(body.String())
+		for _, o := range ops[k:end] {
+			if o.kind != '+' {
+				oldLine++
+			}
+			if o.kind != '-' {
+				newLine++
+			}
+		}
+		k = end
+	}
+	return out.String()
+}
+
+// runMigrateConfig 实现 migrate-config 子命令：把配置升级到当前版本并输出差异。
+func runMigrateConfig(args []string) int {
+	fs := flag.NewFlagSet("migrate-config", flag.ContinueOnError)
+	configPath := fs.String("config", paths.Config, T("flag.config"))
+	output := fs.String("output", "", T("flag.migrate.output"))
+	dryRun := fs.Bool("dry-run", false, T("flag.migrate.dryrun"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	migrated, applied, err := migrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(applied) == 0 {
+		fmt.Fprintf(os.Stderr, "config is already at version %d\n", CurrentConfigVersion)
+		return 0
+	}
+	for _, a := range applied {
+		fmt.Fprintf(os.Stderr, "[*] migration %s\n", a)
+	}
+
+	target := *output
+	if target == "" {
+		target = *configPath
+	}
+	fmt.Print(unifiedDiff(*configPath, target, string(data), string(migrated)))
+	if *dryRun {
+		return 0
+	}
+
+	// The config may hold stream keys, so the backup and a new output file get the source's permissions.
+	info, err := os.Stat(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if target == *configPath {
+		if err := writeFileAtomicMode(*configPath+".bak", data, info.Mode().Perm()); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: failed to write backup: %v\n", err)
+			return 1
+		}
+	}
+	mode := info.Mode().Perm()
+	if existing, err := os.Stat(target); err == nil {
+		mode = existing.Mode().Perm()
+	}
+	if err := writeFileAtomicMode(target, migrated, mode); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] wrote %s\n", target)
+	return 0
+}
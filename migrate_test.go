@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMigrateConfig 测试旧配置升级到当前版本
+func TestMigrateConfig(t *testing.T) {
+	old := "# streams\nstreams:\n  - id: stream-1\n    src: rtmp://a/live\n    dst: rtmp://b/live\n"
+	migrated, applied, err := migrateConfig([]byte(old))
+	if err != nil {
+		t.Fatalf("migrateConfig failed: %v", err)
+	}
+	if len(applied) != CurrentConfigVersion {
+		t.Errorf("expected %d migrations, got %v", CurrentConfigVersion, applied)
+	}
+	if !strings.Contains(string(migrated), "version: 1") || !strings.Contains(string(migrated), "id: stream-1") {
+		t.Errorf("unexpected migrated config:\n%s", migrated)
+	}
+
+	again, applied, err := migrateConfig(migrated)
+	if err != nil || len(applied) != 0 || string(again) != string(migrated) {
+		t.Errorf("expected current config to be left untouched, got %v %v", applied, err)
+	}
+	if _, _, err := migrateConfig([]byte("version: 99\nstreams: []\n")); err == nil {
+		t.Error("expected newer config version to be rejected")
+	}
+
+	diff := unifiedDiff("a", "b", "x\ny\nz\n", "x\nY\nz\n")
+	want := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n x\n-y\n+Y\n z\n"
+	if diff != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", diff, want)
+	}
+}
+
+// TestRunMigrateConfigPermissions 测试升级后的配置和备份保留原配置的权限，已有的宽松备份也会收紧
+func TestRunMigrateConfigPermissions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "streams.yml")
+	old := "streams:\n  - id: stream-1\n    src: rtmp://a/live\n    dst: rtmp://b/live/secret-key\n"
+	if err := os.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".bak", []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMigrateConfig([]string{"--config", path}); code != 0 {
+		t.Fatalf("migrate-config exited with %d", code)
+	}
+	for _, p := range []string{path, path + ".bak"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode %v, want 0600", p, info.Mode().Perm())
+		}
+	}
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != old {
+		t.Errorf("backup = %q", data)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "version: 1") {
+		t.Errorf("config not migrated:\n%s", data)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".stream-runner-config-*")); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// namespaceFlags 是命名空间名称到 clone 标志的映射。
+var namespaceFlags = map[string]uintptr{
+	"mount": syscall.CLONE_NEWNS,
+	"pid":   syscall.CLONE_NEWPID,
+	"ipc":   syscall.CLONE_NEWIPC,
+	"uts":   syscall.CLONE_NEWUTS,
+	"net":   syscall.CLONE_NEWNET,
+	"user":  syscall.CLONE_NEWUSER,
+}
+
+// applyNamespaces 在进程属性上设置创建新命名空间所需的 clone 标志。
+// 使用 user 命名空间时将当前用户映射为命名空间内的 root，使非 root 守护进程也能挂载。
+func applyNamespaces(attr *syscall.SysProcAttr, namespaces []string) error {
+	for _, ns := range namespaces {
+		flag, ok := namespaceFlags[ns]
+		if !ok {
+			return fmt.Errorf("unknown namespace %q", ns)
+		}
+		attr.Cloneflags |= flag
+		if ns == "user" {
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+		}
+	}
+	return nil
+}
+
+// mountSetup 是 sandbox-exec 在新 mount 命名空间内执行的挂载操作。
+type mountSetup struct {
+	readOnlyRoot bool
+	writable     []string
+	hide         []string
+	mountProc    bool
+	chroot       string
+}
+
+// apply 执行挂载操作，必须在新的 mount 命名空间内调用，否则会影响宿主机。
+func (m *mountSetup) apply() error {
+	// Stop mount events from propagating back to the host.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if m.mountProc {
+		// A fresh /proc shows only processes of the new pid namespace.
+		if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("failed to mount /proc: %w", err)
+		}
+	}
+	for _, p := range m.hide {
+		if err := syscall.Mount("tmpfs", p, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=0755"); err != nil {
+			return fmt.Errorf("failed to hide %s: %w", p, err)
+		}
+	}
+	if m.readOnlyRoot {
+		// Writable paths become separate bind mounts first so they keep read-write access.
+		for _, p := range m.writable {
+			if err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+				return fmt.Errorf("failed to bind %s: %w", p, err)
+			}
+		}
+		if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("failed to remount / read-only: %w", err)
+		}
+	}
+	if m.chroot != "" {
+		if err := syscall.Chroot(m.chroot); err != nil {
+			return fmt.Errorf("failed to chroot to %s: %w", m.chroot, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("failed to chdir after chroot: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// applyNamespaces 在不支持命名空间的平台上，只要请求了命名空间就返回错误。
+func applyNamespaces(_ *syscall.SysProcAttr, namespaces []string) error {
+	if len(namespaces) > 0 {
+		return errors.New("namespaces are only supported on linux")
+	}
+	return nil
+}
+
+// mountSetup 是 sandbox-exec 在新 mount 命名空间内执行的挂载操作。
+type mountSetup struct {
+	readOnlyRoot bool
+	writable     []string
+	hide         []string
+	mountProc    bool
+	chroot       string
+}
+
+// apply 在不支持的平台上总是返回错误。
+func (m *mountSetup) apply() error {
+	return errors.New("mount namespaces are only supported on linux")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// IPFamilyAuto 表示不限制地址族，由系统解析顺序决定。
+	IPFamilyAuto = "auto"
+	// IPFamilyIPv4 表示只使用 IPv4。
+	IPFamilyIPv4 = "ipv4"
+	// IPFamilyIPv6 表示只使用 IPv6。
+	IPFamilyIPv6 = "ipv6"
+
+	// dnsTimeout 是启动前解析流地址的超时时间。
+	dnsTimeout = 5 * time.Second
+)
+
+// rewritableSchemes 是可以安全地把主机名替换为 IP 的协议。
+// rtmps 等 TLS 协议依赖主机名做证书校验，只校验解析结果而不替换。
+var rewritableSchemes = map[string]bool{
+	"rtmp": true,
+	"srt":  true,
+	"tcp":  true,
+	"udp":  true,
+	"rtp":  true,
+}
+
+// resolvedEndpoints 是每次启动 ffmpeg 前解析出的实际连接参数。
+type resolvedEndpoints struct {
+	// Src 和 Dst 是实际传给 ffmpeg 的地址，可能已按地址族偏好将主机名替换为 IP。
+	Src, Dst string
+	// SrcTCURL 和 DstTCURL 是替换主机名后用于保留原始 tcUrl 的 RTMP 参数，未替换时为空。
+	SrcTCURL, DstTCURL string
+	// SrcAddr 和 DstAddr 是本地绑定地址，为空时不绑定。
+	SrcAddr, DstAddr string
+}
+
+// validIPFamily 检查地址族配置是否合法，空值等同于 auto。
+func validIPFamily(family string) bool {
+	switch family {
+	case "", IPFamilyAuto, IPFamilyIPv4, IPFamilyIPv6:
+		return true
+	}
+	return false
+}
+
+// ipNetwork 将地址族配置转换为 net 包使用的网络名。
+func ipNetwork(family string) string {
+	switch family {
+	case IPFamilyIPv4:
+		return "ip4"
+	case IPFamilyIPv6:
+		return "ip6"
+	}
+	return "ip"
+}
+
+// matchesFamily 检查 IP 是否属于指定地址族。
+func matchesFamily(ip net.IP, family string) bool {
+	switch family {
+	case IPFamilyIPv4:
+		return ip.To4() != nil
+	case IPFamilyIPv6:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// resolveBindAddr 将配置中的绑定值（本地 IP 或网卡名）解析为可用的本地 IP。
+// 空值表示不绑定，返回空字符串。
+// 指定 IP 时会校验该地址确实属于本机某个网卡；指定网卡名时取其第一个符合地址族的可用地址。
+func resolveBindAddr(spec, family string) (string, error) {
+	if spec == "" {
+		return "", nil
+	}
+
+	if ip := net.ParseIP(spec); ip != nil {
+		if !matchesFamily(ip, family) {
+			return "", fmt.Errorf("bind address %s does not match ip_family %s", spec, family)
+		}
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return "", fmt.Errorf("failed to list interface addresses: %w", err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return ip.String(), nil
+			}
+		}
+		return "", fmt.Errorf("bind address %s is not assigned to any local interface", spec)
+	}
+
+	iface, err := net.InterfaceByName(spec)
+	if err != nil {
+		return "", fmt.Errorf("bind interface %s not found: %w", spec, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return "", fmt.Errorf("bind interface %s is down", spec)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to list addresses of interface %s: %w", spec, err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue // Link-local addresses need a zone and are useless for routing out.
+		}
+		if !matchesFamily(ipNet.IP, family) {
+			continue
+		}
+		return ipNet.IP.String(), nil
+	}
+	return "", fmt.Errorf("bind interface %s has no usable address for ip_family %s", spec, family)
+}
+
+// resolveHost 按地址族偏好解析流地址中的主机名。
+// 返回实际使用的地址，以及主机名被替换时需要传给 ffmpeg 的 RTMP tcUrl。
+// 地址族为 auto 或地址不是 URL 时原样返回，交给 ffmpeg 自行解析。
+func resolveHost(rawURL, family string) (target, tcURL string, err error) {
+	network := ipNetwork(family)
+	u, err := url.Parse(rawURL)
+	if network == "ip" || err != nil || u.Host == "" {
+		return rawURL, "", nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !matchesFamily(ip, family) {
+			return "", "", fmt.Errorf("address %s does not match ip_family %s", host, family)
+		}
+		return rawURL, "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve %s for ip_family %s: %w", host, family, err)
+	}
+	if len(ips) == 0 {
+		return "", "", fmt.Errorf("no %s address found for %s", family, host)
+	}
+	if !rewritableSchemes[u.Scheme] {
+		return rawURL, "", nil
+	}
+
+	newHost := ips[0].String()
+	if port := u.Port(); port != "" {
+		newHost = net.JoinHostPort(newHost, port)
+	} else if ips[0].To4() == nil {
+		newHost = "[" + newHost + "]"
+	}
+	// Replace textually so that stream keys are passed through byte for byte.
+	target = strings.Replace(rawURL, "//"+u.Host, "//"+newHost, 1)
+
+	if u.Scheme == "rtmp" {
+		tcURL = rtmpTCURL(u)
+	}
+	return target, tcURL, nil
+}
+
+// rtmpTCURL 按 ffmpeg 的默认规则（首个路径段为 app，端口默认 1935）构造 tcUrl。
+func rtmpTCURL(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "1935"
+	}
+	app := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(app, "/"); i >= 0 {
+		app = app[:i]
+	}
+	return fmt.Sprintf("%s://%s/%s", u.Scheme, net.JoinHostPort(u.Hostname(), port), app)
+}
+
+// resolveEndpoints 解析流的源端和目标端连接参数，每次启动 ffmpeg 前调用，
+// 使 DNS 变化和网卡地址变化能在重连时生效。
+func resolveEndpoints(cfg StreamConfig) (*resolvedEndpoints, error) {
+	var ep resolvedEndpoints
+	var err error
+	if ep.SrcAddr, err = resolveBindAddr(cfg.SrcBind, cfg.IPFamily); err != nil {
+		return nil, fmt.Errorf("src_bind: %w", err)
+	}
+	if ep.DstAddr, err = resolveBindAddr(cfg.DstBind, cfg.IPFamily); err != nil {
+		return nil, fmt.Errorf("dst_bind: %w", err)
+	}
+	if ep.Src, ep.SrcTCURL, err = resolveHost(cfg.Src, cfg.IPFamily); err != nil {
+		return nil, fmt.Errorf("src: %w", err)
+	}
+	if ep.Dst, ep.DstTCURL, err = resolveHost(cfg.Dst, cfg.IPFamily); err != nil {
+		return nil, fmt.Errorf("dst: %w", err)
+	}
+	return &ep, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+// TestResolveBindAddr 测试绑定地址解析
+func TestResolveBindAddr(t *testing.T) {
+	addr, err := resolveBindAddr("", "")
+	if err != nil || addr != "" {
+		t.Errorf("expected empty bind to resolve to nothing, got %q, %v", addr, err)
+	}
+
+	addr, err = resolveBindAddr("127.0.0.1", IPFamilyIPv4)
+	if err != nil {
+		t.Fatalf("resolveBindAddr failed: %v", err)
+	}
+	if addr != "127.0.0.1" {
+		t.Errorf("expected 127.0.0.1, got %s", addr)
+	}
+
+	if _, err := resolveBindAddr("127.0.0.1", IPFamilyIPv6); err == nil {
+		t.Error("expected error for IPv4 bind address with ip_family ipv6")
+	}
+
+	if _, err := resolveBindAddr("192.0.2.123", ""); err == nil {
+		t.Error("expected error for address not assigned to a local interface")
+	}
+
+	if _, err := resolveBindAddr("no-such-iface0", ""); err == nil {
+		t.Error("expected error for unknown interface")
+	}
+}
+
+// TestResolveHost 测试按地址族偏好解析流地址
+func TestResolveHost(t *testing.T) {
+	raw := "rtmp://dest.example.com/live/key"
+	target, tcURL, err := resolveHost(raw, IPFamilyAuto)
+	if err != nil || target != raw || tcURL != "" {
+		t.Errorf("expected auto family to keep URL untouched, got %q, %q, %v", target, tcURL, err)
+	}
+
+	target, tcURL, err = resolveHost("rtmp://localhost/live/key", IPFamilyIPv4)
+	if err != nil {
+		t.Fatalf("resolveHost failed: %v", err)
+	}
+	if target != "rtmp://127.0.0.1/live/key" {
+		t.Errorf("expected host to be replaced by IPv4 address, got %s", target)
+	}
+	if tcURL != "rtmp://localhost:1935/live" {
+		t.Errorf("expected original tcUrl to be kept, got %s", tcURL)
+	}
+
+	if _, _, err := resolveHost("rtmp://[2001:db8::1]/live/key", IPFamilyIPv4); err == nil {
+		t.Error("expected error for IPv6 literal with ip_family ipv4")
+	}
+}
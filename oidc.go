@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for RS384/RS512/ES384 signatures
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcTimeout 是请求身份提供方（发现文档、JWKS、令牌端点）的超时时间。
+const oidcTimeout = 10 * time.Second
+
+// oidcKeyRefreshInterval 是因未知的签名密钥重新获取 JWKS 的最短间隔，避免伪造的 kid 让守护进程反复请求身份提供方。
+const oidcKeyRefreshInterval = time.Minute
+
+// oidcClockSkew 是校验 ID 令牌有效期时容许的时钟偏差。
+const oidcClockSkew = time.Minute
+
+// oidcCallbackPath 是登录回调的路径，redirect_url 必须指向它。
+const oidcCallbackPath = "/auth/callback"
+
+// OIDCConfig 是仪表盘和管理接口的单点登录（OpenID Connect）配置。用户登录后按所在的组映射为令牌角色，
+// 与令牌使用同一套权限检查，支持热重载。
+type OIDCConfig struct {
+	// Issuer 是身份提供方的地址，如 "https://sso.example.com/realms/ops"，发现文档从 {issuer}/.well-known/openid-configuration 获取。
+	Issuer string `yaml:"issuer"`
+	// ClientID 是在身份提供方注册的客户端 ID。
+	ClientID string `yaml:"client_id"`
+	// ClientSecret 是客户端密钥（可选），支持 ${secret:...} 占位符，与 ClientSecretEnv 二选一；公共客户端只使用 PKCE。
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	// ClientSecretEnv 是保存客户端密钥的环境变量名（可选）。
+	ClientSecretEnv string `yaml:"client_secret_env,omitempty"`
+	// RedirectURL 是在身份提供方登记的回调地址，路径必须为 api.base_path 下的 /auth/callback，如 "https://runner.example.com:9311/auth/callback"。
+	RedirectURL string `yaml:"redirect_url"`
+	// Scopes 是请求的权限范围，默认 openid、profile 和 email；部分身份提供方需要额外的 groups 才会返回组。
+	Scopes []string `yaml:"scopes,omitempty"`
+	// UserClaim 是作为用户名记录到日志和审计日志中的声明，默认 email，缺失时依次使用 preferred_username 和 sub。
+	UserClaim string `yaml:"user_claim,omitempty"`
+	// GroupsClaim 是 ID 令牌中组列表的声明名，默认 groups。
+	GroupsClaim string `yaml:"groups_claim,omitempty"`
+	// Roles 是组到角色（read-only、operator 或 admin）的映射，用户属于多个组时取最高的角色，不属于任何组时拒绝登录。
+	Roles map[string]string `yaml:"roles"`
+	// SessionTTL 是会话的最长有效期，默认 8h，到期后需要重新登录。
+	SessionTTL time.Duration `yaml:"session_ttl,omitempty"`
+	// IdleTimeout 是会话的空闲超时，默认 1h。
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+}
+
+// validate 校验单点登录配置，basePath 是管理接口的路径前缀。
+func (c *OIDCConfig) validate(basePath string) error {
+	u, err := url.Parse(c.Issuer)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("issuer must be an absolute url")
+	}
+	// Plain http is only acceptable for an identity provider on the same host, e.g. in development.
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return fmt.Errorf("issuer must use https")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if c.ClientSecret != "" && c.ClientSecretEnv != "" {
+		return fmt.Errorf("client_secret and client_secret_env are mutually exclusive")
+	}
+	if c.ClientSecretEnv != "" && os.Getenv(c.ClientSecretEnv) == "" {
+		return fmt.Errorf("client_secret_env: environment variable %s is not set", c.ClientSecretEnv)
+	}
+	r, err := url.Parse(c.RedirectURL)
+	if err != nil || r.Host == "" || (r.Scheme != "https" && r.Scheme != "http") {
+		return fmt.Errorf("redirect_url must be an absolute http(s) url")
+	}
+	if want := normalizeBasePath(basePath) + oidcCallbackPath; r.Path != want {
+		return fmt.Errorf("redirect_url path must be %s", want)
+	}
+	if len(c.Roles) == 0 {
+		return fmt.Errorf("roles is required")
+	}
+	for group, role := range c.Roles {
+		if apiRoleLevels[role] == 0 {
+			return fmt.Errorf("roles: group %q: role must be read-only, operator or admin", group)
+		}
+	}
+	if c.SessionTTL < 0 || c.IdleTimeout < 0 {
+		return fmt.Errorf("session_ttl and idle_timeout must not be negative")
+	}
+	return nil
+}
+
+// scopes 返回请求的权限范围，总是包含 openid。
+func (c *OIDCConfig) scopes() []string {
+	if len(c.Scopes) == 0 {
+		return []string{"openid", "profile", "email"}
+	}
+	for _, s := range c.Scopes {
+		if s == "openid" {
+			return c.Scopes
+		}
+	}
+	return append([]string{"openid"}, c.Scopes...)
+}
+
+// sessionTTL 返回会话的最长有效期。
+func (c *OIDCConfig) sessionTTL() time.Duration {
+	if c.SessionTTL == 0 {
+		return 8 * time.Hour
+	}
+	return c.SessionTTL
+}
+
+// idleTimeout 返回会话的空闲超时。
+func (c *OIDCConfig) idleTimeout() time.Duration {
+	if c.IdleTimeout == 0 {
+		return time.Hour
+	}
+	return c.IdleTimeout
+}
+
+// clientSecret 返回客户端密钥，未配置时为空。
+func (c *OIDCConfig) clientSecret() (string, error) {
+	if c.ClientSecretEnv != "" {
+		return strings.TrimSpace(os.Getenv(c.ClientSecretEnv)), nil
+	}
+	return resolveSecrets(context.Background(), c.ClientSecret)
+}
+
+// role 返回组列表对应的最高角色，没有映射的组时为空。
+func (c *OIDCConfig) role(groups []string) string {
+	role := ""
+	if c == nil {
+		return role
+	}
+	for _, g := range groups {
+		if r := c.Roles[g]; apiRoleLevels[r] > apiRoleLevels[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// oidcProvider 是身份提供方的端点和签名公钥，发现文档和 JWKS 按 issuer 缓存。
+type oidcProvider struct {
+	issuer   string
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// oidcProviders 缓存已发现的身份提供方，key 为 issuer。
+var oidcProviders = struct {
+	mu sync.Mutex
+	m  map[string]*oidcProvider
+}{m: make(map[string]*oidcProvider)}
+
+// oidcGetJSON 请求身份提供方并解析 JSON 响应。
+func oidcGetJSON(rawURL string, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", redactURLs(rawURL), resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// discoverOIDC 返回 issuer 对应的身份提供方，首次使用时获取发现文档。获取失败不缓存，下次登录时重试。
+func discoverOIDC(issuer string) (*oidcProvider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	oidcProviders.mu.Lock()
+	defer oidcProviders.mu.Unlock()
+	if p := oidcProviders.m[issuer]; p != nil {
+		return p, nil
+	}
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := oidcGetJSON(issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: authorization_endpoint, token_endpoint and jwks_uri are required")
+	}
+	p := &oidcProvider{issuer: doc.Issuer, authURL: doc.AuthorizationEndpoint, tokenURL: doc.TokenEndpoint, jwksURL: doc.JWKSURI}
+	oidcProviders.m[issuer] = p
+	return p, nil
+}
+
+// authCodeURL 返回跳转到身份提供方登录页的地址，使用授权码流程和 PKCE（S256）。
+func (p *oidcProvider) authCodeURL(c *OIDCConfig, state, nonce, verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(c.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + q.Encode()
+}
+
+// exchange 用授权码换取 ID 令牌。
+func (p *oidcProvider) exchange(c *OIDCConfig, code, verifier string) (string, error) {
+	secret, err := c.clientSecret()
+	if err != nil {
+		return "", fmt.Errorf("client_secret: %w", err)
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"client_id":     {c.ClientID},
+		"code_verifier": {verifier},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if secret != "" {
+		// RFC 6749 2.3.1: credentials are form-encoded before basic authentication.
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(secret))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || out.Error != "" {
+		if out.Error != "" {
+			return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, out.Error, out.ErrorDescription)
+		}
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if out.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return out.IDToken, nil
+}
+
+// jsonWebKey 是 JWKS 中的一个公钥，支持 RSA 和 P-256/P-384 椭圆曲线密钥。
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 解析公钥。
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported rsa key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("ec point is not on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// key 返回 kid 对应的签名公钥。密钥未知时（身份提供方轮换了密钥）重新获取 JWKS，两次获取至少间隔 oidcKeyRefreshInterval。
+func (p *oidcProvider) key(kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if !p.fetched.IsZero() && time.Since(p.fetched) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := oidcGetJSON(p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	p.fetched = time.Now()
+	p.keys = make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys that cannot be parsed are skipped so one exotic key does not break login.
+		if pub, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = pub
+		}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// oidcAlgs 是支持的 ID 令牌签名算法及其摘要算法。不支持 none 和 HMAC，避免用公钥伪造签名。
+var oidcAlgs = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+// verifyJWS 校验 JWS 签名。
+func verifyJWS(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	hash, ok := oidcAlgs[alg]
+	if !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match rsa key", alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return fmt.Errorf("algorithm %s does not match ec key", alg)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key")
+	}
+}
+
+// oidcIdentity 是从 ID 令牌中取出的用户身份。
+type oidcIdentity struct {
+	Subject string
+	User    string
+	Groups  []string
+}
+
+// verifyIDToken 校验 ID 令牌的签名、签发者、受众、有效期和 nonce，返回用户身份。
+func (p *oidcProvider) verifyIDToken(c *OIDCConfig, raw, nonce string, now time.Time) (oidcIdentity, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return oidcIdentity{}, fmt.Errorf("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return oidcIdentity{}, fmt.Errorf("id token header: %w", err)
+	}
+	if _, ok := oidcAlgs[header.Alg]; !ok {
+		return oidcIdentity{}, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return oidcIdentity{}, fmt.Errorf("id token signature: %w", err)
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	if err := verifyJWS(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return oidcIdentity{}, fmt.Errorf("id token signature: %w", err)
+	}
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return oidcIdentity{}, fmt.Errorf("id token claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != p.issuer {
+		return oidcIdentity{}, fmt.Errorf("id token issuer %q does not match", iss)
+	}
+	var aud []string
+	switch a := claims["aud"].(type) {
+	case string:
+		aud = []string{a}
+	case []any:
+		for _, v := range a {
+			if s, ok := v.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	found := false
+	for _, a := range aud {
+		found = found || a == c.ClientID
+	}
+	if !found {
+		return oidcIdentity{}, fmt.Errorf("id token is not issued for client %s", c.ClientID)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != c.ClientID {
+		return oidcIdentity{}, fmt.Errorf("id token authorized party %q does not match", azp)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return oidcIdentity{}, fmt.Errorf("id token expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcClockSkew)) {
+		return oidcIdentity{}, fmt.Errorf("id token issued in the future")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return oidcIdentity{}, fmt.Errorf("id token nonce does not match")
+	}
+	id := oidcIdentity{}
+	if id.Subject, _ = claims["sub"].(string); id.Subject == "" {
+		return oidcIdentity{}, fmt.Errorf("id token has no subject")
+	}
+	userClaims := []string{"email", "preferred_username", "sub"}
+	if c.UserClaim != "" {
+		userClaims = append([]string{c.UserClaim}, userClaims...)
+	}
+	for _, name := range userClaims {
+		if id.User, _ = claims[name].(string); id.User != "" {
+			break
+		}
+	}
+	groupsClaim := c.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	switch g := claims[groupsClaim].(type) {
+	case string:
+		id.Groups = []string{g}
+	case []any:
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+// decodeJWTPart 解码 JWT 中 base64url 编码的 JSON 部分。
+func decodeJWTPart(part string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT 用 key 签名 claims，返回紧凑格式的 JWT。
+func signJWT(t *testing.T, key crypto.Signer, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := enc(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// fakeIdP 是测试用的身份提供方，令牌端点对 code "good" 签发 ID 令牌。
+type fakeIdP struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+	groups    []string
+}
+
+// newFakeIdP 启动测试用的身份提供方。
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer": p.URL, "authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint": p.URL + "/token", "jwks_uri": p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good" || id != "runner" || secret != "client-secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		now := time.Now().Unix()
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signJWT(t, key, "RS256", "k1", map[string]any{
+			"iss": p.URL, "aud": "runner", "sub": "u-1", "email": "alice@example.com",
+			"groups": p.groups, "nonce": p.nonce, "iat": now, "exp": now + 300,
+		})})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// TestOIDCLogin 测试单点登录的完整流程：跳转、回调换取 ID 令牌、按组映射角色、CSRF 校验和退出登录
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.groups = []string{"staff", "noc"}
+	oidc := &OIDCConfig{
+		Issuer: idp.URL, ClientID: "runner", ClientSecret: "client-secret",
+		RedirectURL: "http://127.0.0.1:9311/auth/callback",
+		Roles:       map[string]string{"noc": APIRoleOperator, "streaming": APIRoleAdmin},
+	}
+	api := &APIConfig{Listen: "127.0.0.1:0", OIDC: oidc}
+	if err := api.validate(); err != nil {
+		t.Fatal(err)
+	}
+	state := &AppState{config: &Config{API: api}, workers: newWorkerMap(nil)}
+	h := newAPIHandler(state, "")
+	do := func(method, path string, cookies []*http.Cookie, csrf string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if csrf != "" {
+			req.Header.Set(csrfHeader, csrf)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/auth/login?next=https://evil.example.com/", nil, "")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	q := loc.Query()
+	if !strings.HasPrefix(loc.String(), idp.URL+"/authorize?") || q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != oidc.RedirectURL {
+		t.Fatalf("unexpected authorize url %s", loc)
+	}
+	idp.nonce, idp.challenge = q.Get("nonce"), q.Get("code_challenge")
+	stateCookies := rec.Result().Cookies()
+
+	if rec := do(http.MethodGet, "/auth/callback?code=good&state=forged", stateCookies, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback with forged state: %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/auth/callback?code=good&state="+url.QueryEscape(q.Get("state")), stateCookies, "")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/ui/" {
+		t.Fatalf("callback: %d %s %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	var session []*http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			if !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+				t.Errorf("session cookie is not protected: %+v", c)
+			}
+			session = append(session, c)
+		}
+	}
+	if len(session) != 1 {
+		t.Fatalf("no session cookie: %v", rec.Result().Cookies())
+	}
+	// The state is single use.
+	if rec := do(http.MethodGet, "/auth/callback?code=good&state="+url.QueryEscape(q.Get("state")), stateCookies, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback: %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, "/auth/session", session, "")
+	var info struct {
+		User      string `json:"user"`
+		Role      string `json:"role"`
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || info.User != "alice@example.com" || info.Role != APIRoleOperator || info.CSRFToken == "" {
+		t.Fatalf("session: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(http.MethodGet, "/status", session, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /status with session: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/streams/news/restart", session, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("POST without csrf token: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/streams/news/restart", session, info.CSRFToken); rec.Code == http.StatusForbidden || rec.Code == http.StatusUnauthorized {
+		t.Errorf("operator restart: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/streams/news", session, info.CSRFToken); rec.Code != http.StatusForbidden {
+		t.Errorf("operator delete stream: %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/sessions", session, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("operator list sessions: %d", rec.Code)
+	}
+
+	// The group mapping is evaluated on every request, so a reload takes effect for signed-in users.
+	oidc.Roles = map[string]string{"noc": APIRoleAdmin}
+	rec = do(http.MethodGet, "/sessions", session, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "alice@example.com") {
+		t.Errorf("admin list sessions: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(http.MethodPost, "/auth/logout", session, info.CSRFToken); rec.Code != http.StatusNoContent {
+		t.Errorf("logout: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/status", session, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /status after logout: %d", rec.Code)
+	}
+}
+
+// TestVerifyIDToken 测试 ID 令牌的签名、受众、有效期、nonce 和算法校验
+func TestVerifyIDToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p := &oidcProvider{issuer: "https://sso.example.com", fetched: time.Now(), keys: map[string]crypto.PublicKey{"ec": &key.PublicKey}}
+	c := &OIDCConfig{ClientID: "runner", GroupsClaim: "roles", UserClaim: "upn"}
+	now := time.Now()
+	claims := func(change func(map[string]any)) map[string]any {
+		m := map[string]any{
+			"iss": p.issuer, "aud": []string{"runner", "other"}, "azp": "runner", "sub": "u-2", "upn": "bob",
+			"roles": []string{"ops"}, "nonce": "n-1", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+		if change != nil {
+			change(m)
+		}
+		return m
+	}
+	id, err := p.verifyIDToken(c, signJWT(t, key, "ES256", "ec", claims(nil)), "n-1", now)
+	if err != nil || id.User != "bob" || id.Subject != "u-2" || len(id.Groups) != 1 || id.Groups[0] != "ops" {
+		t.Fatalf("valid token: %+v %v", id, err)
+	}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"ec"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"https://sso.example.com","aud":"runner","sub":"x","nonce":"n-1"}`)) + "."
+	for name, raw := range map[string]string{
+		"wrong key":      signJWT(t, other, "ES256", "ec", claims(nil)),
+		"unknown kid":    signJWT(t, key, "ES256", "missing", claims(nil)),
+		"alg none":       none,
+		"wrong audience": signJWT(t, key, "ES256", "ec", claims(func(m map[string]any) { m["aud"] = "other"; delete(m, "azp") })),
+		"wrong issuer":   signJWT(t, key, "ES256", "ec", claims(func(m map[string]any) { m["iss"] = "https://evil.example.com" })),
+		"expired":        signJWT(t, key, "ES256", "ec", claims(func(m map[string]any) { m["exp"] = now.Add(-time.Hour).Unix() })),
+		"wrong nonce":    signJWT(t, key, "ES256", "ec", claims(func(m map[string]any) { m["nonce"] = "n-2" })),
+		"no subject":     signJWT(t, key, "ES256", "ec", claims(func(m map[string]any) { delete(m, "sub") })),
+	} {
+		if _, err := p.verifyIDToken(c, raw, "n-1", now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
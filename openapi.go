@@ -0,0 +1,899 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// jsonObject 是 OpenAPI 文档中的 JSON 对象，用于减少字面量的嵌套噪音。
+type jsonObject = map[string]any
+
+// openAPIResponse 返回只有描述和单一内容类型的响应定义，schema 为空时不写 content。
+func openAPIResponse(description, contentType string, schema jsonObject) jsonObject {
+	resp := jsonObject{"description": description}
+	if contentType != "" {
+		media := jsonObject{}
+		if schema != nil {
+			media["schema"] = schema
+		}
+		resp["content"] = jsonObject{contentType: media}
+	}
+	return resp
+}
+
+// openAPIError 是接口返回的纯文本错误响应。
+func openAPIError(description string) jsonObject {
+	return openAPIResponse(description, "text/plain", jsonObject{"type": "string"})
+}
+
+// openAPIQuery 返回一个可选查询参数定义。
+func openAPIQuery(name, description string, schema jsonObject) jsonObject {
+	return jsonObject{"name": name, "in": "query", "required": false, "description": description, "schema": schema}
+}
+
+// openAPIRef 返回对 components.schemas 中定义的引用。
+func openAPIRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISpec 返回 HTTP 接口的 OpenAPI 3 文档：指标服务（metrics.listen）和管理接口（api.listen）。
+// basePath 和 apiBasePath 分别是两者的反向代理路径前缀。新增或修改接口时需要同步更新这里，
+// TestOpenAPISpec 会校验文档与 newMetricsMux、newAPIMux 注册的路径一致。
+func openAPISpec(basePath, apiBasePath string) jsonObject {
+	ref := openAPIRef
+	server := normalizeBasePath(basePath)
+	if server == "" {
+		server = "/"
+	}
+	metricsServer := jsonObject{"url": server, "description": "metrics.listen"}
+	apiServer := jsonObject{
+		"url":         "{api}" + normalizeBasePath(apiBasePath),
+		"description": "api.listen",
+		"variables": jsonObject{
+			"api": jsonObject{"default": "http://127.0.0.1:9311", "description": "Scheme, host and port of api.listen."},
+		},
+	}
+	paths := jsonObject{
+		"/metrics": jsonObject{"get": jsonObject{
+			"operationId": "getMetrics",
+			"summary":     "Prometheus metrics in text exposition format.",
+			"responses": jsonObject{
+				"200": openAPIResponse("Metrics.", "text/plain", jsonObject{"type": "string"}),
+			},
+		}},
+		"/version": jsonObject{"get": jsonObject{
+			"operationId": "getVersion",
+			"summary":     "Version and build information of the running daemon.",
+			"responses": jsonObject{
+				"200": openAPIResponse("Build information.", "application/json", ref("BuildInfo")),
+			},
+		}},
+		"/dashboard.json": jsonObject{"get": jsonObject{
+			"operationId": "getDashboard",
+			"summary":     "Grafana dashboard for the current streams, ready to import.",
+			"responses": jsonObject{
+				"200": openAPIResponse("Grafana dashboard JSON model.", "application/json", jsonObject{"type": "object"}),
+			},
+		}},
+		"/status": jsonObject{"get": jsonObject{
+			"operationId": "getStatus",
+			"summary":     "Filtered, sorted and paginated status of the streams on this node.",
+			"parameters": []jsonObject{
+				openAPIQuery("state", "Comma-separated states to include.", jsonObject{"type": "string", "example": "backoff,starting"}),
+				openAPIQuery("label", "key=value label filter, repeat to require several labels.", jsonObject{"type": "string"}),
+				openAPIQuery("q", "Case-insensitive substring of the stream ID.", jsonObject{"type": "string"}),
+				openAPIQuery("error", "Comma-separated categories of the last error, none for streams without errors.", jsonObject{"type": "string", "example": "readiness,exit"}),
+				openAPIQuery("sort", "Sort key, prefix with - for descending.", jsonObject{"type": "string", "enum": []string{"id", "-id", "state", "-state", "restarts", "-restarts", "failures", "-failures", "uptime", "-uptime", "last_error", "-last_error", "viewers", "-viewers", "health", "-health"}}),
+				openAPIQuery("offset", "Number of matching streams to skip.", jsonObject{"type": "integer", "minimum": 0}),
+				openAPIQuery("limit", "Page size, default 100, at most 1000 (0 for the maximum).", jsonObject{"type": "integer", "minimum": 0}),
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("One page of matching streams.", "application/json", ref("StatusPage")),
+				"400": openAPIError("Invalid filter, sort key or pagination."),
+			},
+		}},
+		"/status/{id}": jsonObject{"get": jsonObject{
+			"operationId": "getStreamStatus",
+			"summary":     "Status of one stream, including its most recent ffmpeg output.",
+			"parameters": []jsonObject{
+				{"name": "id", "in": "path", "required": true, "description": "Stream ID.", "schema": jsonObject{"type": "string"}},
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("Stream status.", "application/json", ref("StreamStatus")),
+				"404": openAPIError("No such stream."),
+			},
+		}},
+		"/inventory": jsonObject{"get": jsonObject{
+			"operationId": "getInventory",
+			"summary":     "Ansible dynamic inventory (ansible-inventory --list format) with this host and its streams.",
+			"parameters": []jsonObject{
+				openAPIQuery("host", "Inventory host name, defaults to the daemon hostname.", jsonObject{"type": "string"}),
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("Inventory. Streams are listed in the stream_runner_streams host variable.", "application/json", jsonObject{"type": "object"}),
+			},
+		}},
+		"/fleet": jsonObject{"get": jsonObject{
+			"operationId": "getFleet",
+			"summary":     "Status and streams of the nodes listed in fleet.nodes, as of the last poll.",
+			"responses": jsonObject{
+				"200": openAPIResponse("Fleet status.", "application/json", ref("FleetStatus")),
+				"404": openAPIError("fleet is not configured."),
+			},
+		}},
+		"/healthz": jsonObject{"get": jsonObject{
+			"operationId": "getHealthz",
+			"summary":     "Liveness probe, succeeds while the daemon answers requests.",
+			"responses": jsonObject{
+				"200": openAPIResponse("The daemon is alive.", "text/plain", jsonObject{"type": "string", "example": "ok"}),
+			},
+		}},
+		"/readyz": jsonObject{"get": jsonObject{
+			"operationId": "getReadyz",
+			"summary":     "Readiness probe, succeeds when at least metrics.ready_percent of the streams are running.",
+			"responses": jsonObject{
+				"200": openAPIResponse("Enough streams are running.", "application/json", ref("Readiness")),
+				"503": openAPIResponse("Too few streams are running, or the daemon is draining.", "application/json", ref("Readiness")),
+			},
+		}},
+		"/openapi.json": jsonObject{"get": jsonObject{
+			"operationId": "getOpenAPI",
+			"summary":     "This document.",
+			"responses": jsonObject{
+				"200": openAPIResponse("OpenAPI 3 document.", "application/json", jsonObject{"type": "object"}),
+			},
+		}},
+	}
+	for p, item := range managementPaths() {
+		item.(jsonObject)["servers"] = []jsonObject{apiServer}
+		paths[p] = item
+	}
+	// /status and /status/{id} are served on both listeners; the management API requires a token of any role.
+	for _, p := range []string{"/status", "/status/{id}"} {
+		item := paths[p].(jsonObject)
+		item["servers"] = []jsonObject{metricsServer, apiServer}
+		op := item["get"].(jsonObject)
+		op["security"] = []jsonObject{{}, {"bearerAuth": []string{}}, {"sessionCookie": []string{}}}
+		op["description"] = "No authentication on metrics.listen; api.listen requires a token or session of any role. URL paths in the output are redacted."
+	}
+	schemas := jsonObject{
+		"Readiness": jsonObject{
+			"type":     "object",
+			"required": []string{"ready", "running", "expected", "required_percent"},
+			"properties": jsonObject{
+				"ready":            jsonObject{"type": "boolean"},
+				"running":          jsonObject{"type": "integer"},
+				"expected":         jsonObject{"type": "integer", "description": "Streams that should be running, excluding streams off air by schedule."},
+				"required_percent": jsonObject{"type": "number", "example": 100},
+				"draining":         jsonObject{"type": "boolean", "description": "The daemon is draining before maintenance and is never ready."},
+			},
+		},
+		"BuildInfo": jsonObject{
+			"type":     "object",
+			"required": []string{"version", "commit", "build_date", "go_version", "protocol"},
+			"properties": jsonObject{
+				"version":    jsonObject{"type": "string", "example": "1.2.0"},
+				"commit":     jsonObject{"type": "string"},
+				"build_date": jsonObject{"type": "string"},
+				"go_version": jsonObject{"type": "string", "example": "go1.21.13"},
+				"protocol":   jsonObject{"type": "integer", "description": "Version of the node-to-node interface; fleet only merges nodes with the same protocol."},
+			},
+		},
+		"StatusPage": jsonObject{
+			"type":     "object",
+			"required": []string{"total", "offset", "limit", "streams"},
+			"properties": jsonObject{
+				"total":   jsonObject{"type": "integer", "description": "Matching streams before pagination."},
+				"offset":  jsonObject{"type": "integer"},
+				"limit":   jsonObject{"type": "integer"},
+				"streams": jsonObject{"type": "array", "items": ref("StreamStatus")},
+			},
+		},
+		"StreamStatus": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "state", "restarts", "failures", "uptime_seconds", "health"},
+			"properties": jsonObject{
+				"id":             jsonObject{"type": "string"},
+				"state":          jsonObject{"type": "string", "enum": []string{"running", "backoff", "starting", "off_schedule", "stopped", "paused"}},
+				"labels":         jsonObject{"type": "object", "additionalProperties": jsonObject{"type": "string"}},
+				"region":         jsonObject{"type": "string"},
+				"dst_host":       jsonObject{"type": "string"},
+				"restarts":       jsonObject{"type": "integer"},
+				"failures":       jsonObject{"type": "integer"},
+				"uptime_seconds": jsonObject{"type": "number"},
+				"pid":            jsonObject{"type": "integer", "description": "PID of the running ffmpeg, omitted when it is not running."},
+				"started_at":     jsonObject{"type": "string", "format": "date-time", "description": "Start time of the running ffmpeg."},
+				"logs":           jsonObject{"type": "array", "items": jsonObject{"type": "string"}, "description": "Last 10 lines of ffmpeg output, only returned by /status/{id}."},
+				"outputs": jsonObject{
+					"type":        "array",
+					"description": "Per-output status, only set for streams with additional outputs. The first entry is dst.",
+					"items": jsonObject{
+						"type":     "object",
+						"required": []string{"name", "format", "state"},
+						"properties": jsonObject{
+							"name":      jsonObject{"type": "string"},
+							"format":    jsonObject{"type": "string"},
+							"dst_host":  jsonObject{"type": "string"},
+							"state":     jsonObject{"type": "string", "enum": []string{"running", "failed", "down"}},
+							"error":     jsonObject{"type": "string"},
+							"failed_at": jsonObject{"type": "string", "format": "date-time"},
+							"restarts":  jsonObject{"type": "integer", "description": "Restarts of this output alone, only with output_mode independent."},
+						},
+					},
+				},
+				"health":     jsonObject{"type": "number", "minimum": 0, "maximum": 100, "description": "Composite health score, higher is healthier."},
+				"degraded":   jsonObject{"type": "array", "items": jsonObject{"type": "string", "enum": []string{"bitrate", "fps"}}, "description": "Metrics deviating from the stream's own baseline."},
+				"expires_at": jsonObject{"type": "string", "format": "date-time", "description": "Only set for temporary streams."},
+				"platform": jsonObject{
+					"type":        "object",
+					"description": "Platform-side broadcast status, only set for streams with a platform integration.",
+					"required":    []string{"type", "healthy", "checked"},
+					"properties": jsonObject{
+						"type":    jsonObject{"type": "string", "enum": []string{"youtube", "twitch", "facebook"}},
+						"state":   jsonObject{"type": "string", "description": "Raw state reported by the platform."},
+						"healthy": jsonObject{"type": "boolean"},
+						"viewers": jsonObject{"type": "integer", "description": "Concurrent viewers, omitted when the platform does not report them."},
+						"checked": jsonObject{"type": "string", "format": "date-time"},
+						"error":   jsonObject{"type": "string", "description": "URL paths are redacted."},
+					},
+				},
+				"last_error": jsonObject{
+					"type":     "object",
+					"required": []string{"category", "message", "time"},
+					"properties": jsonObject{
+						"category": jsonObject{"type": "string", "enum": errorCategories},
+						"message":  jsonObject{"type": "string", "description": "URL paths are redacted."},
+						"time":     jsonObject{"type": "string", "format": "date-time"},
+					},
+				},
+			},
+		},
+		"InventoryStream": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "running"},
+			"properties": jsonObject{
+				"id":       jsonObject{"type": "string"},
+				"running":  jsonObject{"type": "boolean"},
+				"region":   jsonObject{"type": "string"},
+				"src_host": jsonObject{"type": "string"},
+				"dst_host": jsonObject{"type": "string"},
+				"labels":   jsonObject{"type": "object", "additionalProperties": jsonObject{"type": "string"}},
+			},
+		},
+		"FleetStatus": jsonObject{
+			"type":     "object",
+			"required": []string{"nodes", "nodes_up", "streams", "streams_running"},
+			"properties": jsonObject{
+				"nodes":           jsonObject{"type": "array", "items": ref("FleetNode")},
+				"nodes_up":        jsonObject{"type": "integer"},
+				"streams":         jsonObject{"type": "integer"},
+				"streams_running": jsonObject{"type": "integer"},
+			},
+		},
+		"FleetNode": jsonObject{
+			"type":     "object",
+			"required": []string{"name", "url", "up", "streams"},
+			"properties": jsonObject{
+				"name":      jsonObject{"type": "string"},
+				"url":       jsonObject{"type": "string"},
+				"up":        jsonObject{"type": "boolean"},
+				"rejected":  jsonObject{"type": "boolean", "description": "The node speaks another protocol version; its streams are not merged."},
+				"last_seen": jsonObject{"type": "string", "format": "date-time"},
+				"error":     jsonObject{"type": "string"},
+				"version":   jsonObject{"type": "string"},
+				"region":    jsonObject{"type": "string"},
+				"streams":   jsonObject{"type": "array", "items": ref("InventoryStream")},
+			},
+		},
+	}
+	for name, schema := range managementSchemas() {
+		schemas[name] = schema
+	}
+	return jsonObject{
+		"openapi": "3.0.3",
+		"servers": []jsonObject{metricsServer},
+		"info": jsonObject{
+			"title": "stream-runner",
+			"description": "HTTP interfaces of stream-runner. Paths without their own servers are served on metrics.listen without authentication; " +
+				"the management API on api.listen requires a bearer token from api.tokens or an SSO session, and the role noted on each operation.",
+			"version": currentBuildInfo().Version,
+		},
+		"paths": paths,
+		"components": jsonObject{
+			"schemas": schemas,
+			"securitySchemes": jsonObject{
+				"bearerAuth":    jsonObject{"type": "http", "scheme": "bearer", "description": "A token from api.tokens; its role limits the allowed operations."},
+				"sessionCookie": jsonObject{"type": "apiKey", "in": "cookie", "name": sessionCookie, "description": "SSO session created by /auth/login, used by the /ui/ dashboard."},
+			},
+		},
+	}
+}
+
+// writeOpenAPISpec 将 OpenAPI 文档以缩进 JSON 写入 w。
+func writeOpenAPISpec(w io.Writer, basePath, apiBasePath string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(openAPISpec(basePath, apiBasePath))
+}
+
+// runOpenAPI 执行 openapi 子命令，输出 HTTP 接口的 OpenAPI 文档。
+func runOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := fs.String("output", "", T("flag.output.stdout"))
+	basePath := fs.String("base-path", "", T("flag.openapi.basepath"))
+	apiBasePath := fs.String("api-base-path", "", T("flag.openapi.api_basepath"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var buf bytes.Buffer
+	if err := writeOpenAPISpec(&buf, *basePath, *apiBasePath); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] wrote %s\n", *output)
+	return 0
+}
+
+// openAPIAPIError 是管理接口返回的 JSON 错误响应。
+func openAPIAPIError(description string) jsonObject {
+	return openAPIResponse(description, "application/json", openAPIRef("APIError"))
+}
+
+// openAPIPathID 是路径中的 ID 参数定义。
+func openAPIPathID(description string) jsonObject {
+	return jsonObject{"name": "id", "in": "path", "required": true, "description": description, "schema": jsonObject{"type": "string"}}
+}
+
+// openAPIBody 返回 JSON 请求正文定义，JSON 是合法的 YAML，接受 YAML 的接口同时列出 application/yaml。
+func openAPIBody(description string, schema jsonObject, yaml bool) jsonObject {
+	content := jsonObject{"application/json": jsonObject{"schema": schema}}
+	if yaml {
+		content["application/yaml"] = jsonObject{"schema": schema}
+	}
+	return jsonObject{"description": description, "required": true, "content": content}
+}
+
+// managementOp 为管理接口的操作补上认证方式、所需角色和通用的错误响应。
+func managementOp(role string, op jsonObject) jsonObject {
+	op["tags"] = []string{"management"}
+	op["security"] = []jsonObject{{"bearerAuth": []string{}}, {"sessionCookie": []string{}}}
+	op["description"] = "Requires the " + role + " role."
+	responses := op["responses"].(jsonObject)
+	responses["401"] = openAPIAPIError("Missing or invalid token or session.")
+	responses["403"] = openAPIAPIError("The role of the token or session does not allow this operation.")
+	responses["429"] = openAPIAPIError("Rate limited by api.limits.rate.")
+	return op
+}
+
+// managementPaths 返回管理接口（newAPIMux）的路径，角色与 requiredRole 一致。
+func managementPaths() jsonObject {
+	ref := openAPIRef
+	draining := openAPIAPIError("The daemon is draining and does not start new ffmpeg processes or change the config.")
+	ifMatch := jsonObject{"name": "If-Match", "in": "header", "required": false, "description": "Only change the stream if its ETag still matches.", "schema": jsonObject{"type": "string"}}
+	streamID := openAPIPathID("Stream ID.")
+	return jsonObject{
+		"/streams": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "listStreams",
+				"summary":     "Streams in the config, sorted by ID. Temporary streams are listed by /temporary-streams.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Streams.", "application/json", jsonObject{"type": "array", "items": ref("Stream")}),
+				},
+			}),
+			"post": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "createStream",
+				"summary":     "Add a stream; fails if the ID already exists.",
+				"requestBody": openAPIBody("Stream with the streams.yml field names.", ref("Stream"), true),
+				"responses": jsonObject{
+					"201": openAPIResponse("The stream was added. The ETag header is set.", "application/json", ref("StreamWriteResult")),
+					"400": openAPIAPIError("The body is not valid JSON or YAML."),
+					"409": openAPIAPIError("A stream or temporary stream with this ID exists."),
+					"422": openAPIAPIError("The stream or the resulting config is invalid."),
+					"503": draining,
+				},
+			}),
+		},
+		"/streams/{id}": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "getStream",
+				"summary":     "One stream from the config.",
+				"parameters":  []jsonObject{streamID},
+				"responses": jsonObject{
+					"200": openAPIResponse("The stream. The ETag header is set.", "application/json", ref("Stream")),
+					"304": openAPIResponse("If-None-Match matched the current ETag.", "", nil),
+					"404": openAPIAPIError("No such stream."),
+				},
+			}),
+			"put": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "putStream",
+				"summary":     "Create or replace a stream. Repeating the same request changes nothing and does not restart ffmpeg.",
+				"parameters": []jsonObject{streamID, ifMatch,
+					{"name": "If-None-Match", "in": "header", "required": false, "description": "* to only create the stream.", "schema": jsonObject{"type": "string"}},
+				},
+				"requestBody": openAPIBody("Stream with the streams.yml field names; id may be omitted.", ref("Stream"), true),
+				"responses": jsonObject{
+					"200": openAPIResponse("The stream was created, replaced or already up to date. The ETag header is set.", "application/json", ref("StreamWriteResult")),
+					"400": openAPIAPIError("The body is not valid JSON or YAML."),
+					"409": openAPIAPIError("The ID belongs to a temporary stream."),
+					"412": openAPIAPIError("If-Match or If-None-Match did not match."),
+					"422": openAPIAPIError("The stream or the resulting config is invalid, or id does not match the path."),
+					"503": draining,
+				},
+			}),
+			"delete": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "deleteStream",
+				"summary":     "Remove a stream from the config and stop it. Removing a missing stream succeeds.",
+				"parameters":  []jsonObject{streamID, ifMatch},
+				"responses": jsonObject{
+					"200": openAPIResponse("The stream was removed, but stopping ffmpeg failed (see error).", "application/json", ref("StreamWriteResult")),
+					"204": openAPIResponse("The stream was removed or did not exist.", "", nil),
+					"409": openAPIAPIError("The ID belongs to a temporary stream."),
+					"412": openAPIAPIError("If-Match did not match."),
+				},
+			}),
+		},
+		"/streams/{id}/{action}": jsonObject{"post": managementOp(APIRoleOperator, jsonObject{
+			"operationId": "controlStream",
+			"summary":     "Restart, stop, start, pause or resume a configured or temporary stream. Stop and pause are not written to the config file.",
+			"parameters": []jsonObject{streamID,
+				{"name": "action", "in": "path", "required": true, "schema": jsonObject{"type": "string", "enum": []string{StreamActionRestart, StreamActionStop, StreamActionStart, StreamActionPause, StreamActionResume}}},
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("The new state of the stream.", "application/json", ref("StreamControl")),
+				"404": openAPIAPIError("No such stream or action."),
+				"409": openAPIAPIError("The stream is still stopping."),
+				"503": draining,
+			},
+		})},
+		"/streams/{id}/tail": jsonObject{"get": managementOp(APIRoleOperator, jsonObject{
+			"operationId": "tailStream",
+			"summary":     "Most recent ffmpeg output of a stream, unredacted.",
+			"parameters": []jsonObject{streamID,
+				openAPIQuery("lines", fmt.Sprintf("Number of lines, default %d, at most %d.", defaultTailLines, streamTailSize), jsonObject{"type": "integer", "minimum": 1}),
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("Output lines, oldest first.", "application/json", ref("StreamTail")),
+				"400": openAPIAPIError("Invalid lines."),
+				"404": openAPIAPIError("No such stream."),
+			},
+		})},
+		"/config/plan": jsonObject{"post": managementOp(APIRoleAdmin, jsonObject{
+			"operationId": "planConfig",
+			"summary":     "Validate a complete config file and report what applying it would change, without changing anything.",
+			"requestBody": jsonObject{"required": true, "content": jsonObject{"application/yaml": jsonObject{"schema": jsonObject{"type": "string"}}}},
+			"responses": jsonObject{
+				"200": openAPIResponse("The plan; check valid before applying.", "application/json", ref("ConfigPlan")),
+				"400": openAPIAPIError("The body could not be read."),
+			},
+		})},
+		"/config/apply": jsonObject{"post": managementOp(APIRoleAdmin, jsonObject{
+			"operationId": "applyConfig",
+			"summary":     "Write the planned config file and reload it. The body must be the document that was planned.",
+			"parameters": []jsonObject{
+				{"name": "plan", "in": "query", "required": true, "description": "plan_id returned by /config/plan.", "schema": jsonObject{"type": "string"}},
+			},
+			"requestBody": jsonObject{"required": true, "content": jsonObject{"application/yaml": jsonObject{"schema": jsonObject{"type": "string"}}}},
+			"responses": jsonObject{
+				"200": openAPIResponse("The config was applied.", "application/json", ref("ConfigPlan")),
+				"400": openAPIAPIError("plan is missing or the body could not be read."),
+				"409": openAPIAPIError("The document or the config file changed since the plan."),
+				"422": openAPIResponse("The config is invalid.", "application/json", ref("ConfigPlan")),
+				"500": openAPIAPIError("Writing or reloading the config failed."),
+				"503": draining,
+			},
+		})},
+		"/temporary-streams": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "listTemporaryStreams",
+				"summary":     "Temporary streams, sorted by ID.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Temporary streams.", "application/json", jsonObject{"type": "array", "items": ref("TemporaryStream")}),
+				},
+			}),
+			"post": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "createTemporaryStream",
+				"summary":     "Start a stream that is removed after ttl and never written to the config file.",
+				"requestBody": openAPIBody("Stream with the streams.yml field names and a ttl such as 2h.", ref("TemporaryStreamRequest"), true),
+				"responses": jsonObject{
+					"201": openAPIResponse("The temporary stream was started.", "application/json", ref("TemporaryStream")),
+					"400": openAPIAPIError("The body is not valid JSON or YAML."),
+					"409": openAPIAPIError("A stream with this ID exists."),
+					"422": openAPIAPIError("The stream or ttl is invalid."),
+					"503": draining,
+				},
+			}),
+		},
+		"/temporary-streams/{id}": jsonObject{"delete": managementOp(APIRoleOperator, jsonObject{
+			"operationId": "deleteTemporaryStream",
+			"summary":     "Stop and remove a temporary stream. Removing a missing stream succeeds.",
+			"parameters":  []jsonObject{streamID},
+			"responses": jsonObject{
+				"204": openAPIResponse("The temporary stream was removed or did not exist.", "", nil),
+				"409": openAPIAPIError("The stream is in the config, not temporary."),
+			},
+		})},
+		"/jobs": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "listJobs",
+				"summary":     "Transcoding and archive jobs, in submission order.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Jobs.", "application/json", jsonObject{"type": "array", "items": ref("Job")}),
+					"404": openAPIAPIError("jobs is not configured."),
+				},
+			}),
+			"post": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "submitJob",
+				"summary":     "Queue a one-off ffmpeg job.",
+				"requestBody": openAPIBody("Job.", ref("JobRequest"), false),
+				"responses": jsonObject{
+					"202": openAPIResponse("The job was queued.", "application/json", ref("Job")),
+					"400": openAPIAPIError("The body is not valid JSON."),
+					"404": openAPIAPIError("jobs is not configured."),
+					"422": openAPIAPIError("The job is invalid or the queue is full."),
+					"503": draining,
+				},
+			}),
+		},
+		"/jobs/{id}": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "getJob",
+				"summary":     "One job.",
+				"parameters":  []jsonObject{openAPIPathID("Job ID.")},
+				"responses": jsonObject{
+					"200": openAPIResponse("The job.", "application/json", ref("Job")),
+					"404": openAPIAPIError("No such job, or jobs is not configured."),
+				},
+			}),
+			"delete": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "cancelJob",
+				"summary":     "Cancel a queued or running job, or forget a finished one. Deleting a missing job succeeds.",
+				"parameters":  []jsonObject{openAPIPathID("Job ID.")},
+				"responses": jsonObject{
+					"204": openAPIResponse("The job was canceled or removed.", "", nil),
+					"404": openAPIAPIError("jobs is not configured."),
+				},
+			}),
+		},
+		"/drain": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "getDrain",
+				"summary":     "Progress of the current drain.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Drain status; draining is false when no drain is in progress.", "application/json", ref("DrainStatus")),
+				},
+			}),
+			"post": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "startDrain",
+				"summary":     "Stop starting new streams and stop the running ones before maintenance.",
+				"requestBody": openAPIBody("Drain options.", ref("DrainRequest"), true),
+				"responses": jsonObject{
+					"202": openAPIResponse("The drain started.", "application/json", ref("DrainStatus")),
+					"400": openAPIAPIError("Invalid options."),
+					"409": openAPIAPIError("A drain is already in progress."),
+				},
+			}),
+			"delete": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "cancelDrain",
+				"summary":     "Cancel the drain and restart the drained streams.",
+				"responses": jsonObject{
+					"200": openAPIResponse("The drain was canceled.", "application/json", ref("DrainStatus")),
+					"409": openAPIAPIError("No drain is in progress."),
+				},
+			}),
+		},
+		"/log-level": jsonObject{
+			"get": managementOp(APIRoleOperator, jsonObject{
+				"operationId": "getLogLevel",
+				"summary":     "Current and configured log level.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Log level.", "application/json", ref("LogLevel")),
+				},
+			}),
+			"put": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "setLogLevel",
+				"summary":     "Override the log level until the next reset or restart.",
+				"requestBody": openAPIBody("Level.", jsonObject{
+					"type":       "object",
+					"required":   []string{"level"},
+					"properties": jsonObject{"level": jsonObject{"type": "string", "enum": []string{"debug", "info", "warn", "error"}}},
+				}, true),
+				"responses": jsonObject{
+					"200": openAPIResponse("The new log level.", "application/json", ref("LogLevel")),
+					"400": openAPIAPIError("Invalid level."),
+				},
+			}),
+			"delete": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "resetLogLevel",
+				"summary":     "Return to the configured log level.",
+				"responses": jsonObject{
+					"200": openAPIResponse("The configured log level.", "application/json", ref("LogLevel")),
+				},
+			}),
+		},
+		"/logs": jsonObject{"get": managementOp(APIRoleOperator, jsonObject{
+			"operationId": "getLogs",
+			"summary":     "Recent daemon logs and ffmpeg output from the metrics.log_buffer ring buffer, oldest first.",
+			"parameters": []jsonObject{
+				openAPIQuery("level", "Minimum level.", jsonObject{"type": "string", "enum": []string{"debug", "info", "warn", "error"}}),
+				openAPIQuery("stream", "Only records of this stream.", jsonObject{"type": "string"}),
+				openAPIQuery("limit", "Only the newest records, 0 for all.", jsonObject{"type": "integer", "minimum": 0}),
+			},
+			"responses": jsonObject{
+				"200": openAPIResponse("One JSON log record per line.", "application/x-ndjson", jsonObject{"type": "string"}),
+				"400": openAPIError("Invalid level or limit."),
+				"404": openAPIError("metrics.log_buffer is not configured."),
+			},
+		})},
+		"/events": jsonObject{"get": managementOp(APIRoleOperator, jsonObject{
+			"operationId": "watchEvents",
+			"summary":     "WebSocket pushing one LifecycleEvent as JSON per text message. Browsers are only allowed from the same origin.",
+			"parameters": []jsonObject{
+				openAPIQuery("stream", "Comma-separated stream IDs to subscribe to, all streams by default.", jsonObject{"type": "string"}),
+			},
+			"responses": jsonObject{
+				"101": openAPIResponse("Switched to WebSocket. A subscriber that falls 256 events behind is closed with status 1008.", "", nil),
+				"400": openAPIError("Invalid Sec-WebSocket-Key."),
+				"426": openAPIError("Not a WebSocket upgrade."),
+			},
+		})},
+		"/purge/{id}": jsonObject{"post": managementOp(APIRoleAdmin, jsonObject{
+			"operationId": "purgeStream",
+			"summary":     "Delete the logs, recordings, report records and jobs of a stopped or removed stream.",
+			"parameters":  []jsonObject{streamID},
+			"requestBody": openAPIBody("Confirmation repeating the stream ID.", jsonObject{
+				"type":       "object",
+				"required":   []string{"confirm"},
+				"properties": jsonObject{"confirm": jsonObject{"type": "string"}},
+			}, true),
+			"responses": jsonObject{
+				"200": openAPIResponse("What was deleted.", "application/json", ref("PurgeResult")),
+				"400": openAPIAPIError("confirm does not repeat the stream ID."),
+				"409": openAPIAPIError("The stream is running."),
+				"500": openAPIAPIError("Some data could not be deleted."),
+			},
+		})},
+		"/sessions": jsonObject{
+			"get": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "listSessions",
+				"summary":     "Active SSO sessions.",
+				"responses": jsonObject{
+					"200": openAPIResponse("Sessions.", "application/json", jsonObject{"type": "array", "items": ref("Session")}),
+				},
+			}),
+			"delete": managementOp(APIRoleAdmin, jsonObject{
+				"operationId": "revokeUserSessions",
+				"summary":     "Revoke every session of a user.",
+				"parameters": []jsonObject{
+					{"name": "user", "in": "query", "required": true, "schema": jsonObject{"type": "string"}},
+				},
+				"responses": jsonObject{
+					"204": openAPIResponse("The sessions were revoked.", "", nil),
+					"400": openAPIAPIError("user is missing."),
+				},
+			}),
+		},
+		"/sessions/{id}": jsonObject{"delete": managementOp(APIRoleAdmin, jsonObject{
+			"operationId": "revokeSession",
+			"summary":     "Revoke one SSO session.",
+			"parameters":  []jsonObject{openAPIPathID("Session ID.")},
+			"responses": jsonObject{
+				"204": openAPIResponse("The session was revoked or did not exist.", "", nil),
+			},
+		})},
+	}
+}
+
+// managementSchemas 返回管理接口使用的数据结构。
+func managementSchemas() jsonObject {
+	ref := openAPIRef
+	timestamp := jsonObject{"type": "string", "format": "date-time"}
+	stringList := jsonObject{"type": "array", "items": jsonObject{"type": "string"}}
+	return jsonObject{
+		"APIError": jsonObject{
+			"type":       "object",
+			"required":   []string{"error"},
+			"properties": jsonObject{"error": jsonObject{"type": "string"}},
+		},
+		"Stream": jsonObject{
+			"type":                 "object",
+			"description":          "A stream with the same fields as in streams.yml. PUT replaces the whole stream, so send every field to keep.",
+			"required":             []string{"id"},
+			"additionalProperties": true,
+			"properties": jsonObject{
+				"id":           jsonObject{"type": "string"},
+				"src":          jsonObject{"type": "string"},
+				"dst":          jsonObject{"type": "string"},
+				"renamed_from": stringList,
+			},
+		},
+		"StreamWriteResult": jsonObject{
+			"type":     "object",
+			"required": []string{"changed"},
+			"properties": jsonObject{
+				"changed": jsonObject{"type": "boolean", "description": "The request changed the config."},
+				"stream":  ref("Stream"),
+				"error":   jsonObject{"type": "string", "description": "The change is in effect, but stopping or restarting ffmpeg failed; do not retry or roll back."},
+			},
+		},
+		"StreamControl": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "state"},
+			"properties": jsonObject{
+				"id":    jsonObject{"type": "string"},
+				"state": jsonObject{"type": "string", "enum": []string{"running", "backoff", "starting", "off_schedule", "stopped", "paused"}},
+			},
+		},
+		"StreamTail": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "lines"},
+			"properties": jsonObject{
+				"id":    jsonObject{"type": "string"},
+				"lines": stringList,
+			},
+		},
+		"ConfigPlan": jsonObject{
+			"type":     "object",
+			"required": []string{"valid", "plan_id", "streams", "summary"},
+			"properties": jsonObject{
+				"valid":   jsonObject{"type": "boolean"},
+				"plan_id": jsonObject{"type": "string", "description": "Identifies the planned document and the config file at the time; pass it to /config/apply."},
+				"errors":  jsonObject{"type": "array", "items": jsonObject{"type": "string"}, "description": "Errors not tied to one stream, such as YAML syntax or global settings."},
+				"streams": jsonObject{"type": "array", "items": jsonObject{
+					"type":     "object",
+					"required": []string{"id", "action"},
+					"properties": jsonObject{
+						"id":          jsonObject{"type": "string"},
+						"action":      jsonObject{"type": "string", "enum": []string{ImportActionAdd, ImportActionUpdate, ImportActionRename, ImportActionUnchanged, ImportActionRemove, "invalid"}},
+						"previous_id": jsonObject{"type": "string"},
+						"changed":     jsonObject{"type": "array", "items": jsonObject{"type": "string"}, "description": "Fields that restart ffmpeg."},
+						"error":       jsonObject{"type": "string"},
+					},
+				}},
+				"summary": jsonObject{"type": "object", "additionalProperties": jsonObject{"type": "integer"}, "description": "Number of streams per action."},
+			},
+		},
+		"TemporaryStreamRequest": jsonObject{
+			"allOf": []jsonObject{ref("Stream"), {
+				"type":       "object",
+				"required":   []string{"ttl"},
+				"properties": jsonObject{"ttl": jsonObject{"type": "string", "example": "2h"}},
+			}},
+		},
+		"TemporaryStream": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "created_at", "expires_at"},
+			"properties": jsonObject{
+				"id":         jsonObject{"type": "string"},
+				"dst_host":   jsonObject{"type": "string"},
+				"created_at": timestamp,
+				"expires_at": timestamp,
+			},
+		},
+		"JobRequest": jsonObject{
+			"type":     "object",
+			"required": []string{"input", "output"},
+			"properties": jsonObject{
+				"input":     jsonObject{"type": "string", "description": "Absolute path or rtmp/http/srt URL."},
+				"output":    jsonObject{"type": "string", "description": "Absolute path under jobs.dirs; the extension selects the container."},
+				"profile":   jsonObject{"type": "string", "description": "Transcoding profile, remux only when empty."},
+				"overwrite": jsonObject{"type": "boolean"},
+			},
+		},
+		"Job": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "input", "output", "state", "progress", "created_at"},
+			"properties": jsonObject{
+				"id":        jsonObject{"type": "string"},
+				"kind":      jsonObject{"type": "string", "description": "Empty for ffmpeg jobs, archive for recording uploads."},
+				"stream_id": jsonObject{"type": "string"},
+				"input":     jsonObject{"type": "string"},
+				"output":    jsonObject{"type": "string"},
+				"profile":   jsonObject{"type": "string"},
+				"state":     jsonObject{"type": "string", "enum": []string{JobQueued, JobRunning, JobSucceeded, JobFailed, JobCanceled}},
+				"error":     jsonObject{"type": "string"},
+				"progress": jsonObject{
+					"type":     "object",
+					"required": []string{"out_time_seconds", "speed", "size_bytes"},
+					"properties": jsonObject{
+						"out_time_seconds": jsonObject{"type": "number"},
+						"duration_seconds": jsonObject{"type": "number"},
+						"percent":          jsonObject{"type": "number"},
+						"speed":            jsonObject{"type": "number"},
+						"size_bytes":       jsonObject{"type": "integer"},
+					},
+				},
+				"created_at":  timestamp,
+				"started_at":  timestamp,
+				"finished_at": timestamp,
+			},
+		},
+		"DrainRequest": jsonObject{
+			"type": "object",
+			"properties": jsonObject{
+				"wait":    jsonObject{"type": "string", "enum": []string{"none", "schedule"}, "description": "Wait for each stream's scheduled end, default schedule."},
+				"timeout": jsonObject{"type": "string", "example": "2h", "description": "Stop the remaining streams after this long, default 1h."},
+			},
+		},
+		"DrainStatus": jsonObject{
+			"type":     "object",
+			"required": []string{"draining"},
+			"properties": jsonObject{
+				"draining":     jsonObject{"type": "boolean"},
+				"wait":         jsonObject{"type": "string"},
+				"started_at":   timestamp,
+				"deadline":     timestamp,
+				"completed_at": timestamp,
+				"remaining":    stringList,
+				"drained":      stringList,
+			},
+		},
+		"LogLevel": jsonObject{
+			"type":     "object",
+			"required": []string{"level", "configured", "override"},
+			"properties": jsonObject{
+				"level":      jsonObject{"type": "string"},
+				"configured": jsonObject{"type": "string"},
+				"override":   jsonObject{"type": "boolean", "description": "The level was set at runtime."},
+			},
+		},
+		"LifecycleEvent": jsonObject{
+			"type":        "object",
+			"description": "Message pushed by /events.",
+			"required":    []string{"type", "stream_id", "time", "retries"},
+			"properties": jsonObject{
+				"type":      jsonObject{"type": "string", "enum": []string{LifecycleStarting, LifecycleStarted, LifecycleExited, LifecycleRestarting, LifecycleKilled}},
+				"stream_id": jsonObject{"type": "string"},
+				"time":      timestamp,
+				"exit_code": jsonObject{"type": "integer", "description": "Only in exited; -1 when ffmpeg was killed by a signal, omitted when it failed to start."},
+				"retries":   jsonObject{"type": "integer", "description": "Restarts since the first start."},
+				"retry_in":  jsonObject{"type": "string", "description": "Only in restarting."},
+				"error":     jsonObject{"type": "string"},
+			},
+		},
+		"PurgeResult": jsonObject{
+			"type":     "object",
+			"required": []string{"stream_id", "log_records", "buffered_logs", "report_records", "jobs"},
+			"properties": jsonObject{
+				"stream_id":      jsonObject{"type": "string"},
+				"log_records":    jsonObject{"type": "integer"},
+				"buffered_logs":  jsonObject{"type": "integer"},
+				"recordings":     stringList,
+				"report_records": jsonObject{"type": "integer"},
+				"jobs":           jsonObject{"type": "integer"},
+				"config_copies":  stringList,
+				"notes":          stringList,
+			},
+		},
+		"Session": jsonObject{
+			"type":     "object",
+			"required": []string{"id", "user", "subject", "role", "created", "last_seen", "expires"},
+			"properties": jsonObject{
+				"id":        jsonObject{"type": "string"},
+				"user":      jsonObject{"type": "string"},
+				"subject":   jsonObject{"type": "string"},
+				"role":      jsonObject{"type": "string", "enum": []string{APIRoleReadOnly, APIRoleOperator, APIRoleAdmin}},
+				"groups":    stringList,
+				"addr":      jsonObject{"type": "string"},
+				"created":   timestamp,
+				"last_seen": timestamp,
+				"expires":   timestamp,
+			},
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPISpec 测试文档中的每个路径都已在对应的服务中注册，管理接口的操作都声明了认证方式，且 /openapi.json 返回合法 JSON
+func TestOpenAPISpec(t *testing.T) {
+	state := &AppState{workers: newWorkerMap(nil)}
+	mux := newMetricsMux(state, "")
+	apiMux := newAPIMux(state)
+	paths := openAPISpec("", "/runner")["paths"].(jsonObject)
+	for p, item := range paths {
+		servers, _ := item.(jsonObject)["servers"].([]jsonObject)
+		muxes := map[string]*http.ServeMux{"metrics.listen": mux}
+		if servers != nil {
+			muxes = map[string]*http.ServeMux{}
+			for _, s := range servers {
+				switch s["description"] {
+				case "metrics.listen":
+					muxes["metrics.listen"] = mux
+				case "api.listen":
+					muxes["api.listen"] = apiMux
+					if url := s["url"].(string); url != "{api}/runner" {
+						t.Errorf("%s: unexpected api server url %q", p, url)
+					}
+				}
+			}
+		}
+		// A path with a parameter, such as /status/{id}, is served by the subtree pattern /status/.
+		want, _, param := strings.Cut(p, "{")
+		if !param {
+			want = p
+		}
+		target := strings.NewReplacer("{id}", "x", "{action}", StreamActionRestart).Replace(p)
+		for name, m := range muxes {
+			if _, pattern := m.Handler(httptest.NewRequest(http.MethodGet, target, nil)); pattern != want {
+				t.Errorf("documented path %s is not registered on %s (matched %q)", p, name, pattern)
+			}
+			if name != "api.listen" {
+				continue
+			}
+			for method, op := range item.(jsonObject) {
+				if method == "servers" {
+					continue
+				}
+				if _, ok := op.(jsonObject)["security"]; !ok {
+					t.Errorf("%s %s on the management api has no security requirement", method, p)
+				}
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid openapi json: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) != len(paths) {
+		t.Errorf("unexpected document: openapi=%q paths=%d", doc.OpenAPI, len(doc.Paths))
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case jsonObject:
+			if typ, ok := v["type"].(string); ok && !containsString([]string{"object", "array", "string", "integer", "number", "boolean"}, typ) {
+				t.Errorf("invalid schema type %q", typ)
+			}
+			for key, child := range v {
+				// Security schemes have a type too, but not a schema type.
+				if key != "securitySchemes" {
+					walk(child)
+				}
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var raw any
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	walk(raw)
+}
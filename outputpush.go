@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 附加输出的推送方式。
+const (
+	// OutputModeTee 表示所有输出由同一个 ffmpeg 通过 tee 封装推送，附加输出失败后等 ffmpeg 重启才重新连接。
+	OutputModeTee = "tee"
+	// OutputModeIndependent 表示每路附加输出由独立的 ffmpeg 推送，从主 ffmpeg 输出的本地 MPEG-TS 流读取数据，
+	// 失败时只重启该输出；dst 重启时其他输出的连接保持，只短暂中断数据。
+	OutputModeIndependent = "independent"
+)
+
+const (
+	// outputFeedChunks 是每路附加输出缓冲的数据块数，推送跟不上时丢弃新的数据块。
+	outputFeedChunks = 256
+	// outputFeedChunkSize 是从主 ffmpeg 读取本地流的块大小。
+	outputFeedChunkSize = 32 << 10
+	// maxOutputRestartDelay 是附加输出连续失败时的最长重启间隔。
+	maxOutputRestartDelay = time.Minute
+	// outputStableAfter 是附加输出持续运行多久后重置重启间隔。
+	outputStableAfter = time.Minute
+)
+
+// independentOutputs 判断流的附加输出是否由独立的 ffmpeg 推送。
+func independentOutputs(cfg StreamConfig) bool {
+	return len(cfg.Outputs) > 0 && cfg.OutputMode == OutputModeIndependent
+}
+
+// outputFeed 把主 ffmpeg 输出的本地 MPEG-TS 流分发给各路附加输出的推送进程。
+// 跨主 ffmpeg 的多次运行保留，推送进程在主 ffmpeg 重启期间等待新的数据，不断开与目标的连接。
+type outputFeed struct {
+	mu   sync.Mutex
+	subs map[*feedSub]bool
+}
+
+// feedSub 是一个推送进程的订阅。
+type feedSub struct {
+	ch chan []byte
+	// dropped 是因推送跟不上而丢弃的数据块数。
+	dropped atomic.Int64
+}
+
+// subscribe 订阅本地流。
+func (f *outputFeed) subscribe() *feedSub {
+	s := &feedSub{ch: make(chan []byte, outputFeedChunks)}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*feedSub]bool)
+	}
+	f.subs[s] = true
+	return s
+}
+
+// unsubscribe 取消订阅。
+func (f *outputFeed) unsubscribe(s *feedSub) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, s)
+}
+
+// broadcast 把一块数据发给所有订阅，不等待推送慢的订阅。MPEG-TS 按包同步，丢弃的数据块只造成短暂的花屏。
+func (f *outputFeed) broadcast(chunk []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		select {
+		case s.ch <- chunk:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// copyFrom 读取主 ffmpeg 一次运行输出的本地流直到结束。
+func (f *outputFeed) copyFrom(r io.ReadCloser) {
+	defer r.Close()
+	for {
+		buf := make([]byte, outputFeedChunkSize)
+		n, err := r.Read(buf)
+		if n > 0 {
+			f.broadcast(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// attachOutputFeed 让主 ffmpeg 把本地流写到 fd 3（pipe:3），返回在 ffmpeg 启动后调用的函数：
+// started 为 true 时开始分发，否则只关闭管道。
+func attachOutputFeed(cmd *exec.Cmd, feed *outputFeed) (func(started bool), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.ExtraFiles = []*os.File{w}
+	return func(started bool) {
+		// The child holds its own copy; closing ours lets the reader see EOF when ffmpeg exits.
+		w.Close()
+		if !started {
+			r.Close()
+			return
+		}
+		go feed.copyFrom(r)
+	}, nil
+}
+
+// outputPushers 是一路流的附加输出推送进程。
+type outputPushers struct {
+	feed    outputFeed
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	pushers []*outputPusher
+}
+
+// startOutputPushers 为 cfg 的每路附加输出启动推送进程。
+func startOutputPushers(cfg StreamConfig) *outputPushers {
+	ctx, cancel := context.WithCancel(context.Background())
+	ps := &outputPushers{cancel: cancel}
+	for _, o := range cfg.Outputs {
+		p := &outputPusher{cfg: cfg, out: o, feed: &ps.feed}
+		ps.pushers = append(ps.pushers, p)
+		ps.wg.Add(1)
+		go func() {
+			defer ps.wg.Done()
+			p.run(ctx)
+		}()
+	}
+	return ps
+}
+
+// stop 停止所有推送进程并等待其退出。
+func (ps *outputPushers) stop() {
+	ps.cancel()
+	ps.wg.Wait()
+}
+
+// outputPusher 推送一路附加输出，推送进程退出后按退避间隔单独重启。
+type outputPusher struct {
+	cfg  StreamConfig
+	out  StreamOutput
+	feed *outputFeed
+
+	mu       sync.Mutex
+	running  bool
+	restarts int64
+	lastErr  string
+	failedAt time.Time
+}
+
+// logID 是推送进程日志中的流 ID，如 news/srt-backup。
+func (p *outputPusher) logID() string {
+	return p.cfg.ID + "/" + p.out.Name
+}
+
+// pushArgs 返回推送进程的参数：从标准输入读取本地流，原样复制到输出。
+func pushArgs(cfg StreamConfig, o StreamOutput) []string {
+	args := []string{"-f", "mpegts", "-i", "pipe:0", "-map", "0", "-c", "copy", "-f", o.format()}
+	if whitelist := protocolWhitelist(cfg); whitelist != "" {
+		args = append(args, "-protocol_whitelist", whitelist)
+	}
+	keys := make([]string, 0, len(o.Options))
+	for k := range o.Options {
+		keys = append(keys, k)
+	}
+	// Sorted for stable command lines across restarts.
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-"+k, o.Options[k])
+	}
+	return append(args, o.target())
+}
+
+// run 运行推送进程，退出后重启，直到 ctx 取消。
+func (p *outputPusher) run(ctx context.Context) {
+	delay := currentSettings().RestartDelay
+	for {
+		started := time.Now()
+		err := p.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("ffmpeg exited")
+		}
+		if time.Since(started) >= outputStableAfter {
+			delay = currentSettings().RestartDelay
+		}
+		p.mu.Lock()
+		p.restarts++
+		p.lastErr, p.failedAt = err.Error(), time.Now()
+		p.mu.Unlock()
+		slog.Warn("output failed, restarting only this output", "stream_id", p.cfg.ID, "output", p.out.Name, "error", err, "retry_in", delay)
+		emitEvent(p.cfg.ID, "output_failed", p.out.Name, err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxOutputRestartDelay)
+	}
+}
+
+// runOnce 启动一次推送进程并等待其退出，ctx 取消时终止进程。
+func (p *outputPusher) runOnce(ctx context.Context) error {
+	cmd, err := newFFmpegCommand(p.cfg, pushArgs(p.cfg, p.out))
+	if err != nil {
+		return err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = &StreamLogWriter{streamID: p.logID(), writer: os.Stderr}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.running = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+	}()
+
+	exited := make(chan struct{})
+	stopFeed := make(chan struct{})
+	sub := p.feed.subscribe()
+	go func() {
+		defer p.feed.unsubscribe(sub)
+		defer stdin.Close()
+		for {
+			select {
+			case chunk := <-sub.ch:
+				if _, err := stdin.Write(chunk); err != nil {
+					return
+				}
+			case <-stopFeed:
+				return
+			}
+		}
+	}()
+	stopOnCancel := context.AfterFunc(ctx, func() {
+		if err := terminateProcess(p.logID(), cmd.Process.Pid, exited, currentSettings().StopTimeout); err != nil {
+			slog.Error("failed to stop output", "stream_id", p.cfg.ID, "output", p.out.Name, "error", err)
+		}
+	})
+	defer stopOnCancel()
+	err = cmd.Wait()
+	close(exited)
+	close(stopFeed)
+	if n := sub.dropped.Load(); n > 0 {
+		slog.Warn("output could not keep up, data dropped", "stream_id", p.cfg.ID, "output", p.out.Name, "chunks", n)
+	}
+	return err
+}
+
+// status 返回推送进程的状态。
+func (p *outputPusher) status() outputStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := outputStatus{Name: p.out.Name, Format: p.out.format(), DstHost: endpointHost(p.out.target()), Restarts: p.restarts}
+	switch {
+	case p.running:
+		s.State = OutputStateRunning
+	case p.lastErr != "":
+		t := p.failedAt
+		s.State, s.Error, s.FailedAt = OutputStateFailed, redactURLs(p.lastErr), &t
+	default:
+		s.State = OutputStateDown
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOutputPushers 测试独立推送的附加输出从本地流读取数据，一路失败时只重启该路，另一路不受影响。
+func TestOutputPushers(t *testing.T) {
+	dir := t.TempDir()
+	// The fake copies its input to the output path and fails once for the flaky output.
+	script := "#!/bin/sh\nfor a; do last=$a; done\ncase $last in *flaky) [ -e $last.failed ] || { touch $last.failed; exit 1; };; esac\nexec cat >> $last\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	prev := runtimeSettings.Swap(&Settings{RestartDelay: 10 * time.Millisecond, StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+
+	stable, flaky := filepath.Join(dir, "stable"), filepath.Join(dir, "flaky")
+	cfg := StreamConfig{ID: "news", OutputMode: OutputModeIndependent, Outputs: []StreamOutput{
+		{Name: "stable", Dst: stable, Format: "mpegts"},
+		{Name: "flaky", Dst: flaky, Format: "mpegts"},
+	}}
+	ps := startOutputPushers(cfg)
+	defer ps.stop()
+
+	received := func(path string) bool {
+		data, _ := os.ReadFile(path)
+		return len(data) > 0
+	}
+	waitFor(t, "both outputs to receive the feed", func() bool {
+		ps.feed.broadcast([]byte("ts"))
+		return received(stable) && received(flaky)
+	})
+	if s := ps.pushers[0].status(); s.State != OutputStateRunning || s.Restarts != 0 {
+		t.Errorf("stable output = %+v", s)
+	}
+	if s := ps.pushers[1].status(); s.State != OutputStateRunning || s.Restarts != 1 {
+		t.Errorf("flaky output = %+v", s)
+	}
+
+	cfg.Dst = "rtmp://dest.com/live/key"
+	mainArgs := buildFFmpegArgs(cfg, &resolvedEndpoints{Dst: cfg.Dst}, outputPlan{Format: "flv"})
+	if got := mainArgs[len(mainArgs)-1]; got != "[f=flv]rtmp://dest.com/live/key|[f=mpegts:onfail=ignore]pipe:3" {
+		t.Errorf("main ffmpeg outputs = %s", got)
+	}
+	args := strings.Join(pushArgs(cfg, cfg.Outputs[0]), " ")
+	if !strings.HasPrefix(args, "-f mpegts -i pipe:0 -map 0 -c copy -f mpegts") || !strings.HasSuffix(args, stable) {
+		t.Errorf("push args = %s", args)
+	}
+}
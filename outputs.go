@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// primaryOutputName 是状态和指标中 dst 这一路输出的名称。
+const primaryOutputName = "primary"
+
+// 附加输出的状态。
+const (
+	// OutputStateRunning 表示输出正在推送。
+	OutputStateRunning = "running"
+	// OutputStateFailed 表示输出在当前 ffmpeg 进程中已失败，其他输出继续推送，下次启动 ffmpeg 时重新连接。
+	OutputStateFailed = "failed"
+	// OutputStateDown 表示 ffmpeg 未运行。
+	OutputStateDown = "down"
+)
+
+// StreamOutput 是流除 dst 之外的一路附加输出，如 SRT 或 HLS 目录。同一个 ffmpeg 进程通过 tee 封装同时推送所有输出：
+// 附加输出失败时只停止该输出，dst 失败时 ffmpeg 退出并按原有逻辑重启。
+type StreamOutput struct {
+	// Name 是输出的名称，在状态和指标中标识该输出。
+	Name string `yaml:"name"`
+	// Dst 是输出地址，如 srt://host:port、rtmp://host/app/key 或 HLS 播放列表路径（/var/www/hls/a/index.m3u8）。
+	// 以 / 结尾的本地目录按 HLS 输出到该目录下的 index.m3u8。
+	Dst string `yaml:"dst"`
+	// Format 是输出封装格式（可选），为空时根据地址推断。
+	Format string `yaml:"format,omitempty"`
+	// Options 是传给该输出封装的选项（可选），如 HLS 的 hls_time、hls_list_size、hls_flags。
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// validate 校验附加输出配置。
+func (o *StreamOutput) validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if o.Name == primaryOutputName {
+		return fmt.Errorf("name %q is reserved for dst", primaryOutputName)
+	}
+	if o.Dst == "" {
+		return fmt.Errorf("dst is required")
+	}
+	if strings.ContainsAny(o.Dst, " \t\n") {
+		return fmt.Errorf("dst must not contain whitespace")
+	}
+	for k := range o.Options {
+		if k == "" || strings.ContainsAny(k, "=:[]|\\' \t\n") {
+			return fmt.Errorf("invalid option name %q", k)
+		}
+		if k == "f" || k == "onfail" {
+			return fmt.Errorf("option %q is set by stream-runner", k)
+		}
+	}
+	return nil
+}
+
+// target 返回 ffmpeg 使用的输出地址，HLS 目录补上 index.m3u8。
+func (o StreamOutput) target() string {
+	if strings.HasSuffix(o.Dst, "/") && !strings.Contains(o.Dst, "://") {
+		return o.Dst + "index.m3u8"
+	}
+	return o.Dst
+}
+
+// format 返回输出的封装格式。
+func (o StreamOutput) format() string {
+	if o.Format != "" {
+		return o.Format
+	}
+	return formatForDst(o.target())
+}
+
+// validateOutputs 校验流的附加输出，名称不能重复。
+func validateOutputs(outputs []StreamOutput) error {
+	names := make(map[string]bool, len(outputs))
+	for i := range outputs {
+		if err := outputs[i].validate(); err != nil {
+			return fmt.Errorf("outputs[%d]: %w", i, err)
+		}
+		if names[outputs[i].Name] {
+			return fmt.Errorf("outputs[%d]: duplicate name %q", i, outputs[i].Name)
+		}
+		names[outputs[i].Name] = true
+	}
+	return nil
+}
+
+// outputFormats 返回流所有输出的封装格式，第一个是 dst。
+func outputFormats(cfg StreamConfig) []string {
+	formats := []string{outputFormat(cfg)}
+	for _, o := range cfg.Outputs {
+		formats = append(formats, o.format())
+	}
+	return formats
+}
+
+// checkOutputsFFmpegVersion 对流的每种输出封装检查当前 ffmpeg 的版本。
+func checkOutputsFFmpegVersion(cfg StreamConfig, plan outputPlan) error {
+	formats := []string{plan.Format}
+	for _, o := range cfg.Outputs {
+		formats = append(formats, o.format())
+	}
+	for _, format := range formats {
+		if err := checkFFmpegVersion(cfg.ID, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareOutputs 为本地文件输出（如 HLS）创建目录。
+func prepareOutputs(cfg StreamConfig) error {
+	for _, o := range cfg.Outputs {
+		target := o.target()
+		if strings.Contains(target, "://") {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("output %s: %w", o.Name, err)
+		}
+	}
+	return nil
+}
+
+// teeArgs 返回通过 tee 封装同时推送 dst 和附加输出的参数。dst 的协议选项（出口地址、tcUrl）作为该输出的选项传入；
+// 附加输出设置 onfail=ignore，失败时不影响其他输出。
+func teeArgs(cfg StreamConfig, ep *resolvedEndpoints, plan outputPlan, whitelist string) []string {
+	format := plan.Format
+	if format == "" {
+		format = "flv"
+	}
+	primary := [][2]string{{"f", format}}
+	if whitelist != "" {
+		primary = append(primary, [2]string{"protocol_whitelist", whitelist})
+	}
+	if ep.DstAddr != "" {
+		primary = append(primary, [2]string{"local_addr", ep.DstAddr})
+	}
+	if ep.DstTCURL != "" {
+		primary = append(primary, [2]string{"rtmp_tcurl", ep.DstTCURL})
+	}
+	slaves := []string{teeSlave(primary, ep.Dst)}
+	if independentOutputs(cfg) {
+		// Additional outputs are pushed by their own processes from the local feed on fd 3.
+		feed := [][2]string{{"f", "mpegts"}, {"onfail", "ignore"}}
+		if whitelist != "" {
+			feed = append(feed, [2]string{"protocol_whitelist", "pipe"})
+		}
+		slaves = append(slaves, teeSlave(feed, "pipe:3"))
+	}
+	for _, o := range cfg.Outputs {
+		if independentOutputs(cfg) {
+			break
+		}
+		opts := [][2]string{{"f", o.format()}, {"onfail", "ignore"}}
+		if whitelist != "" {
+			opts = append(opts, [2]string{"protocol_whitelist", whitelist})
+		}
+		keys := make([]string, 0, len(o.Options))
+		for k := range o.Options {
+			keys = append(keys, k)
+		}
+		// Sorted for stable command lines across restarts.
+		sort.Strings(keys)
+		for _, k := range keys {
+			opts = append(opts, [2]string{k, o.Options[k]})
+		}
+		slaves = append(slaves, teeSlave(opts, o.target()))
+	}
+
+	var args []string
+	if cfg.Synthetic != nil || plan.TranscodeVideo || plan.TranscodeAudio {
+		// The tee muxer cannot tell encoders that FLV and MP4 outputs need global headers.
+		args = append(args, "-flags", "+global_header")
+	}
+	args = append(args, "-f", "tee")
+	args = append(args, metadataArgs(cfg)...)
+	return append(args, strings.Join(slaves, "|"))
+}
+
+// teeSlave 返回 tee 封装中的一路输出：[key=value:...]地址。选项值先按选项的规则转义，整路输出再按输出之间的规则转义。
+func teeSlave(opts [][2]string, target string) string {
+	pairs := make([]string, len(opts))
+	for i, kv := range opts {
+		pairs[i] = kv[0] + "=" + teeEscape(kv[1], `:]=`)
+	}
+	return teeEscape("["+strings.Join(pairs, ":")+"]", "|") + teeEscape(target, "|")
+}
+
+// teeEscape 用反斜杠转义 s 中的 special 字符以及反斜杠和单引号。
+func teeEscape(s, special string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c == '\\' || c == '\'' || strings.ContainsRune(special, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// teeSlaveFailure 匹配 tee 封装报告的输出失败，如 "Slave muxer #1 failed: Broken pipe, continuing with 2/3 slaves."。
+var teeSlaveFailure = regexp.MustCompile(`Slave muxer #(\d+) failed(?:: (.*?), continuing with|, aborting)`)
+
+// outputFailure 是一路输出在当前 ffmpeg 进程中的失败记录。
+type outputFailure struct {
+	err  string
+	time time.Time
+}
+
+// outputTracker 记录当前 ffmpeg 进程中各路输出的失败，按 tee 中的序号（dst 为 0）索引。
+// 由 ffmpeg 输出的处理协程更新，使用独立的锁，不与工作器的锁嵌套。
+type outputTracker struct {
+	mu     sync.Mutex
+	failed map[int]outputFailure
+}
+
+// reset 在启动新的 ffmpeg 进程时清除失败记录。
+func (t *outputTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = nil
+}
+
+// observe 检查一行 ffmpeg 输出，是输出失败时记录并返回失败的序号。
+func (t *outputTracker) observe(line string, now time.Time) (int, string, bool) {
+	m := teeSlaveFailure.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", false
+	}
+	idx, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, "", false
+	}
+	msg := m[2]
+	if msg == "" {
+		msg = "output failed"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed == nil {
+		t.failed = make(map[int]outputFailure)
+	}
+	t.failed[idx] = outputFailure{err: msg, time: now}
+	return idx, msg, true
+}
+
+// failure 返回序号为 idx 的输出的失败记录。
+func (t *outputTracker) failure(idx int) (outputFailure, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.failed[idx]
+	return f, ok
+}
+
+// outputLineHandler 返回处理 ffmpeg 输出行的函数，附加输出失败时记录日志并发送 output_failed 事件。
+func (w *StreamWorker) outputLineHandler(cfg StreamConfig) func(string) {
+	if len(cfg.Outputs) == 0 || independentOutputs(cfg) {
+		return nil
+	}
+	return func(line string) {
+		idx, msg, ok := w.outputs.observe(line, time.Now())
+		if !ok || idx < 1 || idx > len(cfg.Outputs) {
+			return
+		}
+		name := cfg.Outputs[idx-1].Name
+		slog.Warn("output failed, other outputs continue until ffmpeg restarts", "stream_id", cfg.ID, "output", name, "error", msg)
+		emitEvent(cfg.ID, "output_failed", name, msg)
+	}
+}
+
+// outputStatus 是流的一路输出的状态。
+type outputStatus struct {
+	Name    string `json:"name"`
+	Format  string `json:"format"`
+	DstHost string `json:"dst_host,omitempty"`
+	// State 是 running、failed 或 down。
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	FailedAt *time.Time `json:"failed_at,omitempty"`
+	// Restarts 是独立推送的输出单独重启的次数。
+	Restarts int64 `json:"restarts,omitempty"`
+}
+
+// outputStatuses 返回流各路输出的状态，第一项是 dst。没有附加输出时返回 nil。
+func (w *StreamWorker) outputStatuses(cfg StreamConfig, dst string) []outputStatus {
+	if len(cfg.Outputs) == 0 {
+		return nil
+	}
+	running := w.IsRunning()
+	w.mu.Lock()
+	pushers := w.pushers
+	w.mu.Unlock()
+	formats := outputFormats(cfg)
+	dsts := []string{dst}
+	names := []string{primaryOutputName}
+	for _, o := range cfg.Outputs {
+		dsts = append(dsts, o.target())
+		names = append(names, o.Name)
+	}
+	out := make([]outputStatus, len(names))
+	for i := range names {
+		if i > 0 && pushers != nil && i <= len(pushers.pushers) {
+			out[i] = pushers.pushers[i-1].status()
+			continue
+		}
+		s := outputStatus{Name: names[i], Format: formats[i], DstHost: endpointHost(dsts[i]), State: OutputStateDown}
+		if running {
+			s.State = OutputStateRunning
+			if f, ok := w.outputs.failure(i); ok {
+				t := f.time
+				s.State, s.Error, s.FailedAt = OutputStateFailed, redactURLs(f.err), &t
+			}
+		}
+		out[i] = s
+	}
+	return out
+}
+
+// writeOutputMetrics 输出配置了附加输出的流中每路输出是否正在推送。
+func writeOutputMetrics(bw *bufio.Writer, snaps []workerSnapshot) {
+	fmt.Fprintln(bw, "# HELP stream_runner_output_up Whether an output of a stream with additional outputs is being pushed.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_output_up gauge")
+	for _, s := range snaps {
+		for _, o := range s.outputs {
+			v := 0
+			if o.State == OutputStateRunning {
+				v = 1
+			}
+			fmt.Fprintf(bw, "stream_runner_output_up{stream_id=\"%s\",output=\"%s\"} %d\n",
+				escapeLabelValue(s.id), escapeLabelValue(o.Name), v)
+		}
+	}
+}
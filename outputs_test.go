@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTeeArgs 测试配置附加输出时通过 tee 封装推送，dst 的协议选项和特殊字符正确转义。
+func TestTeeArgs(t *testing.T) {
+	cfg := StreamConfig{
+		ID:  "news",
+		Src: "rtmp://source.com/live",
+		Dst: "rtmp://dest.com/live/key",
+		Outputs: []StreamOutput{
+			{Name: "srt", Dst: "srt://backup.com:9000?streamid=a|b"},
+			{Name: "hls", Dst: "/var/www/hls/news/", Options: map[string]string{"hls_time": "4", "hls_flags": "delete_segments"}},
+		},
+	}
+	if err := validateOutputs(cfg.Outputs); err != nil {
+		t.Fatal(err)
+	}
+	ep := &resolvedEndpoints{Src: cfg.Src, Dst: cfg.Dst, DstTCURL: "rtmp://dest.com/live"}
+	args := buildFFmpegArgs(cfg, ep, outputPlan{Format: "flv"})
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-f tee") {
+		t.Fatalf("expected tee output, got %v", args)
+	}
+	want := `[f=flv:rtmp_tcurl=rtmp\\://dest.com/live]rtmp://dest.com/live/key` +
+		`|[f=mpegts:onfail=ignore]srt://backup.com:9000?streamid=a\|b` +
+		`|[f=hls:onfail=ignore:hls_flags=delete_segments:hls_time=4]/var/www/hls/news/index.m3u8`
+	if got := args[len(args)-1]; got != want {
+		t.Errorf("tee outputs:\n got %s\nwant %s", got, want)
+	}
+	if strings.Contains(joined, "-rtmp_tcurl") {
+		t.Errorf("dst protocol options must be passed per output, got %v", args)
+	}
+
+	dup := []StreamOutput{{Name: "a", Dst: "srt://x:1"}, {Name: "a", Dst: "srt://y:1"}}
+	if err := validateOutputs(dup); err == nil {
+		t.Error("expected duplicate output names to be rejected")
+	}
+	if err := validateOutputs([]StreamOutput{{Name: "a", Dst: "/tmp/a/", Options: map[string]string{"f": "mp4"}}}); err == nil {
+		t.Error("expected option f to be rejected")
+	}
+}
+
+// TestOutputStatuses 测试 tee 报告附加输出失败后，该输出在状态中为 failed，其他输出仍在推送。
+func TestOutputStatuses(t *testing.T) {
+	cfg := StreamConfig{
+		ID:      "news",
+		Dst:     "rtmp://dest.com/live/key",
+		Outputs: []StreamOutput{{Name: "srt", Dst: "srt://backup.com:9000"}, {Name: "hls", Dst: "/tmp/hls/index.m3u8"}},
+	}
+	w := &StreamWorker{cfg: cfg}
+	if got := w.outputStatuses(cfg, cfg.Dst); got[0].State != OutputStateDown {
+		t.Fatalf("expected outputs down while ffmpeg is not running, got %+v", got)
+	}
+
+	w.running = true
+	handle := w.outputLineHandler(cfg)
+	handle("[tee @ 0x55d] Slave muxer #1 failed: Connection refused, continuing with 2/3 slaves.")
+	got := w.outputStatuses(cfg, cfg.Dst)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 outputs, got %+v", got)
+	}
+	if got[0].Name != primaryOutputName || got[0].Format != "flv" || got[0].DstHost != "dest.com" || got[0].State != OutputStateRunning {
+		t.Errorf("primary = %+v", got[0])
+	}
+	if got[1].State != OutputStateFailed || got[1].Error != "Connection refused" || got[1].FailedAt == nil {
+		t.Errorf("srt = %+v", got[1])
+	}
+	if got[2].Format != "hls" || got[2].State != OutputStateRunning {
+		t.Errorf("hls = %+v", got[2])
+	}
+
+	// A new ffmpeg process reconnects every output.
+	w.outputs.reset()
+	if got := w.outputStatuses(cfg, cfg.Dst); got[1].State != OutputStateRunning {
+		t.Errorf("expected srt running after restart, got %+v", got[1])
+	}
+	if _, _, ok := w.outputs.observe("frame= 100 fps=25", time.Now()); ok {
+		t.Error("ordinary ffmpeg output must not be treated as a failure")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envVar 是选择配置环境的环境变量，守护进程的 --env 参数优先。
+const envVar = "STREAM_RUNNER_ENV"
+
+// envNamePattern 限制环境名的字符，避免拼出配置目录之外的路径。
+var envNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// configEnvs 是叠加在基础配置上的环境列表，按顺序合并，后面的优先。
+var configEnvs, _ = parseEnvList(os.Getenv(envVar))
+
+// parseEnvList 解析逗号分隔的环境列表。
+func parseEnvList(s string) ([]string, error) {
+	var envs []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment name %q", name)
+		}
+		envs = append(envs, name)
+	}
+	return envs, nil
+}
+
+// overlayPath 返回基础配置对应环境的叠加文件路径，如 streams.yml 对应 streams.prod.yml。
+func overlayPath(base, env string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+// applyOverlays 把各环境的叠加文件依次合并到基础配置上，返回合并后的 YAML。
+func applyOverlays(path string, data []byte, envs []string) ([]byte, error) {
+	var merged any
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for _, env := range envs {
+		p := overlayPath(path, env)
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %w", env, err)
+		}
+		var overlay any
+		if err := yaml.Unmarshal(raw, &overlay); err != nil {
+			return nil, fmt.Errorf("environment %s: %s: %w", env, p, err)
+		}
+		if merged, err = mergeOverlay(merged, overlay, ""); err != nil {
+			return nil, fmt.Errorf("environment %s: %s: %w", env, p, err)
+		}
+	}
+	return yaml.Marshal(merged)
+}
+
+// mergeOverlay 把 overlay 合并到 base 上：映射逐键递归合并，值为 null 的键被删除，
+// 顶层 streams 按 id 合并，其余列表和标量整体替换。
+func mergeOverlay(base, overlay any, path string) (any, error) {
+	b, bok := base.(map[string]any)
+	o, ook := overlay.(map[string]any)
+	if !bok || !ook {
+		if path == "streams" {
+			return mergeStreams(base, overlay)
+		}
+		return overlay, nil
+	}
+	for k, v := range o {
+		if v == nil {
+			delete(b, k)
+			continue
+		}
+		child := k
+		if path != "" {
+			child = path + "." + k
+		}
+		merged, err := mergeOverlay(b[k], v, child)
+		if err != nil {
+			return nil, err
+		}
+		b[k] = merged
+	}
+	return b, nil
+}
+
+// mergeStreams 按 id 合并流列表：已有的流逐字段合并，新的流追加到末尾。
+func mergeStreams(base, overlay any) (any, error) {
+	o, ok := overlay.([]any)
+	if !ok {
+		return nil, fmt.Errorf("streams must be a list")
+	}
+	b, _ := base.([]any)
+	index := make(map[string]int, len(b))
+	for i, s := range b {
+		if m, ok := s.(map[string]any); ok {
+			if id, ok := m["id"].(string); ok {
+				index[id] = i
+			}
+		}
+	}
+	for i, s := range o {
+		m, ok := s.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("streams[%d]: must be a mapping", i)
+		}
+		id, ok := m["id"].(string)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("streams[%d]: id is required in overlays", i)
+		}
+		if j, exists := index[id]; exists {
+			merged, err := mergeOverlay(b[j], m, "streams."+id)
+			if err != nil {
+				return nil, err
+			}
+			b[j] = merged
+			continue
+		}
+		index[id] = len(b)
+		b = append(b, m)
+	}
+	return b, nil
+}
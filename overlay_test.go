@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestApplyOverlays 测试环境叠加文件的合并规则
+func TestApplyOverlays(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "streams.yml")
+	files := map[string]string{
+		"streams.yml": `region: cn
+metrics:
+  listen: ":9090"
+  max_streams: 100
+streams:
+  - id: a
+    src: rtmp://src/live/a
+    dst: rtmp://staging/live/a
+    probe: true
+  - id: b
+    src: rtmp://src/live/b
+    dst: rtmp://staging/live/b
+`,
+		"streams.prod.yml": `metrics:
+  max_streams: null
+streams:
+  - id: a
+    dst: rtmp://prod/live/a
+  - id: c
+    src: rtmp://src/live/c
+    dst: rtmp://prod/live/c
+`,
+		"streams.prod-eu.yml": `region: eu
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := configEnvs
+	defer func() { configEnvs = old }()
+	configEnvs = []string{"prod", "prod-eu"}
+	cfg, err := loadConfig(base)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.Region != "eu" || cfg.Metrics.Listen != ":9090" || cfg.Metrics.MaxStreams != 0 {
+		t.Errorf("region = %q, metrics = %+v", cfg.Region, cfg.Metrics)
+	}
+	if len(cfg.Streams) != 3 {
+		t.Fatalf("got %d streams, want 3", len(cfg.Streams))
+	}
+	if s := cfg.Streams[0]; s.Dst != "rtmp://prod/live/a" || s.Src != "rtmp://src/live/a" || !s.Probe {
+		t.Errorf("stream a = %+v", s)
+	}
+	if s := cfg.Streams[2]; s.ID != "c" || s.Region != "eu" {
+		t.Errorf("stream c = %+v", s)
+	}
+
+	configEnvs = []string{"missing"}
+	if _, err := loadConfig(base); err == nil {
+		t.Error("expected error for missing overlay")
+	}
+	if _, err := parseEnvList("prod,../etc"); err == nil {
+		t.Error("expected error for invalid environment name")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPacingInterval 是目标主机启动限速的默认时间窗口。
+const DefaultPacingInterval = time.Second
+
+// DestinationPacing 表示按目标主机的启动限速。大量流推往同一主机时，网络抖动后的集中重连
+// 会同时发起大量握手，触发目标的限流反而延长中断；限速后同一主机的启动按间隔错开。
+type DestinationPacing struct {
+	// MaxStarts 是每个目标主机在 interval 内允许的启动数，超出的启动均匀排到后面。
+	MaxStarts int `yaml:"max_starts"`
+	// Interval 是时间窗口，默认 1s。
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// validate 校验目标主机限速配置。
+func (p *DestinationPacing) validate() error {
+	if p.MaxStarts <= 0 {
+		return fmt.Errorf("max_starts must be positive")
+	}
+	if p.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (p DestinationPacing) withDefaults() DestinationPacing {
+	if p.Interval == 0 {
+		p.Interval = DefaultPacingInterval
+	}
+	return p
+}
+
+// destinationPacing 是当前生效的目标主机限速，未配置时为空。
+var destinationPacing atomic.Pointer[DestinationPacing]
+
+// pacer 为每个目标主机排定启动时间。
+type pacer struct {
+	mu sync.Mutex
+	// next 是每个主机下一个启动名额的理论时间。
+	next map[string]time.Time
+}
+
+// destinationPacer 是所有工作器共享的排程。
+var destinationPacer = pacer{next: make(map[string]time.Time)}
+
+// reserve 为 host 预订一个启动名额，返回需要等待的时长。interval 内前 max_starts 个启动不等待，
+// 之后每个启动间隔 interval/max_starts。
+func (p *pacer) reserve(host string, now time.Time, c DestinationPacing) time.Duration {
+	spacing := c.Interval / time.Duration(c.MaxStarts)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for h, t := range p.next {
+		if t.Before(now) {
+			delete(p.next, h)
+		}
+	}
+	next := p.next[host]
+	if next.Before(now) {
+		next = now
+	}
+	p.next[host] = next.Add(spacing)
+	if wait := next.Sub(now) - (c.Interval - spacing); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// waitForDestination 在配置了目标主机限速时等待 dst 所在主机的启动名额。
+func (w *StreamWorker) waitForDestination(id, dst string) {
+	p := destinationPacing.Load()
+	if p == nil {
+		return
+	}
+	host := endpointHost(dst)
+	if wait := destinationPacer.reserve(host, time.Now(), p.withDefaults()); wait > 0 {
+		slog.Info("pacing ffmpeg start to destination", "stream_id", id, "host", host, "wait", wait)
+		w.backoff(wait)
+	}
+}
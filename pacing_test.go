@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPacerReserve 测试同一目标主机超出 max_starts 的启动按间隔错开，不同主机互不影响
+func TestPacerReserve(t *testing.T) {
+	p := pacer{next: make(map[string]time.Time)}
+	c := DestinationPacing{MaxStarts: 4, Interval: time.Second}.withDefaults()
+	now := time.Now()
+	var got []time.Duration
+	for i := 0; i < 6; i++ {
+		got = append(got, p.reserve("live.example.com", now, c))
+	}
+	want := []time.Duration{0, 0, 0, 0, 250 * time.Millisecond, 500 * time.Millisecond}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("start %d: got wait %s, want %s", i, got[i], want[i])
+		}
+	}
+	if wait := p.reserve("other.example.com", now, c); wait != 0 {
+		t.Errorf("other host: got wait %s", wait)
+	}
+	// Once the backlog has drained the host gets a full burst again.
+	if wait := p.reserve("live.example.com", now.Add(2*time.Second), c); wait != 0 {
+		t.Errorf("after drain: got wait %s", wait)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 支持的直播平台。
+const (
+	// PlatformYouTube 是 YouTube Live，推流地址和健康状态来自 Data API v3 的 liveStreams。
+	PlatformYouTube = "youtube"
+	// PlatformTwitch 是 Twitch，推流密钥和直播状态来自 Helix API。
+	PlatformTwitch = "twitch"
+	// PlatformFacebook 是 Facebook Live，推流地址和直播状态来自 Graph API 的 live video。
+	PlatformFacebook = "facebook"
+)
+
+const (
+	// DefaultPlatformCheckInterval 是平台侧健康检查的默认间隔。
+	DefaultPlatformCheckInterval = time.Minute
+	// DefaultTwitchIngest 是 Twitch 的默认接入服务器。
+	DefaultTwitchIngest = "rtmp://live.twitch.tv/app"
+	// platformTimeout 是单次平台 API 请求的超时时间。
+	platformTimeout = 10 * time.Second
+	// platformWarmup 是推流开始后到首次健康检查前的等待时间，平台需要时间识别新的推流。
+	platformWarmup = 30 * time.Second
+	// facebookGraphVersion 是调用的 Graph API 版本。
+	facebookGraphVersion = "v19.0"
+)
+
+// platformAPIs 是各平台 API 的根地址，测试中替换为本地服务器。
+var platformAPIs = map[string]string{
+	PlatformYouTube:  "https://www.googleapis.com",
+	PlatformTwitch:   "https://api.twitch.tv",
+	PlatformFacebook: "https://graph.facebook.com",
+}
+
+// PlatformConfig 表示从直播平台 API 获取推流地址：每次启动 ffmpeg 前向平台查询接入地址和推流密钥，
+// 运行期间定期查询平台侧的直播状态。配置后 dst 留空。
+type PlatformConfig struct {
+	// Type 是平台类型：youtube、twitch 或 facebook。
+	Type string `yaml:"type"`
+	// Token 是 OAuth 访问令牌，支持 ${secret:plugin/name} 占位符，令牌的刷新由密钥插件负责。
+	Token string `yaml:"token"`
+	// StreamID 是 YouTube liveStream 资源的 ID。
+	StreamID string `yaml:"stream_id,omitempty"`
+	// VideoID 是 YouTube liveBroadcast（即直播视频）的 ID，配置后读取同时在线观众数。
+	VideoID string `yaml:"video_id,omitempty"`
+	// BroadcasterID 是 Twitch 频道的用户 ID。
+	BroadcasterID string `yaml:"broadcaster_id,omitempty"`
+	// ClientID 是 Twitch 应用的 Client ID。
+	ClientID string `yaml:"client_id,omitempty"`
+	// Ingest 是 Twitch 的接入服务器，默认 rtmp://live.twitch.tv/app。
+	Ingest string `yaml:"ingest,omitempty"`
+	// LiveVideoID 是 Facebook live video 的 ID。
+	LiveVideoID string `yaml:"live_video_id,omitempty"`
+	// CheckInterval 是平台侧健康检查的间隔，默认 1m。
+	CheckInterval time.Duration `yaml:"check_interval,omitempty"`
+}
+
+// validate 校验平台配置，s 是流本身的配置。
+func (c *PlatformConfig) validate(s StreamConfig) error {
+	if s.Dst != "" || len(s.DstCandidates) > 0 {
+		return fmt.Errorf("dst and dst_candidates must be empty, the ingest URL comes from the platform")
+	}
+	if c.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if c.CheckInterval < 0 {
+		return fmt.Errorf("check_interval must not be negative")
+	}
+	switch c.Type {
+	case PlatformYouTube:
+		if c.StreamID == "" {
+			return fmt.Errorf("stream_id is required for youtube")
+		}
+	case PlatformTwitch:
+		if c.BroadcasterID == "" || c.ClientID == "" {
+			return fmt.Errorf("broadcaster_id and client_id are required for twitch")
+		}
+		if c.Ingest != "" {
+			if u, err := url.Parse(c.Ingest); err != nil || (u.Scheme != "rtmp" && u.Scheme != "rtmps") || u.Host == "" {
+				return fmt.Errorf("ingest must be an rtmp(s) URL")
+			}
+		}
+	case PlatformFacebook:
+		if c.LiveVideoID == "" {
+			return fmt.Errorf("live_video_id is required for facebook")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected youtube, twitch or facebook", c.Type)
+	}
+	return nil
+}
+
+// platformStatus 是平台侧的直播状态，出现在 /status 中。
+type platformStatus struct {
+	Type string `json:"type"`
+	// State 是平台返回的原始状态，如 YouTube 的 active/good、Facebook 的 LIVE。
+	State   string `json:"state,omitempty"`
+	Healthy bool   `json:"healthy"`
+	// Viewers 是平台报告的同时在线观众数，平台未提供时为空。
+	Viewers *int64    `json:"viewers,omitempty"`
+	Checked time.Time `json:"checked"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// platformGet 请求平台 API 并解析 JSON 响应，令牌通过 Authorization 头发送，不出现在地址中。
+func platformGet(c PlatformConfig, path string, query url.Values, out any) error {
+	token, err := resolveSecrets(context.Background(), c.Token)
+	if err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), platformTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, platformAPIs[c.Type]+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if c.Type == PlatformTwitch {
+		req.Header.Set("Client-Id", c.ClientID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s API returned %s", c.Type, resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode %s API response: %w", c.Type, err)
+	}
+	return nil
+}
+
+// youtubeStream 是 YouTube liveStreams 资源中用到的字段。
+type youtubeStream struct {
+	CDN struct {
+		IngestionInfo struct {
+			IngestionAddress      string `json:"ingestionAddress"`
+			RTMPSIngestionAddress string `json:"rtmpsIngestionAddress"`
+			StreamName            string `json:"streamName"`
+		} `json:"ingestionInfo"`
+	} `json:"cdn"`
+	Status struct {
+		StreamStatus string `json:"streamStatus"`
+		HealthStatus struct {
+			Status string `json:"status"`
+		} `json:"healthStatus"`
+	} `json:"status"`
+}
+
+// fetchYouTubeStream 查询 YouTube liveStream 资源。
+func fetchYouTubeStream(c PlatformConfig) (youtubeStream, error) {
+	var resp struct {
+		Items []youtubeStream `json:"items"`
+	}
+	err := platformGet(c, "/youtube/v3/liveStreams", url.Values{"part": {"cdn,status"}, "id": {c.StreamID}}, &resp)
+	if err != nil {
+		return youtubeStream{}, err
+	}
+	if len(resp.Items) == 0 {
+		return youtubeStream{}, fmt.Errorf("youtube live stream %s not found", c.StreamID)
+	}
+	return resp.Items[0], nil
+}
+
+// facebookLiveVideo 是 Facebook live video 中用到的字段。
+type facebookLiveVideo struct {
+	SecureStreamURL string `json:"secure_stream_url"`
+	Status          string `json:"status"`
+	LiveViews       *int64 `json:"live_views"`
+}
+
+// fetchFacebookLiveVideo 查询 Facebook live video。
+func fetchFacebookLiveVideo(c PlatformConfig) (facebookLiveVideo, error) {
+	var v facebookLiveVideo
+	err := platformGet(c, "/"+facebookGraphVersion+"/"+url.PathEscape(c.LiveVideoID), url.Values{"fields": {"secure_stream_url,status,live_views"}}, &v)
+	return v, err
+}
+
+// fetchYouTubeViewers 查询 YouTube 直播视频的同时在线观众数，直播未开始或已结束时返回 nil。
+func fetchYouTubeViewers(c PlatformConfig) (*int64, error) {
+	var resp struct {
+		Items []struct {
+			LiveStreamingDetails struct {
+				// ConcurrentViewers is a decimal string in the Data API.
+				ConcurrentViewers string `json:"concurrentViewers"`
+			} `json:"liveStreamingDetails"`
+		} `json:"items"`
+	}
+	if err := platformGet(c, "/youtube/v3/videos", url.Values{"part": {"liveStreamingDetails"}, "id": {c.VideoID}}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Items) == 0 {
+		return nil, fmt.Errorf("youtube video %s not found", c.VideoID)
+	}
+	v := resp.Items[0].LiveStreamingDetails.ConcurrentViewers
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("youtube video %s: invalid concurrentViewers %q", c.VideoID, v)
+	}
+	return &n, nil
+}
+
+// fetchPlatformIngest 向平台查询推流地址（含推流密钥）。
+func fetchPlatformIngest(c PlatformConfig) (string, error) {
+	switch c.Type {
+	case PlatformYouTube:
+		s, err := fetchYouTubeStream(c)
+		if err != nil {
+			return "", err
+		}
+		info := s.CDN.IngestionInfo
+		addr := info.RTMPSIngestionAddress
+		if addr == "" {
+			addr = info.IngestionAddress
+		}
+		if addr == "" || info.StreamName == "" {
+			return "", fmt.Errorf("youtube live stream %s has no ingestion info", c.StreamID)
+		}
+		return strings.TrimSuffix(addr, "/") + "/" + info.StreamName, nil
+	case PlatformTwitch:
+		var resp struct {
+			Data []struct {
+				StreamKey string `json:"stream_key"`
+			} `json:"data"`
+		}
+		if err := platformGet(c, "/helix/streams/key", url.Values{"broadcaster_id": {c.BroadcasterID}}, &resp); err != nil {
+			return "", err
+		}
+		if len(resp.Data) == 0 || resp.Data[0].StreamKey == "" {
+			return "", fmt.Errorf("twitch returned no stream key for broadcaster %s", c.BroadcasterID)
+		}
+		ingest := c.Ingest
+		if ingest == "" {
+			ingest = DefaultTwitchIngest
+		}
+		return strings.TrimSuffix(ingest, "/") + "/" + resp.Data[0].StreamKey, nil
+	case PlatformFacebook:
+		v, err := fetchFacebookLiveVideo(c)
+		if err != nil {
+			return "", err
+		}
+		if v.SecureStreamURL == "" {
+			return "", fmt.Errorf("facebook live video %s has no stream URL, status %s", c.LiveVideoID, v.Status)
+		}
+		return v.SecureStreamURL, nil
+	}
+	return "", fmt.Errorf("unknown platform %q", c.Type)
+}
+
+// checkPlatform 查询平台侧的直播状态和同时在线观众数。YouTube 要求推流活跃且健康状态为 good 或 ok，
+// Twitch 要求频道正在直播，Facebook 要求 live video 状态为 LIVE。观众数查询失败不影响健康判断。
+func checkPlatform(c PlatformConfig) platformStatus {
+	st := platformStatus{Type: c.Type, Checked: time.Now()}
+	var err error
+	switch c.Type {
+	case PlatformYouTube:
+		var s youtubeStream
+		if s, err = fetchYouTubeStream(c); err == nil {
+			health := s.Status.HealthStatus.Status
+			st.State = s.Status.StreamStatus + "/" + health
+			st.Healthy = s.Status.StreamStatus == "active" && (health == "good" || health == "ok")
+			if c.VideoID != "" {
+				viewers, verr := fetchYouTubeViewers(c)
+				if verr != nil {
+					slog.Warn("failed to fetch viewer count", "platform", c.Type, "error", verr)
+				}
+				st.Viewers = viewers
+			}
+		}
+	case PlatformTwitch:
+		var resp struct {
+			Data []struct {
+				Type        string `json:"type"`
+				ViewerCount int64  `json:"viewer_count"`
+			} `json:"data"`
+		}
+		if err = platformGet(c, "/helix/streams", url.Values{"user_id": {c.BroadcasterID}}, &resp); err == nil {
+			st.State = "offline"
+			if len(resp.Data) > 0 {
+				st.State = resp.Data[0].Type
+				st.Viewers = &resp.Data[0].ViewerCount
+			}
+			st.Healthy = st.State == "live"
+		}
+	case PlatformFacebook:
+		var v facebookLiveVideo
+		if v, err = fetchFacebookLiveVideo(c); err == nil {
+			st.State = v.Status
+			st.Healthy = v.Status == "LIVE"
+			st.Viewers = v.LiveViews
+		}
+	default:
+		err = fmt.Errorf("unknown platform %q", c.Type)
+	}
+	if err != nil {
+		st.Error = redactURLs(err.Error())
+	}
+	return st
+}
+
+// platformMonitor 定期查询运行中的流在平台侧的直播状态，状态变化时发出事件。
+type platformMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// results 是每路流最近一次的平台状态。
+	results  map[string]platformStatus
+	inFlight map[string]bool
+}
+
+// platforms 是当前的平台状态监控器。
+var platforms atomic.Pointer[platformMonitor]
+
+// newPlatformMonitor 创建平台状态监控器。
+func newPlatformMonitor(state *AppState) *platformMonitor {
+	return &platformMonitor{state: state, results: make(map[string]platformStatus), inFlight: make(map[string]bool)}
+}
+
+// status 返回流最近一次的平台状态，尚未检查过时返回 nil。
+func (m *platformMonitor) status(id string) *platformStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.results[id]
+	if !ok {
+		return nil
+	}
+	return &st
+}
+
+// run 每 10 秒扫描一次工作器，对推流已超过预热时间且到期的流发起检查。
+func (m *platformMonitor) run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		workers := m.state.workers.snapshot()
+		ids := make(map[string]bool, len(workers))
+		for id, w := range workers {
+			cfg := w.config()
+			if cfg.Platform == nil {
+				continue
+			}
+			ids[id] = true
+			start := w.runningSince()
+			if start.IsZero() || now.Sub(start) < platformWarmup {
+				continue
+			}
+			interval := cfg.Platform.CheckInterval
+			if interval == 0 {
+				interval = DefaultPlatformCheckInterval
+			}
+			m.mu.Lock()
+			due := !m.inFlight[id] && now.Sub(m.results[id].Checked) >= interval
+			if due {
+				m.inFlight[id] = true
+			}
+			m.mu.Unlock()
+			if due {
+				go m.check(id, *cfg.Platform)
+			}
+		}
+
+		m.mu.Lock()
+		for id := range m.results {
+			if !ids[id] {
+				delete(m.results, id)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// check 查询一次平台状态并记录结果，变为异常和恢复时各发出一次事件。
+func (m *platformMonitor) check(id string, c PlatformConfig) {
+	st := checkPlatform(c)
+
+	m.mu.Lock()
+	prev, seen := m.results[id]
+	m.results[id] = st
+	delete(m.inFlight, id)
+	m.mu.Unlock()
+
+	detail := st.State
+	if st.Error != "" {
+		detail = st.Error
+	}
+	switch {
+	case !st.Healthy && (!seen || prev.Healthy):
+		slog.Warn("platform reports stream unhealthy", "stream_id", id, "platform", c.Type, "state", st.State, "error", st.Error)
+		emitEvent(id, "platform_unhealthy", c.Type, detail)
+	case st.Healthy && seen && !prev.Healthy:
+		emitEvent(id, "platform_healthy", c.Type)
+	}
+}
+
+// writePlatformMetrics 输出平台报告的同时在线观众数，没有观众数时不输出。
+func writePlatformMetrics(bw *bufio.Writer) {
+	m := platforms.Load()
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.results))
+	for id, st := range m.results {
+		if st.Viewers != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	results := make([]platformStatus, len(ids))
+	for i, id := range ids {
+		results[i] = m.results[id]
+	}
+	m.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	fmt.Fprintln(bw, "# HELP stream_runner_platform_viewers Concurrent viewers reported by the destination platform.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_platform_viewers gauge")
+	for i, id := range ids {
+		fmt.Fprintf(bw, "stream_runner_platform_viewers{stream_id=\"%s\",platform=\"%s\"} %d\n", escapeLabelValue(id), results[i].Type, *results[i].Viewers)
+	}
+}
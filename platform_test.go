@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPlatformValidate 测试平台配置要求 dst 留空，并按平台类型检查必填字段
+func TestPlatformValidate(t *testing.T) {
+	ok := PlatformConfig{Type: PlatformYouTube, Token: "t", StreamID: "abc"}
+	if err := ok.validate(StreamConfig{}); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	cases := map[string]struct {
+		c PlatformConfig
+		s StreamConfig
+	}{
+		"dst":            {ok, StreamConfig{Dst: "rtmp://a.rtmp.youtube.com/live2/key"}},
+		"token":          {PlatformConfig{Type: PlatformYouTube, StreamID: "abc"}, StreamConfig{}},
+		"type":           {PlatformConfig{Type: "vimeo", Token: "t"}, StreamConfig{}},
+		"twitch fields":  {PlatformConfig{Type: PlatformTwitch, Token: "t", BroadcasterID: "1"}, StreamConfig{}},
+		"twitch ingest":  {PlatformConfig{Type: PlatformTwitch, Token: "t", BroadcasterID: "1", ClientID: "c", Ingest: "https://x"}, StreamConfig{}},
+		"facebook video": {PlatformConfig{Type: PlatformFacebook, Token: "t"}, StreamConfig{}},
+	}
+	for name, tc := range cases {
+		if err := tc.c.validate(tc.s); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestPlatformIngestAndHealth 测试从各平台 API 获取推流地址、直播状态和观众数，令牌只通过请求头发送
+func TestPlatformIngestAndHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" || r.URL.Query().Has("access_token") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/youtube/v3/liveStreams":
+			w.Write([]byte(`{"items":[{"cdn":{"ingestionInfo":{"rtmpsIngestionAddress":"rtmps://a.rtmps.youtube.com/live2","streamName":"yt-key"}},"status":{"streamStatus":"active","healthStatus":{"status":"bad"}}}]}`))
+		case "/youtube/v3/videos":
+			w.Write([]byte(`{"items":[{"liveStreamingDetails":{"concurrentViewers":"1500"}}]}`))
+		case "/helix/streams/key":
+			if r.Header.Get("Client-Id") != "client" {
+				http.Error(w, "missing client id", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"data":[{"stream_key":"live_tw-key"}]}`))
+		case "/helix/streams":
+			w.Write([]byte(`{"data":[{"type":"live","viewer_count":320}]}`))
+		case "/" + facebookGraphVersion + "/42":
+			w.Write([]byte(`{"secure_stream_url":"rtmps://live-api-s.facebook.com:443/rtmp/fb-key","status":"LIVE","live_views":75}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	prev := platformAPIs
+	platformAPIs = map[string]string{PlatformYouTube: srv.URL, PlatformTwitch: srv.URL, PlatformFacebook: srv.URL}
+	defer func() { platformAPIs = prev }()
+
+	cases := []struct {
+		c       PlatformConfig
+		ingest  string
+		healthy bool
+		viewers int64
+	}{
+		{PlatformConfig{Type: PlatformYouTube, Token: "secret-token", StreamID: "abc", VideoID: "v"}, "rtmps://a.rtmps.youtube.com/live2/yt-key", false, 1500},
+		{PlatformConfig{Type: PlatformTwitch, Token: "secret-token", BroadcasterID: "1", ClientID: "client"}, "rtmp://live.twitch.tv/app/live_tw-key", true, 320},
+		{PlatformConfig{Type: PlatformFacebook, Token: "secret-token", LiveVideoID: "42"}, "rtmps://live-api-s.facebook.com:443/rtmp/fb-key", true, 75},
+	}
+	for _, tc := range cases {
+		got, err := fetchPlatformIngest(tc.c)
+		if err != nil || got != tc.ingest {
+			t.Errorf("%s: ingest = %q, %v; want %q", tc.c.Type, got, err, tc.ingest)
+		}
+		st := checkPlatform(tc.c)
+		if st.Error != "" || st.Healthy != tc.healthy {
+			t.Errorf("%s: status = %+v, want healthy %v", tc.c.Type, st, tc.healthy)
+		}
+		if st.Viewers == nil || *st.Viewers != tc.viewers {
+			t.Errorf("%s: viewers = %v, want %d", tc.c.Type, st.Viewers, tc.viewers)
+		}
+	}
+
+	bad := PlatformConfig{Type: PlatformYouTube, Token: "wrong", StreamID: "abc"}
+	if _, err := fetchPlatformIngest(bad); err == nil {
+		t.Error("expected error for rejected token")
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultPluginTimeout 是单次插件调用的默认超时时间。
+	DefaultPluginTimeout = 10 * time.Second
+	// pluginMaxResponse 是插件响应的最大字节数。
+	pluginMaxResponse = 1 << 20
+)
+
+// HealthProbe 是自定义就绪检查，条件不满足时返回错误。
+type HealthProbe interface {
+	Probe(ctx context.Context, streamID string, args map[string]string) error
+}
+
+// Notifier 是自定义告警渠道，body 是渲染后的告警正文。
+type Notifier interface {
+	Notify(ctx context.Context, channel string, body []byte) error
+}
+
+// SecretProvider 按名称返回密钥，用于在启动 ffmpeg 前替换地址中的占位符。
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// PluginConfig 表示一个外部插件进程。
+// 每次调用启动一次命令，通过 stdin 写入一个 JSON 请求，从 stdout 读取一个 JSON 响应。
+type PluginConfig struct {
+	// Command 是插件命令及其参数（不经过 shell）。
+	Command []string `yaml:"command"`
+	// Timeout 是单次调用的超时时间，默认 10s。
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Env 是传给插件的额外环境变量，继承的变量受 hooks.env 白名单限制。
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+// validate 校验插件配置。
+func (c *PluginConfig) validate() error {
+	if len(c.Command) == 0 || c.Command[0] == "" {
+		return fmt.Errorf("command is required")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+// pluginRequest 是发给插件的请求。
+type pluginRequest struct {
+	// Kind 是调用类型：probe、notify 或 secret。
+	Kind     string            `json:"kind"`
+	StreamID string            `json:"stream_id,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
+	Channel  string            `json:"channel,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Name     string            `json:"name,omitempty"`
+}
+
+// pluginResponse 是插件返回的响应。
+type pluginResponse struct {
+	// OK 表示调用成功；为 false 时 Error 说明原因。
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Value 是 secret 调用返回的密钥。
+	Value string `json:"value,omitempty"`
+}
+
+// execPlugin 是以外部进程实现的插件，同时实现 HealthProbe、Notifier 和 SecretProvider。
+type execPlugin struct {
+	name string
+	cfg  PluginConfig
+}
+
+var (
+	_ HealthProbe    = (*execPlugin)(nil)
+	_ Notifier       = (*execPlugin)(nil)
+	_ SecretProvider = (*execPlugin)(nil)
+)
+
+// plugins 是当前生效的插件，按名称索引，在配置重载时替换。
+var plugins atomic.Pointer[map[string]*execPlugin]
+
+// newPlugins 根据配置构建插件表。
+func newPlugins(cfg map[string]PluginConfig) *map[string]*execPlugin {
+	m := make(map[string]*execPlugin, len(cfg))
+	for name, c := range cfg {
+		m[name] = &execPlugin{name: name, cfg: c}
+	}
+	return &m
+}
+
+// lookupPlugin 返回指定名称的插件。
+func lookupPlugin(name string) (*execPlugin, error) {
+	if m := plugins.Load(); m != nil {
+		if p, ok := (*m)[name]; ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown plugin %q", name)
+}
+
+// call 执行一次插件调用。插件以非零状态退出或返回 ok=false 时视为失败。
+func (p *execPlugin) call(ctx context.Context, req pluginRequest) (pluginResponse, error) {
+	timeout := p.cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return pluginResponse{}, err
+	}
+	allowed := defaultHookEnv
+	if policy := hookPolicy.Load(); policy != nil && len(policy.Env) > 0 {
+		allowed = policy.Env
+	}
+
+	cmd := exec.CommandContext(ctx, p.cfg.Command[0], p.cfg.Command[1:]...)
+	cmd.Env = hookEnv(allowed, p.cfg.Env)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(in)
+	stdout := &limitedBuffer{limit: pluginMaxResponse}
+	stderr := &limitedBuffer{limit: DefaultHookMaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return pluginResponse{}, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	if stdout.truncated {
+		return pluginResponse{}, fmt.Errorf("plugin %s: response exceeds %d bytes", p.name, pluginMaxResponse)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.buf.Bytes(), &resp); err != nil {
+		return pluginResponse{}, fmt.Errorf("plugin %s: invalid response: %w", p.name, err)
+	}
+	if !resp.OK {
+		msg := resp.Error
+		if msg == "" {
+			msg = "failed without an error message"
+		}
+		return resp, fmt.Errorf("plugin %s: %s", p.name, msg)
+	}
+	return resp, nil
+}
+
+// Probe 实现 HealthProbe 接口。
+func (p *execPlugin) Probe(ctx context.Context, streamID string, args map[string]string) error {
+	_, err := p.call(ctx, pluginRequest{Kind: "probe", StreamID: streamID, Args: args})
+	return err
+}
+
+// Notify 实现 Notifier 接口。
+func (p *execPlugin) Notify(ctx context.Context, channel string, body []byte) error {
+	_, err := p.call(ctx, pluginRequest{Kind: "notify", Channel: channel, Body: string(body)})
+	return err
+}
+
+// Secret 实现 SecretProvider 接口。
+func (p *execPlugin) Secret(ctx context.Context, name string) (string, error) {
+	resp, err := p.call(ctx, pluginRequest{Kind: "secret", Name: name})
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// secretRef 匹配 ${secret:插件/名称} 形式的密钥占位符。
+var secretRef = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_-]+)/([^}]+)\}`)
+
+// secretPlugins 返回字符串中引用的所有插件名称。
+func secretPlugins(s string) []string {
+	var names []string
+	for _, m := range secretRef.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// resolveSecrets 将字符串中的密钥占位符替换为插件返回的值。
+func resolveSecrets(ctx context.Context, s string) (string, error) {
+	var errs []error
+	out := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		p, err := lookupPlugin(m[1])
+		if err != nil {
+			errs = append(errs, err)
+			return ref
+		}
+		v, err := p.Secret(ctx, m[2])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", m[2], err))
+			return ref
+		}
+		return v
+	})
+	return out, errors.Join(errs...)
+}
+
+// resolveStreamSecrets 替换流源地址和目标地址中的密钥占位符。
+// 每次启动 ffmpeg 前重新解析，密钥轮换后重启即可生效，解析结果不写回配置。
+func resolveStreamSecrets(cfg *StreamConfig) error {
+	ctx := context.Background()
+	var err error
+	if cfg.Src, err = resolveSecrets(ctx, cfg.Src); err != nil {
+		return fmt.Errorf("src: %w", err)
+	}
+	if cfg.Dst, err = resolveSecrets(ctx, cfg.Dst); err != nil {
+		return fmt.Errorf("dst: %w", err)
+	}
+	if len(cfg.DstCandidates) > 0 {
+		candidates := make([]string, len(cfg.DstCandidates))
+		for i, c := range cfg.DstCandidates {
+			if candidates[i], err = resolveSecrets(ctx, c); err != nil {
+				return fmt.Errorf("dst_candidates[%d]: %w", i, err)
+			}
+		}
+		cfg.DstCandidates = candidates
+	}
+	return nil
+}
+
+// notifyPlugin 通过插件发送告警，失败只记录日志。
+func notifyPlugin(ch AlertChannel, name string, body []byte) {
+	p, err := lookupPlugin(ch.Plugin)
+	if err != nil {
+		slog.Warn("failed to send alert", "channel", name, "error", err)
+		return
+	}
+	if err := p.Notify(context.Background(), name, body); err != nil {
+		slog.Warn("failed to send alert", "channel", name, "error", err)
+	}
+}
+
+// validatePluginRefs 校验配置中引用的插件是否都已定义。
+func validatePluginRefs(cfg *Config) error {
+	known := func(name string) bool {
+		_, ok := cfg.Plugins[name]
+		return ok
+	}
+	for _, s := range cfg.Streams {
+		for i, c := range s.WaitFor {
+			if c.Plugin != "" && !known(c.Plugin) {
+				return fmt.Errorf("stream %s: wait_for[%d]: unknown plugin %q", s.ID, i, c.Plugin)
+			}
+		}
+		refs := append([]string{s.Src, s.Dst}, s.DstCandidates...)
+		if s.Platform != nil {
+			refs = append(refs, s.Platform.Token)
+		}
+		for _, v := range refs {
+			for _, name := range secretPlugins(v) {
+				if !known(name) {
+					return fmt.Errorf("stream %s: secret references unknown plugin %q", s.ID, name)
+				}
+			}
+		}
+	}
+	if cfg.Alerts != nil {
+		for name, ch := range cfg.Alerts.Channels {
+			if ch.Plugin != "" && !known(ch.Plugin) {
+				return fmt.Errorf("alerts: channel %s: unknown plugin %q", name, ch.Plugin)
+			}
+		}
+	}
+	return nil
+}
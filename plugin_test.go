@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePlugin 在临时目录中写入一个插件脚本并返回其路径。
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestExecPlugin 测试插件的请求响应、失败处理和密钥占位符替换
+func TestExecPlugin(t *testing.T) {
+	ok := writePlugin(t, `read req
+case "$req" in
+*'"kind":"secret"'*) echo '{"ok":true,"value":"s3cr3t"}' ;;
+*) echo '{"ok":true}' ;;
+esac
+`)
+	bad := writePlugin(t, `cat >/dev/null; echo '{"ok":false,"error":"origin down"}'`)
+	crash := writePlugin(t, `echo boom >&2; exit 3`)
+	plugins.Store(newPlugins(map[string]PluginConfig{
+		"vault": {Command: []string{ok}},
+		"bad":   {Command: []string{bad}},
+		"crash": {Command: []string{crash}},
+	}))
+	defer plugins.Store(nil)
+
+	got, err := resolveSecrets(context.Background(), "rtmp://live/app/${secret:vault/youtube}")
+	if err != nil || got != "rtmp://live/app/s3cr3t" {
+		t.Errorf("unexpected secret resolution %q, %v", got, err)
+	}
+	if err := checkReadiness("a", []ReadinessCheck{{Plugin: "vault", Args: map[string]string{"x": "1"}}}); err != nil {
+		t.Errorf("expected probe to pass, got %v", err)
+	}
+	if err := checkReadiness("a", []ReadinessCheck{{Plugin: "bad"}}); err == nil || !strings.Contains(err.Error(), "origin down") {
+		t.Errorf("expected plugin error message, got %v", err)
+	}
+	if _, err := resolveSecrets(context.Background(), "${secret:crash/k}"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected stderr in error, got %v", err)
+	}
+
+	cfg := &Config{Streams: []StreamConfig{{ID: "a", Dst: "rtmp://x/${secret:missing/k}"}}}
+	if err := validatePluginRefs(cfg); err == nil {
+		t.Error("expected unknown secret plugin to be rejected")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// RunAsConfig 表示守护进程完成特权操作（写 PID 文件、绑定端口）后切换到的身份。
+type RunAsConfig struct {
+	// User 是目标用户名。
+	User string `yaml:"user"`
+	// Group 是目标组名，为空时使用用户的主组。
+	Group string `yaml:"group,omitempty"`
+}
+
+// runtimePaths 是运行时实际使用的文件路径。
+type runtimePaths struct {
+	// Config 是配置文件路径。
+	Config string
+	// LogDir 是日志目录。
+	LogDir string
+	// LogFile 是主日志文件路径。
+	LogFile string
+	// PIDFile 是 PID 文件路径。
+	PIDFile string
+	// AuditLog 是控制操作审计日志的路径。
+	AuditLog string
+	// Snapshot 是守护进程当前生效配置的快照路径，供 export-config 读取。
+	Snapshot string
+	// Control 是本地控制套接字路径，供 status、reload、add、remove 子命令连接。
+	Control string
+}
+
+// paths 是当前进程使用的路径，root 运行时为系统路径，否则为用户可写路径。
+var paths = defaultPaths()
+
+// defaultPaths 返回默认路径。
+// 以 root 运行时使用 /etc、/var/log、/var/run 下的系统路径；
+// 非 root 时按 XDG 规范使用用户目录，避免仅仅为了写 /var/run 而需要 root。
+func defaultPaths() runtimePaths {
+	if os.Geteuid() == 0 {
+		return runtimePaths{Config: ConfigPath, LogDir: LogDir, LogFile: LogFile, AuditLog: AuditLogPath, PIDFile: PIDFilePath, Snapshot: SnapshotPath, Control: ControlSocketPath}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	configHome := envOr("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	stateHome := envOr("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+	runtimeDir := envOr("XDG_RUNTIME_DIR", filepath.Join(stateHome, "stream-runner"))
+
+	logDir := filepath.Join(stateHome, "stream-runner")
+	return runtimePaths{
+		Config:   filepath.Join(configHome, "stream-runner", "streams.yml"),
+		LogDir:   logDir,
+		LogFile:  filepath.Join(logDir, "stream.log"),
+		AuditLog: filepath.Join(logDir, "audit.log"),
+		PIDFile:  filepath.Join(runtimeDir, "stream-runner.pid"),
+		Snapshot: filepath.Join(runtimeDir, "stream-runner.snapshot.yml"),
+		Control:  filepath.Join(runtimeDir, "stream-runner.sock"),
+	}
+}
+
+// envOr 返回环境变量的值，未设置时返回默认值。
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// isPermissionError 判断错误是否由权限不足引起。
+func isPermissionError(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES)
+}
+
+// withPermissionHint 在权限错误后附加所需权限的说明，其他错误原样返回。
+func withPermissionHint(err error, hint string) error {
+	if err == nil || !isPermissionError(err) {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, hint)
+}
+
+// resolveRunAs 将用户名和组名解析为 uid/gid。
+func resolveRunAs(cfg *RunAsConfig) (uid, gid int, err error) {
+	u, err := user.Lookup(cfg.User)
+	if err != nil {
+		return 0, 0, fmt.Errorf("run_as user %s: %w", cfg.User, err)
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, fmt.Errorf("run_as user %s has non-numeric uid %s", cfg.User, u.Uid)
+	}
+	gidStr := u.Gid
+	if cfg.Group != "" {
+		g, err := user.LookupGroup(cfg.Group)
+		if err != nil {
+			return 0, 0, fmt.Errorf("run_as group %s: %w", cfg.Group, err)
+		}
+		gidStr = g.Gid
+	}
+	if gid, err = strconv.Atoi(gidStr); err != nil {
+		return 0, 0, fmt.Errorf("run_as group has non-numeric gid %s", gidStr)
+	}
+	return uid, gid, nil
+}
+
+// auditLogFiles 在降权前准备审计日志，返回需要交给目标用户的路径。审计日志可能不在日志目录下：
+// 目录不存在时创建并交给目标用户；目录已存在时（如 /var/log）不改变其所有者，只预先创建文件，目标用户不能在该目录创建文件时也能追加。
+func auditLogFiles() []string {
+	var out []string
+	dir := filepath.Dir(paths.AuditLog)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			slog.Warn("failed to create audit log directory", "path", dir, "error", err)
+			return nil
+		}
+		out = append(out, dir)
+	}
+	f, err := os.OpenFile(paths.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		slog.Warn("failed to create audit log", "path", paths.AuditLog, "error", err)
+		return out
+	}
+	f.Close()
+	return append(out, paths.AuditLog)
+}
+
+// dropPrivileges 切换到配置的用户和组，并清空附加组。
+// 切换前将日志目录、日志文件、审计日志、配置快照、事件序号文件和控制套接字交给目标用户，
+// 使之后的日志轮转、审计记录、快照和序号更新以及控制命令仍然可以进行。
+func dropPrivileges(cfg *RunAsConfig) error {
+	uid, gid, err := resolveRunAs(cfg)
+	if err != nil {
+		return err
+	}
+	if os.Geteuid() == uid {
+		return nil // Already running as the target user.
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("switching to user %s requires starting as root (or CAP_SETUID and CAP_SETGID)", cfg.User)
+	}
+
+	handOver := append([]string{paths.LogDir, paths.Snapshot, filepath.Join(paths.LogDir, eventSeqFile), recordingIndexPath(), paths.Control}, logFiles()...)
+	for _, p := range append(handOver, auditLogFiles()...) {
+		if err := os.Chown(p, uid, gid); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to hand %s over to %s: %w", p, cfg.User, err)
+		}
+	}
+
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return withPermissionHint(fmt.Errorf("setgroups failed: %w", err), "requires CAP_SETGID")
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return withPermissionHint(fmt.Errorf("setgid %d failed: %w", gid, err), "requires CAP_SETGID")
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return withPermissionHint(fmt.Errorf("setuid %d failed: %w", uid, err), "requires CAP_SETUID")
+	}
+	return nil
+}
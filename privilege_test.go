@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestWithPermissionHint 测试权限错误提示
+func TestWithPermissionHint(t *testing.T) {
+	err := withPermissionHint(&os.PathError{Op: "open", Path: "/var/run/x.pid", Err: syscall.EACCES}, "run as root")
+	if !strings.Contains(err.Error(), "(run as root)") {
+		t.Errorf("expected hint in permission error, got %v", err)
+	}
+	if !errors.Is(err, syscall.EACCES) {
+		t.Error("expected hinted error to wrap the original error")
+	}
+
+	other := errors.New("disk full")
+	if withPermissionHint(other, "run as root") != other {
+		t.Error("expected non-permission errors to be returned unchanged")
+	}
+}
+
+// TestResolveRunAs 测试用户和组解析
+func TestResolveRunAs(t *testing.T) {
+	uid, gid, err := resolveRunAs(&RunAsConfig{User: "root"})
+	if err != nil {
+		t.Fatalf("resolveRunAs failed: %v", err)
+	}
+	if uid != 0 || gid != 0 {
+		t.Errorf("expected root to resolve to 0:0, got %d:%d", uid, gid)
+	}
+
+	if _, _, err := resolveRunAs(&RunAsConfig{User: "no-such-user-xyz"}); err == nil {
+		t.Error("expected error for unknown user")
+	}
+}
+
+// TestAuditLogFiles 测试降权前预先创建审计日志，只接管新建的目录
+func TestAuditLogFiles(t *testing.T) {
+	saved := paths.AuditLog
+	defer func() { paths.AuditLog = saved }()
+	existing := t.TempDir()
+	paths.AuditLog = filepath.Join(existing, "audit.log")
+	if got := auditLogFiles(); len(got) != 1 || got[0] != paths.AuditLog {
+		t.Errorf("existing directory: %v", got)
+	}
+	if info, err := os.Stat(paths.AuditLog); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("audit log not created with mode 0600: %v %v", info, err)
+	}
+	paths.AuditLog = filepath.Join(existing, "audit", "audit.log")
+	if got := auditLogFiles(); len(got) != 2 || got[0] != filepath.Dir(paths.AuditLog) {
+		t.Errorf("new directory: %v", got)
+	}
+}
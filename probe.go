@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// probeTimeout 是单次 ffprobe 探测允许的最长时间。
+const probeTimeout = 15 * time.Second
+
+// incompatibleRetryDelay 是源流编码与输出封装不兼容时的重试间隔，
+// 避免在配置修正前频繁重启 ffmpeg。
+const incompatibleRetryDelay = 30 * time.Second
+
+// errIncompatible 表示源流编码无法直接封装到目标格式。
+var errIncompatible = errors.New("incompatible source")
+
+// probeStream 是 ffprobe 输出中单条媒体流的信息。
+type probeStream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Profile      string `json:"profile"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FieldOrder   string `json:"field_order"`
+	RFrameRate   string `json:"r_frame_rate"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	SampleRate   string `json:"sample_rate"`
+	Channels     int    `json:"channels"`
+}
+
+// probeResult 是 ffprobe 对源流的探测结果。
+type probeResult struct {
+	FormatName string
+	// Duration 是输入的总时长，直播流等未知时为 0。
+	Duration time.Duration
+	Streams  []probeStream
+}
+
+// Video 返回第一条视频流，不存在时返回 nil。
+func (r *probeResult) Video() *probeStream {
+	return r.first("video")
+}
+
+// Audio 返回第一条音频流，不存在时返回 nil。
+func (r *probeResult) Audio() *probeStream {
+	return r.first("audio")
+}
+
+func (r *probeResult) first(codecType string) *probeStream {
+	for i := range r.Streams {
+		if r.Streams[i].CodecType == codecType {
+			return &r.Streams[i]
+		}
+	}
+	return nil
+}
+
+// codecSummary 返回音视频编码的简短描述，如 "hevc/aac"。
+func (r *probeResult) codecSummary() string {
+	video, audio := "none", "none"
+	if v := r.Video(); v != nil {
+		video = v.CodecName
+	}
+	if a := r.Audio(); a != nil {
+		audio = a.CodecName
+	}
+	return video + "/" + audio
+}
+
+// parseProbeOutput 解析 ffprobe -print_format json 的输出。
+func parseProbeOutput(data []byte) (*probeResult, error) {
+	var raw struct {
+		Streams []probeStream `json:"streams"`
+		Format  struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if len(raw.Streams) == 0 {
+		return nil, fmt.Errorf("ffprobe found no streams in source")
+	}
+	result := &probeResult{FormatName: raw.Format.FormatName, Streams: raw.Streams}
+	if secs, err := strconv.ParseFloat(raw.Format.Duration, 64); err == nil && secs > 0 {
+		result.Duration = time.Duration(secs * float64(time.Second))
+	}
+	return result, nil
+}
+
+// probeSource 使用 ffprobe 探测源流的封装和编码信息。
+func probeSource(cfg StreamConfig, ep *resolvedEndpoints) (*probeResult, error) {
+	args := append(probeInputArgs(cfg, ep), "-show_format", "-show_streams", ep.Src)
+	out, err := runFFprobe(cfg.Sandbox, probeTimeout, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbeOutput(out)
+}
+
+// probeInputArgs 返回 ffprobe 读取源流所需的公共参数（不含输入地址）。
+func probeInputArgs(cfg StreamConfig, ep *resolvedEndpoints) []string {
+	args := []string{"-v", "error", "-print_format", "json", "-rw_timeout", "5000000"}
+	if whitelist := protocolWhitelist(cfg); whitelist != "" {
+		args = append(args, "-protocol_whitelist", whitelist)
+	}
+	if ep.SrcAddr != "" {
+		args = append(args, "-local_addr", ep.SrcAddr)
+	}
+	if ep.SrcTCURL != "" {
+		args = append(args, "-rtmp_tcurl", ep.SrcTCURL)
+	}
+	return args
+}
+
+// runFFprobe 按 sb 加固后执行 ffprobe 并返回标准输出，失败时错误中包含 ffprobe 的错误输出。
+// ffprobe 与 ffmpeg 一样解析不受信任的源流，因此使用同一沙箱；超过 timeout 时终止整个进程组。
+func runFFprobe(sb *SandboxConfig, timeout time.Duration, args []string) ([]byte, error) {
+	cmd, err := newSandboxedCommand(sb, ffprobeBin, args)
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	timer := time.AfterFunc(timeout, func() {
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			slog.Warn("failed to kill ffprobe after timeout", "pid", cmd.Process.Pid, "error", err)
+		}
+	})
+	err = cmd.Wait()
+	timer.Stop()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("ffprobe failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// outputFormat 返回流的输出封装格式：优先使用显式配置，否则根据目标地址推断。
+func outputFormat(cfg StreamConfig) string {
+	if cfg.Format != "" {
+		return cfg.Format
+	}
+	return formatForDst(cfg.Dst)
+}
+
+// formatForDst 根据地址的协议和扩展名推断输出封装格式，无法推断时为 flv。
+func formatForDst(dst string) string {
+	u, err := url.Parse(dst)
+	if err != nil {
+		return "flv"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "rtmp", "rtmps", "rtmpt", "rtmpe":
+		return "flv"
+	case "srt", "udp", "rtp", "tcp":
+		return "mpegts"
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u8":
+		return "hls"
+	case ".ts":
+		return "mpegts"
+	case ".mp4":
+		return "mp4"
+	case ".mkv":
+		return "matroska"
+	}
+	return "flv"
+}
+
+// containerCodecs 列出各输出封装在流复制模式下支持的视频和音频编码。
+// 未列出的封装不做兼容性检查。
+var containerCodecs = map[string]struct{ video, audio []string }{
+	"flv":    {video: []string{"h264"}, audio: []string{"aac", "mp3"}},
+	"mpegts": {video: []string{"h264", "hevc", "mpeg2video"}, audio: []string{"aac", "mp3", "mp2", "ac3", "eac3", "opus"}},
+	"hls":    {video: []string{"h264", "hevc"}, audio: []string{"aac", "mp3", "ac3", "eac3"}},
+	"mp4":    {video: []string{"h264", "hevc", "av1", "vp9"}, audio: []string{"aac", "mp3", "ac3", "eac3", "opus"}},
+}
+
+// enhancedFLVVideo 是 enhanced RTMP 在 FLV 中额外支持的视频编码。
+var enhancedFLVVideo = []string{"hevc", "av1", "vp9"}
+
+// outputPlan 描述本次启动 ffmpeg 时采用的输出方式。
+type outputPlan struct {
+	// Format 是输出封装格式。
+	Format string
+	// Profile 是转码回退使用的配置，为 nil 时全部流复制。
+	Profile *TranscodeProfile
+	// TranscodeVideo 表示视频需要按 Profile 转码。
+	TranscodeVideo bool
+	// TranscodeAudio 表示音频需要按 Profile 转码。
+	TranscodeAudio bool
+	// Fallback 表示因源流不满足输出要求而回退到转码。
+	Fallback bool
+	// KeyframeInterval 是视频转码时强制的关键帧间隔，为 0 时不强制。
+	KeyframeInterval time.Duration
+	// BurnIn 是叠加到视频上的调试文字滤镜，为空时不叠加。
+	BurnIn string
+	// Deinterlace 是去隔行滤镜，为空时不去隔行。
+	Deinterlace string
+	// FrameRate 是帧率转换滤镜，为空时保持源帧率。
+	FrameRate string
+}
+
+// codecArgs 返回输出编码参数，兼容的流保持复制。
+func (p outputPlan) codecArgs() []string {
+	if p.Profile == nil || (!p.TranscodeVideo && !p.TranscodeAudio) {
+		return []string{"-c", "copy"}
+	}
+	var args []string
+	if p.TranscodeVideo {
+		// Deinterlace and convert frame rate before scaling; overlays go last so they stay sharp.
+		var before, after []string
+		if p.Deinterlace != "" {
+			before = append(before, p.Deinterlace)
+		}
+		if p.FrameRate != "" {
+			before = append(before, p.FrameRate)
+		}
+		if p.BurnIn != "" {
+			after = append(after, p.BurnIn)
+		}
+		args = append(args, p.Profile.videoArgs(before, after)...)
+		if p.KeyframeInterval > 0 {
+			args = append(args, "-force_key_frames",
+				fmt.Sprintf("expr:gte(t,n_forced*%g)", p.KeyframeInterval.Seconds()))
+		}
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	if p.TranscodeAudio {
+		args = append(args, p.Profile.audioArgs()...)
+	} else {
+		args = append(args, "-c:a", "copy")
+	}
+	return args
+}
+
+// planOutput 根据流配置和可选的探测结果确定输出方式。
+// 源流编码无法放入目标封装时，如果提供了转码配置则对不兼容的流转码，否则返回 errIncompatible。
+func planOutput(cfg StreamConfig, probe *probeResult, profile *TranscodeProfile) (outputPlan, error) {
+	plan := outputPlan{Format: outputFormat(cfg), KeyframeInterval: cfg.KeyframeInterval}
+	enhanced := cfg.EnhancedRTMP && plan.Format == "flv"
+	if enhanced && !ffmpegAtLeast(ffmpegVersion, 6, 1) {
+		return plan, fmt.Errorf("%w: enhanced_rtmp requires ffmpeg 6.1 or newer, found %q",
+			errIncompatible, ffmpegVersion)
+	}
+	if probe == nil {
+		return plan, nil
+	}
+	// Every output shares the same encoded streams, so each container must accept them.
+	for i, format := range outputFormats(cfg) {
+		codecs, ok := containerCodecs[format]
+		if !ok {
+			continue
+		}
+		if i == 0 && enhanced {
+			codecs.video = append(append([]string(nil), codecs.video...), enhancedFLVVideo...)
+		}
+		if v := probe.Video(); v != nil && !containsString(codecs.video, v.CodecName) {
+			if profile == nil {
+				return plan, fmt.Errorf("%w: video codec %s cannot be muxed into %s (supported: %s)",
+					errIncompatible, v.CodecName, format, strings.Join(codecs.video, ", "))
+			}
+			plan.TranscodeVideo = true
+		}
+		if a := probe.Audio(); a != nil && !containsString(codecs.audio, a.CodecName) {
+			if profile == nil {
+				return plan, fmt.Errorf("%w: audio codec %s cannot be muxed into %s (supported: %s)",
+					errIncompatible, a.CodecName, format, strings.Join(codecs.audio, ", "))
+			}
+			plan.TranscodeAudio = true
+		}
+	}
+	if plan.TranscodeVideo || plan.TranscodeAudio {
+		plan.Profile = profile
+		plan.Fallback = true
+	}
+	return plan, nil
+}
+
+// planBurnIn 在调试叠加生效期间强制视频走转码路径并加入叠加滤镜。
+func planBurnIn(plan outputPlan, cfg StreamConfig, profile *TranscodeProfile, now time.Time) outputPlan {
+	if !burnInActive(cfg, now) {
+		return plan
+	}
+	plan = forceVideoTranscode(plan, profile)
+	plan.BurnIn = burnInFilter(cfg.ID)
+	return plan
+}
+
+// containsString 判断切片中是否包含指定字符串。
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
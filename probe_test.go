@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestOutputFormat 测试根据目标地址推断输出封装
+func TestOutputFormat(t *testing.T) {
+	cases := map[string]string{
+		"rtmp://dest.com/live/key":     "flv",
+		"srt://dest.com:9000":          "mpegts",
+		"udp://239.0.0.1:1234":         "mpegts",
+		"/var/www/hls/live/index.m3u8": "hls",
+		"/data/record/out.mp4":         "mp4",
+		"https://example.com/ingest":   "flv",
+	}
+	for dst, want := range cases {
+		if got := outputFormat(StreamConfig{Dst: dst}); got != want {
+			t.Errorf("outputFormat(%q) = %q, want %q", dst, got, want)
+		}
+	}
+	if got := outputFormat(StreamConfig{Dst: "rtmp://dest.com/live", Format: "mpegts"}); got != "mpegts" {
+		t.Errorf("expected explicit format to win, got %q", got)
+	}
+}
+
+// TestPlanOutput 测试探测结果与输出封装的兼容性检查
+func TestPlanOutput(t *testing.T) {
+	probe, err := parseProbeOutput([]byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080},
+			{"codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"format_name": "flv"}
+	}`))
+	if err != nil {
+		t.Fatalf("parseProbeOutput failed: %v", err)
+	}
+	if v := probe.Video(); v == nil || v.Width != 1920 {
+		t.Fatalf("unexpected video stream: %+v", v)
+	}
+
+	if _, err := planOutput(StreamConfig{Dst: "rtmp://dest.com/live"}, probe, nil); !errors.Is(err, errIncompatible) {
+		t.Errorf("expected hevc into flv to be incompatible, got %v", err)
+	}
+	plan, err := planOutput(StreamConfig{Dst: "srt://dest.com:9000"}, probe, nil)
+	if err != nil || plan.Format != "mpegts" {
+		t.Errorf("expected hevc into mpegts to be accepted, got %+v %v", plan, err)
+	}
+	ffmpegVersion = "ffmpeg version 6.1.1"
+	defer func() { ffmpegVersion = "" }()
+	if _, err := planOutput(StreamConfig{Dst: "rtmp://dest.com/live", EnhancedRTMP: true}, probe, nil); err != nil {
+		t.Errorf("expected hevc passthrough with enhanced_rtmp, got %v", err)
+	}
+	ffmpegVersion = "ffmpeg version 5.1.4"
+	if _, err := planOutput(StreamConfig{Dst: "rtmp://dest.com/live", EnhancedRTMP: true}, probe, nil); !errors.Is(err, errIncompatible) {
+		t.Errorf("expected enhanced_rtmp to require ffmpeg 6.1, got %v", err)
+	}
+	if _, err := parseProbeOutput([]byte(`{"streams": []}`)); err == nil {
+		t.Error("expected error for source without streams")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// DefaultReadyPercent 是 /readyz 默认要求运行中的流所占的百分比。
+const DefaultReadyPercent = 100
+
+// readyz 是 /readyz 的响应。
+type readyz struct {
+	// Ready 表示运行中的流是否达到要求的比例。
+	Ready bool `json:"ready"`
+	// Running 是 ffmpeg 正在运行的流数。
+	Running int `json:"running"`
+	// Expected 是应当运行的流数，不含节目表安排停播和通过管理接口停止的流。
+	Expected int `json:"expected"`
+	// RequiredPercent 是要求运行中的流所占的百分比。
+	RequiredPercent float64 `json:"required_percent"`
+	// Draining 表示守护进程正在排空，此时总是未就绪。
+	Draining bool `json:"draining,omitempty"`
+}
+
+// readyPercent 返回 /readyz 要求的百分比。
+func readyPercent(state *AppState) float64 {
+	if m := metricsConfig(state); m != nil && m.ReadyPercent > 0 {
+		return m.ReadyPercent
+	}
+	return DefaultReadyPercent
+}
+
+// readyzStatus 统计运行中的流，判断是否达到要求的比例。没有应当运行的流时视为就绪。
+func readyzStatus(state *AppState) readyz {
+	r := readyz{RequiredPercent: readyPercent(state)}
+	for _, w := range state.workers.snapshot() {
+		if w.IsRunning() {
+			r.Running++
+			r.Expected++
+		} else if !w.isOffSchedule() && !w.isStopped() {
+			r.Expected++
+		}
+	}
+	r.Draining = draining()
+	r.Ready = !r.Draining && (r.Expected == 0 || float64(r.Running)*100 >= r.RequiredPercent*float64(r.Expected))
+	return r
+}
+
+// handleHealthz 处理 GET /healthz：进程能响应请求即返回 200，用作存活探针。
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz 处理 GET /readyz：运行中的流达到 metrics.ready_percent 时返回 200，否则返回 503，用作就绪探针。
+func handleReadyz(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		r := readyzStatus(state)
+		w.Header().Set("Content-Type", "application/json")
+		if !r.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(r); err != nil {
+			slog.Warn("failed to write readiness", "error", err)
+		}
+	}
+}
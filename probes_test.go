@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestReadyz 测试 /readyz 按 ready_percent 判断就绪，节目表停播的流不计入，/healthz 始终返回 200
+func TestReadyz(t *testing.T) {
+	state := &AppState{
+		config: &Config{},
+		workers: newWorkerMap(map[string]*StreamWorker{
+			"a":   {running: true},
+			"b":   {running: true},
+			"c":   {},
+			"off": {offSchedule: true},
+		}),
+	}
+	mux := newMetricsMux(state, "")
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("healthz: %d", rec.Code)
+	}
+	rec := get("/readyz")
+	var r readyz
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || r.Ready || r.Running != 2 || r.Expected != 3 {
+		t.Errorf("readyz: %d %+v", rec.Code, r)
+	}
+
+	state.config.Metrics = &MetricsConfig{ReadyPercent: 60}
+	if rec := get("/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("readyz at 60%%: %d %s", rec.Code, rec.Body)
+	}
+	state.config.Metrics.ReadyPercent = 70
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz at 70%%: %d %s", rec.Code, rec.Body)
+	}
+
+	if err := (&MetricsConfig{ReadyPercent: 101}).validate(); err == nil {
+		t.Error("ready_percent above 100 accepted")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// procSampleInterval 是采样 ffmpeg 子进程资源占用的间隔。
+const procSampleInterval = 10 * time.Second
+
+// processStats 是 ffmpeg 子进程当前的资源占用。
+type processStats struct {
+	// CPUPercent 是最近一个采样周期的 CPU 使用率，100 表示占满一个核。
+	CPUPercent float64
+	// RSS 是常驻内存字节数。
+	RSS int64
+	// ReadBytes 是本次运行读取的字节数（含网络）。
+	ReadBytes int64
+	// WriteBytes 是本次运行写出的字节数（含网络）。
+	WriteBytes int64
+	// FDs 是打开的文件描述符数量。
+	FDs int
+}
+
+// procSample 是一次 /proc 采样结果。
+type procSample struct {
+	// cpu 是进程累计的 CPU 时间。
+	cpu   time.Duration
+	stats processStats
+}
+
+// ResourceLimits 表示 ffmpeg 子进程的资源告警阈值，超过时发出 resource_exceeded 事件。
+type ResourceLimits struct {
+	// MaxCPUPercent 是 CPU 使用率阈值（100 表示一个核）。
+	MaxCPUPercent float64 `yaml:"max_cpu_percent,omitempty"`
+	// MaxRSS 是常驻内存阈值，如 512MB。
+	MaxRSS ByteSize `yaml:"max_rss,omitempty"`
+	// MaxRSSMB 是以 MB 为单位的 MaxRSS，已弃用。
+	MaxRSSMB int64 `yaml:"max_rss_mb,omitempty"`
+	// MaxFDs 是打开文件描述符数量阈值。
+	MaxFDs int `yaml:"max_fds,omitempty"`
+}
+
+// validate 校验资源阈值。
+func (l *ResourceLimits) validate() error {
+	if l.MaxCPUPercent < 0 || l.MaxRSS < 0 || l.MaxRSSMB < 0 || l.MaxFDs < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if l.MaxRSSMB > 0 && l.MaxRSS != ByteSize(l.MaxRSSMB)<<20 {
+		return fmt.Errorf("max_rss and the deprecated max_rss_mb are mutually exclusive")
+	}
+	return nil
+}
+
+// exceeded 返回超过阈值的资源描述，未超过时返回空串。
+func (l *ResourceLimits) exceeded(s processStats) string {
+	var out []string
+	if l.MaxCPUPercent > 0 && s.CPUPercent > l.MaxCPUPercent {
+		out = append(out, fmt.Sprintf("cpu %.0f%% > %.0f%%", s.CPUPercent, l.MaxCPUPercent))
+	}
+	if l.MaxRSS > 0 && s.RSS > int64(l.MaxRSS) {
+		out = append(out, fmt.Sprintf("rss %s > %s", ByteSize(s.RSS>>20<<20), l.MaxRSS))
+	}
+	if l.MaxFDs > 0 && s.FDs > l.MaxFDs {
+		out = append(out, fmt.Sprintf("fds %d > %d", s.FDs, l.MaxFDs))
+	}
+	return strings.Join(out, ", ")
+}
+
+// cpuPercent 根据两次采样计算 CPU 使用率。
+func cpuPercent(prev, cur procSample, elapsed time.Duration) float64 {
+	if elapsed <= 0 || cur.cpu < prev.cpu {
+		return 0
+	}
+	return float64(cur.cpu-prev.cpu) / float64(elapsed) * 100
+}
+
+// procMonitor 定期采样所有运行中的 ffmpeg 子进程，记录资源占用并检查阈值。
+type procMonitor struct {
+	state *AppState
+	// prev 是每路流上一次的采样，按 pid 区分不同的运行。
+	prev map[string]procMonitorEntry
+	// alerting 记录当前处于超限状态的流。
+	alerting map[string]bool
+}
+
+// procMonitorEntry 是某路流上一次的采样。
+type procMonitorEntry struct {
+	pid    int
+	at     time.Time
+	sample procSample
+}
+
+// newProcMonitor 创建资源监控器。
+func newProcMonitor(state *AppState) *procMonitor {
+	return &procMonitor{state: state, prev: make(map[string]procMonitorEntry), alerting: make(map[string]bool)}
+}
+
+// run 每个采样周期读取一次所有子进程的 /proc 数据。
+func (m *procMonitor) run() {
+	ticker := time.NewTicker(procSampleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		workers := m.state.workers.snapshot()
+
+		for id := range m.prev {
+			if _, ok := workers[id]; !ok {
+				delete(m.prev, id)
+				delete(m.alerting, id)
+			}
+		}
+		for id, w := range workers {
+			m.sample(id, w, now)
+		}
+	}
+}
+
+// sample 采样一路流并更新统计和告警状态。
+func (m *procMonitor) sample(id string, w *StreamWorker, now time.Time) {
+	pid := w.pid()
+	if pid == 0 {
+		delete(m.prev, id)
+		return
+	}
+	cur, err := readProcSample(pid)
+	if err != nil {
+		slog.Debug("failed to sample ffmpeg process", "stream_id", id, "pid", pid, "error", err)
+		return
+	}
+	if prev, ok := m.prev[id]; ok && prev.pid == pid {
+		cur.stats.CPUPercent = cpuPercent(prev.sample, cur, now.Sub(prev.at))
+	}
+	m.prev[id] = procMonitorEntry{pid: pid, at: now, sample: cur}
+	w.recordProcStats(pid, cur.stats)
+
+	cfg := w.config()
+	if cfg.Resources == nil {
+		return
+	}
+	over := cfg.Resources.exceeded(cur.stats)
+	switch {
+	case over != "" && !m.alerting[id]:
+		m.alerting[id] = true
+		emitEvent(id, "resource_exceeded", over)
+	case over == "" && m.alerting[id]:
+		m.alerting[id] = false
+		emitEvent(id, "resource_recovered")
+	}
+}
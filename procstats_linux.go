@@ -0,0 +1,61 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks 是 /proc/<pid>/stat 中 CPU 时间的单位（USER_HZ），Linux 上固定为 100。
+const clockTicks = 100
+
+// readProcSample 从 /proc/<pid> 读取进程的资源占用。
+// /proc/<pid>/io 只有同一用户或 root 可读，读取失败时 I/O 字段为 0。
+func readProcSample(pid int) (procSample, error) {
+	var s procSample
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return s, err
+	}
+	// The command name may contain spaces and parentheses; fields start after the last ')'.
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return s, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return s, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	// fields[0] is field 3 (state): utime=14, stime=15, rss=24.
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	s.cpu = time.Duration(utime+stime) * time.Second / clockTicks
+	s.stats.RSS = rss * int64(os.Getpagesize())
+
+	if f, err := os.Open(fmt.Sprintf("/proc/%d/io", pid)); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), ":")
+			n, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			// rchar/wchar include socket traffic, which is most of ffmpeg's I/O.
+			switch key {
+			case "rchar":
+				s.stats.ReadBytes = n
+			case "wchar":
+				s.stats.WriteBytes = n
+			}
+		}
+		_ = f.Close()
+	}
+
+	if entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+		s.stats.FDs = len(entries)
+	}
+	return s, nil
+}
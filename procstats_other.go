@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readProcSample 在没有 /proc 的平台上总是返回错误。
+func readProcSample(_ int) (procSample, error) {
+	return procSample{}, errors.New("process stats are only supported on linux")
+}
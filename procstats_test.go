@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestReadProcSample 测试读取当前进程的 /proc 数据
+func TestReadProcSample(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process stats are only supported on linux")
+	}
+	s, err := readProcSample(os.Getpid())
+	if err != nil {
+		t.Fatalf("readProcSample failed: %v", err)
+	}
+	if s.stats.RSS <= 0 || s.stats.FDs <= 0 {
+		t.Errorf("stats = %+v, want positive rss and fds", s.stats)
+	}
+}
+
+// TestResourceLimits 测试 CPU 使用率计算和阈值判断
+func TestResourceLimits(t *testing.T) {
+	prev := procSample{cpu: time.Second}
+	cur := procSample{cpu: 16 * time.Second}
+	if got := cpuPercent(prev, cur, 10*time.Second); got != 150 {
+		t.Errorf("cpuPercent = %v, want 150", got)
+	}
+
+	limits := &ResourceLimits{MaxCPUPercent: 100, MaxRSS: 512 << 20}
+	if got := limits.exceeded(processStats{CPUPercent: 150, RSS: 100 << 20}); got != "cpu 150% > 100%" {
+		t.Errorf("exceeded = %q", got)
+	}
+	if got := limits.exceeded(processStats{CPUPercent: 50, RSS: 512 << 20, FDs: 1000}); got != "" {
+		t.Errorf("exceeded = %q, want empty", got)
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 清除结果中的说明，是 purge.note.* 文案的消息 ID 后缀。
+const (
+	// purgeNoteStillConfigured 表示流仍在配置中，配置文件里的地址未删除。
+	purgeNoteStillConfigured = "still_configured"
+	// purgeNoteNotConfigured 表示流不在配置中，无法定位录制文件。
+	purgeNoteNotConfigured = "not_configured"
+	// purgeNoteStdout 表示输出到 stdout/stderr 的 ffmpeg 日志不在清除范围内。
+	purgeNoteStdout = "stdout_not_covered"
+)
+
+// purgeResult 是清除一路流的数据的结果。
+type purgeResult struct {
+	StreamID string `json:"stream_id"`
+	// LogRecords 是从主日志和轮转日志中删除的行数。
+	LogRecords int `json:"log_records"`
+	// BufferedLogs 是从 /logs 内存缓冲区中删除的记录数。
+	BufferedLogs int `json:"buffered_logs"`
+	// Recordings 是删除的录制文件、归档副本和 HLS 分片。
+	Recordings []string `json:"recordings,omitempty"`
+	// ReportRecords 是从 reports.dir 下的用量报表中删除的记录数。
+	ReportRecords int `json:"report_records"`
+	// Jobs 是取消或删除的归档任务数。
+	Jobs int `json:"jobs"`
+	// ConfigCopies 是删除了该流的配置备份和快照文件。
+	ConfigCopies []string `json:"config_copies,omitempty"`
+	// Notes 是未能覆盖的数据，取值为 purgeNote* 常量，CLI 按语言输出对应的说明。
+	Notes []string `json:"notes,omitempty"`
+}
+
+// purgeStream 删除流在本机保存的全部数据：日志（持有主日志的写入锁，守护进程此时写入的记录不会丢失）、
+// 内存日志缓冲区、录制文件、用量报表、归档任务，以及配置备份和快照中该流的条目。
+// 录制位置取自 cfg 中的流和录制位置索引，流已从配置中删除时也能找到；报表目录取自 cfg。
+// 某一项失败时继续清除其余各项，返回汇总的错误。
+func purgeStream(cfg *Config, id string) (purgeResult, error) {
+	res := purgeResult{StreamID: id}
+	var errs []error
+	n, err := mainLog.purge(id)
+	res.LogRecords = n
+	errs = append(errs, err)
+	if r := logRing.Load(); r != nil {
+		res.BufferedLogs = r.purge(id)
+	}
+
+	var stream *StreamConfig
+	if cfg != nil {
+		for i := range cfg.Streams {
+			if cfg.Streams[i].ID == id {
+				stream = &cfg.Streams[i]
+			}
+		}
+	}
+	// Locations the stream used earlier, including after it was removed from the config.
+	outputs, err := recordedOutputs(id)
+	errs = append(errs, err)
+	if stream != nil {
+		outputs = append(localOutputs(*stream), outputs...)
+		res.Notes = append(res.Notes, purgeNoteStillConfigured)
+	} else if len(outputs) == 0 {
+		res.Notes = append(res.Notes, purgeNoteNotConfigured)
+	}
+	res.Recordings, err = purgeRecordings(outputs)
+	errs = append(errs, err)
+	if stream == nil {
+		errs = append(errs, forgetRecordings(id))
+	}
+	if cfg != nil && cfg.Reports != nil && cfg.Reports.Dir != "" {
+		res.ReportRecords, err = purgeReports(cfg.Reports.Dir, id)
+		errs = append(errs, err)
+	}
+	if q := jobs.Load(); q != nil {
+		res.Jobs = q.forgetStream(id)
+	}
+	for _, path := range []string{paths.Config + ".bak", paths.Snapshot} {
+		changed, err := purgeConfigCopy(path, id)
+		if changed {
+			res.ConfigCopies = append(res.ConfigCopies, path)
+		}
+		errs = append(errs, err)
+	}
+	if stream == nil {
+		forgetEvents(id)
+	}
+	res.Notes = append(res.Notes, purgeNoteStdout)
+	return res, errors.Join(errs...)
+}
+
+// purgeLogFile 删除日志文件中属于指定流的行，返回删除的行数。
+// 文件原地重写以保持 inode 不变；守护进程运行时由 logFile.purge 在持有写入锁时调用，重写期间不会有新的记录写入。
+func purgeLogFile(path, streamID string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if logLineMatchesStream(line, streamID) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := os.WriteFile(path, kept.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to rewrite %s: %w", path, err)
+	}
+	return removed, nil
+}
+
+// logLineMatchesStream 判断一行日志是否属于指定流。
+// 支持 slog JSON 记录（stream_id 字段）和 StreamLogWriter 的 "[时间] [流ID] 内容" 格式。
+func logLineMatchesStream(line []byte, streamID string) bool {
+	var record struct {
+		StreamID string `json:"stream_id"`
+	}
+	if json.Unmarshal(line, &record) == nil {
+		return record.StreamID == streamID
+	}
+	return bytes.Contains(line, []byte("] ["+streamID+"] "))
+}
+
+// localOutputs 返回流输出到本机文件的输出（dst 和附加输出中的绝对路径）。
+func localOutputs(s StreamConfig) []StreamOutput {
+	var out []StreamOutput
+	for _, o := range append([]StreamOutput{{Name: primaryOutputName, Dst: s.Dst, Format: s.Format}}, s.Outputs...) {
+		if target := o.target(); !strings.Contains(target, "://") && filepath.IsAbs(target) {
+			out = append(out, StreamOutput{Name: o.Name, Dst: o.Dst, Format: o.Format})
+		}
+	}
+	return out
+}
+
+// purgeRecordings 删除本地输出的文件：单文件录制及节目归档改名后的副本、HLS 的播放列表和分片。
+// 同一位置出现多次时只处理一次。
+func purgeRecordings(outputs []StreamOutput) ([]string, error) {
+	var removed []string
+	var errs []error
+	seen := make(map[string]bool, len(outputs))
+	for _, o := range outputs {
+		if seen[o.Dst] {
+			continue
+		}
+		seen[o.Dst] = true
+		files, err := recordingFiles(o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("output %s: %w", o.Name, err))
+			continue
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+				continue
+			}
+			removed = append(removed, f)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// recordingFiles 返回本地输出在磁盘上的文件。以 / 结尾的 HLS 目录属于该输出，其中的文件全部返回；
+// 其他 HLS 播放列表返回它和 ffmpeg 默认命名的分片（<名称><序号>.<扩展名>）；单文件录制返回它和 archivedName 改名的副本。
+func recordingFiles(o StreamOutput) ([]string, error) {
+	target := filepath.Clean(o.target())
+	dir, name := filepath.Split(target)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hls := o.format() == "hls"
+	dedicated := hls && strings.HasSuffix(o.Dst, "/")
+	var out []string
+	for _, e := range entries {
+		n := e.Name()
+		if !e.Type().IsRegular() {
+			continue
+		}
+		match := n == name || dedicated
+		if !match && hls {
+			rest := strings.TrimPrefix(n, base)
+			digits := strings.TrimLeft(rest, "0123456789")
+			match = rest != n && len(digits) < len(rest) && strings.HasPrefix(digits, ".")
+		}
+		if !match && !hls && strings.HasPrefix(n, base+"-") && strings.HasSuffix(n, ext) {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(n, base+"-"), ext)
+			_, err := time.Parse(archiveTimeLayout, stamp)
+			match = err == nil
+		}
+		if match {
+			out = append(out, filepath.Join(dir, n))
+		}
+	}
+	return out, nil
+}
+
+// recordingIndexFile 是日志目录中记录各路流本地输出位置的文件名。
+const recordingIndexFile = "recordings.json"
+
+// recordingIndexMu 串行化录制位置索引的读写。
+var recordingIndexMu sync.Mutex
+
+// recordingIndexPath 返回录制位置索引的路径。
+func recordingIndexPath() string {
+	return filepath.Join(paths.LogDir, recordingIndexFile)
+}
+
+// readRecordingIndex 读取录制位置索引：流 ID 到其用过的本地输出，文件不存在时返回空索引。调用方需持有 recordingIndexMu。
+func readRecordingIndex() (map[string][]StreamOutput, error) {
+	index := make(map[string][]StreamOutput)
+	data, err := os.ReadFile(recordingIndexPath())
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %w", recordingIndexPath(), err)
+	}
+	return index, nil
+}
+
+// rememberRecordings 把流的本地输出位置合并到索引中，在配置生效和新增临时流时调用。
+// 流被删除或改了输出地址后旧位置仍然保留，之后清除该流时可以找到它的录制文件；清除后才从索引中删除。
+func rememberRecordings(streams []StreamConfig) {
+	recordingIndexMu.Lock()
+	defer recordingIndexMu.Unlock()
+	index, err := readRecordingIndex()
+	if err != nil {
+		slog.Warn("failed to read recording index", "error", err)
+		return
+	}
+	changed := false
+	for _, s := range streams {
+		for _, o := range localOutputs(s) {
+			known := false
+			for _, k := range index[s.ID] {
+				known = known || k.Dst == o.Dst
+			}
+			if !known {
+				index[s.ID] = append(index[s.ID], o)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(recordingIndexPath(), data)
+	}
+	if err != nil {
+		slog.Warn("failed to write recording index", "error", withPermissionHint(err,
+			"after dropping privileges the log directory must be writable by run_as user"))
+	}
+}
+
+// recordedOutputs 返回索引中记录的流用过的本地输出。
+func recordedOutputs(id string) ([]StreamOutput, error) {
+	recordingIndexMu.Lock()
+	defer recordingIndexMu.Unlock()
+	index, err := readRecordingIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index[id], nil
+}
+
+// forgetRecordings 从索引中删除流的条目。
+func forgetRecordings(id string) error {
+	recordingIndexMu.Lock()
+	defer recordingIndexMu.Unlock()
+	index, err := readRecordingIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[id]; !ok {
+		return nil
+	}
+	delete(index, id)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(recordingIndexPath(), data)
+}
+
+// purgeReports 删除 dir 下用量报表文件中属于该流的记录，返回删除的记录数。
+func purgeReports(dir, streamID string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "usage-*"))
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	var errs []error
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var out []byte
+		removed := 0
+		switch filepath.Ext(path) {
+		case ".json":
+			var records []usageRecord
+			if err := json.Unmarshal(data, &records); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+			kept := records[:0]
+			for _, r := range records {
+				if r.StreamID == streamID {
+					removed++
+					continue
+				}
+				kept = append(kept, r)
+			}
+			out, err = encodeUsageReport("json", kept)
+		case ".csv":
+			out, removed, err = purgeCSVReport(data, streamID)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if removed == 0 {
+			continue
+		}
+		if err := writeFileAtomic(path, out); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total += removed
+	}
+	return total, errors.Join(errs...)
+}
+
+// purgeCSVReport 删除 CSV 报表中第一列为 streamID 的行，保留表头。
+func purgeCSVReport(data []byte, streamID string) ([]byte, int, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	removed := 0
+	for i, row := range rows {
+		if i > 0 && len(row) > 0 && row[0] == streamID {
+			removed++
+			continue
+		}
+		if err := w.Write(row); err != nil {
+			return nil, 0, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), removed, w.Error()
+}
+
+// purgeConfigCopy 从配置备份或快照文件的 streams 列表中删除该流，返回是否修改了文件。文件不存在时不做任何事。
+func purgeConfigCopy(path, streamID string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	removed := false
+	doc, err := editConfigStreams(data, func(streams *yaml.Node) error {
+		removed = streamNodeIndex(streams, streamID) >= 0
+		removeStreamNode(streams, streamID)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if !removed {
+		return false, nil
+	}
+	if err := writeFileAtomic(path, doc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handlePurge 处理 POST /purge/{id}：在守护进程内清除流的数据，正文 {"confirm": "<id>"} 必须重复流 ID。
+// 流正在运行时返回 409，需要先停止或删除。
+func handlePurge(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/purge/")
+		if id == "" || strings.Contains(id, "/") {
+			writeAPIError(w, http.StatusNotFound, "not found")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req struct {
+			Confirm string `yaml:"confirm"`
+		}
+		if err := yaml.Unmarshal(body, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Confirm != id {
+			writeAPIError(w, http.StatusBadRequest, "confirm must repeat the stream id")
+			return
+		}
+		if wk, ok := state.workers.get(id); ok && !wk.isStopped() {
+			writeAPIError(w, http.StatusConflict, "stream is running, stop or remove it before purging")
+			return
+		}
+		res, err := purgeStream(currentConfig(state), id)
+		// Logged after the purge with purged_stream_id, so a later purge does not remove the record itself.
+		slog.Info("stream data purged", "purged_stream_id", id, "records", res.LogRecords,
+			"recordings", len(res.Recordings), "report_records", res.ReportRecords)
+		auditChange(r, id, nil, res)
+		if err != nil {
+			slog.Error("stream purge incomplete", "purged_stream_id", id, "error", err)
+			writeAPIError(w, http.StatusInternalServerError, "purge incomplete: "+err.Error())
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, res)
+	}
+}
+
+// runPurge 实现 purge 子命令：通过控制套接字让守护进程清除流的数据。守护进程未运行时直接在本机清除。
+func runPurge(args []string) int {
+	fs, socket := controlFlags("purge")
+	id := fs.String("id", "", T("flag.purge.id"))
+	yes := fs.Bool("yes", false, T("flag.purge.yes"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *id == "" {
+		printCLI(os.Stderr, T("control.id_required")+"\n")
+		return 2
+	}
+
+	if !*yes {
+		printCLI(os.Stderr, T("purge.confirm", *id))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != *id {
+			printCLI(os.Stderr, T("purge.aborted")+"\n")
+			return 1
+		}
+	}
+
+	var res purgeResult
+	err := newControlClient(*socket).do(http.MethodPost, "/purge/"+url.PathEscape(*id), map[string]string{"confirm": *id}, &res)
+	if daemonUnreachable(err) {
+		printCLI(os.Stderr, T("purge.offline")+"\n")
+		res, err = purgeOffline(*id)
+	}
+	if err != nil {
+		return controlFail(err)
+	}
+	printCLI(os.Stdout, T("purge.done", res.StreamID, res.LogRecords, res.BufferedLogs, len(res.Recordings), res.ReportRecords, res.Jobs))
+	for _, f := range res.Recordings {
+		printCLI(os.Stdout, T("purge.deleted", f))
+	}
+	for _, f := range res.ConfigCopies {
+		printCLI(os.Stdout, T("purge.removed_from", f))
+	}
+	for _, n := range res.Notes {
+		printCLI(os.Stdout, T("purge.note", T("purge.note."+n)))
+	}
+	return 0
+}
+
+// daemonUnreachable 判断错误是否因为连接不上控制套接字（守护进程未运行）。
+func daemonUnreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// purgeOffline 在守护进程未运行时直接清除本机的数据，并写入审计记录。
+func purgeOffline(id string) (purgeResult, error) {
+	// The daemon may write its log somewhere else and keep a different number of rotations.
+	cfg, err := loadConfig(paths.Config)
+	if err == nil {
+		applyPathSettings(cfg.Settings)
+		runtimeSettings.Store(cfg.Settings)
+	} else {
+		printCLI(os.Stderr, T("purge.no_config", err))
+		cfg = nil
+	}
+	res, err := purgeStream(cfg, id)
+	if auditErr := auditPurge(res); auditErr != nil {
+		printCLI(os.Stderr, T("purge.audit_failed", auditErr))
+	}
+	return res, err
+}
+
+// logFiles 返回主日志文件及所有轮转日志文件的路径。
+func logFiles() []string {
+	files := []string{paths.LogFile}
+	for i := 1; i <= currentSettings().LogMaxFiles; i++ {
+		files = append(files, fmt.Sprintf("%s.%d", paths.LogFile, i))
+	}
+	return files
+}
+
+// auditPurge 向主日志和审计日志追加一条本机清除操作的审计记录。
+// 使用 purged_stream_id 字段，避免审计记录本身被后续的清除操作删除。
+func auditPurge(res purgeResult) error {
+	f, err := os.OpenFile(paths.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	operator := localOperator()
+	// Match the daemon's timestamp settings so the record parses like the rest of the log.
+	if cfg, err := loadConfig(paths.Config); err == nil {
+		if lt, err := cfg.Log.resolve(); err == nil {
+			logTime.Store(lt)
+		}
+	}
+	slog.New(newLogHandler(f)).Info("stream data purged",
+		"purged_stream_id", res.StreamID,
+		"records", res.LogRecords,
+		"recordings", len(res.Recordings),
+		"report_records", res.ReportRecords,
+		"operator", operator,
+	)
+	writeAudit(auditEntry{Actor: "user:" + operator, Via: AuditViaCLI, Action: "purge", Target: res.StreamID, After: res})
+	return f.Close()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestPurgeLogFile 测试按流 ID 清除日志记录
+func TestPurgeLogFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "stream.log")
+
+	content := `{"level":"INFO","msg":"starting ffmpeg","stream_id":"stream-1"}
+{"level":"INFO","msg":"starting ffmpeg","stream_id":"stream-2"}
+[2025-01-15 14:30:26] [stream-1] frame=  123 fps= 30
+[2025-01-15 14:30:26] [stream-10] frame=  456 fps= 30
+{"level":"INFO","msg":"stream data purged","purged_stream_id":"stream-1"}
+`
+	if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create test log file: %v", err)
+	}
+
+	removed, err := purgeLogFile(logPath, "stream-1")
+	if err != nil {
+		t.Fatalf("purgeLogFile failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed records, got %d", removed)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	expected := `{"level":"INFO","msg":"starting ffmpeg","stream_id":"stream-2"}
+[2025-01-15 14:30:26] [stream-10] frame=  456 fps= 30
+{"level":"INFO","msg":"stream data purged","purged_stream_id":"stream-1"}
+`
+	if string(data) != expected {
+		t.Errorf("unexpected log content after purge:\n%s", data)
+	}
+}
+
+// TestPurgeLogFileMissing 测试清除不存在的日志文件
+func TestPurgeLogFileMissing(t *testing.T) {
+	removed, err := purgeLogFile(filepath.Join(t.TempDir(), "missing.log"), "stream-1")
+	if err != nil || removed != 0 {
+		t.Errorf("expected missing file to be ignored, got %d, %v", removed, err)
+	}
+}
+
+// TestRecordingFiles 测试按输出类型查找录制文件、归档副本和 HLS 分片，不误删同目录的其他文件
+func TestRecordingFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"news.mp4", "news-20250115T143026Z.mp4", "news-old.mp4", "newsroom.mp4",
+		"live.m3u8", "live0.ts", "live12.ts", "lively.ts",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hlsDir := filepath.Join(dir, "hls")
+	if err := os.Mkdir(hlsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.m3u8", "seg001.ts"} {
+		if err := os.WriteFile(filepath.Join(hlsDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		output StreamOutput
+		want   []string
+	}{
+		{StreamOutput{Dst: filepath.Join(dir, "news.mp4")}, []string{"news-20250115T143026Z.mp4", "news.mp4"}},
+		{StreamOutput{Dst: filepath.Join(dir, "live.m3u8"), Format: "hls"}, []string{"live.m3u8", "live0.ts", "live12.ts"}},
+		{StreamOutput{Dst: hlsDir + "/", Format: "hls"}, []string{"hls/index.m3u8", "hls/seg001.ts"}},
+		{StreamOutput{Dst: filepath.Join(dir, "missing", "out.mp4")}, nil},
+	}
+	for _, tt := range tests {
+		files, err := recordingFiles(tt.output)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.output.Dst, err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			got = append(got, rel)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.output.Dst, got, tt.want)
+		}
+	}
+}
+
+// TestPurgeReports 测试从 JSON 和 CSV 用量报表中删除流的记录
+func TestPurgeReports(t *testing.T) {
+	dir := t.TempDir()
+	records := []usageRecord{{StreamID: "stream-1", Restarts: 1}, {StreamID: "stream-2", Restarts: 2}}
+	for _, format := range []string{"json", "csv"} {
+		data, err := encodeUsageReport(format, records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "usage-daily-20250115."+format), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := purgeReports(dir, "stream-1")
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 removed records, got %d, %v", removed, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "usage-daily-20250115.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []usageRecord
+	if err := json.Unmarshal(data, &kept); err != nil || len(kept) != 1 || kept[0].StreamID != "stream-2" {
+		t.Errorf("unexpected json report after purge: %v, %s", err, data)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "usage-daily-20250115.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "stream-2,") {
+		t.Errorf("unexpected csv report after purge:\n%s", data)
+	}
+}
+
+// TestPurgeRemovedStream 测试流从配置中删除后清除：按录制位置索引删除录制文件并删除索引条目
+func TestPurgeRemovedStream(t *testing.T) {
+	saved := paths
+	defer func() { paths = saved }()
+	dir := t.TempDir()
+	paths.LogDir = dir
+	paths.LogFile = filepath.Join(dir, "stream-runner.log")
+	paths.Config = filepath.Join(dir, "config.yml")
+	paths.Snapshot = filepath.Join(dir, "stream-runner.snapshot.yml")
+
+	recording := filepath.Join(dir, "news.mp4")
+	other := filepath.Join(dir, "music.mp4")
+	for _, p := range []string{recording, other} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rememberRecordings([]StreamConfig{
+		{ID: "news", Src: "rtmp://127.0.0.1/live/news", Dst: recording},
+		{ID: "music", Src: "rtmp://127.0.0.1/live/music", Dst: other},
+		{ID: "remote", Src: "rtmp://127.0.0.1/live/remote", Dst: "rtmp://127.0.0.2/live/remote"},
+	})
+
+	res, err := purgeStream(&Config{}, "news")
+	if err != nil {
+		t.Fatalf("purgeStream failed: %v", err)
+	}
+	if len(res.Recordings) != 1 || res.Recordings[0] != recording {
+		t.Errorf("expected %s to be purged, got %v", recording, res.Recordings)
+	}
+	for _, n := range res.Notes {
+		if n == purgeNoteNotConfigured {
+			t.Errorf("unexpected note %q for a stream with known recordings", n)
+		}
+	}
+	if _, err := os.Stat(recording); !os.IsNotExist(err) {
+		t.Errorf("expected recording to be deleted, stat: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected other stream's recording to be kept: %v", err)
+	}
+
+	outputs, err := recordedOutputs("news")
+	if err != nil || len(outputs) != 0 {
+		t.Errorf("expected index entry to be removed, got %v, %v", outputs, err)
+	}
+	if outputs, err := recordedOutputs("music"); err != nil || len(outputs) != 1 {
+		t.Errorf("expected other stream's index entry to be kept, got %v, %v", outputs, err)
+	}
+	if outputs, err := recordedOutputs("remote"); err != nil || len(outputs) != 0 {
+		t.Errorf("expected network outputs not to be indexed, got %v, %v", outputs, err)
+	}
+}
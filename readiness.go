@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// readinessTimeout 是单个就绪检查的超时时间。
+	readinessTimeout = 5 * time.Second
+	// readinessMaxBackoff 是就绪检查失败后重试间隔的上限。
+	readinessMaxBackoff = 60 * time.Second
+)
+
+// ReadinessCheck 表示启动流之前必须满足的外部条件，每项只能设置一种检查。
+type ReadinessCheck struct {
+	// HTTP 是需要返回 200 的 URL。
+	HTTP string `yaml:"http,omitempty"`
+	// File 是必须存在的文件路径。
+	File string `yaml:"file,omitempty"`
+	// TCP 是必须可以连接的 host:port。
+	TCP string `yaml:"tcp,omitempty"`
+	// Plugin 是执行检查的插件名称，Args 原样传给插件。
+	Plugin string            `yaml:"plugin,omitempty"`
+	Args   map[string]string `yaml:"args,omitempty"`
+}
+
+// validate 校验就绪检查配置。
+func (c *ReadinessCheck) validate() error {
+	set := 0
+	for _, v := range []string{c.HTTP, c.File, c.TCP, c.Plugin} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of http, file, tcp or plugin must be set")
+	}
+	if len(c.Args) > 0 && c.Plugin == "" {
+		return fmt.Errorf("args requires plugin")
+	}
+	if c.TCP != "" {
+		if _, _, err := net.SplitHostPort(c.TCP); err != nil {
+			return fmt.Errorf("tcp: %w", err)
+		}
+	}
+	return nil
+}
+
+// check 执行一次检查，条件不满足时返回错误。
+func (c *ReadinessCheck) check(streamID string) error {
+	switch {
+	case c.HTTP != "":
+		client := &http.Client{Timeout: readinessTimeout}
+		resp, err := client.Get(c.HTTP)
+		if err != nil {
+			return err
+		}
+		if err := resp.Body.Close(); err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s", c.HTTP, resp.Status)
+		}
+	case c.File != "":
+		if _, err := os.Stat(c.File); err != nil {
+			return err
+		}
+	case c.TCP != "":
+		conn, err := net.DialTimeout("tcp", c.TCP, readinessTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case c.Plugin != "":
+		p, err := lookupPlugin(c.Plugin)
+		if err != nil {
+			return err
+		}
+		return p.Probe(context.Background(), streamID, c.Args)
+	}
+	return nil
+}
+
+// checkReadiness 依次执行所有就绪检查，返回第一个未满足的条件。
+func checkReadiness(streamID string, checks []ReadinessCheck) error {
+	for i := range checks {
+		if err := checks[i].check(streamID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextReadinessBackoff 返回就绪检查的下一次重试间隔，从 1s 开始翻倍直到上限。
+func nextReadinessBackoff(prev time.Duration) time.Duration {
+	if prev <= 0 {
+		return time.Second
+	}
+	if next := prev * 2; next < readinessMaxBackoff {
+		return next
+	}
+	return readinessMaxBackoff
+}
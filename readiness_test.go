@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCheckReadiness 测试 HTTP、文件和 TCP 就绪检查
+func TestCheckReadiness(t *testing.T) {
+	ready := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !ready {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	checks := []ReadinessCheck{{HTTP: srv.URL}, {TCP: srv.Listener.Addr().String()}}
+	if err := checkReadiness("a", checks); err == nil {
+		t.Error("expected 404 to fail readiness")
+	}
+	ready = true
+	if err := checkReadiness("a", checks); err != nil {
+		t.Errorf("expected readiness, got %v", err)
+	}
+	if err := checkReadiness("a", []ReadinessCheck{{File: filepath.Join(t.TempDir(), "missing")}}); err == nil {
+		t.Error("expected missing file to fail readiness")
+	}
+	if err := (&ReadinessCheck{HTTP: srv.URL, File: "/tmp/x"}).validate(); err == nil {
+		t.Error("expected check with two conditions to be rejected")
+	}
+	if got := nextReadinessBackoff(40 * time.Second); got != readinessMaxBackoff {
+		t.Errorf("expected backoff capped at %s, got %s", readinessMaxBackoff, got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// ReportDaily 表示按天生成报表。
+	ReportDaily = "daily"
+	// ReportWeekly 表示按周（周一零点）生成报表。
+	ReportWeekly = "weekly"
+
+	// reportPostTimeout 是 POST 报表的超时时间。
+	reportPostTimeout = 30 * time.Second
+)
+
+// ReportConfig 表示用量报表配置。
+type ReportConfig struct {
+	// Interval 是报表周期：daily 或 weekly。
+	Interval string `yaml:"interval"`
+	// Format 是报表格式：csv 或 json。
+	Format string `yaml:"format"`
+	// Dir 是报表输出目录（可选）。
+	Dir string `yaml:"dir,omitempty"`
+	// URL 是接收报表的 HTTP 地址，报表以 POST 请求体发送（可选）。
+	URL string `yaml:"url,omitempty"`
+}
+
+// validate 校验报表配置。
+func (c *ReportConfig) validate() error {
+	if c.Interval != ReportDaily && c.Interval != ReportWeekly {
+		return fmt.Errorf("invalid interval %q, expected daily or weekly", c.Interval)
+	}
+	if c.Format != "csv" && c.Format != "json" {
+		return fmt.Errorf("invalid format %q, expected csv or json", c.Format)
+	}
+	if c.Dir == "" && c.URL == "" {
+		return fmt.Errorf("at least one of dir or url is required")
+	}
+	return nil
+}
+
+// usageRecord 是单个流在一个报表周期内的用量汇总。
+type usageRecord struct {
+	StreamID      string    `json:"stream_id"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	UptimePercent float64   `json:"uptime_percent"`
+	Restarts      int64     `json:"restarts"`
+	Incidents     int64     `json:"incidents"`
+	BytesOut      int64     `json:"bytes_out"`
+}
+
+// reportBaseline 是上一个报表周期结束时某个工作器的累计统计。
+type reportBaseline struct {
+	worker *StreamWorker
+	stats  streamStats
+}
+
+// usageReporter 在每个报表周期结束时汇总各流的用量并输出报表。
+type usageReporter struct {
+	state    *AppState
+	baseline map[string]reportBaseline
+}
+
+// nextReportTime 返回 now 之后的下一个报表周期边界（本地零点，weekly 为周一零点）。
+func nextReportTime(now time.Time, interval string) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	if interval == ReportWeekly {
+		for next.Weekday() != time.Monday {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
+
+// run 是报表循环，每到周期边界生成一次报表。
+// 未配置报表时仍按天推进基线，使启用报表后的第一份报表只包含启用后的用量。
+func (r *usageReporter) run() {
+	periodStart := time.Now()
+	r.collect(periodStart, periodStart)
+	for {
+		r.state.mu.RLock()
+		cfg := r.state.config.Reports
+		r.state.mu.RUnlock()
+
+		interval := ReportDaily
+		if cfg != nil {
+			interval = cfg.Interval
+		}
+		periodEnd := nextReportTime(periodStart, interval)
+		time.Sleep(time.Until(periodEnd))
+
+		r.state.mu.RLock()
+		cfg = r.state.config.Reports
+		r.state.mu.RUnlock()
+
+		records := r.collect(periodStart, periodEnd)
+		if cfg != nil {
+			if err := writeUsageReport(cfg, periodStart, records); err != nil {
+				slog.Error("failed to write usage report", "error", err)
+			} else {
+				slog.Info("usage report written", "streams", len(records), "period_start", periodStart)
+			}
+		}
+		periodStart = periodEnd
+	}
+}
+
+// collect 计算自上次基线以来各流的用量增量，并将当前累计值记为新基线。
+func (r *usageReporter) collect(periodStart, periodEnd time.Time) []usageRecord {
+	now := time.Now()
+	period := periodEnd.Sub(periodStart)
+
+	workers := r.state.workers.snapshot()
+	current := make(map[string]reportBaseline, len(workers))
+	for id, w := range workers {
+		current[id] = reportBaseline{worker: w, stats: w.Stats(now)}
+	}
+
+	// Baselines follow the worker, so a renamed stream keeps its history.
+	previous := make(map[*StreamWorker]streamStats, len(r.baseline))
+	for _, prev := range r.baseline {
+		previous[prev.worker] = prev.stats
+	}
+
+	records := make([]usageRecord, 0, len(current))
+	for id, cur := range current {
+		// A replaced worker starts counting from zero again.
+		base := previous[cur.worker]
+		rec := usageRecord{
+			StreamID:      id,
+			PeriodStart:   periodStart,
+			PeriodEnd:     periodEnd,
+			UptimeSeconds: int64((cur.stats.Uptime - base.Uptime).Seconds()),
+			Restarts:      cur.stats.Restarts - base.Restarts,
+			Incidents:     cur.stats.Failures - base.Failures,
+			BytesOut:      cur.stats.BytesOut - base.BytesOut,
+		}
+		if period > 0 {
+			rec.UptimePercent = float64(rec.UptimeSeconds) / period.Seconds() * 100
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].StreamID < records[j].StreamID })
+
+	r.baseline = current
+	return records
+}
+
+// encodeUsageReport 将报表编码为 CSV 或 JSON。
+func encodeUsageReport(format string, records []usageRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if format == "json" {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(records); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{
+		"stream_id", "period_start", "period_end", "uptime_seconds",
+		"uptime_percent", "restarts", "incidents", "bytes_out",
+	}); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if err := w.Write([]string{
+			r.StreamID,
+			r.PeriodStart.Format(time.RFC3339),
+			r.PeriodEnd.Format(time.RFC3339),
+			strconv.FormatInt(r.UptimeSeconds, 10),
+			strconv.FormatFloat(r.UptimePercent, 'f', 2, 64),
+			strconv.FormatInt(r.Restarts, 10),
+			strconv.FormatInt(r.Incidents, 10),
+			strconv.FormatInt(r.BytesOut, 10),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// writeUsageReport 将报表写入目录和/或 POST 到配置的地址。
+func writeUsageReport(cfg *ReportConfig, periodStart time.Time, records []usageRecord) error {
+	data, err := encodeUsageReport(cfg.Format, records)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+		name := fmt.Sprintf("usage-%s-%s.%s", cfg.Interval, periodStart.Format("20060102"), cfg.Format)
+		if err := os.WriteFile(filepath.Join(cfg.Dir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write report file: %w", err)
+		}
+	}
+
+	if cfg.URL != "" {
+		contentType := "text/csv"
+		if cfg.Format == "json" {
+			contentType = "application/json"
+		}
+		client := &http.Client{Timeout: reportPostTimeout}
+		resp, err := client.Post(cfg.URL, contentType, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to post report: %w", err)
+		}
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Warn("failed to close report response body", "error", closeErr)
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("report endpoint returned %s", resp.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNextReportTime 测试报表周期边界计算
+func TestNextReportTime(t *testing.T) {
+	// 2025-01-15 is a Wednesday.
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+
+	daily := nextReportTime(now, ReportDaily)
+	if !daily.Equal(time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily boundary: %s", daily)
+	}
+
+	weekly := nextReportTime(now, ReportWeekly)
+	if !weekly.Equal(time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected weekly boundary: %s", weekly)
+	}
+}
+
+// TestEncodeUsageReportCSV 测试 CSV 报表编码
+func TestEncodeUsageReportCSV(t *testing.T) {
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	records := []usageRecord{{
+		StreamID:      "stream-1",
+		PeriodStart:   start,
+		PeriodEnd:     start.Add(24 * time.Hour),
+		UptimeSeconds: 43200,
+		UptimePercent: 50,
+		Restarts:      3,
+		Incidents:     2,
+		BytesOut:      1024,
+	}}
+
+	data, err := encodeUsageReport("csv", records)
+	if err != nil {
+		t.Fatalf("encodeUsageReport failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and 1 row, got %d lines", len(lines))
+	}
+	expected := "stream-1,2025-01-15T00:00:00Z,2025-01-16T00:00:00Z,43200,50.00,3,2,1024"
+	if lines[1] != expected {
+		t.Errorf("expected row %q, got %q", expected, lines[1])
+	}
+}
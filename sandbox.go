@@ -0,0 +1,276 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// SandboxConfig 表示 ffmpeg 子进程的加固配置，用于处理不可信输入地址的边缘主机。
+type SandboxConfig struct {
+	// RestrictProtocols 为 true 时根据 src/dst 的协议自动生成 ffmpeg 协议白名单。
+	RestrictProtocols bool `yaml:"restrict_protocols,omitempty"`
+	// Protocols 是显式指定的协议白名单，设置后优先于自动推导。
+	Protocols []string `yaml:"protocols,omitempty"`
+	// Seccomp 为 true 时对 ffmpeg 应用 seccomp 过滤器，禁止与转发无关的危险系统调用。
+	Seccomp bool `yaml:"seccomp,omitempty"`
+	// AppArmor 是 ffmpeg 执行时切换到的 AppArmor profile 名称（需预先加载）。
+	AppArmor string `yaml:"apparmor,omitempty"`
+	// Namespaces 是 ffmpeg 运行所在的新命名空间：mount、pid、ipc、uts、net、user。
+	// net 命名空间中只有回环网卡，只适用于不需要外部网络的流。
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// ReadOnlyRoot 为 true 时将根挂载点重新挂载为只读（需要 mount 命名空间）。
+	ReadOnlyRoot bool `yaml:"read_only_root,omitempty"`
+	// WritablePaths 是只读根下仍然可写的目录，例如录制输出目录。
+	WritablePaths []string `yaml:"writable_paths,omitempty"`
+	// HidePaths 是用空 tmpfs 覆盖的目录，例如 /home、/root（需要 mount 命名空间）。
+	HidePaths []string `yaml:"hide_paths,omitempty"`
+	// Chroot 是 ffmpeg 的根目录，必须包含 ffmpeg 及其依赖库（需要 mount 命名空间）。
+	Chroot string `yaml:"chroot,omitempty"`
+}
+
+// hasNamespace 检查是否请求了指定命名空间。
+func (c *SandboxConfig) hasNamespace(name string) bool {
+	for _, ns := range c.Namespaces {
+		if ns == name {
+			return true
+		}
+	}
+	return false
+}
+
+// needsMounts 检查是否需要在 mount 命名空间内执行挂载操作。
+func (c *SandboxConfig) needsMounts() bool {
+	return c.ReadOnlyRoot || len(c.HidePaths) > 0 || c.Chroot != "" ||
+		(c.hasNamespace("mount") && c.hasNamespace("pid"))
+}
+
+// needsHelper 检查是否需要通过 sandbox-exec 启动 ffmpeg。
+func (c *SandboxConfig) needsHelper() bool {
+	return c.Seccomp || c.AppArmor != "" || c.needsMounts()
+}
+
+// schemeProtocols 是各 URL 协议在 ffmpeg 内部依赖的协议。
+var schemeProtocols = map[string][]string{
+	"rtmp":  {"rtmp", "tcp"},
+	"rtmps": {"rtmps", "tcp", "tls"},
+	"rtmpt": {"rtmpt", "http", "tcp"},
+	"srt":   {"srt", "udp"},
+	"udp":   {"udp"},
+	"tcp":   {"tcp"},
+	"rtp":   {"rtp", "udp"},
+	"rtsp":  {"rtsp", "rtp", "tcp", "udp"},
+	"http":  {"http", "tcp", "hls", "crypto"},
+	"https": {"https", "http", "tcp", "tls", "hls", "crypto"},
+	"file":  {"file"},
+}
+
+// protocolWhitelist 返回 ffmpeg -protocol_whitelist 的值，未启用时返回空字符串。
+func protocolWhitelist(cfg StreamConfig) string {
+	sb := cfg.Sandbox
+	if sb == nil {
+		return ""
+	}
+	if len(sb.Protocols) > 0 {
+		return strings.Join(sb.Protocols, ",")
+	}
+	if !sb.RestrictProtocols {
+		return ""
+	}
+
+	set := make(map[string]bool)
+	targets := []string{cfg.Src, cfg.Dst}
+	for _, o := range cfg.Outputs {
+		targets = append(targets, o.target())
+	}
+	for _, raw := range targets {
+		scheme := "file"
+		if u, err := url.Parse(raw); err == nil && u.Scheme != "" {
+			scheme = strings.ToLower(u.Scheme)
+		}
+		protos, ok := schemeProtocols[scheme]
+		if !ok {
+			protos = []string{scheme}
+		}
+		for _, p := range protos {
+			set[p] = true
+		}
+	}
+	list := make([]string, 0, len(set))
+	for p := range set {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// validate 校验沙箱配置在当前平台上是否可用。
+func (c *SandboxConfig) validate() error {
+	if c.Seccomp && !seccompSupported {
+		return fmt.Errorf("seccomp is not supported on this platform")
+	}
+	if c.AppArmor != "" {
+		if _, err := os.Stat("/sys/kernel/security/apparmor"); err != nil {
+			return fmt.Errorf("apparmor profile %s requested but AppArmor is not enabled", c.AppArmor)
+		}
+	}
+	if err := applyNamespaces(&syscall.SysProcAttr{}, c.Namespaces); err != nil {
+		return err
+	}
+	if (c.ReadOnlyRoot || len(c.HidePaths) > 0 || c.Chroot != "") && !c.hasNamespace("mount") {
+		return fmt.Errorf("read_only_root, hide_paths and chroot require the mount namespace")
+	}
+	for _, p := range append(append([]string{c.Chroot}, c.WritablePaths...), c.HidePaths...) {
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("path %s must be absolute", p)
+		}
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			return fmt.Errorf("path %s must be an existing directory", p)
+		}
+	}
+	return nil
+}
+
+// newFFmpegCommand 创建在独立进程组中运行的 ffmpeg 命令，按流的 sandbox 配置加固。
+func newFFmpegCommand(cfg StreamConfig, args []string) (*exec.Cmd, error) {
+	return newSandboxedCommand(cfg.Sandbox, ffmpegBin, args)
+}
+
+// newSandboxedCommand 创建在独立进程组中运行的 bin 命令（ffmpeg 或读取源流的 ffprobe），sb 为 nil 时不加固。
+// 需要 seccomp、AppArmor 或挂载操作时通过 sandbox-exec 子命令启动：它先在新命名空间内
+// 完成挂载并应用限制，再 exec 为 bin，因此 PID 和进程组与直接启动 bin 相同。
+func newSandboxedCommand(sb *SandboxConfig, bin string, args []string) (*exec.Cmd, error) {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if sb == nil {
+		cmd := exec.Command(bin, args...)
+		cmd.SysProcAttr = attr
+		return cmd, nil
+	}
+	if err := applyNamespaces(attr, sb.Namespaces); err != nil {
+		return nil, err
+	}
+	if !sb.needsHelper() {
+		cmd := exec.Command(bin, args...)
+		cmd.SysProcAttr = attr
+		return cmd, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate own executable for sandbox-exec: %w", err)
+	}
+	helperArgs := []string{"sandbox-exec"}
+	if sb.Seccomp {
+		helperArgs = append(helperArgs, "--seccomp")
+	}
+	if sb.AppArmor != "" {
+		helperArgs = append(helperArgs, "--apparmor", sb.AppArmor)
+	}
+	if sb.hasNamespace("mount") && sb.hasNamespace("pid") {
+		helperArgs = append(helperArgs, "--mount-proc")
+	}
+	if sb.ReadOnlyRoot {
+		helperArgs = append(helperArgs, "--ro-root")
+	}
+	for _, p := range sb.WritablePaths {
+		helperArgs = append(helperArgs, "--writable", p)
+	}
+	for _, p := range sb.HidePaths {
+		helperArgs = append(helperArgs, "--hide", p)
+	}
+	if sb.Chroot != "" {
+		helperArgs = append(helperArgs, "--chroot", sb.Chroot)
+	}
+	helperArgs = append(helperArgs, "--", bin)
+	cmd := exec.Command(self, append(helperArgs, args...)...)
+	cmd.SysProcAttr = attr
+	return cmd, nil
+}
+
+// stringList 是可重复的字符串命令行参数。
+type stringList []string
+
+// String 实现 flag.Value 接口。
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+// Set 实现 flag.Value 接口。
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runSandboxExec 实现内部子命令 sandbox-exec：应用 seccomp / AppArmor 限制后 exec 目标程序。
+func runSandboxExec(args []string) int {
+	fs := flag.NewFlagSet("sandbox-exec", flag.ContinueOnError)
+	useSeccomp := fs.Bool("seccomp", false, T("flag.sandbox.seccomp"))
+	profile := fs.String("apparmor", "", T("flag.sandbox.apparmor"))
+	var mounts mountSetup
+	fs.BoolVar(&mounts.mountProc, "mount-proc", false, "挂载新的 /proc")
+	fs.BoolVar(&mounts.readOnlyRoot, "ro-root", false, "将根挂载点重新挂载为只读")
+	fs.Var((*stringList)(&mounts.writable), "writable", "只读根下保持可写的目录（可重复）")
+	fs.Var((*stringList)(&mounts.hide), "hide", "用空 tmpfs 覆盖的目录（可重复）")
+	fs.StringVar(&mounts.chroot, "chroot", "", "chroot 目录")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	argv := fs.Args()
+	if len(argv) == 0 {
+		fmt.Fprintln(os.Stderr, "sandbox-exec: missing command")
+		return 2
+	}
+	// Resolve the binary before chroot; it must exist at the same path inside the new root.
+	binary, err := exec.LookPath(argv[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", err)
+		return 127
+	}
+
+	if mounts.mountProc || mounts.readOnlyRoot || len(mounts.hide) > 0 || mounts.chroot != "" {
+		if err := mounts.apply(); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", withPermissionHint(err,
+				"mount operations require root, CAP_SYS_ADMIN or the user namespace"))
+			return 1
+		}
+	}
+
+	if *profile != "" {
+		if err := setAppArmorOnExec(*profile); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", err)
+			return 1
+		}
+	}
+	// Seccomp goes last: the filter also applies to everything this helper does afterwards.
+	if *useSeccomp {
+		if err := applySeccomp(); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox-exec: %v\n", withPermissionHint(err, "seccomp requires no_new_privs support"))
+			return 1
+		}
+	}
+
+	err = syscall.Exec(binary, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "sandbox-exec: exec %s: %v\n", binary, err)
+	return 126
+}
+
+// setAppArmorOnExec 请求内核在下一次 exec 时切换到指定 AppArmor profile（等同于 aa-exec -p）。
+func setAppArmorOnExec(profile string) error {
+	data := []byte("exec " + profile)
+	// Newer kernels expose the AppArmor specific interface; fall back to the generic one.
+	for _, path := range []string{"/proc/self/attr/apparmor/exec", "/proc/self/attr/exec"} {
+		if err := os.WriteFile(path, data, 0); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to set apparmor profile %s: %w", profile, err)
+		}
+	}
+	return fmt.Errorf("failed to set apparmor profile %s: apparmor interface not available", profile)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestProtocolWhitelist 测试协议白名单推导
+func TestProtocolWhitelist(t *testing.T) {
+	cfg := StreamConfig{
+		ID:  "test-stream",
+		Src: "srt://source.com:9000",
+		Dst: "rtmps://dest.com/live/key",
+	}
+	if got := protocolWhitelist(cfg); got != "" {
+		t.Errorf("expected no whitelist without sandbox, got %q", got)
+	}
+
+	cfg.Sandbox = &SandboxConfig{RestrictProtocols: true}
+	if got := protocolWhitelist(cfg); got != "rtmps,srt,tcp,tls,udp" {
+		t.Errorf("unexpected derived whitelist %q", got)
+	}
+
+	cfg.Sandbox.Protocols = []string{"rtmp", "tcp"}
+	if got := protocolWhitelist(cfg); got != "rtmp,tcp" {
+		t.Errorf("expected explicit whitelist to win, got %q", got)
+	}
+}
+
+// TestNewFFmpegCommandSandboxed 测试沙箱模式通过 sandbox-exec 启动 ffmpeg
+func TestNewFFmpegCommandSandboxed(t *testing.T) {
+	cfg := StreamConfig{ID: "test-stream"}
+	cmd, err := newFFmpegCommand(cfg, []string{"-i", "in"})
+	if err != nil {
+		t.Fatalf("newFFmpegCommand failed: %v", err)
+	}
+	if cmd.Args[0] != "ffmpeg" {
+		t.Errorf("expected plain ffmpeg command, got %v", cmd.Args)
+	}
+
+	cfg.Sandbox = &SandboxConfig{Seccomp: true, AppArmor: "stream-runner-ffmpeg"}
+	cmd, err = newFFmpegCommand(cfg, []string{"-i", "in"})
+	if err != nil {
+		t.Fatalf("newFFmpegCommand failed: %v", err)
+	}
+	expected := "sandbox-exec --seccomp --apparmor stream-runner-ffmpeg -- ffmpeg -i in"
+	if got := strings.Join(cmd.Args[1:], " "); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// ffprobe reads the same untrusted source and gets the same sandbox.
+	cmd, err = newSandboxedCommand(cfg.Sandbox, "ffprobe", []string{"-i", "in"})
+	if err != nil {
+		t.Fatalf("newSandboxedCommand failed: %v", err)
+	}
+	expected = "sandbox-exec --seccomp --apparmor stream-runner-ffmpeg -- ffprobe -i in"
+	if got := strings.Join(cmd.Args[1:], " "); got != expected || !cmd.SysProcAttr.Setpgid {
+		t.Errorf("expected %q in its own process group, got %q", expected, got)
+	}
+}
+
+// TestSandboxNamespaceValidation 测试命名空间配置校验
+func TestSandboxNamespaceValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cases := []struct {
+		name    string
+		cfg     SandboxConfig
+		wantErr bool
+	}{
+		{"valid", SandboxConfig{Namespaces: []string{"mount", "pid"}, ReadOnlyRoot: true, WritablePaths: []string{tmpDir}}, false},
+		{"unknown namespace", SandboxConfig{Namespaces: []string{"cgroupz"}}, true},
+		{"mounts without mount namespace", SandboxConfig{HidePaths: []string{tmpDir}}, true},
+		{"relative path", SandboxConfig{Namespaces: []string{"mount"}, ReadOnlyRoot: true, WritablePaths: []string{"out"}}, true},
+	}
+	for _, tc := range cases {
+		if err := tc.cfg.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error=%v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+// TestNewFFmpegCommandNamespaces 测试命名空间模式的 sandbox-exec 参数
+func TestNewFFmpegCommandNamespaces(t *testing.T) {
+	cfg := StreamConfig{ID: "test-stream", Sandbox: &SandboxConfig{
+		Namespaces:    []string{"mount", "pid"},
+		ReadOnlyRoot:  true,
+		WritablePaths: []string{"/var/lib/stream-runner"},
+		HidePaths:     []string{"/home"},
+	}}
+	cmd, err := newFFmpegCommand(cfg, []string{"-i", "in"})
+	if err != nil {
+		t.Fatalf("newFFmpegCommand failed: %v", err)
+	}
+	expected := "sandbox-exec --mount-proc --ro-root --writable /var/lib/stream-runner --hide /home -- ffmpeg -i in"
+	if got := strings.Join(cmd.Args[1:], " "); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if !cmd.SysProcAttr.Setpgid {
+		t.Error("expected ffmpeg to run in its own process group")
+	}
+}
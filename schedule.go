@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 节目表格式。
+const (
+	// ScheduleXMLTV 是 XMLTV 格式的节目表。
+	ScheduleXMLTV = "xmltv"
+	// ScheduleJSON 是 JSON 格式的节目表：{"programmes": [{"channel", "start", "stop", "title"}]}。
+	ScheduleJSON = "json"
+)
+
+const (
+	// DefaultScheduleInterval 是重新拉取节目表的默认间隔。
+	DefaultScheduleInterval = 5 * time.Minute
+	// DefaultScheduleDriftGrace 是实际状态与节目表不一致多久后视为偏离的默认时长。
+	DefaultScheduleDriftGrace = 2 * time.Minute
+	// scheduleTick 是节目表对账和工作器等待节目开始的检查间隔。
+	scheduleTick = 5 * time.Second
+	// scheduleFetchTimeout 是拉取节目表的超时时间。
+	scheduleFetchTimeout = 30 * time.Second
+	// maxScheduleSize 是节目表的最大字节数。
+	maxScheduleSize = 32 << 20
+)
+
+// ScheduleConfig 表示由外部节目表（XMLTV 或 JSON EPG）驱动流的开播和停播：
+// streams 中列出的流只在对应频道有节目时运行，节目结束后停止，其他流不受影响。
+type ScheduleConfig struct {
+	// URL 是节目表地址，支持 http(s) 地址或本地文件路径。
+	URL string `yaml:"url"`
+	// Format 是节目表格式：xmltv 或 json，默认按内容判断。
+	Format string `yaml:"format,omitempty"`
+	// Interval 是重新拉取节目表的间隔，默认 5m。
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Streams 是受节目表控制的流，key 为流 ID，值为节目表中的频道 ID。
+	Streams map[string]string `yaml:"streams"`
+	// Lead 是节目开始前提前开播的时长，给推流和平台留出准备时间。
+	Lead time.Duration `yaml:"lead,omitempty"`
+	// Trail 是节目结束后延迟停播的时长。
+	Trail time.Duration `yaml:"trail,omitempty"`
+	// DriftGrace 是实际状态与节目表不一致多久后发出偏离事件，默认 2m。
+	DriftGrace time.Duration `yaml:"drift_grace,omitempty"`
+	// Timezone 是 XMLTV 中不带时区的时间所用的时区，如 Asia/Shanghai，默认 UTC。
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// scheduleConfig 是当前生效的节目表配置，在配置重载时替换。
+var scheduleConfig atomic.Pointer[ScheduleConfig]
+
+// validate 校验节目表配置，streams 是配置中的流。
+func (c *ScheduleConfig) validate(streams []StreamConfig) error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	switch c.Format {
+	case "", ScheduleXMLTV, ScheduleJSON:
+	default:
+		return fmt.Errorf("unknown format %q, expected xmltv or json", c.Format)
+	}
+	if c.Interval < 0 || c.Lead < 0 || c.Trail < 0 || c.DriftGrace < 0 {
+		return fmt.Errorf("interval, lead, trail and drift_grace must not be negative")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	if len(c.Streams) == 0 {
+		return fmt.Errorf("streams is required")
+	}
+	known := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		known[s.ID] = true
+	}
+	for id, channel := range c.Streams {
+		if !known[id] {
+			return fmt.Errorf("unknown stream %q", id)
+		}
+		if channel == "" {
+			return fmt.Errorf("stream %s: channel is required", id)
+		}
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c ScheduleConfig) withDefaults() ScheduleConfig {
+	if c.Interval == 0 {
+		c.Interval = DefaultScheduleInterval
+	}
+	if c.DriftGrace == 0 {
+		c.DriftGrace = DefaultScheduleDriftGrace
+	}
+	return c
+}
+
+// location 返回节目表的时区，已在加载时校验，无效时退回 UTC。
+func (c ScheduleConfig) location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// programme 是节目表中的一档节目。
+type programme struct {
+	Channel string    `json:"channel"`
+	Title   string    `json:"title,omitempty"`
+	Start   time.Time `json:"start"`
+	Stop    time.Time `json:"stop"`
+}
+
+// xmltvTime 解析 XMLTV 的时间，如 "20261015120000 +0800"，不带时区时按 loc。
+func xmltvTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse("20060102150405 -0700", s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("20060102150405", s, loc)
+}
+
+// parseXMLTV 解析 XMLTV 节目表，没有结束时间的节目被跳过，不带时区的时间按 loc。
+func parseXMLTV(data []byte, loc *time.Location) ([]programme, error) {
+	var doc struct {
+		Programmes []struct {
+			Channel string   `xml:"channel,attr"`
+			Start   string   `xml:"start,attr"`
+			Stop    string   `xml:"stop,attr"`
+			Titles  []string `xml:"title"`
+		} `xml:"programme"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse xmltv: %w", err)
+	}
+	out := make([]programme, 0, len(doc.Programmes))
+	for _, p := range doc.Programmes {
+		if p.Stop == "" {
+			continue
+		}
+		start, err := xmltvTime(p.Start, loc)
+		if err != nil {
+			return nil, fmt.Errorf("programme on %s: invalid start %q", p.Channel, p.Start)
+		}
+		stop, err := xmltvTime(p.Stop, loc)
+		if err != nil {
+			return nil, fmt.Errorf("programme on %s: invalid stop %q", p.Channel, p.Stop)
+		}
+		prog := programme{Channel: p.Channel, Start: start, Stop: stop}
+		if len(p.Titles) > 0 {
+			prog.Title = p.Titles[0]
+		}
+		out = append(out, prog)
+	}
+	return out, nil
+}
+
+// parseJSONSchedule 解析 JSON 节目表，时间为 RFC 3339 格式。
+func parseJSONSchedule(data []byte) ([]programme, error) {
+	var doc struct {
+		Programmes []programme `json:"programmes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse json schedule: %w", err)
+	}
+	return doc.Programmes, nil
+}
+
+// parseSchedule 按格式解析节目表，未指定格式时以 < 开头的内容视为 XMLTV。
+// 结束时间不晚于开始时间的节目视为无效。XMLTV 中不带时区的时间按 loc。
+func parseSchedule(data []byte, format string, loc *time.Location) ([]programme, error) {
+	if format == "" {
+		format = ScheduleJSON
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			format = ScheduleXMLTV
+		}
+	}
+	var progs []programme
+	var err error
+	if format == ScheduleXMLTV {
+		progs, err = parseXMLTV(data, loc)
+	} else {
+		progs, err = parseJSONSchedule(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range progs {
+		if !p.Stop.After(p.Start) {
+			return nil, fmt.Errorf("programme %q on %s ends before it starts", p.Title, p.Channel)
+		}
+	}
+	return progs, nil
+}
+
+// fetchSchedule 读取并解析节目表。
+func fetchSchedule(c ScheduleConfig) ([]programme, error) {
+	var data []byte
+	if u, err := url.Parse(c.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		ctx, cancel := context.WithTimeout(context.Background(), scheduleFetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected response %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxScheduleSize)); err != nil {
+			return nil, err
+		}
+	} else {
+		if data, err = os.ReadFile(c.URL); err != nil {
+			return nil, err
+		}
+	}
+	return parseSchedule(data, c.Format, c.location())
+}
+
+// liveProgramme 返回频道在 now 时正在播出的节目（含 lead 和 trail）以及之后的下一档节目。
+func liveProgramme(progs []programme, channel string, c ScheduleConfig, now time.Time) (current, next *programme) {
+	for i := range progs {
+		p := &progs[i]
+		if p.Channel != channel {
+			continue
+		}
+		start, stop := p.Start.Add(-c.Lead), p.Stop.Add(c.Trail)
+		if !now.Before(start) && now.Before(stop) {
+			if current == nil || p.Start.Before(current.Start) {
+				current = p
+			}
+		} else if now.Before(start) && (next == nil || p.Start.Before(next.Start)) {
+			next = p
+		}
+	}
+	return current, next
+}
+
+// endedProgramme 返回频道在 now 之前最近结束（含 trail）的节目，没有时返回 nil。
+func endedProgramme(progs []programme, channel string, c ScheduleConfig, now time.Time) *programme {
+	var ended *programme
+	for i := range progs {
+		p := &progs[i]
+		if p.Channel == channel && !now.Before(p.Stop.Add(c.Trail)) && (ended == nil || p.Stop.After(ended.Stop)) {
+			ended = p
+		}
+	}
+	return ended
+}
+
+// scheduleEntry 是 /schedule 中一路流的对账结果。
+type scheduleEntry struct {
+	StreamID string `json:"stream_id"`
+	Channel  string `json:"channel"`
+	// Live 表示按节目表当前应当开播。
+	Live    bool `json:"live"`
+	Running bool `json:"running"`
+	// Drift 表示实际状态与节目表不一致已超过 drift_grace。
+	Drift   bool       `json:"drift"`
+	Current *programme `json:"current,omitempty"`
+	Next    *programme `json:"next,omitempty"`
+}
+
+// scheduleStatus 是 GET /schedule 的响应。
+type scheduleStatus struct {
+	// Source 是节目表地址，只保留主机部分。
+	Source    string          `json:"source"`
+	FetchedAt *time.Time      `json:"fetched_at,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Streams   []scheduleEntry `json:"streams"`
+}
+
+// scheduleMonitor 定期拉取节目表，并对照节目表停止节目已结束的流、报告偏离。
+type scheduleMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// source 是当前节目表的地址，地址变化后立即重新拉取。
+	source     string
+	programmes []programme
+	// loaded 表示已成功拉取过节目表，拉取失败时沿用上一次的结果。
+	loaded    bool
+	fetchedAt time.Time
+	lastFetch time.Time
+	fetchErr  string
+	inFlight  bool
+	// mismatchSince 是每路流实际状态开始与节目表不一致的时间。
+	mismatchSince map[string]time.Time
+	drifting      map[string]bool
+	stopping      map[string]bool
+}
+
+// epg 是当前的节目表监控器。
+var epg atomic.Pointer[scheduleMonitor]
+
+// newScheduleMonitor 创建节目表监控器。
+func newScheduleMonitor(state *AppState) *scheduleMonitor {
+	return &scheduleMonitor{
+		state:         state,
+		mismatchSince: make(map[string]time.Time),
+		drifting:      make(map[string]bool),
+		stopping:      make(map[string]bool),
+	}
+}
+
+// wantLive 返回流按节目表当前是否应当开播，scheduled 为 false 表示流不受节目表控制。
+// 尚未成功拉取过节目表时不干预，流照常运行。
+func (m *scheduleMonitor) wantLive(id string, now time.Time) (live, scheduled bool) {
+	p := scheduleConfig.Load()
+	if p == nil {
+		return false, false
+	}
+	channel, ok := p.Streams[id]
+	if !ok {
+		return false, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.loaded || m.source != p.URL {
+		return true, true
+	}
+	current, _ := liveProgramme(m.programmes, channel, *p, now)
+	return current != nil, true
+}
+
+// run 每 scheduleTick 检查一次，到期时拉取节目表并对账。
+func (m *scheduleMonitor) run() {
+	ticker := currentClock().NewTicker(scheduleTick)
+	defer ticker.Stop()
+	for now := range ticker.C() {
+		p := scheduleConfig.Load()
+		if p == nil {
+			m.mu.Lock()
+			m.source, m.programmes, m.loaded, m.fetchErr = "", nil, false, ""
+			clear(m.mismatchSince)
+			clear(m.drifting)
+			m.mu.Unlock()
+			continue
+		}
+		c := p.withDefaults()
+		m.mu.Lock()
+		due := !m.inFlight && (m.source != c.URL || now.Sub(m.lastFetch) >= c.Interval)
+		if due {
+			m.inFlight = true
+			m.lastFetch = now
+		}
+		m.mu.Unlock()
+		if due {
+			go m.refresh(c)
+		}
+		m.reconcile(c, now)
+	}
+}
+
+// refresh 拉取一次节目表，失败时保留上一次的结果。
+func (m *scheduleMonitor) refresh(c ScheduleConfig) {
+	progs, err := fetchSchedule(c)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight = false
+	if err != nil {
+		m.fetchErr = redactURLs(err.Error())
+		slog.Warn("failed to fetch schedule", "source", redactURLs(c.URL), "error", m.fetchErr)
+		if m.source != c.URL {
+			m.source, m.programmes, m.loaded = c.URL, nil, false
+		}
+		return
+	}
+	m.source, m.programmes, m.loaded, m.fetchErr = c.URL, progs, true, ""
+	m.fetchedAt = currentClock().Now()
+}
+
+// reconcile 停止节目已结束仍在运行的流，并记录实际状态与节目表的偏离，进入和离开偏离时各发出一次事件。
+// 节目开始时由工作器自行开播，见 waitForSchedule。
+func (m *scheduleMonitor) reconcile(c ScheduleConfig, now time.Time) {
+	workers := make(map[string]*StreamWorker, len(c.Streams))
+	for id := range c.Streams {
+		if w, ok := m.state.workers.get(id); ok {
+			workers[id] = w
+		}
+	}
+
+	for id := range m.mismatchSince {
+		if _, ok := workers[id]; !ok {
+			m.mu.Lock()
+			delete(m.mismatchSince, id)
+			delete(m.drifting, id)
+			m.mu.Unlock()
+		}
+	}
+	for id, w := range workers {
+		live, _ := m.wantLive(id, now)
+		running := w.IsRunning()
+
+		m.mu.Lock()
+		if !live && running && !m.stopping[id] {
+			m.stopping[id] = true
+			slog.Info("programme ended, stopping stream", "stream_id", id)
+			var ended *programme
+			if p := endedProgramme(m.programmes, c.Streams[id], c, now); p != nil {
+				copied := *p
+				ended = &copied
+			}
+			go func(id string, w *StreamWorker) {
+				w.Terminate()
+				// The recording is complete once ffmpeg has exited.
+				if ended != nil {
+					archiveRecording(m.state, w.config(), *ended, currentClock().Now())
+				}
+				m.mu.Lock()
+				delete(m.stopping, id)
+				m.mu.Unlock()
+			}(id, w)
+		}
+		var drift, wasDrifting bool
+		if live != running {
+			since, ok := m.mismatchSince[id]
+			if !ok {
+				since = now
+				m.mismatchSince[id] = now
+			}
+			drift = now.Sub(since) >= c.DriftGrace
+		} else {
+			delete(m.mismatchSince, id)
+		}
+		wasDrifting = m.drifting[id]
+		if drift {
+			m.drifting[id] = true
+		} else {
+			delete(m.drifting, id)
+		}
+		m.mu.Unlock()
+
+		switch {
+		case drift && !wasDrifting:
+			expected, actual := "live", "stopped"
+			if !live {
+				expected, actual = "stopped", "live"
+			}
+			slog.Warn("stream drifted from schedule", "stream_id", id, "expected", expected, "actual", actual)
+			emitEvent(id, "schedule_drift", expected, actual)
+		case !drift && wasDrifting:
+			emitEvent(id, "schedule_drift_resolved")
+		}
+	}
+}
+
+// snapshot 返回节目表对账结果，按流 ID 排序。
+func (m *scheduleMonitor) snapshot(c ScheduleConfig, now time.Time) scheduleStatus {
+	running := make(map[string]bool, len(c.Streams))
+	for id := range c.Streams {
+		if w, ok := m.state.workers.get(id); ok {
+			running[id] = w.IsRunning()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := scheduleStatus{Source: redactURLs(c.URL), Error: m.fetchErr, Streams: []scheduleEntry{}}
+	if !m.fetchedAt.IsZero() {
+		t := m.fetchedAt
+		st.FetchedAt = &t
+	}
+	for id, channel := range c.Streams {
+		e := scheduleEntry{StreamID: id, Channel: channel, Running: running[id], Drift: m.drifting[id], Live: !m.loaded}
+		if m.loaded {
+			e.Current, e.Next = liveProgramme(m.programmes, channel, c, now)
+			e.Live = e.Current != nil
+		}
+		st.Streams = append(st.Streams, e)
+	}
+	sort.Slice(st.Streams, func(i, j int) bool { return st.Streams[i].StreamID < st.Streams[j].StreamID })
+	return st
+}
+
+// waitForSchedule 在流受节目表控制且当前没有节目时等待，直到节目开始（含 lead）。
+func (w *StreamWorker) waitForSchedule(id string) {
+	logged := false
+	for {
+		m := epg.Load()
+		if m == nil {
+			return
+		}
+		live, scheduled := m.wantLive(id, currentClock().Now())
+		w.mu.Lock()
+		w.offSchedule = scheduled && !live
+		off := w.offSchedule
+		w.mu.Unlock()
+		if !off {
+			if logged {
+				slog.Info("programme starting, starting stream", "stream_id", id)
+			}
+			return
+		}
+		if !logged {
+			slog.Info("stream is off schedule, waiting for the next programme", "stream_id", id)
+			logged = true
+		}
+		if !w.sleep(scheduleTick) {
+			return
+		}
+	}
+}
+
+// programmeEnded 判断受节目表控制的流在 now 时是否没有节目，用于区分节目结束停播和异常退出。
+func programmeEnded(id string, now time.Time) bool {
+	m := epg.Load()
+	if m == nil {
+		return false
+	}
+	live, scheduled := m.wantLive(id, now)
+	return scheduled && !live
+}
+
+// isOffSchedule 判断工作器是否正在等待节目开始。
+func (w *StreamWorker) isOffSchedule() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.offSchedule
+}
+
+// handleSchedule 处理 GET /schedule：返回受节目表控制的流的对账结果。
+func handleSchedule(w http.ResponseWriter, _ *http.Request) {
+	m := epg.Load()
+	p := scheduleConfig.Load()
+	if m == nil || p == nil {
+		http.Error(w, "schedule is not configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.snapshot(p.withDefaults(), currentClock().Now())); err != nil {
+		slog.Warn("failed to write schedule status", "error", err)
+	}
+}
+
+// writeScheduleMetrics 输出受节目表控制的流是否偏离节目表，未配置节目表时不输出。
+func writeScheduleMetrics(bw *bufio.Writer) {
+	m := epg.Load()
+	p := scheduleConfig.Load()
+	if m == nil || p == nil {
+		return
+	}
+	ids := make([]string, 0, len(p.Streams))
+	for id := range p.Streams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	m.mu.Lock()
+	drift := make([]bool, len(ids))
+	for i, id := range ids {
+		drift[i] = m.drifting[id]
+	}
+	m.mu.Unlock()
+	fmt.Fprintln(bw, "# HELP stream_runner_schedule_drift Whether the stream has drifted from the schedule feed.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_schedule_drift gauge")
+	for i, id := range ids {
+		v := 0
+		if drift[i] {
+			v = 1
+		}
+		fmt.Fprintf(bw, "stream_runner_schedule_drift{stream_id=\"%s\"} %d\n", escapeLabelValue(id), v)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseSchedule 测试解析 XMLTV 和 JSON 节目表，并按 lead 和 trail 判断当前节目
+func TestParseSchedule(t *testing.T) {
+	xmltv := []byte(`<?xml version="1.0"?>
+<tv>
+  <programme start="20261015120000 +0800" stop="20261015130000 +0800" channel="news.example">
+    <title lang="zh">午间新闻</title>
+  </programme>
+  <programme start="20261015140000 +0800" stop="20261015150000 +0800" channel="news.example">
+    <title>Afternoon</title>
+  </programme>
+</tv>`)
+	progs, err := parseSchedule(xmltv, "", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progs) != 2 || progs[0].Title != "午间新闻" {
+		t.Fatalf("programmes = %+v", progs)
+	}
+	c := ScheduleConfig{Lead: time.Minute, Trail: 5 * time.Minute}
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		now     string
+		current string
+		next    string
+	}{
+		{"2026-10-15T03:58:00Z", "", "午间新闻"},
+		{"2026-10-15T03:59:30Z", "午间新闻", "Afternoon"},
+		{"2026-10-15T05:04:00Z", "午间新闻", "Afternoon"},
+		{"2026-10-15T05:30:00Z", "", "Afternoon"},
+		{"2026-10-15T07:10:00Z", "", ""},
+	}
+	for _, tc := range cases {
+		current, next := liveProgramme(progs, "news.example", c, at(tc.now))
+		if got := titleOf(current); got != tc.current {
+			t.Errorf("%s: current = %q, want %q", tc.now, got, tc.current)
+		}
+		if got := titleOf(next); got != tc.next {
+			t.Errorf("%s: next = %q, want %q", tc.now, got, tc.next)
+		}
+	}
+
+	// Times without an offset are read in the configured timezone.
+	local, err := parseSchedule([]byte(`<tv><programme start="20261015120000" stop="20261015130000" channel="a"/></tv>`), "", time.FixedZone("CST", 8*3600))
+	if err != nil || len(local) != 1 || !local[0].Start.Equal(progs[0].Start) {
+		t.Errorf("local times = %+v, %v", local, err)
+	}
+	if err := (&ScheduleConfig{URL: "epg.xml", Streams: map[string]string{"a": "a"}, Timezone: "Mars/Olympus"}).validate([]StreamConfig{{ID: "a"}}); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+
+	if _, err := parseSchedule([]byte(`{"programmes":[{"channel":"a","start":"2026-10-15T12:00:00Z","stop":"2026-10-15T11:00:00Z"}]}`), "", time.UTC); err == nil {
+		t.Error("expected error for programme ending before it starts")
+	}
+}
+
+// titleOf 返回节目标题，节目为空时返回空串。
+func titleOf(p *programme) string {
+	if p == nil {
+		return ""
+	}
+	return p.Title
+}
+
+// TestScheduleReconcile 测试没有节目时流处于 off_schedule，偏离超过 drift_grace 后才报告偏离
+func TestScheduleReconcile(t *testing.T) {
+	now := time.Now()
+	cfg := &ScheduleConfig{URL: "epg.json", Streams: map[string]string{"a": "ch-a", "b": "ch-b"}, DriftGrace: time.Minute}
+	prev := scheduleConfig.Swap(cfg)
+	defer scheduleConfig.Store(prev)
+
+	a := &StreamWorker{cfg: StreamConfig{ID: "a"}}
+	b := &StreamWorker{cfg: StreamConfig{ID: "b"}}
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"a": a, "b": b})}
+	m := newScheduleMonitor(state)
+	m.source, m.loaded = cfg.URL, true
+	m.programmes = []programme{{Channel: "ch-a", Title: "live now", Start: now.Add(-time.Hour), Stop: now.Add(time.Hour)}}
+	prevEPG := epg.Swap(m)
+	defer epg.Store(prevEPG)
+
+	if live, scheduled := m.wantLive("a", now); !live || !scheduled {
+		t.Errorf("a: live=%v scheduled=%v, want live", live, scheduled)
+	}
+	if live, scheduled := m.wantLive("b", now); live || !scheduled {
+		t.Errorf("b: live=%v scheduled=%v, want off", live, scheduled)
+	}
+	if live, scheduled := m.wantLive("c", now); scheduled {
+		t.Errorf("c: live=%v scheduled=%v, want unscheduled", live, scheduled)
+	}
+
+	// The waiting worker returns once the globals are restored at the end of the test.
+	go b.waitForSchedule("b")
+	deadline := time.Now().Add(time.Second)
+	for !b.isOffSchedule() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := b.state(); got != StreamStateOffSchedule {
+		t.Errorf("b state = %s, want %s", got, StreamStateOffSchedule)
+	}
+
+	c := cfg.withDefaults()
+	m.reconcile(c, now)
+	if m.drifting["a"] {
+		t.Error("a drifted before drift_grace")
+	}
+	m.reconcile(c, now.Add(2*time.Minute))
+	if !m.drifting["a"] || m.drifting["b"] {
+		t.Errorf("drifting = %v, want only a", m.drifting)
+	}
+	st := m.snapshot(c, now)
+	if len(st.Streams) != 2 || !st.Streams[0].Live || titleOf(st.Streams[0].Current) != "live now" || st.Streams[1].Live {
+		t.Errorf("snapshot = %+v", st)
+	}
+}
@@ -2,6 +2,7 @@
 # frozen_string_literal: true
 
 require 'fileutils'
+require 'time'
 
 APP = 'stream-runner'
 DIST_DIR = 'dist'.freeze
@@ -63,15 +64,40 @@ rescue StandardError => e
 end
 
 
-puts '[*] Building Linux binary (amd64)...'
+# GOARCH 选择目标架构（amd64、arm64 等），默认 amd64。
+# BUNDLED_FFMPEG 指向包含静态 ffmpeg（可选 ffprobe）的目录时，把它们内置到二进制中（-tags bundled_ffmpeg），
+# 软件包不再依赖系统的 ffmpeg。静态 ffmpeg 的架构必须与 GOARCH 一致。
+arch = ENV.fetch('GOARCH', 'amd64')
+bundled_ffmpeg = ENV['BUNDLED_FFMPEG'].to_s
+build_tags = []
+unless bundled_ffmpeg.empty?
+  abort "ERROR: #{bundled_ffmpeg}/ffmpeg not found" unless File.file?("#{bundled_ffmpeg}/ffmpeg")
+  %w[ffmpeg ffprobe].each do |tool|
+    src = "#{bundled_ffmpeg}/#{tool}"
+    next unless File.file?(src)
+
+    FileUtils.cp(src, "#{project_root}/bundled/#{tool}")
+    puts "[*] Bundling #{src}"
+  end
+  build_tags << 'bundled_ffmpeg'
+end
+
+puts "[*] Building Linux binary (#{arch})..."
 Dir.chdir(project_root) do
-  env = { 'GOOS' => 'linux', 'GOARCH' => 'amd64' }
+  # CGO is disabled so the binary is static and runs on minimal images.
+  env = { 'GOOS' => 'linux', 'GOARCH' => arch, 'CGO_ENABLED' => '0' }
 
   # Run go mod tidy to ensure dependencies are up to date
   abort 'ERROR: go mod tidy failed' unless system(env, 'go mod tidy')
 
-  # Build the binary
-  abort 'ERROR: go build failed' unless system(env, "go build -o #{DIST_DIR}/#{APP} main.go")
+  # Build the binary with version information
+  version = `git describe --tags --always --dirty 2>/dev/null`.strip.sub(/\Av/, '')
+  version = 'dev' if version.empty?
+  commit = `git rev-parse HEAD 2>/dev/null`.strip
+  ldflags = "-X main.version=#{version} -X main.commit=#{commit} -X main.buildDate=#{Time.now.utc.iso8601}"
+  build_args = ['go', 'build', '-ldflags', ldflags, '-o', "#{DIST_DIR}/#{APP}"]
+  build_args += ['-tags', build_tags.join(',')] unless build_tags.empty?
+  abort 'ERROR: go build failed' unless system(env, *build_args, '.')
 
   # Verify binary was created
   abort 'ERROR: Binary file was not created' unless File.exist?("#{DIST_DIR}/#{APP}")
@@ -89,15 +115,19 @@ end
 
 puts '[*] Packaging with nfpm...'
 Dir.chdir(project_root) do
+  # The package architecture follows GOARCH; a bundled ffmpeg drops the ffmpeg dependency.
+  nfpm_config = File.read('nfpm.yaml').sub(/^arch: .*$/, "arch: #{arch}")
+  nfpm_config = nfpm_config.sub(/^depends:\n  - ffmpeg\n/, "depends: []\n") unless bundled_ffmpeg.empty?
+  File.write("#{DIST_DIR}/nfpm.yaml", nfpm_config)
   # Build .deb package
   puts '[*] Building .deb package...'
-  unless system("nfpm pkg --packager deb --config nfpm.yaml --target dist/")
+  unless system("nfpm pkg --packager deb --config #{DIST_DIR}/nfpm.yaml --target dist/")
     abort 'ERROR: Failed to create .deb package'
   end
 
   # Build .rpm package
   puts '[*] Building .rpm package...'
-  unless system("nfpm pkg --packager rpm --config nfpm.yaml --target dist/")
+  unless system("nfpm pkg --packager rpm --config #{DIST_DIR}/nfpm.yaml --target dist/")
     abort 'ERROR: Failed to create .rpm package'
   end
 end
@@ -0,0 +1,35 @@
+package main
+
+// auditArch 是 AUDIT_ARCH_X86_64。
+const auditArch = 0xc000003e
+
+// sysSeccomp 是 seccomp 系统调用号。
+const sysSeccomp = 317
+
+// deniedSyscalls 是 ffmpeg 转发不需要、且常被用于提权或逃逸的系统调用。
+var deniedSyscalls = []uint32{
+	101, // ptrace
+	155, // pivot_root
+	161, // chroot
+	165, // mount
+	166, // umount2
+	167, // swapon
+	168, // swapoff
+	169, // reboot
+	175, // init_module
+	176, // delete_module
+	246, // kexec_load
+	248, // add_key
+	249, // request_key
+	250, // keyctl
+	272, // unshare
+	298, // perf_event_open
+	304, // open_by_handle_at
+	308, // setns
+	310, // process_vm_readv
+	311, // process_vm_writev
+	313, // finit_module
+	320, // kexec_file_load
+	321, // bpf
+	323, // userfaultfd
+}
@@ -0,0 +1,35 @@
+package main
+
+// auditArch 是 AUDIT_ARCH_AARCH64。
+const auditArch = 0xc00000b7
+
+// sysSeccomp 是 seccomp 系统调用号。
+const sysSeccomp = 277
+
+// deniedSyscalls 是 ffmpeg 转发不需要、且常被用于提权或逃逸的系统调用。
+var deniedSyscalls = []uint32{
+	39,  // umount2
+	40,  // mount
+	41,  // pivot_root
+	51,  // chroot
+	97,  // unshare
+	104, // kexec_load
+	105, // init_module
+	106, // delete_module
+	117, // ptrace
+	142, // reboot
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	224, // swapon
+	225, // swapoff
+	241, // perf_event_open
+	265, // open_by_handle_at
+	268, // setns
+	270, // process_vm_readv
+	271, // process_vm_writev
+	273, // finit_module
+	280, // bpf
+	282, // userfaultfd
+	294, // kexec_file_load
+}
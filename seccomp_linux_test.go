@@ -0,0 +1,22 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import "testing"
+
+// TestBuildSeccompFilter 测试 seccomp 过滤器的跳转目标
+func TestBuildSeccompFilter(t *testing.T) {
+	prog := buildSeccompFilter()
+	errnoIdx := len(prog) - 1
+	if prog[errnoIdx].Code != bpfRetK || prog[errnoIdx-1].K != seccompRetAllow {
+		t.Fatalf("expected program to end with allow then errno returns")
+	}
+	for i, ins := range prog {
+		if ins.Code != bpfJeqK || ins.K == auditArch {
+			continue
+		}
+		if target := i + 1 + int(ins.Jt); target != errnoIdx {
+			t.Errorf("instruction %d jumps to %d, expected errno return at %d", i, target, errnoIdx)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux || !(amd64 || arm64)
+
+package main
+
+import "errors"
+
+// seccompSupported 表示当前平台支持 seccomp 过滤器。
+const seccompSupported = false
+
+// applySeccomp 在不支持的平台上总是返回错误。
+func applySeccomp() error {
+	return errors.New("seccomp is not supported on this platform")
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// updateTimeout 是下载更新清单和二进制的超时时间。
+	updateTimeout = 5 * time.Minute
+	// maxUpdateSize 是允许下载的最大二进制大小。
+	maxUpdateSize = 256 << 20
+)
+
+// updatePublicKey 是编译时内置的更新签名公钥（base64 编码的 ed25519 公钥），
+// 通过 -ldflags "-X main.updatePublicKey=..." 设置，配置中的 update.public_key 优先。
+var updatePublicKey string
+
+// UpdateConfig 表示 self-update 子命令使用的发布源。
+type UpdateConfig struct {
+	// URL 是更新清单（JSON）的地址，必须使用 https（本机地址除外），签名位于同一地址加 .sig 后缀。
+	URL string `yaml:"url"`
+	// PublicKey 是验证清单签名的 ed25519 公钥（base64），为空时使用编译时内置的公钥。
+	PublicKey string `yaml:"public_key,omitempty"`
+}
+
+// validate 校验发布源配置。
+func (c *UpdateConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+		return fmt.Errorf("url must be an https URL")
+	}
+	if c.PublicKey != "" {
+		if _, err := parsePublicKey(c.PublicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateManifest 是发布源提供的更新清单。
+type updateManifest struct {
+	// Version 是发布版本号，如 1.2.0。低于当前版本的清单默认拒绝，防止重放旧的签名清单回退到有漏洞的版本。
+	Version string `json:"version"`
+	// Assets 是各平台的二进制，key 为 GOOS/GOARCH，如 linux/amd64。
+	Assets map[string]updateAsset `json:"assets"`
+}
+
+// updateAsset 是单个平台的二进制下载信息。
+type updateAsset struct {
+	// URL 是二进制地址，可以是相对清单地址的相对路径。
+	URL string `json:"url"`
+	// SHA256 是二进制的 SHA-256（十六进制）。
+	SHA256 string `json:"sha256"`
+}
+
+// parsePublicKey 解析 base64 编码的 ed25519 公钥。
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifySignature 校验 data 的 ed25519 签名（base64 编码）。
+func verifySignature(pub ed25519.PublicKey, data, sig []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(pub, data, raw) {
+		return fmt.Errorf("manifest signature verification failed")
+	}
+	return nil
+}
+
+// verifyManifest 校验清单签名（base64 编码的 ed25519 签名）并解析清单。
+func verifyManifest(pub ed25519.PublicKey, data, sig []byte) (*updateManifest, error) {
+	if err := verifySignature(pub, data, sig); err != nil {
+		return nil, err
+	}
+	var m updateManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// checkUpdateVersion 检查从 current 更新到 next 是否允许：next 必须是版本号，低于 current 时只有 allowDowngrade 才允许。
+// current 不是版本号（本地构建的 dev）时无法比较，不做限制。
+func checkUpdateVersion(current, next string, allowDowngrade bool) error {
+	nextNums := parseVersionNumbers(strings.TrimPrefix(next, "v"))
+	if nextNums == nil {
+		return fmt.Errorf("manifest version %q is not a version number", next)
+	}
+	curNums := parseVersionNumbers(strings.TrimPrefix(current, "v"))
+	if curNums == nil || allowDowngrade {
+		return nil
+	}
+	c := compareVersion(nextNums, curNums)
+	if c == 0 {
+		c = -compareVersion(curNums, nextNums)
+	}
+	if c < 0 {
+		return fmt.Errorf("refusing to downgrade from %s to %s, pass --allow-downgrade to roll back on purpose", current, next)
+	}
+	return nil
+}
+
+// assetFor 返回当前平台的二进制信息，相对地址按清单地址解析。
+func (m *updateManifest) assetFor(manifestURL, platform string) (updateAsset, error) {
+	a, ok := m.Assets[platform]
+	if !ok {
+		return a, fmt.Errorf("release %s has no binary for %s", m.Version, platform)
+	}
+	return a.resolve(manifestURL, platform)
+}
+
+// resolve 按清单地址解析相对的下载地址，并检查 SHA-256 的格式。name 用于错误信息。
+func (a updateAsset) resolve(manifestURL, name string) (updateAsset, error) {
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return a, err
+	}
+	ref, err := url.Parse(a.URL)
+	if err != nil {
+		return a, fmt.Errorf("invalid asset url: %w", err)
+	}
+	a.URL = base.ResolveReference(ref).String()
+	if _, err := hex.DecodeString(a.SHA256); err != nil || len(a.SHA256) != sha256.Size*2 {
+		return a, fmt.Errorf("invalid sha256 for %s", name)
+	}
+	return a, nil
+}
+
+// fetchURL 下载地址内容，非 2xx 响应视为失败。
+func fetchURL(client *http.Client, u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpdateSize {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", u, maxUpdateSize)
+	}
+	return data, nil
+}
+
+// fileSHA256 返回文件的 SHA-256（十六进制）。
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaceExecutable 原子地替换可执行文件，旧文件保留为 .old 以便回退。
+func replaceExecutable(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stream-runner-update-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	// A hard link keeps the running binary in place until the final rename.
+	backup := path + ".old"
+	_ = os.Remove(backup)
+	if err := os.Link(path, backup); err != nil {
+		return fmt.Errorf("failed to keep backup %s: %w", backup, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runSelfUpdate 实现 self-update 子命令：下载并校验新版本，替换当前可执行文件，可选重启服务。
+// 重启是普通的服务重启，期间所有流都会中断；不中断推流需要先把流交接到其他节点（见 handover）。
+func runSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	configPath := fs.String("config", paths.Config, T("flag.config"))
+	manifestURL := fs.String("url", "", T("flag.update.url"))
+	publicKey := fs.String("public-key", "", T("flag.update.key"))
+	check := fs.Bool("check", false, T("flag.update.check"))
+	restart := fs.Bool("restart", false, T("flag.update.restart"))
+	allowDowngrade := fs.Bool("allow-downgrade", false, T("flag.update.allow_downgrade"))
+	initSystem := fs.String("init", "", T("flag.service.init"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Flags win over the config; a missing config is fine when both flags are given.
+	var uc UpdateConfig
+	if cfg, err := loadConfig(*configPath); err == nil && cfg.Update != nil {
+		uc = *cfg.Update
+	}
+	if *manifestURL != "" {
+		uc.URL = *manifestURL
+	}
+	if *publicKey != "" {
+		uc.PublicKey = *publicKey
+	}
+	if uc.PublicKey == "" {
+		uc.PublicKey = updatePublicKey
+	}
+	if uc.URL == "" || uc.PublicKey == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: update url and public key are required (update section in config, or --url and --public-key)")
+		return 2
+	}
+	if err := uc.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: update: %v\n", err)
+		return 2
+	}
+	pub, err := parsePublicKey(uc.PublicKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	client := &http.Client{Timeout: updateTimeout}
+	data, err := fetchURL(client, uc.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	sig, err := fetchURL(client, uc.URL+".sig")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	manifest, err := verifyManifest(pub, data, sig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := checkUpdateVersion(currentBuildInfo().Version, manifest.Version, *allowDowngrade); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	asset, err := manifest.assetFor(uc.URL, runtime.GOOS+"/"+runtime.GOARCH)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	current, err := fileSHA256(exe)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if strings.EqualFold(current, asset.SHA256) {
+		fmt.Fprintf(os.Stderr, "[*] Already up to date (%s)\n", manifest.Version)
+		return 0
+	}
+	if *check {
+		fmt.Fprintf(os.Stderr, "[*] Update available: %s -> %s\n", currentBuildInfo().Version, manifest.Version)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "[*] Downloading %s\n", asset.URL)
+	binary, err := fetchURL(client, asset.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, asset.SHA256) {
+		fmt.Fprintf(os.Stderr, "ERROR: sha256 mismatch: manifest %s, downloaded %s\n", asset.SHA256, got)
+		return 1
+	}
+	if !bytes.HasPrefix(binary, []byte("\x7fELF")) && runtime.GOOS == "linux" {
+		fmt.Fprintln(os.Stderr, "ERROR: downloaded file is not an ELF binary")
+		return 1
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", withPermissionHint(err, "run as root, or as the owner of the binary"))
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] Updated %s to %s (previous binary kept as %s.old)\n", exe, manifest.Version, exe)
+
+	if !*restart {
+		fmt.Fprintln(os.Stderr, "[*] Restart the service to run the new version")
+		return 0
+	}
+	name, err := resolveInit(*initSystem)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := runCommands(serviceDefs[name].restart); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] Restarted %s service\n", name)
+	return 0
+}
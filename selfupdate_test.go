@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestVerifyManifest 测试更新清单的签名校验和二进制地址解析
+func TestVerifyManifest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("binary"))
+	data := []byte(`{"version": "1.2.0", "assets": {"linux/amd64": {"url": "v1.2.0/stream-runner-linux-amd64", "sha256": "` + hex.EncodeToString(sum[:]) + `"}}}`)
+	sig := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)))
+
+	key, err := parsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("parsePublicKey failed: %v", err)
+	}
+	m, err := verifyManifest(key, data, sig)
+	if err != nil {
+		t.Fatalf("verifyManifest failed: %v", err)
+	}
+	a, err := m.assetFor("https://releases.example.com/stream-runner/latest.json", "linux/amd64")
+	if err != nil {
+		t.Fatalf("assetFor failed: %v", err)
+	}
+	if want := "https://releases.example.com/stream-runner/v1.2.0/stream-runner-linux-amd64"; a.URL != want {
+		t.Errorf("url = %s, want %s", a.URL, want)
+	}
+	if _, err := m.assetFor("https://releases.example.com/latest.json", "darwin/arm64"); err == nil {
+		t.Error("expected error for missing platform")
+	}
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-3] = ' '
+	if _, err := verifyManifest(key, tampered, sig); err == nil {
+		t.Error("expected signature error for tampered manifest")
+	}
+}
+
+// TestReplaceExecutable 测试替换可执行文件并保留旧版本
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream-runner")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatalf("replaceExecutable failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("binary = %q, want new", data)
+	}
+	if data, _ := os.ReadFile(path + ".old"); string(data) != "old" {
+		t.Errorf("backup = %q, want old", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v, %v", info.Mode(), err)
+	}
+}
+
+// TestCheckUpdateVersion 测试拒绝回退到旧版本，除非显式允许；本地构建不做比较
+func TestCheckUpdateVersion(t *testing.T) {
+	cases := []struct {
+		current, next string
+		allow, ok     bool
+	}{
+		{"1.2.0", "1.3.0", false, true},
+		{"1.2.0", "v1.2.0", false, true},
+		{"1.2.0", "1.2.0.1", false, true},
+		{"1.2.0", "1.1.9", false, false},
+		{"v1.2.0", "1.2", false, true},
+		{"1.2.1", "1.2", false, false},
+		{"1.2.0", "1.1.9", true, true},
+		{"dev", "1.0.0", false, true},
+		{"1.2.0", "latest", true, false},
+	}
+	for _, c := range cases {
+		if err := checkUpdateVersion(c.current, c.next, c.allow); (err == nil) != c.ok {
+			t.Errorf("%s -> %s (allow %v): %v", c.current, c.next, c.allow, err)
+		}
+	}
+
+	for u, ok := range map[string]bool{
+		"https://releases.example.com/latest.json": true,
+		"http://127.0.0.1:8080/latest.json":        true,
+		"http://releases.example.com/latest.json":  false,
+	} {
+		if err := (&UpdateConfig{URL: u}).validate(); (err == nil) != ok {
+			t.Errorf("%s: %v", u, err)
+		}
+	}
+}
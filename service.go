@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"text/template"
+)
+
+const (
+	// InitSystemd 表示 systemd。
+	InitSystemd = "systemd"
+	// InitLaunchd 表示 macOS launchd。
+	InitLaunchd = "launchd"
+	// InitOpenRC 表示 OpenRC。
+	InitOpenRC = "openrc"
+)
+
+// serviceOptions 是生成服务文件所需的参数。
+type serviceOptions struct {
+	// Binary 是 stream-runner 可执行文件的绝对路径。
+	Binary string
+	// User 是运行服务的用户，为空时以 root 运行（可通过配置中的 run_as 降权）。
+	User string
+	// Group 是运行服务的组，为空时与 User 同名。
+	Group string
+}
+
+// serviceDef 描述一种 init 系统的服务文件位置、模板和启用/停用命令。
+type serviceDef struct {
+	path     string
+	mode     os.FileMode
+	template string
+	enable   [][]string
+	disable  [][]string
+	restart  [][]string
+}
+
+// Non-root services reuse the XDG path logic: pointing the XDG directories at
+// system locations makes a non-root daemon use the same paths as a root one.
+const systemdUnit = `[Unit]
+Description=RTMP Stream Runner
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{.Binary}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=always
+RestartSec=5
+{{- if .User}}
+User={{.User}}
+Group={{.Group}}
+Environment=XDG_CONFIG_HOME=/etc XDG_STATE_HOME=/var/log XDG_RUNTIME_DIR=/run/stream-runner
+RuntimeDirectory=stream-runner
+LogsDirectory=stream-runner
+PIDFile=/run/stream-runner/stream-runner.pid
+{{- else}}
+PIDFile=/var/run/stream-runner.pid
+{{- end}}
+
+# Hardening. Namespaces and privilege changes stay allowed for the ffmpeg sandbox and run_as.
+# ProtectSystem=full makes /etc read-only; /config/apply and persisted /streams edits rewrite the config.
+ProtectSystem=full
+ReadWritePaths=/etc/stream-runner
+ProtectHome=read-only
+PrivateTmp=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const openrcScript = `#!/sbin/openrc-run
+
+name="stream-runner"
+description="RTMP Stream Runner"
+command="{{.Binary}}"
+command_background=true
+{{- if .User}}
+command_user="{{.User}}:{{.Group}}"
+export XDG_CONFIG_HOME=/etc XDG_STATE_HOME=/var/log XDG_RUNTIME_DIR=/run/stream-runner
+pidfile="/run/stream-runner/stream-runner.pid"
+{{- else}}
+pidfile="/var/run/stream-runner.pid"
+{{- end}}
+extra_started_commands="reload"
+
+depend() {
+	need net
+}
+{{if .User}}
+start_pre() {
+	checkpath --directory --owner {{.User}}:{{.Group}} /run/stream-runner /var/log/stream-runner
+}
+{{end}}
+reload() {
+	ebegin "Reloading ${name}"
+	start-stop-daemon --signal HUP --pidfile "${pidfile}"
+	eend $?
+}
+`
+
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.stream-runner</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Binary}}</string>
+	</array>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{.User}}</string>
+	<key>GroupName</key>
+	<string>{{.Group}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+</dict>
+</plist>
+`
+
+// serviceDefs 是支持的 init 系统。
+var serviceDefs = map[string]serviceDef{
+	InitSystemd: {
+		path:     "/etc/systemd/system/stream-runner.service",
+		mode:     0644,
+		template: systemdUnit,
+		enable:   [][]string{{"systemctl", "daemon-reload"}, {"systemctl", "enable", "stream-runner"}},
+		disable:  [][]string{{"systemctl", "disable", "--now", "stream-runner"}},
+		restart:  [][]string{{"systemctl", "restart", "stream-runner"}},
+	},
+	InitOpenRC: {
+		path:     "/etc/init.d/stream-runner",
+		mode:     0755,
+		template: openrcScript,
+		enable:   [][]string{{"rc-update", "add", "stream-runner", "default"}},
+		disable:  [][]string{{"rc-service", "stream-runner", "stop"}, {"rc-update", "del", "stream-runner", "default"}},
+		restart:  [][]string{{"rc-service", "stream-runner", "restart"}},
+	},
+	InitLaunchd: {
+		path:     "/Library/LaunchDaemons/com.stream-runner.plist",
+		mode:     0644,
+		template: launchdPlist,
+		enable:   [][]string{{"launchctl", "load", "-w", "/Library/LaunchDaemons/com.stream-runner.plist"}},
+		disable:  [][]string{{"launchctl", "unload", "-w", "/Library/LaunchDaemons/com.stream-runner.plist"}},
+		restart:  [][]string{{"launchctl", "kickstart", "-k", "system/com.stream-runner"}},
+	},
+}
+
+// detectInit 返回当前主机使用的 init 系统。
+func detectInit() (string, error) {
+	if runtime.GOOS == "darwin" {
+		return InitLaunchd, nil
+	}
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		return InitSystemd, nil
+	}
+	if _, err := os.Stat("/sbin/openrc-run"); err == nil {
+		return InitOpenRC, nil
+	}
+	return "", fmt.Errorf("cannot detect init system, use --init")
+}
+
+// renderService 根据 init 系统生成服务文件内容。
+func renderService(initSystem string, opts serviceOptions) ([]byte, error) {
+	def, ok := serviceDefs[initSystem]
+	if !ok {
+		return nil, fmt.Errorf("unsupported init system %q", initSystem)
+	}
+	if opts.User != "" && opts.Group == "" {
+		opts.Group = opts.User
+	}
+	tmpl, err := template.New(initSystem).Parse(def.template)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runCommands 依次执行服务管理命令，输出直接透传给用户。
+func runCommands(cmds [][]string) error {
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%v: %w", args, err)
+		}
+	}
+	return nil
+}
+
+// resolveInit 返回用户指定的 init 系统，未指定时自动检测。
+func resolveInit(initSystem string) (string, error) {
+	if initSystem == "" {
+		return detectInit()
+	}
+	if _, ok := serviceDefs[initSystem]; !ok {
+		return "", fmt.Errorf("unsupported init system %q", initSystem)
+	}
+	return initSystem, nil
+}
+
+// runInstallService 实现 install-service 子命令：生成并安装服务文件。
+func runInstallService(args []string) int {
+	fs := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	initSystem := fs.String("init", "", T("flag.service.init"))
+	user := fs.String("user", "", T("flag.service.user"))
+	group := fs.String("group", "", T("flag.service.group"))
+	binary := fs.String("binary", "", T("flag.service.binary"))
+	dryRun := fs.Bool("dry-run", false, T("flag.service.dryrun"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	name, err := resolveInit(*initSystem)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	bin := *binary
+	if bin == "" {
+		if bin, err = os.Executable(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if bin, err = filepath.Abs(bin); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	data, err := renderService(name, serviceOptions{Binary: bin, User: *user, Group: *group})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if *dryRun {
+		if _, err := os.Stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: must be run as root (use --dry-run to preview)")
+		return 1
+	}
+
+	def := serviceDefs[name]
+	if err := os.WriteFile(def.path, data, def.mode); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] Installed %s service: %s\n", name, def.path)
+	if err := runCommands(def.enable); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "[*] Service enabled; edit the config and start the service")
+	return 0
+}
+
+// runUninstallService 实现 uninstall-service 子命令：停止并删除服务文件。
+func runUninstallService(args []string) int {
+	fs := flag.NewFlagSet("uninstall-service", flag.ContinueOnError)
+	initSystem := fs.String("init", "", T("flag.service.init"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	name, err := resolveInit(*initSystem)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: must be run as root")
+		return 1
+	}
+	def := serviceDefs[name]
+	if _, err := os.Stat(def.path); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "ERROR: %s not installed\n", def.path)
+		return 1
+	}
+	// Keep going if the service is already stopped or disabled.
+	if err := runCommands(def.disable); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+	}
+	if err := os.Remove(def.path); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if name == InitSystemd {
+		if err := runCommands([][]string{{"systemctl", "daemon-reload"}}); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[*] Removed %s service: %s\n", name, def.path)
+	return 0
+}
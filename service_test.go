@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenderService 测试各 init 系统服务文件的生成
+func TestRenderService(t *testing.T) {
+	unit, err := renderService(InitSystemd, serviceOptions{Binary: "/usr/local/bin/stream-runner"})
+	if err != nil {
+		t.Fatalf("renderService failed: %v", err)
+	}
+	for _, want := range []string{"ExecStart=/usr/local/bin/stream-runner", "PIDFile=/var/run/stream-runner.pid", "ProtectSystem=full",
+		// The api rewrites the config file and its backup.
+		"ReadWritePaths=/etc/stream-runner"} {
+		if !strings.Contains(string(unit), want) {
+			t.Errorf("expected %q in systemd unit:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(string(unit), "User=") {
+		t.Errorf("expected root service without User=:\n%s", unit)
+	}
+
+	script, err := renderService(InitOpenRC, serviceOptions{Binary: "/usr/bin/stream-runner", User: "streamer"})
+	if err != nil {
+		t.Fatalf("renderService failed: %v", err)
+	}
+	if !strings.Contains(string(script), `command_user="streamer:streamer"`) {
+		t.Errorf("expected group to default to user:\n%s", script)
+	}
+	if _, err := renderService("upstart", serviceOptions{}); err == nil {
+		t.Error("expected unsupported init system to be rejected")
+	}
+}
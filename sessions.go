@@ -0,0 +1,475 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 单点登录使用的 Cookie 和请求头。
+const (
+	// sessionCookie 保存会话令牌，HttpOnly，页面脚本无法读取。
+	sessionCookie = "stream_runner_session"
+	// oidcStateCookie 在登录跳转期间保存 state，把回调绑定到发起登录的浏览器。
+	oidcStateCookie = "stream_runner_oidc_state"
+	// csrfHeader 是会话发起修改请求时必须携带的 CSRF 令牌请求头，值从 GET /auth/session 获得。
+	csrfHeader = "X-CSRF-Token"
+)
+
+// oidcLoginTimeout 是从跳转到身份提供方到回调的最长时间。
+const oidcLoginTimeout = 10 * time.Minute
+
+// 未完成的登录和会话数量的上限，防止大量登录请求耗尽内存。
+const (
+	maxPendingLogins = 1000
+	maxSessions      = 10000
+)
+
+// ssoSession 是一个单点登录会话。会话只保存在内存中，守护进程重启后需要重新登录。
+type ssoSession struct {
+	// token 是 Cookie 中的会话令牌，只用于查找，不出现在接口和日志中。
+	token string
+	// id 是会话令牌哈希的前缀，用于在 /sessions 中列出和撤销会话。
+	id      string
+	csrf    string
+	subject string
+	user    string
+	groups  []string
+	addr    string
+	// issuer 和 clientID 是创建会话时的单点登录配置，配置修改后会话失效。
+	issuer   string
+	clientID string
+	created  time.Time
+	lastSeen time.Time
+	expires  time.Time
+}
+
+// sessionInfo 是 /sessions 和 /auth/session 中的会话信息。
+type sessionInfo struct {
+	ID      string `json:"id"`
+	User    string `json:"user"`
+	Subject string `json:"subject"`
+	// Role 是按当前配置的组映射得到的角色。
+	Role     string    `json:"role"`
+	Groups   []string  `json:"groups,omitempty"`
+	Addr     string    `json:"addr,omitempty"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"last_seen"`
+	Expires  time.Time `json:"expires"`
+}
+
+// pendingLogin 是已跳转到身份提供方、等待回调的登录。
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	next     string
+	expires  time.Time
+}
+
+// sessionStore 保存单点登录会话和未完成的登录。
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*ssoSession
+	pending  map[string]pendingLogin
+}
+
+// ssoSessions 是管理接口的单点登录会话。
+var ssoSessions = newSessionStore()
+
+// newSessionStore 创建空的会话存储。
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*ssoSession), pending: make(map[string]pendingLogin)}
+}
+
+// randomToken 返回 n 字节随机数的 base64url 编码。
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// valid 判断会话在 now 时是否仍然有效。
+func (s *ssoSession) valid(c *OIDCConfig, now time.Time) bool {
+	return c != nil && s.issuer == c.Issuer && s.clientID == c.ClientID &&
+		now.Before(s.expires) && now.Sub(s.lastSeen) < c.idleTimeout()
+}
+
+// info 返回会话信息，角色按 c 中当前的组映射计算。
+func (s *ssoSession) info(c *OIDCConfig) sessionInfo {
+	return sessionInfo{
+		ID: s.id, User: s.user, Subject: s.subject, Role: c.role(s.groups), Groups: s.groups, Addr: s.addr,
+		Created: s.created, LastSeen: s.lastSeen, Expires: s.expires,
+	}
+}
+
+// prune 删除过期的会话和登录，调用方持有 mu。
+func (st *sessionStore) prune(c *OIDCConfig, now time.Time) {
+	for token, s := range st.sessions {
+		if !s.valid(c, now) {
+			delete(st.sessions, token)
+		}
+	}
+	for state, p := range st.pending {
+		if now.After(p.expires) {
+			delete(st.pending, state)
+		}
+	}
+}
+
+// startLogin 记录一次跳转到身份提供方的登录。
+func (st *sessionStore) startLogin(c *OIDCConfig, state string, p pendingLogin, now time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.prune(c, now)
+	if len(st.pending) >= maxPendingLogins {
+		return fmt.Errorf("too many logins in progress")
+	}
+	st.pending[state] = p
+	return nil
+}
+
+// finishLogin 取出 state 对应的登录，每个 state 只能使用一次。
+func (st *sessionStore) finishLogin(state string, now time.Time) (pendingLogin, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p, ok := st.pending[state]
+	delete(st.pending, state)
+	return p, ok && now.Before(p.expires)
+}
+
+// create 为登录成功的用户创建会话。
+func (st *sessionStore) create(c *OIDCConfig, id oidcIdentity, addr string, now time.Time) (*ssoSession, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(token))
+	s := &ssoSession{
+		token: token, id: hex.EncodeToString(sum[:8]), csrf: csrf,
+		subject: id.Subject, user: id.User, groups: id.Groups, addr: addr,
+		issuer: c.Issuer, clientID: c.ClientID,
+		created: now, lastSeen: now, expires: now.Add(c.sessionTTL()),
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.prune(c, now)
+	if len(st.sessions) >= maxSessions {
+		return nil, fmt.Errorf("too many sessions")
+	}
+	st.sessions[token] = s
+	return s, nil
+}
+
+// lookup 返回会话令牌对应的有效会话的副本并刷新最近活动时间，无效的会话被删除。
+func (st *sessionStore) lookup(c *OIDCConfig, token string, now time.Time) (ssoSession, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.sessions[token]
+	if !ok {
+		return ssoSession{}, false
+	}
+	if !s.valid(c, now) {
+		delete(st.sessions, token)
+		return ssoSession{}, false
+	}
+	s.lastSeen = now
+	return *s, true
+}
+
+// remove 删除会话令牌对应的会话。
+func (st *sessionStore) remove(token string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sessions, token)
+}
+
+// revoke 撤销 ID 为 id 或用户为 user 的会话，返回被撤销的会话。
+func (st *sessionStore) revoke(c *OIDCConfig, id, user string) []sessionInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var out []sessionInfo
+	for token, s := range st.sessions {
+		if (id != "" && s.id == id) || (user != "" && s.user == user) {
+			out = append(out, s.info(c))
+			delete(st.sessions, token)
+		}
+	}
+	return out
+}
+
+// list 返回所有有效的会话，按创建时间排序。
+func (st *sessionStore) list(c *OIDCConfig, now time.Time) []sessionInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.prune(c, now)
+	out := make([]sessionInfo, 0, len(st.sessions))
+	for _, s := range st.sessions {
+		out = append(out, s.info(c))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+// oidcConfig 返回当前生效的单点登录配置，未配置时为 nil。
+func oidcConfig(state *AppState) *OIDCConfig {
+	if c := apiConfig(state); c != nil {
+		return c.OIDC
+	}
+	return nil
+}
+
+// sessionActor 返回会话在审计记录中的身份。
+func sessionActor(s ssoSession) string {
+	return "sso:" + s.user
+}
+
+// secureCookies 判断是否只通过 HTTPS 发送 Cookie。
+func secureCookies(c *OIDCConfig, r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(c.RedirectURL, "https://")
+}
+
+// clearCookie 让浏览器删除 Cookie。
+func clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: path, MaxAge: -1, HttpOnly: true})
+}
+
+// remoteHost 返回请求来源的 IP。
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// serveSession 以会话身份执行管理接口请求：角色按当前配置的组映射计算，修改请求还需要 CSRF 令牌。
+func serveSession(w http.ResponseWriter, r *http.Request, c *OIDCConfig, token string, h http.Handler) {
+	s, ok := ssoSessions.lookup(c, token, time.Now())
+	if !ok {
+		clearCookie(w, sessionCookie, "/")
+		writeAPIError(w, http.StatusUnauthorized, "session expired or invalid, sign in again")
+		return
+	}
+	role := c.role(s.groups)
+	if role == "" {
+		// The group mapping changed since login and no longer grants any role.
+		ssoSessions.remove(token)
+		clearCookie(w, sessionCookie, "/")
+		writeAPIError(w, http.StatusForbidden, "none of your groups is mapped to a role")
+		return
+	}
+	authorizeAPI(w, r, sessionActor(s), role, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(s.csrf)) != 1 {
+			writeAPIError(w, http.StatusForbidden, "missing or invalid "+csrfHeader+" header")
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+}
+
+// handleAuth 处理单点登录：GET /auth/login 跳转到身份提供方，GET /auth/callback 完成登录并设置会话 Cookie，
+// GET /auth/session 返回当前会话和 CSRF 令牌，POST /auth/logout 退出登录。未配置单点登录时返回 404。
+// base 是反向代理的路径前缀，加在跳转地址和登录流程的 Cookie 路径前。
+func handleAuth(state *AppState, base string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := oidcConfig(state)
+		if c == nil {
+			writeAPIError(w, http.StatusNotFound, "single sign-on is not configured")
+			return
+		}
+		route, method := r.URL.Path, http.MethodGet
+		if route == "/auth/logout" {
+			method = http.MethodPost
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		switch route {
+		case "/auth/login":
+			oidcLogin(w, r, c, base)
+		case oidcCallbackPath:
+			oidcCallback(w, r, c, base)
+		case "/auth/session":
+			cookie, err := r.Cookie(sessionCookie)
+			if err != nil {
+				writeAPIJSON(w, http.StatusUnauthorized, map[string]string{"error": "not signed in", "login": base + "/auth/login"})
+				return
+			}
+			s, ok := ssoSessions.lookup(c, cookie.Value, time.Now())
+			if !ok {
+				clearCookie(w, sessionCookie, "/")
+				writeAPIJSON(w, http.StatusUnauthorized, map[string]string{"error": "session expired", "login": base + "/auth/login"})
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, struct {
+				sessionInfo
+				CSRFToken string `json:"csrf_token"`
+			}{s.info(c), s.csrf})
+		case "/auth/logout":
+			cookie, err := r.Cookie(sessionCookie)
+			if err == nil {
+				s, ok := ssoSessions.lookup(c, cookie.Value, time.Now())
+				if ok && subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(s.csrf)) != 1 {
+					writeAPIError(w, http.StatusForbidden, "missing or invalid "+csrfHeader+" header")
+					return
+				}
+				ssoSessions.remove(cookie.Value)
+				if ok {
+					slog.Info("sso logout", "user", s.user)
+					writeAudit(auditEntry{Actor: sessionActor(s), Via: AuditViaAPI, Action: "logout"})
+				}
+			}
+			clearCookie(w, sessionCookie, "/")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeAPIError(w, http.StatusNotFound, "not found")
+		}
+	}
+}
+
+// oidcLogin 跳转到身份提供方的登录页，next 是登录后返回的仪表盘页面。
+func oidcLogin(w http.ResponseWriter, r *http.Request, c *OIDCConfig, base string) {
+	p, err := discoverOIDC(c.Issuer)
+	if err != nil {
+		slog.Error("sso login failed", "error", err)
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	next := r.URL.Query().Get("next")
+	// Only dashboard pages are accepted so the login cannot be used as an open redirect.
+	if !strings.HasPrefix(next, "/ui/") || strings.ContainsAny(next, `\`) {
+		next = "/ui/"
+	}
+	var tokens [3]string
+	for i := range tokens {
+		if tokens[i], err = randomToken(32); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	state, nonce, verifier := tokens[0], tokens[1], tokens[2]
+	now := time.Now()
+	if err := ssoSessions.startLogin(c, state, pendingLogin{nonce: nonce, verifier: verifier, next: base + next, expires: now.Add(oidcLoginTimeout)}, now); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: oidcStateCookie, Value: state, Path: base + "/auth/", MaxAge: int(oidcLoginTimeout / time.Second),
+		HttpOnly: true, Secure: secureCookies(c, r), SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, p.authCodeURL(c, state, nonce, verifier), http.StatusFound)
+}
+
+// oidcCallback 校验身份提供方的回调，换取并校验 ID 令牌，按组映射角色后创建会话。
+func oidcCallback(w http.ResponseWriter, r *http.Request, c *OIDCConfig, base string) {
+	q := r.URL.Query()
+	clearCookie(w, oidcStateCookie, base+"/auth/")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+		http.Error(w, "login state does not match, start the login again", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	pending, ok := ssoSessions.finishLogin(q.Get("state"), now)
+	if !ok {
+		http.Error(w, "login expired, start the login again", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		slog.Warn("sso login rejected by identity provider", "error", e, "description", q.Get("error_description"))
+		http.Error(w, "login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	p, err := discoverOIDC(c.Issuer)
+	if err != nil {
+		slog.Error("sso login failed", "error", err)
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	raw, err := p.exchange(c, q.Get("code"), pending.verifier)
+	if err != nil {
+		slog.Warn("sso login failed", "error", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	id, err := p.verifyIDToken(c, raw, pending.nonce, now)
+	if err != nil {
+		slog.Warn("sso login failed", "error", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	role := c.role(id.Groups)
+	if role == "" {
+		slog.Warn("sso login denied, no group is mapped to a role", "user", id.User, "groups", id.Groups)
+		writeAudit(auditEntry{Actor: "sso:" + id.User, Via: AuditViaAPI, Action: "login", Result: AuditResultDenied, Error: "no group is mapped to a role"})
+		http.Error(w, "none of your groups is allowed to use stream-runner", http.StatusForbidden)
+		return
+	}
+	s, err := ssoSessions.create(c, id, remoteHost(r), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	slog.Info("sso login", "user", s.user, "role", role, "session", s.id)
+	writeAudit(auditEntry{Actor: sessionActor(*s), Via: AuditViaAPI, Action: "login", After: s.info(c)})
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: s.token, Path: "/", Expires: s.expires,
+		HttpOnly: true, Secure: secureCookies(c, r), SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, pending.next, http.StatusFound)
+}
+
+// handleSessions 处理 GET /sessions（列出单点登录会话）、DELETE /sessions/{id}（撤销一个会话）
+// 和 DELETE /sessions?user=...（撤销某个用户的所有会话，如人员离职）。
+func handleSessions(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := oidcConfig(state)
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			if c == nil {
+				writeAPIJSON(w, http.StatusOK, []sessionInfo{})
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, ssoSessions.list(c, time.Now()))
+		case r.Method == http.MethodDelete:
+			user := r.URL.Query().Get("user")
+			if id == "" && user == "" {
+				writeAPIError(w, http.StatusBadRequest, "session id or user is required")
+				return
+			}
+			if id != "" {
+				user = ""
+			}
+			revoked := ssoSessions.revoke(c, id, user)
+			for _, s := range revoked {
+				slog.Info("sso session revoked", "user", s.User, "session", s.ID)
+			}
+			if len(revoked) > 0 {
+				auditChange(r, "", revoked, nil)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSessionStore 测试会话的有效期、空闲超时、配置修改后失效和按用户撤销
+func TestSessionStore(t *testing.T) {
+	c := &OIDCConfig{Issuer: "https://sso.example.com", ClientID: "runner", SessionTTL: 2 * time.Hour, IdleTimeout: 30 * time.Minute,
+		Roles: map[string]string{"noc": APIRoleOperator}}
+	st := newSessionStore()
+	now := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	create := func(user string) *ssoSession {
+		s, err := st.create(c, oidcIdentity{Subject: user, User: user, Groups: []string{"noc"}}, "192.0.2.1", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	a, b, b2 := create("alice"), create("bob"), create("bob")
+
+	// Activity keeps a session alive past the idle timeout, but not past its ttl.
+	for i := 1; i <= 4; i++ {
+		if _, ok := st.lookup(c, a.token, now.Add(time.Duration(i)*20*time.Minute)); !ok {
+			t.Fatalf("active session expired after %d minutes", i*20)
+		}
+	}
+	if _, ok := st.lookup(c, a.token, now.Add(2*time.Hour)); ok {
+		t.Error("session outlived its ttl")
+	}
+	if _, ok := st.lookup(c, b.token, now.Add(31*time.Minute)); ok {
+		t.Error("idle session is still valid")
+	}
+
+	other := *c
+	other.ClientID = "another-client"
+	if _, ok := st.lookup(&other, b2.token, now); ok {
+		t.Error("session is valid after the client changed")
+	}
+	c2 := create("bob")
+	if got := st.revoke(c, "", "bob"); len(got) != 1 || got[0].ID != c2.id || got[0].Role != APIRoleOperator {
+		t.Errorf("revoke by user: %+v", got)
+	}
+	if _, ok := st.lookup(c, c2.token, now); ok {
+		t.Error("revoked session is still valid")
+	}
+	if got := st.list(c, now); len(got) != 0 {
+		t.Errorf("expected no sessions, got %+v", got)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRestartDelay 是 ffmpeg 退出或启动失败后的默认重试间隔。
+	DefaultRestartDelay = 1 * time.Second
+	// DefaultWatchdogInterval 是看门狗检查工作器的默认间隔。
+	DefaultWatchdogInterval = 5 * time.Second
+	// DefaultWatchdogGrace 是守护进程启动后看门狗开始检查前的默认等待时间。
+	DefaultWatchdogGrace = 10 * time.Second
+	// DefaultStartTimeout 是 ffmpeg 启动后等待输出开始前进的默认时长。
+	DefaultStartTimeout = 30 * time.Second
+	// DefaultStopTimeout 是停止 ffmpeg 时从 SIGTERM 升级到 SIGKILL 前的默认等待时间。
+	DefaultStopTimeout = 10 * time.Second
+	// DefaultReloadConcurrency 是重载时同时停止或重启的工作器数。
+	DefaultReloadConcurrency = 16
+	// DefaultLogRotateInterval 是检查主日志是否需要轮转的默认间隔。
+	DefaultLogRotateInterval = time.Hour
+	// DefaultLoopStallTimeout 是核心循环没有进展多久后判定卡住的默认时长。
+	DefaultLoopStallTimeout = 5 * time.Minute
+)
+
+// Settings 表示守护进程的运行参数，未设置的项使用编译时的默认值。
+// log_file、pid_file 和 audit_log 只在启动时读取，其余参数在重载后生效。
+type Settings struct {
+	// LogFile 是主日志文件路径，日志目录为其所在目录（可选）。
+	LogFile string `yaml:"log_file,omitempty"`
+	// PIDFile 是 PID 文件路径（可选）。
+	PIDFile string `yaml:"pid_file,omitempty"`
+	// AuditLog 是控制操作审计日志的路径（可选），默认为日志目录下的 audit.log。
+	AuditLog string `yaml:"audit_log,omitempty"`
+	// LogMaxSize 是主日志轮转的大小阈值，默认 100MB。
+	LogMaxSize ByteSize `yaml:"log_max_size,omitempty"`
+	// LogMaxFiles 是保留的轮转日志数量，默认 5。
+	LogMaxFiles int `yaml:"log_max_files,omitempty"`
+	// LogRotateInterval 是检查日志大小的间隔，默认 1h。
+	LogRotateInterval time.Duration `yaml:"log_rotate_interval,omitempty"`
+	// WatchdogInterval 是看门狗检查工作器的间隔，默认 5s。
+	WatchdogInterval time.Duration `yaml:"watchdog_interval,omitempty"`
+	// WatchdogGrace 是启动后看门狗开始检查前的等待时间，默认 10s。
+	WatchdogGrace time.Duration `yaml:"watchdog_grace,omitempty"`
+	// RestartDelay 是 ffmpeg 退出或启动失败后的重试间隔，默认 1s。
+	RestartDelay time.Duration `yaml:"restart_delay,omitempty"`
+	// MaintenanceRetryDelay 是目标维护窗口内断开后的重试间隔，默认 30s。
+	MaintenanceRetryDelay time.Duration `yaml:"maintenance_retry_delay,omitempty"`
+	// IncompatibleRetryDelay 是源流与输出不兼容时的重试间隔，默认 30s。
+	IncompatibleRetryDelay time.Duration `yaml:"incompatible_retry_delay,omitempty"`
+	// StartTimeout 是 ffmpeg 启动后等待输出开始前进的时长，超时视为卡住并终止，默认 30s。
+	StartTimeout time.Duration `yaml:"start_timeout,omitempty"`
+	// StopTimeout 是停止 ffmpeg 时发送 SIGTERM 后等待其写完文件尾并退出的时长，超时后发送 SIGKILL，默认 10s。
+	StopTimeout time.Duration `yaml:"stop_timeout,omitempty"`
+	// ReloadConcurrency 是重载时同时停止或重启的工作器数，默认 16。
+	ReloadConcurrency int `yaml:"reload_concurrency,omitempty"`
+	// LoopStallTimeout 是信号处理、看门狗、配置应用等核心循环没有进展多久后判定卡住，默认 5m。
+	LoopStallTimeout time.Duration `yaml:"loop_stall_timeout,omitempty"`
+	// NodeID 是事件中的节点名，默认为主机名。多个节点的事件汇总到同一处时用于区分来源。
+	NodeID string `yaml:"node_id,omitempty"`
+}
+
+// validate 校验运行参数。
+func (s *Settings) validate() error {
+	for name, p := range map[string]string{"log_file": s.LogFile, "pid_file": s.PIDFile, "audit_log": s.AuditLog} {
+		if p != "" && !filepath.IsAbs(p) {
+			return fmt.Errorf("%s must be an absolute path", name)
+		}
+	}
+	if s.LogMaxSize < 0 || s.LogMaxFiles < 0 || s.ReloadConcurrency < 0 {
+		return fmt.Errorf("log_max_size, log_max_files and reload_concurrency must not be negative")
+	}
+	for name, d := range map[string]time.Duration{
+		"log_rotate_interval":      s.LogRotateInterval,
+		"watchdog_interval":        s.WatchdogInterval,
+		"watchdog_grace":           s.WatchdogGrace,
+		"restart_delay":            s.RestartDelay,
+		"maintenance_retry_delay":  s.MaintenanceRetryDelay,
+		"incompatible_retry_delay": s.IncompatibleRetryDelay,
+		"start_timeout":            s.StartTimeout,
+		"stop_timeout":             s.StopTimeout,
+		"loop_stall_timeout":       s.LoopStallTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的运行参数。
+func (s Settings) withDefaults() Settings {
+	if s.LogMaxSize == 0 {
+		s.LogMaxSize = MaxLogSize
+	}
+	if s.LogMaxFiles == 0 {
+		s.LogMaxFiles = MaxLogFiles
+	}
+	if s.LogRotateInterval == 0 {
+		s.LogRotateInterval = DefaultLogRotateInterval
+	}
+	if s.WatchdogInterval == 0 {
+		s.WatchdogInterval = DefaultWatchdogInterval
+	}
+	if s.WatchdogGrace == 0 {
+		s.WatchdogGrace = DefaultWatchdogGrace
+	}
+	if s.RestartDelay == 0 {
+		s.RestartDelay = DefaultRestartDelay
+	}
+	if s.MaintenanceRetryDelay == 0 {
+		s.MaintenanceRetryDelay = maintenanceRetryDelay
+	}
+	if s.IncompatibleRetryDelay == 0 {
+		s.IncompatibleRetryDelay = incompatibleRetryDelay
+	}
+	if s.StartTimeout == 0 {
+		s.StartTimeout = DefaultStartTimeout
+	}
+	if s.StopTimeout == 0 {
+		s.StopTimeout = DefaultStopTimeout
+	}
+	if s.ReloadConcurrency == 0 {
+		s.ReloadConcurrency = DefaultReloadConcurrency
+	}
+	if s.LoopStallTimeout == 0 {
+		s.LoopStallTimeout = DefaultLoopStallTimeout
+	}
+	return s
+}
+
+// runtimeSettings 是当前生效的运行参数，在配置重载时替换。
+var runtimeSettings atomic.Pointer[Settings]
+
+// currentSettings 返回当前生效且已填充默认值的运行参数。
+func currentSettings() Settings {
+	if s := runtimeSettings.Load(); s != nil {
+		return s.withDefaults()
+	}
+	return Settings{}.withDefaults()
+}
+
+// applyPathSettings 用配置中的路径覆盖默认的日志和 PID 文件路径。
+func applyPathSettings(s *Settings) {
+	if s == nil {
+		return
+	}
+	if s.LogFile != "" {
+		paths.LogFile = s.LogFile
+		paths.LogDir = filepath.Dir(s.LogFile)
+		paths.AuditLog = filepath.Join(paths.LogDir, "audit.log")
+	}
+	if s.PIDFile != "" {
+		paths.PIDFile = s.PIDFile
+	}
+	if s.AuditLog != "" {
+		paths.AuditLog = s.AuditLog
+	}
+}
+
+// pathSettingsChanged 判断两份配置的日志、PID 或审计日志文件路径是否不同。
+func pathSettingsChanged(a, b *Settings) bool {
+	var x, y Settings
+	if a != nil {
+		x = *a
+	}
+	if b != nil {
+		y = *b
+	}
+	return x.LogFile != y.LogFile || x.PIDFile != y.PIDFile || x.AuditLog != y.AuditLog
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSettingsDefaults 测试运行参数的默认值、校验和路径覆盖
+func TestSettingsDefaults(t *testing.T) {
+	s := Settings{RestartDelay: 3 * time.Second}.withDefaults()
+	if s.RestartDelay != 3*time.Second || s.WatchdogInterval != DefaultWatchdogInterval || s.LogMaxSize != MaxLogSize {
+		t.Errorf("withDefaults = %+v", s)
+	}
+	if err := (&Settings{LogFile: "relative.log"}).validate(); err == nil {
+		t.Error("expected error for relative log_file")
+	}
+	if err := (&Settings{WatchdogGrace: -time.Second}).validate(); err == nil {
+		t.Error("expected error for negative duration")
+	}
+
+	old := paths
+	defer func() { paths = old }()
+	applyPathSettings(&Settings{LogFile: "/data/logs/relay.log", PIDFile: "/run/relay.pid"})
+	if paths.LogFile != "/data/logs/relay.log" || paths.LogDir != "/data/logs" || paths.PIDFile != "/run/relay.pid" {
+		t.Errorf("paths = %+v", paths)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encodeSnapshot 将配置编码为可直接提交到版本库的 YAML，文件头注明导出时间。
+func encodeSnapshot(cfg *Config, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Effective stream-runner config exported at %s\n", now.Format(time.RFC3339))
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// saveSnapshot 把当前生效的配置写入快照文件，在配置加载或运行时修改后调用。
+// 快照包含推流密钥，因此只有守护进程的运行用户可读。写入失败不影响运行。
+func saveSnapshot(cfg *Config) {
+	data, err := encodeSnapshot(cfg, time.Now())
+	if err != nil {
+		slog.Warn("failed to encode config snapshot", "error", err)
+		return
+	}
+	// WriteFile keeps the owner of an existing file, so updates still work after run_as.
+	if err := os.WriteFile(paths.Snapshot, data, 0600); err != nil {
+		slog.Warn("failed to write config snapshot", "path", paths.Snapshot, "error", withPermissionHint(err,
+			"after dropping privileges the snapshot must be writable by run_as user"))
+	}
+}
+
+// removeSnapshot 在守护进程退出时删除快照，避免把已停止的状态当作当前状态导出。
+func removeSnapshot() {
+	if err := os.Remove(paths.Snapshot); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove config snapshot", "error", err)
+	}
+}
+
+// runExportConfig 实现 export-config 子命令：导出运行中守护进程当前生效的配置。
+func runExportConfig(args []string) int {
+	fs := flag.NewFlagSet("export-config", flag.ContinueOnError)
+	output := fs.String("output", "", T("flag.output.stdout"))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	data, err := os.ReadFile(paths.Snapshot)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "ERROR: no snapshot at %s, is the daemon running?\n", paths.Snapshot)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	// Make sure a truncated snapshot is never committed as config.
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid snapshot: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "[*] wrote %s (%d streams)\n", *output, len(cfg.Streams))
+	return 0
+}
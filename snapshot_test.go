@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestEncodeSnapshot 测试配置快照可以被重新加载且与原配置一致
+func TestEncodeSnapshot(t *testing.T) {
+	cfg := &Config{
+		Version: CurrentConfigVersion,
+		Streams: []StreamConfig{
+			{ID: "s1", Src: "rtmp://src/live/a", Dst: "rtmp://dst/live/a", Probe: true, KeyframeInterval: 2 * time.Second},
+		},
+		Maintenance: []MaintenanceWindow{{Hosts: []string{"*.example.com"}, Start: "02:00", Duration: time.Hour}},
+	}
+	data, err := encodeSnapshot(cfg, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("encodeSnapshot: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "# Effective stream-runner config exported at 2024-01-02T03:04:05Z\n") {
+		t.Errorf("missing header:\n%s", data)
+	}
+	if strings.Contains(string(data), "burn_in_until") || strings.Contains(string(data), "sandbox") {
+		t.Errorf("snapshot contains unset fields:\n%s", data)
+	}
+	var got Config
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Streams[0].KeyframeInterval != 2*time.Second || !got.Streams[0].Probe || got.Maintenance[0].Duration != time.Hour {
+		t.Errorf("round trip mismatch: %+v", got)
+	}
+}
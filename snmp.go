@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSNMPBaseOID 是自定义 MIB 的默认根 OID（streamRunnerMIB）。
+	DefaultSNMPBaseOID = "1.3.6.1.4.1.32473.1"
+
+	// snmpMaxBulkVarbinds 是单个 GETBULK 响应的最大变量数（non-repeaters 和各轮重复合计），避免超出 UDP 报文大小。
+	snmpMaxBulkVarbinds = 100
+)
+
+// BER/SNMP 标签。
+const (
+	berInteger     byte = 0x02
+	berOctetString byte = 0x04
+	berNull        byte = 0x05
+	berOID         byte = 0x06
+	berSequence    byte = 0x30
+	berCounter32   byte = 0x41
+	berGauge32     byte = 0x42
+	berTimeTicks   byte = 0x43
+
+	snmpNoSuchObject byte = 0x80
+	snmpEndOfMib     byte = 0x82
+
+	pduGet      byte = 0xa0
+	pduGetNext  byte = 0xa1
+	pduResponse byte = 0xa2
+	pduSet      byte = 0xa3
+	pduGetBulk  byte = 0xa5
+
+	snmpVersion2c      = 1
+	snmpErrNotWritable = 17
+)
+
+// SNMPConfig 表示 SNMP 代理配置。
+type SNMPConfig struct {
+	// Listen 是 SNMP UDP 监听地址，如 ":1161"。修改后需重启生效。
+	Listen string `yaml:"listen"`
+	// Community 是只读团体名，默认为 public。
+	Community string `yaml:"community,omitempty"`
+	// BaseOID 是自定义 MIB 的根 OID，默认为 DefaultSNMPBaseOID。
+	BaseOID string `yaml:"base_oid,omitempty"`
+}
+
+// mibEntry 是 MIB 树中的一个叶子节点。
+type mibEntry struct {
+	oid   []uint32
+	value []byte // BER-encoded value.
+}
+
+// snmpAgent 是只读的 SNMPv2c 代理，导出守护进程和每路流的状态。
+type snmpAgent struct {
+	state     *AppState
+	community string
+	base      []uint32
+	started   time.Time
+}
+
+// newSNMPAgent 根据配置创建 SNMP 代理。
+func newSNMPAgent(state *AppState, cfg *SNMPConfig) (*snmpAgent, error) {
+	baseOID := cfg.BaseOID
+	if baseOID == "" {
+		baseOID = DefaultSNMPBaseOID
+	}
+	base, err := parseOID(baseOID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base_oid: %w", err)
+	}
+	community := cfg.Community
+	if community == "" {
+		community = "public"
+	}
+	return &snmpAgent{state: state, community: community, base: base, started: time.Now()}, nil
+}
+
+// serve 在已绑定的 UDP 连接上处理 SNMP 请求。
+func (a *snmpAgent) serve(conn net.PacketConn) {
+	slog.Info("snmp agent listening", "addr", conn.LocalAddr().String())
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			slog.Error("snmp agent stopped", "error", err)
+			return
+		}
+		resp, err := a.handle(buf[:n])
+		if err != nil {
+			slog.Debug("dropping snmp request", "remote", addr.String(), "error", err)
+			continue
+		}
+		if _, err := conn.WriteTo(resp, addr); err != nil {
+			slog.Warn("failed to send snmp response", "remote", addr.String(), "error", err)
+		}
+	}
+}
+
+// handle 解析一个 SNMP 请求报文并返回响应报文。
+func (a *snmpAgent) handle(req []byte) ([]byte, error) {
+	tag, msg, _, err := berRead(req)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("malformed message")
+	}
+	tag, versionBytes, msg, err := berRead(msg)
+	if err != nil || tag != berInteger {
+		return nil, errors.New("malformed version")
+	}
+	if berParseInt(versionBytes) != snmpVersion2c {
+		return nil, errors.New("unsupported snmp version")
+	}
+	tag, community, msg, err := berRead(msg)
+	if err != nil || tag != berOctetString {
+		return nil, errors.New("malformed community")
+	}
+	if string(community) != a.community {
+		return nil, errors.New("community mismatch")
+	}
+	pduType, pdu, _, err := berRead(msg)
+	if err != nil {
+		return nil, errors.New("malformed pdu")
+	}
+
+	var fields [3]int64
+	for i := range fields {
+		var content []byte
+		if tag, content, pdu, err = berRead(pdu); err != nil || tag != berInteger {
+			return nil, errors.New("malformed pdu header")
+		}
+		fields[i] = berParseInt(content)
+	}
+	requestID := fields[0]
+
+	tag, vbList, _, err := berRead(pdu)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("malformed varbind list")
+	}
+	var oids [][]uint32
+	for len(vbList) > 0 {
+		var vb, oidBytes []byte
+		if tag, vb, vbList, err = berRead(vbList); err != nil || tag != berSequence {
+			return nil, errors.New("malformed varbind")
+		}
+		if tag, oidBytes, _, err = berRead(vb); err != nil || tag != berOID {
+			return nil, errors.New("malformed varbind oid")
+		}
+		oid, err := berParseOID(oidBytes)
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+
+	entries := a.mibEntries()
+	var varbinds [][]byte
+	var errorStatus, errorIndex int64
+	switch pduType {
+	case pduGet:
+		for _, oid := range oids {
+			varbinds = append(varbinds, encodeVarbind(oid, lookupExact(entries, oid)))
+		}
+	case pduGetNext:
+		for _, oid := range oids {
+			varbinds = append(varbinds, encodeNext(entries, oid))
+		}
+	case pduGetBulk:
+		nonRepeaters, maxRepetitions := int(fields[1]), int(fields[2])
+		if nonRepeaters < 0 {
+			nonRepeaters = 0
+		}
+		if nonRepeaters > len(oids) {
+			nonRepeaters = len(oids)
+		}
+		for _, oid := range oids[:nonRepeaters] {
+			if len(varbinds) >= snmpMaxBulkVarbinds {
+				break
+			}
+			varbinds = append(varbinds, encodeNext(entries, oid))
+		}
+		repeaters := append([][]uint32(nil), oids[nonRepeaters:]...)
+		for r := 0; r < maxRepetitions && len(repeaters) > 0 && len(varbinds) < snmpMaxBulkVarbinds; r++ {
+			for i, oid := range repeaters {
+				// RFC 3416 allows truncating the last repetition when the response would be too large.
+				if len(varbinds) >= snmpMaxBulkVarbinds {
+					break
+				}
+				next := nextEntry(entries, oid)
+				if next == nil {
+					varbinds = append(varbinds, encodeVarbind(oid, []byte{snmpEndOfMib, 0}))
+					continue
+				}
+				varbinds = append(varbinds, encodeVarbind(next.oid, next.value))
+				repeaters[i] = next.oid
+			}
+		}
+	case pduSet:
+		errorStatus, errorIndex = snmpErrNotWritable, 1
+		for _, oid := range oids {
+			varbinds = append(varbinds, encodeVarbind(oid, []byte{berNull, 0}))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pdu type 0x%x", pduType)
+	}
+
+	body := berTLV(berSequence, bytes.Join(varbinds, nil))
+	respPDU := berTLV(pduResponse, bytes.Join([][]byte{
+		berInt(berInteger, requestID),
+		berInt(berInteger, errorStatus),
+		berInt(berInteger, errorIndex),
+		body,
+	}, nil))
+	return berTLV(berSequence, bytes.Join([][]byte{
+		berInt(berInteger, snmpVersion2c),
+		berTLV(berOctetString, []byte(a.community)),
+		respPDU,
+	}, nil)), nil
+}
+
+// mibEntries 生成当前状态下按 OID 排序的 MIB 叶子节点。
+//
+//	base.1.0       streamCount      Gauge32
+//	base.2.0       daemonUptime     TimeTicks
+//	base.3.1.1.i   streamIndex      INTEGER
+//	base.3.1.2.i   streamId         OCTET STRING
+//	base.3.1.3.i   streamState      INTEGER running(1) stopped(2)
+//	base.3.1.4.i   streamRestarts   Counter32
+//	base.3.1.5.i   streamFailures   Counter32
+//	base.3.1.6.i   streamBitrate    Gauge32 (kbit/s)
+//
+// 表索引 i 按流 ID 排序从 1 开始，配置变更后可能变化，应通过 streamId 关联。
+func (a *snmpAgent) mibEntries() []mibEntry {
+	snaps := snapshotWorkers(a.state)
+	oid := func(arcs ...uint32) []uint32 {
+		return append(append([]uint32(nil), a.base...), arcs...)
+	}
+
+	entries := []mibEntry{
+		{oid(1, 0), berUint(berGauge32, uint64(len(snaps)))},
+		{oid(2, 0), berUint(berTimeTicks, uint64(time.Since(a.started)/(10*time.Millisecond)))},
+	}
+	columns := []func(i int, s workerSnapshot) []byte{
+		func(i int, _ workerSnapshot) []byte { return berInt(berInteger, int64(i)) },
+		func(_ int, s workerSnapshot) []byte { return berTLV(berOctetString, []byte(s.id)) },
+		func(_ int, s workerSnapshot) []byte {
+			if s.running {
+				return berInt(berInteger, 1)
+			}
+			return berInt(berInteger, 2)
+		},
+		func(_ int, s workerSnapshot) []byte { return berUint(berCounter32, uint64(uint32(s.stats.Restarts))) },
+		func(_ int, s workerSnapshot) []byte { return berUint(berCounter32, uint64(uint32(s.stats.Failures))) },
+		func(_ int, s workerSnapshot) []byte { return berUint(berGauge32, uint64(s.stats.Progress.Bitrate)) },
+	}
+	// Column-major order keeps entries sorted by OID.
+	for col, value := range columns {
+		for i, s := range snaps {
+			entries = append(entries, mibEntry{oid(3, 1, uint32(col+1), uint32(i+1)), value(i+1, s)})
+		}
+	}
+	return entries
+}
+
+// lookupExact 返回与 OID 完全匹配的值，不存在时返回 noSuchObject。
+func lookupExact(entries []mibEntry, oid []uint32) []byte {
+	for _, e := range entries {
+		if compareOID(e.oid, oid) == 0 {
+			return e.value
+		}
+	}
+	return []byte{snmpNoSuchObject, 0}
+}
+
+// nextEntry 返回字典序大于 OID 的第一个节点，不存在时返回 nil。
+func nextEntry(entries []mibEntry, oid []uint32) *mibEntry {
+	for i := range entries {
+		if compareOID(entries[i].oid, oid) > 0 {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// encodeNext 编码 GETNEXT 的单个结果。
+func encodeNext(entries []mibEntry, oid []uint32) []byte {
+	if next := nextEntry(entries, oid); next != nil {
+		return encodeVarbind(next.oid, next.value)
+	}
+	return encodeVarbind(oid, []byte{snmpEndOfMib, 0})
+}
+
+// encodeVarbind 编码一个 OID/值 对。
+func encodeVarbind(oid []uint32, value []byte) []byte {
+	return berTLV(berSequence, append(berEncodeOID(oid), value...))
+}
+
+// compareOID 按字典序比较两个 OID。
+func compareOID(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// parseOID 解析点分格式的 OID。前两个弧必须合法（第一个不超过 2，第一个为 0 或 1 时第二个小于 40），
+// 否则无法编码为 BER 的第一个子标识符。
+func parseOID(s string) ([]uint32, error) {
+	parts := strings.Split(strings.Trim(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("oid %q is too short", s)
+	}
+	oid := make([]uint32, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %q: %w", s, err)
+		}
+		oid[i] = uint32(v)
+	}
+	if oid[0] > 2 {
+		return nil, fmt.Errorf("invalid oid %q: first arc must be 0, 1 or 2", s)
+	}
+	// The first two arcs share one subidentifier, so the second one stays below 40 under 0 and 1,
+	// and under 2 must leave room for 80 within 32 bits.
+	if (oid[0] < 2 && oid[1] >= 40) || oid[1] > math.MaxUint32-80 {
+		return nil, fmt.Errorf("invalid oid %q: second arc is out of range", s)
+	}
+	return oid, nil
+}
+
+// berTLV 编码一个 TLV。
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	n := len(content)
+	if n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var lenBytes []byte
+		for ; n > 0; n >>= 8 {
+			lenBytes = append([]byte{byte(n)}, lenBytes...)
+		}
+		out = append(out, 0x80|byte(len(lenBytes)))
+		out = append(out, lenBytes...)
+	}
+	return append(out, content...)
+}
+
+// berInt 以最短补码形式编码有符号整数。
+func berInt(tag byte, v int64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		if (v >= -128 && v < 128) || len(content) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, content)
+}
+
+// berUint 编码无符号整数（Counter32、Gauge32、TimeTicks），最高位为 1 时补前导零。
+func berUint(tag byte, v uint64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return berTLV(tag, content)
+}
+
+// berEncodeOID 编码 OID。前两个弧合并为第一个子标识符，与其余弧一样按 7 位分组编码，第一个弧为 2 时可以超过一个字节。
+func berEncodeOID(oid []uint32) []byte {
+	var content []byte
+	for _, arc := range append([]uint32{oid[0]*40 + oid[1]}, oid[2:]...) {
+		enc := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			enc = append([]byte{byte(arc&0x7f) | 0x80}, enc...)
+		}
+		content = append(content, enc...)
+	}
+	return berTLV(berOID, content)
+}
+
+// berRead 读取一个 TLV，返回标签、内容和剩余数据。
+func berRead(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated tlv")
+	}
+	tag = data[0]
+	length := int(data[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return 0, nil, nil, errors.New("invalid length")
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if length < 0 || len(data)-offset < length {
+		return 0, nil, nil, errors.New("truncated tlv")
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+// berParseInt 解析补码整数内容。
+func berParseInt(content []byte) int64 {
+	var v int64
+	for i, b := range content {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+// berParseOID 解析 OID 内容。
+func berParseOID(content []byte) ([]uint32, error) {
+	if len(content) == 0 {
+		return nil, errors.New("empty oid")
+	}
+	var oid []uint32
+	var arc uint32
+	for _, b := range content {
+		arc = arc<<7 | uint32(b&0x7f)
+		if b&0x80 != 0 {
+			continue
+		}
+		if oid == nil {
+			// The first subidentifier holds the first two arcs; a first arc of 2 takes everything from 80 up.
+			first := min(arc/40, 2)
+			oid = []uint32{first, arc - first*40}
+		} else {
+			oid = append(oid, arc)
+		}
+		arc = 0
+	}
+	if oid == nil {
+		return nil, errors.New("truncated oid")
+	}
+	return oid, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// buildSNMPRequest 构造一个 SNMPv2c 请求报文
+func buildSNMPRequest(pduType byte, community string, f1, f2 int64, oids ...[]uint32) []byte {
+	var varbinds [][]byte
+	for _, oid := range oids {
+		varbinds = append(varbinds, encodeVarbind(oid, []byte{berNull, 0}))
+	}
+	pdu := berTLV(pduType, bytes.Join([][]byte{
+		berInt(berInteger, 42),
+		berInt(berInteger, f1),
+		berInt(berInteger, f2),
+		berTLV(berSequence, bytes.Join(varbinds, nil)),
+	}, nil))
+	return berTLV(berSequence, bytes.Join([][]byte{
+		berInt(berInteger, snmpVersion2c),
+		berTLV(berOctetString, []byte(community)),
+		pdu,
+	}, nil))
+}
+
+// parseSNMPResponse 解析响应报文中的变量列表
+func parseSNMPResponse(t *testing.T, resp []byte) (oids [][]uint32, values [][]byte) {
+	t.Helper()
+	_, msg, _, _ := berRead(resp)
+	_, _, msg, _ = berRead(msg) // version
+	_, _, msg, _ = berRead(msg) // community
+	tag, pdu, _, err := berRead(msg)
+	if err != nil || tag != pduResponse {
+		t.Fatalf("expected response pdu, got 0x%x, %v", tag, err)
+	}
+	for i := 0; i < 3; i++ {
+		_, _, pdu, _ = berRead(pdu)
+	}
+	_, list, _, _ := berRead(pdu)
+	for len(list) > 0 {
+		var vb, oidBytes []byte
+		_, vb, list, _ = berRead(list)
+		_, oidBytes, value, _ := berRead(vb)
+		oid, err := berParseOID(oidBytes)
+		if err != nil {
+			t.Fatalf("failed to parse oid: %v", err)
+		}
+		oids = append(oids, oid)
+		values = append(values, value)
+	}
+	return oids, values
+}
+
+// TestSNMPAgentGetNext 测试 SNMP GETNEXT 遍历
+func TestSNMPAgentGetNext(t *testing.T) {
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{
+		"stream-b": {cfg: StreamConfig{ID: "stream-b"}},
+		"stream-a": {cfg: StreamConfig{ID: "stream-a"}, running: true},
+	})}
+	agent, err := newSNMPAgent(state, &SNMPConfig{Community: "secret"})
+	if err != nil {
+		t.Fatalf("newSNMPAgent failed: %v", err)
+	}
+
+	if _, err := agent.handle(buildSNMPRequest(pduGet, "wrong", 0, 0, agent.base)); err == nil {
+		t.Error("expected request with wrong community to be rejected")
+	}
+
+	// GETNEXT on the base returns streamCount.
+	resp, err := agent.handle(buildSNMPRequest(pduGetNext, "secret", 0, 0, agent.base))
+	if err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	oids, values := parseSNMPResponse(t, resp)
+	if len(oids) != 1 || compareOID(oids[0], append(append([]uint32(nil), agent.base...), 1, 0)) != 0 {
+		t.Fatalf("unexpected oids: %v", oids)
+	}
+	if !bytes.Equal(values[0], berUint(berGauge32, 2)) {
+		t.Errorf("expected stream count 2, got %x", values[0])
+	}
+
+	// streamId column is sorted by stream ID.
+	streamIDCol := append(append([]uint32(nil), agent.base...), 3, 1, 2)
+	resp, err = agent.handle(buildSNMPRequest(pduGetBulk, "secret", 0, 2, streamIDCol))
+	if err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+	_, values = parseSNMPResponse(t, resp)
+	if len(values) != 2 || !bytes.Equal(values[0], berTLV(berOctetString, []byte("stream-a"))) {
+		t.Errorf("unexpected bulk values: %x", values)
+	}
+}
+
+// TestBEREncoding 测试 BER 整数和 OID 编解码
+func TestBEREncoding(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -129, 1 << 40} {
+		_, content, _, err := berRead(berInt(berInteger, v))
+		if err != nil || berParseInt(content) != v {
+			t.Errorf("integer %d did not round-trip: %v", v, err)
+		}
+	}
+
+	for _, s := range []string{"1.3.6.1.4.1.32473.1.3.1.2.300", "0.39.1", "2.999.3", "2.100000"} {
+		oid, err := parseOID(s)
+		if err != nil {
+			t.Fatalf("parseOID(%q): %v", s, err)
+		}
+		_, content, _, _ := berRead(berEncodeOID(oid))
+		parsed, err := berParseOID(content)
+		if err != nil || compareOID(parsed, oid) != 0 {
+			t.Errorf("oid %s did not round-trip: %v, %v", s, parsed, err)
+		}
+	}
+	// 2.999.3 is the example from X.690: the first subidentifier 1079 takes two bytes.
+	if got := berEncodeOID([]uint32{2, 999, 3}); !bytes.Equal(got, []byte{berOID, 3, 0x88, 0x37, 0x03}) {
+		t.Errorf("2.999.3 encoded as %x", got)
+	}
+	for _, s := range []string{"3.1", "7.1.2", "0.40", "1.40.1", "2.4294967295"} {
+		if _, err := parseOID(s); err == nil {
+			t.Errorf("parseOID(%q) accepted an oid that cannot be encoded", s)
+		}
+	}
+}
+
+// TestSNMPGetBulkLimit 测试 GETBULK 响应的变量总数（含 non-repeaters）不超过 snmpMaxBulkVarbinds
+func TestSNMPGetBulkLimit(t *testing.T) {
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"stream-a": {cfg: StreamConfig{ID: "stream-a"}}})}
+	agent, err := newSNMPAgent(state, &SNMPConfig{Community: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oids := make([][]uint32, 3*snmpMaxBulkVarbinds)
+	for i := range oids {
+		oids[i] = agent.base
+	}
+	for _, c := range []struct{ nonRepeaters, repetitions int64 }{
+		{int64(len(oids)), 0},
+		{10, 1000},
+		{0, 7},
+	} {
+		resp, err := agent.handle(buildSNMPRequest(pduGetBulk, "secret", c.nonRepeaters, c.repetitions, oids...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := parseSNMPResponse(t, resp); len(got) != snmpMaxBulkVarbinds {
+			t.Errorf("non-repeaters %d, max-repetitions %d: %d varbinds, want %d", c.nonRepeaters, c.repetitions, len(got), snmpMaxBulkVarbinds)
+		}
+	}
+}
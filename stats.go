@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ffmpegProgress 是 ffmpeg -progress 输出的一次进度快照。
+type ffmpegProgress struct {
+	// Frame 是已输出的视频帧数。
+	Frame int64
+	// FPS 是当前输出帧率。
+	FPS float64
+	// Bitrate 是当前输出码率（kbit/s），未知时为 0。
+	Bitrate float64
+	// TotalSize 是本次运行已输出的字节数。
+	TotalSize int64
+	// OutTime 是已输出的媒体时长。
+	OutTime time.Duration
+	// Speed 是处理速度相对实时的倍数。
+	Speed float64
+}
+
+// progressWriter 解析 ffmpeg -progress 输出的 key=value 行，
+// 每收到一个完整的进度块（以 progress= 结尾）调用一次 onProgress。
+type progressWriter struct {
+	// buf 是缓冲区，用于处理不完整的行。
+	buf bytes.Buffer
+	// cur 是正在累积的进度块。
+	cur ffmpegProgress
+	// onProgress 是进度块完成时的回调。
+	onProgress func(ffmpegProgress)
+	// mu 保护并发写入的互斥锁。
+	mu sync.Mutex
+}
+
+// Write 实现 io.Writer 接口。
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf.Write(data)
+	for {
+		line, err := p.buf.ReadString('\n')
+		if err == io.EOF {
+			// Incomplete line, keep in buffer.
+			p.buf.WriteString(line)
+			break
+		}
+		p.parseLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+// parseLine 解析单行 key=value，无法识别的键和 N/A 值会被忽略。
+func (p *progressWriter) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "frame":
+		p.cur.Frame, _ = strconv.ParseInt(value, 10, 64)
+	case "fps":
+		p.cur.FPS, _ = strconv.ParseFloat(value, 64)
+	case "bitrate":
+		p.cur.Bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+	case "total_size":
+		p.cur.TotalSize, _ = strconv.ParseInt(value, 10, 64)
+	case "out_time_us":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			p.cur.OutTime = time.Duration(us) * time.Microsecond
+		}
+	case "speed":
+		p.cur.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	case "progress":
+		if p.onProgress != nil {
+			p.onProgress(p.cur)
+		}
+	}
+}
+
+// 错误类别，用于按最近错误筛选流。
+const (
+	// ErrorCategoryReadiness 表示就绪检查未通过。
+	ErrorCategoryReadiness = "readiness"
+	// ErrorCategorySecrets 表示密钥解析失败。
+	ErrorCategorySecrets = "secrets"
+	// ErrorCategoryDestination 表示目标选择或地址解析失败。
+	ErrorCategoryDestination = "destination"
+	// ErrorCategoryProbe 表示源流探测失败。
+	ErrorCategoryProbe = "probe"
+	// ErrorCategoryIncompatible 表示源流与输出封装不兼容。
+	ErrorCategoryIncompatible = "incompatible"
+	// ErrorCategoryStart 表示 ffmpeg 进程无法启动。
+	ErrorCategoryStart = "start"
+	// ErrorCategoryExit 表示 ffmpeg 异常退出。
+	ErrorCategoryExit = "exit"
+	// ErrorCategoryHung 表示 ffmpeg 启动后在 start_timeout 内没有输出，被判定为卡住并终止。
+	ErrorCategoryHung = "hung"
+)
+
+// errorCategories 是所有错误类别。
+var errorCategories = []string{
+	ErrorCategoryReadiness, ErrorCategorySecrets, ErrorCategoryDestination, ErrorCategoryProbe,
+	ErrorCategoryIncompatible, ErrorCategoryStart, ErrorCategoryExit, ErrorCategoryHung,
+}
+
+// streamError 是流最近一次出错的记录。
+type streamError struct {
+	// Category 是错误类别，见 ErrorCategory* 常量。
+	Category string
+	// Message 是错误描述。
+	Message string
+	// Time 是出错时间。
+	Time time.Time
+}
+
+// streamStats 是流工作器的累计运行统计，用于报表和状态展示。
+type streamStats struct {
+	// Starts 是 ffmpeg 成功启动的次数。
+	Starts int64
+	// Restarts 是首次启动之后的重启次数。
+	Restarts int64
+	// Failures 是 ffmpeg 异常退出的次数（含卡住后被终止）。
+	Failures int64
+	// Hangs 是 ffmpeg 启动后超时无输出而被终止的次数。
+	Hangs int64
+	// Uptime 是 ffmpeg 累计运行时长（含当前运行）。
+	Uptime time.Duration
+	// BytesOut 是累计输出字节数（含当前运行）。
+	BytesOut int64
+	// AVDrift 是最近一次音画同步检查测得的偏差，正值表示视频超前。
+	AVDrift time.Duration
+	// AVDriftMeasured 表示 AVDrift 是否已有测量值。
+	AVDriftMeasured bool
+	// ProbeFailed 表示最近一次读取源流（启动前探测、看门狗探测或音画同步检查）失败。
+	ProbeFailed bool
+	// Bitrates 是当前运行最近的输出码率采样（kbit/s），每 bitrateSampleInterval 一个。
+	Bitrates []float64
+	// Progress 是当前运行最近一次的进度快照。
+	Progress ffmpegProgress
+	// Proc 是当前运行的 ffmpeg 子进程最近一次资源采样。
+	Proc processStats
+	// LastError 是最近一次启动失败或异常退出的原因，从未出错时为零值。
+	LastError streamError
+	// runStart 是当前运行的开始时间，未运行时为零值。
+	runStart time.Time
+	// lastAdvance 是当前运行的输出最近一次前进的时间，用于判断 ffmpeg 是否卡住。
+	lastAdvance time.Time
+	// rateAt 和 rateBytes 是上一次码率采样的时间和已输出字节数。
+	rateAt    time.Time
+	rateBytes int64
+}
+
+const (
+	// bitrateSampleInterval 是输出码率的采样间隔，足够长以平滑关键帧带来的波动。
+	bitrateSampleInterval = 5 * time.Second
+	// bitrateSamples 是保留的码率采样数。
+	bitrateSamples = 12
+)
+
+// recordStart 记录一次 ffmpeg 启动。
+func (s *streamStats) recordStart(now time.Time) {
+	s.Starts++
+	if s.Starts > 1 {
+		s.Restarts++
+	}
+	s.runStart = now
+	s.lastAdvance = now
+	s.Progress = ffmpegProgress{}
+	s.Proc = processStats{}
+	s.Bitrates = nil
+	s.rateAt, s.rateBytes = now, 0
+}
+
+// advanced 判断当前运行的输出是否已经开始前进。
+func (s *streamStats) advanced() bool {
+	return s.lastAdvance.After(s.runStart)
+}
+
+// recordProgress 记录一次进度快照，输出时长或字节数增加时视为前进。返回是否新增了码率采样。
+func (s *streamStats) recordProgress(p ffmpegProgress, now time.Time) bool {
+	if p.OutTime > s.Progress.OutTime || p.TotalSize > s.Progress.TotalSize {
+		s.lastAdvance = now
+	}
+	if elapsed := now.Sub(s.rateAt); elapsed >= bitrateSampleInterval && p.TotalSize >= s.rateBytes {
+		s.Bitrates = append(s.Bitrates, float64(p.TotalSize-s.rateBytes)*8/1000/elapsed.Seconds())
+		if len(s.Bitrates) > bitrateSamples {
+			s.Bitrates = s.Bitrates[len(s.Bitrates)-bitrateSamples:]
+		}
+		s.rateAt, s.rateBytes = now, p.TotalSize
+		s.Progress = p
+		return true
+	}
+	s.Progress = p
+	return false
+}
+
+// recordExit 记录一次 ffmpeg 退出，将本次运行的时长和输出量计入累计值。
+func (s *streamStats) recordExit(now time.Time, failed bool) {
+	if !s.runStart.IsZero() {
+		s.Uptime += now.Sub(s.runStart)
+	}
+	s.BytesOut += s.Progress.TotalSize
+	if failed {
+		s.Failures++
+	}
+	s.runStart = time.Time{}
+	s.Progress = ffmpegProgress{}
+	s.Proc = processStats{}
+	s.Bitrates = nil
+}
+
+// snapshot 返回包含当前运行在内的统计快照。
+func (s *streamStats) snapshot(now time.Time) streamStats {
+	snap := *s
+	snap.Bitrates = append([]float64(nil), s.Bitrates...)
+	if !s.runStart.IsZero() {
+		snap.Uptime += now.Sub(s.runStart)
+	}
+	snap.BytesOut += s.Progress.TotalSize
+	return snap
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestProgressWriter 测试 ffmpeg 进度输出解析
+func TestProgressWriter(t *testing.T) {
+	var got []ffmpegProgress
+	w := &progressWriter{onProgress: func(p ffmpegProgress) { got = append(got, p) }}
+
+	chunks := []string{
+		"frame=250\nfps=25.00\nbitrate=2500.5kbits/s\ntotal_size=31",
+		"25000\nout_time_us=10000000\nspeed=1.01x\nprogress=continue\n",
+		"frame=N/A\nprogress=end\n",
+	}
+	for _, c := range chunks {
+		if _, err := w.Write([]byte(c)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 progress blocks, got %d", len(got))
+	}
+	p := got[0]
+	if p.Frame != 250 || p.FPS != 25 || p.Bitrate != 2500.5 || p.TotalSize != 3125000 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+	if p.OutTime != 10*time.Second || p.Speed != 1.01 {
+		t.Errorf("unexpected progress timing: %+v", p)
+	}
+}
+
+// TestStreamStats 测试运行统计累计
+func TestStreamStats(t *testing.T) {
+	var s streamStats
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	s.recordStart(start)
+	s.Progress.TotalSize = 1000
+	s.recordExit(start.Add(time.Minute), true)
+	s.recordStart(start.Add(2 * time.Minute))
+	s.Progress.TotalSize = 500
+
+	snap := s.snapshot(start.Add(3 * time.Minute))
+	if snap.Starts != 2 || snap.Restarts != 1 || snap.Failures != 1 {
+		t.Errorf("unexpected counters: %+v", snap)
+	}
+	if snap.Uptime != 2*time.Minute {
+		t.Errorf("expected 2m uptime, got %s", snap.Uptime)
+	}
+	if snap.BytesOut != 1500 {
+		t.Errorf("expected 1500 bytes out, got %d", snap.BytesOut)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 流的运行状态。
+const (
+	// StreamStateRunning 表示 ffmpeg 正在运行。
+	StreamStateRunning = "running"
+	// StreamStateBackoff 表示正在等待重试。
+	StreamStateBackoff = "backoff"
+	// StreamStateStarting 表示正在准备启动（就绪检查、探测、等待启动名额等）。
+	StreamStateStarting = "starting"
+	// StreamStateOffSchedule 表示流受节目表控制，正在等待下一档节目开始。
+	StreamStateOffSchedule = "off_schedule"
+	// StreamStateStopped 表示流已通过管理接口停止，重新启动或配置变更前不会运行。
+	StreamStateStopped = "stopped"
+	// StreamStatePaused 表示流已通过管理接口暂停，重载后仍保持暂停，恢复前不会运行。
+	StreamStatePaused = "paused"
+)
+
+const (
+	// defaultStatusLimit 是 /status 未指定 limit 时每页返回的流数。
+	defaultStatusLimit = 100
+	// maxStatusLimit 是 /status 每页最多返回的流数。
+	maxStatusLimit = 1000
+	// statusLogLines 是单路流状态中包含的最近 ffmpeg 输出行数。
+	statusLogLines = 10
+)
+
+// statusSortKeys 是 /status 支持的排序字段，值为比较函数（升序）。
+var statusSortKeys = map[string]func(a, b streamStatus) bool{
+	"id":       func(a, b streamStatus) bool { return a.ID < b.ID },
+	"state":    func(a, b streamStatus) bool { return a.State < b.State },
+	"restarts": func(a, b streamStatus) bool { return a.Restarts < b.Restarts },
+	"failures": func(a, b streamStatus) bool { return a.Failures < b.Failures },
+	"uptime":   func(a, b streamStatus) bool { return a.UptimeSeconds < b.UptimeSeconds },
+	"viewers":  func(a, b streamStatus) bool { return a.viewers() < b.viewers() },
+	"health":   func(a, b streamStatus) bool { return a.Health < b.Health },
+	"last_error": func(a, b streamStatus) bool {
+		return a.LastError == nil || (b.LastError != nil && a.LastError.Time.Before(b.LastError.Time))
+	},
+}
+
+// streamStatus 是 /status 中一路流的状态。
+type streamStatus struct {
+	ID            string            `json:"id"`
+	State         string            `json:"state"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Region        string            `json:"region,omitempty"`
+	DstHost       string            `json:"dst_host,omitempty"`
+	Restarts      int64             `json:"restarts"`
+	Failures      int64             `json:"failures"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	// PID 是当前 ffmpeg 进程的 pid，未运行时为空。
+	PID int `json:"pid,omitempty"`
+	// StartedAt 是当前 ffmpeg 进程的启动时间，未运行时为空。
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Health 是健康分，0~100，越高越健康。
+	Health float64 `json:"health"`
+	// Degraded 是当前偏离自身基线的指标（bitrate、fps），只有开启了 anomaly 才有。
+	Degraded  []string           `json:"degraded,omitempty"`
+	LastError *streamErrorStatus `json:"last_error,omitempty"`
+	// ExpiresAt 是临时流的到期时间，配置中的流没有该字段。
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Platform 是最近一次查询到的平台侧直播状态，只有配置了 platform 的流才有。
+	Platform *platformStatus `json:"platform,omitempty"`
+	// Outputs 是各路输出的状态，只有配置了附加输出的流才有，第一项是 dst。
+	Outputs []outputStatus `json:"outputs,omitempty"`
+	// Logs 是最近的 ffmpeg 输出，只在查询单路流（/status/{id}）时返回。
+	Logs []string `json:"logs,omitempty"`
+}
+
+// streamErrorStatus 是流最近一次出错的记录，描述中的地址只保留主机部分。
+type streamErrorStatus struct {
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// viewers 返回平台报告的同时在线观众数，未知时返回 -1，排序时排在观众数为 0 的流之前。
+func (s streamStatus) viewers() int64 {
+	if s.Platform == nil || s.Platform.Viewers == nil {
+		return -1
+	}
+	return *s.Platform.Viewers
+}
+
+// statusPage 是 /status 的响应。
+type statusPage struct {
+	// Total 是符合筛选条件的流总数（分页前）。
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Streams []streamStatus `json:"streams"`
+}
+
+// statusQuery 是 /status 的筛选、排序和分页条件。
+type statusQuery struct {
+	// states 是允许的运行状态，为空时不筛选。
+	states []string
+	// labels 是必须全部匹配的标签。
+	labels map[string]string
+	// search 是流 ID 中需要包含的子串（不区分大小写）。
+	search string
+	// errors 是允许的最近错误类别，为空时不筛选。
+	errors  []string
+	sortKey string
+	desc    bool
+	offset  int
+	limit   int
+}
+
+// splitList 拆分逗号分隔的查询参数，可以重复出现。
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// parseStatusQuery 解析 /status 的查询参数。
+func parseStatusQuery(r *http.Request) (statusQuery, error) {
+	q := r.URL.Query()
+	sq := statusQuery{
+		states:  splitList(q["state"]),
+		search:  strings.ToLower(q.Get("q")),
+		errors:  splitList(q["error"]),
+		sortKey: "id",
+		limit:   defaultStatusLimit,
+	}
+	for _, s := range sq.states {
+		if s != StreamStateRunning && s != StreamStateBackoff && s != StreamStateStarting {
+			return sq, fmt.Errorf("invalid state %q", s)
+		}
+	}
+	for _, e := range sq.errors {
+		if e != "none" && !containsString(errorCategories, e) {
+			return sq, fmt.Errorf("invalid error category %q", e)
+		}
+	}
+	for _, l := range q["label"] {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return sq, fmt.Errorf("invalid label filter %q, expected key=value", l)
+		}
+		if sq.labels == nil {
+			sq.labels = make(map[string]string)
+		}
+		sq.labels[k] = v
+	}
+	if v := q.Get("sort"); v != "" {
+		sq.desc = strings.HasPrefix(v, "-")
+		sq.sortKey = strings.TrimPrefix(v, "-")
+		if _, ok := statusSortKeys[sq.sortKey]; !ok {
+			return sq, fmt.Errorf("invalid sort key %q", sq.sortKey)
+		}
+	}
+	for name, dst := range map[string]*int{"offset": &sq.offset, "limit": &sq.limit} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return sq, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	if sq.limit == 0 || sq.limit > maxStatusLimit {
+		sq.limit = maxStatusLimit
+	}
+	return sq, nil
+}
+
+// matches 判断流是否符合筛选条件。
+func (q statusQuery) matches(s streamStatus) bool {
+	if len(q.states) > 0 && !containsString(q.states, s.State) {
+		return false
+	}
+	if q.search != "" && !strings.Contains(strings.ToLower(s.ID), q.search) {
+		return false
+	}
+	for k, v := range q.labels {
+		if got, ok := s.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	if len(q.errors) > 0 {
+		category := "none"
+		if s.LastError != nil {
+			category = s.LastError.Category
+		}
+		if !containsString(q.errors, category) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply 筛选、排序并分页。
+func (q statusQuery) apply(all []streamStatus) statusPage {
+	var matched []streamStatus
+	for _, s := range all {
+		if q.matches(s) {
+			matched = append(matched, s)
+		}
+	}
+	less := statusSortKeys[q.sortKey]
+	sort.SliceStable(matched, func(i, j int) bool {
+		if q.desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+	page := statusPage{Total: len(matched), Offset: q.offset, Limit: q.limit, Streams: []streamStatus{}}
+	if q.offset < len(matched) {
+		end := min(q.offset+q.limit, len(matched))
+		page.Streams = matched[q.offset:end]
+	}
+	return page
+}
+
+// urlPattern 匹配文本中的地址。
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// redactURLs 把文本中的地址改写为只含协议、主机和端口的形式。推流密钥和口令可能出现在路径、
+// 查询参数（如 SRT 的 streamid、passphrase）和用户信息中，去掉了其中任何部分时以 "/..." 标明。
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, redactURL)
+}
+
+// redactURL 改写单个地址，见 redactURLs。无法解析的地址只保留协议。
+func redactURL(raw string) string {
+	// Punctuation that follows an address in ffmpeg output is not part of it.
+	trimmed := strings.TrimRight(raw, ".,;:)]")
+	suffix := raw[len(trimmed):]
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Host == "" {
+		scheme, _, _ := strings.Cut(trimmed, "://")
+		return scheme + "://..." + suffix
+	}
+	out := u.Scheme + "://" + u.Host
+	if out != trimmed {
+		out += "/..."
+	}
+	return out + suffix
+}
+
+// Status 返回流当前的运行状态：状态、pid、启动时间、重启次数、最近错误和最近的 ffmpeg 输出。错误和输出中的地址只保留协议、主机和端口（见 redactURLs）。
+// 临时流的到期时间和平台侧状态不属于工作器，由 collectStatus 补充。
+func (w *StreamWorker) Status(now time.Time) streamStatus {
+	cfg := w.config()
+	stats := w.Stats(now)
+	dst := w.Endpoint()
+	if dst == "" {
+		dst = cfg.Dst
+	}
+	s := streamStatus{
+		ID:            cfg.ID,
+		State:         w.state(),
+		Labels:        cfg.Labels,
+		Region:        cfg.Region,
+		DstHost:       endpointHost(dst),
+		Restarts:      stats.Restarts,
+		Failures:      stats.Failures,
+		UptimeSeconds: stats.Uptime.Seconds(),
+		PID:           w.pid(),
+		Health:        w.healthScore(now),
+		Degraded:      w.degradedMetrics(),
+		Outputs:       w.outputStatuses(cfg, dst),
+		Logs:          w.stderrTail().last(statusLogLines),
+	}
+	// ffmpeg prints the full input and output addresses, push keys included.
+	for i, line := range s.Logs {
+		s.Logs[i] = redactURLs(line)
+	}
+	if t := w.runningSince(); !t.IsZero() {
+		s.StartedAt = &t
+	}
+	if e := stats.LastError; e.Category != "" {
+		s.LastError = &streamErrorStatus{Category: e.Category, Message: redactURLs(e.Message), Time: e.Time}
+	}
+	return s
+}
+
+// collectStatus 返回所有流的状态，按流 ID 排序。列表中不含 ffmpeg 输出，避免响应过大。
+func collectStatus(state *AppState) []streamStatus {
+	now := time.Now()
+	// Only temporary streams need state.mu; workers are read from a lock-free snapshot.
+	state.mu.RLock()
+	expiries := make(map[string]*time.Time, len(state.temporary))
+	for id := range state.temporary {
+		expiries[id] = temporaryExpiry(state, id)
+	}
+	state.mu.RUnlock()
+	workers := state.workers.snapshot()
+	out := make([]streamStatus, 0, len(workers))
+	for id, w := range workers {
+		s := w.Status(now)
+		s.ID = id
+		s.Logs = nil
+		s.ExpiresAt = expiries[id]
+		if m := platforms.Load(); m != nil && w.config().Platform != nil {
+			s.Platform = m.status(id)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// handleStatus 处理 GET /status：按状态、标签、ID 子串和最近错误类别筛选，支持排序和分页。
+func handleStatus(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseStatusQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(q.apply(collectStatus(state))); err != nil {
+			slog.Warn("failed to write status", "error", err)
+		}
+	}
+}
+
+// handleStreamStatus 处理 GET /status/{id}：返回单路流的状态，包括最近的 ffmpeg 输出。
+func handleStreamStatus(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/status/")
+		worker, ok := state.workers.get(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("stream %s not found", id), http.StatusNotFound)
+			return
+		}
+		s := worker.Status(time.Now())
+		s.ID = id
+		state.mu.RLock()
+		s.ExpiresAt = temporaryExpiry(state, id)
+		state.mu.RUnlock()
+		if m := platforms.Load(); m != nil && worker.config().Platform != nil {
+			s.Platform = m.status(id)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s); err != nil {
+			slog.Warn("failed to write status", "error", err)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 流管理接口的错误，由 handleStreams 映射为状态码。
+var (
+	// errPreconditionFailed 表示 If-Match 或 If-None-Match 条件不满足。
+	errPreconditionFailed = errors.New("precondition failed")
+	// errTemporaryStream 表示流是临时流，需要通过 /temporary-streams 管理。
+	errTemporaryStream = errors.New("temporary streams are managed via /temporary-streams")
+)
+
+// streamValidationError 表示请求中的流配置未通过校验。
+type streamValidationError struct{ err error }
+
+func (e streamValidationError) Error() string { return e.err.Error() }
+
+// streamResource 返回流在管理接口中的表示：与 streams.yml 中的字段一一对应，不含运行时统计。
+func streamResource(s StreamConfig) (map[string]any, error) {
+	m, err := canonicalStream(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.RenamedFrom) > 0 {
+		m["renamed_from"] = s.RenamedFrom
+	}
+	return m, nil
+}
+
+// streamETag 返回流配置的 ETag。基于规范化配置计算，只随语义变化而变化。
+func streamETag(s StreamConfig) string {
+	m, err := canonicalStream(s)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches 判断 If-Match / If-None-Match 的取值是否匹配 etag，etag 为空表示流不存在。
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if (v == "*" && etag != "") || (v != "" && v == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions 按 If-Match 和 If-None-Match 检查写操作的前提条件，etag 为空表示流不存在。
+func checkPreconditions(r *http.Request, etag string) error {
+	if h := r.Header.Get("If-Match"); h != "" && !etagMatches(h, etag) {
+		return errPreconditionFailed
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" && etagMatches(h, etag) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// configuredStream 返回配置中的流。调用方需持有 state.mu。
+func configuredStream(state *AppState, id string) (StreamConfig, bool) {
+	if state.config == nil {
+		return StreamConfig{}, false
+	}
+	for _, s := range state.config.Streams {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return StreamConfig{}, false
+}
+
+// putStream 创建或整体替换一路流，返回是否实际修改了配置。语义未变化时不做任何修改，ffmpeg 不会重启。
+func putStream(state *AppState, s StreamConfig, r *http.Request) (bool, error) {
+	importMu.Lock()
+	defer importMu.Unlock()
+
+	state.mu.RLock()
+	current, exists := configuredStream(state, s.ID)
+	_, temporary := state.temporary[s.ID]
+	cfg := state.config
+	state.mu.RUnlock()
+	if temporary {
+		return false, errTemporaryStream
+	}
+	etag := ""
+	if exists {
+		etag = streamETag(current)
+	}
+	if err := checkPreconditions(r, etag); err != nil {
+		return false, err
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	// Fill in defaults the same way loading the config file does before comparing.
+	next := *cfg
+	next.Streams = []StreamConfig{s}
+	next.applyDefaults()
+	filled := next.Streams[0]
+	if exists && len(streamConfigDiff(current, filled)) == 0 && equalStrings(current.RenamedFrom, filled.RenamedFrom) {
+		return false, nil
+	}
+
+	next.Streams = make([]StreamConfig, 0, len(cfg.Streams)+1)
+	for _, cur := range cfg.Streams {
+		if cur.ID != s.ID {
+			next.Streams = append(next.Streams, cur)
+		}
+	}
+	next.Streams = append(next.Streams, filled)
+	if err := validateConfig(&next); err != nil {
+		return false, streamValidationError{err}
+	}
+	if exists {
+		slog.Info("stream replaced via api", "stream_id", s.ID, "changed", streamConfigDiff(current, filled))
+		auditChange(r, s.ID, auditStream(current), auditStream(filled))
+	} else {
+		slog.Info("stream added via api", "stream_id", s.ID)
+		auditChange(r, s.ID, nil, auditStream(filled))
+	}
+	return true, commitStreams(state, &next, func(streams *yaml.Node) error {
+		return setStreamNode(streams, s)
+	})
+}
+
+// deleteStream 删除一路流，返回是否实际修改了配置。流不存在时不是错误，重复删除没有副作用。
+func deleteStream(state *AppState, id string, r *http.Request) (bool, error) {
+	importMu.Lock()
+	defer importMu.Unlock()
+
+	state.mu.RLock()
+	current, exists := configuredStream(state, id)
+	_, temporary := state.temporary[id]
+	cfg := state.config
+	state.mu.RUnlock()
+	if temporary {
+		return false, errTemporaryStream
+	}
+	etag := ""
+	if exists {
+		etag = streamETag(current)
+	}
+	if err := checkPreconditions(r, etag); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+
+	next := *cfg
+	next.Streams = make([]StreamConfig, 0, len(cfg.Streams))
+	for _, cur := range cfg.Streams {
+		if cur.ID != id {
+			next.Streams = append(next.Streams, cur)
+		}
+	}
+	slog.Info("stream deleted via api", "stream_id", id)
+	auditChange(r, id, auditStream(current), nil)
+	return true, commitStreams(state, &next, func(streams *yaml.Node) error {
+		removeStreamNode(streams, id)
+		return nil
+	})
+}
+
+// commitStreams 应用修改后的配置。开启 api.persist_streams 时先把修改写回配置文件再重载，
+// 否则只修改内存中的配置，下次重载或重启后丢失。新配置生效后只是部分工作器失败时返回 configAppliedError。
+func commitStreams(state *AppState, next *Config, edit func(streams *yaml.Node) error) error {
+	if c := apiConfig(state); c == nil || !c.PersistStreams {
+		// applyConfig only fails in the workers, after next is already in effect.
+		if err := applyConfig(state, next); err != nil {
+			return &configAppliedError{err}
+		}
+		return nil
+	}
+	currentFile, err := os.ReadFile(paths.Config)
+	if err != nil {
+		return err
+	}
+	doc, err := editConfigStreams(currentFile, edit)
+	if err != nil {
+		return err
+	}
+	return installConfig(state, doc, currentFile)
+}
+
+// editConfigStreams 在配置文件的 streams 列表上执行 edit 并返回新的文件内容，其余部分（含注释）保持不变。
+func editConfigStreams(data []byte, edit func(streams *yaml.Node) error) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file is not a mapping")
+	}
+	var streams *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "streams" {
+			streams = root.Content[i+1]
+		}
+	}
+	if streams == nil {
+		streams = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "streams"}, streams)
+	}
+	if streams.Kind == yaml.ScalarNode && streams.Tag == "!!null" {
+		*streams = yaml.Node{Kind: yaml.SequenceNode}
+	}
+	if streams.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("streams is not a list")
+	}
+	if err := edit(streams); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(&doc)
+}
+
+// streamNodeIndex 返回 streams 列表中指定 ID 的流的位置，不存在时返回 -1。
+func streamNodeIndex(streams *yaml.Node, id string) int {
+	for i, n := range streams.Content {
+		// Decoding resolves aliases and merge keys, so the id may come from a shared block.
+		var s struct {
+			ID string `yaml:"id"`
+		}
+		if err := n.Decode(&s); err == nil && s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// setStreamNode 在 streams 列表中替换或追加一路流。
+func setStreamNode(streams *yaml.Node, s StreamConfig) error {
+	var n yaml.Node
+	if err := n.Encode(s); err != nil {
+		return err
+	}
+	if i := streamNodeIndex(streams, s.ID); i >= 0 {
+		n.HeadComment = streams.Content[i].HeadComment
+		streams.Content[i] = &n
+		return nil
+	}
+	streams.Content = append(streams.Content, &n)
+	return nil
+}
+
+// removeStreamNode 从 streams 列表中删除一路流。
+func removeStreamNode(streams *yaml.Node, id string) {
+	if i := streamNodeIndex(streams, id); i >= 0 {
+		streams.Content = append(streams.Content[:i], streams.Content[i+1:]...)
+	}
+}
+
+// equalStrings 判断两个字符串列表是否相同。
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// streamWriteResponse 是 PUT 和 POST /streams 的响应，以及配置已生效但工作器失败时 DELETE /streams/{id} 的响应。
+type streamWriteResponse struct {
+	// Changed 表示本次请求是否实际修改了配置。
+	Changed bool           `json:"changed"`
+	Stream  map[string]any `json:"stream,omitempty"`
+	// Error 是修改已生效、但 ffmpeg 停止或重启失败时的错误，客户端不应重试或回滚修改。
+	Error string `json:"error,omitempty"`
+}
+
+// writeStreamResource 写出一路流及其 ETag。applyErr 是修改生效后工作器的错误，没有时为 nil。
+func writeStreamResource(w http.ResponseWriter, code int, s StreamConfig, changed *bool, applyErr error) {
+	res, err := streamResource(s)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("ETag", streamETag(s))
+	if changed == nil {
+		writeAPIJSON(w, code, res)
+		return
+	}
+	out := streamWriteResponse{Changed: *changed, Stream: res}
+	if applyErr != nil {
+		out.Error = applyErr.Error()
+	}
+	writeAPIJSON(w, code, out)
+}
+
+// writeStreamError 把流管理接口的错误映射为状态码。
+func writeStreamError(w http.ResponseWriter, err error) {
+	var invalid streamValidationError
+	switch {
+	case errors.Is(err, errPreconditionFailed):
+		writeAPIError(w, http.StatusPreconditionFailed, "stream was modified, fetch it again")
+	case errors.Is(err, errTemporaryStream), errors.Is(err, errStreamExists):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &invalid):
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		slog.Error("stream api write failed", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// decodeStreamBody 解析请求正文中的流配置，JSON 和 YAML 均可，字段名与 streams.yml 相同。
+func decodeStreamBody(r *http.Request) (StreamConfig, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return StreamConfig{}, err
+	}
+	var s StreamConfig
+	if err := yaml.Unmarshal(body, &s); err != nil {
+		return StreamConfig{}, annotateYAMLError(body, err)
+	}
+	return s, nil
+}
+
+// handleStreams 处理 /streams：GET 列出和读取、POST 新增、PUT /streams/{id} 创建或替换、DELETE /streams/{id} 删除。
+// 只管理配置中的流，临时流通过 /temporary-streams 管理。
+func handleStreams(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/streams"), "/")
+		if sid, action, ok := strings.Cut(id, "/"); ok {
+			handleStreamAction(state, w, r, sid, action)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			state.mu.RLock()
+			var streams []StreamConfig
+			if state.config != nil {
+				streams = append(streams, state.config.Streams...)
+			}
+			state.mu.RUnlock()
+			sort.Slice(streams, func(i, j int) bool { return streams[i].ID < streams[j].ID })
+			list := make([]map[string]any, 0, len(streams))
+			for _, s := range streams {
+				res, err := streamResource(s)
+				if err != nil {
+					writeAPIError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+				list = append(list, res)
+			}
+			writeAPIJSON(w, http.StatusOK, list)
+		case r.Method == http.MethodGet:
+			state.mu.RLock()
+			s, ok := configuredStream(state, id)
+			state.mu.RUnlock()
+			if !ok {
+				writeAPIError(w, http.StatusNotFound, fmt.Sprintf("stream %s not found", id))
+				return
+			}
+			if etagMatches(r.Header.Get("If-None-Match"), streamETag(s)) {
+				w.Header().Set("ETag", streamETag(s))
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			writeStreamResource(w, http.StatusOK, s, nil, nil)
+		case r.Method == http.MethodPost && id == "", r.Method == http.MethodPut && id != "":
+			s, err := decodeStreamBody(r)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if r.Method == http.MethodPost {
+				// Creating only: the same as PUT with If-None-Match: *.
+				r.Header.Set("If-None-Match", "*")
+				id = s.ID
+			}
+			switch {
+			case s.ID == "" && id == "":
+				writeAPIError(w, http.StatusUnprocessableEntity, "id is required")
+				return
+			case s.ID == "":
+				s.ID = id
+			case s.ID != id:
+				writeAPIError(w, http.StatusUnprocessableEntity, fmt.Sprintf("id %q does not match the path", s.ID))
+				return
+			}
+			changed, err := putStream(state, s, r)
+			if errors.Is(err, errPreconditionFailed) && r.Method == http.MethodPost {
+				err = errStreamExists
+			}
+			if err != nil && !configApplied(err) {
+				writeStreamError(w, err)
+				return
+			}
+			if err != nil {
+				slog.Error("stream changed via api, but some workers failed", "stream_id", s.ID, "error", err)
+			}
+			state.mu.RLock()
+			saved, _ := configuredStream(state, s.ID)
+			state.mu.RUnlock()
+			code := http.StatusOK
+			if r.Method == http.MethodPost {
+				code = http.StatusCreated
+			}
+			writeStreamResource(w, code, saved, &changed, err)
+		case r.Method == http.MethodDelete && id != "":
+			_, err := deleteStream(state, id, r)
+			if configApplied(err) {
+				slog.Error("stream deleted via api, but stopping it failed", "stream_id", id, "error", err)
+				writeAPIJSON(w, http.StatusOK, streamWriteResponse{Changed: true, Error: err.Error()})
+				return
+			}
+			if err != nil {
+				writeStreamError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
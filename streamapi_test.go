@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestEditConfigStreams 测试写回配置文件时只替换、追加或删除目标流，保留注释和共享块
+func TestEditConfigStreams(t *testing.T) {
+	file := []byte(`# main config
+defaults: &defaults
+  probe: true
+streams:
+  # news channel
+  - <<: *defaults
+    id: news
+    src: rtmp://a.example.com/live/news
+    dst: rtmp://b.example.com/live/news
+  - id: sports
+    src: rtmp://a.example.com/live/sports
+    dst: rtmp://b.example.com/live/sports
+`)
+	out, err := editConfigStreams(file, func(streams *yaml.Node) error {
+		if err := setStreamNode(streams, StreamConfig{ID: "news", Src: "rtmp://a.example.com/live/news2", Dst: "rtmp://b.example.com/live/news"}); err != nil {
+			return err
+		}
+		if err := setStreamNode(streams, StreamConfig{ID: "music", Src: "rtmp://a.example.com/live/music", Dst: "rtmp://b.example.com/live/music"}); err != nil {
+			return err
+		}
+		removeStreamNode(streams, "sports")
+		removeStreamNode(streams, "missing")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if len(cfg.Streams) != 2 || cfg.Streams[0].ID != "news" || cfg.Streams[0].Src != "rtmp://a.example.com/live/news2" || cfg.Streams[1].ID != "music" {
+		t.Errorf("streams = %+v", cfg.Streams)
+	}
+	for _, keep := range []string{"# main config", "# news channel", "defaults: &defaults"} {
+		if !strings.Contains(string(out), keep) {
+			t.Errorf("%q lost:\n%s", keep, out)
+		}
+	}
+
+	out, err = editConfigStreams(nil, func(streams *yaml.Node) error {
+		return setStreamNode(streams, StreamConfig{ID: "first"})
+	})
+	if err != nil || !strings.Contains(string(out), "id: first") {
+		t.Errorf("empty file: %v\n%s", err, out)
+	}
+}
+
+// TestStreamsAPI 测试 ETag、重复 PUT 不修改配置、过期 If-Match 返回 412 和重复删除
+func TestStreamsAPI(t *testing.T) {
+	news := StreamConfig{ID: "news", Src: "rtmp://a.example.com/live/news", Dst: "rtmp://b.example.com/live/news"}
+	state := &AppState{
+		config:    &Config{Streams: []StreamConfig{news}},
+		workers:   newWorkerMap(map[string]*StreamWorker{"news": {cfg: news}, "event": {}}),
+		temporary: map[string]temporaryStream{"event": {cfg: StreamConfig{ID: "event"}}},
+	}
+	h := handleStreams(state)
+	do := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/streams/news", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET: %d %q", rec.Code, etag)
+	}
+	if rec := do(http.MethodGet, "/streams/news", "", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET If-None-Match: %d", rec.Code)
+	}
+
+	// The same config in another field order is not a change.
+	body := `{"dst": "rtmp://b.example.com/live/news", "src": "rtmp://a.example.com/live/news"}`
+	rec = do(http.MethodPut, "/streams/news", body, "If-Match", etag)
+	var res streamWriteResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK || res.Changed {
+		t.Errorf("PUT same config: %d %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed from %s to %s", etag, rec.Header().Get("ETag"))
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		headers            []string
+		code               int
+	}{
+		{http.MethodPut, "/streams/news", `{"src": "rtmp://a.example.com/live/other", "dst": "rtmp://b.example.com/live/news"}`, []string{"If-Match", `"stale"`}, http.StatusPreconditionFailed},
+		{http.MethodPut, "/streams/news", body, []string{"If-None-Match", "*"}, http.StatusPreconditionFailed},
+		{http.MethodPost, "/streams", `{"id": "news"}`, nil, http.StatusConflict},
+		{http.MethodPut, "/streams/news", `{"id": "other"}`, nil, http.StatusUnprocessableEntity},
+		{http.MethodPut, "/streams/event", body, nil, http.StatusConflict},
+		{http.MethodDelete, "/streams/news", "", []string{"If-Match", `"stale"`}, http.StatusPreconditionFailed},
+		{http.MethodDelete, "/streams/missing", "", nil, http.StatusNoContent},
+		{http.MethodDelete, "/streams/event", "", nil, http.StatusConflict},
+		{http.MethodGet, "/streams/missing", "", nil, http.StatusNotFound},
+	} {
+		if rec := do(c.method, c.path, c.body, c.headers...); rec.Code != c.code {
+			t.Errorf("%s %s: got %d, want %d: %s", c.method, c.path, rec.Code, c.code, rec.Body)
+		}
+	}
+	if got := state.config.Streams; len(got) != 1 || got[0].Src != news.Src {
+		t.Errorf("config changed: %+v", got)
+	}
+}
+
+// TestStreamsAPIRefreshesSnapshot 测试通过管理接口修改流后 export-config 导出的是修改后的配置
+func TestStreamsAPIRefreshesSnapshot(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Load()
+	defer runtimeSettings.Store(prev)
+
+	settings := &Settings{StopTimeout: time.Second}
+	state := &AppState{workers: newWorkerMap(nil)}
+	if err := applyConfig(state, &Config{Settings: settings}); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"src": "rtmp://127.0.0.1/live/music", "dst": "rtmp://127.0.0.2/live/music"}`
+	rec := httptest.NewRecorder()
+	handleStreams(state).ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/streams/music", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	w, _ := state.workers.get("music")
+	defer w.shutdown()
+	waitFor(t, "ffmpeg to start", func() bool { return running() == 1 })
+
+	out := filepath.Join(t.TempDir(), "exported.yml")
+	if code := runExportConfig([]string{"--output", out}); code != 0 {
+		t.Fatalf("export-config exited with %d", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Streams) != 1 || cfg.Streams[0].ID != "music" || cfg.Streams[0].Dst != "rtmp://127.0.0.2/live/music" {
+		t.Errorf("exported streams = %+v", cfg.Streams)
+	}
+}
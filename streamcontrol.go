@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// 流控制操作。
+const (
+	// StreamActionRestart 终止当前的 ffmpeg 并立即重新启动；已停止的流直接启动。
+	StreamActionRestart = "restart"
+	// StreamActionStop 停止流，直到 start、restart 或配置变更。
+	StreamActionStop = "stop"
+	// StreamActionStart 启动已停止或已暂停的流。
+	StreamActionStart = "start"
+	// StreamActionPause 暂停流：与 stop 相同，但重载修改了流的配置时也保持暂停。
+	StreamActionPause = "pause"
+	// StreamActionResume 恢复已暂停或已停止的流，与 start 相同。
+	StreamActionResume = "resume"
+	// streamActionTail 返回最近的 ffmpeg 输出。
+	streamActionTail = "tail"
+	// defaultTailLines 是 tail 未指定 lines 时返回的行数。
+	defaultTailLines = 100
+)
+
+// streamControlResponse 是流控制操作的响应。
+type streamControlResponse struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+}
+
+// streamTailResponse 是 GET /streams/{id}/tail 的响应。
+type streamTailResponse struct {
+	ID    string   `json:"id"`
+	Lines []string `json:"lines"`
+}
+
+// handleStreamAction 处理 POST /streams/{id}/restart、stop、start、pause、resume 和 GET /streams/{id}/tail，
+// 配置中的流和临时流都可以操作。停止和暂停只在内存中生效，不写回配置文件。
+func handleStreamAction(state *AppState, w http.ResponseWriter, r *http.Request, id, action string) {
+	worker, ok := state.workers.get(id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("stream %s not found", id))
+		return
+	}
+	if action == streamActionTail {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		n := defaultTailLines
+		if v := r.URL.Query().Get("lines"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 1 || n > streamTailSize {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("lines must be between 1 and %d", streamTailSize))
+				return
+			}
+		}
+		writeAPIJSON(w, http.StatusOK, streamTailResponse{ID: id, Lines: worker.stderrTail().last(n)})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var err error
+	switch action {
+	case StreamActionRestart:
+		slog.Info("restarting stream via api", "stream_id", id)
+		if worker.isStopped() {
+			err = worker.resume()
+		} else {
+			err = worker.stop()
+		}
+	case StreamActionStop:
+		slog.Info("stopping stream via api", "stream_id", id)
+		if err = worker.Stop(); err == nil {
+			<-worker.Done()
+		}
+	case StreamActionStart, StreamActionResume:
+		if worker.isStopped() {
+			slog.Info("starting stream via api", "stream_id", id, "action", action)
+			err = worker.resume()
+		}
+	case StreamActionPause:
+		slog.Info("pausing stream via api", "stream_id", id)
+		err = worker.pause()
+	default:
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("unknown action %q, expected restart, stop, start, pause, resume or tail", action))
+		return
+	}
+	switch {
+	case errors.Is(err, errStreamStopping):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeAPIJSON(w, http.StatusOK, streamControlResponse{ID: id, State: worker.state()})
+	}
+}
+
+// errStreamStopping 表示流已停止但 ffmpeg 尚未退出，暂时不能重新启动。
+var errStreamStopping = errors.New("stream is still stopping, ffmpeg has not exited yet")
+
+// pause 暂停工作器：停止 ffmpeg 和重启循环并等待主循环退出。暂停的工作器在重载时只更新配置，不重新启动。
+func (w *StreamWorker) pause() error {
+	w.mu.Lock()
+	w.paused = true
+	w.mu.Unlock()
+	if err := w.Stop(); err != nil {
+		return err
+	}
+	<-w.Done()
+	return nil
+}
+
+// resume 以原来的 ctx 重新启动已停止或已暂停的工作器，主循环尚未退出时返回 errStreamStopping。
+func (w *StreamWorker) resume() error {
+	select {
+	case <-w.Done():
+	default:
+		return errStreamStopping
+	}
+	w.mu.Lock()
+	w.paused = false
+	parent := w.parent
+	w.mu.Unlock()
+	if parent == nil {
+		parent = context.Background()
+	}
+	w.Start(parent)
+	return nil
+}
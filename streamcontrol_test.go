@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStreamActions 测试通过管理接口停止、启动和重启流，以及读取最近的 ffmpeg 输出
+func TestStreamActions(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Swap(&Settings{StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+
+	w := &StreamWorker{cfg: StreamConfig{ID: "a", Src: "rtmp://127.0.0.1/live/a", Dst: "rtmp://127.0.0.2/live/a"}}
+	w.stderrTail().add("frame=1")
+	w.stderrTail().add("frame=2")
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"a": w})}
+	h := handleStreams(state)
+	do := func(method, path string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		var body map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	if code, body := do(http.MethodGet, "/streams/a/tail?lines=1"); code != http.StatusOK || len(body["lines"].([]any)) != 1 {
+		t.Errorf("tail: %d %v", code, body)
+	}
+	defer w.shutdown()
+	if code, body := do(http.MethodPost, "/streams/a/start"); code != http.StatusOK {
+		t.Fatalf("start of a never started stream: %d %v", code, body)
+	}
+	w.Start(context.Background())
+	waitFor(t, "ffmpeg to start", func() bool { return w.IsRunning() && running() == 1 })
+
+	if code, body := do(http.MethodPost, "/streams/a/stop"); code != http.StatusOK || body["state"] != StreamStateStopped {
+		t.Fatalf("stop: %d %v", code, body)
+	}
+	if running() != 0 {
+		t.Error("ffmpeg still running after stop")
+	}
+	if code, body := do(http.MethodPost, "/streams/a/start"); code != http.StatusOK || body["state"] == StreamStateStopped {
+		t.Fatalf("start: %d %v", code, body)
+	}
+	waitFor(t, "ffmpeg to start again", func() bool { return w.IsRunning() && running() == 1 })
+	starts := w.Stats(time.Now()).Starts
+	if code, body := do(http.MethodPost, "/streams/a/restart"); code != http.StatusOK {
+		t.Fatalf("restart: %d %v", code, body)
+	}
+	waitFor(t, "ffmpeg to restart", func() bool { return w.Stats(time.Now()).Starts > starts && running() == 1 })
+
+	for _, c := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, "/streams/missing/stop", http.StatusNotFound},
+		{http.MethodPost, "/streams/a/suspend", http.StatusNotFound},
+		{http.MethodGet, "/streams/a/stop", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/streams/a/tail?lines=0", http.StatusBadRequest},
+	} {
+		if code, body := do(c.method, c.path); code != c.code {
+			t.Errorf("%s %s: %d %v, want %d", c.method, c.path, code, body, c.code)
+		}
+	}
+}
+
+// TestStreamPause 测试暂停流：ffmpeg 停止，重载修改配置后仍保持暂停，恢复后使用新配置运行
+func TestStreamPause(t *testing.T) {
+	running := fakeFFmpeg(t)
+	prev := runtimeSettings.Swap(&Settings{StopTimeout: time.Second})
+	defer runtimeSettings.Store(prev)
+
+	w := &StreamWorker{cfg: StreamConfig{ID: "a", Src: "rtmp://127.0.0.1/live/a", Dst: "rtmp://127.0.0.2/live/a"}}
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"a": w})}
+	h := handleStreams(state)
+	post := func(path string) map[string]any {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		var body map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: %d %v", path, rec.Code, body)
+		}
+		return body
+	}
+
+	defer w.shutdown()
+	w.Start(context.Background())
+	waitFor(t, "ffmpeg to start", func() bool { return w.IsRunning() && running() == 1 })
+	if body := post("/streams/a/pause"); body["state"] != StreamStatePaused || running() != 0 {
+		t.Fatalf("pause: %v, %d ffmpeg running", body, running())
+	}
+
+	// A reload that changes the stream keeps it paused.
+	changed := w.config()
+	changed.Dst = "rtmp://127.0.0.3/live/a"
+	if err := w.restart(changed); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if w.state() != StreamStatePaused || running() != 0 {
+		t.Fatalf("after reload: state %s, %d ffmpeg running", w.state(), running())
+	}
+
+	if body := post("/streams/a/resume"); body["state"] == StreamStatePaused {
+		t.Fatalf("resume: %v", body)
+	}
+	waitFor(t, "ffmpeg to resume", func() bool { return w.IsRunning() && running() == 1 })
+	if w.config().Dst != changed.Dst {
+		t.Errorf("resumed with dst %s, want %s", w.config().Dst, changed.Dst)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// superviseMinBackoff 是内部协程 panic 后第一次重启前的等待时间，之后每次翻倍。
+	superviseMinBackoff = time.Second
+	// superviseMaxBackoff 是内部协程重启前的最长等待时间。
+	superviseMaxBackoff = time.Minute
+	// superviseStableAfter 是内部协程持续运行多久后重置重启等待时间。
+	superviseStableAfter = 5 * time.Minute
+)
+
+// goroutinePanics 是按名称累计的内部协程和 HTTP 处理函数的 panic 次数。
+var goroutinePanics = struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// reportPanic 记录一次 panic：写入错误日志（含调用栈）、累计指标并发送 goroutine_panic 事件。
+func reportPanic(name string, r any, stack []byte) {
+	goroutinePanics.mu.Lock()
+	goroutinePanics.counts[name]++
+	goroutinePanics.mu.Unlock()
+	slog.Error("internal goroutine panicked", "goroutine", name, "panic", fmt.Sprint(r), "stack", string(stack))
+	emitEvent("", "goroutine_panic", name, fmt.Sprint(r))
+}
+
+// supervise 运行内部协程 run：panic 时记录并告警，等待一段时间后重新运行，避免看门狗、日志轮转等辅助协程
+// 因一次 panic 永久停止。run 正常返回时不再重启。调用方可以在 run 中重新创建协程的状态，丢弃 panic 前可能不一致的状态。
+func supervise(name string, run func()) {
+	backoff := superviseMinBackoff
+	for {
+		started := currentClock().Now()
+		if !runRecovered(name, run) {
+			return
+		}
+		if currentClock().Now().Sub(started) >= superviseStableAfter {
+			backoff = superviseMinBackoff
+		}
+		slog.Warn("restarting internal goroutine", "goroutine", name, "delay", backoff)
+		<-currentClock().After(backoff)
+		backoff = min(backoff*2, superviseMaxBackoff)
+	}
+}
+
+// runRecovered 运行 run，panic 时上报并返回 true。
+func runRecovered(name string, run func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(name, r, debug.Stack())
+			panicked = true
+		}
+	}()
+	run()
+	return false
+}
+
+// withPanicReport 上报 HTTP 处理函数中的 panic 并返回 500。net/http 自身只把 panic 写到标准错误，
+// 不会进入日志文件和告警。http.ErrAbortHandler 按 net/http 的约定原样抛出。
+func withPanicReport(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				reportPanic(name, v, debug.Stack())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeSupervisorMetrics 输出内部协程的 panic 次数。
+func writeSupervisorMetrics(bw *bufio.Writer) {
+	goroutinePanics.mu.Lock()
+	names := make([]string, 0, len(goroutinePanics.counts))
+	for name := range goroutinePanics.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := make([]int64, len(names))
+	for i, name := range names {
+		counts[i] = goroutinePanics.counts[name]
+	}
+	goroutinePanics.mu.Unlock()
+	fmt.Fprintln(bw, "# HELP stream_runner_goroutine_panics_total Panics recovered in internal goroutines and HTTP handlers.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_goroutine_panics_total counter")
+	for i, name := range names {
+		fmt.Fprintf(bw, "stream_runner_goroutine_panics_total{goroutine=\"%s\"} %d\n", escapeLabelValue(name), counts[i])
+	}
+}
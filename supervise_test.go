@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSupervise 测试内部协程 panic 后记录次数并按退避时间重启，正常返回后不再重启。
+func TestSupervise(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC))
+	defer setClock(clock)()
+
+	runs := make(chan int, 3)
+	n := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		supervise("test worker", func() {
+			n++
+			runs <- n
+			if n < 3 {
+				panic("boom")
+			}
+		})
+	}()
+
+	<-runs
+	waitFor(t, "restart backoff", func() bool { return clock.pending() == 1 })
+	clock.advance(superviseMinBackoff)
+	<-runs
+	// The second restart waits twice as long.
+	waitFor(t, "restart backoff", func() bool { return clock.pending() == 1 })
+	clock.advance(superviseMinBackoff)
+	select {
+	case <-runs:
+		t.Fatal("restarted before the doubled backoff")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.advance(superviseMinBackoff)
+	<-runs
+	<-done
+
+	var b strings.Builder
+	bw := bufio.NewWriter(&b)
+	writeSupervisorMetrics(bw)
+	bw.Flush()
+	if !strings.Contains(b.String(), `stream_runner_goroutine_panics_total{goroutine="test worker"} 2`) {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+}
+
+// TestWithPanicReport 测试 HTTP 处理函数 panic 时返回 500 并计入 panic 次数。
+func TestWithPanicReport(t *testing.T) {
+	h := withPanicReport("test handler", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("nil map")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", rec.Code)
+	}
+	goroutinePanics.mu.Lock()
+	defer goroutinePanics.mu.Unlock()
+	if got := goroutinePanics.counts["test handler"]; got != 1 {
+		t.Errorf("panics = %d", got)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSyntheticSize 是测试图案的默认分辨率。
+	DefaultSyntheticSize = "1280x720"
+	// DefaultSyntheticFrameRate 是测试图案的默认帧率。
+	DefaultSyntheticFrameRate = 25
+	// DefaultSyntheticBitrate 是测试图案的默认视频码率。
+	DefaultSyntheticBitrate = "2500k"
+	// DefaultSyntheticInterval 是平台侧验证的默认间隔。
+	DefaultSyntheticInterval = time.Minute
+	// syntheticWarmup 是推流开始后到首次验证前的等待时间，给平台留出转码和分发的时间。
+	syntheticWarmup = 30 * time.Second
+)
+
+// syntheticSize 匹配 WxH 形式的分辨率。
+var syntheticSize = regexp.MustCompile(`^[1-9][0-9]{1,4}x[1-9][0-9]{1,4}$`)
+
+// SyntheticConfig 表示端到端监测流：用 ffmpeg 生成测试图案，经与正式流相同的网络路径推到目标平台，
+// 再从平台侧验证能否播放。正式流和监测流同时出问题时多半是平台侧故障，只有正式流出问题时多半是源或本机。
+type SyntheticConfig struct {
+	// Size 是测试图案的分辨率，默认 1280x720。
+	Size string `yaml:"size,omitempty"`
+	// FrameRate 是测试图案的帧率，默认 25。
+	FrameRate int `yaml:"frame_rate,omitempty"`
+	// Bitrate 是视频码率，默认 2500k。
+	Bitrate string `yaml:"bitrate,omitempty"`
+	// PlaybackURL 是平台侧的播放地址（HLS、FLV、RTMP 等），用 ffprobe 验证能否读到视频。
+	PlaybackURL string `yaml:"playback_url,omitempty"`
+	// StatusURL 是平台的状态 API，GET 返回 2xx 视为正常。
+	StatusURL string `yaml:"status_url,omitempty"`
+	// Headers 是请求 status_url 时附带的请求头，如 API 令牌。
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Interval 是验证间隔，默认 1m。
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// validate 校验端到端监测配置，s 是监测流本身的配置。
+func (c *SyntheticConfig) validate(s StreamConfig) error {
+	if s.Src != "" {
+		return fmt.Errorf("src must be empty, the test pattern is generated")
+	}
+	if s.Probe || s.TranscodeFallback != "" || s.Deinterlace != nil || s.FrameRate != "" || s.AVSync != nil {
+		return fmt.Errorf("probe, transcode_fallback, deinterlace, frame_rate and av_sync do not apply to synthetic streams")
+	}
+	if c.Size != "" && !syntheticSize.MatchString(c.Size) {
+		return fmt.Errorf("size must look like 1280x720")
+	}
+	if c.FrameRate < 0 || c.FrameRate > 120 {
+		return fmt.Errorf("frame_rate must not exceed 120")
+	}
+	if c.Bitrate != "" {
+		if _, err := strconv.ParseUint(trimBitrateSuffix(c.Bitrate), 10, 32); err != nil {
+			return fmt.Errorf("bitrate must look like 2500k")
+		}
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if c.PlaybackURL == "" && c.StatusURL == "" {
+		return fmt.Errorf("at least one of playback_url and status_url is required")
+	}
+	if c.StatusURL != "" {
+		u, err := url.Parse(c.StatusURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("status_url must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// trimBitrateSuffix 去掉码率的 k/M 后缀。
+func trimBitrateSuffix(s string) string {
+	if n := len(s); n > 1 && (s[n-1] == 'k' || s[n-1] == 'M') {
+		return s[:n-1]
+	}
+	return s
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c SyntheticConfig) withDefaults() SyntheticConfig {
+	if c.Size == "" {
+		c.Size = DefaultSyntheticSize
+	}
+	if c.FrameRate == 0 {
+		c.FrameRate = DefaultSyntheticFrameRate
+	}
+	if c.Bitrate == "" {
+		c.Bitrate = DefaultSyntheticBitrate
+	}
+	if c.Interval == 0 {
+		c.Interval = DefaultSyntheticInterval
+	}
+	return c
+}
+
+// inputArgs 返回生成测试图案（带帧计数）和 1kHz 测试音的输入参数。
+func (c SyntheticConfig) inputArgs() []string {
+	o := c.withDefaults()
+	return []string{
+		"-re", "-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=%s:rate=%d", o.Size, o.FrameRate),
+		"-f", "lavfi", "-i", "sine=frequency=1000:sample_rate=48000",
+	}
+}
+
+// codecArgs 返回测试图案的编码参数，关键帧间隔 2 秒。
+func (c SyntheticConfig) codecArgs() []string {
+	o := c.withDefaults()
+	return []string{
+		"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-pix_fmt", "yuv420p",
+		"-b:v", o.Bitrate, "-maxrate", o.Bitrate, "-bufsize", o.Bitrate, "-g", strconv.Itoa(2 * o.FrameRate),
+		"-c:a", "aac", "-b:a", "128k",
+	}
+}
+
+// syntheticResult 是一次平台侧验证的结果。
+type syntheticResult struct {
+	OK      bool
+	Checked time.Time
+	Error   string
+}
+
+// checkSynthetic 从平台侧验证监测流：播放地址能读到视频，状态 API 返回 2xx。读取播放地址时使用流的 sandbox 配置。
+func checkSynthetic(c SyntheticConfig, sb *SandboxConfig) error {
+	if c.PlaybackURL != "" {
+		out, err := runFFprobe(sb, probeTimeout, []string{"-v", "error", "-print_format", "json", "-rw_timeout", "10000000", "-show_format", "-show_streams", c.PlaybackURL})
+		if err != nil {
+			return fmt.Errorf("playback: %w", err)
+		}
+		probe, err := parseProbeOutput(out)
+		if err != nil {
+			return fmt.Errorf("playback: %w", err)
+		}
+		if probe.Video() == nil {
+			return fmt.Errorf("playback: no video stream")
+		}
+	}
+	if c.StatusURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.StatusURL, nil)
+		if err != nil {
+			return fmt.Errorf("status: %w", err)
+		}
+		for k, v := range c.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("status: %w", err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("status: unexpected response %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// syntheticMonitor 定期验证运行中的监测流，状态变化时发出事件。
+type syntheticMonitor struct {
+	state *AppState
+	mu    sync.Mutex
+	// results 是每路监测流最近一次的验证结果。
+	results  map[string]syntheticResult
+	inFlight map[string]bool
+}
+
+// synthetic 是当前的端到端监测器。
+var synthetic atomic.Pointer[syntheticMonitor]
+
+// newSyntheticMonitor 创建端到端监测器。
+func newSyntheticMonitor(state *AppState) *syntheticMonitor {
+	return &syntheticMonitor{state: state, results: make(map[string]syntheticResult), inFlight: make(map[string]bool)}
+}
+
+// run 每 10 秒扫描一次工作器，对推流已超过预热时间且到期的监测流发起验证。
+func (m *syntheticMonitor) run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		workers := m.state.workers.snapshot()
+		ids := make(map[string]bool, len(workers))
+		for id, w := range workers {
+			cfg := w.config()
+			if cfg.Synthetic == nil {
+				continue
+			}
+			ids[id] = true
+			start := w.runningSince()
+			if start.IsZero() || now.Sub(start) < syntheticWarmup {
+				continue
+			}
+			opts := cfg.Synthetic.withDefaults()
+			m.mu.Lock()
+			due := !m.inFlight[id] && now.Sub(m.results[id].Checked) >= opts.Interval
+			if due {
+				m.inFlight[id] = true
+			}
+			m.mu.Unlock()
+			if due {
+				go m.check(id, opts, cfg.Sandbox)
+			}
+		}
+
+		m.mu.Lock()
+		for id := range m.results {
+			if !ids[id] {
+				delete(m.results, id)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// check 验证一次监测流并记录结果，失败和恢复时各发出一次事件。
+func (m *syntheticMonitor) check(id string, opts SyntheticConfig, sb *SandboxConfig) {
+	err := checkSynthetic(opts, sb)
+	res := syntheticResult{OK: err == nil, Checked: time.Now()}
+	if err != nil {
+		res.Error = redactURLs(err.Error())
+	}
+
+	m.mu.Lock()
+	prev, seen := m.results[id]
+	m.results[id] = res
+	delete(m.inFlight, id)
+	m.mu.Unlock()
+
+	switch {
+	case !res.OK && (!seen || prev.OK):
+		slog.Warn("synthetic stream failed platform-side check", "stream_id", id, "error", res.Error)
+		emitEvent(id, "synthetic_failed", res.Error)
+	case res.OK && seen && !prev.OK:
+		emitEvent(id, "synthetic_recovered")
+	}
+}
+
+// writeSyntheticMetrics 输出监测流最近一次平台侧验证的结果，没有监测流时不输出。
+func writeSyntheticMetrics(bw *bufio.Writer) {
+	m := synthetic.Load()
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.results))
+	for id := range m.results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	results := make([]syntheticResult, len(ids))
+	for i, id := range ids {
+		results[i] = m.results[id]
+	}
+	m.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	fmt.Fprintln(bw, "# HELP stream_runner_synthetic_check_ok Whether the last platform-side check of the synthetic stream passed.")
+	fmt.Fprintln(bw, "# TYPE stream_runner_synthetic_check_ok gauge")
+	for i, id := range ids {
+		ok := 0
+		if results[i].OK {
+			ok = 1
+		}
+		fmt.Fprintf(bw, "stream_runner_synthetic_check_ok{stream_id=\"%s\"} %d\n", escapeLabelValue(id), ok)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSyntheticValidate 测试监测流不能配置源地址和源相关选项，且至少要有一种平台侧验证方式
+func TestSyntheticValidate(t *testing.T) {
+	ok := SyntheticConfig{PlaybackURL: "https://live.example.com/app/synthetic.m3u8"}
+	if err := ok.validate(StreamConfig{ID: "s", Dst: "rtmp://live.example.com/app/key"}); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	cases := map[string]struct {
+		c SyntheticConfig
+		s StreamConfig
+	}{
+		"src":        {ok, StreamConfig{Src: "rtmp://127.0.0.1/live/src"}},
+		"probe":      {ok, StreamConfig{Probe: true}},
+		"no check":   {SyntheticConfig{}, StreamConfig{}},
+		"size":       {SyntheticConfig{PlaybackURL: ok.PlaybackURL, Size: "720p"}, StreamConfig{}},
+		"bitrate":    {SyntheticConfig{PlaybackURL: ok.PlaybackURL, Bitrate: "fast"}, StreamConfig{}},
+		"status url": {SyntheticConfig{StatusURL: "ftp://api.example.com/status"}, StreamConfig{}},
+	}
+	for name, tc := range cases {
+		if err := tc.c.validate(tc.s); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestSyntheticFFmpegArgs 测试监测流用生成的测试图案代替源输入
+func TestSyntheticFFmpegArgs(t *testing.T) {
+	cfg := StreamConfig{ID: "s", Dst: "rtmp://live.example.com/app/key", Synthetic: &SyntheticConfig{Size: "640x360", FrameRate: 30}}
+	joined := strings.Join(buildFFmpegArgs(cfg, &resolvedEndpoints{Dst: cfg.Dst}, outputPlan{}), " ")
+	for _, want := range []string{"-f lavfi -i testsrc2=size=640x360:rate=30", "-c:v libx264", "-g 60", "rtmp://live.example.com/app/key"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args %q missing %q", joined, want)
+		}
+	}
+	if strings.Contains(joined, "-c copy") {
+		t.Errorf("args %q should not copy codecs", joined)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxTemporaryTTL 是临时流的最长存活时间。
+const MaxTemporaryTTL = 7 * 24 * time.Hour
+
+// temporaryStream 是通过管理接口创建的临时流，只保存在内存中，到期后自动停止并删除。
+type temporaryStream struct {
+	cfg     StreamConfig
+	created time.Time
+	expires time.Time
+}
+
+// temporaryStreamRequest 是 POST /temporary-streams 的请求正文，字段与 streams.yml 中的流相同，另加 ttl。
+type temporaryStreamRequest struct {
+	StreamConfig `yaml:",inline"`
+	// TTL 是存活时间，如 2h。
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// temporaryStreamInfo 是临时流在管理接口中的表示，不含完整地址。
+type temporaryStreamInfo struct {
+	ID        string    `json:"id"`
+	DstHost   string    `json:"dst_host,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// info 返回临时流在管理接口中的表示。
+func (t temporaryStream) info() temporaryStreamInfo {
+	return temporaryStreamInfo{ID: t.cfg.ID, DstHost: endpointHost(t.cfg.Dst), CreatedAt: t.created, ExpiresAt: t.expires}
+}
+
+// effectiveStreams 返回配置中的流加上仍有效的临时流。与配置中的流 ID 冲突的临时流被丢弃，配置优先。
+// 调用方需持有 state.mu 写锁。
+func effectiveStreams(state *AppState, cfg *Config) []StreamConfig {
+	if len(state.temporary) == 0 {
+		return cfg.Streams
+	}
+	streams := append([]StreamConfig(nil), cfg.Streams...)
+	configured := make(map[string]bool, len(cfg.Streams))
+	for _, s := range cfg.Streams {
+		configured[s.ID] = true
+	}
+	ids := make([]string, 0, len(state.temporary))
+	for id := range state.temporary {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if configured[id] {
+			slog.Warn("temporary stream replaced by configured stream", "stream_id", id)
+			delete(state.temporary, id)
+			continue
+		}
+		streams = append(streams, state.temporary[id].cfg)
+	}
+	return streams
+}
+
+// addTemporaryStream 校验并启动临时流。
+func addTemporaryStream(state *AppState, req temporaryStreamRequest, now time.Time) (temporaryStream, error) {
+	s := req.StreamConfig
+	if s.ID == "" {
+		return temporaryStream{}, fmt.Errorf("id is required")
+	}
+	if req.TTL <= 0 || req.TTL > MaxTemporaryTTL {
+		return temporaryStream{}, fmt.Errorf("ttl must be between 0 and %s", MaxTemporaryTTL)
+	}
+	if len(s.RenamedFrom) > 0 {
+		return temporaryStream{}, fmt.Errorf("renamed_from is not supported for temporary streams")
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	cfg := state.config
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if s.Region == "" {
+		s.Region = cfg.Region
+	}
+	if err := validateStream(cfg, s); err != nil {
+		return temporaryStream{}, err
+	}
+	if _, exists := state.workers.get(s.ID); exists {
+		return temporaryStream{}, errStreamExists
+	}
+	t := temporaryStream{cfg: s, created: now, expires: now.Add(req.TTL)}
+	if state.temporary == nil {
+		state.temporary = make(map[string]temporaryStream)
+	}
+	state.temporary[s.ID] = t
+	slog.Info("adding temporary stream", "stream_id", s.ID, "expires", t.expires)
+	rememberRecordings([]StreamConfig{s})
+	w := &StreamWorker{cfg: s}
+	state.workers.store(s.ID, w)
+	w.Start(context.Background())
+	return t, nil
+}
+
+// errStreamExists 表示同名的流已存在。
+var errStreamExists = errors.New("stream already exists")
+
+// removeTemporaryStream 停止并删除临时流，不存在时返回 false。
+func removeTemporaryStream(state *AppState, id string) bool {
+	state.mu.Lock()
+	if _, ok := state.temporary[id]; !ok {
+		state.mu.Unlock()
+		return false
+	}
+	delete(state.temporary, id)
+	w, ok := state.workers.remove(id)
+	state.mu.Unlock()
+
+	// Stopping may wait for stop_timeout, so it runs outside state.mu.
+	if ok {
+		forgetEvents(id)
+		if err := w.shutdown(); err != nil {
+			slog.Error("failed to stop worker", "stream_id", id, "error", err)
+		}
+	}
+	return true
+}
+
+// expireTemporaryStreams 删除 now 时已到期的临时流。
+func expireTemporaryStreams(state *AppState, now time.Time) {
+	state.mu.RLock()
+	var expired []string
+	for id, t := range state.temporary {
+		if !now.Before(t.expires) {
+			expired = append(expired, id)
+		}
+	}
+	state.mu.RUnlock()
+	for _, id := range expired {
+		if removeTemporaryStream(state, id) {
+			slog.Info("temporary stream expired", "stream_id", id)
+		}
+	}
+}
+
+// runTemporaryReaper 每秒清理一次到期的临时流。
+func runTemporaryReaper(state *AppState) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		expireTemporaryStreams(state, now)
+	}
+}
+
+// temporaryExpiry 返回临时流的到期时间，不是临时流时返回 nil。调用方需持有 state.mu。
+func temporaryExpiry(state *AppState, id string) *time.Time {
+	t, ok := state.temporary[id]
+	if !ok {
+		return nil
+	}
+	return &t.expires
+}
+
+// handleTemporaryStreams 处理 /temporary-streams：GET 列出、POST 创建、DELETE /temporary-streams/{id} 删除。
+func handleTemporaryStreams(state *AppState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/temporary-streams"), "/")
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			state.mu.RLock()
+			list := make([]temporaryStreamInfo, 0, len(state.temporary))
+			for _, t := range state.temporary {
+				list = append(list, t.info())
+			}
+			state.mu.RUnlock()
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			writeAPIJSON(w, http.StatusOK, list)
+		case r.Method == http.MethodPost && id == "":
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// JSON is valid YAML, so both are accepted with the streams.yml field names.
+			var req temporaryStreamRequest
+			if err := yaml.Unmarshal(body, &req); err != nil {
+				writeAPIError(w, http.StatusBadRequest, annotateYAMLError(body, err).Error())
+				return
+			}
+			t, err := addTemporaryStream(state, req, time.Now())
+			switch {
+			case errors.Is(err, errStreamExists):
+				writeAPIError(w, http.StatusConflict, fmt.Sprintf("stream %s already exists", req.ID))
+			case err != nil:
+				writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			default:
+				writeAPIJSON(w, http.StatusCreated, t.info())
+			}
+		case r.Method == http.MethodDelete && id != "":
+			// Deleting a missing stream is not an error, so retries are safe.
+			if !removeTemporaryStream(state, id) {
+				if _, configured := state.workers.get(id); configured {
+					writeAPIError(w, http.StatusConflict, fmt.Sprintf("stream %s is not a temporary stream", id))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTemporaryStreams 测试临时流在重载时保留、与配置冲突时让位，并在到期后删除
+func TestTemporaryStreams(t *testing.T) {
+	now := time.Now()
+	state := &AppState{
+		workers: newWorkerMap(map[string]*StreamWorker{"event": {cfg: StreamConfig{ID: "event"}}, "clash": {cfg: StreamConfig{ID: "clash"}}}),
+		temporary: map[string]temporaryStream{
+			"event": {cfg: StreamConfig{ID: "event"}, expires: now.Add(time.Minute)},
+			"clash": {cfg: StreamConfig{ID: "clash"}, expires: now.Add(time.Minute)},
+		},
+	}
+	streams := effectiveStreams(state, &Config{Streams: []StreamConfig{{ID: "clash"}, {ID: "main"}}})
+	if len(streams) != 3 || streams[2].ID != "event" {
+		t.Errorf("unexpected effective streams %+v", streams)
+	}
+	if _, ok := state.temporary["clash"]; ok {
+		t.Error("configured stream must replace the temporary stream with the same id")
+	}
+
+	expireTemporaryStreams(state, now)
+	if _, ok := state.workers.get("event"); !ok {
+		t.Fatal("stream removed before it expired")
+	}
+	expireTemporaryStreams(state, now.Add(time.Minute))
+	if _, ok := state.workers.get("event"); ok || len(state.temporary) != 0 {
+		t.Error("expired temporary stream was not removed")
+	}
+}
+
+// TestAddTemporaryStreamValidation 测试创建临时流时的参数校验
+func TestAddTemporaryStreamValidation(t *testing.T) {
+	state := &AppState{workers: newWorkerMap(map[string]*StreamWorker{"main": {}}), config: &Config{}}
+	valid := StreamConfig{ID: "main", Src: "rtmp://a/live/1", Dst: "rtmp://b/live/1"}
+	cases := []temporaryStreamRequest{
+		{StreamConfig: StreamConfig{Src: valid.Src, Dst: valid.Dst}, TTL: time.Hour},
+		{StreamConfig: valid, TTL: 0},
+		{StreamConfig: valid, TTL: MaxTemporaryTTL + time.Hour},
+		{StreamConfig: StreamConfig{ID: "x", Src: valid.Src, Dst: valid.Dst, IPFamily: "ipv5"}, TTL: time.Hour},
+		{StreamConfig: valid, TTL: time.Hour},
+	}
+	for _, req := range cases {
+		if _, err := addTemporaryStream(state, req, time.Now()); err == nil {
+			t.Errorf("%+v: expected error", req)
+		}
+	}
+	if len(state.temporary) != 0 {
+		t.Error("rejected requests must not create temporary streams")
+	}
+}
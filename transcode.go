@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// DefaultTranscodeVideoCodec 是转码配置未指定视频编码器时使用的编码器。
+	DefaultTranscodeVideoCodec = "libx264"
+	// DefaultTranscodePreset 是转码配置未指定预设时使用的编码预设。
+	DefaultTranscodePreset = "veryfast"
+	// DefaultTranscodeAudioCodec 是转码配置未指定音频编码器时使用的编码器。
+	DefaultTranscodeAudioCodec = "aac"
+)
+
+// TranscodeProfile 表示源编码与输出封装不兼容时使用的转码参数。
+type TranscodeProfile struct {
+	// VideoCodec 是视频编码器，默认 libx264。
+	VideoCodec string `yaml:"video_codec,omitempty"`
+	// Preset 是编码预设，默认 veryfast。
+	Preset string `yaml:"preset,omitempty"`
+	// VideoBitrate 是视频码率，如 3000k。
+	VideoBitrate string `yaml:"video_bitrate,omitempty"`
+	// MaxRate 是视频最大码率（可选）。
+	MaxRate string `yaml:"max_rate,omitempty"`
+	// BufSize 是码率控制缓冲区大小（可选）。
+	BufSize string `yaml:"buf_size,omitempty"`
+	// GOP 是关键帧间隔帧数（可选）。
+	GOP int `yaml:"gop,omitempty"`
+	// Width 是输出宽度，为 0 时保持源分辨率；只设置宽度时按比例缩放。
+	Width int `yaml:"width,omitempty"`
+	// Height 是输出高度，为 0 时按比例缩放。
+	Height int `yaml:"height,omitempty"`
+	// AudioCodec 是音频编码器，默认 aac。
+	AudioCodec string `yaml:"audio_codec,omitempty"`
+	// AudioBitrate 是音频码率，如 128k。
+	AudioBitrate string `yaml:"audio_bitrate,omitempty"`
+}
+
+// transcodeProfiles 是当前生效的转码配置表，在配置重载时替换。
+var transcodeProfiles atomic.Pointer[map[string]TranscodeProfile]
+
+// lookupTranscodeProfile 返回指定名称的转码配置，不存在时返回 nil。
+func lookupTranscodeProfile(name string) *TranscodeProfile {
+	profiles := transcodeProfiles.Load()
+	if name == "" || profiles == nil {
+		return nil
+	}
+	if p, ok := (*profiles)[name]; ok {
+		return &p
+	}
+	return nil
+}
+
+// validate 校验转码配置。
+func (p TranscodeProfile) validate() error {
+	if p.GOP < 0 || p.Width < 0 || p.Height < 0 {
+		return fmt.Errorf("gop, width and height must not be negative")
+	}
+	return nil
+}
+
+// videoArgs 返回视频转码参数，before 中的滤镜在缩放之前执行，after 中的滤镜在缩放之后执行。
+func (p *TranscodeProfile) videoArgs(before, after []string) []string {
+	codec := p.VideoCodec
+	if codec == "" {
+		codec = DefaultTranscodeVideoCodec
+	}
+	preset := p.Preset
+	if preset == "" {
+		preset = DefaultTranscodePreset
+	}
+	args := []string{"-c:v", codec, "-preset", preset}
+	if p.VideoBitrate != "" {
+		args = append(args, "-b:v", p.VideoBitrate)
+	}
+	if p.MaxRate != "" {
+		args = append(args, "-maxrate", p.MaxRate)
+	}
+	if p.BufSize != "" {
+		args = append(args, "-bufsize", p.BufSize)
+	}
+	if p.GOP > 0 {
+		args = append(args, "-g", strconv.Itoa(p.GOP))
+	}
+	chain := append([]string(nil), before...)
+	if p.Width > 0 || p.Height > 0 {
+		// -2 keeps the aspect ratio with an even dimension, as most encoders require.
+		w, h := p.Width, p.Height
+		if w == 0 {
+			w = -2
+		}
+		if h == 0 {
+			h = -2
+		}
+		chain = append(chain, fmt.Sprintf("scale=%d:%d", w, h))
+	}
+	chain = append(chain, after...)
+	if len(chain) > 0 {
+		args = append(args, "-vf", strings.Join(chain, ","))
+	}
+	// Keep the output playable by decoders that only accept 8-bit 4:2:0.
+	return append(args, "-pix_fmt", "yuv420p")
+}
+
+// audioArgs 返回音频转码参数。
+func (p *TranscodeProfile) audioArgs() []string {
+	codec := p.AudioCodec
+	if codec == "" {
+		codec = DefaultTranscodeAudioCodec
+	}
+	args := []string{"-c:a", codec}
+	if p.AudioBitrate != "" {
+		args = append(args, "-b:a", p.AudioBitrate)
+	}
+	return args
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTranscodeFallback 测试不兼容源流按转码配置回退
+func TestTranscodeFallback(t *testing.T) {
+	probe := &probeResult{Streams: []probeStream{
+		{CodecType: "video", CodecName: "av1"},
+		{CodecType: "audio", CodecName: "aac"},
+	}}
+	profile := &TranscodeProfile{VideoBitrate: "3000k", Width: 1280, GOP: 50}
+	cfg := StreamConfig{Src: "rtmp://source.com/live", Dst: "rtmp://dest.com/live"}
+
+	plan, err := planOutput(cfg, probe, profile)
+	if err != nil {
+		t.Fatalf("planOutput failed: %v", err)
+	}
+	if !plan.TranscodeVideo || plan.TranscodeAudio {
+		t.Fatalf("expected only video to be transcoded, got %+v", plan)
+	}
+
+	joined := strings.Join(buildFFmpegArgs(cfg, &resolvedEndpoints{Src: cfg.Src, Dst: cfg.Dst}, plan), " ")
+	for _, want := range []string{"-c:v libx264 -preset veryfast -b:v 3000k -g 50", "-vf scale=1280:-2", "-c:a copy", "-f flv"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %q in args, got %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "-c copy") {
+		t.Errorf("expected no stream copy for all streams, got %s", joined)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize 是配置中的字节数，可以写成 512KB、100MB、1.5GiB 或纯数字（字节）。
+// 单位按 1024 进制换算，KB 与 KiB 含义相同。
+type ByteSize int64
+
+// byteUnits 是支持的单位（小写）到字节数的换算。
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// byteSizePattern 匹配数值和可选单位。
+var byteSizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z]*)$`)
+
+// parseByteSize 解析带单位的字节数。
+func parseByteSize(s string) (ByteSize, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional unit such as 512KB or 100MB", s)
+	}
+	unit, ok := byteUnits[strings.ToLower(m[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, m[2])
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return ByteSize(n * float64(unit)), nil
+}
+
+// UnmarshalYAML 实现 yaml.Unmarshaler 接口。
+func (b *ByteSize) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: size must be a scalar", n.Line)}}
+	}
+	v, err := parseByteSize(n.Value)
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %v", n.Line, err)}}
+	}
+	*b = v
+	return nil
+}
+
+// String 返回最大的可整除单位表示，如 512KB、100MB。
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if b != 0 && int64(b)%u.size == 0 {
+			return strconv.FormatInt(int64(b)/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// MarshalYAML 实现 yaml.Marshaler 接口，导出配置时保留可读的单位。
+func (b ByteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
+
+// yamlLinePattern 匹配 yaml 解码错误中的行号前缀。
+var yamlLinePattern = regexp.MustCompile(`^line (\d+): `)
+
+// yamlKeyPaths 返回每一行上的值所对应的配置键路径，如 streams[0].av_sync.interval。
+func yamlKeyPaths(data []byte) map[int]string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	paths := make(map[int]string)
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				walk(n.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+		// Keep the first path seen on a line; flow mappings put several keys on one line.
+		if _, ok := paths[n.Line]; !ok && n.Kind == yaml.ScalarNode {
+			paths[n.Line] = path
+		}
+	}
+	walk(&doc, "")
+	return paths
+}
+
+// annotateYAMLError 在 yaml 类型错误前加上出错的配置键路径，方便定位写错的值。
+func annotateYAMLError(data []byte, err error) error {
+	te, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	paths := yamlKeyPaths(data)
+	msgs := make([]string, len(te.Errors))
+	for i, msg := range te.Errors {
+		msgs[i] = msg
+		m := yamlLinePattern.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		if path, ok := paths[line]; ok && path != "" {
+			msgs[i] = fmt.Sprintf("%s (line %d): %s", path, line, msg[len(m[0]):])
+		}
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
+}
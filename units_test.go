@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestParseByteSize 测试带单位的字节数解析和格式化
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]ByteSize{
+		"512":    512,
+		"512KB":  512 << 10,
+		"100 MB": 100 << 20,
+		"1.5GiB": 3 << 29,
+		"2g":     2 << 30,
+	}
+	for in, want := range cases {
+		got, err := parseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "10 parsecs", "-1MB"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded, want error", in)
+		}
+	}
+	if s := ByteSize(100 << 20).String(); s != "100MB" {
+		t.Errorf("String() = %q, want 100MB", s)
+	}
+}
+
+// TestAnnotateYAMLError 测试解码错误指向出错的配置键
+func TestAnnotateYAMLError(t *testing.T) {
+	data := []byte(`streams:
+  - id: a
+    resources:
+      max_rss: 10 parsecs
+    av_sync:
+      interval: 2 days
+`)
+	var cfg Config
+	err := annotateYAMLError(data, yaml.Unmarshal(data, &cfg))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"streams[0].resources.max_rss (line 4)", "streams[0].av_sync.interval (line 6)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// 构建信息，发布时通过 -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..." 写入。
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// protocolVersion 是节点之间读取的接口（/version、/inventory）的协议版本，这些接口发生不兼容的变化时加一。
+// fleet 汇总只合并协议版本相同的节点。
+const protocolVersion = 1
+
+// buildInfo 是当前程序的版本和构建信息。
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	// Protocol 是 protocolVersion，早于握手的版本不返回该字段。
+	Protocol int `json:"protocol"`
+}
+
+// currentBuildInfo 返回构建信息；未通过 ldflags 设置的提交和时间从 Go 内置的 VCS 信息中读取。
+func currentBuildInfo() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version(), Protocol: protocolVersion}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = s.Value
+			case s.Key == "vcs.time" && b.BuildDate == "":
+				b.BuildDate = s.Value
+			}
+		}
+	}
+	if len(b.Commit) > 12 {
+		b.Commit = b.Commit[:12]
+	}
+	return b
+}
+
+// String 返回 --version 输出的单行描述。
+func (b buildInfo) String() string {
+	s := "stream-runner " + b.Version
+	if b.Commit != "" {
+		s += " (commit " + b.Commit
+		if b.BuildDate != "" {
+			s += ", built " + b.BuildDate
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s %s/%s", s, b.GoVersion, runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBuildInfoString 测试 --version 输出
+func TestBuildInfoString(t *testing.T) {
+	b := buildInfo{Version: "1.2.0", Commit: "abc1234", BuildDate: "2026-10-15T08:00:00Z", GoVersion: "go1.22.5"}
+	if s := b.String(); !strings.HasPrefix(s, "stream-runner 1.2.0 (commit abc1234, built 2026-10-15T08:00:00Z) go1.22.5 ") {
+		t.Errorf("String() = %q", s)
+	}
+	if s := (buildInfo{Version: "dev", GoVersion: "go1.22.5"}).String(); !strings.HasPrefix(s, "stream-runner dev go1.22.5 ") {
+		t.Errorf("String() = %q", s)
+	}
+}
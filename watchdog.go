@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultWatchdogStallTimeout 是输出停止前进多久后视为卡住的默认时长。
+const DefaultWatchdogStallTimeout = 30 * time.Second
+
+// 看门狗判定流异常的条件。
+const (
+	// WatchdogDown 表示 ffmpeg 未运行且不在重试等待或节目间隙中。
+	WatchdogDown = "down"
+	// WatchdogStalled 表示 ffmpeg 在运行但输出超过 stall_timeout 没有前进。
+	WatchdogStalled = "stalled"
+	// WatchdogProbeFailed 表示 ffmpeg 在运行但 ffprobe 无法读取源流。
+	WatchdogProbeFailed = "probe_failed"
+)
+
+// 看门狗发现异常后的处理方式。
+const (
+	// WatchdogRestart 停止 ffmpeg，由工作器重新启动。
+	WatchdogRestart = "restart"
+	// WatchdogNotify 只发出事件，不干预 ffmpeg。
+	WatchdogNotify = "notify"
+	// WatchdogHook 执行 hook 中配置的命令。
+	WatchdogHook = "hook"
+)
+
+// WatchdogConfig 表示流的看门狗策略。未配置时每隔 settings.watchdog_interval 检查一次，
+// ffmpeg 未运行时强制重启。
+type WatchdogConfig struct {
+	// Interval 是检查间隔，默认取 settings.watchdog_interval。
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Unhealthy 是判定异常的条件：down、stalled、probe_failed，默认只有 down。
+	Unhealthy []string `yaml:"unhealthy,omitempty"`
+	// StallTimeout 是输出停止前进多久后视为卡住，默认 30s。
+	StallTimeout time.Duration `yaml:"stall_timeout,omitempty"`
+	// Action 是发现异常后的处理方式：restart、notify、hook，默认 restart。
+	Action string `yaml:"action,omitempty"`
+	// Hook 是 action 为 hook 时执行的命令及其参数（不经过 shell），受全局 hooks 策略约束。
+	Hook []string `yaml:"hook,omitempty"`
+}
+
+// validate 校验看门狗配置。
+func (c *WatchdogConfig) validate() error {
+	if c.Interval < 0 || c.StallTimeout < 0 {
+		return fmt.Errorf("interval and stall_timeout must not be negative")
+	}
+	for _, u := range c.Unhealthy {
+		switch u {
+		case WatchdogDown, WatchdogStalled, WatchdogProbeFailed:
+		default:
+			return fmt.Errorf("unknown unhealthy condition %q, expected down, stalled or probe_failed", u)
+		}
+	}
+	switch c.Action {
+	case "", WatchdogRestart, WatchdogNotify:
+		if len(c.Hook) > 0 {
+			return fmt.Errorf("hook is only used with action hook")
+		}
+	case WatchdogHook:
+		if len(c.Hook) == 0 {
+			return fmt.Errorf("hook is required for action hook")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected restart, notify or hook", c.Action)
+	}
+	return nil
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (c WatchdogConfig) withDefaults() WatchdogConfig {
+	if c.Interval == 0 {
+		c.Interval = currentSettings().WatchdogInterval
+	}
+	if len(c.Unhealthy) == 0 {
+		c.Unhealthy = []string{WatchdogDown}
+	}
+	if c.StallTimeout == 0 {
+		c.StallTimeout = DefaultWatchdogStallTimeout
+	}
+	if c.Action == "" {
+		c.Action = WatchdogRestart
+	}
+	return c
+}
+
+// watchdogOptions 返回流生效的看门狗策略。
+func watchdogOptions(cfg StreamConfig) WatchdogConfig {
+	if cfg.Watchdog == nil {
+		return WatchdogConfig{}.withDefaults()
+	}
+	return cfg.Watchdog.withDefaults()
+}
+
+// stalledFor 返回当前运行的输出已停止前进的时长，未运行时返回 0。
+func (w *StreamWorker) stalledFor(now time.Time) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running || w.stats.lastAdvance.IsZero() {
+		return 0
+	}
+	return now.Sub(w.stats.lastAdvance)
+}
+
+// unhealthyReason 按配置的条件检查工作器，返回第一个命中的条件，健康时返回空串。
+// probe_failed 需要读取源流，放在最后检查。
+func unhealthyReason(w *StreamWorker, cfg StreamConfig, opts WatchdogConfig, now time.Time) string {
+	running := w.IsRunning()
+	if containsString(opts.Unhealthy, WatchdogDown) && !running && !w.inBackoff() && !w.isOffSchedule() && !w.isStopped() {
+		return WatchdogDown
+	}
+	if containsString(opts.Unhealthy, WatchdogStalled) && w.stalledFor(now) >= opts.StallTimeout {
+		return WatchdogStalled
+	}
+	if containsString(opts.Unhealthy, WatchdogProbeFailed) && running {
+		err := probeRunningSource(cfg)
+		w.recordProbe(err)
+		if err != nil {
+			slog.Warn("watchdog probe failed", "stream_id", cfg.ID, "error", err)
+			return WatchdogProbeFailed
+		}
+	}
+	return ""
+}
+
+// probeRunningSource 用 ffprobe 读取一次源流，只关心能否读取。
+func probeRunningSource(cfg StreamConfig) error {
+	if err := resolveStreamSecrets(&cfg); err != nil {
+		return err
+	}
+	ep, err := resolveEndpoints(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = probeSource(cfg, ep)
+	return err
+}
+
+// watchdog 按每路流的策略定期检查工作器，发现异常时重启、通知或执行钩子。
+type watchdog struct {
+	state *AppState
+	mu    sync.Mutex
+	// lastCheck 是每路流上次开始检查的时间。
+	lastCheck map[string]time.Time
+	// inFlight 记录正在检查的流，避免探测较慢时同一路流并发检查。
+	inFlight map[string]bool
+	// unhealthy 记录当前处于异常状态的流及命中的条件。
+	unhealthy map[string]string
+}
+
+// newWatchdog 创建看门狗。
+func newWatchdog(state *AppState) *watchdog {
+	return &watchdog{
+		state:     state,
+		lastCheck: make(map[string]time.Time),
+		inFlight:  make(map[string]bool),
+		unhealthy: make(map[string]string),
+	}
+}
+
+// run 在启动宽限期之后每秒扫描一次工作器，对到期的流发起检查。
+func (d *watchdog) run() {
+	grace := currentSettings().WatchdogGrace
+	loopWatchdog.expect(grace)
+	<-currentClock().After(grace) // Give workers time to start.
+	ticker := currentClock().NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C() {
+		loopWatchdog.beat()
+		for id, w := range d.state.workers.snapshot() {
+			cfg := w.config()
+			opts := watchdogOptions(cfg)
+			d.mu.Lock()
+			due := !d.inFlight[id] && now.Sub(d.lastCheck[id]) >= opts.Interval
+			if due {
+				d.inFlight[id] = true
+				d.lastCheck[id] = now
+			}
+			d.mu.Unlock()
+			if due {
+				go d.check(w, cfg, opts, now)
+			}
+		}
+	}
+}
+
+// check 检查一次工作器并按策略处理。restart 在异常期间每次检查都会执行，
+// 事件和钩子只在进入和离开异常状态时触发一次；未配置 watchdog 的流只重启、不发事件。
+func (d *watchdog) check(w *StreamWorker, cfg StreamConfig, opts WatchdogConfig, now time.Time) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.inFlight, cfg.ID)
+		d.mu.Unlock()
+	}()
+
+	reason := unhealthyReason(w, cfg, opts, now)
+	d.mu.Lock()
+	prev := d.unhealthy[cfg.ID]
+	if reason == "" {
+		delete(d.unhealthy, cfg.ID)
+	} else {
+		d.unhealthy[cfg.ID] = reason
+	}
+	d.mu.Unlock()
+
+	if reason == "" {
+		if prev != "" && cfg.Watchdog != nil {
+			emitEvent(cfg.ID, "watchdog_recovered", prev)
+		}
+		return
+	}
+	if reason != prev && cfg.Watchdog != nil {
+		emitEvent(cfg.ID, "watchdog_unhealthy", reason, opts.Action)
+	}
+	switch opts.Action {
+	case WatchdogRestart:
+		// A source that cannot be probed is not hard-down; ffmpeg is still pushing.
+		if reason == WatchdogProbeFailed {
+			if end, ok := restartBlackoutEnd(cfg, now); ok {
+				slog.Info("watchdog restart deferred by blackout window", "stream_id", cfg.ID, "until", end)
+				return
+			}
+		}
+		slog.Warn("watchdog found worker unhealthy, restarting", "stream_id", cfg.ID, "reason", reason)
+		w.Terminate()
+	case WatchdogHook:
+		if reason != prev {
+			fireHook(cfg.ID, "watchdog", opts.Hook, map[string]string{
+				"WATCHDOG_REASON": reason,
+			})
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWatchdogConfigValidate 测试看门狗配置的条件、处理方式和钩子校验
+func TestWatchdogConfigValidate(t *testing.T) {
+	cases := []struct {
+		cfg WatchdogConfig
+		ok  bool
+	}{
+		{WatchdogConfig{}, true},
+		{WatchdogConfig{Unhealthy: []string{"down", "stalled", "probe_failed"}, Action: "notify"}, true},
+		{WatchdogConfig{Action: "hook", Hook: []string{"/usr/local/bin/page"}}, true},
+		{WatchdogConfig{Action: "hook"}, false},
+		{WatchdogConfig{Hook: []string{"/usr/local/bin/page"}}, false},
+		{WatchdogConfig{Unhealthy: []string{"slow"}}, false},
+		{WatchdogConfig{Action: "reboot"}, false},
+		{WatchdogConfig{StallTimeout: -time.Second}, false},
+	}
+	for _, c := range cases {
+		if err := c.cfg.validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c.cfg, err)
+		}
+	}
+}
+
+// TestUnhealthyReason 测试按配置的条件判定未运行和输出卡住的工作器
+func TestUnhealthyReason(t *testing.T) {
+	start := time.Now()
+	opts := WatchdogConfig{Unhealthy: []string{WatchdogDown, WatchdogStalled}, StallTimeout: 30 * time.Second}.withDefaults()
+
+	w := &StreamWorker{cfg: StreamConfig{ID: "a"}}
+	if got := unhealthyReason(w, w.cfg, opts, start); got != WatchdogDown {
+		t.Errorf("stopped worker: got %q", got)
+	}
+
+	w.running = true
+	w.stats.recordStart(start)
+	w.stats.recordProgress(ffmpegProgress{OutTime: 10 * time.Second}, start.Add(10*time.Second))
+	if got := unhealthyReason(w, w.cfg, opts, start.Add(35*time.Second)); got != "" {
+		t.Errorf("advancing worker: got %q", got)
+	}
+	// The same progress again does not count as advancing.
+	w.stats.recordProgress(ffmpegProgress{OutTime: 10 * time.Second}, start.Add(30*time.Second))
+	if got := unhealthyReason(w, w.cfg, opts, start.Add(41*time.Second)); got != WatchdogStalled {
+		t.Errorf("stalled worker: got %q", got)
+	}
+
+	// Stalls are ignored unless configured.
+	if got := unhealthyReason(w, w.cfg, WatchdogConfig{}.withDefaults(), start.Add(41*time.Second)); got != "" {
+		t.Errorf("default strategy: got %q", got)
+	}
+}
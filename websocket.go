@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID 是 RFC 6455 握手中拼接在 Sec-WebSocket-Key 之后的固定值。
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket 帧的操作码。
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// wsMaxControlPayload 是控制帧负载的上限；只推送不接收业务消息，客户端发来的数据帧同样按此限制。
+const wsMaxControlPayload = 125
+
+// wsWriteTimeout 是写入单个帧的超时，客户端长时间不读取时断开连接。
+const wsWriteTimeout = 10 * time.Second
+
+// wsConn 是服务端的 WebSocket 连接，只实现推送事件需要的部分：发送文本帧，应答 ping 和关闭帧。
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	// mu 串行化写入，读取循环应答 ping 时与推送并发。
+	mu sync.Mutex
+}
+
+// upgradeWebSocket 校验握手请求并切换协议。origin 判断浏览器请求的来源是否允许，校验失败时已写入错误响应。
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, origin func(string) bool) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("method %s", r.Method)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+	if o := r.Header.Get("Origin"); o != "" && !origin(o) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("origin %s not allowed", o)
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The handshake deadline is cleared once the response is written.
+	_ = conn.SetDeadline(time.Now().Add(wsWriteTimeout))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+// websocketAccept 计算握手响应中的 Sec-WebSocket-Accept。
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains 判断逗号分隔的请求头中是否包含 token（不区分大小写）。
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame 发送一个不分片、不加掩码的帧。
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// writeText 发送文本帧。
+func (c *wsConn) writeText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// readLoop 读取客户端发来的帧：应答 ping，收到关闭帧或连接出错时返回。其他帧被丢弃。
+func (c *wsConn) readLoop() error {
+	for {
+		op, payload, err := readWSFrame(c.rw.Reader)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return err
+			}
+		case wsOpClose:
+			// Echo the status code back as required by the closing handshake.
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			_ = c.writeFrame(wsOpClose, payload)
+			return nil
+		}
+	}
+}
+
+// readWSFrame 读取一个客户端帧并去掉掩码。客户端帧必须带掩码，负载不能超过 wsMaxControlPayload。
+func readWSFrame(r io.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	n := int(head[1] & 0x7F)
+	if n > wsMaxControlPayload {
+		return 0, nil, fmt.Errorf("client frame of %d bytes exceeds %d", n, wsMaxControlPayload)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+// close 发送关闭帧并关闭连接。
+func (c *wsConn) close(code uint16) {
+	_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, code))
+	c.conn.Close()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// workerMap 是写时复制的流工作器映射表。读取方（状态查询、指标、看门狗和各监控）拿到的是不可变的快照，
+// 不需要加锁，也不会排在重载之后；增删工作器时复制整张表，修改后原子替换。工作器自身的状态由 StreamWorker.mu 保护。
+type workerMap struct {
+	// current 指向当前的映射表，发布后不再修改。
+	current atomic.Pointer[map[string]*StreamWorker]
+	// mu 串行化写入，避免并发的复制互相覆盖。
+	mu sync.Mutex
+}
+
+// newWorkerMap 以 workers 的副本创建映射表。
+func newWorkerMap(workers map[string]*StreamWorker) *workerMap {
+	m := &workerMap{}
+	cp := make(map[string]*StreamWorker, len(workers))
+	for id, w := range workers {
+		cp[id] = w
+	}
+	m.current.Store(&cp)
+	return m
+}
+
+// snapshot 返回当前的映射表，调用方不能修改它。
+func (m *workerMap) snapshot() map[string]*StreamWorker {
+	if m == nil {
+		return nil
+	}
+	if p := m.current.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// get 返回指定 ID 的工作器。
+func (m *workerMap) get(id string) (*StreamWorker, bool) {
+	w, ok := m.snapshot()[id]
+	return w, ok
+}
+
+// len 返回工作器数量。
+func (m *workerMap) len() int {
+	return len(m.snapshot())
+}
+
+// update 在当前映射表的副本上执行 fn，然后原子替换。fn 中不能调用 update。
+func (m *workerMap) update(fn func(workers map[string]*StreamWorker)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.snapshot()
+	cp := make(map[string]*StreamWorker, len(old))
+	for id, w := range old {
+		cp[id] = w
+	}
+	fn(cp)
+	m.current.Store(&cp)
+}
+
+// store 添加或替换一个工作器。
+func (m *workerMap) store(id string, w *StreamWorker) {
+	m.update(func(workers map[string]*StreamWorker) { workers[id] = w })
+}
+
+// remove 删除一个工作器，返回被删除的工作器。
+func (m *workerMap) remove(id string) (*StreamWorker, bool) {
+	var removed *StreamWorker
+	var ok bool
+	m.update(func(workers map[string]*StreamWorker) {
+		if removed, ok = workers[id]; ok {
+			delete(workers, id)
+		}
+	})
+	return removed, ok
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestWorkerMap 测试快照不受之后的增删影响，并发读写时读取方不需要加锁
+func TestWorkerMap(t *testing.T) {
+	a := &StreamWorker{cfg: StreamConfig{ID: "a"}}
+	m := newWorkerMap(map[string]*StreamWorker{"a": a})
+	before := m.snapshot()
+
+	m.store("b", &StreamWorker{cfg: StreamConfig{ID: "b"}})
+	if w, ok := m.remove("a"); !ok || w != a {
+		t.Fatalf("remove returned %v, %v", w, ok)
+	}
+	if _, ok := m.remove("a"); ok {
+		t.Error("removed a twice")
+	}
+	if len(before) != 1 || before["a"] != a {
+		t.Errorf("earlier snapshot changed: %v", before)
+	}
+	if _, ok := m.get("b"); !ok || m.len() != 1 {
+		t.Errorf("snapshot = %v", m.snapshot())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.store(fmt.Sprintf("w%d-%d", i, j), &StreamWorker{})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for range m.snapshot() {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := m.len(); n != 401 {
+		t.Errorf("len = %d, want 401", n)
+	}
+
+	var empty *workerMap
+	if _, ok := empty.get("a"); ok || empty.len() != 0 {
+		t.Error("nil map is not empty")
+	}
+}